@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"podman-k8s-adapter/pkg/config"
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// backupTimeout bounds the download or collection of a backup, and each pod restore
+const backupTimeout = 10 * time.Minute
+
+// runBackup implements the backup subcommand: it writes the backup of a running server,
+// downloaded from /debug/backup, or with -local one collected without the server, from the
+// state directory and nodes of a config file
+func runBackup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	var (
+		serverURL  = flags.String("server", "https://127.0.0.1:8443", "URL of the running server")
+		tokenFile  = flags.String("token-file", "", "File holding the debug token of the server (its --debug-token-file)")
+		caFile     = flags.String("certificate-authority", filepath.Join(defaultStateDir(), "pki", "ca.crt"), "CA certificate the server certificate is verified with")
+		insecure   = flags.Bool("insecure-skip-tls-verify", false, "Do not verify the server certificate")
+		local      = flags.Bool("local", false, "Collect the backup without the server, from its state directory and nodes")
+		configFile = flags.String("config", "", "With -local, config file of the server, whose settings select the state directory and nodes")
+		stateDir   = flags.String("state-dir", "", "With -local, state directory of the server (default the one of -config, else "+defaultStateDir()+")")
+		keys       = flags.Bool("include-keys", false, "With -local, include the private keys of the self-signed certificates, so that the restored server keeps its CA")
+		output     = flags.String("o", "", "File the backup is written to, - for stdout (default podkube-backup-TIMESTAMP.tar.gz)")
+	)
+	flags.Parse(args)
+	if *keys && !*local {
+		return fmt.Errorf("-include-keys requires -local: the server never serves its private keys")
+	}
+
+	if *output == "" {
+		*output = "podkube-backup-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	}
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+	var err error
+	if *local {
+		err = writeLocalBackup(ctx, out, *configFile, *stateDir, *keys)
+	} else {
+		err = downloadDebug(ctx, out, "/debug/backup", *serverURL, *tokenFile, *caFile, *insecure)
+	}
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", *output)
+	}
+	return nil
+}
+
+// localSettings returns the flag values of a config file, none without one, and the state
+// directory they set unless stateDir overrides it
+func localSettings(configFile, stateDir string) (map[string]string, string, error) {
+	values := map[string]string{}
+	if configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return nil, "", err
+		}
+		values = cfg.FlagValues()
+	}
+	if stateDir == "" {
+		stateDir = values["state-dir"]
+	}
+	if stateDir == "" {
+		stateDir = defaultStateDir()
+	}
+	return values, stateDir, nil
+}
+
+// writeLocalBackup writes a backup collected without the server, for the state directory and
+// nodes set by a config file, with the private keys when includeKeys is set
+func writeLocalBackup(ctx context.Context, out io.Writer, configFile, stateDir string, includeKeys bool) error {
+	values, stateDir, err := localSettings(configFile, stateDir)
+	if err != nil {
+		return err
+	}
+	nodes, err := configNodes(values)
+	if err != nil {
+		return err
+	}
+	index, err := server.WriteBackup(ctx, out, stateDir, storage.NewCluster(nodes...), includeKeys)
+	if err != nil {
+		return err
+	}
+	for _, skipped := range index.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: incomplete backup: %s\n", skipped)
+	}
+	return nil
+}
+
+// runRestore implements the restore subcommand: it writes the state files of a backup to the
+// state directory, and with -play recreates its pods from their manifests. It runs while the
+// server is stopped, which loads the restored state when it starts.
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	var (
+		configFile = flags.String("config", "", "Config file of the server, whose settings select the state directory and nodes")
+		stateDir   = flags.String("state-dir", "", "State directory of the server (default the one of -config, else "+defaultStateDir()+")")
+		force      = flags.Bool("force", false, "Overwrite the state files that already exist")
+		play       = flags.Bool("play", false, "Recreate the pods of the backup with podman kube play on the nodes they ran on")
+		node       = flags.String("node", "", "With -play, recreate every pod on this node instead")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s restore [flags] BACKUP\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected the backup file")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	backup, err := server.ReadBackup(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	values, dir, err := localSettings(*configFile, *stateDir)
+	if err != nil {
+		return err
+	}
+
+	if err := restoreState(backup, dir, *force); err != nil {
+		return err
+	}
+	if !*play {
+		if len(backup.Index.Pods) > 0 {
+			fmt.Fprintf(os.Stderr, "The backup holds the manifests of %d pods, use -play to recreate them\n", len(backup.Index.Pods))
+		}
+		return nil
+	}
+
+	nodes, err := configNodes(values)
+	if err != nil {
+		return err
+	}
+	return restorePods(backup, nodes, *node)
+}
+
+// restoreState writes the state files of a backup to stateDir, refusing to overwrite existing
+// ones unless force is set
+func restoreState(backup *server.Backup, stateDir string, force bool) error {
+	names := make([]string, 0, len(backup.State))
+	for name := range backup.State {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !force {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(stateDir, filepath.FromSlash(name))); err == nil {
+				return fmt.Errorf("%s already exists in %s, use -force to overwrite the state", name, stateDir)
+			}
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(stateDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, backup.State[name], 0600); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Restored %s\n", path)
+	}
+	return nil
+}
+
+// restorePods recreates the pods of a backup with podman kube play on the nodes they ran on,
+// or all on the named node; every pod is attempted, and the failures are reported together
+func restorePods(backup *server.Backup, nodes []*storage.Node, nodeName string) error {
+	byName := map[string]*storage.Node{}
+	for _, node := range nodes {
+		byName[node.Name] = node
+	}
+	if nodeName != "" && byName[nodeName] == nil {
+		return fmt.Errorf("node %q does not exist", nodeName)
+	}
+
+	var failed []string
+	for _, pod := range backup.Index.Pods {
+		target := pod.Node
+		if nodeName != "" {
+			target = nodeName
+		}
+		err := playManifest(byName[target], backup.Manifests[pod.Manifest])
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Recreated pod %s/%s on node %s\n", pod.Namespace, pod.Name, target)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to recreate %d pods:\n  %s", len(failed), strings.Join(failed, "\n  "))
+	}
+	return nil
+}
+
+// playManifest runs podman kube play with a manifest on a node
+func playManifest(node *storage.Node, manifest []byte) error {
+	if node == nil {
+		return fmt.Errorf("its node does not exist, use -node to pick another")
+	}
+	if node.Storage.Runtime() != storage.RuntimePodman {
+		return fmt.Errorf("node %s runs %s, which cannot play manifests", node.Name, node.Storage.Runtime())
+	}
+	if manifest == nil {
+		return fmt.Errorf("manifest missing from the backup")
+	}
+
+	file, err := os.CreateTemp("", "podkube-restore-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(manifest)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backupTimeout)
+	defer cancel()
+	args := node.Storage.CommandLine("kube", "play", file.Name())
+	if output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("podman kube play failed: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
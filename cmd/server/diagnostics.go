@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"podman-k8s-adapter/pkg/config"
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// diagnosticsTimeout bounds the download or collection of a diagnostics bundle
+const diagnosticsTimeout = 5 * time.Minute
+
+// runDiagnostics implements the diagnostics subcommand: it writes the diagnostics bundle of
+// a running server, downloaded from /debug/bundle, or with -local one collected without the
+// server, from the settings of a config file, for when the server does not answer
+func runDiagnostics(args []string) error {
+	flags := flag.NewFlagSet("diagnostics", flag.ExitOnError)
+	var (
+		serverURL  = flags.String("server", "https://127.0.0.1:8443", "URL of the running server")
+		tokenFile  = flags.String("token-file", "", "File holding the debug token of the server (its --debug-token-file)")
+		caFile     = flags.String("certificate-authority", filepath.Join(defaultStateDir(), "pki", "ca.crt"), "CA certificate the server certificate is verified with")
+		insecure   = flags.Bool("insecure-skip-tls-verify", false, "Do not verify the server certificate")
+		local      = flags.Bool("local", false, "Collect the bundle without the server: version, config, audit log and runtime state")
+		configFile = flags.String("config", "", "With -local, config file of the server, whose settings select the runtime, nodes and audit log")
+		output     = flags.String("o", "", "File the bundle is written to, - for stdout (default podkube-diagnostics-TIMESTAMP.tar.gz)")
+	)
+	flags.Parse(args)
+
+	if *output == "" {
+		*output = "podkube-diagnostics-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	}
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	var err error
+	if *local {
+		err = writeLocalBundle(ctx, out, *configFile)
+	} else {
+		err = downloadDebug(ctx, out, "/debug/bundle", *serverURL, *tokenFile, *caFile, *insecure)
+	}
+	if err != nil {
+		if *output != "-" {
+			os.Remove(*output)
+		}
+		return err
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "Wrote %s\n", *output)
+	}
+	return nil
+}
+
+// downloadDebug writes what a debug endpoint of a running server, such as /debug/bundle,
+// answers to the debug token
+func downloadDebug(ctx context.Context, out io.Writer, endpoint, serverURL, tokenFile, caFile string, insecure bool) error {
+	if tokenFile == "" {
+		return fmt.Errorf("-token-file is required to download from a server, or use -local")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read debug token: %v", err)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if !insecure {
+		if pem, err := os.ReadFile(caFile); err == nil {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificate found in %s", caFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(serverURL, "/")+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the server, use -local to do without it: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("server answered %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// writeLocalBundle writes a diagnostics bundle collected without the server, for the runtime,
+// nodes and audit log set by a config file
+func writeLocalBundle(ctx context.Context, out io.Writer, configFile string) error {
+	values := map[string]string{}
+	sources := server.BundleSources{Commands: map[string][]string{}, Files: map[string][]byte{}}
+	if configFile != "" {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return err
+		}
+		values = cfg.FlagValues()
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		sources.Files["config.yaml"] = data
+	}
+	sources.Flags = values
+	sources.AuditLogPath = values["audit-log-path"]
+
+	nodes, err := configNodes(values)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		sources.Commands["nodes/"+node.Name+"/info.txt"] = node.Storage.CommandLine("info")
+		sources.Commands["nodes/"+node.Name+"/ps.txt"] = node.Storage.CommandLine("ps", "--all")
+	}
+	return server.WriteBundle(ctx, out, sources)
+}
+
+// configNodes returns the nodes set by the flag values of a config file
+func configNodes(values map[string]string) ([]*storage.Node, error) {
+	runtime := values["runtime"]
+	if runtime == "" {
+		runtime = storage.RuntimePodman
+	}
+	rootful, _ := strconv.ParseBool(values["rootful"])
+	var nodeSpecs, nodeLabelSpecs stringSliceFlag
+	nodeSpecs.Set(values["node"])
+	nodeLabelSpecs.Set(values["node-label"])
+	return buildNodes(runtime, nodeSpecs, nodeLabelSpecs, values["podman-connection"], values["podman-identity"], rootful)
+}
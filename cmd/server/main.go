@@ -1,40 +1,552 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"k8s.io/klog/v2"
 
+	"podman-k8s-adapter/pkg/config"
 	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/pkg/version"
 )
 
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 10 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		printVersion()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diagnostics" {
+		if err := runDiagnostics(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		if err := runBackup(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore" {
+		if err := runRestore(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		port     = flag.Int("port", 8443, "Port to serve on")
+		port     = flag.Int("port", 8443, "Port to serve HTTPS on (0 disables the HTTPS listener)")
 		host     = flag.String("host", "0.0.0.0", "Host to serve on")
 		certFile = flag.String("cert-file", "", "Path to TLS certificate file")
 		keyFile  = flag.String("key-file", "", "Path to TLS private key file")
+
+		insecurePort        = flag.Int("insecure-port", 0, "Port to serve unauthenticated plain HTTP on, for local health checks and scraping (0 disables the HTTP listener)")
+		insecureBindAddress = flag.String("insecure-bind-address", "127.0.0.1", "Loopback address to serve plain HTTP on")
+
+		auditLogPath = flag.String("audit-log-path", "", "If set, write audit events as JSON lines to this file ('-' for stdout)")
+		auditLevel   = flag.String("audit-level", "Metadata", "Audit level: Metadata or RequestResponse")
+
+		cacheTTL    = flag.Duration("cache-ttl", 2*time.Second, "How long container listings are served from memory when podman events are unavailable (0 disables caching)")
+		parallelism = flag.Int("podman-parallelism", 8, "Maximum number of concurrent per-container podman calls (kube generate, inspect) during a list")
+		cmdTimeout  = flag.Duration("podman-command-timeout", 60*time.Second, "Maximum duration of a single non-streaming podman call (0 disables the limit)")
+
+		containerRuntime = flag.String("runtime", storage.RuntimePodman, "Container runtime backing the nodes: podman or docker")
+		podmanConnection = flag.String("podman-connection", "", "Remote podman service to use instead of the local one: a URL (ssh://user@host/run/podman/podman.sock, unix:///path/podman.sock) or a 'podman system connection' name such as podman-machine-default")
+		podmanIdentity   = flag.String("podman-identity", "", "SSH private key for ssh:// podman connections")
+
+		rootful     = flag.Bool("rootful", false, "Also expose the system (rootful) podman, through its service socket "+storage.RootfulConnection+", as a separate node named <hostname>-rootful")
+		defaultNode = flag.String("default-node", "", "Node on which pods without nodeName or nodeSelector are created (default: round-robin over reachable nodes)")
+
+		tolerateUnsupported = flag.Bool("tolerate-unsupported-fields", false, "Create pods using fields that cannot be honored (affinity, volumes, probes...) with a warning per field instead of rejecting them")
+		hideInternal        = flag.Bool("hide-internal-annotations", false, "Serve pods without the annotations set by podKube and the container runtime (podman.io/*, docker.io/*...), only with the annotations they were created with")
+		podColumns          = flag.String("pod-columns", "", "Custom columns of pod tables (oc get pods) in the kubectl custom-columns format, e.g. NAME:.metadata.name,NODE:.spec.nodeName,IMAGES:.spec.containers[*].image (default: podman-flavored columns)")
+		allowRecreate       = flag.Bool("allow-pod-recreate-on-update", false, "Apply pod updates changing the image or env of containers by stopping, removing and re-running the container under the same name, instead of rejecting them")
+		allowSystemdDelete  = flag.Bool("allow-systemd-delete", false, "Delete the pods of containers managed by systemd units (Quadlet, podman generate systemd), which are otherwise only deleted with --force --grace-period=0 as the unit would run them again, and garbage collect their exited containers")
+		defaultPodLabels    = flag.String("default-pod-labels", "", "Labels set on created pods that do not set them, e.g. app.kubernetes.io/managed-by=podkube,env=dev")
+		defaultRequests     = flag.String("default-container-requests", "", "Requests set on the containers of created pods that do not set them, like a LimitRange defaultRequest, e.g. cpu=100m,memory=64Mi (default: the container limits)")
+		defaultLimits       = flag.String("default-container-limits", "", "Limits set on the containers of created pods that do not set them, like a LimitRange default, e.g. cpu=1,memory=512Mi")
+		podUsage            = flag.Bool("pod-usage-annotations", false, "Annotate pods read one at a time (kubectl get pod NAME) with the CPU and memory usage of their running containers, and projects and namespaces with the total usage of their pods, sampled with podman stats and cached for 10s")
+		routePortForwards   = flag.Bool("route-port-forwards", false, "Store OpenShift routes and admit them at the host port their pod publishes for the route target port, instead of accepting and dropping them")
+		kubernetesService   = flag.Bool("kubernetes-service", false, "Give the containers of created pods the KUBERNETES_SERVICE_HOST/PORT environment and resolve kubernetes.default.svc to the host, and serve the kubernetes service of the default namespace, so that in-cluster clients reach podKube on --port")
+
+		gcExitedAfter = flag.Duration("gc-exited-after", 0, "Remove exited containers (the containers-exited namespace) this long after they exited, e.g. 24h (0 keeps them)")
+		gcMaxExited   = flag.Int("gc-max-exited", 0, "Maximum number of exited containers kept per node, the oldest being removed first (0 means no limit)")
+
+		maxExecSessions       = flag.Int("max-exec-sessions", 64, "Maximum number of concurrent exec sessions, beyond which exec requests get 429 Too Many Requests (0 means no limit)")
+		streamCreationTimeout = flag.Duration("stream-creation-timeout", server.DefaultStreamCreationTimeout, "How long exec clients may take to create the streams of a session, overridable per request with the streamCreationTimeout parameter")
+		execTranscriptDir     = flag.String("exec-transcript-dir", "", "Directory where the transcripts of exec sessions, their stdin, stdout and stderr, are recorded for compliance; sessions whose transcript cannot be written are refused (empty disables transcripts)")
+		streamIdleTimeout     = flag.Duration("stream-idle-timeout", server.DefaultStreamIdleTimeout, "How long the streams of an exec session may stay idle before it is closed, overridable per request with the streamIdleTimeout parameter (0 disables the timeout)")
+
+		breakerThreshold = flag.Int("podman-failure-threshold", 5, "Consecutive podman failures before requests fail fast and cached data is served (0 disables the circuit breaker)")
+		breakerCooldown  = flag.Duration("podman-breaker-cooldown", 30*time.Second, "How long the podman circuit breaker stays open before probing podman again")
+
+		nodeLogUnits = flag.String("node-log-units", "podman.service,podman.socket", "Journald units whose journal is served by /logs/?query=UNIT and the node logs proxy, those of the user manager when running rootless")
+		nodeLogFiles = flag.String("node-log-files", "", "Host log files served by /logs/NAME and the node logs proxy, written path or name=path, e.g. /var/log/containers.log (podKube's own --log_file is always served, as podkube.log)")
+
+		authorizationMode = flag.String("authorization-mode", server.AuthorizationModeAlwaysAllow, "Comma-separated authorization modes asked in order, the first allowing or denying a request deciding: AlwaysAllow, AlwaysDeny, Node, SimpleRBAC (token holders get full access, narrowed by the podkube:read-only and podkube:namespace:NAME groups) and AlwaysAllowReadOnlyForAnonymous, e.g. Node,SimpleRBAC,AlwaysAllowReadOnlyForAnonymous")
+		tokenAuthFile     = flag.String("token-auth-file", "", "Static token file authenticating bearer tokens, with a token,user,uid,\"group1,group2\" line per token as for kube-apiserver (empty: bearer tokens are ignored)")
+		anonymousAuth     = flag.Bool("anonymous-auth", true, "Serve the requests without credentials as the system:anonymous user of the system:unauthenticated group; when false they are rejected with 401 Unauthorized, which requires --token-auth-file (health probes and the loopback --insecure-port listener excepted)")
+
+		debugTokenFile = flag.String("debug-token-file", "", "File holding the bearer token required by /debug/bundle and /debug/backup, the diagnostics bundle and backup endpoints (empty disables them)")
+
+		shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "On SIGTERM/SIGINT, how long to wait for in-flight exec and log sessions before exiting")
+
+		encryptionConfig = flag.String("encryption-provider-config", "", "kube-apiserver EncryptionConfiguration file whose aesgcm and identity providers encrypt the state podKube persists in --state-dir (namespaces, pods and routes) at rest")
+
+		logFormat = flag.String("log-format", "text", "Log format: text, the klog format, or json, one JSON object per line with the structured fields of each message (requestID, verb, resource, namespace, latency...), written to --log_file when set")
+
+		stateDir = flag.String("state-dir", defaultStateDir(), "Directory where the state podKube owns, such as the self-signed CA and serving certificate, namespace annotations, pod finalizers and routes, is persisted (empty keeps it in memory)")
+
+		configFile = flag.String("config", "", "Path to a YAML config file; settings it defines supersede the matching flags and are reloaded on SIGHUP or when the file changes")
 	)
 
+	var tlsSANs, nodeSpecs, nodeLabelSpecs stringSliceFlag
+	flag.Var(&nodeSpecs, "node", "Podman backend exposed as a Node, as name=connection where connection is a URL or 'podman system connection' name, empty for the local podman (repeatable)")
+	flag.Var(&nodeLabelSpecs, "node-label", "Label of a node, as name:key=value, matched against pod nodeSelectors (repeatable)")
+	flag.Var(&tlsSANs, "tls-san", "Additional hostname or IP address for the self-signed serving certificate (repeatable or comma-separated)")
+
 	klog.InitFlags(nil)
 	flag.Parse()
+	commandLine := config.Snapshot(flag.CommandLine)
+
+	// Admission webhooks are only configured by the config file
+	var webhooks []config.WebhookConfig
+	if *configFile != "" {
+		cfg, err := applyConfigFile(*configFile, commandLine, false)
+		if err != nil {
+			klog.Fatalf("%v", err)
+		}
+		webhooks = cfg.Admission.Webhooks
+		klog.Infof("Loaded config file %s", *configFile)
+	}
 
-	klog.Infof("Starting Podman Kubernetes API Server...")
-	klog.Infof("Listening on %s:%d", *host, *port)
+	if err := setLogFormat(*logFormat); err != nil {
+		klog.Fatalf("Invalid --log-format: %v", err)
+	}
+
+	if *port == 0 && *insecurePort == 0 {
+		klog.Fatalf("Both the HTTPS (--port) and HTTP (--insecure-port) listeners are disabled")
+	}
+
+	klog.Infof("Starting Podman Kubernetes API Server %s...", version.Tag())
+	if *port != 0 {
+		klog.Infof("Listening on %s:%d", *host, *port)
+	}
 
 	// Create the API server
 	apiServer := server.New(*host, *port)
+	nodes, err := buildNodes(*containerRuntime, nodeSpecs, nodeLabelSpecs, *podmanConnection, *podmanIdentity, *rootful)
+	if err != nil {
+		klog.Fatalf("%v", err)
+	}
+	if err := apiServer.SetNodes(nodes, *defaultNode); err != nil {
+		klog.Fatalf("%v", err)
+	}
+	apiServer.SetCacheTTL(*cacheTTL)
+	apiServer.SetPodmanParallelism(*parallelism)
+	apiServer.SetPodmanCommandTimeout(*cmdTimeout)
+	apiServer.SetCircuitBreaker(*breakerThreshold, *breakerCooldown)
+	apiServer.SetTolerateUnsupportedFields(*tolerateUnsupported)
+	apiServer.SetHideInternalAnnotations(*hideInternal)
+	apiServer.SetAllowPodRecreateOnUpdate(*allowRecreate)
+	apiServer.SetAllowSystemdDelete(*allowSystemdDelete)
+	apiServer.SetPodUsageAnnotations(*podUsage)
+	apiServer.SetRoutePortForwards(*routePortForwards)
+	if err := apiServer.SetAdmissionDefaults(*defaultPodLabels, *defaultRequests, *defaultLimits); err != nil {
+		klog.Fatalf("Invalid admission defaults: %v", err)
+	}
+	if err := apiServer.SetAdmissionWebhooks(webhooks); err != nil {
+		klog.Fatalf("Invalid admission webhooks: %v", err)
+	}
+	apiServer.SetMaxExecSessions(*maxExecSessions)
+	if err := apiServer.SetStreamTimeouts(*streamCreationTimeout, *streamIdleTimeout); err != nil {
+		klog.Fatalf("Invalid stream timeouts: %v", err)
+	}
+	if err := apiServer.SetPodColumns(*podColumns); err != nil {
+		klog.Fatalf("Invalid --pod-columns: %v", err)
+	}
+	apiServer.SetGarbageCollection(*gcExitedAfter, *gcMaxExited)
+	if err := apiServer.SetNodeLogs(*nodeLogUnits, withOwnLogFile(*nodeLogFiles)); err != nil {
+		klog.Fatalf("Invalid --node-log-files: %v", err)
+	}
+	if err := apiServer.SetExecTranscriptDir(*execTranscriptDir); err != nil {
+		klog.Fatalf("Invalid --exec-transcript-dir: %v", err)
+	}
+	if err := apiServer.SetDiagnostics(*debugTokenFile, flagValues(), *auditLogPath); err != nil {
+		klog.Fatalf("Invalid --debug-token-file: %v", err)
+	}
+	if err := apiServer.SetAuthorization(*authorizationMode, *tokenAuthFile, *anonymousAuth); err != nil {
+		klog.Fatalf("Invalid authorization settings: %v", err)
+	}
+	if err := apiServer.SetKubernetesService(*kubernetesService); err != nil {
+		klog.Fatalf("Invalid --kubernetes-service: %v", err)
+	}
+	apiServer.SetSelfSignedCertConfig(*stateDir, tlsSANs)
+	if err := apiServer.SetStateDir(*stateDir, *encryptionConfig); err != nil {
+		klog.Fatalf("Failed to load the state: %v", err)
+	}
+	if *insecurePort != 0 {
+		if err := apiServer.SetInsecureServing(*insecureBindAddress, *insecurePort); err != nil {
+			klog.Fatalf("%v", err)
+		}
+	}
+
+	// Configure audit logging
+	if *auditLogPath != "" {
+		auditLogger, err := server.NewAuditLogger(*auditLogPath, server.AuditLevel(*auditLevel))
+		if err != nil {
+			klog.Fatalf("Failed to set up audit logging: %v", err)
+		}
+		defer auditLogger.Close()
+		klog.Infof("Writing %s audit events to %s", *auditLevel, *auditLogPath)
+		apiServer.SetAuditLogger(auditLogger)
+	}
+
+	// Reload runtime settings when the config file changes
+	var reloadMu sync.Mutex
+	reloadConfig := func() {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		cfg, err := applyConfigFile(*configFile, commandLine, true)
+		if err != nil {
+			klog.Errorf("Failed to reload config, keeping current settings: %v", err)
+			return
+		}
+
+		apiServer.SetCacheTTL(*cacheTTL)
+		apiServer.SetPodmanParallelism(*parallelism)
+		apiServer.SetPodmanCommandTimeout(*cmdTimeout)
+		apiServer.SetCircuitBreaker(*breakerThreshold, *breakerCooldown)
+		apiServer.SetTolerateUnsupportedFields(*tolerateUnsupported)
+		apiServer.SetHideInternalAnnotations(*hideInternal)
+		apiServer.SetAllowPodRecreateOnUpdate(*allowRecreate)
+		apiServer.SetAllowSystemdDelete(*allowSystemdDelete)
+		apiServer.SetPodUsageAnnotations(*podUsage)
+		apiServer.SetRoutePortForwards(*routePortForwards)
+		if err := apiServer.SetAdmissionDefaults(*defaultPodLabels, *defaultRequests, *defaultLimits); err != nil {
+			klog.Errorf("Invalid admission defaults, keeping the current ones: %v", err)
+		}
+		if err := apiServer.SetAdmissionWebhooks(cfg.Admission.Webhooks); err != nil {
+			klog.Errorf("Invalid admission webhooks, keeping the current ones: %v", err)
+		}
+		apiServer.SetMaxExecSessions(*maxExecSessions)
+		if err := apiServer.SetStreamTimeouts(*streamCreationTimeout, *streamIdleTimeout); err != nil {
+			klog.Errorf("Invalid stream timeouts, keeping the current ones: %v", err)
+		}
+		if err := apiServer.SetPodColumns(*podColumns); err != nil {
+			klog.Errorf("Invalid pod columns, keeping the current ones: %v", err)
+		}
+		apiServer.SetGarbageCollection(*gcExitedAfter, *gcMaxExited)
+		if err := apiServer.SetNodeLogs(*nodeLogUnits, withOwnLogFile(*nodeLogFiles)); err != nil {
+			klog.Errorf("Invalid node log files, keeping the current ones: %v", err)
+		}
+		if err := apiServer.SetExecTranscriptDir(*execTranscriptDir); err != nil {
+			klog.Errorf("Invalid exec transcript directory, keeping the current one: %v", err)
+		}
+		if err := apiServer.SetDiagnostics(*debugTokenFile, flagValues(), *auditLogPath); err != nil {
+			klog.Errorf("Invalid debug token file, keeping the current one: %v", err)
+		}
+		if err := apiServer.SetAuthorization(*authorizationMode, *tokenAuthFile, *anonymousAuth); err != nil {
+			klog.Errorf("Invalid authorization settings, keeping the current ones: %v", err)
+		}
+		klog.Infof("Reloaded config file %s", *configFile)
+	}
+	if *configFile != "" {
+		go config.Watch(*configFile, configPollInterval, apiServer.ShutdownCh(), reloadConfig)
+	}
+
+	// SIGHUP reloads the config file and the TLS certificate
+	go func() {
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		for range hangups {
+			klog.Infof("Received SIGHUP, reloading")
+			if *configFile != "" {
+				reloadConfig()
+			}
+			if err := apiServer.ReloadCertificate(); err != nil {
+				klog.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+			}
+		}
+	}()
+
+	// Shut down gracefully on SIGTERM/SIGINT
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		sig := <-signals
+		klog.Infof("Received %v, shutting down (timeout %v)", sig, *shutdownTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := apiServer.Shutdown(ctx); err != nil {
+			klog.Warningf("Graceful shutdown incomplete: %v", err)
+		}
+	}()
+
+	// Start the listeners; the first one to stop ends the server
+	serveErrors := make(chan error, 2)
+	if *insecurePort != 0 {
+		go func() {
+			serveErrors <- apiServer.ListenAndServeInsecure()
+		}()
+	}
+	if *port != 0 {
+		go func() {
+			// Configure TLS
+			if *certFile != "" && *keyFile != "" {
+				klog.Infof("Using provided TLS certificate: %s", *certFile)
+				serveErrors <- apiServer.ListenAndServeTLS(*certFile, *keyFile)
+			} else {
+				serveErrors <- apiServer.ListenAndServeTLSWithSelfSigned()
+			}
+		}()
+	}
+	if err := <-serveErrors; err != http.ErrServerClosed {
+		klog.Fatalf("Failed to start server: %v", err)
+	}
+
+	<-shutdownDone
+	klog.Infof("Server stopped")
+	klog.Flush()
+}
+
+// restartOnlyFlags are the settings that cannot change while the server is running
+var restartOnlyFlags = map[string]bool{
+	"host":                       true,
+	"port":                       true,
+	"insecure-port":              true,
+	"insecure-bind-address":      true,
+	"cert-file":                  true,
+	"key-file":                   true,
+	"audit-log-path":             true,
+	"audit-level":                true,
+	"state-dir":                  true,
+	"encryption-provider-config": true,
+	"tls-san":                    true,
+	"runtime":                    true,
+	"podman-connection":          true,
+	"podman-identity":            true,
+	"node":                       true,
+	"node-label":                 true,
+	"rootful":                    true,
+	"default-node":               true,
+	"log-format":                 true,
+	"kubernetes-service":         true,
+}
+
+// applyConfigFile loads the config file and sets the flags to their command line value
+// overridden by its settings, returning it for the settings that have no flag. On error no
+// flag is changed. When reloading, settings that require a restart are left untouched.
+func applyConfigFile(path string, commandLine map[string]string, reloading bool) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keep map[string]bool
+	if reloading {
+		keep = restartOnlyFlags
+	}
+	previous := config.Snapshot(flag.CommandLine)
+	if err := cfg.Apply(flag.CommandLine, commandLine, keep); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
 
-	// Configure TLS
-	if *certFile != "" && *keyFile != "" {
-		klog.Infof("Using provided TLS certificate: %s", *certFile)
-		if err := apiServer.ListenAndServeTLS(*certFile, *keyFile); err != nil {
-			klog.Fatalf("Failed to start HTTPS server: %v", err)
+	if reloading {
+		for name, value := range cfg.FlagValues() {
+			if restartOnlyFlags[name] && previous[name] != value {
+				klog.Warningf("Config setting %s changed to %q, this takes effect after a restart", name, value)
+			}
 		}
-	} else {
-		klog.Infof("Generating self-signed certificate...")
-		if err := apiServer.ListenAndServeTLSWithSelfSigned(); err != nil {
-			klog.Fatalf("Failed to start HTTPS server with self-signed cert: %v", err)
+	}
+	return cfg, nil
+}
+
+// buildNodes creates the runtime backends from the --node and --node-label flags. Without
+// --node, the local runtime (or --podman-connection) is the single node, named after the host.
+// With rootful, the system podman socket is added as a <hostname>-rootful node.
+func buildNodes(runtime string, nodeSpecs, nodeLabelSpecs []string, defaultConnection, identity string, rootful bool) ([]*storage.Node, error) {
+	if len(nodeSpecs) == 0 {
+		nodeSpecs = []string{storage.DefaultNodeName() + "=" + defaultConnection}
+	}
+	if rootful && runtime != storage.RuntimePodman {
+		return nil, fmt.Errorf("--rootful requires --runtime=%s", storage.RuntimePodman)
+	}
+	if rootful {
+		if os.Geteuid() == 0 {
+			klog.Warningf("--rootful has no effect when running as root, the local podman already is rootful")
+		} else {
+			nodeSpecs = append(nodeSpecs, storage.DefaultNodeName()+"-rootful="+storage.RootfulConnection)
 		}
 	}
+
+	nodeLabels := map[string]map[string]string{}
+	for _, spec := range nodeLabelSpecs {
+		name, label, ok := strings.Cut(spec, ":")
+		key, value, hasValue := strings.Cut(label, "=")
+		if !ok || !hasValue || key == "" {
+			return nil, fmt.Errorf("invalid --node-label %q, expected name:key=value", spec)
+		}
+		setNodeLabel(nodeLabels, name, key, value)
+	}
+
+	var nodes []*storage.Node
+	seen := map[string]bool{}
+	for _, spec := range nodeSpecs {
+		name, connection, _ := strings.Cut(spec, "=")
+		if name == "" || seen[name] {
+			return nil, fmt.Errorf("invalid --node %q, expected a unique name=connection", spec)
+		}
+		seen[name] = true
+
+		// Tell rootless and rootful podman apart when it is known from the connection
+		if _, ok := nodeLabels[name][storage.RootlessLabel]; !ok && runtime == storage.RuntimePodman {
+			switch connection {
+			case "":
+				setNodeLabel(nodeLabels, name, storage.RootlessLabel, strconv.FormatBool(os.Geteuid() != 0))
+			case storage.RootfulConnection:
+				setNodeLabel(nodeLabels, name, storage.RootlessLabel, "false")
+			}
+		}
+
+		node, err := storage.NewNode(name, runtime, connection, identity, nodeLabels[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid node %s: %v", name, err)
+		}
+		if connection != "" {
+			klog.Infof("Node %s uses %s connection %s", name, runtime, connection)
+		} else {
+			klog.Infof("Node %s uses the local %s", name, runtime)
+		}
+		nodes = append(nodes, node)
+	}
+
+	for name := range nodeLabels {
+		if !seen[name] {
+			return nil, fmt.Errorf("--node-label refers to unknown node %q", name)
+		}
+	}
+
+	return nodes, nil
+}
+
+// setNodeLabel records a label for the named node
+func setNodeLabel(nodeLabels map[string]map[string]string, name, key, value string) {
+	if nodeLabels[name] == nil {
+		nodeLabels[name] = map[string]string{}
+	}
+	nodeLabels[name][key] = value
+}
+
+// stringSliceFlag is a flag that can be repeated or given a comma-separated list
+type stringSliceFlag []string
+
+func (f *stringSliceFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringSliceFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f = append(*f, item)
+		}
+	}
+	return nil
+}
+
+// withOwnLogFile adds the log file of podKube, set with the klog --log_file flag, to the
+// host log files served as node logs
+func withOwnLogFile(files string) string {
+	logFile := flag.Lookup("log_file")
+	if logFile == nil || logFile.Value.String() == "" {
+		return files
+	}
+	path, err := filepath.Abs(logFile.Value.String())
+	if err != nil {
+		return files
+	}
+	own := "podkube.log=" + path
+	if files == "" {
+		return own
+	}
+	return own + "," + files
+}
+
+// setLogFormat routes the klog output through a JSON logger for the json log format, writing
+// to the klog --log_file when set and to stderr otherwise
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", format)
+	}
+
+	out := io.Writer(os.Stderr)
+	if logFile := flag.Lookup("log_file"); logFile != nil && logFile.Value.String() != "" {
+		f, err := os.OpenFile(logFile.Value.String(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		out = f
+	}
+	klog.SetLogger(server.NewJSONLogger(out))
+	return nil
+}
+
+// flagValues returns the current value of every flag, by name
+func flagValues() map[string]string {
+	values := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// printVersion prints the build information of the server, as served by GET /version
+func printVersion() {
+	info := version.Get()
+	fmt.Printf("Version:    %s\n", info.GitVersion)
+	fmt.Printf("Git commit: %s (%s)\n", info.GitCommit, info.GitTreeState)
+	fmt.Printf("Build date: %s\n", info.BuildDate)
+	fmt.Printf("Go version: %s\n", info.GoVersion)
+	fmt.Printf("Platform:   %s\n", info.Platform)
+}
+
+// defaultStateDir returns where generated state (such as the self-signed CA) is kept
+func defaultStateDir() string {
+	if os.Geteuid() == 0 {
+		return "/var/lib/podman-k8s-adapter"
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "podman-k8s-adapter")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "podman-k8s-adapter")
+	}
+	return ""
 }
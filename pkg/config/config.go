@@ -0,0 +1,414 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the content of the --config file. Every field is optional; fields that are
+// set supersede the matching command line flag.
+type Config struct {
+	// Host and Port are the address the HTTPS server listens on (port 0 disables HTTPS)
+	Host string `json:"host,omitempty"`
+	Port *int   `json:"port,omitempty"`
+
+	// Insecure is the optional plain HTTP listener, restricted to loopback addresses
+	Insecure InsecureConfig `json:"insecure,omitempty"`
+
+	TLS    TLSConfig    `json:"tls,omitempty"`
+	Audit  AuditConfig  `json:"audit,omitempty"`
+	Podman PodmanConfig `json:"podman,omitempty"`
+
+	// Runtime is the container runtime backing the nodes (podman or docker); it requires a restart
+	Runtime string `json:"runtime,omitempty"`
+
+	// Nodes are the podman backends exposed as Nodes; defaults to the local podman only
+	Nodes []NodeConfig `json:"nodes,omitempty"`
+	// DefaultNode receives the pods that select no node; round-robin when empty
+	DefaultNode string `json:"defaultNode,omitempty"`
+
+	// TolerateUnsupportedFields creates pods using fields that cannot be honored, with warnings
+	TolerateUnsupportedFields *bool `json:"tolerateUnsupportedFields,omitempty"`
+	// HideInternalAnnotations serves pods without the podman.io/* and other runtime annotations
+	HideInternalAnnotations *bool `json:"hideInternalAnnotations,omitempty"`
+	// AllowPodRecreateOnUpdate applies image and env changes by recreating the container
+	AllowPodRecreateOnUpdate *bool `json:"allowPodRecreateOnUpdate,omitempty"`
+	// AllowSystemdDelete deletes the pods of systemd units without a forced deletion
+	AllowSystemdDelete *bool `json:"allowSystemdDelete,omitempty"`
+	// PodUsageAnnotations annotates pod reads with the CPU and memory usage of their containers
+	PodUsageAnnotations *bool `json:"podUsageAnnotations,omitempty"`
+	// RoutePortForwards stores OpenShift routes and exposes them through the host ports of pods
+	RoutePortForwards *bool `json:"routePortForwards,omitempty"`
+	// KubernetesService gives pods the kubernetes service pointing at podKube; it requires a restart
+	KubernetesService *bool `json:"kubernetesService,omitempty"`
+
+	// PodColumns replace the default columns of pod tables (oc get pods)
+	PodColumns []PodColumnConfig `json:"podColumns,omitempty"`
+
+	// GC removes old exited containers
+	GC GCConfig `json:"gc,omitempty"`
+
+	// Exec holds the exec session settings
+	Exec ExecConfig `json:"exec,omitempty"`
+
+	// Admission holds the defaults applied to created pods
+	Admission AdmissionConfig `json:"admission,omitempty"`
+
+	// NodeLogs selects the host logs served by /logs/ and the node logs proxy
+	NodeLogs NodeLogsConfig `json:"nodeLogs,omitempty"`
+
+	// DebugTokenFile holds the bearer token of /debug/bundle, which is disabled without it
+	DebugTokenFile string `json:"debugTokenFile,omitempty"`
+
+	// AuthorizationMode lists the authorization modes asked in order, AlwaysAllow by default
+	AuthorizationMode string `json:"authorizationMode,omitempty"`
+	// TokenAuthFile is the static token file authenticating bearer tokens
+	TokenAuthFile string `json:"tokenAuthFile,omitempty"`
+	// AnonymousAuth serves the requests without credentials as system:anonymous, true by default
+	AnonymousAuth *bool `json:"anonymousAuth,omitempty"`
+
+	// StateDir is where the state podKube owns, such as the self-signed CA, namespace
+	// annotations, pod metadata changes and routes, is persisted
+	StateDir string `json:"stateDir,omitempty"`
+	// EncryptionProviderConfig is the EncryptionConfiguration encrypting the state at rest
+	EncryptionProviderConfig string `json:"encryptionProviderConfig,omitempty"`
+
+	// ShutdownTimeout bounds how long shutdown waits for exec and log sessions
+	ShutdownTimeout *metav1.Duration `json:"shutdownTimeout,omitempty"`
+
+	// LogLevel is the klog verbosity (-v); it can be changed at runtime
+	LogLevel *int `json:"logLevel,omitempty"`
+	// LogFormat is text (klog) or json; it requires a restart
+	LogFormat string `json:"logFormat,omitempty"`
+}
+
+// TLSConfig holds the serving certificate settings
+type TLSConfig struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// SANs are additional hostnames and IPs for the self-signed serving certificate
+	SANs []string `json:"sans,omitempty"`
+}
+
+// InsecureConfig holds the plain HTTP listener settings
+type InsecureConfig struct {
+	BindAddress string `json:"bindAddress,omitempty"`
+	Port        *int   `json:"port,omitempty"`
+}
+
+// NodeConfig describes a podman backend exposed as a Node
+type NodeConfig struct {
+	Name string `json:"name"`
+	// Connection is a podman URL or connection name, empty for the local podman
+	Connection string            `json:"connection,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// PodColumnConfig is a custom column of pod tables
+type PodColumnConfig struct {
+	Name string `json:"name"`
+	// JSONPath selects the value of the column, e.g. .spec.nodeName or .spec.containers[*].image
+	JSONPath string `json:"jsonPath"`
+}
+
+// GCConfig holds the exited container garbage collection settings; zero values disable a limit
+type GCConfig struct {
+	ExitedAfter *metav1.Duration `json:"exitedAfter,omitempty"`
+	MaxExited   *int             `json:"maxExited,omitempty"`
+}
+
+// ExecConfig holds the exec session settings
+type ExecConfig struct {
+	// MaxSessions caps the number of concurrent exec sessions, 0 for no limit
+	MaxSessions *int `json:"maxSessions,omitempty"`
+	// StreamCreationTimeout bounds how long clients take to create the streams of a session
+	StreamCreationTimeout *metav1.Duration `json:"streamCreationTimeout,omitempty"`
+	// StreamIdleTimeout closes sessions whose streams stay idle this long
+	StreamIdleTimeout *metav1.Duration `json:"streamIdleTimeout,omitempty"`
+	// TranscriptDir is where the transcripts of exec sessions are recorded, none when empty
+	TranscriptDir string `json:"transcriptDir,omitempty"`
+}
+
+// NodeLogsConfig selects the host logs served by /logs/ and the node logs proxy
+type NodeLogsConfig struct {
+	// Units are the journald units whose journal can be queried
+	Units []string `json:"units,omitempty"`
+	// Files are log files, written path or name=path
+	Files []string `json:"files,omitempty"`
+}
+
+// AdmissionConfig holds the defaults the admission chain applies to created pods
+type AdmissionConfig struct {
+	// DefaultPodLabels are set on created pods that do not set them
+	DefaultPodLabels map[string]string `json:"defaultPodLabels,omitempty"`
+	// DefaultContainerRequests and DefaultContainerLimits (cpu, memory) are set on the
+	// containers of created pods that do not set them, like the defaults of a LimitRange
+	DefaultContainerRequests map[string]string `json:"defaultContainerRequests,omitempty"`
+	DefaultContainerLimits   map[string]string `json:"defaultContainerLimits,omitempty"`
+	// Webhooks are the external admission webhooks called on pod create and update, in order
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+}
+
+// WebhookConfig is an external admission webhook, called with an admission.k8s.io/v1
+// AdmissionReview like the webhooks registered with kube-apiserver
+type WebhookConfig struct {
+	Name string `json:"name"`
+	// Type is Mutating or Validating
+	Type string `json:"type"`
+	// URL is the https:// URL the AdmissionReview is posted to
+	URL string `json:"url"`
+	// CAFile verifies the certificate of the webhook; the system roots are used when empty
+	CAFile string `json:"caFile,omitempty"`
+	// Rules select the requests sent to the webhook; every pod create and update when empty
+	Rules []admissionregistrationv1.RuleWithOperations `json:"rules,omitempty"`
+	// FailurePolicy is Fail (the default) or Ignore, when the webhook cannot be called
+	FailurePolicy string `json:"failurePolicy,omitempty"`
+	// Timeout bounds each call; 10s when unset
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// AuditConfig holds the audit logging settings
+type AuditConfig struct {
+	LogPath string `json:"logPath,omitempty"`
+	Level   string `json:"level,omitempty"`
+}
+
+// PodmanConfig holds the podman backend settings; all but the connection can be changed at runtime
+type PodmanConfig struct {
+	// Connection and Identity select a remote podman service; they require a restart
+	Connection string `json:"connection,omitempty"`
+	Identity   string `json:"identity,omitempty"`
+	// Rootful also exposes the system podman as a <hostname>-rootful node
+	Rootful *bool `json:"rootful,omitempty"`
+
+	CacheTTL         *metav1.Duration `json:"cacheTTL,omitempty"`
+	Parallelism      int              `json:"parallelism,omitempty"`
+	CommandTimeout   *metav1.Duration `json:"commandTimeout,omitempty"`
+	FailureThreshold *int             `json:"failureThreshold,omitempty"`
+	BreakerCooldown  *metav1.Duration `json:"breakerCooldown,omitempty"`
+}
+
+// Load reads and parses a YAML (or JSON) config file, rejecting unknown fields
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// FlagValues returns the command line flag values (by flag name) set by the config file
+func (c *Config) FlagValues() map[string]string {
+	values := make(map[string]string)
+
+	setString := func(name, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setDuration := func(name string, value *metav1.Duration) {
+		if value != nil {
+			values[name] = value.Duration.String()
+		}
+	}
+
+	setInt := func(name string, value *int) {
+		if value != nil {
+			values[name] = strconv.Itoa(*value)
+		}
+	}
+	setMap := func(name string, value map[string]string) {
+		if len(value) > 0 {
+			items := make([]string, 0, len(value))
+			for key, item := range value {
+				items = append(items, key+"="+item)
+			}
+			sort.Strings(items)
+			values[name] = strings.Join(items, ",")
+		}
+	}
+
+	setString("host", c.Host)
+	setInt("port", c.Port)
+	setString("insecure-bind-address", c.Insecure.BindAddress)
+	setInt("insecure-port", c.Insecure.Port)
+	setString("cert-file", c.TLS.CertFile)
+	setString("key-file", c.TLS.KeyFile)
+	if len(c.TLS.SANs) > 0 {
+		values["tls-san"] = strings.Join(c.TLS.SANs, ",")
+	}
+	setString("state-dir", c.StateDir)
+	setString("encryption-provider-config", c.EncryptionProviderConfig)
+	setString("audit-log-path", c.Audit.LogPath)
+	setString("audit-level", c.Audit.Level)
+	setString("runtime", c.Runtime)
+	setString("podman-connection", c.Podman.Connection)
+	setString("podman-identity", c.Podman.Identity)
+	if c.Podman.Rootful != nil {
+		values["rootful"] = strconv.FormatBool(*c.Podman.Rootful)
+	}
+	setString("default-node", c.DefaultNode)
+	if len(c.Nodes) > 0 {
+		var nodes, nodeLabels []string
+		for _, node := range c.Nodes {
+			nodes = append(nodes, node.Name+"="+node.Connection)
+			for key, value := range node.Labels {
+				nodeLabels = append(nodeLabels, node.Name+":"+key+"="+value)
+			}
+		}
+		sort.Strings(nodeLabels)
+		values["node"] = strings.Join(nodes, ",")
+		if len(nodeLabels) > 0 {
+			values["node-label"] = strings.Join(nodeLabels, ",")
+		}
+	}
+	setDuration("cache-ttl", c.Podman.CacheTTL)
+	if c.Podman.Parallelism != 0 {
+		values["podman-parallelism"] = strconv.Itoa(c.Podman.Parallelism)
+	}
+	setDuration("podman-command-timeout", c.Podman.CommandTimeout)
+	setInt("podman-failure-threshold", c.Podman.FailureThreshold)
+	setDuration("podman-breaker-cooldown", c.Podman.BreakerCooldown)
+	if c.TolerateUnsupportedFields != nil {
+		values["tolerate-unsupported-fields"] = strconv.FormatBool(*c.TolerateUnsupportedFields)
+	}
+	if c.HideInternalAnnotations != nil {
+		values["hide-internal-annotations"] = strconv.FormatBool(*c.HideInternalAnnotations)
+	}
+	if c.AllowPodRecreateOnUpdate != nil {
+		values["allow-pod-recreate-on-update"] = strconv.FormatBool(*c.AllowPodRecreateOnUpdate)
+	}
+	if c.AllowSystemdDelete != nil {
+		values["allow-systemd-delete"] = strconv.FormatBool(*c.AllowSystemdDelete)
+	}
+	if c.PodUsageAnnotations != nil {
+		values["pod-usage-annotations"] = strconv.FormatBool(*c.PodUsageAnnotations)
+	}
+	if c.RoutePortForwards != nil {
+		values["route-port-forwards"] = strconv.FormatBool(*c.RoutePortForwards)
+	}
+	if c.KubernetesService != nil {
+		values["kubernetes-service"] = strconv.FormatBool(*c.KubernetesService)
+	}
+	if len(c.PodColumns) > 0 {
+		columns := make([]string, len(c.PodColumns))
+		for i, column := range c.PodColumns {
+			columns[i] = column.Name + ":" + column.JSONPath
+		}
+		values["pod-columns"] = strings.Join(columns, ",")
+	}
+	setDuration("gc-exited-after", c.GC.ExitedAfter)
+	setInt("gc-max-exited", c.GC.MaxExited)
+	setInt("max-exec-sessions", c.Exec.MaxSessions)
+	setMap("default-pod-labels", c.Admission.DefaultPodLabels)
+	setMap("default-container-requests", c.Admission.DefaultContainerRequests)
+	setMap("default-container-limits", c.Admission.DefaultContainerLimits)
+	setDuration("stream-creation-timeout", c.Exec.StreamCreationTimeout)
+	setDuration("stream-idle-timeout", c.Exec.StreamIdleTimeout)
+	setString("exec-transcript-dir", c.Exec.TranscriptDir)
+	if len(c.NodeLogs.Units) > 0 {
+		values["node-log-units"] = strings.Join(c.NodeLogs.Units, ",")
+	}
+	if len(c.NodeLogs.Files) > 0 {
+		values["node-log-files"] = strings.Join(c.NodeLogs.Files, ",")
+	}
+	setString("debug-token-file", c.DebugTokenFile)
+	setString("authorization-mode", c.AuthorizationMode)
+	setString("token-auth-file", c.TokenAuthFile)
+	if c.AnonymousAuth != nil {
+		values["anonymous-auth"] = strconv.FormatBool(*c.AnonymousAuth)
+	}
+	setDuration("shutdown-timeout", c.ShutdownTimeout)
+	setInt("v", c.LogLevel)
+	setString("log-format", c.LogFormat)
+
+	return values
+}
+
+// Snapshot returns the current value of every flag of fs, by flag name
+func Snapshot(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+	return values
+}
+
+// Apply sets the flags of fs to the base values (usually the command line) overridden by
+// the config's settings, so that a setting removed from the file goes back to its base
+// value. Flags in keep are left as they are. Either every value is applied or, when one
+// is invalid, fs is left unchanged.
+func (c *Config) Apply(fs *flag.FlagSet, base map[string]string, keep map[string]bool) error {
+	values := make(map[string]string, len(base))
+	for name, value := range base {
+		values[name] = value
+	}
+	for name, value := range c.FlagValues() {
+		values[name] = value
+	}
+
+	previous := make(map[string]string)
+	for name, value := range values {
+		f := fs.Lookup(name)
+		if f == nil || keep[name] {
+			continue
+		}
+		current := f.Value.String()
+		if current == value {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			for name, value := range previous {
+				fs.Set(name, value)
+			}
+			return fmt.Errorf("invalid value %q for %s: %v", value, name, err)
+		}
+		previous[name] = current
+	}
+	return nil
+}
+
+// Watch calls onChange whenever the file's modification time changes, checking every
+// interval, until stopCh is closed
+func Watch(path string, interval time.Duration, stopCh <-chan struct{}, onChange func()) {
+	lastModified := modTime(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if modified := modTime(path); !modified.Equal(lastModified) {
+				lastModified = modified
+				onChange()
+			}
+		}
+	}
+}
+
+// modTime returns the modification time of path, or the zero time if it cannot be read
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
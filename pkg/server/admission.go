@@ -0,0 +1,385 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// defaultPodNamespace is the namespace of pods that name none, the namespace pods are created in
+const defaultPodNamespace = "containers"
+
+// admissionOperation is the operation a pod is admitted for
+type admissionOperation string
+
+const (
+	admissionCreate admissionOperation = "CREATE"
+	admissionUpdate admissionOperation = "UPDATE"
+)
+
+// admissionAttributes describe the request a pod is admitted for
+type admissionAttributes struct {
+	operation admissionOperation
+	namespace string      // Namespace of the request URL, empty on cluster-wide routes
+	old       *corev1.Pod // Current pod on updates
+	dryRun    bool
+	user      AuditUserInfo
+	warnings  []string // Warnings of the plugins and webhooks, returned as Warning headers
+
+	auditAnnotations map[string]string // Annotations of the audit event of the request
+}
+
+// flushWarnings adds the warnings of the plugins and webhooks called so far as Warning
+// headers, and their annotations to the audit event
+func (attrs *admissionAttributes) flushWarnings(w http.ResponseWriter) {
+	for _, warning := range attrs.warnings {
+		addWarning(w, warning)
+	}
+	for key, value := range attrs.auditAnnotations {
+		addAuditAnnotation(w, key, value)
+	}
+	attrs.warnings = nil
+	attrs.auditAnnotations = nil
+}
+
+// mutatingAdmission is an admission plugin changing pods before they are validated and stored.
+// Admit errors are reported as 400 Bad Request, unless they are API statuses.
+type mutatingAdmission interface {
+	Name() string
+	Admit(attrs *admissionAttributes, pod *corev1.Pod) error
+}
+
+// validatingAdmission is an admission plugin rejecting pods, once every mutation is applied
+type validatingAdmission interface {
+	Name() string
+	Validate(attrs *admissionAttributes, pod *corev1.Pod) field.ErrorList
+}
+
+// enforcingAdmission is an admission plugin rejecting the pods that are valid but not allowed,
+// once every mutation is applied. Enforce errors are reported as 403 Forbidden, unless they
+// are API statuses.
+type enforcingAdmission interface {
+	Name() string
+	Enforce(attrs *admissionAttributes, pod *corev1.Pod) error
+}
+
+// admissionChain runs the admission plugins on the pods created and updated, like the
+// admission chain of kube-apiserver: the mutating plugins in order, then the mutating
+// webhooks, then the validating plugins, whose errors are all reported in a single 422
+// Invalid Status, the enforcing plugins and the validating webhooks
+type admissionChain struct {
+	mutating   []mutatingAdmission
+	validating []validatingAdmission
+	enforcing  []enforcingAdmission
+	webhooks   []*admissionWebhook
+}
+
+// admissionDefaults are the settings of the defaulting plugins; empty ones change nothing
+type admissionDefaults struct {
+	podLabels         map[string]string   // Labels set on created pods that do not set them
+	containerRequests corev1.ResourceList // Requests of created containers that set none, like a LimitRange defaultRequest
+	containerLimits   corev1.ResourceList // Limits of created containers that set none, like a LimitRange default
+}
+
+// newAdmissionChain builds the admission chain of pods with the given defaults and webhooks;
+// terminating reports whether a namespace is being deleted, and namespaceLabels returns the
+// labels of a namespace
+func newAdmissionChain(defaults admissionDefaults, webhooks []*admissionWebhook, terminating func(namespace string) bool, namespaceLabels func(namespace string) map[string]string) *admissionChain {
+	return &admissionChain{
+		webhooks: webhooks,
+		mutating: []mutatingAdmission{
+			namespaceDefaulter{},
+			namespaceLifecycle{terminating: terminating},
+			podLabelDefaulter{labels: defaults.podLabels},
+			limitRangeDefaulter{requests: defaults.containerRequests, limits: defaults.containerLimits},
+		},
+		validating: []validatingAdmission{
+			metadataValidator{},
+		},
+		enforcing: []enforcingAdmission{
+			podSecurityAdmission{namespaceLabels: namespaceLabels},
+		},
+	}
+}
+
+// mutate runs the mutating plugins and webhooks on a pod
+func (c *admissionChain) mutate(ctx context.Context, attrs *admissionAttributes, pod *corev1.Pod) *apierrors.StatusError {
+	for _, plugin := range c.mutating {
+		if err := plugin.Admit(attrs, pod); err != nil {
+			var statusErr *apierrors.StatusError
+			if errors.As(err, &statusErr) {
+				return statusErr
+			}
+			return apierrors.NewBadRequest(fmt.Sprintf("admission plugin %s rejected pod %q: %v", plugin.Name(), pod.Name, err))
+		}
+	}
+	return c.callWebhooks(ctx, attrs, pod, true)
+}
+
+// validate runs the validating plugins and webhooks on a pod
+func (c *admissionChain) validate(ctx context.Context, attrs *admissionAttributes, pod *corev1.Pod) *apierrors.StatusError {
+	var errs field.ErrorList
+	for _, plugin := range c.validating {
+		errs = append(errs, plugin.Validate(attrs, pod)...)
+	}
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, pod.Name, errs)
+	}
+	for _, plugin := range c.enforcing {
+		if err := plugin.Enforce(attrs, pod); err != nil {
+			var statusErr *apierrors.StatusError
+			if errors.As(err, &statusErr) {
+				return statusErr
+			}
+			return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.Name, fmt.Errorf("admission plugin %s: %v", plugin.Name(), err))
+		}
+	}
+	return c.callWebhooks(ctx, attrs, pod, false)
+}
+
+// callWebhooks sends a pod to the mutating or validating webhooks whose rules select it
+func (c *admissionChain) callWebhooks(ctx context.Context, attrs *admissionAttributes, pod *corev1.Pod, mutating bool) *apierrors.StatusError {
+	for _, webhook := range c.webhooks {
+		if webhook.mutating != mutating || !webhook.matches(attrs) {
+			continue
+		}
+		if err := webhook.review(ctx, attrs, pod); err != nil {
+			var statusErr *apierrors.StatusError
+			if errors.As(err, &statusErr) {
+				return statusErr
+			}
+			return apierrors.NewInternalError(err)
+		}
+	}
+	return nil
+}
+
+// namespaceDefaulter places pods that name no namespace in the namespace of the URL, or in
+// the namespace pods are created in on cluster-wide routes
+type namespaceDefaulter struct{}
+
+func (namespaceDefaulter) Name() string { return "NamespaceDefault" }
+
+func (namespaceDefaulter) Admit(attrs *admissionAttributes, pod *corev1.Pod) error {
+	if pod.Namespace != "" {
+		return nil
+	}
+	pod.Namespace = attrs.namespace
+	if pod.Namespace == "" {
+		pod.Namespace = defaultPodNamespace
+	}
+	return nil
+}
+
+// namespaceLifecycle rejects the pods created in a terminating namespace, whose pods are being
+// deleted, as the NamespaceLifecycle plugin does
+type namespaceLifecycle struct {
+	terminating func(namespace string) bool
+}
+
+func (namespaceLifecycle) Name() string { return "NamespaceLifecycle" }
+
+func (l namespaceLifecycle) Admit(attrs *admissionAttributes, pod *corev1.Pod) error {
+	if attrs.operation != admissionCreate || !l.terminating(pod.Namespace) {
+		return nil
+	}
+	return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.Name,
+		fmt.Errorf("unable to create new content in namespace %s because it is being terminated", pod.Namespace))
+}
+
+// podLabelDefaulter sets the standard labels on created pods, keeping the values pods set
+type podLabelDefaulter struct {
+	labels map[string]string
+}
+
+func (podLabelDefaulter) Name() string { return "PodLabelDefault" }
+
+func (d podLabelDefaulter) Admit(attrs *admissionAttributes, pod *corev1.Pod) error {
+	if attrs.operation != admissionCreate || len(d.labels) == 0 {
+		return nil
+	}
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	for key, value := range d.labels {
+		if _, ok := pod.Labels[key]; !ok {
+			pod.Labels[key] = value
+		}
+	}
+	return nil
+}
+
+// limitRangeDefaulter sets the default requests and limits on the containers of created pods,
+// as the LimitRanger plugin applies the defaults of a LimitRange: a container without a limit
+// gets the default limit, and one without a request gets the default request, or its limit
+type limitRangeDefaulter struct {
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+}
+
+func (limitRangeDefaulter) Name() string { return "LimitRanger" }
+
+func (d limitRangeDefaulter) Admit(attrs *admissionAttributes, pod *corev1.Pod) error {
+	if attrs.operation != admissionCreate || (len(d.requests) == 0 && len(d.limits) == 0) {
+		return nil
+	}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			resources := &containers[i].Resources
+			for name, limit := range d.limits {
+				if _, ok := resources.Limits[name]; !ok {
+					if resources.Limits == nil {
+						resources.Limits = corev1.ResourceList{}
+					}
+					resources.Limits[name] = limit.DeepCopy()
+				}
+			}
+			for name, limit := range resources.Limits {
+				request, ok := d.requests[name]
+				if !ok {
+					request = limit
+				}
+				setDefaultRequest(resources, name, request)
+			}
+			for name, request := range d.requests {
+				setDefaultRequest(resources, name, request)
+			}
+		}
+	}
+	return nil
+}
+
+// setDefaultRequest sets the request of a resource, unless it is already set
+func setDefaultRequest(resources *corev1.ResourceRequirements, name corev1.ResourceName, request resource.Quantity) {
+	if _, ok := resources.Requests[name]; ok {
+		return
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	resources.Requests[name] = request.DeepCopy()
+}
+
+// metadataValidator rejects pods whose metadata kube-apiserver would reject, and created pods
+// whose containers are not named by DNS labels. The names of existing containers are not
+// validated, as containers created outside of podKube have names podman allows, such as
+// my_container, and neither are the labels they already have.
+type metadataValidator struct{}
+
+func (metadataValidator) Name() string { return "ObjectMetaValidation" }
+
+func (metadataValidator) Validate(attrs *admissionAttributes, pod *corev1.Pod) field.ErrorList {
+	var old *metav1.ObjectMeta
+	if attrs.old != nil {
+		old = &attrs.old.ObjectMeta
+	}
+	errs := validateObjectMeta(&pod.ObjectMeta, old)
+	if attrs.operation != admissionCreate {
+		return errs
+	}
+
+	specPath := field.NewPath("spec")
+	for _, containers := range []struct {
+		path *field.Path
+		list []corev1.Container
+	}{
+		{specPath.Child("initContainers"), pod.Spec.InitContainers},
+		{specPath.Child("containers"), pod.Spec.Containers},
+	} {
+		for i, container := range containers.list {
+			for _, msg := range validation.IsDNS1123Label(container.Name) {
+				errs = append(errs, field.Invalid(containers.path.Index(i).Child("name"), container.Name, msg))
+			}
+		}
+	}
+	return errs
+}
+
+// SetAdmissionDefaults sets the defaults applied to created pods: the labels of podLabels
+// (key=value,...), and the requests and limits (cpu=100m,memory=128Mi) set on containers
+// without them. Empty values apply no defaults.
+func (s *Server) SetAdmissionDefaults(podLabels, containerRequests, containerLimits string) error {
+	var defaults admissionDefaults
+	var err error
+	if defaults.podLabels, err = parseLabelList(podLabels); err != nil {
+		return fmt.Errorf("invalid pod labels: %v", err)
+	}
+	if defaults.containerRequests, err = parseResourceList(containerRequests); err != nil {
+		return fmt.Errorf("invalid container requests: %v", err)
+	}
+	if defaults.containerLimits, err = parseResourceList(containerLimits); err != nil {
+		return fmt.Errorf("invalid container limits: %v", err)
+	}
+	for name, request := range defaults.containerRequests {
+		if limit, ok := defaults.containerLimits[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("default %s request %s is greater than its default limit %s", name, request.String(), limit.String())
+		}
+	}
+	s.admissionDefaults.Store(&defaults)
+	return nil
+}
+
+// parseLabelList parses labels written key=value,...
+func parseLabelList(spec string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not key=value", item)
+		}
+		if msgs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...); len(msgs) > 0 {
+			return nil, fmt.Errorf("%q: %s", item, strings.Join(msgs, "; "))
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// parseResourceList parses resource quantities written name=quantity,..., of CPU and memory
+func parseResourceList(spec string) (corev1.ResourceList, error) {
+	resources := corev1.ResourceList{}
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not name=quantity", item)
+		}
+		if name != string(corev1.ResourceCPU) && name != string(corev1.ResourceMemory) {
+			return nil, fmt.Errorf("unsupported resource %q, only %s and %s are", name, corev1.ResourceCPU, corev1.ResourceMemory)
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", item, err)
+		}
+		resources[corev1.ResourceName(name)] = quantity
+	}
+	return resources, nil
+}
+
+// podAdmission returns the admission chain of pods with the current defaults and webhooks
+func (s *Server) podAdmission() *admissionChain {
+	var defaults admissionDefaults
+	if current := s.admissionDefaults.Load(); current != nil {
+		defaults = *current
+	}
+	var webhooks []*admissionWebhook
+	if current := s.admissionWebhooks.Load(); current != nil {
+		webhooks = *current
+	}
+	return newAdmissionChain(defaults, webhooks, s.podStorage.NamespaceTerminating, s.podStorage.NamespaceLabels)
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+)
+
+// AuditLevel defines how much of each request is recorded in the audit log
+type AuditLevel string
+
+const (
+	// AuditLevelMetadata records request metadata (user, verb, resource, response code) only
+	AuditLevelMetadata AuditLevel = "Metadata"
+	// AuditLevelRequestResponse records metadata plus request and response bodies
+	AuditLevelRequestResponse AuditLevel = "RequestResponse"
+)
+
+// maxAuditBodySize caps how much of a request/response body is kept in a single audit event
+const maxAuditBodySize = 64 * 1024
+
+// AuditEvent is a trimmed-down audit.k8s.io/v1 Event
+type AuditEvent struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Level                    AuditLevel            `json:"level"`
+	AuditID                  types.UID             `json:"auditID"`
+	Stage                    string                `json:"stage"`
+	RequestURI               string                `json:"requestURI"`
+	Verb                     string                `json:"verb"`
+	User                     AuditUserInfo         `json:"user"`
+	SourceIPs                []string              `json:"sourceIPs,omitempty"`
+	UserAgent                string                `json:"userAgent,omitempty"`
+	ObjectRef                *AuditObjectReference `json:"objectRef,omitempty"`
+	ResponseStatus           *metav1.Status        `json:"responseStatus,omitempty"`
+	RequestObject            *runtime.Unknown      `json:"requestObject,omitempty"`
+	ResponseObject           *runtime.Unknown      `json:"responseObject,omitempty"`
+	RequestReceivedTimestamp metav1.MicroTime      `json:"requestReceivedTimestamp"`
+	StageTimestamp           metav1.MicroTime      `json:"stageTimestamp"`
+	Annotations              map[string]string     `json:"annotations,omitempty"`
+}
+
+// AuditUserInfo identifies the user that issued a request
+type AuditUserInfo struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// AuditObjectReference identifies the object a request was made against
+type AuditObjectReference struct {
+	Resource    string `json:"resource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// AuditLogger writes audit events as JSON lines to a file
+type AuditLogger struct {
+	level AuditLevel
+	mu    sync.Mutex
+	out   io.WriteCloser
+}
+
+// NewAuditLogger opens (or creates) the audit log file at path
+func NewAuditLogger(path string, level AuditLevel) (*AuditLogger, error) {
+	switch level {
+	case AuditLevelMetadata, AuditLevelRequestResponse:
+	default:
+		return nil, fmt.Errorf("unsupported audit level %q (supported: %s, %s)", level, AuditLevelMetadata, AuditLevelRequestResponse)
+	}
+
+	var out io.WriteCloser
+	if path == "-" {
+		out = os.Stdout
+	} else {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log %s: %v", path, err)
+		}
+		out = f
+	}
+
+	return &AuditLogger{
+		level: level,
+		out:   out,
+	}, nil
+}
+
+// Log writes a single audit event
+func (a *AuditLogger) Log(event *AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("Failed to marshal audit event: %v", err)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		klog.Errorf("Failed to write audit event: %v", err)
+	}
+}
+
+// Close closes the underlying audit log file
+func (a *AuditLogger) Close() error {
+	if a.out == os.Stdout {
+		return nil
+	}
+	return a.out.Close()
+}
+
+// SetAuditLogger enables auditing of every API request through the given logger
+func (s *Server) SetAuditLogger(auditLogger *AuditLogger) {
+	s.auditLogger = auditLogger
+}
+
+// withAudit wraps handler so that every API request produces an audit event
+func (s *Server) withAudit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auditLogger == nil || isHealthPath(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		received := time.Now()
+		captureBodies := s.auditLogger.level == AuditLevelRequestResponse && !isStreamingRequest(r)
+
+		var requestBody []byte
+		if captureBodies && r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				klog.Warningf("Failed to read request body for audit: %v", err)
+			}
+			r.Body.Close()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			requestBody = body
+		}
+
+		recorder := &auditResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+			capture:        captureBodies,
+		}
+		handler.ServeHTTP(recorder, r)
+
+		s.auditLogger.Log(s.newAuditEvent(r, recorder, received, requestBody))
+	})
+}
+
+// newAuditEvent builds the ResponseComplete audit event for a finished request
+func (s *Server) newAuditEvent(r *http.Request, recorder *auditResponseWriter, received time.Time, requestBody []byte) *AuditEvent {
+	info := parseRequestInfo(r)
+	now := time.Now()
+	auditID := requestID(r.Context())
+	if auditID == "" {
+		auditID = string(uuid.NewUUID())
+	}
+
+	event := &AuditEvent{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Event",
+			APIVersion: "audit.k8s.io/v1",
+		},
+		Level:      s.auditLogger.level,
+		AuditID:    types.UID(auditID),
+		Stage:      "ResponseComplete",
+		RequestURI: r.URL.RequestURI(),
+		Verb:       info.Verb,
+		User:       requestUser(r),
+		SourceIPs:  sourceIPs(r),
+		UserAgent:  r.UserAgent(),
+		ResponseStatus: &metav1.Status{
+			Code: int32(recorder.statusCode),
+		},
+		RequestReceivedTimestamp: metav1.NewMicroTime(received),
+		StageTimestamp:           metav1.NewMicroTime(now),
+		Annotations: map[string]string{
+			"podman.io/latency": now.Sub(received).String(),
+		},
+	}
+
+	for key, value := range recorder.annotations {
+		event.Annotations[key] = value
+	}
+
+	if info.Resource != "" {
+		event.ObjectRef = &AuditObjectReference{
+			Resource:    info.Resource,
+			Namespace:   info.Namespace,
+			Name:        info.Name,
+			APIGroup:    info.APIGroup,
+			APIVersion:  info.APIVersion,
+			Subresource: info.Subresource,
+		}
+	}
+
+	if recorder.statusCode >= http.StatusBadRequest {
+		event.ResponseStatus.Status = metav1.StatusFailure
+	} else {
+		event.ResponseStatus.Status = metav1.StatusSuccess
+	}
+
+	if s.auditLogger.level == AuditLevelRequestResponse {
+		if len(requestBody) > 0 {
+			event.RequestObject = auditBody(requestBody, r.Header.Get("Content-Type"))
+		}
+		if recorder.body.Len() > 0 {
+			event.ResponseObject = auditBody(recorder.body.Bytes(), recorder.Header().Get("Content-Type"))
+		}
+	}
+
+	return event
+}
+
+// auditBody wraps a captured body so it can be embedded in an audit event
+func auditBody(body []byte, contentType string) *runtime.Unknown {
+	if len(body) > maxAuditBodySize {
+		body = body[:maxAuditBodySize]
+	}
+	if !json.Valid(body) {
+		// Non-JSON bodies (plain text errors, logs) are kept as a JSON string
+		quoted, _ := json.Marshal(string(body))
+		body = quoted
+	}
+	return &runtime.Unknown{
+		Raw:         body,
+		ContentType: contentType,
+	}
+}
+
+// requestUser returns the user authenticated by the bearer token of the request, or derives
+// it from the TLS client certificate, if any
+func requestUser(r *http.Request) AuditUserInfo {
+	if user, ok := r.Context().Value(userKey{}).(AuditUserInfo); ok {
+		return user
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		subject := r.TLS.PeerCertificates[0].Subject
+		return AuditUserInfo{
+			Username: subject.CommonName,
+			Groups:   append(subject.Organization, "system:authenticated"),
+		}
+	}
+	return AuditUserInfo{
+		Username: "system:anonymous",
+		Groups:   []string{"system:unauthenticated"},
+	}
+}
+
+// sourceIPs returns the client addresses for a request, honoring X-Forwarded-For
+func sourceIPs(r *http.Request) []string {
+	var ips []string
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		for _, ip := range strings.Split(forwarded, ",") {
+			ips = append(ips, strings.TrimSpace(ip))
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ips = append(ips, host)
+	} else if r.RemoteAddr != "" {
+		ips = append(ips, r.RemoteAddr)
+	}
+	return ips
+}
+
+// isHealthPath reports whether path is one of the health probe endpoints
+func isHealthPath(path string) bool {
+	return path == "/healthz" || path == "/readyz" || path == "/livez" || strings.HasPrefix(path, "/readyz/")
+}
+
+// isStreamingRequest reports whether a request streams its response (watch, follow, exec)
+func isStreamingRequest(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Get("watch") == "true" || query.Get("follow") == "true" || isUpgradeRequest(r)
+}
+
+// auditResponseWriter records the status code (and optionally the body) of a response
+type auditResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	capture     bool
+	body        bytes.Buffer
+	annotations map[string]string // Set by the handler with addAuditAnnotation
+}
+
+// addAuditAnnotation annotates the audit event of the request of w, when it is audited
+func addAuditAnnotation(w http.ResponseWriter, key, value string) {
+	if recorder, ok := w.(*auditResponseWriter); ok {
+		if recorder.annotations == nil {
+			recorder.annotations = map[string]string{}
+		}
+		recorder.annotations[key] = value
+	}
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.statusCode = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	w.wroteHeader = true
+	if w.capture && w.body.Len() < maxAuditBodySize {
+		w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush forwards to the underlying writer so watch and log streaming keep working
+func (w *auditResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer so SPDY upgrades for exec keep working
+func (w *auditResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if !w.wroteHeader {
+		w.statusCode = http.StatusSwitchingProtocols
+		w.wroteHeader = true
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,378 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// Authorization modes of --authorization-mode, asked in order like the authorizers of
+// kube-apiserver: the first one allowing or denying a request decides, and requests no mode
+// allows are forbidden
+const (
+	// AuthorizationModeAlwaysAllow allows every request, the default
+	AuthorizationModeAlwaysAllow = "AlwaysAllow"
+	// AuthorizationModeAlwaysDeny denies every request
+	AuthorizationModeAlwaysDeny = "AlwaysDeny"
+	// AuthorizationModeNode lets the node users read pods and update their own node and lease
+	AuthorizationModeNode = "Node"
+	// AuthorizationModeSimpleRBAC gives the token holders full access, narrowed by the
+	// podkube:read-only and podkube:namespace:NAME groups of their tokens
+	AuthorizationModeSimpleRBAC = "SimpleRBAC"
+	// AuthorizationModeAnonymousReadOnly lets anonymous users read everything but secrets
+	AuthorizationModeAnonymousReadOnly = "AlwaysAllowReadOnlyForAnonymous"
+)
+
+// Groups of the token file narrowing the access SimpleRBAC gives to token holders
+const (
+	// readOnlyGroup restricts its users to the get, list and watch verbs
+	readOnlyGroup = "podkube:read-only"
+	// namespaceGroupPrefix restricts its users to the namespaces named after it, and to
+	// reading the resources that are not namespaced
+	namespaceGroupPrefix = "podkube:namespace:"
+)
+
+// Users and groups of the node users, as kubelets authenticate
+const (
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+	nodeLeaseNS    = "kube-node-lease"
+)
+
+// clusterScopedResources are the resources that are not namespaced
+var clusterScopedResources = map[string]bool{
+	"namespaces":                  true,
+	"nodes":                       true,
+	"projects":                    true,
+	"images":                      true,
+	"networks":                    true,
+	"flowschemas":                 true,
+	"prioritylevelconfigurations": true,
+}
+
+// anonymousUser is the user of the requests without credentials
+const anonymousUser = "system:anonymous"
+
+// decision is the answer of an authorization mode to a request
+type decision int
+
+const (
+	decisionNoOpinion decision = iota
+	decisionAllow
+	decisionDeny
+)
+
+// authorizer decides whether a user may make a request, given its attributes and path
+type authorizer func(user AuditUserInfo, info *RequestInfo, path string) decision
+
+// authorizers implement the authorization modes
+var authorizers = map[string]authorizer{
+	AuthorizationModeAlwaysAllow:       func(AuditUserInfo, *RequestInfo, string) decision { return decisionAllow },
+	AuthorizationModeAlwaysDeny:        func(AuditUserInfo, *RequestInfo, string) decision { return decisionDeny },
+	AuthorizationModeNode:              authorizeNode,
+	AuthorizationModeSimpleRBAC:        authorizeSimpleRBAC,
+	AuthorizationModeAnonymousReadOnly: authorizeAnonymousReadOnly,
+}
+
+// authorization holds the authorization modes and the users of the bearer tokens
+type authorization struct {
+	modes     []string
+	tokens    map[string]AuditUserInfo
+	anonymous bool // Requests without credentials are made by system:anonymous, else rejected
+}
+
+// userKey is the request context key of the authenticated user
+type userKey struct{}
+
+// SetAuthorization sets the comma-separated authorization modes, AlwaysAllow when empty, and
+// the static token file authenticating bearer tokens, in the format of the kube-apiserver
+// --token-auth-file: token,user,uid and optionally "group1,group2" per line. Without a token
+// file, bearer tokens are ignored and requests are anonymous. Unless anonymous is set, the
+// requests without credentials are rejected, which requires a token file.
+func (s *Server) SetAuthorization(modes, tokenFile string, anonymous bool) error {
+	settings := &authorization{anonymous: anonymous}
+	if strings.TrimSpace(modes) == "" {
+		modes = AuthorizationModeAlwaysAllow
+	}
+	seen := map[string]bool{}
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		if _, ok := authorizers[mode]; !ok {
+			return fmt.Errorf("unknown authorization mode %q (supported: %s, %s, %s, %s, %s)", mode,
+				AuthorizationModeAlwaysAllow, AuthorizationModeAlwaysDeny, AuthorizationModeNode, AuthorizationModeSimpleRBAC, AuthorizationModeAnonymousReadOnly)
+		}
+		if seen[mode] {
+			return fmt.Errorf("authorization mode %s is listed twice", mode)
+		}
+		seen[mode] = true
+		settings.modes = append(settings.modes, mode)
+	}
+
+	if tokenFile != "" {
+		tokens, err := readTokenFile(tokenFile)
+		if err != nil {
+			return err
+		}
+		settings.tokens = tokens
+	} else if !anonymous {
+		return fmt.Errorf("disabling anonymous authentication requires a token file, or no request could authenticate")
+	}
+	s.authorization.Store(settings)
+	return nil
+}
+
+// readTokenFile reads the users of the bearer tokens from a static token file
+func readTokenFile(path string) (map[string]AuditUserInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid token file %s: %v", path, err)
+	}
+
+	tokens := map[string]AuditUserInfo{}
+	for i, record := range records {
+		if len(record) < 3 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("invalid token file %s: line %d must be token,user,uid[,\"groups\"]", path, i+1)
+		}
+		if _, ok := tokens[record[0]]; ok {
+			return nil, fmt.Errorf("invalid token file %s: duplicate token on line %d", path, i+1)
+		}
+		user := AuditUserInfo{Username: record[1]}
+		if len(record) > 3 {
+			for _, group := range strings.Split(record[3], ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					user.Groups = append(user.Groups, group)
+				}
+			}
+		}
+		user.Groups = append(user.Groups, "system:authenticated")
+		tokens[record[0]] = user
+	}
+	return tokens, nil
+}
+
+// authenticate returns the user of the bearer token of a request, a service account or a user
+// of the token file, reporting false for unknown tokens; requests without token, or with
+// another token without token file, are anonymous, and rejected as such when anonymous
+// requests are not allowed
+func (a *authorization) authenticate(r *http.Request, serviceAccounts *serviceAccountTokens) (AuditUserInfo, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if ok && serviceAccounts != nil {
+		if user, valid, ours := serviceAccounts.authenticate(token); ours {
+			return user, valid
+		}
+	}
+	if !ok || a.tokens == nil {
+		user := requestUser(r)
+		return user, a.anonymous || user.Username != anonymousUser
+	}
+	for candidate, user := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			return user, true
+		}
+	}
+	return AuditUserInfo{}, false
+}
+
+// authorize asks the authorization modes in order whether a user may make a request
+func (a *authorization) authorize(user AuditUserInfo, info *RequestInfo, path string) bool {
+	for _, mode := range a.modes {
+		switch authorizers[mode](user, info, path) {
+		case decisionAllow:
+			return true
+		case decisionDeny:
+			return false
+		}
+	}
+	return false
+}
+
+// selfAuthenticatedPath reports whether the handler of a path checks its own credentials:
+// the health probes, open to all, and the debug endpoints taking the debug token
+func selfAuthenticatedPath(path string) bool {
+	return isHealthPath(path) || path == "/debug/bundle" || path == "/debug/backup"
+}
+
+// withAuthentication sets the user of the bearer token of requests, rejecting the requests
+// with an unknown token, and the anonymous ones when they are not allowed, except on the plain
+// HTTP listener
+func (s *Server) withAuthentication(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := s.authorization.Load()
+		if settings == nil || selfAuthenticatedPath(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		user, ok := settings.authenticate(r, s.serviceAccounts)
+		if !ok && r.TLS == nil && user.Username == anonymousUser {
+			ok = true
+		}
+		if !ok {
+			s.writeStatusError(w, apierrors.NewUnauthorized("Unauthorized"))
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+// withAuthorization forbids the requests the authorization modes do not allow, but for the
+// reviews users make of their own permissions. The plain HTTP listener, which only binds
+// loopback addresses, is not authorized.
+func (s *Server) withAuthorization(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		settings := s.authorization.Load()
+		if settings == nil || r.TLS == nil || selfAuthenticatedPath(r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		user := requestUser(r)
+		info := parseRequestInfo(r)
+		selfReview := info.IsResourceRequest && info.APIGroup == authorizationGroup && selfReviewResources[info.Resource]
+		if selfReview || settings.authorize(user, info, r.URL.Path) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		klog.V(2).Infof("Forbidden %s %s for user %q", r.Method, r.URL.Path, user.Username)
+		if !info.IsResourceRequest {
+			s.writeStatusError(w, apierrors.NewForbidden(schema.GroupResource{}, "",
+				fmt.Errorf("User %q cannot %s path %q", user.Username, info.Verb, r.URL.Path)))
+			return
+		}
+		resource := info.Resource
+		if info.Subresource != "" {
+			resource += "/" + info.Subresource
+		}
+		reason := fmt.Sprintf("User %q cannot %s resource %q in API group %q", user.Username, info.Verb, resource, info.APIGroup)
+		if info.Namespace != "" && info.Resource != "namespaces" {
+			reason += fmt.Sprintf(" in the namespace %q", info.Namespace)
+		} else {
+			reason += " at the cluster scope"
+		}
+		s.writeStatusError(w, apierrors.NewForbidden(schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}, info.Name, fmt.Errorf("%s", reason)))
+	})
+}
+
+// readOnlyRequest reports whether a request only reads: get, list and watch, without the
+// subresources that run commands in or connect to pods, which kubectl opens with GET
+func readOnlyRequest(info *RequestInfo) bool {
+	switch info.Subresource {
+	case "exec", "attach", "portforward", "proxy":
+		return false
+	}
+	return info.Verb == "get" || info.Verb == "list" || info.Verb == "watch"
+}
+
+// hostPath reports whether a path serves the host logs or the debug endpoints, which only the
+// users with full access reach
+func hostPath(path string) bool {
+	return path == "/logs" || strings.HasPrefix(path, "/logs/") || strings.HasPrefix(path, "/debug/")
+}
+
+// hasGroup reports whether a user is in a group
+func hasGroup(user AuditUserInfo, group string) bool {
+	for _, candidate := range user.Groups {
+		if candidate == group {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeAnonymousReadOnly lets anonymous users read the API, but not secrets, the host
+// logs nor the debug endpoints, as the view role of Kubernetes does
+func authorizeAnonymousReadOnly(user AuditUserInfo, info *RequestInfo, path string) decision {
+	if user.Username != anonymousUser || !readOnlyRequest(info) {
+		return decisionNoOpinion
+	}
+	if !info.IsResourceRequest {
+		if hostPath(path) {
+			return decisionNoOpinion
+		}
+		return decisionAllow
+	}
+	if info.Resource == "secrets" || (info.Resource == "nodes" && info.Subresource == "proxy") {
+		return decisionNoOpinion
+	}
+	return decisionAllow
+}
+
+// authorizeSimpleRBAC gives the token holders full access, or read-only access for the
+// members of podkube:read-only, to every namespace, or for the members of
+// podkube:namespace:NAME groups to those namespaces, the resources that are not namespaced
+// being read-only to them
+func authorizeSimpleRBAC(user AuditUserInfo, info *RequestInfo, path string) decision {
+	// Node users only get the access of the Node mode
+	if !hasGroup(user, "system:authenticated") || hasGroup(user, nodesGroup) {
+		return decisionNoOpinion
+	}
+	if hasGroup(user, readOnlyGroup) && !readOnlyRequest(info) {
+		return decisionDeny
+	}
+
+	var namespaces []string
+	for _, group := range user.Groups {
+		if namespace, ok := strings.CutPrefix(group, namespaceGroupPrefix); ok {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return decisionAllow
+	}
+	// Namespace-scoped users neither reach the host logs nor the debug endpoints, nor the pods
+	// of all namespaces
+	if !info.IsResourceRequest {
+		if readOnlyRequest(info) && !hostPath(path) {
+			return decisionAllow
+		}
+		return decisionDeny
+	}
+	if clusterScopedResources[info.Resource] {
+		if readOnlyRequest(info) {
+			return decisionAllow
+		}
+		return decisionDeny
+	}
+	for _, namespace := range namespaces {
+		if info.Namespace == namespace {
+			return decisionAllow
+		}
+	}
+	return decisionDeny
+}
+
+// authorizeNode lets the node users, system:node:NAME in the system:nodes group, read the
+// resources other than secrets and manage their own node and lease, as the Node authorizer
+// does for kubelets
+func authorizeNode(user AuditUserInfo, info *RequestInfo, path string) decision {
+	nodeName, ok := strings.CutPrefix(user.Username, nodeUserPrefix)
+	if !ok || nodeName == "" || !hasGroup(user, nodesGroup) || !info.IsResourceRequest {
+		return decisionNoOpinion
+	}
+	switch {
+	case info.Resource == "nodes" && info.Name == nodeName && info.Subresource != "proxy":
+		return decisionAllow
+	case info.Resource == "leases" && info.Namespace == nodeLeaseNS && (info.Name == nodeName || info.Name == "" && info.Verb == "create"):
+		return decisionAllow
+	case readOnlyRequest(info) && info.Resource != "secrets":
+		return decisionAllow
+	}
+	return decisionNoOpinion
+}
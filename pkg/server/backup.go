@@ -0,0 +1,280 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimachineryversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/pkg/version"
+)
+
+const (
+	// backupIndexFile describes a backup, at the root of its tarball
+	backupIndexFile = "backup.json"
+	// backupStateDir holds the files of the state directory in a backup
+	backupStateDir = "state/"
+	// backupManifestDir holds the manifests of the running pods in a backup, by node
+	backupManifestDir = "manifests/"
+	// backupKeysDir is the directory of the state directory holding the private keys of the
+	// self-signed certificates, left out of backups unless asked for
+	backupKeysDir = "pki"
+	// maxBackupFileSize bounds the files read from a backup
+	maxBackupFileSize = 64 << 20
+)
+
+// BackupIndex describes a backup: the podKube that wrote it and the pods it holds the
+// manifest of, and those it could not generate one for
+type BackupIndex struct {
+	Version apimachineryversion.Info `json:"version"`
+	Created time.Time                `json:"created"`
+	State   []string                 `json:"state"` // Files of the state directory
+	Keys    bool                     `json:"keys"`  // Whether the pki directory is included
+	Pods    []BackupPod              `json:"pods"`
+	Errors  []string                 `json:"errors,omitempty"`
+}
+
+// BackupPod is a running pod whose manifest a backup holds
+type BackupPod struct {
+	Node      string `json:"node"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Manifest  string `json:"manifest"` // Path of the manifest in the backup
+}
+
+// Backup is a backup read back by ReadBackup
+type Backup struct {
+	Index     BackupIndex
+	State     map[string][]byte // Files of the state directory, by slash-separated relative path
+	Manifests map[string][]byte // Manifests, by path in the backup
+}
+
+// WriteBackup writes a backup of podKube, a gzipped tarball holding the files of the state
+// directory, which podman does not know about, and the manifest of every running pod of the
+// cluster, as podman kube generate writes it, so that the environment can be restored on
+// another host. The state is copied as it is stored, encrypted if it is. Pods whose manifest
+// cannot be listed or generated, such as those of docker nodes, are reported in the index
+// rather than failing the backup. The pki directory, which holds the private keys of the
+// self-signed certificates, is only included with includeKeys; without it the restored
+// server generates a new CA.
+func WriteBackup(ctx context.Context, w io.Writer, stateDir string, cluster *storage.Cluster, includeKeys bool) (*BackupIndex, error) {
+	now := time.Now()
+	index := &BackupIndex{Version: version.Get(), Created: now.UTC(), State: []string{}, Keys: includeKeys, Pods: []BackupPod{}}
+	files := map[string][]byte{}
+
+	if stateDir != "" {
+		err := filepath.WalkDir(stateDir, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && file == stateDir {
+					return filepath.SkipDir // Nothing was persisted yet
+				}
+				return err
+			}
+			if entry.IsDir() && !includeKeys && file == filepath.Join(stateDir, backupKeysDir) {
+				return filepath.SkipDir
+			}
+			if !entry.Type().IsRegular() || strings.HasSuffix(file, ".tmp") {
+				return nil
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(stateDir, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			index.State = append(index.State, rel)
+			files[backupStateDir+rel] = data
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state directory %s: %v", stateDir, err)
+		}
+	}
+
+	// The state is backed up even when pods cannot be listed, such as when a node is down
+	pods, err := cluster.List(ctx, "", "", "")
+	if err != nil {
+		index.Errors = append(index.Errors, fmt.Sprintf("failed to list pods: %v", err))
+		pods = &corev1.PodList{}
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		manifest, err := backupManifest(ctx, cluster, pod)
+		if err != nil {
+			index.Errors = append(index.Errors, fmt.Sprintf("pod %s/%s: %v", pod.Namespace, pod.Name, err))
+			continue
+		}
+		name := backupManifestDir + pod.Spec.NodeName + "/" + pod.Namespace + "/" + pod.Name + ".yaml"
+		files[name] = manifest
+		index.Pods = append(index.Pods, BackupPod{Node: pod.Spec.NodeName, Namespace: pod.Namespace, Name: pod.Name, Manifest: name})
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files[backupIndexFile] = append(data, '\n')
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	dir := "podkube-backup-" + now.UTC().Format("20060102-150405") + "/"
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{
+			Name:    dir + name,
+			Mode:    0600,
+			Size:    int64(len(files[name])),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return index, gz.Close()
+}
+
+// backupManifest returns the manifest of a running pod, generated by podman on its node
+func backupManifest(ctx context.Context, cluster *storage.Cluster, pod *corev1.Pod) ([]byte, error) {
+	node, ok := cluster.Node(pod.Spec.NodeName)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", pod.Spec.NodeName)
+	}
+	if node.Storage.Runtime() != storage.RuntimePodman {
+		return nil, fmt.Errorf("node %s runs %s, which cannot generate manifests", node.Name, node.Storage.Runtime())
+	}
+	container, err := runtimeContainer(pod, "")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, bundleCommandTimeout)
+	defer cancel()
+	args := node.Storage.CommandLine("kube", "generate", "--type", "pod", container)
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("podman kube generate failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("podman kube generate failed: %v", err)
+	}
+	return output, nil
+}
+
+// ReadBackup reads a backup written by WriteBackup
+func ReadBackup(r io.Reader) (*Backup, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a podKube backup: %v", err)
+	}
+	defer gz.Close()
+
+	backup := &Backup{State: map[string][]byte{}, Manifests: map[string][]byte{}}
+	foundIndex := false
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Names are podkube-backup-TIMESTAMP/FILE; anything escaping the backup is rejected
+		_, name, ok := strings.Cut(header.Name, "/")
+		if !ok || name == "" || path.Clean(name) != name || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("invalid backup: unexpected file %q", header.Name)
+		}
+		if header.Size > maxBackupFileSize {
+			return nil, fmt.Errorf("invalid backup: %s is too large", name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxBackupFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup: %v", err)
+		}
+
+		switch {
+		case name == backupIndexFile:
+			if err := json.Unmarshal(data, &backup.Index); err != nil {
+				return nil, fmt.Errorf("invalid backup index: %v", err)
+			}
+			foundIndex = true
+		case strings.HasPrefix(name, backupStateDir):
+			backup.State[strings.TrimPrefix(name, backupStateDir)] = data
+		case strings.HasPrefix(name, backupManifestDir):
+			backup.Manifests[name] = data
+		}
+	}
+	if !foundIndex {
+		return nil, fmt.Errorf("not a podKube backup: no %s", backupIndexFile)
+	}
+	return backup, nil
+}
+
+// handleBackup serves a backup of the state directory and of the manifests of the running
+// pods to the requests bearing the debug token. The private keys are never served: the debug
+// token grants diagnostics, not the server's identity.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	settings := s.diagnostics.Load()
+	if settings == nil || settings.token == "" {
+		s.writeStatusError(w, apierrors.NewForbidden(debugResource, "backup", fmt.Errorf("backups are disabled, set --debug-token-file to enable them")))
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !validDebugToken(settings, token) {
+		s.writeStatusError(w, apierrors.NewUnauthorized("a valid debug token is required"))
+		return
+	}
+
+	// Written to memory first, so that a failure is answered with an error status; a backup
+	// holds small state files and manifests
+	klog.Infof("Writing backup for %s", strings.Join(sourceIPs(r), ","))
+	var backup bytes.Buffer
+	index, err := WriteBackup(r.Context(), &backup, s.stateDir, s.podStorage, false)
+	if err != nil {
+		klog.Errorf("Failed to write backup: %v", err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return
+	}
+	for _, skipped := range index.Errors {
+		klog.Warningf("Incomplete backup: %s", skipped)
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="podkube-backup-%s.tar.gz"`, index.Created.Format("20060102-150405")))
+	w.Write(backup.Bytes())
+}
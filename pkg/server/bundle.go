@@ -0,0 +1,242 @@
+package server
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/version"
+)
+
+const (
+	// bundleAuditEvents is how many of the last audit events a diagnostics bundle includes
+	bundleAuditEvents = 1000
+	// bundleCommandTimeout bounds each runtime command run for a diagnostics bundle
+	bundleCommandTimeout = 30 * time.Second
+)
+
+// debugResource names the debug endpoints in API errors
+var debugResource = schema.GroupResource{Resource: "debug"}
+
+// BundleSources are what a diagnostics bundle is gathered from
+type BundleSources struct {
+	// Flags are the effective command line flags, by name
+	Flags map[string]string
+	// AuditLogPath is the audit log the last events are read from, none when empty or "-"
+	AuditLogPath string
+	// Commands are the command lines whose output is included, by file name
+	Commands map[string][]string
+	// Goroutines includes the stacks of the goroutines of the running process
+	Goroutines bool
+	// Files are included as they are, by file name
+	Files map[string][]byte
+}
+
+// WriteBundle writes a diagnostics bundle, a gzipped tarball for issue reports, with the
+// version and flags of podKube, its last audit events without their request and response
+// bodies, and the output of the commands. A source that fails is reported in its file
+// rather than failing the bundle.
+func WriteBundle(ctx context.Context, w io.Writer, sources BundleSources) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	dir := "podkube-diagnostics-" + now.UTC().Format("20060102-150405") + "/"
+
+	files := map[string][]byte{}
+	for name, data := range sources.Files {
+		files[name] = data
+	}
+	info, err := json.MarshalIndent(version.Get(), "", "  ")
+	if err != nil {
+		return err
+	}
+	files["version.json"] = append(info, '\n')
+	files["flags.txt"] = bundleFlags(sources.Flags)
+	if sources.AuditLogPath != "" && sources.AuditLogPath != "-" {
+		files["audit.log"] = bundleAuditLog(sources.AuditLogPath)
+	}
+	for name, args := range sources.Commands {
+		files[name] = bundleCommand(ctx, args)
+	}
+	if sources.Goroutines {
+		var stacks bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&stacks, 2); err != nil {
+			fmt.Fprintf(&stacks, "failed to dump goroutines: %v\n", err)
+		}
+		files["goroutines.txt"] = stacks.Bytes()
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{
+			Name:    dir + name,
+			Mode:    0600,
+			Size:    int64(len(files[name])),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// bundleFlags writes flags as sorted name=value lines
+func bundleFlags(flags map[string]string) []byte {
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&out, "%s=%s\n", name, flags[name])
+	}
+	return out.Bytes()
+}
+
+// bundleAuditLog returns the last audit events of an audit log, without the request and
+// response objects of RequestResponse events, which may hold secrets
+func bundleAuditLog(path string) []byte {
+	f, err := os.Open(path)
+	if err != nil {
+		return []byte(fmt.Sprintf("failed to read audit log %s: %v\n", path, err))
+	}
+	defer f.Close()
+
+	var events []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*maxAuditBodySize)
+	for scanner.Scan() {
+		events = append(events, scanner.Text())
+		if len(events) > bundleAuditEvents {
+			events = events[1:]
+		}
+	}
+
+	var out bytes.Buffer
+	for _, line := range events {
+		var event map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		delete(event, "requestObject")
+		delete(event, "responseObject")
+		trimmed, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		out.Write(append(trimmed, '\n'))
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(&out, "failed to read audit log %s: %v\n", path, err)
+	}
+	return out.Bytes()
+}
+
+// bundleCommand returns the output of a command line, followed by its error when it fails
+func bundleCommand(ctx context.Context, args []string) []byte {
+	ctx, cancel := context.WithTimeout(ctx, bundleCommandTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		output = append(output, fmt.Sprintf("\n%s failed: %v\n", strings.Join(args, " "), err)...)
+	}
+	return output
+}
+
+// diagnostics holds the settings of the /debug/bundle endpoint
+type diagnostics struct {
+	token        string
+	flags        map[string]string
+	auditLogPath string
+}
+
+// SetDiagnostics enables /debug/bundle for the bearer token read from tokenFile, disabling it
+// when tokenFile is empty; flags are the effective flags, and auditLogPath the audit log,
+// included in bundles
+func (s *Server) SetDiagnostics(tokenFile string, flags map[string]string, auditLogPath string) error {
+	settings := &diagnostics{flags: flags, auditLogPath: auditLogPath}
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read debug token: %v", err)
+		}
+		settings.token = strings.TrimSpace(string(data))
+		if settings.token == "" {
+			return fmt.Errorf("debug token file %s is empty", tokenFile)
+		}
+	}
+	s.diagnostics.Store(settings)
+	return nil
+}
+
+// validDebugToken reports whether a bearer token is the debug token
+func validDebugToken(settings *diagnostics, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(settings.token)) == 1
+}
+
+// handleBundle serves a diagnostics bundle of the server, its nodes and its goroutines to the
+// requests bearing the debug token
+func (s *Server) handleBundle(w http.ResponseWriter, r *http.Request) {
+	settings := s.diagnostics.Load()
+	if settings == nil || settings.token == "" {
+		s.writeStatusError(w, apierrors.NewForbidden(debugResource, "bundle", fmt.Errorf("diagnostics bundles are disabled, set --debug-token-file to enable them")))
+		return
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !validDebugToken(settings, token) {
+		s.writeStatusError(w, apierrors.NewUnauthorized("a valid debug token is required"))
+		return
+	}
+
+	sources := BundleSources{
+		Flags:        settings.flags,
+		AuditLogPath: settings.auditLogPath,
+		Commands:     map[string][]string{},
+		Goroutines:   true,
+		Files:        map[string][]byte{},
+	}
+	for _, node := range s.podStorage.Nodes() {
+		sources.Commands["nodes/"+node.Name+"/info.txt"] = node.Storage.CommandLine("info")
+		sources.Commands["nodes/"+node.Name+"/ps.txt"] = node.Storage.CommandLine("ps", "--all")
+	}
+	if sessions, err := json.MarshalIndent(s.execSessions.list(), "", "  "); err == nil {
+		sources.Files["exec-sessions.json"] = append(sessions, '\n')
+	}
+
+	klog.Infof("Writing diagnostics bundle for %s", strings.Join(sourceIPs(r), ","))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="podkube-diagnostics-%s.tar.gz"`, time.Now().UTC().Format("20060102-150405")))
+	if err := WriteBundle(r.Context(), w, sources); err != nil {
+		klog.Errorf("Failed to write diagnostics bundle: %v", err)
+	}
+}
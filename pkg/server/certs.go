@@ -0,0 +1,357 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/config"
+)
+
+const (
+	// caValidity and servingCertValidity are the lifetimes of the generated certificates
+	caValidity          = 10 * 365 * 24 * time.Hour
+	servingCertValidity = 365 * 24 * time.Hour
+	// servingCertRenewBefore is how long before expiry the serving certificate is regenerated
+	servingCertRenewBefore = 30 * 24 * time.Hour
+
+	caCertFileName      = "ca.crt"
+	caKeyFileName       = "ca.key"
+	servingCertFileName = "serving.crt"
+	servingKeyFileName  = "serving.key"
+)
+
+// SetSelfSignedCertConfig configures the certificate used when no --cert-file/--key-file is given:
+// the CA and serving certificate are persisted under stateDir/pki (kept in memory when stateDir
+// is empty), and sans are added to the serving certificate's subject alternative names.
+func (s *Server) SetSelfSignedCertConfig(stateDir string, sans []string) {
+	s.stateDir = stateDir
+	s.tlsSANs = sans
+}
+
+// certKeyPair is a parsed certificate with its private key
+type certKeyPair struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+}
+
+// generateSelfSignedCert returns a serving certificate signed by the adapter's own CA.
+// Both are reused across restarts when a state directory is configured; the serving
+// certificate is regenerated when it is about to expire or does not cover all SANs.
+func (s *Server) generateSelfSignedCert() (tls.Certificate, error) {
+	dnsNames, ipAddresses := s.servingSANs()
+
+	pkiDir := ""
+	if s.stateDir != "" {
+		pkiDir = filepath.Join(s.stateDir, "pki")
+		if err := os.MkdirAll(pkiDir, 0700); err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to create %s: %v", pkiDir, err)
+		}
+	}
+
+	ca, err := loadCertKeyPair(pkiDir, caCertFileName, caKeyFileName)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if ca == nil || !ca.cert.IsCA || time.Now().After(ca.cert.NotAfter) {
+		klog.Infof("Generating self-signed CA")
+		ca, err = newCertKeyPair(&x509.Certificate{
+			Subject: pkix.Name{
+				CommonName:   "podman-k8s-adapter-ca",
+				Organization: []string{"Podman-K8s-Adapter"},
+			},
+			NotAfter:              time.Now().Add(caValidity),
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, nil)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to generate CA: %v", err)
+		}
+		if err := saveCertKeyPair(pkiDir, caCertFileName, caKeyFileName, ca); err != nil {
+			return tls.Certificate{}, err
+		}
+		// A new CA invalidates any previous serving certificate
+		if pkiDir != "" {
+			os.Remove(filepath.Join(pkiDir, servingCertFileName))
+		}
+	}
+
+	serving, err := loadCertKeyPair(pkiDir, servingCertFileName, servingKeyFileName)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if serving == nil || !servingCertValid(serving.cert, ca.cert, dnsNames, ipAddresses) {
+		klog.Infof("Generating serving certificate for %v %v", dnsNames, ipAddresses)
+		serving, err = newCertKeyPair(&x509.Certificate{
+			Subject: pkix.Name{
+				CommonName:   "podman-k8s-adapter",
+				Organization: []string{"Podman-K8s-Adapter"},
+			},
+			NotAfter:    time.Now().Add(servingCertValidity),
+			KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			DNSNames:    dnsNames,
+			IPAddresses: ipAddresses,
+		}, ca)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to generate serving certificate: %v", err)
+		}
+		if err := saveCertKeyPair(pkiDir, servingCertFileName, servingKeyFileName, serving); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	if pkiDir != "" {
+		klog.Infof("Clients can verify the server with the CA certificate %s", filepath.Join(pkiDir, caCertFileName))
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{serving.cert.Raw, ca.cert.Raw},
+		PrivateKey:  serving.key,
+		Leaf:        serving.cert,
+	}, nil
+}
+
+// servingSANs returns the names the serving certificate must cover: loopback, the local
+// hostname, the listen address when it is a specific one, and the configured extra SANs
+func (s *Server) servingSANs() ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	ipAddresses := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}
+
+	add := func(name string) {
+		if ip := net.ParseIP(name); ip != nil {
+			if ip.IsUnspecified() {
+				return
+			}
+			for _, existing := range ipAddresses {
+				if existing.Equal(ip) {
+					return
+				}
+			}
+			ipAddresses = append(ipAddresses, ip)
+			return
+		}
+		for _, existing := range dnsNames {
+			if existing == name {
+				return
+			}
+		}
+		dnsNames = append(dnsNames, name)
+	}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		add(hostname)
+	}
+	if s.host != "" {
+		add(s.host)
+	}
+	for _, san := range s.tlsSANs {
+		add(san)
+	}
+	for _, san := range s.kubernetesServiceSANs() {
+		add(san)
+	}
+
+	return dnsNames, ipAddresses
+}
+
+// servingCertValid reports whether a persisted serving certificate can be reused
+func servingCertValid(cert, caCert *x509.Certificate, dnsNames []string, ipAddresses []net.IP) bool {
+	if time.Now().Add(servingCertRenewBefore).After(cert.NotAfter) {
+		return false
+	}
+	if !bytes.Equal(cert.RawIssuer, caCert.RawSubject) || cert.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	for _, ip := range ipAddresses {
+		if cert.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// newCertKeyPair creates a certificate from template, signed by parent (self-signed when nil)
+func newCertKeyPair(template *x509.Certificate, parent *certKeyPair) (*certKeyPair, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certKeyPair{cert: cert, key: key}, nil
+}
+
+// loadCertKeyPair reads a PEM certificate and key from dir; it returns nil when they do not exist
+func loadCertKeyPair(dir, certFileName, keyFileName string) (*certKeyPair, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	certPath := filepath.Join(dir, certFileName)
+	keyPath := filepath.Join(dir, keyFileName)
+	certPEM, err := os.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", certPath, err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", keyPath, err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		klog.Warningf("Ignoring unparsable certificate %s, regenerating it", certPath)
+		return nil, nil
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		klog.Warningf("Ignoring unparsable certificate %s, regenerating it: %v", certPath, err)
+		return nil, nil
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		klog.Warningf("Ignoring unparsable key %s, regenerating it: %v", keyPath, err)
+		return nil, nil
+	}
+
+	return &certKeyPair{cert: cert, key: key}, nil
+}
+
+// saveCertKeyPair writes a certificate and key as PEM files to dir (no-op when dir is empty)
+func saveCertKeyPair(dir, certFileName, keyFileName string, pair *certKeyPair) error {
+	if dir == "" {
+		return nil
+	}
+
+	keyPath := filepath.Join(dir, keyFileName)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(pair.key)})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", keyPath, err)
+	}
+
+	certPath := filepath.Join(dir, certFileName)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.cert.Raw})
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", certPath, err)
+	}
+
+	return nil
+}
+
+// certPollInterval is how often provided certificate files are checked for changes
+const certPollInterval = 10 * time.Second
+
+// certReloader serves a certificate loaded from files and reloads it when they change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertReloader loads the initial certificate from certFile and keyFile
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// reload reads the certificate files again; the current certificate is kept on failure
+func (c *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate %s and key %s: %v", c.certFile, c.keyFile, err)
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+
+	if cert.Leaf != nil {
+		klog.Infof("Loaded TLS certificate %s (serial %s, expires %s)", c.certFile, cert.Leaf.SerialNumber, cert.Leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// getCertificate is the tls.Config GetCertificate callback
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// watch reloads the certificate whenever the certificate or key file changes, until stopCh is closed.
+// A cert-manager or ACME client usually rewrites both files; a pair that does not match yet is
+// retried on the next change or poll.
+func (c *certReloader) watch(stopCh <-chan struct{}) {
+	reload := func() {
+		if err := c.reload(); err != nil {
+			klog.Errorf("Failed to reload TLS certificate, keeping the current one: %v", err)
+		}
+	}
+	go config.Watch(c.keyFile, certPollInterval, stopCh, reload)
+	config.Watch(c.certFile, certPollInterval, stopCh, reload)
+}
+
+// ReloadCertificate reloads the provided --cert-file/--key-file immediately.
+// It is a no-op when the server uses its self-signed certificate.
+func (s *Server) ReloadCertificate() error {
+	if s.certReloader == nil {
+		return nil
+	}
+	return s.certReloader.reload()
+}
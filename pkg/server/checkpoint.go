@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// checkpointMediaType is the media type of checkpoint archives
+const checkpointMediaType = "application/octet-stream"
+
+// handlePodCheckpoint handles pod checkpoint requests: /api/v1/namespaces/{namespace}/pods/{name}/checkpoint.
+// The response body is the checkpoint archive, which a restore request takes back, on this
+// or another host. The pod is stopped unless leaveRunning=true.
+func (s *Server) handlePodCheckpoint(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if s.rejectIfShuttingDown(w) {
+		return
+	}
+	defer s.beginSession()()
+
+	leaveRunning := r.URL.Query().Get("leaveRunning") == "true"
+	archive, err := s.podStorage.Checkpoint(r.Context(), namespace, name, leaveRunning)
+	if err != nil {
+		s.writeCheckpointError(w, name, err)
+		return
+	}
+	defer archive.Close()
+
+	w.Header().Set("Content-Type", checkpointMediaType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-checkpoint.tar"`, name))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, archive); err != nil {
+		klog.Errorf("Failed to send checkpoint of pod %s/%s: %v", namespace, name, err)
+	}
+}
+
+// handlePodRestore handles pod restore requests: /api/v1/namespaces/{namespace}/pods/{name}/restore.
+// The request body is a checkpoint archive; the pod is restored under the name of the URL,
+// on the node given by the nodeName parameter or on a node picked as for a new pod.
+func (s *Server) handlePodRestore(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if s.rejectIfShuttingDown(w) {
+		return
+	}
+	defer s.beginSession()()
+
+	pod, err := s.podStorage.Restore(r.Context(), namespace, name, r.URL.Query().Get("nodeName"), r.Body)
+	if err != nil {
+		s.writeCheckpointError(w, name, err)
+		return
+	}
+	s.writeObjectWithStatus(w, r, http.StatusCreated, pod)
+}
+
+// writeCheckpointError reports a checkpoint or restore error as a Kubernetes Status
+func (s *Server) writeCheckpointError(w http.ResponseWriter, name string, err error) {
+	podResource := schema.GroupResource{Resource: "pods"}
+	switch {
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	case errors.Is(err, storage.ErrCheckpointUnsupported):
+		s.writeStatusError(w, apierrors.NewMethodNotSupported(podResource, "checkpoint"))
+	case errors.Is(err, storage.ErrUnschedulable):
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+	case strings.Contains(err.Error(), "already exists"):
+		s.writeStatusError(w, apierrors.NewAlreadyExists(podResource, name))
+	case strings.Contains(err.Error(), "not found"):
+		s.writeStatusError(w, apierrors.NewNotFound(podResource, name))
+	default:
+		klog.Errorf("Checkpoint request for pod %s failed: %v", name, err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxTrackedClients caps the number of clients with their own requests counters and metric
+	// labels; the requests of further clients are counted as otherClient
+	maxTrackedClients = 100
+	// maxClientNameLength bounds the client names derived from user agents
+	maxClientNameLength = 64
+
+	unknownClient = "unknown"
+	otherClient   = "other"
+)
+
+// clientName identifies the client of a request by the product of its user agent, e.g.
+// kubectl/v1.29.0 for "kubectl/v1.29.0 (linux/amd64) kubernetes/3f7a50f", the format of
+// client-go user agents, leaving out the platform and commit
+func clientName(userAgent string) string {
+	name, _, _ := strings.Cut(strings.TrimSpace(userAgent), " ")
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > maxClientNameLength {
+		name = name[:maxClientNameLength]
+	}
+	if name == "" {
+		return unknownClient
+	}
+	return name
+}
+
+// clientStats are the requests of a client
+type clientStats struct {
+	requests map[string]uint64 // By verb
+	watches  int
+	lastSeen time.Time
+}
+
+// clientSummary is a client, as listed by /debug/clients
+type clientSummary struct {
+	Client   string            `json:"client"`
+	Requests map[string]uint64 `json:"requests"` // By verb
+	Watches  int               `json:"watches"`
+	LastSeen time.Time         `json:"lastSeen"`
+}
+
+// watchClient is an open watch, as listed by /debug/clients
+type watchClient struct {
+	ID        string    `json:"id"`
+	Client    string    `json:"client"`
+	UserAgent string    `json:"userAgent"`
+	SourceIPs []string  `json:"sourceIPs"`
+	Resource  string    `json:"resource"`
+	Namespace string    `json:"namespace,omitempty"`
+	Started   time.Time `json:"started"`
+}
+
+// clientTracker counts the requests of each client, identified by its user agent, and tracks
+// the open watches, so that operators can tell which tool loads the adapter
+type clientTracker struct {
+	mu      sync.Mutex
+	nextID  uint64
+	clients map[string]*clientStats
+	watches map[string]*watchClient
+}
+
+// stats returns the stats of a client, creating them unless maxTrackedClients are tracked,
+// in which case the client is counted as otherClient; it returns the name the client is
+// tracked under. m.mu must be held.
+func (m *clientTracker) stats(client string) (string, *clientStats) {
+	if m.clients == nil {
+		m.clients = map[string]*clientStats{}
+	}
+	if _, ok := m.clients[client]; !ok && len(m.clients) >= maxTrackedClients {
+		client = otherClient
+	}
+	stats, ok := m.clients[client]
+	if !ok {
+		stats = &clientStats{requests: map[string]uint64{}}
+		m.clients[client] = stats
+	}
+	return client, stats
+}
+
+// request counts a request of a client with the given verb
+func (m *clientTracker) request(client, verb string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, stats := m.stats(client)
+	stats.requests[verb]++
+	stats.lastSeen = time.Now()
+}
+
+// watch registers an open watch; the returned function must be called when it ends
+func (m *clientTracker) watch(watch watchClient) func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.watches == nil {
+		m.watches = map[string]*watchClient{}
+	}
+	m.nextID++
+	watch.ID = strconv.FormatUint(m.nextID, 10)
+	watch.Started = time.Now()
+	m.watches[watch.ID] = &watch
+	client, stats := m.stats(watch.Client)
+	stats.watches++
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.watches, watch.ID)
+		m.clients[client].watches--
+	}
+}
+
+// list returns the clients, by name, and the open watches, oldest first
+func (m *clientTracker) list() ([]clientSummary, []watchClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clients := make([]clientSummary, 0, len(m.clients))
+	for name, stats := range m.clients {
+		requests := make(map[string]uint64, len(stats.requests))
+		for verb, count := range stats.requests {
+			requests[verb] = count
+		}
+		clients = append(clients, clientSummary{Client: name, Requests: requests, Watches: stats.watches, LastSeen: stats.lastSeen})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].Client < clients[j].Client
+	})
+
+	watches := make([]watchClient, 0, len(m.watches))
+	for _, watch := range m.watches {
+		watches = append(watches, *watch)
+	}
+	sort.Slice(watches, func(i, j int) bool {
+		return watches[i].Started.Before(watches[j].Started)
+	})
+	return clients, watches
+}
+
+// writeMetrics writes the requests and open watches of each client in the Prometheus text
+// format
+func (m *clientTracker) writeMetrics(w *metricsWriter) {
+	clients, _ := m.list()
+
+	w.header("podkube_requests_total", "counter", "Number of requests served, by client (the product of its user agent) and verb")
+	for _, client := range clients {
+		verbs := make([]string, 0, len(client.Requests))
+		for verb := range client.Requests {
+			verbs = append(verbs, verb)
+		}
+		sort.Strings(verbs)
+		for _, verb := range verbs {
+			w.sample("podkube_requests_total", float64(client.Requests[verb]), "client", client.Client, "verb", verb)
+		}
+	}
+	w.header("podkube_watches_active", "gauge", "Number of open watches, by client")
+	for _, client := range clients {
+		w.sample("podkube_watches_active", float64(client.Watches), "client", client.Client)
+	}
+}
+
+// handleClientList lists the clients of the server with their requests, and the open watches
+func (s *Server) handleClientList(w http.ResponseWriter, r *http.Request) {
+	clients, watches := s.clients.list()
+	s.writeJSON(w, map[string]interface{}{
+		"clients": clients,
+		"watches": watches,
+	})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+	kjson "sigs.k8s.io/json"
+	"sigs.k8s.io/yaml"
+)
+
+// Media types negotiated on API requests and responses
+const (
+	mediaTypeJSON     = "application/json"
+	mediaTypeYAML     = "application/yaml"
+	mediaTypeProtobuf = "application/vnd.kubernetes.protobuf"
+)
+
+// Values of the fieldValidation query parameter
+const (
+	fieldValidationIgnore = "Ignore"
+	fieldValidationWarn   = "Warn"
+	fieldValidationStrict = "Strict"
+)
+
+// errUnsupportedMediaType is returned when a request body has a Content-Type that cannot be decoded
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// scheme registers the core v1 types so they can be encoded to and decoded from protobuf
+var scheme = runtime.NewScheme()
+
+// protobufSerializer encodes and decodes the protobuf envelope used by Kubernetes clients
+var protobufSerializer = protobuf.NewSerializer(scheme, scheme)
+
+func init() {
+	utilruntime.Must(corev1.AddToScheme(scheme))
+	metav1.AddToGroupVersion(scheme, schema.GroupVersion{Version: "v1"})
+}
+
+// negotiateMediaType returns the response media type preferred by the Accept header,
+// in the order the client listed them; JSON when nothing supported is listed
+func negotiateMediaType(r *http.Request) string {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil || params["as"] != "" {
+			// Transformed responses (Table, discovery) are negotiated by their handlers
+			continue
+		}
+		switch mediaType {
+		case mediaTypeJSON, mediaTypeYAML, mediaTypeProtobuf:
+			return mediaType
+		case "*/*", "application/*":
+			return mediaTypeJSON
+		}
+	}
+	return mediaTypeJSON
+}
+
+// writeObject writes obj in the media type negotiated from the Accept header. Objects
+// without a protobuf encoding (projects, tables) are written as JSON to protobuf clients.
+func (s *Server) writeObject(w http.ResponseWriter, r *http.Request, obj interface{}) {
+	s.writeObjectWithStatus(w, r, http.StatusOK, obj)
+}
+
+// writeObjectWithStatus is writeObject with an explicit HTTP status code
+func (s *Server) writeObjectWithStatus(w http.ResponseWriter, r *http.Request, statusCode int, obj interface{}) {
+	var data []byte
+	var err error
+
+	mediaType := negotiateMediaType(r)
+	switch mediaType {
+	case mediaTypeYAML:
+		data, err = yaml.Marshal(obj)
+	case mediaTypeProtobuf:
+		data, err = encodeProtobuf(obj)
+		if err != nil {
+			klog.V(4).Infof("Falling back to JSON for %T: %v", obj, err)
+			mediaType = mediaTypeJSON
+			data, err = json.Marshal(obj)
+		}
+	default:
+		data, err = json.Marshal(obj)
+	}
+	if err != nil {
+		klog.Errorf("Failed to encode %s response: %v", mediaType, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if statusCode == http.StatusOK && notModified(w, r, data) {
+		return
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(statusCode)
+	if mediaType == mediaTypeJSON {
+		data = append(data, '\n')
+	}
+	if _, err := w.Write(data); err != nil {
+		klog.V(4).Infof("Failed to write response: %v", err)
+	}
+}
+
+// encodeProtobuf encodes obj in the Kubernetes protobuf envelope
+func encodeProtobuf(obj interface{}) ([]byte, error) {
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a Kubernetes object", obj)
+	}
+	if runtimeObj.GetObjectKind().GroupVersionKind().Empty() {
+		// The protobuf envelope carries the kind, which clients need to decode it
+		gvks, _, err := scheme.ObjectKinds(runtimeObj)
+		if err != nil {
+			return nil, err
+		}
+		runtimeObj.GetObjectKind().SetGroupVersionKind(gvks[0])
+	}
+	var buf bytes.Buffer
+	if err := protobufSerializer.Encode(runtimeObj, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBody decodes the request body into obj according to its Content-Type: JSON (the
+// default), YAML or protobuf. Unknown and duplicate fields are handled according to the
+// fieldValidation query parameter: rejected (Strict), reported as Warning headers (Warn,
+// the default) or dropped (Ignore). Protobuf bodies cannot carry unknown fields.
+func decodeBody(w http.ResponseWriter, r *http.Request, obj runtime.Object) error {
+	fieldValidation := r.URL.Query().Get("fieldValidation")
+	switch fieldValidation {
+	case "":
+		fieldValidation = fieldValidationWarn
+	case fieldValidationIgnore, fieldValidationWarn, fieldValidationStrict:
+	default:
+		return fmt.Errorf("invalid fieldValidation %q (supported: %s, %s, %s)", fieldValidation, fieldValidationIgnore, fieldValidationWarn, fieldValidationStrict)
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	mediaType := mediaTypeJSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid Content-Type %q: %v", contentType, err)
+		}
+	}
+
+	var strictErrors []error
+	switch mediaType {
+	case mediaTypeJSON:
+	case mediaTypeYAML, "application/x-yaml", "text/yaml":
+		jsonData, strictErr := yaml.YAMLToJSONStrict(data)
+		if strictErr != nil {
+			// Duplicate keys are the only error the lenient conversion accepts
+			if jsonData, err = yaml.YAMLToJSON(data); err != nil {
+				return err
+			}
+			strictErrors = append(strictErrors, strictErr)
+		}
+		data = jsonData
+	case mediaTypeProtobuf:
+		_, _, err := protobufSerializer.Decode(data, nil, obj)
+		return err
+	default:
+		return fmt.Errorf("%w %q (supported: %s, %s, %s)", errUnsupportedMediaType, mediaType, mediaTypeJSON, mediaTypeYAML, mediaTypeProtobuf)
+	}
+
+	fieldErrors, err := kjson.UnmarshalStrict(data, obj, kjson.DisallowDuplicateFields, kjson.DisallowUnknownFields)
+	if err != nil {
+		return err
+	}
+	strictErrors = append(strictErrors, fieldErrors...)
+	if len(strictErrors) == 0 {
+		return nil
+	}
+
+	switch fieldValidation {
+	case fieldValidationStrict:
+		messages := make([]string, len(strictErrors))
+		for i, strictErr := range strictErrors {
+			messages[i] = strictErr.Error()
+		}
+		return fmt.Errorf("strict decoding error: %s", strings.Join(messages, ", "))
+	case fieldValidationWarn:
+		for _, strictErr := range strictErrors {
+			addWarning(w, strictErr.Error())
+		}
+	}
+	return nil
+}
+
+// addWarning adds a Warning header, which kubectl prints to the user
+func addWarning(w http.ResponseWriter, message string) {
+	w.Header().Add("Warning", fmt.Sprintf("299 - %q", message))
+}
+
+// writeDecodeError reports a request body that could not be decoded: 415 for an
+// unsupported Content-Type, 400 otherwise
+func (s *Server) writeDecodeError(w http.ResponseWriter, kind string, err error) {
+	if errors.Is(err, errUnsupportedMediaType) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Failed to decode %s: %v", kind, err), http.StatusBadRequest)
+}
@@ -0,0 +1,404 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// apiGroupVersion is a served group version with its resources. Both the legacy
+// per-group endpoints and the aggregated discovery documents are built from it, with the
+// verbs of each resource taken from its registered routes (see Server.served).
+type apiGroupVersion struct {
+	Group     string
+	Version   string
+	Resources []metav1.APIResource
+}
+
+// GroupVersion returns the group version as written in apiVersion fields
+func (gv apiGroupVersion) GroupVersion() string {
+	if gv.Group == "" {
+		return gv.Version
+	}
+	return gv.Group + "/" + gv.Version
+}
+
+// coreV1 lists the resources served under /api/v1
+var coreV1 = apiGroupVersion{
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "namespaces",
+			SingularName: "namespace",
+			Namespaced:   false,
+			Kind:         "Namespace",
+			ShortNames:   []string{"ns"},
+		},
+		{
+			Name:         "nodes",
+			SingularName: "node",
+			Namespaced:   false,
+			Kind:         "Node",
+			ShortNames:   []string{"no"},
+		},
+		{
+			Name:         "pods",
+			SingularName: "pod",
+			Namespaced:   true,
+			Kind:         "Pod",
+			Categories:   []string{"all"},
+		},
+		{
+			Name:         "pods/binding",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "Binding",
+		},
+		{
+			Name:         "pods/checkpoint",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "Pod",
+		},
+		{
+			Name:         "pods/exec",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "PodExecOptions",
+		},
+		{
+			Name:         "pods/pause",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "Pod",
+		},
+		{
+			Name:         "pods/proxy",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "PodProxyOptions",
+		},
+		{
+			Name:         "pods/restore",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "Pod",
+		},
+		{
+			Name:         "pods/unpause",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "Pod",
+		},
+		{
+			Name:         "pods/log",
+			SingularName: "",
+			Namespaced:   true,
+			Kind:         "PodLogOptions",
+		},
+		{
+			Name:         "secrets",
+			SingularName: "secret",
+			Namespaced:   true,
+			Kind:         "Secret",
+		},
+		{
+			Name:         "services",
+			SingularName: "service",
+			Namespaced:   true,
+			Kind:         "Service",
+			ShortNames:   []string{"svc"},
+		},
+		{
+			Name:       "services/proxy",
+			Namespaced: true,
+			Kind:       "ServiceProxyOptions",
+		},
+		{
+			Name:       "serviceaccounts/token",
+			Namespaced: true,
+			Group:      "authentication.k8s.io",
+			Version:    "v1",
+			Kind:       "TokenRequest",
+		},
+	},
+}
+
+// projectV1 lists the resources served under /apis/project.openshift.io/v1
+var projectV1 = apiGroupVersion{
+	Group:   "project.openshift.io",
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "projects",
+			SingularName: "project",
+			Namespaced:   false,
+			Kind:         "Project",
+		},
+		{
+			Name:       "projects/status",
+			Namespaced: false,
+			Kind:       "Project",
+		},
+	},
+}
+
+// podmanV1 lists the resources served under /apis/podman.io/v1
+var podmanV1 = apiGroupVersion{
+	Group:   "podman.io",
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "images",
+			SingularName: "image",
+			Namespaced:   false,
+			Kind:         "Image",
+		},
+		{
+			Name:         "networks",
+			SingularName: "network",
+			Namespaced:   false,
+			Kind:         "Network",
+		},
+	},
+}
+
+// apiGroups are the named groups served under /apis, one version each
+var apiGroups = []apiGroupVersion{projectV1, podmanV1, flowcontrolV1, coordinationV1, routeV1, authorizationV1}
+
+// aggregatedDiscoveryVersions are the apidiscovery.k8s.io versions that can be negotiated.
+// v2beta1 has the same schema as v2 and is still requested by kubectl 1.26 to 1.29.
+var aggregatedDiscoveryVersions = []string{"v2", "v2beta1"}
+
+// handleAPIDiscovery returns core API group information
+func (s *Server) handleAPIDiscovery(w http.ResponseWriter, r *http.Request) {
+	if version, ok := negotiateAggregatedDiscovery(r); ok {
+		s.writeAggregatedDiscovery(w, version, []apiGroupVersion{s.served(coreV1)})
+		return
+	}
+
+	apiVersions := &metav1.APIVersions{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIVersions",
+			APIVersion: "v1",
+		},
+		Versions: []string{coreV1.Version},
+		ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
+			{
+				ClientCIDR:    "0.0.0.0/0",
+				ServerAddress: fmt.Sprintf("%s:%d", s.host, s.port),
+			},
+		},
+	}
+
+	w.Header().Set("Vary", "Accept")
+	s.writeJSON(w, apiVersions)
+}
+
+// handleAPIsDiscovery returns available API groups (empty for core API only)
+func (s *Server) handleAPIsDiscovery(w http.ResponseWriter, r *http.Request) {
+	if version, ok := negotiateAggregatedDiscovery(r); ok {
+		s.writeAggregatedDiscovery(w, version, s.servedGroups())
+		return
+	}
+
+	apiGroupList := &metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIGroupList",
+			APIVersion: "v1",
+		},
+	}
+	for _, gv := range apiGroups {
+		apiGroupList.Groups = append(apiGroupList.Groups, gv.apiGroup())
+	}
+
+	w.Header().Set("Vary", "Accept")
+	s.writeJSON(w, apiGroupList)
+}
+
+// handleAPIV1Discovery returns resources available in the v1 API
+func (s *Server) handleAPIV1Discovery(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.served(coreV1).resourceList())
+}
+
+// handleProjectAPIDiscovery returns resources available in the project.openshift.io/v1 API
+func (s *Server) handleProjectAPIDiscovery(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.served(projectV1).resourceList())
+}
+
+// handlePodmanAPIDiscovery returns resources available in the podman.io/v1 API
+func (s *Server) handlePodmanAPIDiscovery(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, s.served(podmanV1).resourceList())
+}
+
+// served returns the group version with the verbs the routes of each resource serve, as
+// registered on the router: collection routes give list, watch, create and deletecollection,
+// object routes get, update, patch and delete, and the routes of a subresource its verbs.
+// Resources without any route are left out, so that clients never attempt a verb that is
+// not served nor miss one that is.
+func (s *Server) served(gv apiGroupVersion) apiGroupVersion {
+	prefix := "/api/" + gv.Version
+	if gv.Group != "" {
+		prefix = "/apis/" + gv.Group + "/" + gv.Version
+	}
+
+	served := apiGroupVersion{Group: gv.Group, Version: gv.Version}
+	for _, resource := range gv.Resources {
+		name, subresource, isSubresource := strings.Cut(resource.Name, "/")
+		collection := prefix + "/" + name
+		if resource.Namespaced {
+			collection = prefix + "/namespaces/{namespace}/" + name
+		}
+		object := collection + "/{name}"
+		if isSubresource {
+			collection, object = "", object+"/"+subresource
+		}
+
+		resource.Verbs = s.router.verbs(collection, object)
+		if len(resource.Verbs) > 0 {
+			served.Resources = append(served.Resources, resource)
+		}
+	}
+	return served
+}
+
+// servedGroups returns the named groups with the verbs their routes serve
+func (s *Server) servedGroups() []apiGroupVersion {
+	groups := make([]apiGroupVersion, 0, len(apiGroups))
+	for _, gv := range apiGroups {
+		groups = append(groups, s.served(gv))
+	}
+	return groups
+}
+
+// resourceList returns the legacy discovery document of the group version
+func (gv apiGroupVersion) resourceList() *metav1.APIResourceList {
+	return &metav1.APIResourceList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIResourceList",
+			APIVersion: "v1",
+		},
+		GroupVersion: gv.GroupVersion(),
+		APIResources: gv.Resources,
+	}
+}
+
+// apiGroup returns the APIGroup of the group version, its only and preferred version, as
+// listed under /apis and served at /apis/{group}
+func (gv apiGroupVersion) apiGroup() metav1.APIGroup {
+	version := metav1.GroupVersionForDiscovery{
+		GroupVersion: gv.GroupVersion(),
+		Version:      gv.Version,
+	}
+	return metav1.APIGroup{
+		Name:             gv.Group,
+		Versions:         []metav1.GroupVersionForDiscovery{version},
+		PreferredVersion: version,
+	}
+}
+
+// discovery returns the aggregated discovery document of the group version, with
+// subresources (pods/exec) nested under their parent resource
+func (gv apiGroupVersion) discovery() apidiscoveryv2.APIGroupDiscovery {
+	var resources []apidiscoveryv2.APIResourceDiscovery
+	for _, resource := range gv.Resources {
+		responseKind := &metav1.GroupVersionKind{
+			Group:   gv.Group,
+			Version: gv.Version,
+			Kind:    resource.Kind,
+		}
+
+		if parent, subresource, ok := strings.Cut(resource.Name, "/"); ok {
+			for i := range resources {
+				if resources[i].Resource == parent {
+					resources[i].Subresources = append(resources[i].Subresources, apidiscoveryv2.APISubresourceDiscovery{
+						Subresource:  subresource,
+						ResponseKind: responseKind,
+						Verbs:        resource.Verbs,
+					})
+				}
+			}
+			continue
+		}
+
+		scope := apidiscoveryv2.ScopeCluster
+		if resource.Namespaced {
+			scope = apidiscoveryv2.ScopeNamespace
+		}
+		resources = append(resources, apidiscoveryv2.APIResourceDiscovery{
+			Resource:         resource.Name,
+			ResponseKind:     responseKind,
+			Scope:            scope,
+			SingularResource: resource.SingularName,
+			Verbs:            resource.Verbs,
+			ShortNames:       resource.ShortNames,
+			Categories:       resource.Categories,
+		})
+	}
+
+	return apidiscoveryv2.APIGroupDiscovery{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: gv.Group,
+		},
+		Versions: []apidiscoveryv2.APIVersionDiscovery{
+			{
+				Version:   gv.Version,
+				Resources: resources,
+				Freshness: apidiscoveryv2.DiscoveryFreshnessCurrent,
+			},
+		},
+	}
+}
+
+// negotiateAggregatedDiscovery returns the apidiscovery.k8s.io version requested by the
+// Accept header, if the client asked for an APIGroupDiscoveryList. Media types are
+// considered in the order the client listed them.
+func negotiateAggregatedDiscovery(r *http.Request) (string, bool) {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if params["g"] != "apidiscovery.k8s.io" || params["as"] != "APIGroupDiscoveryList" {
+			// Legacy discovery preferred over aggregated discovery
+			return "", false
+		}
+		if mediaType != "application/json" {
+			// Aggregated discovery is only served as JSON, not protobuf
+			continue
+		}
+		for _, version := range aggregatedDiscoveryVersions {
+			if params["v"] == version {
+				return version, true
+			}
+		}
+	}
+	return "", false
+}
+
+// writeAggregatedDiscovery writes an APIGroupDiscoveryList of the given groups
+func (s *Server) writeAggregatedDiscovery(w http.ResponseWriter, version string, groups []apiGroupVersion) {
+	groupList := &apidiscoveryv2.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIGroupDiscoveryList",
+			APIVersion: "apidiscovery.k8s.io/" + version,
+		},
+	}
+	for _, gv := range groups {
+		groupList.Items = append(groupList.Items, gv.discovery())
+	}
+
+	w.Header().Set("Content-Type", "application/json;g=apidiscovery.k8s.io;v="+version+";as=APIGroupDiscoveryList")
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(groupList); err != nil {
+		klog.Errorf("Failed to encode aggregated discovery response: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// notModified sets the ETag of the response to a GET request and, when the request lists it
+// in If-None-Match, answers 304 Not Modified and reports true so the body is not written.
+//
+// The ETag is a digest of the encoded body rather than of the resourceVersion alone: the
+// resourceVersion of a pod is that of its container, which stays the same while the status of
+// the pod changes, and the body differs between media types and tables anyway.
+func notModified(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	hash := fnv.New64a()
+	hash.Write(body)
+	etag := fmt.Sprintf(`"%x"`, hash.Sum64())
+	w.Header().Set("ETag", etag)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
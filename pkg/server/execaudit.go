@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+)
+
+// execRecording records an exec session for compliance: who ran which command in which
+// container, logged when the session starts and ends, and, when transcripts are enabled, its
+// transcript. A transcript is a file of JSON lines: a header object describing the session,
+// then one [seconds since the start, stream, data] event per read or write of a stream, the
+// streams being "i" (stdin), "o" (stdout) and "e" (stderr), like the asciicast format.
+type execRecording struct {
+	session execSession
+	id      string // ID of the exec request
+	started time.Time
+
+	mu         sync.Mutex
+	transcript *os.File
+	path       string
+	exitCode   int
+	exitErr    error
+	exited     bool
+}
+
+// execTranscriptHeader is the first line of a transcript
+type execTranscriptHeader struct {
+	Version   int       `json:"version"`
+	RequestID string    `json:"requestID"`
+	User      string    `json:"user"`
+	SourceIPs []string  `json:"sourceIPs"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+	Command   []string  `json:"command"`
+	TTY       bool      `json:"tty"`
+	Started   time.Time `json:"started"`
+}
+
+type execRecordingKey struct{}
+
+// execRecordingFrom returns the recording of the exec session of a context, nil if none
+func execRecordingFrom(ctx context.Context) *execRecording {
+	recording, _ := ctx.Value(execRecordingKey{}).(*execRecording)
+	return recording
+}
+
+// SetExecTranscriptDir enables the transcripts of exec sessions, written to dir, or disables
+// them when dir is empty
+func (s *Server) SetExecTranscriptDir(dir string) error {
+	if dir != "" {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("exec transcript directory %q must be an absolute path", dir)
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create exec transcript directory: %v", err)
+		}
+	}
+	s.execTranscriptDir.Store(&dir)
+	return nil
+}
+
+// beginExecRecording logs the start of an exec session and opens its transcript when they are
+// enabled, returning the request with the recording in its context. The session is refused
+// when its transcript cannot be written, so that no session goes unrecorded.
+func (s *Server) beginExecRecording(r *http.Request, session execSession) (*http.Request, *execRecording, error) {
+	recording := &execRecording{session: session, id: requestID(r.Context()), started: time.Now()}
+	if recording.id == "" {
+		recording.id = string(uuid.NewUUID())
+	}
+	sourceIPs := sourceIPs(r)
+
+	if dir := s.execTranscriptDir.Load(); dir != nil && *dir != "" {
+		name := fmt.Sprintf("%s_%s_%s_%s.log", session.Namespace, session.Pod,
+			recording.started.UTC().Format("20060102T150405Z"), fileNameSafe(recording.id))
+		recording.path = filepath.Join(*dir, name)
+		f, err := os.OpenFile(recording.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return r, nil, fmt.Errorf("failed to create exec transcript: %v", err)
+		}
+		header, _ := json.Marshal(execTranscriptHeader{
+			Version:   1,
+			RequestID: recording.id,
+			User:      session.User,
+			SourceIPs: sourceIPs,
+			Namespace: session.Namespace,
+			Pod:       session.Pod,
+			Container: session.Container,
+			Command:   session.Command,
+			TTY:       session.TTY,
+			Started:   recording.started,
+		})
+		if _, err := f.Write(append(header, '\n')); err != nil {
+			f.Close()
+			return r, nil, fmt.Errorf("failed to write exec transcript: %v", err)
+		}
+		recording.transcript = f
+	}
+
+	klog.InfoS("Exec session started", "requestID", recording.id, "user", session.User, "sourceIPs", sourceIPs,
+		"namespace", session.Namespace, "pod", session.Pod, "container", session.Container,
+		"command", session.Command, "tty", session.TTY, "transcript", recording.path)
+	return r.WithContext(context.WithValue(r.Context(), execRecordingKey{}, recording)), recording, nil
+}
+
+// fileNameSafe keeps the characters of a request ID that are safe in file names
+func fileNameSafe(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return -1
+	}, id)
+}
+
+// record appends an event of a stream to the transcript
+func (rec *execRecording) record(stream string, data []byte) {
+	if rec == nil || len(data) == 0 {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.transcript == nil {
+		return
+	}
+	event, _ := json.Marshal([]interface{}{time.Since(rec.started).Seconds(), stream, string(data)})
+	if _, err := rec.transcript.Write(append(event, '\n')); err != nil {
+		klog.Errorf("Failed to write exec transcript %s: %v", rec.path, err)
+	}
+}
+
+// setResult records how the command of the session ended
+func (rec *execRecording) setResult(err error) {
+	if rec == nil {
+		return
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.exited = true
+	rec.exitErr = err
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ProcessState != nil {
+		rec.exitCode = exitErr.ExitCode()
+		rec.exitErr = nil
+	}
+}
+
+// end logs the end of the session and closes its transcript
+func (rec *execRecording) end() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	keysAndValues := []interface{}{"requestID", rec.id, "user", rec.session.User, "namespace", rec.session.Namespace,
+		"pod", rec.session.Pod, "container", rec.session.Container, "duration", time.Since(rec.started)}
+	switch {
+	case rec.exitErr != nil:
+		keysAndValues = append(keysAndValues, "err", rec.exitErr.Error())
+	case rec.exited:
+		keysAndValues = append(keysAndValues, "exitCode", rec.exitCode)
+	}
+	klog.InfoS("Exec session ended", keysAndValues...)
+
+	if rec.transcript != nil {
+		if err := rec.transcript.Close(); err != nil {
+			klog.Errorf("Failed to close exec transcript %s: %v", rec.path, err)
+		}
+		rec.transcript = nil
+	}
+}
+
+// recorded reports whether the session has a transcript
+func (rec *execRecording) recorded() bool {
+	return rec != nil && rec.path != ""
+}
+
+// wrap returns streams recording what goes through them in the transcript, if the session has
+// one; absent streams stay nil
+func (rec *execRecording) wrap(stdin io.ReadCloser, stdout, stderr io.WriteCloser) (io.ReadCloser, io.WriteCloser, io.WriteCloser) {
+	if !rec.recorded() {
+		return stdin, stdout, stderr
+	}
+	if stdin != nil {
+		stdin = rec.reader(stdin)
+	}
+	if stdout != nil {
+		stdout = &recordedWriter{Writer: stdout, recording: rec, stream: "o"}
+	}
+	if stderr != nil {
+		stderr = &recordedWriter{Writer: stderr, recording: rec, stream: "e"}
+	}
+	return stdin, stdout, stderr
+}
+
+// reader returns stdin recording what is read in the transcript, if the session has one
+func (rec *execRecording) reader(stdin io.ReadCloser) io.ReadCloser {
+	if !rec.recorded() {
+		return stdin
+	}
+	return &recordedReader{ReadCloser: stdin, recording: rec}
+}
+
+// writer returns an output stream recording what is written in the transcript, as stream "o"
+// or "e", if the session has one
+func (rec *execRecording) writer(stream string, w io.Writer) io.Writer {
+	if !rec.recorded() {
+		return w
+	}
+	return &recordedWriter{Writer: w, recording: rec, stream: stream}
+}
+
+// recordedReader records the stdin of a session in its transcript
+type recordedReader struct {
+	io.ReadCloser
+	recording *execRecording
+}
+
+func (r *recordedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.recording.record("i", p[:n])
+	return n, err
+}
+
+// recordedWriter records an output stream of a session in its transcript
+type recordedWriter struct {
+	io.Writer
+	recording *execRecording
+	stream    string
+}
+
+func (w *recordedWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.recording.record(w.stream, p[:n])
+	return n, err
+}
+
+// Close closes the underlying stream, if it can be closed
+func (w *recordedWriter) Close() error {
+	if closer, ok := w.Writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
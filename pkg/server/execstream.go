@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// Framed exec streams exec sessions over a single HTTP request, for clients behind proxies
+// and load balancers that strip the Upgrade header SPDY and WebSocket exec rely on. The client
+// asks for it with the X-Podkube-Exec-Stream header; its request body then carries its stdin
+// and resize events and the response body, sent while the request body is still being read,
+// carries stdout, stderr and the final Status of the session. This needs HTTP/2, or HTTP/1.1
+// clients that keep writing their request after the response has started.
+//
+// Both bodies are sequences of frames: a channel byte, the payload length as a big-endian
+// uint32, and the payload. Channels are those of the websocket exec protocols: 0 stdin,
+// 1 stdout, 2 stderr, 3 the v4 Status JSON of the session, 4 resize events as
+// {"width":80,"height":24}. An empty stdin frame closes stdin.
+const (
+	execStreamHeader      = "X-Podkube-Exec-Stream"
+	execStreamFramed      = "framed"
+	execStreamContentType = "application/vnd.podkube.exec-stream"
+)
+
+// maxExecFrameSize bounds the payload of the frames a client sends
+const maxExecFrameSize = 1 << 20
+
+// isFramedExecRequest reports whether an exec request asks for a framed exec stream
+func isFramedExecRequest(r *http.Request) bool {
+	return r.Header.Get(execStreamHeader) == execStreamFramed
+}
+
+// handleFramedExec runs an exec session over a framed exec stream
+func (s *Server) handleFramedExec(w http.ResponseWriter, r *http.Request, args []string, stdin, stdout, stderr, tty bool) {
+	// HTTP/2 streams are full duplex already, HTTP/1.1 connections need to be told
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil && r.ProtoMajor < 2 {
+		klog.V(4).Infof("Full duplex not enabled for framed exec over %s: %v", r.Proto, err)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", execStreamContentType)
+	w.Header().Set(execStreamHeader, execStreamFramed)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	klog.Infof("Framed exec session starting over %s tty=%v", r.Proto, tty)
+
+	output := &execFrameWriter{w: w, flusher: flusher}
+	var stdoutStream, stderrStream io.WriteCloser
+	if stdout {
+		stdoutStream = output.channel(wsStdoutChannel)
+	}
+	if stderr {
+		stderrStream = output.channel(wsStderrChannel)
+	}
+
+	// Demultiplex the request body into stdin and resize events
+	stdinReader, stdinWriter := io.Pipe()
+	var resizeChan chan TerminalSize
+	if tty {
+		resizeChan = make(chan TerminalSize, 1)
+	}
+	go readExecFrames(r, stdinWriter, resizeChan)
+
+	var stdinStream io.ReadCloser
+	if stdin {
+		stdinStream = stdinReader
+	}
+	err := s.execInContainer(r.Context(), args, stdinStream, stdoutStream, stderrStream, tty, resizeChan, initialTerminalSize(r))
+	stdinReader.Close()
+
+	status, _ := json.Marshal(execResultStatus(err).Status())
+	output.writeFrame(wsErrorChannel, status)
+	klog.Infof("Framed exec session completed")
+}
+
+// readExecFrames reads the frames of the request body of a framed exec session, until its end
+// or the end of the session
+func readExecFrames(r *http.Request, stdin *io.PipeWriter, resizeChan chan<- TerminalSize) {
+	defer stdin.Close()
+	if resizeChan != nil {
+		defer close(resizeChan)
+	}
+
+	body := bufio.NewReader(r.Body)
+	header := make([]byte, 5)
+	for {
+		if _, err := io.ReadFull(body, header); err != nil {
+			if !errors.Is(err, io.EOF) {
+				klog.V(4).Infof("Framed exec request stream ended: %v", err)
+			}
+			return
+		}
+		length := binary.BigEndian.Uint32(header[1:])
+		if length > maxExecFrameSize {
+			stdin.CloseWithError(fmt.Errorf("exec frame of %d bytes exceeds the maximum of %d", length, maxExecFrameSize))
+			return
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(body, payload); err != nil {
+			klog.V(4).Infof("Truncated framed exec request frame: %v", err)
+			return
+		}
+
+		switch header[0] {
+		case wsStdinChannel:
+			if length == 0 {
+				stdin.Close()
+				continue
+			}
+			if _, err := stdin.Write(payload); err != nil {
+				// The command is done with stdin; keep reading resize events until the end
+				continue
+			}
+		case wsResizeChannel:
+			var size TerminalSize
+			if err := json.Unmarshal(payload, &size); err != nil {
+				klog.V(4).Infof("Invalid framed exec resize event %q: %v", payload, err)
+				continue
+			}
+			if resizeChan != nil {
+				select {
+				case resizeChan <- size:
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			klog.V(4).Infof("Ignoring framed exec frame on channel %d", header[0])
+		}
+	}
+}
+
+// execFrameWriter writes the frames of the response of a framed exec session, flushing each
+// of them; frames of stdout and stderr are written whole, one at a time
+type execFrameWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (fw *execFrameWriter) writeFrame(channel byte, payload []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	header := make([]byte, 5)
+	header[0] = channel
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := fw.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := fw.w.Write(payload); err != nil {
+		return err
+	}
+	fw.flusher.Flush()
+	return nil
+}
+
+// channel returns a stream writing frames on a channel
+func (fw *execFrameWriter) channel(channel byte) io.WriteCloser {
+	return &execFrameChannel{writer: fw, channel: channel}
+}
+
+// execFrameChannel is a stream of a framed exec session
+type execFrameChannel struct {
+	writer  *execFrameWriter
+	channel byte
+}
+
+func (c *execFrameChannel) Write(data []byte) (int, error) {
+	if err := c.writer.writeFrame(c.channel, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (c *execFrameChannel) Close() error {
+	return nil
+}
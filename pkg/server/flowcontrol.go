@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	flowcontrolv1 "k8s.io/api/flowcontrol/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// flowcontrolGroup is the API priority and fairness group. podKube has no priority levels,
+// every request is served as it comes, but clients such as kubectl and client-go discover
+// and list the group, and log errors and retry when it is missing.
+const flowcontrolGroup = "flowcontrol.apiserver.k8s.io"
+
+// flowcontrolV1 lists the resources served under /apis/flowcontrol.apiserver.k8s.io/v1
+var flowcontrolV1 = apiGroupVersion{
+	Group:   flowcontrolGroup,
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "flowschemas",
+			SingularName: "flowschema",
+			Namespaced:   false,
+			Kind:         "FlowSchema",
+		},
+		{
+			Name:         "prioritylevelconfigurations",
+			SingularName: "prioritylevelconfiguration",
+			Namespaced:   false,
+			Kind:         "PriorityLevelConfiguration",
+		},
+	},
+}
+
+// flowSchemaREST serves an empty list of flow schemas
+type flowSchemaREST struct{}
+
+func (fr *flowSchemaREST) New() runtime.Object {
+	return &flowcontrolv1.FlowSchema{}
+}
+
+func (fr *flowSchemaREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: flowcontrolGroup, Resource: "flowschemas"}, name)
+}
+
+func (fr *flowSchemaREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	return &flowcontrolv1.FlowSchemaList{
+		TypeMeta: metav1.TypeMeta{Kind: "FlowSchemaList", APIVersion: flowcontrolV1.GroupVersion()},
+		Items:    []flowcontrolv1.FlowSchema{},
+	}, nil
+}
+
+// priorityLevelREST serves an empty list of priority level configurations
+type priorityLevelREST struct{}
+
+func (pr *priorityLevelREST) New() runtime.Object {
+	return &flowcontrolv1.PriorityLevelConfiguration{}
+}
+
+func (pr *priorityLevelREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	return nil, apierrors.NewNotFound(schema.GroupResource{Group: flowcontrolGroup, Resource: "prioritylevelconfigurations"}, name)
+}
+
+func (pr *priorityLevelREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	return &flowcontrolv1.PriorityLevelConfigurationList{
+		TypeMeta: metav1.TypeMeta{Kind: "PriorityLevelConfigurationList", APIVersion: flowcontrolV1.GroupVersion()},
+		Items:    []flowcontrolv1.PriorityLevelConfiguration{},
+	}, nil
+}
+
+// registerFlowcontrol routes the flowcontrol.apiserver.k8s.io group and v1 discovery documents
+// and resources. The beta versions older clients ask for, and any other path of the group, get a
+// NotFound Status instead of the plain text 404 of the mux, which clients retry on.
+func (s *Server) registerFlowcontrol(rt *router) {
+	rt.handle("/apis/"+flowcontrolGroup, func(w http.ResponseWriter, r *http.Request) {
+		group := flowcontrolV1.apiGroup()
+		group.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+		s.writeJSON(w, &group)
+	}, http.MethodGet)
+	prefix := "/apis/" + flowcontrolGroup + "/" + flowcontrolV1.Version
+	rt.handle(prefix, func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.served(flowcontrolV1).resourceList())
+	}, http.MethodGet)
+	s.registerREST(rt, prefix, restResource{
+		Resource: schema.GroupResource{Group: flowcontrolGroup, Resource: "flowschemas"},
+		Kind:     "FlowSchema",
+		Storage:  &flowSchemaREST{},
+	})
+	s.registerREST(rt, prefix, restResource{
+		Resource: schema.GroupResource{Group: flowcontrolGroup, Resource: "prioritylevelconfigurations"},
+		Kind:     "PriorityLevelConfiguration",
+		Storage:  &priorityLevelREST{},
+	})
+
+	rt.handle("/apis/"+flowcontrolGroup+"/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		s.writeStatusError(w, &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusNotFound,
+			Reason:  metav1.StatusReasonNotFound,
+			Message: fmt.Sprintf("the server could not find the requested resource (get %s)", r.URL.Path),
+		}})
+	}, http.MethodGet)
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// readyzCheckTimeout bounds how long a readiness probe may wait on podman
+const readyzCheckTimeout = 5 * time.Second
+
+// healthCheck is a named readiness check, reported like kube-apiserver's /readyz checks
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readyzChecks returns the checks run by /readyz
+func (s *Server) readyzChecks() []healthCheck {
+	return []healthCheck{
+		{
+			name:  "ping",
+			check: func(ctx context.Context) error { return nil },
+		},
+		{
+			name: "shutdown",
+			check: func(ctx context.Context) error {
+				if s.isShuttingDown() {
+					return fmt.Errorf("server is shutting down")
+				}
+				return nil
+			},
+		},
+		{
+			name: "podman",
+			check: func(ctx context.Context) error {
+				_, err := s.podStorage.Ping(ctx)
+				return err
+			},
+		},
+		{
+			name: "podman-circuit-breaker",
+			check: func(ctx context.Context) error {
+				if healthy, err := s.podStorage.BackendStatus(); !healthy {
+					return err
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// handleReadyz reports whether the server can serve requests, i.e. whether podman is reachable.
+// Like kube-apiserver it supports ?verbose, ?exclude=<check> and /readyz/<check>.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	_, verbose := query["verbose"]
+	excluded := make(map[string]bool)
+	for _, name := range query["exclude"] {
+		excluded[name] = true
+	}
+
+	checks := s.readyzChecks()
+
+	// /readyz/<check> runs a single check
+	if name := strings.TrimPrefix(r.URL.Path, "/readyz/"); name != r.URL.Path && name != "" {
+		var selected []healthCheck
+		for _, check := range checks {
+			if check.name == name {
+				selected = append(selected, check)
+			}
+		}
+		if len(selected) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		checks = selected
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyzCheckTimeout)
+	defer cancel()
+
+	var report bytes.Buffer
+	var failed []string
+	for _, check := range checks {
+		if excluded[check.name] {
+			fmt.Fprintf(&report, "[+]%s excluded: ok\n", check.name)
+			continue
+		}
+		if err := check.check(ctx); err != nil {
+			klog.V(2).Infof("readyz check %s failed: %v", check.name, err)
+			fmt.Fprintf(&report, "[-]%s failed: %v\n", check.name, err)
+			failed = append(failed, check.name)
+			continue
+		}
+		fmt.Fprintf(&report, "[+]%s ok\n", check.name)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if len(failed) > 0 {
+		// Failures always get the breakdown, as kube-apiserver does
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write(report.Bytes())
+		fmt.Fprintf(w, "readyz check failed\n")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if verbose {
+		w.Write(report.Bytes())
+		fmt.Fprintf(w, "readyz check passed\n")
+		return
+	}
+	w.Write([]byte("ok"))
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// imageResource names images in API errors
+var imageResource = schema.GroupResource{Group: "podman.io", Resource: "images"}
+
+// listImages lists the images of every node
+func (s *Server) listImages(w http.ResponseWriter, r *http.Request) {
+	imageList, err := s.podStorage.ListImages(r.Context())
+	if err != nil {
+		s.writeImageError(w, "", err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, imageListToTable(imageList))
+	} else {
+		s.writeObject(w, r, imageList)
+	}
+}
+
+// getImage returns an image by name
+func (s *Server) getImage(w http.ResponseWriter, r *http.Request, name string) {
+	image, err := s.podStorage.GetImage(r.Context(), name)
+	if err != nil {
+		s.writeImageError(w, name, err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, imageListToTable(&storage.ImageList{Items: []storage.Image{*image}}))
+	} else {
+		s.writeObject(w, r, image)
+	}
+}
+
+// pullImage creates an image by pulling spec.image on every node
+func (s *Server) pullImage(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	var image storage.Image
+	if err := decodeBody(w, r, &image); err != nil {
+		s.writeDecodeError(w, "image", err)
+		return
+	}
+	if image.Spec.Image == "" {
+		s.writeStatusError(w, apierrors.NewInvalid(schema.GroupKind{Group: imageResource.Group, Kind: "Image"}, image.Name,
+			field.ErrorList{field.Required(field.NewPath("spec", "image"), "the image to pull")}))
+		return
+	}
+
+	// The image is named after its ID, which is only known once pulled
+	if dryRun {
+		image.TypeMeta = metav1.TypeMeta{Kind: "Image", APIVersion: storage.PodmanAPIVersion}
+		s.writeObjectWithStatus(w, r, http.StatusCreated, &image)
+		return
+	}
+
+	pulled, err := s.podStorage.PullImage(r.Context(), image.Spec.Image)
+	if err != nil {
+		s.writeImageError(w, image.Spec.Image, err)
+		return
+	}
+	s.writeObjectWithStatus(w, r, http.StatusCreated, pulled)
+}
+
+// deleteImage removes an image from every node
+func (s *Server) deleteImage(w http.ResponseWriter, r *http.Request, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	if dryRun {
+		_, err = s.podStorage.GetImage(r.Context(), name)
+	} else {
+		err = s.podStorage.DeleteImage(r.Context(), name)
+	}
+	if err != nil {
+		s.writeImageError(w, name, err)
+		return
+	}
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusSuccess,
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf(`image "%s" deleted`, name),
+	}
+	s.writeObject(w, r, status)
+}
+
+// writeImageError reports an image storage error as a Kubernetes Status
+func (s *Server) writeImageError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	case errors.Is(err, storage.ErrImageInUse):
+		s.writeStatusError(w, apierrors.NewConflict(imageResource, name, err))
+	case strings.Contains(err.Error(), "not found"):
+		s.writeStatusError(w, apierrors.NewNotFound(imageResource, name))
+	default:
+		klog.Errorf("Image request failed: %v", err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+	}
+}
+
+// imageListToTable converts an ImageList to the table format used by kubectl get images
+func imageListToTable(imageList *storage.ImageList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Abbreviated image ID"},
+			{Name: "Repository", Type: "string", Description: "Repository of the image"},
+			{Name: "Tag", Type: "string", Description: "Tag of the image"},
+			{Name: "Size", Type: "string", Description: "Size of the image"},
+			{Name: "Age", Type: "string", Description: "Time since the image was created"},
+			{Name: "Nodes", Type: "string", Description: "Nodes whose image store has the image", Priority: 1},
+		},
+	}
+
+	for _, image := range imageList.Items {
+		repository, tag := "<none>", "<none>"
+		if len(image.Status.RepoTags) > 0 {
+			reference := image.Status.RepoTags[0]
+			repository = reference
+			// The tag follows the last colon, unless it is part of a registry host:port
+			if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+				repository, tag = reference[:i], reference[i+1:]
+			}
+		}
+
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				image.Name,
+				repository,
+				tag,
+				formatImageSize(image.Status.Size),
+				translateTimestampSince(image.CreationTimestamp),
+				strings.Join(image.Status.Nodes, ","),
+			},
+			Object: runtime.RawExtension{
+				Object: image.DeepCopy(),
+			},
+		})
+	}
+
+	return table
+}
+
+// formatImageSize formats a size in bytes with decimal units, as podman images does
+func formatImageSize(size int64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1000 && unit < len(units)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.3g %s", value, units[unit])
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// coordinationGroup serves the leases of the nodes, which controllers and monitoring tools
+// watch to tell whether nodes are healthy rather than the heartbeats of their conditions
+const coordinationGroup = "coordination.k8s.io"
+
+// leaseResource names leases in API errors
+var leaseResource = schema.GroupResource{Group: coordinationGroup, Resource: "leases"}
+
+// coordinationV1 lists the resources served under /apis/coordination.k8s.io/v1
+var coordinationV1 = apiGroupVersion{
+	Group:   coordinationGroup,
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "leases",
+			SingularName: "lease",
+			Namespaced:   true,
+			Kind:         "Lease",
+		},
+	},
+}
+
+// leaseREST serves the node leases renewed by the cluster
+type leaseREST struct {
+	server *Server
+}
+
+func (lr *leaseREST) New() runtime.Object {
+	return &coordinationv1.Lease{}
+}
+
+func (lr *leaseREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	lease, err := lr.server.podStorage.GetLease(namespace, name)
+	if err != nil {
+		return nil, apierrors.NewNotFound(leaseResource, name)
+	}
+	return lease, nil
+}
+
+func (lr *leaseREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	return lr.server.podStorage.ListLeases(namespace), nil
+}
+
+func (lr *leaseREST) ConvertToTable(obj runtime.Object) *metav1.Table {
+	if lease, ok := obj.(*coordinationv1.Lease); ok {
+		return leaseListToTable(&coordinationv1.LeaseList{Items: []coordinationv1.Lease{*lease}})
+	}
+	return leaseListToTable(obj.(*coordinationv1.LeaseList))
+}
+
+// leaseListToTable converts a LeaseList to the table format used by kubectl get leases
+func leaseListToTable(leaseList *coordinationv1.LeaseList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the lease, the name of its node"},
+			{Name: "Holder", Type: "string", Description: "Identity of the holder of the lease"},
+			{Name: "Age", Type: "string", Description: "Time since the lease was created"},
+		},
+	}
+
+	for _, lease := range leaseList.Items {
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				lease.Name,
+				holder,
+				translateTimestampSince(lease.CreationTimestamp),
+			},
+			Object: runtime.RawExtension{
+				Object: lease.DeepCopy(),
+			},
+		})
+	}
+
+	return table
+}
+
+// registerCoordination routes the coordination.k8s.io/v1 discovery document and leases
+func (s *Server) registerCoordination(rt *router) {
+	prefix := "/apis/" + coordinationGroup + "/" + coordinationV1.Version
+	rt.handle(prefix, func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.served(coordinationV1).resourceList())
+	}, http.MethodGet)
+	s.registerREST(rt, prefix, restResource{
+		Resource:   leaseResource,
+		Kind:       "Lease",
+		Namespaced: true,
+		Storage:    &leaseREST{server: s},
+	})
+}
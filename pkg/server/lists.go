@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// listObject is the part of a request body telling a single object from a list of objects
+type listObject struct {
+	Kind     string            `json:"kind"`
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Items    []json.RawMessage `json:"items"`
+}
+
+// isListKind reports whether a kind holds a list of objects: List or a typed list like PodList
+func isListKind(kind string) bool {
+	return strings.HasSuffix(kind, "List")
+}
+
+// createObjects handles a create request on a collection. A single object is created by
+// create; a List, typed list or multi-document YAML body has each of its items created by the
+// handler of its kind, and the outcome of every item is reported in an aggregated Status.
+func (s *Server) createObjects(w http.ResponseWriter, r *http.Request, namespace string, create http.HandlerFunc) {
+	items, isList, err := splitObjects(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if !isList {
+		create(w, r)
+		return
+	}
+
+	var causes []metav1.StatusCause
+	var failures []string
+	failureCode := 0
+	for i, item := range items {
+		itemField := fmt.Sprintf("items[%d]", i)
+		var meta listObject
+		if err := json.Unmarshal(item, &meta); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", itemField, err))
+			causes = append(causes, metav1.StatusCause{Type: metav1.CauseTypeFieldValueInvalid, Field: itemField, Message: err.Error()})
+			if failureCode == 0 {
+				failureCode = http.StatusBadRequest
+			}
+			continue
+		}
+
+		code, message := s.createItem(w, r, namespace, meta, item)
+		if code >= http.StatusBadRequest {
+			failures = append(failures, fmt.Sprintf("%s: %s", itemField, message))
+			causes = append(causes, metav1.StatusCause{Type: metav1.CauseType(http.StatusText(code)), Field: itemField, Message: message})
+			if failureCode == 0 {
+				failureCode = code
+			}
+			continue
+		}
+		causes = append(causes, metav1.StatusCause{Type: "Created", Field: itemField, Message: message})
+	}
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusSuccess,
+		Code:    http.StatusCreated,
+		Message: fmt.Sprintf("created %d objects", len(items)),
+		Details: &metav1.StatusDetails{Causes: causes},
+	}
+	if len(failures) > 0 {
+		status.Status = metav1.StatusFailure
+		status.Code = int32(failureCode)
+		status.Message = fmt.Sprintf("created %d of %d objects: %s", len(items)-len(failures), len(items), strings.Join(failures, "; "))
+	}
+	s.writeObjectWithStatus(w, r, int(status.Code), status)
+}
+
+// createItem creates an item of a list with the create handler of its kind, and returns the
+// response code with a message describing the outcome. Warnings of the item are passed on.
+func (s *Server) createItem(w http.ResponseWriter, r *http.Request, namespace string, meta listObject, item []byte) (int, string) {
+	var create http.HandlerFunc
+	switch meta.Kind {
+	case "Pod":
+		create = func(w http.ResponseWriter, r *http.Request) { s.createPod(w, r, namespace) }
+	case "Image":
+		create = s.pullImage
+	case "Network":
+		create = s.createNetwork
+	default:
+		h, ok := s.restHandlers[meta.Kind]
+		if ok {
+			_, ok = h.resource.Storage.(restCreater)
+		}
+		if !ok {
+			return http.StatusBadRequest, fmt.Sprintf("kind %q cannot be created", meta.Kind)
+		}
+		create = func(w http.ResponseWriter, r *http.Request) { h.create(w, r, namespace) }
+	}
+
+	itemRequest := r.Clone(r.Context())
+	itemRequest.Body = io.NopCloser(bytes.NewReader(item))
+	itemRequest.ContentLength = int64(len(item))
+	itemRequest.Header.Set("Content-Type", mediaTypeJSON)
+	itemRequest.Header.Set("Accept", mediaTypeJSON)
+
+	recorder := httptest.NewRecorder()
+	create(recorder, itemRequest)
+	for _, warning := range recorder.Header().Values("Warning") {
+		w.Header().Add("Warning", warning)
+	}
+
+	body := recorder.Body.Bytes()
+	if recorder.Code >= http.StatusBadRequest {
+		var status metav1.Status
+		if err := json.Unmarshal(body, &status); err == nil && status.Message != "" {
+			return recorder.Code, status.Message
+		}
+		return recorder.Code, strings.TrimSpace(string(body))
+	}
+
+	var created listObject
+	name := meta.Metadata.Name
+	if err := json.Unmarshal(body, &created); err == nil && created.Metadata.Name != "" {
+		name = created.Metadata.Name
+	}
+	return recorder.Code, fmt.Sprintf("%s/%s created", strings.ToLower(meta.Kind), name)
+}
+
+// splitObjects reads the objects of a create request body: the items of a List or typed list,
+// or the documents of a multi-document YAML body. A body holding a single object is left
+// for the collection's own handler to read, and isList is false.
+func splitObjects(r *http.Request) (items []json.RawMessage, isList bool, err error) {
+	mediaType := mediaTypeJSON
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			// decodeBody reports the invalid Content-Type
+			return nil, false, nil
+		}
+	}
+	isYAML := mediaType == mediaTypeYAML || mediaType == "application/x-yaml" || mediaType == "text/yaml"
+	if mediaType != mediaTypeJSON && !isYAML {
+		return nil, false, nil
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read request body: %v", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	documents := []json.RawMessage{data}
+	if isYAML {
+		documents = nil
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+		for {
+			document, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to split YAML documents: %v", err)
+			}
+			jsonDocument, err := yaml.YAMLToJSON(document)
+			if err != nil {
+				return nil, false, err
+			}
+			if trimmed := bytes.TrimSpace(jsonDocument); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+				documents = append(documents, jsonDocument)
+			}
+		}
+	}
+
+	for _, document := range documents {
+		var object listObject
+		if err := json.Unmarshal(document, &object); err != nil {
+			// decodeBody reports malformed bodies
+			return nil, false, nil
+		}
+		if isListKind(object.Kind) {
+			items = append(items, object.Items...)
+			isList = true
+		} else {
+			items = append(items, document)
+		}
+	}
+	if len(documents) > 1 {
+		isList = true
+	}
+	return items, isList, nil
+}
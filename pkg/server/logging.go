@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+)
+
+// requestIDHeader carries the ID of a request, set by the client or generated, and returned
+// with the response so that client and server logs can be matched
+const requestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// requestID returns the ID of the request of a context, empty outside of requests
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withRequestLog wraps handler so that every request gets an ID, in its context and in the
+// X-Request-Id response header, is counted for its client, and is logged at level 2 once
+// served, with its ID, client, verb, resource, namespace, status and latency as structured
+// fields. Watches are tracked while they are open.
+func (s *Server) withRequestLog(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength || !isPrintableASCII(id) {
+			id = string(uuid.NewUUID())
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		info := parseRequestInfo(r)
+		client := clientName(r.UserAgent())
+		s.clients.request(client, info.Verb)
+		if info.Verb == "watch" {
+			defer s.clients.watch(watchClient{
+				Client:    client,
+				UserAgent: r.UserAgent(),
+				SourceIPs: sourceIPs(r),
+				Resource:  info.Resource,
+				Namespace: info.Namespace,
+			})()
+		}
+
+		if isHealthPath(r.URL.Path) || !klog.V(2).Enabled() {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		received := time.Now()
+		recorder := &auditResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+
+		klog.V(2).InfoS("Served request", "requestID", id, "client", client, "verb", info.Verb, "uri", r.URL.RequestURI(),
+			"resource", info.Resource, "subresource", info.Subresource, "namespace", info.Namespace,
+			"name", info.Name, "status", recorder.statusCode, "latency", time.Since(received),
+			"userAgent", r.UserAgent(), "sourceIPs", sourceIPs(r))
+	})
+}
+
+// isPrintableASCII reports whether s only holds printable ASCII characters
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewJSONLogger returns a logger writing one JSON object per line to out, for klog.SetLogger:
+// ts, level, v (the verbosity of info lines), logger (its name), caller and msg, followed by
+// err and the key/value pairs of structured calls. Verbosity is filtered by klog (-v).
+func NewJSONLogger(out io.Writer) logr.Logger {
+	return logr.New(&jsonLogSink{out: &jsonLogOutput{w: out}})
+}
+
+// jsonLogOutput serializes the lines of the loggers derived from a JSON logger
+type jsonLogOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// jsonLogSink is the logr.LogSink of NewJSONLogger
+type jsonLogSink struct {
+	out       *jsonLogOutput
+	name      string
+	values    []any
+	callDepth int
+}
+
+func (s *jsonLogSink) Init(info logr.RuntimeInfo) {
+	s.callDepth += info.CallDepth
+}
+
+func (s *jsonLogSink) Enabled(level int) bool {
+	return true
+}
+
+func (s *jsonLogSink) Info(level int, msg string, keysAndValues ...any) {
+	s.write("info", level, nil, msg, keysAndValues)
+}
+
+func (s *jsonLogSink) Error(err error, msg string, keysAndValues ...any) {
+	s.write("error", -1, err, msg, keysAndValues)
+}
+
+func (s *jsonLogSink) WithValues(keysAndValues ...any) logr.LogSink {
+	sink := *s
+	sink.values = append(append([]any(nil), s.values...), keysAndValues...)
+	return &sink
+}
+
+func (s *jsonLogSink) WithName(name string) logr.LogSink {
+	sink := *s
+	if sink.name != "" {
+		name = sink.name + "/" + name
+	}
+	sink.name = name
+	return &sink
+}
+
+func (s *jsonLogSink) WithCallDepth(depth int) logr.LogSink {
+	sink := *s
+	sink.callDepth += depth
+	return &sink
+}
+
+// write writes a log line; v is omitted for errors, which have no verbosity
+func (s *jsonLogSink) write(level string, v int, err error, msg string, keysAndValues []any) {
+	var line bytes.Buffer
+	writeField := func(key string, value any) {
+		if line.Len() > 0 {
+			line.WriteByte(',')
+		} else {
+			line.WriteByte('{')
+		}
+		name, _ := json.Marshal(key)
+		line.Write(name)
+		line.WriteByte(':')
+		line.Write(jsonLogValue(value))
+	}
+
+	writeField("ts", time.Now().UTC().Format(time.RFC3339Nano))
+	writeField("level", level)
+	if v >= 0 {
+		writeField("v", v)
+	}
+	if s.name != "" {
+		writeField("logger", s.name)
+	}
+	if _, file, lineNumber, ok := runtime.Caller(s.callDepth + 2); ok {
+		writeField("caller", fmt.Sprintf("%s:%d", filepath.Base(file), lineNumber))
+	}
+	writeField("msg", msg)
+	if err != nil {
+		writeField("err", err)
+	}
+	for _, pairs := range [][]any{s.values, keysAndValues} {
+		for i := 0; i < len(pairs); i += 2 {
+			key := fmt.Sprint(pairs[i])
+			var value any = "(MISSING)"
+			if i+1 < len(pairs) {
+				value = pairs[i+1]
+			}
+			writeField(key, value)
+		}
+	}
+	line.WriteString("}\n")
+
+	s.out.mu.Lock()
+	defer s.out.mu.Unlock()
+	s.out.w.Write(line.Bytes())
+}
+
+// jsonLogValue encodes a logged value: errors and fmt.Stringers (durations, quantities...) as
+// their string, anything else as JSON, or as its %+v string when it cannot be
+func jsonLogValue(value any) (data []byte) {
+	defer func() {
+		// A String or Error method may panic, on nil pointers in particular
+		if r := recover(); r != nil {
+			data, _ = json.Marshal(fmt.Sprintf("<panic: %v>", r))
+		}
+	}()
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", value))
+	}
+	return data
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// kubeletLogTimeFormat is the format of the timestamps the kubelet prefixes log lines with
+// for timestamps=true: RFC3339 with fixed width nanoseconds, in UTC
+const kubeletLogTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// logOptions selects and formats the lines of a logs request
+type logOptions struct {
+	timestamps bool      // Prefix lines with their kubelet formatted timestamp
+	since      time.Time // Drop lines logged before, unless zero
+}
+
+// filtered reports whether the lines need the timestamps of the runtime to be processed
+func (o logOptions) filtered() bool {
+	return o.timestamps || !o.since.IsZero()
+}
+
+// requestLogOptions returns the log options of a logs request, from its timestamps,
+// sinceSeconds and sinceTime parameters
+func requestLogOptions(r *http.Request, now time.Time) (logOptions, error) {
+	query := r.URL.Query()
+	options := logOptions{timestamps: query.Get("timestamps") == "true"}
+
+	sinceSeconds, sinceTime := query.Get("sinceSeconds"), query.Get("sinceTime")
+	switch {
+	case sinceSeconds != "" && sinceTime != "":
+		return options, fmt.Errorf("at most one of sinceTime or sinceSeconds may be specified")
+	case sinceSeconds != "":
+		seconds, err := strconv.ParseInt(sinceSeconds, 10, 64)
+		if err != nil || seconds < 1 {
+			return options, fmt.Errorf("invalid sinceSeconds %q, expected a positive number of seconds", sinceSeconds)
+		}
+		options.since = now.Add(-time.Duration(seconds) * time.Second)
+	case sinceTime != "":
+		since, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			return options, fmt.Errorf("invalid sinceTime %q, expected an RFC3339 time: %v", sinceTime, err)
+		}
+		options.since = since
+	}
+	return options, nil
+}
+
+// runtimeArgs returns the arguments of the runtime logs command for the options: the lines
+// are requested with their timestamps whenever they are processed, and since is passed on
+// to skip most of the older lines, the exact cut being made on the timestamps
+func (o logOptions) runtimeArgs() []string {
+	var args []string
+	if o.filtered() {
+		args = append(args, "--timestamps")
+	}
+	if !o.since.IsZero() {
+		args = append(args, "--since", o.since.Format(time.RFC3339Nano))
+	}
+	return args
+}
+
+// logLineWriter processes the lines of one output stream of a runtime logs command, written
+// with their runtime timestamps, before writing them to a writer shared by the streams of
+// the command: lines logged before since are dropped, and the timestamps are rewritten in
+// the format of the kubelet or removed. Lines are written whole, and lines without a
+// timestamp, such as runtime errors, are written unchanged.
+type logLineWriter struct {
+	out     io.Writer
+	options logOptions
+	partial []byte // Incomplete last line
+}
+
+func (lw *logLineWriter) Write(data []byte) (int, error) {
+	lw.partial = append(lw.partial, data...)
+	for {
+		end := bytes.IndexByte(lw.partial, '\n')
+		if end < 0 {
+			break
+		}
+		line := lw.partial[:end+1]
+		if err := lw.writeLine(line); err != nil {
+			return 0, err
+		}
+		lw.partial = lw.partial[end+1:]
+	}
+	// Let go of the consumed lines
+	lw.partial = append([]byte(nil), lw.partial...)
+	return len(data), nil
+}
+
+// Close writes the last line, when the output does not end with a newline
+func (lw *logLineWriter) Close() error {
+	if len(lw.partial) == 0 {
+		return nil
+	}
+	line := lw.partial
+	lw.partial = nil
+	return lw.writeLine(line)
+}
+
+func (lw *logLineWriter) writeLine(line []byte) error {
+	space := bytes.IndexByte(line, ' ')
+	if space < 0 {
+		_, err := lw.out.Write(line)
+		return err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, string(line[:space]))
+	if err != nil {
+		_, err := lw.out.Write(line)
+		return err
+	}
+	if !lw.options.since.IsZero() && timestamp.Before(lw.options.since) {
+		return nil
+	}
+
+	message := line[space+1:]
+	if lw.options.timestamps {
+		message = append([]byte(timestamp.UTC().Format(kubeletLogTimeFormat)+" "), message...)
+	}
+	_, err = lw.out.Write(message)
+	return err
+}
+
+// lockedWriter serializes the writes of the streams of a command to a buffer
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(data []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(data)
+}
+
+// streams returns the writers for the stdout and stderr of a runtime logs command run with
+// the options, writing to out, and a function writing their last lines once it is done
+func (o logOptions) streams(out io.Writer) (stdout, stderr io.Writer, flush func() error) {
+	if !o.filtered() {
+		return out, out, func() error { return nil }
+	}
+	stdoutLines := &logLineWriter{out: out, options: o}
+	stderrLines := &logLineWriter{out: out, options: o}
+	return stdoutLines, stderrLines, func() error {
+		if err := stdoutLines.Close(); err != nil {
+			return err
+		}
+		return stderrLines.Close()
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+const (
+	// defaultLongPollTimeout is how long a long-poll watch waits for events when the request
+	// sets no timeoutSeconds
+	defaultLongPollTimeout = 30 * time.Second
+	// maxLongPollTimeout bounds the timeoutSeconds of long-poll watches, below the timeouts of
+	// most proxies
+	maxLongPollTimeout = 2 * time.Minute
+	// longPollCursorTTL is how long the cursor of a long-poll watch is kept for the next request
+	longPollCursorTTL = 5 * time.Minute
+)
+
+// watchEventList is the answer to a long-poll watch request: the events since the cursor the
+// request passed as resourceVersion, and in metadata.resourceVersion the cursor to pass to the
+// next request
+type watchEventList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Events          []metav1.WatchEvent `json:"events"`
+}
+
+// longPollCursor is the state of a long-poll watch after a request: the pods it has seen,
+// which the events of the next request are detected against
+type longPollCursor struct {
+	query    string // Namespace and selectors of the watch
+	pods     map[string]*corev1.Pod
+	previous string // Cursor this one was answered to, forgotten once this one is used
+	expires  time.Time
+}
+
+// longPollCursors holds the cursors of long-poll watches, by ID. A cursor stays valid until
+// the next one of its watch is used, so a request lost by a proxy can be retried.
+type longPollCursors struct {
+	mu      sync.Mutex
+	cursors map[string]*longPollCursor
+}
+
+// add stores a cursor and returns its ID, forgetting the expired cursors
+func (c *longPollCursors) add(cursor *longPollCursor) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range c.cursors {
+		if now.After(existing.expires) {
+			delete(c.cursors, id)
+		}
+	}
+	if c.cursors == nil {
+		c.cursors = map[string]*longPollCursor{}
+	}
+	id := string(uuid.NewUUID())
+	cursor.expires = now.Add(longPollCursorTTL)
+	c.cursors[id] = cursor
+	return id
+}
+
+// take returns the cursor of an ID, nil when unknown or expired, and forgets the cursor it
+// was answered to
+func (c *longPollCursors) take(id string) *longPollCursor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor, ok := c.cursors[id]
+	if !ok || time.Now().After(cursor.expires) {
+		return nil
+	}
+	delete(c.cursors, cursor.previous)
+	cursor.expires = time.Now().Add(longPollCursorTTL)
+	return cursor
+}
+
+// longPollPods serves a pod watch requested with fallback=longpoll, for clients behind proxies
+// that buffer chunked responses until they end. Each request answers a watchEventList, as soon
+// as there are events or after timeoutSeconds. A request without resourceVersion starts the
+// watch with ADDED events for the current pods, one with the resourceVersion of a pod list
+// starts it from that list. Cursors that are unknown or expired, and lists that changed since,
+// are answered with 410 Gone, for the client to list the pods again.
+func (s *Server) longPollPods(w http.ResponseWriter, r *http.Request, namespace, labelSelector, fieldSelector string) {
+	timeout := defaultLongPollTimeout
+	if value := r.URL.Query().Get("timeoutSeconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid timeoutSeconds %q", value)))
+			return
+		}
+		timeout = min(time.Duration(seconds)*time.Second, maxLongPollTimeout)
+	}
+	isTableFormat := strings.Contains(r.Header.Get("Accept"), "as=Table")
+	includeObject, err := includeObjectPolicy(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	changed := s.podStorage.Changed(r.Context())
+	currentPods, err := s.podStorage.List(r.Context(), namespace, labelSelector, fieldSelector)
+	if errors.Is(err, storage.ErrPodmanUnavailable) {
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		return
+	}
+	if err != nil {
+		klog.Errorf("Failed to list pods for long-poll watch: %v", err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return
+	}
+
+	query := strings.Join([]string{namespace, labelSelector, fieldSelector}, "\x00")
+	previousPods := map[string]*corev1.Pod{}
+	var cursorID string
+	switch resourceVersion := r.URL.Query().Get("resourceVersion"); resourceVersion {
+	case "", "0":
+	case currentPods.ResourceVersion:
+		previousPods = s.podsByKey(currentPods.Items)
+	default:
+		cursor := s.longPolls.take(resourceVersion)
+		if cursor == nil {
+			s.writeStatusError(w, apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %s", resourceVersion)))
+			return
+		}
+		if cursor.query != query {
+			s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("resourceVersion %s continues a watch of other pods", resourceVersion)))
+			return
+		}
+		previousPods, cursorID = cursor.pods, resourceVersion
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(watchResyncInterval)
+	defer ticker.Stop()
+
+	changes := s.detectPodChanges(previousPods, currentPods.Items)
+wait:
+	for len(changes) == 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdownCh:
+			break wait
+		case <-deadline.C:
+			break wait
+		case <-changed:
+			changed = s.podStorage.Changed(r.Context())
+		case <-ticker.C:
+		}
+
+		pods, err := s.podStorage.List(r.Context(), namespace, labelSelector, fieldSelector)
+		if err != nil {
+			klog.Errorf("Failed to refresh pods during long-poll watch: %v", err)
+			continue
+		}
+		currentPods = pods
+		changes = s.detectPodChanges(previousPods, currentPods.Items)
+	}
+
+	// A watch without events keeps its cursor
+	if len(changes) > 0 || cursorID == "" {
+		cursorID = s.longPolls.add(&longPollCursor{
+			query:    query,
+			pods:     s.podsByKey(currentPods.Items),
+			previous: cursorID,
+		})
+	}
+	s.writeObject(w, r, &watchEventList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "WatchEventList",
+			APIVersion: storage.PodmanAPIVersion,
+		},
+		ListMeta: metav1.ListMeta{ResourceVersion: cursorID},
+		Events:   s.podChangeEvents(changes, currentPods, isTableFormat, includeObject),
+	})
+}
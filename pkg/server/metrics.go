@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w io.Writer
+}
+
+// gauge writes a metric whose value can go up and down
+func (mw *metricsWriter) gauge(name, help string, value float64) {
+	mw.metric(name, "gauge", help, value)
+}
+
+// counter writes a metric whose value only goes up
+func (mw *metricsWriter) counter(name, help string, value float64) {
+	mw.metric(name, "counter", help, value)
+}
+
+func (mw *metricsWriter) metric(name, kind, help string, value float64) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, help, name, kind, name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// header writes the HELP and TYPE lines of a metric whose samples have labels
+func (mw *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes a sample of a metric, with labels given as name, value pairs
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], labelValueEscaper.Replace(labels[i+1])))
+	}
+	fmt.Fprintf(mw.w, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// labelValueEscaper escapes label values as the text exposition format requires
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// handleMetrics serves the metrics of the server in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	metrics := &metricsWriter{w: w}
+	s.execSessions.writeMetrics(metrics)
+	s.clients.writeMetrics(metrics)
+}
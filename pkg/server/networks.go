@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// networkResource names networks in API errors
+var networkResource = schema.GroupResource{Group: "podman.io", Resource: "networks"}
+
+// listNetworks lists the networks of every node
+func (s *Server) listNetworks(w http.ResponseWriter, r *http.Request) {
+	networkList, err := s.podStorage.ListNetworks(r.Context())
+	if err != nil {
+		s.writeNetworkError(w, "", err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, networkListToTable(networkList))
+	} else {
+		s.writeObject(w, r, networkList)
+	}
+}
+
+// getNetwork returns a network by name
+func (s *Server) getNetwork(w http.ResponseWriter, r *http.Request, name string) {
+	network, err := s.podStorage.GetNetwork(r.Context(), name)
+	if err != nil {
+		s.writeNetworkError(w, name, err)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, networkListToTable(&storage.NetworkList{Items: []storage.Network{*network}}))
+	} else {
+		s.writeObject(w, r, network)
+	}
+}
+
+// createNetwork creates a network on every node
+func (s *Server) createNetwork(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	var network storage.Network
+	if err := decodeBody(w, r, &network); err != nil {
+		s.writeDecodeError(w, "network", err)
+		return
+	}
+	var errs field.ErrorList
+	if network.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("metadata", "name"), ""))
+	} else {
+		errs = append(errs, validateObjectMeta(&network.ObjectMeta, nil)...)
+	}
+	for i, subnet := range network.Spec.Subnets {
+		if subnet.Subnet == "" {
+			errs = append(errs, field.Required(field.NewPath("spec", "subnets").Index(i).Child("subnet"), ""))
+		}
+	}
+	if len(errs) > 0 {
+		s.writeStatusError(w, apierrors.NewInvalid(schema.GroupKind{Group: networkResource.Group, Kind: "Network"}, network.Name, errs))
+		return
+	}
+
+	var created *storage.Network
+	if dryRun {
+		if _, err = s.podStorage.GetNetwork(r.Context(), network.Name); err == nil {
+			err = fmt.Errorf("network %s already exists", network.Name)
+		} else if strings.Contains(err.Error(), "not found") {
+			created, err = &network, nil
+			created.TypeMeta = metav1.TypeMeta{Kind: "Network", APIVersion: storage.PodmanAPIVersion}
+		}
+	} else {
+		created, err = s.podStorage.CreateNetwork(r.Context(), &network)
+	}
+	if err != nil {
+		s.writeNetworkError(w, network.Name, err)
+		return
+	}
+	s.writeObjectWithStatus(w, r, http.StatusCreated, created)
+}
+
+// deleteNetwork removes a network from every node
+func (s *Server) deleteNetwork(w http.ResponseWriter, r *http.Request, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	if dryRun {
+		_, err = s.podStorage.GetNetwork(r.Context(), name)
+	} else {
+		err = s.podStorage.DeleteNetwork(r.Context(), name)
+	}
+	if err != nil {
+		s.writeNetworkError(w, name, err)
+		return
+	}
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusSuccess,
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf(`network "%s" deleted`, name),
+	}
+	s.writeObject(w, r, status)
+}
+
+// writeNetworkError reports a network storage error as a Kubernetes Status
+func (s *Server) writeNetworkError(w http.ResponseWriter, name string, err error) {
+	switch {
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	case errors.Is(err, storage.ErrNetworkInUse):
+		s.writeStatusError(w, apierrors.NewConflict(networkResource, name, err))
+	case strings.Contains(err.Error(), "already exists"):
+		s.writeStatusError(w, apierrors.NewAlreadyExists(networkResource, name))
+	case strings.Contains(err.Error(), "not found"):
+		s.writeStatusError(w, apierrors.NewNotFound(networkResource, name))
+	default:
+		klog.Errorf("Network request failed: %v", err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+	}
+}
+
+// networkListToTable converts a NetworkList to the table format used by kubectl get networks
+func networkListToTable(networkList *storage.NetworkList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the network"},
+			{Name: "Driver", Type: "string", Description: "Network driver"},
+			{Name: "Subnet", Type: "string", Description: "Subnets of the network"},
+			{Name: "Gateway", Type: "string", Description: "Gateways of the subnets"},
+			{Name: "Age", Type: "string", Description: "Time since the network was created"},
+			{Name: "Nodes", Type: "string", Description: "Nodes whose runtime has the network", Priority: 1},
+		},
+	}
+
+	for _, network := range networkList.Items {
+		var subnets, gateways []string
+		for _, subnet := range network.Spec.Subnets {
+			subnets = append(subnets, subnet.Subnet)
+			if subnet.Gateway != "" {
+				gateways = append(gateways, subnet.Gateway)
+			}
+		}
+
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				network.Name,
+				network.Spec.Driver,
+				noneIfEmpty(strings.Join(subnets, ",")),
+				noneIfEmpty(strings.Join(gateways, ",")),
+				translateTimestampSince(network.CreationTimestamp),
+				strings.Join(network.Status.Nodes, ","),
+			},
+			Object: runtime.RawExtension{
+				Object: network.DeepCopy(),
+			},
+		})
+	}
+
+	return table
+}
+
+// noneIfEmpty returns the value of a table cell, <none> when empty
+func noneIfEmpty(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// nodeLogSources are the host logs served by /logs/: the journald units that can be queried,
+// and the log files by name. Nothing else of the host is readable through the endpoint.
+type nodeLogSources struct {
+	units []string
+	files map[string]string // Path by name
+}
+
+// SetNodeLogs sets the host logs served by /logs/ and the node logs proxy: units lists the
+// journald units that can be queried, files the log files written path or name=path, the name
+// defaulting to the base name of the path
+func (s *Server) SetNodeLogs(units, files string) error {
+	sources := nodeLogSources{files: map[string]string{}}
+	for _, unit := range strings.Split(units, ",") {
+		if unit = strings.TrimSpace(unit); unit != "" {
+			sources.units = append(sources.units, unit)
+		}
+	}
+	for _, item := range strings.Split(files, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(item, "=")
+		if !ok {
+			name, path = filepath.Base(item), item
+		}
+		if name == "" || strings.Contains(name, "/") || !filepath.IsAbs(path) {
+			return fmt.Errorf("invalid log file %q, expected an absolute path or name=path", item)
+		}
+		if _, exists := sources.files[name]; exists {
+			return fmt.Errorf("log file name %q is used twice", name)
+		}
+		sources.files[name] = path
+	}
+	s.nodeLogs.Store(&sources)
+	return nil
+}
+
+// handleNodeLogsProxy serves the host logs of a node through the node proxy, as
+// /api/v1/nodes/{name}/proxy/logs/ does with the kubelet. Only the nodes running on the host
+// of the adapter, the local runtime and the system podman, have their logs served.
+func (s *Server) handleNodeLogsProxy(w http.ResponseWriter, r *http.Request, name string) {
+	node, ok := s.podStorage.Node(name)
+	if !ok {
+		s.writeStatusError(w, apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, name))
+		return
+	}
+	switch node.Connection {
+	case "":
+		s.serveNodeLogs(w, r, os.Geteuid() != 0, r.PathValue("path"))
+	case storage.RootfulConnection:
+		s.serveNodeLogs(w, r, false, r.PathValue("path"))
+	default:
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(fmt.Sprintf("the logs of node %s are not served, as it runs on another host (%s)", name, node.Connection)))
+	}
+}
+
+// handleLogs serves the host logs of the adapter, at /logs/
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	s.serveNodeLogs(w, r, os.Geteuid() != 0, r.PathValue("path"))
+}
+
+// serveNodeLogs serves a host log like the kubelet /logs/ endpoint: without path, the list of
+// the log files, or with ?query= the journal of a unit (or a log file); with a path, a log
+// file. Journal units are those of the user manager when user is set, as rootless podman runs
+// under it.
+func (s *Server) serveNodeLogs(w http.ResponseWriter, r *http.Request, user bool, path string) {
+	sources := s.nodeLogs.Load()
+	if sources == nil {
+		sources = &nodeLogSources{}
+	}
+
+	if path == "" {
+		query := r.URL.Query().Get("query")
+		if query == "" {
+			s.writeNodeLogIndex(w, sources)
+			return
+		}
+		if _, ok := sources.files[query]; !ok {
+			s.serveJournal(w, r, sources, user, query)
+			return
+		}
+		path = query
+	}
+
+	file, ok := sources.files[path]
+	if !ok {
+		s.writeStatusError(w, apierrors.NewNotFound(schema.GroupResource{Resource: "logs"}, path))
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		klog.Errorf("Failed to open log file %s: %v", file, err)
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(fmt.Sprintf("log file %s cannot be read", path)))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	http.ServeContent(w, r, path, info.ModTime(), f)
+}
+
+// writeNodeLogIndex writes the names of the log files, and the query of each journal unit
+func (s *Server) writeNodeLogIndex(w http.ResponseWriter, sources *nodeLogSources) {
+	var index []string
+	for name := range sources.files {
+		index = append(index, name)
+	}
+	sort.Strings(index)
+	for _, unit := range sources.units {
+		index = append(index, "?query="+unit)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	for _, entry := range index {
+		fmt.Fprintln(w, entry)
+	}
+}
+
+// serveJournal streams the journal of a unit, selected with the parameters of the kubelet node
+// log query: sinceTime, untilTime, tailLines, pattern and boot
+func (s *Server) serveJournal(w http.ResponseWriter, r *http.Request, sources *nodeLogSources, user bool, unit string) {
+	allowed := false
+	for _, candidate := range sources.units {
+		allowed = allowed || candidate == unit
+	}
+	if !allowed {
+		s.writeStatusError(w, apierrors.NewNotFound(schema.GroupResource{Resource: "logs"}, unit))
+		return
+	}
+	args, err := journalArgs(r, user, unit)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	journalctl, err := exec.LookPath("journalctl")
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewServiceUnavailable("journalctl is not available on the host"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	cmd := exec.CommandContext(r.Context(), journalctl, args...)
+	var stderr bytes.Buffer
+	cmd.Stdout = &flushWriter{w: w, flusher: flusher}
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = logsWaitDelay
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := cmd.Run(); err != nil && r.Context().Err() == nil {
+		klog.Errorf("Journal query %v failed: %v, output: %s", cmd.Args, err, stderr.String())
+	}
+}
+
+// journalArgs returns the journalctl arguments of a node log query
+func journalArgs(r *http.Request, user bool, unit string) ([]string, error) {
+	query := r.URL.Query()
+	args := []string{"--no-pager", "--output=short-precise", "--unit=" + unit}
+	if user {
+		args = append(args, "--user")
+	}
+	for _, param := range []string{"sinceTime", "untilTime"} {
+		if value := query.Get(param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q, expected an RFC3339 time: %v", param, value, err)
+			}
+			option := "--since="
+			if param == "untilTime" {
+				option = "--until="
+			}
+			args = append(args, option+t.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+	if value := query.Get("tailLines"); value != "" {
+		lines, err := strconv.Atoi(value)
+		if err != nil || lines < 0 {
+			return nil, fmt.Errorf("invalid tailLines %q, expected a non-negative number of lines", value)
+		}
+		args = append(args, "--lines="+value)
+	}
+	if value := query.Get("pattern"); value != "" {
+		if _, err := regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", value, err)
+		}
+		args = append(args, "--grep="+value)
+	}
+	if value := query.Get("boot"); value != "" {
+		boot, err := strconv.Atoi(value)
+		if err != nil || boot > 0 {
+			return nil, fmt.Errorf("invalid boot %q, expected 0 for the current boot or a negative offset", value)
+		}
+		args = append(args, "--boot="+value)
+	}
+	return args, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// nodeREST serves the nodes of the cluster
+type nodeREST struct {
+	server *Server
+}
+
+func (nr *nodeREST) New() runtime.Object {
+	return &corev1.Node{}
+}
+
+func (nr *nodeREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	node, err := nr.server.podStorage.GetNode(ctx, name)
+	if err != nil {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, name)
+	}
+	return node, nil
+}
+
+func (nr *nodeREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	return nr.server.podStorage.ListNodes(ctx), nil
+}
+
+func (nr *nodeREST) ConvertToTable(obj runtime.Object) *metav1.Table {
+	if node, ok := obj.(*corev1.Node); ok {
+		return nr.server.nodeListToTable(&corev1.NodeList{Items: []corev1.Node{*node}})
+	}
+	return nr.server.nodeListToTable(obj.(*corev1.NodeList))
+}
+
+// nodeListToTable converts a NodeList to the table format used by oc get nodes
+func (s *Server) nodeListToTable(nodeList *corev1.NodeList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the podman node"},
+			{Name: "Status", Type: "string", Description: "Whether podman on the node is reachable"},
+			{Name: "Roles", Type: "string", Description: "The roles of the node"},
+			{Name: "Age", Type: "string", Description: "Time since the node was registered"},
+			{Name: "Version", Type: "string", Description: "Podman version on the node"},
+			{Name: "Connection", Type: "string", Description: "Runtime connection used to reach the node", Priority: 1},
+		},
+	}
+
+	for _, node := range nodeList.Items {
+		status := "Unknown"
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == corev1.NodeReady {
+				if condition.Status == corev1.ConditionTrue {
+					status = "Ready"
+				} else {
+					status = "NotReady"
+				}
+			}
+		}
+
+		version := node.Status.NodeInfo.ContainerRuntimeVersion
+		if _, runtimeVersion, ok := strings.Cut(version, "://"); ok {
+			version = runtimeVersion
+		}
+		if version == "" {
+			version = "<unknown>"
+		}
+
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				node.Name,
+				status,
+				"<none>",
+				translateTimestampSince(node.CreationTimestamp),
+				version,
+				node.Annotations["podman.io/connection"],
+			},
+			Object: runtime.RawExtension{
+				Object: node.DeepCopy(),
+			},
+		})
+	}
+
+	return table
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Patch media types accepted on PATCH requests
+const (
+	patchTypeJSON           = "application/json-patch+json"
+	patchTypeMerge          = "application/merge-patch+json"
+	patchTypeStrategicMerge = "application/strategic-merge-patch+json"
+)
+
+// applyPatch applies a PATCH request body to the JSON of the current object. Strategic
+// merge patches are applied as JSON merge patches: lists are replaced rather than merged
+// by key, and $-directives are ignored, which is what label, annotation and finalizer
+// patches need.
+func applyPatch(contentType string, original, patch []byte) ([]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", errUnsupportedMediaType, contentType, err)
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(original, &document); err != nil {
+		return nil, err
+	}
+
+	switch mediaType {
+	case patchTypeJSON:
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(patch, &operations); err != nil {
+			return nil, fmt.Errorf("invalid JSON patch: %v", err)
+		}
+		for i, operation := range operations {
+			if document, err = operation.apply(document); err != nil {
+				return nil, fmt.Errorf("JSON patch operation %d (%s %s): %v", i, operation.Op, operation.Path, err)
+			}
+		}
+	case patchTypeMerge, patchTypeStrategicMerge:
+		var mergePatch interface{}
+		if err := json.Unmarshal(patch, &mergePatch); err != nil {
+			return nil, fmt.Errorf("invalid merge patch: %v", err)
+		}
+		document = mergePatchValue(document, mergePatch, mediaType == patchTypeStrategicMerge)
+	default:
+		return nil, fmt.Errorf("%w %q (supported: %s, %s, %s)", errUnsupportedMediaType, mediaType, patchTypeJSON, patchTypeMerge, patchTypeStrategicMerge)
+	}
+
+	return json.Marshal(document)
+}
+
+// patchSetsResourceVersion reports whether a PATCH request body sets metadata.resourceVersion,
+// making the patch conflict with the updates made since the client read the object
+func patchSetsResourceVersion(contentType string, patch []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch mediaType {
+	case patchTypeJSON:
+		var operations []jsonPatchOperation
+		if err := json.Unmarshal(patch, &operations); err != nil {
+			return false
+		}
+		for _, operation := range operations {
+			switch {
+			case operation.Op == "remove" || operation.Op == "test":
+			case operation.Path == "/metadata/resourceVersion":
+				return true
+			case operation.Path == "/metadata" && operation.Op != "move" && operation.Op != "copy":
+				var metadata map[string]json.RawMessage
+				if json.Unmarshal(operation.Value, &metadata) == nil && metadata["resourceVersion"] != nil {
+					return true
+				}
+			}
+		}
+	case patchTypeMerge, patchTypeStrategicMerge:
+		var object struct {
+			Metadata map[string]json.RawMessage `json:"metadata"`
+		}
+		if err := json.Unmarshal(patch, &object); err != nil {
+			return false
+		}
+		value, ok := object.Metadata["resourceVersion"]
+		return ok && string(value) != "null"
+	}
+	return false
+}
+
+// mergePatchValue applies a JSON merge patch (RFC 7386) to target
+func mergePatchValue(target, patch interface{}, skipDirectives bool) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if skipDirectives && strings.HasPrefix(key, "$") {
+			continue
+		}
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatchValue(targetObject[key], value, skipDirectives)
+	}
+	return targetObject
+}
+
+// jsonPatchOperation is a single JSON patch (RFC 6902) operation
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// apply applies the operation to document and returns the new document
+func (o *jsonPatchOperation) apply(document interface{}) (interface{}, error) {
+	switch o.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if err := json.Unmarshal(o.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		if o.Op == "test" {
+			current, err := jsonPointerGet(document, o.Path)
+			if err != nil {
+				return nil, err
+			}
+			currentJSON, _ := json.Marshal(current)
+			valueJSON, _ := json.Marshal(value)
+			if string(currentJSON) != string(valueJSON) {
+				return nil, fmt.Errorf("test failed: value is %s", currentJSON)
+			}
+			return document, nil
+		}
+		return jsonPointerSet(document, o.Path, value, o.Op == "replace")
+	case "remove":
+		document, _, err := jsonPointerRemove(document, o.Path)
+		return document, err
+	case "move", "copy":
+		value, err := jsonPointerGet(document, o.From)
+		if err != nil {
+			return nil, err
+		}
+		if o.Op == "move" {
+			if document, _, err = jsonPointerRemove(document, o.From); err != nil {
+				return nil, err
+			}
+		}
+		return jsonPointerSet(document, o.Path, value, false)
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", o.Op)
+	}
+}
+
+// splitJSONPointer splits a JSON pointer (RFC 6901) into unescaped reference tokens
+func splitJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array reference token; "-" refers past the last element when allowed
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if err != nil || index < 0 || index > limit {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+// jsonPointerGet returns the value at pointer
+func jsonPointerGet(document interface{}, pointer string) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := document
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", pointer)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+	}
+	return current, nil
+}
+
+// jsonPointerSet adds (or, with replace, replaces) the value at pointer
+func jsonPointerSet(document interface{}, pointer string, value interface{}, replace bool) (interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return setIn(document, tokens, value, replace, pointer)
+}
+
+// setIn sets value at tokens below node and returns the updated node
+func setIn(node interface{}, tokens []string, value interface{}, replace bool, pointer string) (interface{}, error) {
+	token := tokens[0]
+	last := len(tokens) == 1
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if last {
+			if _, exists := container[token]; replace && !exists {
+				return nil, fmt.Errorf("path %q not found", pointer)
+			}
+			container[token] = value
+			return container, nil
+		}
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path %q not found", pointer)
+		}
+		updated, err := setIn(child, tokens[1:], value, replace, pointer)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = updated
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), last && !replace)
+		if err != nil {
+			return nil, err
+		}
+		if !last {
+			updated, err := setIn(container[index], tokens[1:], value, replace, pointer)
+			if err != nil {
+				return nil, err
+			}
+			container[index] = updated
+			return container, nil
+		}
+		if replace {
+			container[index] = value
+			return container, nil
+		}
+		container = append(container, nil)
+		copy(container[index+1:], container[index:])
+		container[index] = value
+		return container, nil
+	default:
+		return nil, fmt.Errorf("path %q not found", pointer)
+	}
+}
+
+// jsonPointerRemove removes the value at pointer and returns the updated document and the
+// removed value
+func jsonPointerRemove(document interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := splitJSONPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	parentPointer := ""
+	for _, token := range tokens[:len(tokens)-1] {
+		parentPointer += "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+	}
+	parent, err := jsonPointerGet(document, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token := tokens[len(tokens)-1]
+	switch container := parent.(type) {
+	case map[string]interface{}:
+		removed, ok := container[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q not found", pointer)
+		}
+		delete(container, token)
+		return document, removed, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed := container[index]
+		shrunk := append(container[:index:index], container[index+1:]...)
+		if len(tokens) == 1 {
+			return shrunk, removed, nil
+		}
+		document, err = jsonPointerSet(document, parentPointer, shrunk, true)
+		return document, removed, err
+	default:
+		return nil, nil, fmt.Errorf("path %q not found", pointer)
+	}
+}
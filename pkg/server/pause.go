@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// handlePodPause handles pod pause requests: /api/v1/namespaces/{namespace}/pods/{name}/pause.
+// The processes of the containers of the pod are frozen until it is unpaused; the paused pod
+// is returned, with the Paused condition.
+func (s *Server) handlePodPause(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	pod, err := s.podStorage.Pause(r.Context(), namespace, name)
+	s.writePauseResult(w, r, name, pod, err)
+}
+
+// handlePodUnpause handles pod unpause requests: /api/v1/namespaces/{namespace}/pods/{name}/unpause
+func (s *Server) handlePodUnpause(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	pod, err := s.podStorage.Unpause(r.Context(), namespace, name)
+	s.writePauseResult(w, r, name, pod, err)
+}
+
+// writePauseResult writes the pod of a pause or unpause request, or its error as a Kubernetes Status
+func (s *Server) writePauseResult(w http.ResponseWriter, r *http.Request, name string, pod *corev1.Pod, err error) {
+	podResource := schema.GroupResource{Resource: "pods"}
+	switch {
+	case err == nil:
+		s.writeObject(w, r, pod)
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	case errors.Is(err, storage.ErrInvalidPause):
+		s.writeStatusError(w, apierrors.NewConflict(podResource, name, err))
+	case strings.Contains(err.Error(), "not found"):
+		s.writeStatusError(w, apierrors.NewNotFound(podResource, name))
+	default:
+		klog.Errorf("Pause request for pod %s failed: %v", name, err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+	}
+}
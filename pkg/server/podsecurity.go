@@ -0,0 +1,396 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// podSecurityLabelPrefix prefixes the namespace labels setting the Pod Security Standards
+// levels of their pods, as the PodSecurity admission of Kubernetes reads them:
+// pod-security.kubernetes.io/MODE set to a level, and pod-security.kubernetes.io/MODE-version
+// to the version of the standards, which only labels the messages
+const podSecurityLabelPrefix = "pod-security.kubernetes.io/"
+
+// Modes of the Pod Security Standards labels
+const (
+	podSecurityEnforce = "enforce" // Pods violating the level are rejected
+	podSecurityWarn    = "warn"    // Violations are returned as warnings
+	podSecurityAudit   = "audit"   // Violations are annotated on the audit events
+)
+
+// Levels of the Pod Security Standards, from the least to the most restrictive
+const (
+	podSecurityPrivileged = "privileged"
+	podSecurityBaseline   = "baseline"
+	podSecurityRestricted = "restricted"
+)
+
+// podSecurityAuditAnnotation is the audit event annotation listing the violations of the
+// audit level
+const podSecurityAuditAnnotation = "pod-security.kubernetes.io/audit-violations"
+
+// podSecurityVersion matches the versions of the Pod Security Standards labels
+var podSecurityVersion = regexp.MustCompile(`^(latest|v1\.(0|[1-9][0-9]*))$`)
+
+// baselineCapabilities are the capabilities the baseline level allows containers to add,
+// those of the default set of container runtimes
+var baselineCapabilities = map[corev1.Capability]bool{
+	"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true, "KILL": true,
+	"MKNOD": true, "NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true,
+	"SYS_CHROOT": true,
+}
+
+// baselineSELinuxTypes are the SELinux types the baseline level allows
+var baselineSELinuxTypes = map[string]bool{
+	"": true, "container_t": true, "container_init_t": true, "container_kvm_t": true, "container_engine_t": true,
+}
+
+// safeSysctls are the sysctls the baseline level allows
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_local_reserved_ports":    true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.ping_group_range":           true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.tcp_keepalive_time":         true,
+	"net.ipv4.tcp_fin_timeout":            true,
+	"net.ipv4.tcp_keepalive_intvl":        true,
+	"net.ipv4.tcp_keepalive_probes":       true,
+}
+
+// validatePodSecurityLabels validates the Pod Security Standards labels of a namespace
+func validatePodSecurityLabels(labels map[string]string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for key, value := range labels {
+		mode, ok := strings.CutPrefix(key, podSecurityLabelPrefix)
+		if !ok {
+			continue
+		}
+		switch mode {
+		case podSecurityEnforce, podSecurityWarn, podSecurityAudit:
+			if value != podSecurityPrivileged && value != podSecurityBaseline && value != podSecurityRestricted {
+				errs = append(errs, field.NotSupported(path.Key(key), value, []string{podSecurityPrivileged, podSecurityBaseline, podSecurityRestricted}))
+			}
+		case podSecurityEnforce + "-version", podSecurityWarn + "-version", podSecurityAudit + "-version":
+			if !podSecurityVersion.MatchString(value) {
+				errs = append(errs, field.Invalid(path.Key(key), value, "must be latest or v1.X"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(path.Key(key), key, []string{podSecurityEnforce, podSecurityWarn, podSecurityAudit}))
+		}
+	}
+	return errs
+}
+
+// podSecurityAdmission evaluates the pods created, and updated with a new spec, against the
+// Pod Security Standards levels of the labels of their namespace, as the PodSecurity
+// admission of Kubernetes does: the violations of the enforce level reject the pod with a
+// 403 Forbidden, those of the warn level are returned as warnings, and those of the audit
+// level are annotated on the audit events
+type podSecurityAdmission struct {
+	namespaceLabels func(namespace string) map[string]string
+}
+
+func (podSecurityAdmission) Name() string { return "PodSecurity" }
+
+func (p podSecurityAdmission) Enforce(attrs *admissionAttributes, pod *corev1.Pod) error {
+	if attrs.operation == admissionUpdate && attrs.old != nil && equality.Semantic.DeepEqual(attrs.old.Spec, pod.Spec) {
+		return nil
+	}
+	labels := p.namespaceLabels(pod.Namespace)
+	if len(labels) == 0 {
+		return nil
+	}
+
+	policy := func(mode string) (string, []string) {
+		level := labels[podSecurityLabelPrefix+mode]
+		if level == "" || level == podSecurityPrivileged {
+			return "", nil
+		}
+		version := labels[podSecurityLabelPrefix+mode+"-version"]
+		if version == "" {
+			version = "latest"
+		}
+		return level + ":" + version, checkPodSecurity(level, pod)
+	}
+	if name, violations := policy(podSecurityWarn); len(violations) > 0 {
+		attrs.warnings = append(attrs.warnings, fmt.Sprintf("would violate PodSecurity %q: %s", name, strings.Join(violations, ", ")))
+	}
+	if name, violations := policy(podSecurityAudit); len(violations) > 0 {
+		if attrs.auditAnnotations == nil {
+			attrs.auditAnnotations = map[string]string{}
+		}
+		attrs.auditAnnotations[podSecurityAuditAnnotation] = fmt.Sprintf("would violate PodSecurity %q: %s", name, strings.Join(violations, ", "))
+	}
+	if name, violations := policy(podSecurityEnforce); len(violations) > 0 {
+		return apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, pod.Name,
+			fmt.Errorf("violates PodSecurity %q: %s", name, strings.Join(violations, ", ")))
+	}
+	return nil
+}
+
+// podContainers returns the init, regular and ephemeral containers of a pod
+func podContainers(pod *corev1.Pod) []corev1.Container {
+	containers := append(append([]corev1.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range pod.Spec.EphemeralContainers {
+		containers = append(containers, corev1.Container(container.EphemeralContainerCommon))
+	}
+	return containers
+}
+
+// quoteAll writes values quoted and separated by commas
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quotedNames writes the containers or volumes of a violation, as in container "a" or
+// containers "a", "b"
+func quotedNames(singular, plural string, names []string) string {
+	if len(names) == 1 {
+		return singular + " " + quoteAll(names)
+	}
+	return plural + " " + quoteAll(names)
+}
+
+// checkPodSecurity returns the violations of a pod of a Pod Security Standards level, in the
+// words of the PodSecurity admission of Kubernetes
+func checkPodSecurity(level string, pod *corev1.Pod) []string {
+	var violations []string
+	containers := podContainers(pod)
+	podContext := pod.Spec.SecurityContext
+	if podContext == nil {
+		podContext = &corev1.PodSecurityContext{}
+	}
+
+	// containersWhere lists the names of the containers matching a check
+	containersWhere := func(check func(context *corev1.SecurityContext) bool) []string {
+		var names []string
+		for _, container := range containers {
+			context := container.SecurityContext
+			if context == nil {
+				context = &corev1.SecurityContext{}
+			}
+			if check(context) {
+				names = append(names, container.Name)
+			}
+		}
+		return names
+	}
+
+	// Baseline
+	var hostNamespaces []string
+	if pod.Spec.HostNetwork {
+		hostNamespaces = append(hostNamespaces, "hostNetwork=true")
+	}
+	if pod.Spec.HostPID {
+		hostNamespaces = append(hostNamespaces, "hostPID=true")
+	}
+	if pod.Spec.HostIPC {
+		hostNamespaces = append(hostNamespaces, "hostIPC=true")
+	}
+	if len(hostNamespaces) > 0 {
+		violations = append(violations, fmt.Sprintf("host namespaces (%s)", strings.Join(hostNamespaces, ", ")))
+	}
+
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return context.Privileged != nil && *context.Privileged
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("privileged (%s must not set securityContext.privileged=true)", quotedNames("container", "containers", names)))
+	}
+
+	var added []string
+	for _, container := range containers {
+		if container.SecurityContext == nil || container.SecurityContext.Capabilities == nil {
+			continue
+		}
+		for _, capability := range container.SecurityContext.Capabilities.Add {
+			if !baselineCapabilities[capability] {
+				added = append(added, fmt.Sprintf("%s must not include %q in securityContext.capabilities.add", fmt.Sprintf("container %q", container.Name), capability))
+			}
+		}
+	}
+	if len(added) > 0 {
+		violations = append(violations, fmt.Sprintf("non-default capabilities (%s)", strings.Join(added, "; ")))
+	}
+
+	var hostPaths []string
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			hostPaths = append(hostPaths, volume.Name)
+		}
+	}
+	if len(hostPaths) > 0 {
+		violations = append(violations, fmt.Sprintf("hostPath volumes (%s)", quotedNames("volume", "volumes", hostPaths)))
+	}
+
+	var hostPorts []string
+	for _, container := range containers {
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				hostPorts = append(hostPorts, fmt.Sprintf("%s uses hostPort %d", fmt.Sprintf("container %q", container.Name), port.HostPort))
+			}
+		}
+	}
+	if len(hostPorts) > 0 {
+		violations = append(violations, fmt.Sprintf("hostPort (%s)", strings.Join(hostPorts, "; ")))
+	}
+
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return context.ProcMount != nil && *context.ProcMount != corev1.DefaultProcMount
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("procMount (%s must not set securityContext.procMount to \"Unmasked\")", quotedNames("container", "containers", names)))
+	}
+
+	seLinuxAllowed := func(options *corev1.SELinuxOptions) bool {
+		return options == nil || (baselineSELinuxTypes[options.Type] && options.User == "" && options.Role == "")
+	}
+	if !seLinuxAllowed(podContext.SELinuxOptions) {
+		violations = append(violations, "seLinuxOptions (pod set forbidden securityContext.seLinuxOptions)")
+	}
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return !seLinuxAllowed(context.SELinuxOptions)
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("seLinuxOptions (%s set forbidden securityContext.seLinuxOptions)", quotedNames("container", "containers", names)))
+	}
+
+	unconfinedSeccomp := func(profile *corev1.SeccompProfile) bool {
+		return profile != nil && profile.Type == corev1.SeccompProfileTypeUnconfined
+	}
+	if unconfinedSeccomp(podContext.SeccompProfile) {
+		violations = append(violations, "seccompProfile (pod must not set securityContext.seccompProfile.type to \"Unconfined\")")
+	}
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return unconfinedSeccomp(context.SeccompProfile)
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("seccompProfile (%s must not set securityContext.seccompProfile.type to \"Unconfined\")", quotedNames("container", "containers", names)))
+	}
+
+	unconfinedAppArmor := func(profile *corev1.AppArmorProfile) bool {
+		return profile != nil && profile.Type == corev1.AppArmorProfileTypeUnconfined
+	}
+	if unconfinedAppArmor(podContext.AppArmorProfile) {
+		violations = append(violations, "appArmorProfile (pod must not set securityContext.appArmorProfile.type to \"Unconfined\")")
+	}
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return unconfinedAppArmor(context.AppArmorProfile)
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("appArmorProfile (%s must not set securityContext.appArmorProfile.type to \"Unconfined\")", quotedNames("container", "containers", names)))
+	}
+
+	var sysctls []string
+	for _, sysctl := range podContext.Sysctls {
+		if !safeSysctls[sysctl.Name] {
+			sysctls = append(sysctls, sysctl.Name)
+		}
+	}
+	if len(sysctls) > 0 {
+		violations = append(violations, fmt.Sprintf("forbidden sysctls (%s)", strings.Join(sysctls, ", ")))
+	}
+
+	if level != podSecurityRestricted {
+		return violations
+	}
+
+	// Restricted
+	var restrictedVolumes []string
+	for _, volume := range pod.Spec.Volumes {
+		source := volume.VolumeSource
+		switch {
+		case source.ConfigMap != nil, source.CSI != nil, source.DownwardAPI != nil, source.EmptyDir != nil,
+			source.Ephemeral != nil, source.PersistentVolumeClaim != nil, source.Projected != nil, source.Secret != nil,
+			source.HostPath != nil: // Already reported by baseline
+			continue
+		}
+		restrictedVolumes = append(restrictedVolumes, volume.Name)
+	}
+	if len(restrictedVolumes) > 0 {
+		violations = append(violations, fmt.Sprintf("restricted volume types (%s)", quotedNames("volume", "volumes", restrictedVolumes)))
+	}
+
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return context.AllowPrivilegeEscalation == nil || *context.AllowPrivilegeEscalation
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("allowPrivilegeEscalation != false (%s must set securityContext.allowPrivilegeEscalation=false)", quotedNames("container", "containers", names)))
+	}
+
+	podNonRoot := podContext.RunAsNonRoot != nil && *podContext.RunAsNonRoot
+	if podContext.RunAsNonRoot != nil && !*podContext.RunAsNonRoot {
+		violations = append(violations, "runAsNonRoot != true (pod must not set securityContext.runAsNonRoot=false)")
+	}
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		if context.RunAsNonRoot != nil {
+			return !*context.RunAsNonRoot
+		}
+		return !podNonRoot
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("runAsNonRoot != true (pod or %s must set securityContext.runAsNonRoot=true)", quotedNames("container", "containers", names)))
+	}
+
+	if podContext.RunAsUser != nil && *podContext.RunAsUser == 0 {
+		violations = append(violations, "runAsUser=0 (pod must not set runAsUser=0)")
+	}
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		return context.RunAsUser != nil && *context.RunAsUser == 0
+	}); len(names) > 0 {
+		violations = append(violations, fmt.Sprintf("runAsUser=0 (%s must not set runAsUser=0)", quotedNames("container", "containers", names)))
+	}
+
+	confinedSeccomp := func(profile *corev1.SeccompProfile) bool {
+		return profile != nil && (profile.Type == corev1.SeccompProfileTypeRuntimeDefault || profile.Type == corev1.SeccompProfileTypeLocalhost)
+	}
+	if !confinedSeccomp(podContext.SeccompProfile) {
+		if names := containersWhere(func(context *corev1.SecurityContext) bool {
+			return !confinedSeccomp(context.SeccompProfile) && !unconfinedSeccomp(context.SeccompProfile)
+		}); len(names) > 0 {
+			violations = append(violations, fmt.Sprintf("seccompProfile (pod or %s must set securityContext.seccompProfile.type to \"RuntimeDefault\" or \"Localhost\")", quotedNames("container", "containers", names)))
+		}
+	}
+
+	var capabilities []string
+	if names := containersWhere(func(context *corev1.SecurityContext) bool {
+		if context.Capabilities != nil {
+			for _, capability := range context.Capabilities.Drop {
+				if capability == "ALL" {
+					return false
+				}
+			}
+		}
+		return true
+	}); len(names) > 0 {
+		capabilities = append(capabilities, fmt.Sprintf("%s must set securityContext.capabilities.drop=[\"ALL\"]", quotedNames("container", "containers", names)))
+	}
+	for _, container := range containers {
+		if container.SecurityContext == nil || container.SecurityContext.Capabilities == nil {
+			continue
+		}
+		var forbidden []string
+		for _, capability := range container.SecurityContext.Capabilities.Add {
+			// Capabilities outside of the baseline set are already reported
+			if capability != "NET_BIND_SERVICE" && baselineCapabilities[capability] {
+				forbidden = append(forbidden, string(capability))
+			}
+		}
+		if len(forbidden) > 0 {
+			sort.Strings(forbidden)
+			capabilities = append(capabilities, fmt.Sprintf("%s must not include %s in securityContext.capabilities.add",
+				fmt.Sprintf("container %q", container.Name), quoteAll(forbidden)))
+		}
+	}
+	if len(capabilities) > 0 {
+		violations = append(violations, fmt.Sprintf("unrestricted capabilities (%s)", strings.Join(capabilities, "; ")))
+	}
+	return violations
+}
@@ -0,0 +1,375 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// projectResource and namespaceResource name projects and namespaces in API errors
+var (
+	projectResource   = schema.GroupResource{Group: "project.openshift.io", Resource: "projects"}
+	namespaceResource = schema.GroupResource{Resource: "namespaces"}
+)
+
+// oapiDeprecationWarning is the warning of the requests to the legacy /oapi/v1 API, which
+// kubectl and oc print to steer users to the project.openshift.io group
+const oapiDeprecationWarning = "the legacy /oapi/v1 API is deprecated, use project.openshift.io/v1 projects at /apis/project.openshift.io/v1/projects instead"
+
+// deprecatedOAPI serves a route of the legacy /oapi/v1 API with the handler of its
+// project.openshift.io/v1 counterpart and a deprecation warning
+func deprecatedOAPI(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addWarning(w, oapiDeprecationWarning)
+		handler(w, r)
+	}
+}
+
+// handleOAPINotFound answers the GET requests to the paths of the legacy /oapi API that
+// podKube does not serve, every resource but projects, with a NotFound Status rather than the
+// plain text 404 of the mux, and the deprecation warning
+func (s *Server) handleOAPINotFound(w http.ResponseWriter, r *http.Request) {
+	addWarning(w, oapiDeprecationWarning)
+	s.writeStatusError(w, &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotFound,
+		Reason:  metav1.StatusReasonNotFound,
+		Message: fmt.Sprintf("the server could not find the requested resource (get %s)", r.URL.Path),
+	}})
+}
+
+// projectToNamespace returns the namespace of a project
+func projectToNamespace(project *storage.Project) corev1.Namespace {
+	finalizers := make([]corev1.FinalizerName, len(project.Spec.Finalizers))
+	for i, finalizer := range project.Spec.Finalizers {
+		finalizers[i] = corev1.FinalizerName(finalizer)
+	}
+	namespace := corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		Spec: corev1.NamespaceSpec{Finalizers: finalizers},
+		Status: corev1.NamespaceStatus{
+			Phase:      corev1.NamespacePhase(project.Status.Phase),
+			Conditions: project.Status.Conditions,
+		},
+	}
+	project.ObjectMeta.DeepCopyInto(&namespace.ObjectMeta)
+	return namespace
+}
+
+// getProject returns the project of a namespace, writing a 404 when there is none
+func (s *Server) getProject(w http.ResponseWriter, resource schema.GroupResource, name string) (*storage.Project, bool) {
+	project, err := s.podStorage.GetProject(name)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewNotFound(resource, name))
+		return nil, false
+	}
+	return project, true
+}
+
+// writeProject writes a project, or its table when requested
+func (s *Server) writeProject(w http.ResponseWriter, r *http.Request, project *storage.Project) {
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, projectListToTable(&storage.ProjectList{Items: []storage.Project{*project}}, s.namespacePodCounts(r.Context())))
+	} else {
+		s.writeObject(w, r, project)
+	}
+}
+
+// handleNamespaceByName handles GET requests to /api/v1/namespaces/{name}
+func (s *Server) handleNamespaceByName(w http.ResponseWriter, r *http.Request, name string) {
+	project, ok := s.getProject(w, namespaceResource, name)
+	if !ok {
+		return
+	}
+	s.podStorage.AnnotateProjectStatus(r.Context(), project)
+	namespace := projectToNamespace(project)
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, namespaceListToTable(&corev1.NamespaceList{Items: []corev1.Namespace{namespace}}, s.namespacePodCounts(r.Context())))
+	} else {
+		s.writeObject(w, r, &namespace)
+	}
+}
+
+// updateProject replaces a project from a PUT request
+func (s *Server) updateProject(w http.ResponseWriter, r *http.Request, name string) {
+	var project storage.Project
+	if err := decodeBody(w, r, &project); err != nil {
+		s.writeDecodeError(w, "project", err)
+		return
+	}
+	s.replaceProject(w, r, name, &project)
+}
+
+// patchProject applies a JSON, merge or strategic merge patch to a project
+func (s *Server) patchProject(w http.ResponseWriter, r *http.Request, name string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	current, ok := s.getProject(w, projectResource, name)
+	if !ok {
+		return
+	}
+	original, err := json.Marshal(current)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	patched, err := applyPatch(r.Header.Get("Content-Type"), original, patch)
+	if err != nil {
+		s.writeDecodeError(w, "patch", err)
+		return
+	}
+	var project storage.Project
+	if err := json.Unmarshal(patched, &project); err != nil {
+		s.writeDecodeError(w, "patched project", err)
+		return
+	}
+	// As for pods, only the patches setting the resourceVersion conflict with later updates
+	if project.ResourceVersion == current.ResourceVersion && !patchSetsResourceVersion(r.Header.Get("Content-Type"), patch) {
+		project.ResourceVersion = ""
+	}
+	s.replaceProject(w, r, name, &project)
+}
+
+// replaceProject updates a project with its new version from a PUT or PATCH request
+func (s *Server) replaceProject(w http.ResponseWriter, r *http.Request, name string, project *storage.Project) {
+	if updated, ok := s.updateProjectMetadata(w, r, projectResource, "Project", name, &project.ObjectMeta); ok {
+		s.writeProject(w, r, updated)
+	}
+}
+
+// updateNamespace replaces a namespace from a PUT request
+func (s *Server) updateNamespace(w http.ResponseWriter, r *http.Request, name string) {
+	var namespace corev1.Namespace
+	if err := decodeBody(w, r, &namespace); err != nil {
+		s.writeDecodeError(w, "namespace", err)
+		return
+	}
+	s.replaceNamespace(w, r, name, &namespace)
+}
+
+// patchNamespace applies a JSON, merge or strategic merge patch to a namespace, as kubectl
+// label and annotate do
+func (s *Server) patchNamespace(w http.ResponseWriter, r *http.Request, name string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	project, ok := s.getProject(w, namespaceResource, name)
+	if !ok {
+		return
+	}
+	current := projectToNamespace(project)
+	original, err := json.Marshal(&current)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	patched, err := applyPatch(r.Header.Get("Content-Type"), original, patch)
+	if err != nil {
+		s.writeDecodeError(w, "patch", err)
+		return
+	}
+	var namespace corev1.Namespace
+	if err := json.Unmarshal(patched, &namespace); err != nil {
+		s.writeDecodeError(w, "patched namespace", err)
+		return
+	}
+	if namespace.ResourceVersion == current.ResourceVersion && !patchSetsResourceVersion(r.Header.Get("Content-Type"), patch) {
+		namespace.ResourceVersion = ""
+	}
+	s.replaceNamespace(w, r, name, &namespace)
+}
+
+// replaceNamespace updates a namespace with its new version from a PUT or PATCH request
+func (s *Server) replaceNamespace(w http.ResponseWriter, r *http.Request, name string, namespace *corev1.Namespace) {
+	if updated, ok := s.updateProjectMetadata(w, r, namespaceResource, "Namespace", name, &namespace.ObjectMeta); ok {
+		updatedNamespace := projectToNamespace(updated)
+		s.writeObject(w, r, &updatedNamespace)
+	}
+}
+
+// updateProjectMetadata updates the metadata of a project, or of its namespace, with its new
+// version from a PUT or PATCH request, writing the error when it fails. Only the annotations
+// and the Pod Security Standards labels of projects can change, such as
+// openshift.io/display-name and pod-security.kubernetes.io/enforce; the requester of a project
+// is kept, or set to the user first changing them.
+func (s *Server) updateProjectMetadata(w http.ResponseWriter, r *http.Request, resource schema.GroupResource, kind, name string, meta *metav1.ObjectMeta) (*storage.Project, bool) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return nil, false
+	}
+	if meta.Name != name {
+		s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("the name of the %s does not match the URL", strings.ToLower(kind))))
+		return nil, false
+	}
+	current, ok := s.getProject(w, resource, name)
+	if !ok {
+		return nil, false
+	}
+	if meta.ResourceVersion != "" {
+		preconditions := &metav1.Preconditions{ResourceVersion: &meta.ResourceVersion}
+		if statusErr := checkPreconditions(resource.Resource, name, preconditions, current); statusErr != nil {
+			s.writeStatusError(w, statusErr)
+			return nil, false
+		}
+	}
+
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	if _, ok := meta.Annotations[storage.RequesterAnnotation]; !ok {
+		if requester, ok := current.Annotations[storage.RequesterAnnotation]; ok {
+			meta.Annotations[storage.RequesterAnnotation] = requester
+		} else if user := requestUser(r).Username; user != "" {
+			meta.Annotations[storage.RequesterAnnotation] = user
+		}
+	}
+
+	errs := validateObjectMeta(meta, &current.ObjectMeta)
+	if !reflect.DeepEqual(withoutPodSecurityLabels(meta.Labels), withoutPodSecurityLabels(current.Labels)) {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "labels"), "only the annotations and the "+podSecurityLabelPrefix+" labels of projects can be changed"))
+	}
+	errs = append(errs, validatePodSecurityLabels(meta.Labels, field.NewPath("metadata", "labels"))...)
+	if len(errs) > 0 {
+		s.writeStatusError(w, apierrors.NewInvalid(schema.GroupKind{Group: resource.Group, Kind: kind}, name, errs))
+		return nil, false
+	}
+
+	if dryRun {
+		updated := current.DeepCopy()
+		updated.Labels = meta.Labels
+		updated.Annotations = meta.Annotations
+		return updated, true
+	}
+	updated, err := s.podStorage.UpdateProjectMetadata(name, meta.ResourceVersion, meta.Labels, meta.Annotations)
+	if errors.Is(err, storage.ErrConflict) {
+		s.writeStatusError(w, apierrors.NewConflict(resource, name, err))
+		return nil, false
+	}
+	if err != nil {
+		klog.Errorf("Failed to update project %s: %v", name, err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return nil, false
+	}
+	return updated, true
+}
+
+// withoutPodSecurityLabels returns the labels other than those of the Pod Security Standards
+func withoutPodSecurityLabels(labels map[string]string) map[string]string {
+	other := map[string]string{}
+	for key, value := range labels {
+		if !strings.HasPrefix(key, podSecurityLabelPrefix) {
+			other[key] = value
+		}
+	}
+	return other
+}
+
+// deleteProject starts the deletion of the namespace of a project, as oc delete project does
+func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request, name string) {
+	if _, ok := s.startNamespaceDeletion(w, r, projectResource, name); !ok {
+		return
+	}
+	s.writeObject(w, r, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusSuccess,
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf(`project "%s" deleted`, name),
+		Details: &metav1.StatusDetails{Name: name, Group: projectResource.Group, Kind: projectResource.Resource},
+	})
+}
+
+// deleteNamespace starts the deletion of a namespace and returns it, terminating
+func (s *Server) deleteNamespace(w http.ResponseWriter, r *http.Request, name string) {
+	project, ok := s.startNamespaceDeletion(w, r, namespaceResource, name)
+	if !ok {
+		return
+	}
+	namespace := projectToNamespace(project)
+	s.writeObject(w, r, &namespace)
+}
+
+// startNamespaceDeletion marks a namespace as terminating, once its preconditions are checked;
+// its pods are then deleted in the background, and a dry run deletes nothing
+func (s *Server) startNamespaceDeletion(w http.ResponseWriter, r *http.Request, resource schema.GroupResource, name string) (*storage.Project, bool) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return nil, false
+	}
+	options, err := decodeDeleteOptions(w, r)
+	if err != nil {
+		s.writeDecodeError(w, "delete options", err)
+		return nil, false
+	}
+	project, ok := s.getProject(w, resource, name)
+	if !ok {
+		return nil, false
+	}
+	if statusErr := checkPreconditions(resource.Resource, name, options.Preconditions, project); statusErr != nil {
+		s.writeStatusError(w, statusErr)
+		return nil, false
+	}
+	if dryRun || len(options.DryRun) > 0 {
+		return project, true
+	}
+
+	project, err = s.podStorage.DeleteNamespace(name)
+	if err != nil {
+		klog.Errorf("Failed to delete namespace %s: %v", name, err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return nil, false
+	}
+	klog.Infof("Deleting namespace %s and its pods", name)
+	return project, true
+}
+
+// SetStateDir loads the state podKube owns, which has no podman representation, from
+// stateDir, where its changes are then saved, encrypted at rest as the EncryptionConfiguration
+// file encryptionConfig sets: the annotations and deletions of namespaces, the finalizers,
+// label and annotation changes and deletions of pods, and the routes. An empty stateDir keeps
+// them in memory.
+func (s *Server) SetStateDir(stateDir, encryptionConfig string) error {
+	encryption, err := storage.LoadEncryptionConfig(encryptionConfig)
+	if err != nil {
+		return err
+	}
+	path := func(name string) string {
+		if stateDir == "" {
+			return ""
+		}
+		return filepath.Join(stateDir, name)
+	}
+	if err := s.podStorage.SetNamespaceStateFile(path("namespaces.json"), encryption); err != nil {
+		return err
+	}
+	if err := s.podStorage.SetPodStateFile(path("pods.json"), encryption); err != nil {
+		return err
+	}
+	return s.routes.load(storage.StateFile{Path: path("routes.json"), Resource: "routes." + routeGroup, Encryption: encryption})
+}
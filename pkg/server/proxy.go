@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// defaultProxyPort is the pod port proxied to when the request names none and the pod declares none
+const defaultProxyPort = 80
+
+// proxyIdleConnTimeout is how long an idle connection to a pod is kept for the next proxy request
+const proxyIdleConnTimeout = 90 * time.Second
+
+// containerIPFormat lists the IP addresses of a container, in podman and docker inspect output
+const containerIPFormat = "{{range .NetworkSettings.Networks}}{{.IPAddress}} {{end}}{{.NetworkSettings.IPAddress}}"
+
+// handlePodProxy handles pod proxy requests: /api/v1/namespaces/{namespace}/pods/{[scheme:]name[:port]}/proxy[/{path}].
+// The request is forwarded to the pod IP, as read from the container runtime, so it only
+// reaches pods whose network is reachable from the adapter (rootful podman and docker on
+// the local node, or a published host port).
+func (s *Server) handlePodProxy(w http.ResponseWriter, r *http.Request, namespace, id, path string) {
+	if s.rejectIfShuttingDown(w) {
+		return
+	}
+	defer s.beginSession()()
+
+	scheme, name, port, valid := utilnet.SplitSchemeNamePort(id)
+	if !valid {
+		s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid request %q", id)))
+		return
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	pod, err := s.podStorage.Get(r.Context(), namespace, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else {
+			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
+		}
+		return
+	}
+
+	address, err := s.podProxyAddress(r, pod, port)
+	if err != nil {
+		klog.Errorf("Failed to proxy to pod %s/%s: %v", namespace, name, err)
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		return
+	}
+	klog.V(2).Infof("Proxying %s %s to pod %s/%s at %s://%s", r.Method, path, namespace, name, scheme, address)
+	s.reverseProxy(scheme, address, path, "pod "+name).ServeHTTP(w, r)
+}
+
+// reverseProxy returns the proxy forwarding requests to path at scheme://address, for the pod
+// and service proxies; target names what is proxied to in errors
+func (s *Server) reverseProxy(scheme, address, path, target string) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(request *httputil.ProxyRequest) {
+			request.Out.URL.Scheme = scheme
+			request.Out.URL.Host = address
+			request.Out.URL.Path = path
+			request.Out.URL.RawPath = ""
+			request.Out.Host = address
+			// The credentials of the API client are not for the target
+			request.Out.Header.Del("Authorization")
+		},
+		Transport: s.proxyTransport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			klog.Errorf("Failed to proxy to %s: %v", target, err)
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(fmt.Sprintf("error trying to reach %s: %v", target, err)))
+		},
+	}
+}
+
+// podProxyAddress returns the host:port a proxy request to a pod port goes to: the host port
+// the container port is published on for pods of the local node, the pod IP otherwise. An
+// empty port selects the first port declared by the pod.
+func (s *Server) podProxyAddress(r *http.Request, pod *corev1.Pod, port string) (string, error) {
+	containerPort := 0
+	var published *corev1.ContainerPort
+	for _, container := range pod.Spec.Containers {
+		for i := range container.Ports {
+			declared := &container.Ports[i]
+			if port == "" && containerPort == 0 || port == declared.Name || port == strconv.Itoa(int(declared.ContainerPort)) {
+				containerPort = int(declared.ContainerPort)
+				published = declared
+			}
+		}
+	}
+	if containerPort == 0 {
+		if port == "" {
+			containerPort = defaultProxyPort
+		} else if number, err := strconv.Atoi(port); err == nil && number > 0 && number < 65536 {
+			containerPort = number
+		} else {
+			return "", fmt.Errorf("pod %s has no port named %q", pod.Name, port)
+		}
+	}
+
+	if node, ok := s.podStorage.Node(pod.Spec.NodeName); ok && node.Connection == "" && published != nil && published.HostPort != 0 {
+		hostIP := published.HostIP
+		if hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::" {
+			hostIP = "127.0.0.1"
+		}
+		return net.JoinHostPort(hostIP, strconv.Itoa(int(published.HostPort))), nil
+	}
+
+	container, err := runtimeContainer(pod, "")
+	if err != nil {
+		return "", err
+	}
+	args := s.podStorage.CommandLine(pod.Spec.NodeName, "inspect", "--format", containerIPFormat, container)
+	output, err := exec.CommandContext(r.Context(), args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the IP of pod %s: %v", pod.Name, err)
+	}
+	ips := strings.Fields(string(output))
+	if len(ips) == 0 {
+		return "", fmt.Errorf("pod %s has no IP address", pod.Name)
+	}
+	return net.JoinHostPort(ips[0], strconv.Itoa(containerPort)), nil
+}
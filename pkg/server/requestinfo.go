@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequestInfo holds the Kubernetes attributes of an API request, derived from its URL and method
+type RequestInfo struct {
+	IsResourceRequest bool
+	Verb              string
+	APIGroup          string
+	APIVersion        string
+	Namespace         string
+	Resource          string
+	Name              string
+	Subresource       string
+}
+
+// parseRequestInfo resolves the verb and resource coordinates of a request.
+// Supported layouts:
+//
+//	/api/{version}/{resource}[/{name}[/{subresource}]]
+//	/api/{version}/namespaces/{namespace}/{resource}[/{name}[/{subresource}]]
+//	/apis/{group}/{version}/... (same as above)
+//	/oapi/{version}/... (legacy OpenShift, same as above)
+func parseRequestInfo(r *http.Request) *RequestInfo {
+	info := &RequestInfo{
+		Verb: strings.ToLower(r.Method),
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		return info
+	}
+
+	switch parts[0] {
+	case "api", "oapi":
+		info.APIVersion = parts[1]
+		parts = parts[2:]
+	case "apis":
+		if len(parts) < 4 {
+			return info
+		}
+		info.APIGroup = parts[1]
+		info.APIVersion = parts[2]
+		parts = parts[3:]
+	default:
+		return info
+	}
+
+	info.IsResourceRequest = true
+
+	// namespaces/{namespace}/{resource}/... addresses a namespaced resource,
+	// while namespaces[/{name}] addresses the namespace object itself
+	if parts[0] == "namespaces" && len(parts) >= 3 {
+		info.Namespace = parts[1]
+		parts = parts[2:]
+	}
+
+	info.Resource = parts[0]
+	if len(parts) >= 2 {
+		info.Name = parts[1]
+	}
+	if len(parts) >= 3 {
+		info.Subresource = parts[2]
+	}
+	if info.Resource == "namespaces" && info.Name != "" {
+		info.Namespace = info.Name
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if r.URL.Query().Get("watch") == "true" {
+			info.Verb = "watch"
+		} else if info.Name == "" {
+			info.Verb = "list"
+		} else {
+			info.Verb = "get"
+		}
+	case http.MethodPost:
+		info.Verb = "create"
+	case http.MethodPut:
+		info.Verb = "update"
+	case http.MethodPatch:
+		info.Verb = "patch"
+	case http.MethodDelete:
+		if info.Name == "" {
+			info.Verb = "deletecollection"
+		} else {
+			info.Verb = "delete"
+		}
+	}
+
+	return info
+}
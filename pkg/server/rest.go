@@ -0,0 +1,444 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// restStorage is the storage of a resource served by the generic REST handlers. A storage
+// implements the verb interfaces below for the verbs its resource supports, and only those
+// verbs are routed. Errors are reported as they are when they are API status errors
+// (apierrors.NewNotFound...), as 503 for storage.ErrPodmanUnavailable and as 500 otherwise.
+type restStorage interface {
+	// New returns an empty object of the resource, to decode request bodies into
+	New() runtime.Object
+}
+
+// restGetter returns an object by name; namespace is empty for cluster-scoped resources
+type restGetter interface {
+	Get(ctx context.Context, namespace, name string) (runtime.Object, error)
+}
+
+// restLister returns the list of the objects of a namespace, of every namespace when empty
+type restLister interface {
+	List(ctx context.Context, namespace string) (runtime.Object, error)
+}
+
+// restCreater creates an object, already named and placed in its namespace, or only
+// validates its creation on a dry run
+type restCreater interface {
+	Create(ctx context.Context, obj runtime.Object, dryRun bool) (runtime.Object, error)
+}
+
+// restUpdater replaces an object, or only validates the update on a dry run
+type restUpdater interface {
+	Update(ctx context.Context, obj runtime.Object, dryRun bool) (runtime.Object, error)
+}
+
+// restDeleter deletes an object by name
+type restDeleter interface {
+	Delete(ctx context.Context, namespace, name string) error
+}
+
+// restWatcher watches the objects of a namespace, of every namespace when empty
+type restWatcher interface {
+	Watch(ctx context.Context, namespace string) (watch.Interface, error)
+}
+
+// restValidator validates the fields of an object beyond its metadata, which the handlers
+// validate for every resource; old is the current object on updates and nil on creates
+type restValidator interface {
+	Validate(obj, old runtime.Object) field.ErrorList
+}
+
+// restTableConvertor converts an object or a list to the table kubectl and oc print
+type restTableConvertor interface {
+	ConvertToTable(obj runtime.Object) *metav1.Table
+}
+
+// restScaler reads and sets the replicas of an object through its scale subresource, for the
+// workload resources; the scale of an update is already named and placed in its namespace
+type restScaler interface {
+	GetScale(ctx context.Context, namespace, name string) (*autoscalingv1.Scale, error)
+	UpdateScale(ctx context.Context, scale *autoscalingv1.Scale, dryRun bool) (*autoscalingv1.Scale, error)
+}
+
+// restResource is a resource served by the generic REST handlers
+type restResource struct {
+	Resource   schema.GroupResource
+	Kind       string // Kind of the objects, which items of created lists are dispatched on
+	Namespaced bool
+	Storage    restStorage
+}
+
+// restHandler serves the verbs of a resource from its storage
+type restHandler struct {
+	server   *Server
+	resource restResource
+}
+
+// registerREST routes the verbs implemented by the storage of a resource under prefix
+// (/api/v1, /apis/{group}/{version}): the collection, the objects by name and, for namespaced
+// resources, the collections of each namespace, and the scale subresource of the objects of
+// scalable resources
+func (s *Server) registerREST(rt *router, prefix string, resource restResource) {
+	h := &restHandler{server: s, resource: resource}
+	if s.restHandlers == nil {
+		s.restHandlers = map[string]*restHandler{}
+	}
+	s.restHandlers[resource.Kind] = h
+
+	collections := []string{prefix + "/" + resource.Resource.Resource}
+	object := prefix + "/" + resource.Resource.Resource + "/{name}"
+	if resource.Namespaced {
+		collections = append(collections, prefix+"/namespaces/{namespace}/"+resource.Resource.Resource)
+		object = prefix + "/namespaces/{namespace}/" + resource.Resource.Resource + "/{name}"
+	}
+
+	storage := resource.Storage
+	for _, collection := range collections {
+		if _, ok := storage.(restLister); ok {
+			rt.handle(collection, namespaced(h.list), http.MethodGet)
+			if _, ok := storage.(restWatcher); ok {
+				rt.watchable(collection)
+			}
+		}
+		if _, ok := storage.(restCreater); ok {
+			rt.handle(collection, namespaced(func(w http.ResponseWriter, r *http.Request, namespace string) {
+				s.createObjects(w, r, namespace, func(w http.ResponseWriter, r *http.Request) { h.create(w, r, namespace) })
+			}), http.MethodPost)
+		}
+	}
+	if _, ok := storage.(restGetter); ok {
+		rt.handle(object, namespacedName(h.get), http.MethodGet)
+	}
+	if _, ok := storage.(restUpdater); ok {
+		rt.handle(object, namespacedName(h.update), http.MethodPut)
+	}
+	if _, ok := storage.(restDeleter); ok {
+		rt.handle(object, namespacedName(h.delete), http.MethodDelete)
+	}
+	if _, ok := storage.(restScaler); ok {
+		rt.handle(object+"/scale", namespacedName(h.getScale), http.MethodGet)
+		rt.handle(object+"/scale", namespacedName(h.updateScale), http.MethodPut)
+		rt.handle(object+"/scale", namespacedName(h.patchScale), http.MethodPatch)
+	}
+}
+
+// get serves an object, as a table when requested
+func (h *restHandler) get(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	obj, err := h.resource.Storage.(restGetter).Get(r.Context(), namespace, name)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	h.writeObject(w, r, http.StatusOK, obj)
+}
+
+// list serves a collection, filtered by the labelSelector parameter, or watches it
+func (h *restHandler) list(w http.ResponseWriter, r *http.Request, namespace string) {
+	if r.URL.Query().Get("watch") == "true" {
+		h.watch(w, r, namespace)
+		return
+	}
+
+	selector, err := labels.Parse(r.URL.Query().Get("labelSelector"))
+	if err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid labelSelector: %v", err)))
+		return
+	}
+
+	list, err := h.resource.Storage.(restLister).List(r.Context(), namespace)
+	if err != nil {
+		h.writeError(w, "", err)
+		return
+	}
+	if !selector.Empty() {
+		if err := filterList(list, selector); err != nil {
+			h.writeError(w, "", err)
+			return
+		}
+	}
+	h.writeObject(w, r, http.StatusOK, list)
+}
+
+// filterList keeps the items of a list whose labels match selector
+func filterList(list runtime.Object, selector labels.Selector) error {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	matching := []runtime.Object{}
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if selector.Matches(labels.Set(accessor.GetLabels())) {
+			matching = append(matching, item)
+		}
+	}
+	return meta.SetList(list, matching)
+}
+
+// watch streams the changes of a collection as watch events
+func (h *restHandler) watch(w http.ResponseWriter, r *http.Request, namespace string) {
+	watcher, ok := h.resource.Storage.(restWatcher)
+	if !ok {
+		h.server.writeStatusError(w, apierrors.NewMethodNotSupported(h.resource.Resource, "watch"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := watcher.Watch(r.Context(), namespace)
+	if err != nil {
+		h.writeError(w, "", err)
+		return
+	}
+	defer events.Stop()
+
+	w.Header().Set("Content-Type", "application/json;stream=watch")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events.ResultChan():
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(&metav1.WatchEvent{Type: string(event.Type), Object: runtime.RawExtension{Object: event.Object}}); err != nil {
+				klog.V(4).Infof("Failed to write %s watch event: %v", h.resource.Resource, err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// create decodes an object from the request body and creates it in the namespace of the URL
+func (h *restHandler) create(w http.ResponseWriter, r *http.Request, namespace string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	obj, objectMeta, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if h.resource.Namespaced && objectMeta.Namespace == "" {
+		objectMeta.Namespace = namespace
+	}
+	generated := objectMeta.Name == ""
+	if err := assignName(objectMeta); err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if namespace != "" && objectMeta.Namespace != namespace {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("%s namespace does not match URL namespace", h.resource.Kind)))
+		return
+	}
+	if statusErr := h.validate(obj, objectMeta, nil); statusErr != nil {
+		h.server.writeStatusError(w, statusErr)
+		return
+	}
+
+	var created runtime.Object
+	for attempt := 1; ; attempt++ {
+		created, err = h.resource.Storage.(restCreater).Create(r.Context(), obj, dryRun)
+		if !retryGeneratedName(objectMeta, generated, attempt, err) {
+			break
+		}
+	}
+	if err != nil {
+		h.writeError(w, objectMeta.Name, err)
+		return
+	}
+	h.writeObject(w, r, http.StatusCreated, created)
+}
+
+// update decodes an object from the request body and replaces the object of the URL with it
+func (h *restHandler) update(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	obj, objectMeta, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	if h.resource.Namespaced && objectMeta.Namespace == "" {
+		objectMeta.Namespace = namespace
+	}
+	if objectMeta.Name != name || objectMeta.Namespace != namespace {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("the name and namespace of the %s do not match the URL", h.resource.Kind)))
+		return
+	}
+	if getter, ok := h.resource.Storage.(restGetter); ok {
+		current, err := getter.Get(r.Context(), namespace, name)
+		if err != nil {
+			h.writeError(w, name, err)
+			return
+		}
+		if statusErr := h.validate(obj, objectMeta, current); statusErr != nil {
+			h.server.writeStatusError(w, statusErr)
+			return
+		}
+	}
+
+	updated, err := h.resource.Storage.(restUpdater).Update(r.Context(), obj, dryRun)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	h.writeObject(w, r, http.StatusOK, updated)
+}
+
+// delete deletes the object of the URL, once its preconditions are checked against the
+// current object; a dry run only checks that it exists
+func (h *restHandler) delete(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	options, err := decodeDeleteOptions(w, r)
+	if err != nil {
+		h.server.writeDecodeError(w, "delete options", err)
+		return
+	}
+	dryRun = dryRun || len(options.DryRun) > 0
+
+	if getter, ok := h.resource.Storage.(restGetter); ok && (dryRun || options.Preconditions != nil) {
+		current, err := getter.Get(r.Context(), namespace, name)
+		if err != nil {
+			h.writeError(w, name, err)
+			return
+		}
+		accessor, err := meta.Accessor(current)
+		if err != nil {
+			h.writeError(w, name, err)
+			return
+		}
+		if statusErr := checkPreconditions(h.resource.Resource.Resource, name, options.Preconditions, accessor); statusErr != nil {
+			h.server.writeStatusError(w, statusErr)
+			return
+		}
+	}
+	if !dryRun {
+		if err := h.resource.Storage.(restDeleter).Delete(r.Context(), namespace, name); err != nil {
+			h.writeError(w, name, err)
+			return
+		}
+	}
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status:  metav1.StatusSuccess,
+		Code:    http.StatusOK,
+		Message: fmt.Sprintf(`%s "%s" deleted`, strings.ToLower(h.resource.Kind), name),
+	}
+	h.server.writeObject(w, r, status)
+}
+
+// decode decodes the object of a request body, reporting decoding errors
+func (h *restHandler) decode(w http.ResponseWriter, r *http.Request) (runtime.Object, *metav1.ObjectMeta, bool) {
+	obj := h.resource.Storage.New()
+	if err := decodeBody(w, r, obj); err != nil {
+		h.server.writeDecodeError(w, strings.ToLower(h.resource.Kind), err)
+		return nil, nil, false
+	}
+	// meta.Accessor returns the object itself; the ObjectMeta it embeds is reached through
+	// the promoted GetObjectMeta
+	accessor, ok := obj.(metav1.ObjectMetaAccessor)
+	if !ok {
+		h.writeError(w, "", fmt.Errorf("%T has no ObjectMeta", obj))
+		return nil, nil, false
+	}
+	objectMeta, ok := accessor.GetObjectMeta().(*metav1.ObjectMeta)
+	if !ok {
+		h.writeError(w, "", fmt.Errorf("%T has no ObjectMeta", obj))
+		return nil, nil, false
+	}
+	return obj, objectMeta, true
+}
+
+// validate validates the metadata of an object created, or updated from old, and the fields
+// the storage validates, returning every error in a single 422 Invalid Status
+func (h *restHandler) validate(obj runtime.Object, objectMeta *metav1.ObjectMeta, old runtime.Object) *apierrors.StatusError {
+	var oldMeta *metav1.ObjectMeta
+	if old != nil {
+		accessor, err := meta.Accessor(old)
+		if err != nil {
+			return apierrors.NewInternalError(err)
+		}
+		oldMeta = &metav1.ObjectMeta{Labels: accessor.GetLabels(), Annotations: accessor.GetAnnotations(), Finalizers: accessor.GetFinalizers()}
+	}
+	errs := validateObjectMeta(objectMeta, oldMeta)
+	if validator, ok := h.resource.Storage.(restValidator); ok {
+		errs = append(errs, validator.Validate(obj, old)...)
+	}
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(schema.GroupKind{Group: h.resource.Resource.Group, Kind: h.resource.Kind}, objectMeta.Name, errs)
+	}
+	return nil
+}
+
+// writeObject writes an object, or its table when requested and the storage converts tables
+func (h *restHandler) writeObject(w http.ResponseWriter, r *http.Request, statusCode int, obj runtime.Object) {
+	if convertor, ok := h.resource.Storage.(restTableConvertor); ok && strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		table := convertor.ConvertToTable(obj)
+		if list, err := meta.ListAccessor(obj); err == nil {
+			table.ResourceVersion = list.GetResourceVersion()
+		}
+		h.server.writeTable(w, r, table)
+		return
+	}
+	h.server.writeObjectWithStatus(w, r, statusCode, obj)
+}
+
+// writeError reports a storage error as a Kubernetes Status
+func (h *restHandler) writeError(w http.ResponseWriter, name string, err error) {
+	var statusErr *apierrors.StatusError
+	switch {
+	case errors.As(err, &statusErr):
+		h.server.writeStatusError(w, statusErr)
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		h.server.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	default:
+		klog.Errorf("Request for %s %q failed: %v", h.resource.Resource, name, err)
+		h.server.writeStatusError(w, apierrors.NewInternalError(err))
+	}
+}
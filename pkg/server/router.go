@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// router registers handlers per verb on path patterns with path parameters, such as
+// /api/v1/namespaces/{namespace}/pods/{name}, on top of the method and wildcard patterns of
+// http.ServeMux. A request whose path matches a route but not its verbs gets a 405 with an
+// Allow header from the mux, and an OPTIONS request gets the verbs of the path.
+type router struct {
+	mux     *http.ServeMux
+	paths   []string            // Registered path patterns, in registration order
+	methods map[string][]string // Verbs of each path pattern
+	watches map[string]bool     // Collection path patterns whose GET route also serves watches
+}
+
+// newRouter creates a router registering its routes on mux
+func newRouter(mux *http.ServeMux) *router {
+	return &router{
+		mux:     mux,
+		methods: map[string][]string{},
+		watches: map[string]bool{},
+	}
+}
+
+// handle registers handler for the given verbs of a path pattern. A GET route also serves
+// HEAD. Without verbs, the handler serves every verb and answers OPTIONS itself.
+func (rt *router) handle(path string, handler http.HandlerFunc, methods ...string) {
+	if _, ok := rt.methods[path]; !ok {
+		rt.paths = append(rt.paths, path)
+		if len(methods) > 0 {
+			rt.mux.HandleFunc(http.MethodOptions+" "+path, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Allow", strings.Join(append(rt.allowed(path), http.MethodOptions), ", "))
+				w.WriteHeader(http.StatusNoContent)
+			})
+		}
+	}
+
+	if len(methods) == 0 {
+		rt.methods[path] = []string{"*"}
+		rt.mux.HandleFunc(path, handler)
+		return
+	}
+	for _, method := range methods {
+		rt.methods[path] = append(rt.methods[path], method)
+		rt.mux.HandleFunc(method+" "+path, handler)
+	}
+}
+
+// allowed returns the verbs served on a path pattern, HEAD included with GET
+func (rt *router) allowed(path string) []string {
+	methods := slices.Clone(rt.methods[path])
+	if slices.Contains(methods, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+	return methods
+}
+
+// watchable records that the GET route of a collection path pattern also serves watches, with
+// watch=true
+func (rt *router) watchable(path string) {
+	rt.watches[path] = true
+}
+
+// collectionVerbs and objectVerbs are the API verbs of the HTTP verbs on the path of a
+// collection and on the path of an object or subresource
+var (
+	collectionVerbs = map[string]string{
+		http.MethodGet:    "list",
+		http.MethodPost:   "create",
+		http.MethodDelete: "deletecollection",
+	}
+	objectVerbs = map[string]string{
+		http.MethodGet:    "get",
+		http.MethodPost:   "create",
+		http.MethodPut:    "update",
+		http.MethodPatch:  "patch",
+		http.MethodDelete: "delete",
+	}
+)
+
+// verbs returns the API verbs served by the routes of a resource, sorted as kube-apiserver
+// lists them, from the path patterns of its collection and of its objects; a subresource has
+// no collection and the path of its objects is that of the subresource
+func (rt *router) verbs(collection, object string) []string {
+	served := map[string]bool{}
+	for _, route := range []struct {
+		path  string
+		verbs map[string]string
+	}{{collection, collectionVerbs}, {object, objectVerbs}} {
+		for _, method := range rt.methods[route.path] {
+			if method == "*" {
+				for _, verb := range route.verbs {
+					served[verb] = true
+				}
+			} else if verb, ok := route.verbs[method]; ok {
+				served[verb] = true
+			}
+		}
+	}
+	if served["list"] && rt.watches[collection] {
+		served["watch"] = true
+	}
+
+	verbs := make([]string, 0, len(served))
+	for verb := range served {
+		verbs = append(verbs, verb)
+	}
+	sort.Strings(verbs)
+	return verbs
+}
+
+// logRoutes logs every registered route with its verbs
+func (rt *router) logRoutes() {
+	klog.Infof("Registered API routes:")
+	for _, path := range rt.paths {
+		klog.Infof("  %s %s", strings.Join(rt.methods[path], ","), path)
+	}
+}
+
+// namespaced adapts the handler of a namespaced collection to a route with a {namespace}
+// path parameter; on cluster-wide routes, without it, the handler gets an empty namespace
+func namespaced(handler func(w http.ResponseWriter, r *http.Request, namespace string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, r.PathValue("namespace"))
+	}
+}
+
+// namespacedName adapts the handler of a namespaced object to a route with {namespace} and
+// {name} path parameters
+func namespacedName(handler func(w http.ResponseWriter, r *http.Request, namespace, name string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, r.PathValue("namespace"), r.PathValue("name"))
+	}
+}
+
+// named adapts the handler of a cluster-scoped object to a route with a {name} path parameter
+func named(handler func(w http.ResponseWriter, r *http.Request, name string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, r.PathValue("name"))
+	}
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// routeGroup serves OpenShift routes, so that oc status and manifests containing routes work.
+// Routes are only stored when --route-port-forwards is set, and then exposed through the host
+// ports pods publish; otherwise their creation is accepted and they are dropped.
+const routeGroup = "route.openshift.io"
+
+// routeRouterName names podKube in the ingress status of the routes it admits
+const routeRouterName = "podkube"
+
+// routeResource names routes in API errors
+var routeResource = schema.GroupResource{Group: routeGroup, Resource: "routes"}
+
+// routeV1 lists the resources served under /apis/route.openshift.io/v1
+var routeV1 = apiGroupVersion{
+	Group:   routeGroup,
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:         "routes",
+			SingularName: "route",
+			Namespaced:   true,
+			Kind:         "Route",
+		},
+	},
+}
+
+// route is an OpenShift route, with the fields of route.openshift.io/v1 that manifests set
+type route struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              routeSpec   `json:"spec"`
+	Status            routeStatus `json:"status,omitempty"`
+}
+
+type routeSpec struct {
+	Host              string                 `json:"host,omitempty"`
+	Subdomain         string                 `json:"subdomain,omitempty"`
+	Path              string                 `json:"path,omitempty"`
+	To                routeTargetReference   `json:"to"`
+	AlternateBackends []routeTargetReference `json:"alternateBackends,omitempty"`
+	Port              *routePort             `json:"port,omitempty"`
+	TLS               *routeTLSConfig        `json:"tls,omitempty"`
+	WildcardPolicy    string                 `json:"wildcardPolicy,omitempty"`
+}
+
+type routeTargetReference struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Weight *int32 `json:"weight,omitempty"`
+}
+
+type routePort struct {
+	TargetPort intstr.IntOrString `json:"targetPort"`
+}
+
+type routeTLSConfig struct {
+	Termination                   string `json:"termination"`
+	Certificate                   string `json:"certificate,omitempty"`
+	Key                           string `json:"key,omitempty"`
+	CACertificate                 string `json:"caCertificate,omitempty"`
+	DestinationCACertificate      string `json:"destinationCACertificate,omitempty"`
+	InsecureEdgeTerminationPolicy string `json:"insecureEdgeTerminationPolicy,omitempty"`
+}
+
+type routeStatus struct {
+	Ingress []routeIngress `json:"ingress,omitempty"`
+}
+
+type routeIngress struct {
+	Host                    string                  `json:"host,omitempty"`
+	RouterName              string                  `json:"routerName,omitempty"`
+	Conditions              []routeIngressCondition `json:"conditions,omitempty"`
+	WildcardPolicy          string                  `json:"wildcardPolicy,omitempty"`
+	RouterCanonicalHostname string                  `json:"routerCanonicalHostname,omitempty"`
+}
+
+type routeIngressCondition struct {
+	Type               string                 `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime *metav1.Time           `json:"lastTransitionTime,omitempty"`
+}
+
+// DeepCopy returns a copy of the route
+func (in *route) DeepCopy() *route {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec.AlternateBackends = nil
+	for _, backend := range in.Spec.AlternateBackends {
+		if backend.Weight != nil {
+			weight := *backend.Weight
+			backend.Weight = &weight
+		}
+		out.Spec.AlternateBackends = append(out.Spec.AlternateBackends, backend)
+	}
+	if in.Spec.To.Weight != nil {
+		weight := *in.Spec.To.Weight
+		out.Spec.To.Weight = &weight
+	}
+	if in.Spec.Port != nil {
+		port := *in.Spec.Port
+		out.Spec.Port = &port
+	}
+	if in.Spec.TLS != nil {
+		tls := *in.Spec.TLS
+		out.Spec.TLS = &tls
+	}
+	out.Status.Ingress = nil
+	for _, ingress := range in.Status.Ingress {
+		conditions := make([]routeIngressCondition, len(ingress.Conditions))
+		for i, condition := range ingress.Conditions {
+			conditions[i] = condition
+			conditions[i].LastTransitionTime = condition.LastTransitionTime.DeepCopy()
+		}
+		ingress.Conditions = conditions
+		out.Status.Ingress = append(out.Status.Ingress, ingress)
+	}
+	return &out
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *route) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// routeList is a list of routes
+type routeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []route `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object
+func (in *routeList) DeepCopyObject() runtime.Object {
+	out := &routeList{TypeMeta: in.TypeMeta}
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	for i := range in.Items {
+		out.Items = append(out.Items, *in.Items[i].DeepCopy())
+	}
+	return out
+}
+
+// routeStore holds the routes created while --route-port-forwards is set, by namespace/name.
+// Routes are saved to a state file on every change when the state directory is set, and are
+// otherwise lost when the adapter restarts.
+type routeStore struct {
+	mu     sync.Mutex
+	file   storage.StateFile
+	routes map[string]*route
+}
+
+// load reads the state file, which does not exist before the first route is created
+func (store *routeStore) load(file storage.StateFile) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.file = file
+	store.routes = map[string]*route{}
+	return file.Load(&store.routes)
+}
+
+// routeREST serves routes from the route store of the server
+type routeREST struct {
+	server *Server
+}
+
+func (rr *routeREST) New() runtime.Object {
+	return &route{}
+}
+
+func (rr *routeREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	store := &rr.server.routes
+	store.mu.Lock()
+	stored, ok := store.routes[namespace+"/"+name]
+	store.mu.Unlock()
+	if !ok || !rr.server.routePortForwards.Load() {
+		return nil, apierrors.NewNotFound(routeResource, name)
+	}
+	r := stored.DeepCopy()
+	rr.server.admitRoute(ctx, r)
+	return r, nil
+}
+
+func (rr *routeREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	list := &routeList{
+		TypeMeta: metav1.TypeMeta{Kind: "RouteList", APIVersion: routeV1.GroupVersion()},
+		Items:    []route{},
+	}
+	if !rr.server.routePortForwards.Load() {
+		return list, nil
+	}
+
+	store := &rr.server.routes
+	store.mu.Lock()
+	for _, stored := range store.routes {
+		if namespace == "" || stored.Namespace == namespace {
+			list.Items = append(list.Items, *stored.DeepCopy())
+		}
+	}
+	store.mu.Unlock()
+	sort.Slice(list.Items, func(i, j int) bool {
+		if list.Items[i].Namespace != list.Items[j].Namespace {
+			return list.Items[i].Namespace < list.Items[j].Namespace
+		}
+		return list.Items[i].Name < list.Items[j].Name
+	})
+	for i := range list.Items {
+		rr.server.admitRoute(ctx, &list.Items[i])
+	}
+	return list, nil
+}
+
+// Validate checks that a route targets a named service, the name of the pod it is exposed from
+func (rr *routeREST) Validate(obj, old runtime.Object) field.ErrorList {
+	r := obj.(*route)
+	toPath := field.NewPath("spec", "to")
+	var errs field.ErrorList
+	if r.Spec.To.Kind != "" && r.Spec.To.Kind != "Service" {
+		errs = append(errs, field.NotSupported(toPath.Child("kind"), r.Spec.To.Kind, []string{"Service"}))
+	}
+	if r.Spec.To.Name == "" {
+		errs = append(errs, field.Required(toPath.Child("name"), ""))
+	}
+	return errs
+}
+
+func (rr *routeREST) Create(ctx context.Context, obj runtime.Object, dryRun bool) (runtime.Object, error) {
+	r := obj.(*route)
+	r.TypeMeta = metav1.TypeMeta{Kind: "Route", APIVersion: routeV1.GroupVersion()}
+	if r.Spec.To.Kind == "" {
+		r.Spec.To.Kind = "Service"
+	}
+	r.UID = uuid.NewUUID()
+	r.CreationTimestamp = metav1.Now()
+	r.Status = routeStatus{}
+
+	if !rr.server.routePortForwards.Load() {
+		// Accepted so that manifests with routes apply, but not stored
+		klog.Infof("Dropping route %s/%s: routes are only served with --route-port-forwards", r.Namespace, r.Name)
+		r.Status.Ingress = []routeIngress{{
+			RouterName: routeRouterName,
+			Conditions: []routeIngressCondition{{
+				Type:    "Admitted",
+				Status:  corev1.ConditionFalse,
+				Reason:  "RoutesDisabled",
+				Message: "podKube serves routes only with --route-port-forwards; this route was not stored",
+			}},
+		}}
+		return r, nil
+	}
+
+	store := &rr.server.routes
+	store.mu.Lock()
+	key := r.Namespace + "/" + r.Name
+	if _, exists := store.routes[key]; exists {
+		store.mu.Unlock()
+		return nil, apierrors.NewAlreadyExists(routeResource, r.Name)
+	}
+	if !dryRun {
+		if store.routes == nil {
+			store.routes = map[string]*route{}
+		}
+		store.routes[key] = r.DeepCopy()
+		if err := store.file.Save(store.routes); err != nil {
+			delete(store.routes, key)
+			store.mu.Unlock()
+			return nil, apierrors.NewInternalError(fmt.Errorf("failed to save route %s: %v", key, err))
+		}
+	}
+	store.mu.Unlock()
+
+	rr.server.admitRoute(ctx, r)
+	return r, nil
+}
+
+func (rr *routeREST) Delete(ctx context.Context, namespace, name string) error {
+	store := &rr.server.routes
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	key := namespace + "/" + name
+	if _, ok := store.routes[key]; !ok || !rr.server.routePortForwards.Load() {
+		return apierrors.NewNotFound(routeResource, name)
+	}
+	stored := store.routes[key]
+	delete(store.routes, key)
+	if err := store.file.Save(store.routes); err != nil {
+		store.routes[key] = stored
+		return apierrors.NewInternalError(fmt.Errorf("failed to save the deletion of route %s: %v", key, err))
+	}
+	return nil
+}
+
+func (rr *routeREST) ConvertToTable(obj runtime.Object) *metav1.Table {
+	if r, ok := obj.(*route); ok {
+		return routeListToTable(&routeList{Items: []route{*r}})
+	}
+	return routeListToTable(obj.(*routeList))
+}
+
+// admitRoute sets the ingress status of a route: the route is admitted when the pod named by
+// spec.to runs on the local node and publishes the target port of the route on a host port,
+// and its host is then the address of that host port
+func (s *Server) admitRoute(ctx context.Context, r *route) {
+	ingress := routeIngress{RouterName: routeRouterName, Host: r.Spec.Host, WildcardPolicy: r.Spec.WildcardPolicy}
+	condition := routeIngressCondition{Type: "Admitted", Status: corev1.ConditionTrue}
+	defer func() {
+		ingress.Conditions = []routeIngressCondition{condition}
+		r.Status.Ingress = []routeIngress{ingress}
+	}()
+
+	pod, err := s.podStorage.Get(ctx, r.Namespace, r.Spec.To.Name)
+	if err != nil {
+		condition.Status, condition.Reason = corev1.ConditionFalse, "PodNotFound"
+		condition.Message = fmt.Sprintf("no pod %s exposes the route: %v", r.Spec.To.Name, err)
+		return
+	}
+	if node, ok := s.podStorage.Node(pod.Spec.NodeName); !ok || node.Connection != "" {
+		condition.Status, condition.Reason = corev1.ConditionFalse, "RemoteNode"
+		condition.Message = fmt.Sprintf("pod %s runs on node %s, whose host ports podKube does not forward", pod.Name, pod.Spec.NodeName)
+		return
+	}
+
+	var target *intstr.IntOrString
+	if r.Spec.Port != nil {
+		target = &r.Spec.Port.TargetPort
+	}
+	published := routeHostPort(pod, target)
+	if published == nil {
+		condition.Status, condition.Reason = corev1.ConditionFalse, "NoHostPort"
+		condition.Message = fmt.Sprintf("pod %s does not publish the target port of the route on a host port", pod.Name)
+		return
+	}
+	hostIP := published.HostIP
+	if hostIP == "" || hostIP == "0.0.0.0" || hostIP == "::" {
+		hostIP = "127.0.0.1"
+	}
+	ingress.Host = net.JoinHostPort(hostIP, strconv.Itoa(int(published.HostPort)))
+	ingress.RouterCanonicalHostname = hostIP
+}
+
+// routeHostPort returns the port of a pod matching the target port of a route, by name or
+// number, or its first port without target, when it is published on a host port
+func routeHostPort(pod *corev1.Pod, target *intstr.IntOrString) *corev1.ContainerPort {
+	for _, container := range pod.Spec.Containers {
+		for i := range container.Ports {
+			port := &container.Ports[i]
+			matches := target == nil ||
+				target.Type == intstr.String && target.StrVal == port.Name ||
+				target.Type == intstr.Int && target.IntVal == port.ContainerPort
+			if !matches {
+				continue
+			}
+			if port.HostPort != 0 {
+				return port
+			}
+			if target != nil {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// routeListToTable converts a route list to the table format used by oc get routes
+func routeListToTable(list *routeList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the route"},
+			{Name: "Host/Port", Type: "string", Description: "Host the route is reached at, the host port of its pod once admitted"},
+			{Name: "Path", Type: "string", Description: "Path of the route"},
+			{Name: "Services", Type: "string", Description: "Services, the pods, the route targets"},
+			{Name: "Port", Type: "string", Description: "Target port of the route"},
+			{Name: "Termination", Type: "string", Description: "TLS termination of the route"},
+			{Name: "Wildcard", Type: "string", Description: "Wildcard policy of the route"},
+		},
+	}
+
+	for i := range list.Items {
+		r := &list.Items[i]
+		host := r.Spec.Host
+		for _, ingress := range r.Status.Ingress {
+			for _, condition := range ingress.Conditions {
+				if condition.Type == "Admitted" && condition.Status == corev1.ConditionTrue {
+					host = ingress.Host
+				}
+			}
+		}
+		if host == "" {
+			host = "<none>"
+		}
+		services := []string{r.Spec.To.Name}
+		for _, backend := range r.Spec.AlternateBackends {
+			services = append(services, backend.Name)
+		}
+		port, termination, wildcard := "<all>", "", r.Spec.WildcardPolicy
+		if r.Spec.Port != nil {
+			port = r.Spec.Port.TargetPort.String()
+		}
+		if r.Spec.TLS != nil {
+			termination = r.Spec.TLS.Termination
+		}
+		if wildcard == "" {
+			wildcard = "None"
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				r.Name,
+				host,
+				r.Spec.Path,
+				strings.Join(services, ","),
+				port,
+				termination,
+				wildcard,
+			},
+			Object: runtime.RawExtension{
+				Object: r.DeepCopy(),
+			},
+		})
+	}
+	return table
+}
+
+// registerRouteAPI routes the route.openshift.io/v1 discovery document and routes
+func (s *Server) registerRouteAPI(rt *router) {
+	prefix := "/apis/" + routeGroup + "/" + routeV1.Version
+	rt.handle(prefix, func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.served(routeV1).resourceList())
+	}, http.MethodGet)
+	s.registerREST(rt, prefix, restResource{
+		Resource:   routeResource,
+		Kind:       "Route",
+		Namespaced: true,
+		Storage:    &routeREST{server: s},
+	})
+}
+
+// SetRoutePortForwards sets whether routes are stored and exposed through the host ports of
+// their pods; without it routes are accepted and dropped, and route lists are empty
+func (s *Server) SetRoutePortForwards(enabled bool) {
+	s.routePortForwards.Store(enabled)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// authorizationGroup serves the reviews clients make of their own permissions, such as
+// kubectl auth can-i --list and the IDE plugins probing what they may show
+const authorizationGroup = "authorization.k8s.io"
+
+// authorizationV1 lists the resources served under /apis/authorization.k8s.io/v1
+var authorizationV1 = apiGroupVersion{
+	Group:   authorizationGroup,
+	Version: "v1",
+	Resources: []metav1.APIResource{
+		{
+			Name:       "selfsubjectrulesreviews",
+			Namespaced: false,
+			Kind:       "SelfSubjectRulesReview",
+		},
+	},
+}
+
+// selfReviewResources are the reviews every user may create about themselves, whatever the
+// authorization modes, as the system:basic-user role of Kubernetes allows
+var selfReviewResources = map[string]bool{
+	"selfsubjectrulesreviews": true,
+}
+
+// nonResourceRules are the non-resource URLs listed by rules reviews, with a path of each
+// to ask the authorization modes about
+var nonResourceRules = []struct {
+	url, probe string
+}{
+	{"/api", "/api"},
+	{"/api/*", "/api/v1"},
+	{"/apis", "/apis"},
+	{"/apis/*", "/apis/" + authorizationGroup},
+	{"/version", "/version"},
+	{"/openapi/*", "/openapi/v2"},
+	{"/metrics", "/metrics"},
+	{"/logs", "/logs"},
+	{"/logs/*", "/logs/podman"},
+	{"/debug/*", "/debug/sessions"},
+}
+
+// registerAuthorizationAPI routes the authorization.k8s.io/v1 discovery document and the
+// self subject rules reviews
+func (s *Server) registerAuthorizationAPI(rt *router) {
+	prefix := "/apis/" + authorizationGroup + "/" + authorizationV1.Version
+	rt.handle(prefix, func(w http.ResponseWriter, r *http.Request) {
+		s.writeJSON(w, s.served(authorizationV1).resourceList())
+	}, http.MethodGet)
+	rt.handle(prefix+"/selfsubjectrulesreviews", s.createSelfSubjectRulesReview, http.MethodPost)
+}
+
+// createSelfSubjectRulesReview lists what the user of a request may do in the namespace of
+// the review, as the authorization modes answer for each resource, verb and non-resource URL
+// served. Rules granted on single objects by the Node mode are not listed.
+func (s *Server) createSelfSubjectRulesReview(w http.ResponseWriter, r *http.Request) {
+	var review authorizationv1.SelfSubjectRulesReview
+	if err := decodeBody(w, r, &review); err != nil {
+		s.writeDecodeError(w, "selfsubjectrulesreview", err)
+		return
+	}
+	if review.Spec.Namespace == "" {
+		s.writeStatusError(w, apierrors.NewBadRequest("no namespace on request"))
+		return
+	}
+
+	user := requestUser(r)
+	settings := s.authorization.Load()
+	if r.TLS == nil {
+		// The plain HTTP listener is not authorized
+		settings = nil
+	}
+	allowed := func(info *RequestInfo, path string) bool {
+		return settings == nil || settings.authorize(user, info, path)
+	}
+
+	review.TypeMeta = metav1.TypeMeta{Kind: "SelfSubjectRulesReview", APIVersion: authorizationV1.GroupVersion()}
+	review.Status = authorizationv1.SubjectRulesReviewStatus{
+		ResourceRules:    []authorizationv1.ResourceRule{},
+		NonResourceRules: []authorizationv1.NonResourceRule{},
+	}
+	all := true
+
+	// Resources with the same verbs in a group share a rule
+	type ruleKey struct{ group, verbs string }
+	var order []ruleKey
+	rules := map[ruleKey]*authorizationv1.ResourceRule{}
+	for _, gv := range append([]apiGroupVersion{s.served(coreV1)}, s.servedGroups()...) {
+		for _, resource := range gv.Resources {
+			var verbs []string
+			for _, verb := range resource.Verbs {
+				info := &RequestInfo{IsResourceRequest: true, Verb: verb, APIGroup: gv.Group, APIVersion: gv.Version}
+				info.Resource, info.Subresource, _ = strings.Cut(resource.Name, "/")
+				if resource.Namespaced {
+					info.Namespace = review.Spec.Namespace
+				}
+				if (gv.Group == authorizationGroup && selfReviewResources[info.Resource]) || allowed(info, "") {
+					verbs = append(verbs, verb)
+				} else {
+					all = false
+				}
+			}
+			if len(verbs) == 0 {
+				continue
+			}
+			sort.Strings(verbs)
+			key := ruleKey{gv.Group, strings.Join(verbs, ",")}
+			if rules[key] == nil {
+				rules[key] = &authorizationv1.ResourceRule{Verbs: verbs, APIGroups: []string{gv.Group}}
+				order = append(order, key)
+			}
+			rules[key].Resources = append(rules[key].Resources, resource.Name)
+		}
+	}
+
+	var nonResource []string
+	for _, rule := range nonResourceRules {
+		if allowed(&RequestInfo{Verb: "get"}, rule.probe) {
+			nonResource = append(nonResource, rule.url)
+		} else {
+			all = false
+		}
+	}
+
+	if all {
+		review.Status.ResourceRules = append(review.Status.ResourceRules, authorizationv1.ResourceRule{
+			Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"},
+		})
+		review.Status.NonResourceRules = append(review.Status.NonResourceRules, authorizationv1.NonResourceRule{
+			Verbs: []string{"*"}, NonResourceURLs: []string{"*"},
+		})
+	} else {
+		for _, key := range order {
+			review.Status.ResourceRules = append(review.Status.ResourceRules, *rules[key])
+		}
+		if len(nonResource) > 0 {
+			review.Status.NonResourceRules = append(review.Status.NonResourceRules, authorizationv1.NonResourceRule{
+				Verbs: []string{"get"}, NonResourceURLs: nonResource,
+			})
+		}
+		if settings != nil && hasGroup(user, nodesGroup) && strings.HasPrefix(user.Username, nodeUserPrefix) {
+			for _, mode := range settings.modes {
+				if mode == AuthorizationModeNode {
+					review.Status.Incomplete = true
+					review.Status.EvaluationError = fmt.Sprintf("the rules of mode %s on the node and lease of %s are not listed", AuthorizationModeNode, user.Username)
+				}
+			}
+		}
+	}
+
+	s.writeObjectWithStatus(w, r, http.StatusCreated, &review)
+}
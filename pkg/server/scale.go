@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// scaleGroupKind names scales in API errors
+var scaleGroupKind = schema.GroupKind{Group: autoscalingv1.GroupName, Kind: "Scale"}
+
+// scaleAPIResource returns the discovery entry of the scale subresource of a resource
+func scaleAPIResource(resource string) metav1.APIResource {
+	return metav1.APIResource{
+		Name:       resource + "/scale",
+		Namespaced: true,
+		Group:      autoscalingv1.GroupName,
+		Version:    "v1",
+		Kind:       "Scale",
+		Verbs:      []string{"get", "patch", "update"},
+	}
+}
+
+// getScale serves the scale of an object, as kubectl scale and autoscalers read it
+func (h *restHandler) getScale(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	scale, err := h.resource.Storage.(restScaler).GetScale(r.Context(), namespace, name)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	h.server.writeObject(w, r, scale)
+}
+
+// updateScale replaces the scale of an object, setting its replicas
+func (h *restHandler) updateScale(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	var scale autoscalingv1.Scale
+	if err := decodeBody(w, r, &scale); err != nil {
+		h.server.writeDecodeError(w, "scale", err)
+		return
+	}
+	h.replaceScale(w, r, namespace, name, &scale)
+}
+
+// patchScale applies a patch to the scale of an object, such as the merge patch of
+// kubectl scale, {"spec":{"replicas":3}}
+func (h *restHandler) patchScale(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	current, err := h.resource.Storage.(restScaler).GetScale(r.Context(), namespace, name)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	original, err := json.Marshal(current)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	patched, err := applyPatch(r.Header.Get("Content-Type"), original, patch)
+	if err != nil {
+		h.server.writeDecodeError(w, "patch", err)
+		return
+	}
+	var scale autoscalingv1.Scale
+	if err := json.Unmarshal(patched, &scale); err != nil {
+		h.server.writeDecodeError(w, "patched scale", err)
+		return
+	}
+	// A patch only conflicts with concurrent changes when it sets the resourceVersion
+	if scale.ResourceVersion == current.ResourceVersion && !patchSetsResourceVersion(r.Header.Get("Content-Type"), patch) {
+		scale.ResourceVersion = ""
+	}
+	h.replaceScale(w, r, namespace, name, &scale)
+}
+
+// replaceScale validates the scale of a PUT or PATCH request and sets it
+func (h *restHandler) replaceScale(w http.ResponseWriter, r *http.Request, namespace, name string, scale *autoscalingv1.Scale) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		h.server.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	if h.resource.Namespaced && scale.Namespace == "" {
+		scale.Namespace = namespace
+	}
+	if scale.Name != name || scale.Namespace != namespace {
+		h.server.writeStatusError(w, apierrors.NewBadRequest("the name and namespace of the scale do not match the URL"))
+		return
+	}
+	if scale.Spec.Replicas < 0 {
+		h.server.writeStatusError(w, apierrors.NewInvalid(scaleGroupKind, name, field.ErrorList{
+			field.Invalid(field.NewPath("spec", "replicas"), scale.Spec.Replicas, "must be greater than or equal to 0"),
+		}))
+		return
+	}
+
+	updated, err := h.resource.Storage.(restScaler).UpdateScale(r.Context(), scale, dryRun)
+	if err != nil {
+		h.writeError(w, name, err)
+		return
+	}
+	h.server.writeObject(w, r, updated)
+}
+
+// newScale returns the scale of a workload object: its desired and current replicas, and the
+// selector of its pods in the serialized form of status.selector
+func newScale(objectMeta metav1.ObjectMeta, replicas, currentReplicas int32, selector *metav1.LabelSelector) (*autoscalingv1.Scale, error) {
+	scale := &autoscalingv1.Scale{
+		TypeMeta: metav1.TypeMeta{Kind: "Scale", APIVersion: autoscalingv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              objectMeta.Name,
+			Namespace:         objectMeta.Namespace,
+			UID:               objectMeta.UID,
+			ResourceVersion:   objectMeta.ResourceVersion,
+			CreationTimestamp: objectMeta.CreationTimestamp,
+		},
+		Spec:   autoscalingv1.ScaleSpec{Replicas: replicas},
+		Status: autoscalingv1.ScaleStatus{Replicas: currentReplicas},
+	}
+	if selector != nil {
+		parsed, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector of %s: %v", objectMeta.Name, err)
+		}
+		scale.Status.Selector = parsed.String()
+	}
+	return scale, nil
+}
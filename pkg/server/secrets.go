@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// secretResource names secrets in API errors
+var secretResource = schema.GroupResource{Resource: "secrets"}
+
+// secretREST serves secrets from the secrets of the nodes
+type secretREST struct {
+	server *Server
+}
+
+func (sr *secretREST) New() runtime.Object {
+	return &corev1.Secret{}
+}
+
+func (sr *secretREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	secret, err := sr.server.podStorage.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return nil, secretError(name, err)
+	}
+	return secret, nil
+}
+
+func (sr *secretREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	return sr.server.podStorage.ListSecrets(ctx, namespace)
+}
+
+func (sr *secretREST) Create(ctx context.Context, obj runtime.Object, dryRun bool) (runtime.Object, error) {
+	secret := obj.(*corev1.Secret)
+	var created *corev1.Secret
+	var err error
+	if dryRun {
+		created, err = sr.server.podStorage.DryRunCreateSecret(ctx, secret)
+	} else {
+		created, err = sr.server.podStorage.CreateSecret(ctx, secret)
+	}
+	if err != nil {
+		return nil, secretError(secret.Name, err)
+	}
+	return created, nil
+}
+
+// Validate checks that the data keys of a secret are valid ConfigMap keys, as kube-apiserver does
+func (sr *secretREST) Validate(obj, old runtime.Object) field.ErrorList {
+	secret := obj.(*corev1.Secret)
+	var errs field.ErrorList
+	for _, data := range []struct {
+		path *field.Path
+		keys []string
+	}{
+		{field.NewPath("data"), mapKeys(secret.Data)},
+		{field.NewPath("stringData"), mapKeys(secret.StringData)},
+	} {
+		for _, key := range data.keys {
+			for _, msg := range validation.IsConfigMapKey(key) {
+				errs = append(errs, field.Invalid(data.path.Key(key), key, msg))
+			}
+		}
+	}
+	return errs
+}
+
+// mapKeys returns the sorted keys of a map
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (sr *secretREST) Delete(ctx context.Context, namespace, name string) error {
+	if err := sr.server.podStorage.DeleteSecret(ctx, namespace, name); err != nil {
+		return secretError(name, err)
+	}
+	return nil
+}
+
+func (sr *secretREST) ConvertToTable(obj runtime.Object) *metav1.Table {
+	if secret, ok := obj.(*corev1.Secret); ok {
+		return secretListToTable(&corev1.SecretList{Items: []corev1.Secret{*secret}})
+	}
+	return secretListToTable(obj.(*corev1.SecretList))
+}
+
+// secretError turns the not found and already exists errors of the secret storage into
+// their API errors
+func secretError(name string, err error) error {
+	switch {
+	case strings.Contains(err.Error(), "already exists"):
+		return apierrors.NewAlreadyExists(secretResource, name)
+	case strings.Contains(err.Error(), "not found"):
+		return apierrors.NewNotFound(secretResource, name)
+	default:
+		return err
+	}
+}
@@ -1,23 +1,23 @@
 package server
 
 import (
+	"bytes"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
-	"math/big"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -26,13 +26,19 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
 	"k8s.io/apimachinery/pkg/util/httpstream"
 	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/apimachinery/pkg/util/httpstream/wsstream"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/klog/v2"
 
 	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/pkg/version"
 )
 
 // TerminalSize represents terminal dimensions
@@ -42,29 +48,115 @@ type TerminalSize struct {
 }
 
 
+// Default stream timeouts of exec sessions, those of the kubelet
+const (
+	DefaultStreamCreationTimeout = 30 * time.Second
+	DefaultStreamIdleTimeout     = 4 * time.Hour
+)
+
 // Server represents our Kubernetes API server
 type Server struct {
 	host       string
 	port       int
-	httpServer *http.Server
-	podStorage *storage.PodStorage
+	httpServer  *http.Server
+	podStorage  *storage.Cluster
+	auditLogger *AuditLogger
+
+	// proxyTransport is shared by the pod and service proxies so that their connections are reused
+	proxyTransport *http.Transport
+
+	// tolerateUnsupportedFields turns the rejection of pods using unsupported fields into warnings
+	tolerateUnsupportedFields atomic.Bool
+
+	// podColumns are the custom columns of pod tables, nil for the default columns
+	podColumns atomic.Pointer[[]podColumn]
+
+	// Defaults and external webhooks of the admission chain of created and updated pods
+	admissionDefaults atomic.Pointer[admissionDefaults]
+	admissionWebhooks atomic.Pointer[[]*admissionWebhook]
+
+	// insecureServer is the optional plain HTTP listener on a loopback address
+	insecureServer *http.Server
+
+	// Self-signed certificate settings
+	stateDir     string
+	tlsSANs      []string
+	certReloader *certReloader
+
+	// Lifecycle: ctx is cancelled once shutdown completes, shutdownCh is closed when it starts
+	ctx          context.Context
+	cancel       context.CancelFunc
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+	sessions     sync.WaitGroup
+	startOnce    sync.Once
+
+	// execSessions tracks the active exec sessions
+	execSessions sessionManager
+	// execTranscriptDir is where the transcripts of exec sessions are written, none when empty
+	execTranscriptDir atomic.Pointer[string]
+	// clients counts the requests of each client and tracks the open watches
+	clients clientTracker
+
+	// longPolls holds the cursors of long-poll pod watches
+	longPolls longPollCursors
+
+	// routes holds the OpenShift routes, stored and exposed through host ports when
+	// routePortForwards is set
+	routes            routeStore
+	routePortForwards atomic.Bool
+
+	// nodeLogs are the host logs served by /logs/ and the node logs proxy
+	nodeLogs atomic.Pointer[nodeLogSources]
+
+	// diagnostics holds the token and sources of /debug/bundle
+	diagnostics atomic.Pointer[diagnostics]
+
+	// authorization holds the authorization modes and the users of the bearer tokens
+	authorization atomic.Pointer[authorization]
+	// serviceAccounts issues and authenticates the tokens of service accounts
+	serviceAccounts *serviceAccountTokens
+	// kubernetesService gives created pods the kubernetes service and serves it
+	kubernetesService atomic.Bool
+
+	// Default stream creation and idle timeouts of exec sessions, as time.Duration
+	streamCreationTimeout atomic.Int64
+	streamIdleTimeout     atomic.Int64
+
+	restHandlers map[string]*restHandler // Resources served by the generic REST handlers, by kind
+	router       *router                 // Registered routes, which discovery lists the verbs of
 }
 
 // New creates a new Kubernetes API server
 func New(host string, port int) *Server {
-	podStorage := storage.NewPodStorage()
+	// By default the local podman is the single node of the cluster
+	localNode, _ := storage.NewNode(storage.DefaultNodeName(), storage.RuntimePodman, "", "", nil)
+	podStorage := storage.NewCluster(localNode)
 
 	mux := http.NewServeMux()
+	ctx, cancel := context.WithCancel(context.Background())
 
 	server := &Server{
 		host:       host,
 		port:       port,
 		podStorage: podStorage,
+		ctx:        ctx,
+		cancel:     cancel,
+		shutdownCh: make(chan struct{}),
+		proxyTransport: &http.Transport{
+			// Pods and podKube serve self-signed certificates, as for the API server proxies
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			IdleConnTimeout: proxyIdleConnTimeout,
+		},
 		httpServer: &http.Server{
-			Addr:    fmt.Sprintf("%s:%d", host, port),
-			Handler: mux,
+			Addr: fmt.Sprintf("%s:%d", host, port),
 		},
 	}
+	server.httpServer.Handler = server.withRequestLog(server.withAuthentication(server.withAudit(server.withAuthorization(mux))))
+	server.serviceAccounts = &serviceAccountTokens{server: server}
+	podStorage.SetServiceAccountTokens(server.serviceAccounts)
+	server.streamCreationTimeout.Store(int64(DefaultStreamCreationTimeout))
+	server.streamIdleTimeout.Store(int64(DefaultStreamIdleTimeout))
 
 	// Register all API routes
 	server.registerRoutes(mux)
@@ -72,402 +164,282 @@ func New(host string, port int) *Server {
 	return server
 }
 
-// registerRoutes sets up all Kubernetes API endpoints
-func (s *Server) registerRoutes(mux *http.ServeMux) {
-	// Core API discovery endpoints (required by kubectl/oc)
-	mux.HandleFunc("/api", s.handleAPIDiscovery)
-	mux.HandleFunc("/apis", s.handleAPIsDiscovery)
-	mux.HandleFunc("/api/v1", s.handleAPIV1Discovery)
-	mux.HandleFunc("/apis/project.openshift.io/v1", s.handleProjectAPIDiscovery)
-
-	// Namespace API endpoints
-	mux.HandleFunc("/api/v1/namespaces", s.handleNamespaceList)
-
-	// Project API endpoints (OpenShift compatibility)
-	mux.HandleFunc("/apis/project.openshift.io/v1/projects/", s.handleProjectByName)
-	mux.HandleFunc("/apis/project.openshift.io/v1/projects", s.handleProjectList)
-	mux.HandleFunc("/oapi/v1/projects", s.handleProjectList) // Legacy OpenShift API
+// Handler returns the HTTP handler serving the API, with audit logging applied
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
+}
 
-	// Pod API endpoints
-	mux.HandleFunc("/api/v1/pods", s.handleClusterPods)
-	mux.HandleFunc("/api/v1/namespaces/", s.handleNamespacedResources)
+// SetCacheTTL sets how long container listings are served from memory (0 disables caching)
+func (s *Server) SetCacheTTL(ttl time.Duration) {
+	s.podStorage.SetCacheTTL(ttl)
+}
 
-	// Secret API endpoints
-	mux.HandleFunc("/api/v1/secrets", s.handleClusterSecrets)
+// SetPodmanCommandTimeout sets the maximum duration of a single non-streaming podman call
+func (s *Server) SetPodmanCommandTimeout(timeout time.Duration) {
+	s.podStorage.SetCommandTimeout(timeout)
+}
 
-	// Health and version endpoints
-	mux.HandleFunc("/healthz", s.handleHealth)
-	mux.HandleFunc("/readyz", s.handleHealth)
-	mux.HandleFunc("/livez", s.handleHealth)
-	mux.HandleFunc("/version", s.handleVersion)
-
-	klog.Infof("Registered API routes:")
-	klog.Infof("  GET /api/v1/namespaces")
-	klog.Infof("  GET /apis/project.openshift.io/v1/projects")
-	klog.Infof("  GET /oapi/v1/projects")
-	klog.Infof("  GET /api/v1/pods")
-	klog.Infof("  GET /api/v1/namespaces/{namespace}/pods")
-	klog.Infof("  GET /api/v1/namespaces/{namespace}/pods/{name}")
-	klog.Infof("  GET /api/v1/namespaces/{namespace}/pods/{name}/log")
-	klog.Infof("  POST /api/v1/namespaces/{namespace}/pods/{name}/exec")
-	klog.Infof("  GET /api/v1/secrets")
-	klog.Infof("  GET /api/v1/namespaces/{namespace}/secrets")
-	klog.Infof("  GET /api/v1/namespaces/{namespace}/secrets/{name}")
-	klog.Infof("  GET /healthz, /readyz, /livez")
-	klog.Infof("  GET /version")
-}
-
-// handleAPIDiscovery returns core API group information
-func (s *Server) handleAPIDiscovery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// SetCircuitBreaker configures after how many consecutive podman failures requests fail fast,
+// and for how long before podman is probed again
+func (s *Server) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	s.podStorage.SetCircuitBreaker(threshold, cooldown)
+}
 
-	apiVersions := &metav1.APIVersions{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIVersions",
-			APIVersion: "v1",
-		},
-		Versions: []string{"v1"},
-		ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
-			{
-				ClientCIDR:    "0.0.0.0/0",
-				ServerAddress: fmt.Sprintf("%s:%d", s.host, s.port),
-			},
-		},
-	}
+// SetTolerateUnsupportedFields sets whether pods using fields that cannot be honored are
+// created anyway, with a Warning header per field, instead of being rejected
+func (s *Server) SetTolerateUnsupportedFields(tolerate bool) {
+	s.tolerateUnsupportedFields.Store(tolerate)
+}
 
-	s.writeJSON(w, apiVersions)
+// SetHideInternalAnnotations sets whether pods are served without the annotations set by
+// podKube and the container runtimes (podman.io/*, docker.io/*...)
+func (s *Server) SetHideInternalAnnotations(hide bool) {
+	s.podStorage.SetHideInternalAnnotations(hide)
 }
 
-// handleAPIsDiscovery returns available API groups (empty for core API only)
-func (s *Server) handleAPIsDiscovery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// SetAllowPodRecreateOnUpdate sets whether pod updates changing the image or env of
+// containers are applied by recreating the container
+func (s *Server) SetAllowPodRecreateOnUpdate(allow bool) {
+	s.podStorage.SetAllowRecreateOnUpdate(allow)
+}
 
-	apiGroupList := &metav1.APIGroupList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIGroupList",
-			APIVersion: "v1",
-		},
-		Groups: []metav1.APIGroup{
-			{
-				Name: "project.openshift.io",
-				Versions: []metav1.GroupVersionForDiscovery{
-					{
-						GroupVersion: "project.openshift.io/v1",
-						Version:      "v1",
-					},
-				},
-				PreferredVersion: metav1.GroupVersionForDiscovery{
-					GroupVersion: "project.openshift.io/v1",
-					Version:      "v1",
-				},
-			},
-		},
-	}
+// SetAllowSystemdDelete sets whether deleting the pods of containers managed by systemd
+// units removes them without a forced deletion
+func (s *Server) SetAllowSystemdDelete(allow bool) {
+	s.podStorage.SetAllowSystemdDelete(allow)
+}
 
-	s.writeJSON(w, apiGroupList)
+// SetPodUsageAnnotations sets whether single pod reads are annotated with the CPU and memory
+// usage of the pod's containers
+func (s *Server) SetPodUsageAnnotations(enabled bool) {
+	s.podStorage.SetPodUsageAnnotations(enabled)
 }
 
-// handleAPIV1Discovery returns resources available in the v1 API
-func (s *Server) handleAPIV1Discovery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// SetGarbageCollection configures the removal of exited containers: those that exited more
+// than exitedAfter ago, and the oldest beyond maxExited per node (0 disables either limit)
+func (s *Server) SetGarbageCollection(exitedAfter time.Duration, maxExited int) {
+	s.podStorage.SetGarbageCollection(exitedAfter, maxExited)
+}
 
-	apiResourceList := &metav1.APIResourceList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIResourceList",
-			APIVersion: "v1",
-		},
-		GroupVersion: "v1",
-		APIResources: []metav1.APIResource{
-			{
-				Name:         "namespaces",
-				SingularName: "namespace",
-				Namespaced:   false,
-				Kind:         "Namespace",
-				Verbs:        []string{"get", "list"},
-				ShortNames:   []string{"ns"},
-			},
-			{
-				Name:         "pods",
-				SingularName: "pod",
-				Namespaced:   true,
-				Kind:         "Pod",
-				Verbs:        []string{"get", "list", "create", "update", "patch", "delete", "deletecollection", "watch"},
-				Categories:   []string{"all"},
-			},
-			{
-				Name:         "pods/exec",
-				SingularName: "",
-				Namespaced:   true,
-				Kind:         "PodExecOptions",
-				Verbs:        []string{"create"},
-			},
-			{
-				Name:         "pods/log",
-				SingularName: "",
-				Namespaced:   true,
-				Kind:         "PodLogOptions",
-				Verbs:        []string{"get"},
-			},
-			{
-				Name:         "secrets",
-				SingularName: "secret",
-				Namespaced:   true,
-				Kind:         "Secret",
-				Verbs:        []string{"get", "list", "create", "delete"},
-			},
-		},
+// SetNodes replaces the default local node with the given podman backends. Pods that
+// select no node are created on defaultNode, or spread round-robin when it is empty.
+func (s *Server) SetNodes(nodes []*storage.Node, defaultNode string) error {
+	cluster := storage.NewCluster(nodes...)
+	if err := cluster.SetDefaultNode(defaultNode); err != nil {
+		return err
 	}
+	cluster.SetServiceAccountTokens(s.serviceAccounts)
+	s.podStorage = cluster
+	return nil
+}
 
-	s.writeJSON(w, apiResourceList)
+// startBackgroundTasks starts the work that runs for the lifetime of the server, once
+// it is fully configured. It is called by every listener and only runs once.
+func (s *Server) startBackgroundTasks() {
+	s.startOnce.Do(func() {
+		// Keep the container cache in sync with podman
+		go s.podStorage.RunEventWatcher(s.ctx)
+		// Remove old exited containers, when enabled
+		go s.podStorage.RunGarbageCollector(s.ctx)
+		// Renew the node leases while the runtimes are reachable
+		go s.podStorage.RunLeaseRenewer(s.ctx)
+		// Delete the pods of the terminating namespaces
+		go s.podStorage.RunNamespaceDeleter(s.ctx)
+	})
 }
 
-// handleProjectAPIDiscovery returns resources available in the project.openshift.io/v1 API
-func (s *Server) handleProjectAPIDiscovery(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// SetPodmanParallelism sets how many per-container podman calls run concurrently during a list
+func (s *Server) SetPodmanParallelism(parallelism int) {
+	s.podStorage.SetParallelism(parallelism)
+}
 
-	apiResourceList := &metav1.APIResourceList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIResourceList",
-			APIVersion: "v1",
-		},
-		GroupVersion: "project.openshift.io/v1",
-		APIResources: []metav1.APIResource{
-			{
-				Name:         "projects",
-				SingularName: "project",
-				Namespaced:   false,
-				Kind:         "Project",
-				Verbs:        []string{"get", "list"},
-			},
-		},
-	}
+// registerRoutes sets up all Kubernetes API endpoints
+func (s *Server) registerRoutes(mux *http.ServeMux) {
+	rt := newRouter(mux)
+	s.router = rt
+	get, post, put, patch, del := http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete
 
-	s.writeJSON(w, apiResourceList)
-}
+	// Core API discovery endpoints (required by kubectl/oc)
+	rt.handle("/api", s.handleAPIDiscovery, get)
+	rt.handle("/apis", s.handleAPIsDiscovery, get)
+	rt.handle("/api/v1", s.handleAPIV1Discovery, get)
+	rt.handle("/apis/project.openshift.io/v1", s.handleProjectAPIDiscovery, get)
+	rt.handle("/apis/podman.io/v1", s.handlePodmanAPIDiscovery, get)
 
-// handleNamespaceList handles requests to /api/v1/namespaces
-func (s *Server) handleNamespaceList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	// Namespace API endpoints
+	rt.handle("/api/v1/namespaces", s.handleNamespaceList, get)
+	rt.handle("/api/v1/namespaces/{name}", named(s.handleNamespaceByName), get)
+	rt.handle("/api/v1/namespaces/{name}", named(s.updateNamespace), put)
+	rt.handle("/api/v1/namespaces/{name}", named(s.patchNamespace), patch)
+	rt.handle("/api/v1/namespaces/{name}", named(s.deleteNamespace), del)
 
-	namespaces := s.podStorage.ListNamespaces()
+	// Project API endpoints (OpenShift compatibility)
+	rt.handle("/apis/project.openshift.io/v1/projects", s.handleProjectList, get)
+	rt.handle("/apis/project.openshift.io/v1/projects/{name}", named(s.handleProjectByName), get)
+	rt.handle("/apis/project.openshift.io/v1/projects/{name}", named(s.updateProject), put)
+	rt.handle("/apis/project.openshift.io/v1/projects/{name}", named(s.patchProject), patch)
+	rt.handle("/apis/project.openshift.io/v1/projects/{name}", named(s.deleteProject), del)
+	rt.handle("/apis/project.openshift.io/v1/projects/{name}/status", named(s.handleProjectByName), get)
+
+	// Legacy OpenShift API, the project endpoints with a deprecation warning
+	rt.handle("/oapi/v1/projects", deprecatedOAPI(s.handleProjectList), get)
+	rt.handle("/oapi/v1/projects/{name}", deprecatedOAPI(named(s.handleProjectByName)), get)
+	rt.handle("/oapi/v1/projects/{name}", deprecatedOAPI(named(s.updateProject)), put)
+	rt.handle("/oapi/v1/projects/{name}", deprecatedOAPI(named(s.patchProject)), patch)
+	rt.handle("/oapi/v1/projects/{name}", deprecatedOAPI(named(s.deleteProject)), del)
+	rt.handle("/oapi/v1/projects/{name}/status", deprecatedOAPI(named(s.handleProjectByName)), get)
+	rt.handle("/oapi/{path...}", s.handleOAPINotFound, get)
+
+	// Image and network API endpoints (podman.io/v1)
+	rt.handle("/apis/podman.io/v1/images", s.listImages, get)
+	rt.handle("/apis/podman.io/v1/images", func(w http.ResponseWriter, r *http.Request) { s.createObjects(w, r, "", s.pullImage) }, post)
+	rt.handle("/apis/podman.io/v1/images/{name}", named(s.getImage), get)
+	rt.handle("/apis/podman.io/v1/images/{name}", named(s.deleteImage), del)
+	rt.handle("/apis/podman.io/v1/networks", s.listNetworks, get)
+	rt.handle("/apis/podman.io/v1/networks", func(w http.ResponseWriter, r *http.Request) { s.createObjects(w, r, "", s.createNetwork) }, post)
+	rt.handle("/apis/podman.io/v1/networks/{name}", named(s.getNetwork), get)
+	rt.handle("/apis/podman.io/v1/networks/{name}", named(s.deleteNetwork), del)
+
+	// Node API endpoints
+	s.registerREST(rt, "/api/v1", restResource{
+		Resource: schema.GroupResource{Resource: "nodes"},
+		Kind:     "Node",
+		Storage:  &nodeREST{server: s},
+	})
+	rt.handle("/api/v1/nodes/{name}/proxy/logs", named(s.handleNodeLogsProxy), get)
+	rt.handle("/api/v1/nodes/{name}/proxy/logs/{path...}", named(s.handleNodeLogsProxy), get)
 
-	// Create Kubernetes-compatible namespace objects
-	var namespaceItems []corev1.Namespace
-	for _, ns := range namespaces {
-		namespaceItems = append(namespaceItems, corev1.Namespace{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Namespace",
-				APIVersion: "v1",
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name: ns,
-			},
-		})
-	}
+	// Pod API endpoints
+	rt.handle("/api/v1/pods", namespaced(s.listPods), get)
+	rt.handle("/api/v1/pods", namespaced(s.createPod), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods", namespaced(s.listPods), get)
+	rt.watchable("/api/v1/pods")
+	rt.watchable("/api/v1/namespaces/{namespace}/pods")
+	rt.handle("/api/v1/namespaces/{namespace}/pods", namespaced(func(w http.ResponseWriter, r *http.Request, namespace string) {
+		s.createObjects(w, r, namespace, func(w http.ResponseWriter, r *http.Request) { s.createPod(w, r, namespace) })
+	}), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}", namespacedName(s.getPod), get)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}", namespacedName(s.updatePod), put)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}", namespacedName(s.patchPod), patch)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}", namespacedName(s.deletePod), del)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/log", namespacedName(s.handlePodLogs), get)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/exec", namespacedName(s.handlePodExec), get, post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/binding", namespacedName(s.handlePodBinding), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/checkpoint", namespacedName(s.handlePodCheckpoint), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/restore", namespacedName(s.handlePodRestore), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/pause", namespacedName(s.handlePodPause), post)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/unpause", namespacedName(s.handlePodUnpause), post)
+	proxy := namespacedName(func(w http.ResponseWriter, r *http.Request, namespace, name string) {
+		s.handlePodProxy(w, r, namespace, name, "/"+r.PathValue("path"))
+	})
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/proxy", proxy)
+	rt.handle("/api/v1/namespaces/{namespace}/pods/{name}/proxy/{path...}", proxy)
 
-	namespaceList := &corev1.NamespaceList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "NamespaceList",
-			APIVersion: "v1",
-		},
-		Items: namespaceItems,
-	}
+	// Secret API endpoints
+	s.registerREST(rt, "/api/v1", restResource{
+		Resource:   secretResource,
+		Kind:       "Secret",
+		Namespaced: true,
+		Storage:    &secretREST{server: s},
+	})
+	rt.handle("/api/v1/namespaces/{namespace}/serviceaccounts/{name}/token", namespacedName(s.createServiceAccountToken), post)
+
+	// Service API endpoints, serving the kubernetes service
+	s.registerREST(rt, "/api/v1", restResource{
+		Resource:   serviceResource,
+		Kind:       "Service",
+		Namespaced: true,
+		Storage:    &serviceREST{server: s},
+	})
+	serviceProxy := namespacedName(func(w http.ResponseWriter, r *http.Request, namespace, name string) {
+		s.handleServiceProxy(w, r, namespace, name, "/"+r.PathValue("path"))
+	})
+	rt.handle("/api/v1/namespaces/{namespace}/services/{name}/proxy", serviceProxy)
+	rt.handle("/api/v1/namespaces/{namespace}/services/{name}/proxy/{path...}", serviceProxy)
 
-	s.writeJSON(w, namespaceList)
-}
+	// API priority and fairness stubs (flowcontrol.apiserver.k8s.io)
+	s.registerFlowcontrol(rt)
 
-// handleProjectList handles requests to /apis/project.openshift.io/v1/projects and /oapi/v1/projects
-func (s *Server) handleProjectList(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	// Node leases (coordination.k8s.io)
+	s.registerCoordination(rt)
 
-	projectList := s.podStorage.ListProjects()
-	s.writeJSON(w, projectList)
-}
+	// OpenShift routes (route.openshift.io)
+	s.registerRouteAPI(rt)
 
-// handleProjectByName handles requests to /apis/project.openshift.io/v1/projects/{name}
-func (s *Server) handleProjectByName(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+	// Self subject rules reviews (authorization.k8s.io)
+	s.registerAuthorizationAPI(rt)
 
-	// Parse the project name from URL
-	path := strings.TrimPrefix(r.URL.Path, "/apis/project.openshift.io/v1/projects/")
-	projectName := strings.Split(path, "/")[0]
+	// Web UI
+	s.registerUI(rt)
 
-	if projectName == "" {
-		http.Error(w, "Project name is required", http.StatusBadRequest)
-		return
-	}
+	// Metrics and debug endpoints
+	rt.handle("/metrics", s.handleMetrics, get)
+	rt.handle("/debug/sessions", s.handleSessionList, get)
+	rt.handle("/debug/clients", s.handleClientList, get)
+	rt.handle("/debug/sessions/{name}", named(s.handleSessionTerminate), del)
+	rt.handle("/debug/bundle", s.handleBundle, get)
+	rt.handle("/debug/backup", s.handleBackup, get)
+	rt.handle("/logs", s.handleLogs, get)
+	rt.handle("/logs/{path...}", s.handleLogs, get)
 
-	// Get the list of available namespaces
-	namespaces := s.podStorage.ListNamespaces()
+	// Health and version endpoints
+	rt.handle("/healthz", s.handleHealth, get)
+	rt.handle("/readyz", s.handleReadyz, get)
+	rt.handle("/readyz/", s.handleReadyz, get)
+	rt.handle("/livez", s.handleHealth, get)
+	rt.handle("/version", s.handleVersion, get)
 
-	// Check if the requested project exists
-	projectExists := false
-	for _, ns := range namespaces {
-		if ns == projectName {
-			projectExists = true
-			break
-		}
-	}
+	rt.logRoutes()
+}
 
-	if !projectExists {
-		http.Error(w, fmt.Sprintf(`projects.project.openshift.io "%s" not found`, projectName), http.StatusNotFound)
-		return
+// handleNamespaceList handles requests to /api/v1/namespaces
+func (s *Server) handleNamespaceList(w http.ResponseWriter, r *http.Request) {
+	// Create Kubernetes-compatible namespace objects from the projects of the namespaces
+	var namespaceItems []corev1.Namespace
+	for _, project := range s.podStorage.ListProjects().Items {
+		namespaceItems = append(namespaceItems, projectToNamespace(&project))
 	}
 
-	// Return the specific project
-	project := &storage.Project{
+	namespaceList := &corev1.NamespaceList{
 		TypeMeta: metav1.TypeMeta{
-			Kind:       "Project",
-			APIVersion: "project.openshift.io/v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: projectName,
-			Annotations: map[string]string{
-				"openshift.io/display-name": projectName,
-				"openshift.io/description":  fmt.Sprintf("Project for %s", projectName),
-			},
-		},
-		Spec: storage.ProjectSpec{
-			Finalizers: []string{"kubernetes"},
-		},
-		Status: storage.ProjectStatus{
-			Phase: "Active",
+			Kind:       "NamespaceList",
+			APIVersion: "v1",
 		},
+		Items: namespaceItems,
 	}
 
-	s.writeJSON(w, project)
-}
-
-// handleClusterPods handles requests to /api/v1/pods (cluster-wide pods)
-func (s *Server) handleClusterPods(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.listPods(w, r, "")
-	case http.MethodPost:
-		s.createPod(w, r, "")
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
-// handleClusterSecrets handles requests to /api/v1/secrets (cluster-wide secrets)
-func (s *Server) handleClusterSecrets(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		s.listSecrets(w, r, "")
-	case http.MethodPost:
-		s.createSecret(w, r, "")
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, namespaceListToTable(namespaceList, s.namespacePodCounts(r.Context())))
+	} else {
+		s.writeObject(w, r, namespaceList)
 	}
 }
 
-// handleNamespacedResources handles requests to /api/v1/namespaces/{namespace}/...
-func (s *Server) handleNamespacedResources(w http.ResponseWriter, r *http.Request) {
-	// Parse the path: /api/v1/namespaces/{namespace}/{resource}[/{name}]
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/")
-	parts := strings.Split(path, "/")
-
-	if len(parts) < 2 {
-		http.NotFound(w, r)
-		return
-	}
-
-	namespace := parts[0]
-	resource := parts[1]
-
-	// Handle pods
-	if resource == "pods" {
-		// Handle pod logs requests: /api/v1/namespaces/{namespace}/pods/{name}/log
-		if len(parts) == 4 && parts[3] == "log" {
-			podName := parts[2]
-			s.handlePodLogs(w, r, namespace, podName)
-			return
-		}
-
-		// Handle pod exec requests: /api/v1/namespaces/{namespace}/pods/{name}/exec
-		if len(parts) == 4 && parts[3] == "exec" {
-			podName := parts[2]
-			s.handlePodExec(w, r, namespace, podName)
-			return
-		}
-
-		// Handle specific pod requests
-		if len(parts) == 3 {
-			podName := parts[2]
-			s.handlePodByName(w, r, namespace, podName)
-			return
-		}
-
-		// Handle pod list for namespace
-		switch r.Method {
-		case http.MethodGet:
-			s.listPods(w, r, namespace)
-		case http.MethodPost:
-			s.createPod(w, r, namespace)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+// handleProjectList handles requests to /apis/project.openshift.io/v1/projects and /oapi/v1/projects
+func (s *Server) handleProjectList(w http.ResponseWriter, r *http.Request) {
+	// Projects are not watchable: reject watches rather than answering them with a list
+	if r.URL.Query().Get("watch") == "true" {
+		s.writeStatusError(w, apierrors.NewMethodNotSupported(projectResource, "watch"))
 		return
 	}
 
-	// Handle secrets
-	if resource == "secrets" {
-		// Handle specific secret requests
-		if len(parts) == 3 {
-			secretName := parts[2]
-			s.handleSecretByName(w, r, namespace, secretName)
-			return
-		}
-
-		// Handle secret list for namespace
-		switch r.Method {
-		case http.MethodGet:
-			s.listSecrets(w, r, namespace)
-		case http.MethodPost:
-			s.createSecret(w, r, namespace)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-		return
+	projectList := s.podStorage.ListProjects()
+	if strings.Contains(r.Header.Get("Accept"), "as=Table") {
+		s.writeTable(w, r, projectListToTable(projectList, s.namespacePodCounts(r.Context())))
+	} else {
+		s.writeObject(w, r, projectList)
 	}
-
-	http.NotFound(w, r)
 }
 
-// handlePodByName handles requests for specific pods
-func (s *Server) handlePodByName(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	switch r.Method {
-	case http.MethodGet:
-		s.getPod(w, r, namespace, name)
-	case http.MethodPut:
-		s.updatePod(w, r, namespace, name)
-	case http.MethodDelete:
-		s.deletePod(w, r, namespace, name)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleProjectByName handles requests to /apis/project.openshift.io/v1/projects/{name} and its
+// status subresource
+func (s *Server) handleProjectByName(w http.ResponseWriter, r *http.Request, projectName string) {
+	project, ok := s.getProject(w, projectResource, projectName)
+	if !ok {
+		return
 	}
+	s.podStorage.AnnotateProjectStatus(r.Context(), project)
+	s.writeProject(w, r, project)
 }
 
 // listPods lists pods, optionally filtered by namespace
@@ -475,14 +447,29 @@ func (s *Server) listPods(w http.ResponseWriter, r *http.Request, namespace stri
 	labelSelector := r.URL.Query().Get("labelSelector")
 	fieldSelector := r.URL.Query().Get("fieldSelector")
 	watchParam := r.URL.Query().Get("watch")
+	if _, err := storage.ParsePodFieldSelector(fieldSelector); err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid field selector %q: %v", fieldSelector, err)))
+		return
+	}
 
 	// Handle watch requests
 	if watchParam == "true" {
-		s.watchPods(w, r, namespace, labelSelector, fieldSelector)
+		switch fallback := r.URL.Query().Get("fallback"); fallback {
+		case "":
+			s.watchPods(w, r, namespace, labelSelector, fieldSelector)
+		case "longpoll":
+			s.longPollPods(w, r, namespace, labelSelector, fieldSelector)
+		default:
+			s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("unsupported watch fallback %q, only longpoll is", fallback)))
+		}
 		return
 	}
 
-	podList, err := s.podStorage.List(namespace, labelSelector, fieldSelector)
+	podList, err := s.podStorage.List(r.Context(), namespace, labelSelector, fieldSelector)
+	if errors.Is(err, storage.ErrPodmanUnavailable) {
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		return
+	}
 	if err != nil {
 		klog.Errorf("Failed to list pods: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to list pods: %v", err), http.StatusInternalServerError)
@@ -493,12 +480,17 @@ func (s *Server) listPods(w http.ResponseWriter, r *http.Request, namespace stri
 	acceptHeader := r.Header.Get("Accept")
 	if strings.Contains(acceptHeader, "as=Table") {
 		table := s.podListToTable(podList)
-		s.writeJSON(w, table)
+		table.ResourceVersion = podList.ResourceVersion
+		s.writeTable(w, r, table)
 	} else {
-		s.writeJSON(w, podList)
+		s.writeObject(w, r, podList)
 	}
 }
 
+// watchResyncInterval is how often pod watches list the pods when no change woke them up,
+// for the changes podman events do not report, as while their stream is down
+const watchResyncInterval = 5 * time.Second
+
 // watchPods handles watch requests for pods
 func (s *Server) watchPods(w http.ResponseWriter, r *http.Request, namespace, labelSelector, fieldSelector string) {
 	klog.Infof("Starting watch for pods in namespace %q with fieldSelector=%q labelSelector=%q", namespace, fieldSelector, labelSelector)
@@ -519,13 +511,27 @@ func (s *Server) watchPods(w http.ResponseWriter, r *http.Request, namespace, la
 	// Check if client wants table format
 	acceptHeader := r.Header.Get("Accept")
 	isTableFormat := strings.Contains(acceptHeader, "as=Table")
+	includeObject, err := includeObjectPolicy(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	sendInitialEvents, initialEventsEnd, statusErr := watchInitialEvents(r)
+	if statusErr != nil {
+		s.writeStatusError(w, statusErr)
+		return
+	}
 
 	// Write response header
 	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
 
+	// Changes are awaited from before the first list, so that none is missed
+	ctx := r.Context()
+	changed := s.podStorage.Changed(ctx)
+
 	// Get current pods and send them as ADDED events
-	podList, err := s.podStorage.List(namespace, labelSelector, fieldSelector)
+	podList, err := s.podStorage.List(ctx, namespace, labelSelector, fieldSelector)
 	if err != nil {
 		klog.Errorf("Failed to list pods for watch: %v", err)
 		return
@@ -549,6 +555,9 @@ func (s *Server) watchPods(w http.ResponseWriter, r *http.Request, namespace, la
 	for _, pod := range podList.Items {
 		key := s.podKey(pod.Namespace, pod.Name)
 		previousPods[key] = pod.DeepCopy()
+		if !sendInitialEvents {
+			continue
+		}
 
 		// Send ADDED event for this existing pod
 		if isTableFormat {
@@ -556,6 +565,7 @@ func (s *Server) watchPods(w http.ResponseWriter, r *http.Request, namespace, la
 				Items: []corev1.Pod{pod},
 			}
 			table := s.podListToTable(singlePodList)
+			applyIncludeObject(table, includeObject)
 			event := &metav1.WatchEvent{
 				Type:   string(watch.Added),
 				Object: *s.tableRowToRawExtension(table, 0),
@@ -580,91 +590,118 @@ func (s *Server) watchPods(w http.ResponseWriter, r *http.Request, namespace, la
 		klog.Infof("Sent initial ADDED event for pod %s", key)
 	}
 
-	// Keep connection alive and watch for changes
-	ticker := time.NewTicker(5 * time.Second) // Check more frequently for changes
+	// End the initial events of a watch list with a bookmark at the resourceVersion of the list
+	if initialEventsEnd && !isTableFormat {
+		if err := s.writeWatchBookmark(w, metav1.ObjectMeta{
+			ResourceVersion: podList.ResourceVersion,
+			Annotations:     map[string]string{metav1.InitialEventsAnnotationKey: "true"},
+		}); err != nil {
+			klog.Errorf("Failed to send the initial events bookmark: %v", err)
+			return
+		}
+	}
+
+	// Keep connection alive and watch for changes: the pods are listed again as soon as podman
+	// events or writes change them, and periodically for the changes events do not report
+	ticker := time.NewTicker(watchResyncInterval)
 	defer ticker.Stop()
 
-	ctx := r.Context()
 	for {
 		select {
 		case <-ctx.Done():
 			klog.Infof("Watch connection closed by client")
 			return
-		case <-ticker.C:
-			// Check for actual changes
-			currentPods, err := s.podStorage.List(namespace, labelSelector, fieldSelector)
-			if err != nil {
-				klog.Errorf("Failed to refresh pods during watch: %v", err)
-				continue
+		case <-s.shutdownCh:
+			klog.Infof("Server shutting down, ending watch")
+			if r.URL.Query().Get("allowWatchBookmarks") == "true" && !isTableFormat {
+				if err := s.writeWatchBookmark(w, metav1.ObjectMeta{}); err != nil {
+					klog.Errorf("Failed to send final watch bookmark: %v", err)
+				}
 			}
+			return
+		case <-changed:
+			changed = s.podStorage.Changed(ctx)
+		case <-ticker.C:
+		}
 
-			// Detect changes and send appropriate events
-			changes := s.detectPodChanges(previousPods, currentPods.Items)
-
-			if len(changes) > 0 {
-				klog.V(2).Infof("Detected %d pod changes", len(changes))
-
-				if isTableFormat {
-					// Send table format events for changes only
-					table := s.podListToTable(currentPods)
-					podIndexMap := make(map[string]int)
-					for i, pod := range currentPods.Items {
-						key := s.podKey(pod.Namespace, pod.Name)
-						podIndexMap[key] = i
-					}
+		// Check for actual changes
+		currentPods, err := s.podStorage.List(ctx, namespace, labelSelector, fieldSelector)
+		if err != nil {
+			klog.Errorf("Failed to refresh pods during watch: %v", err)
+			continue
+		}
 
-					for _, change := range changes {
-						var event *metav1.WatchEvent
+		// Detect changes and send appropriate events
+		changes := s.detectPodChanges(previousPods, currentPods.Items)
 
-						switch change.Type {
-						case string(watch.Added), string(watch.Modified):
-							if idx, exists := podIndexMap[change.Key]; exists {
-								event = &metav1.WatchEvent{
-									Type:   change.Type,
-									Object: *s.tableRowToRawExtension(table, idx),
-								}
-							}
-						case string(watch.Deleted):
-							// For deleted pods, create a minimal table row
-							deletedTable := s.createDeletedPodTable(change.Pod)
-							event = &metav1.WatchEvent{
-								Type:   change.Type,
-								Object: *s.tableRowToRawExtension(deletedTable, 0),
-							}
-						}
+		if len(changes) > 0 {
+			klog.V(2).Infof("Detected %d pod changes", len(changes))
 
-						if event != nil {
-							if err := encoder.Encode(event); err != nil {
-								klog.Errorf("Failed to encode watch event: %v", err)
-								return
-							}
-							flusher.Flush()
-						}
-					}
-				} else {
-					// Send regular pod format events for changes only
-					for _, change := range changes {
-						event := &metav1.WatchEvent{
-							Type:   change.Type,
-							Object: *s.podToRawExtension(change.Pod),
-						}
-						if err := encoder.Encode(event); err != nil {
-							klog.Errorf("Failed to encode watch event: %v", err)
-							return
-						}
-						flusher.Flush()
-					}
+			for _, event := range s.podChangeEvents(changes, currentPods, isTableFormat, includeObject) {
+				if err := encoder.Encode(&event); err != nil {
+					klog.Errorf("Failed to encode watch event: %v", err)
+					return
 				}
+				flusher.Flush()
 			}
+		}
+
+		// Update previous pods state
+		previousPods = s.podsByKey(currentPods.Items)
+	}
+}
+
+// podChangeEvents returns the watch events of pod changes, as rows of the table of the current
+// pods when isTable
+func (s *Server) podChangeEvents(changes []PodChange, currentPods *corev1.PodList, isTable bool, includeObject metav1.IncludeObjectPolicy) []metav1.WatchEvent {
+	events := make([]metav1.WatchEvent, 0, len(changes))
+	if !isTable {
+		for _, change := range changes {
+			events = append(events, metav1.WatchEvent{
+				Type:   change.Type,
+				Object: *s.podToRawExtension(change.Pod),
+			})
+		}
+		return events
+	}
+
+	table := s.podListToTable(currentPods)
+	applyIncludeObject(table, includeObject)
+	podIndexMap := make(map[string]int)
+	for i, pod := range currentPods.Items {
+		key := s.podKey(pod.Namespace, pod.Name)
+		podIndexMap[key] = i
+	}
 
-			// Update previous pods state
-			previousPods = make(map[string]*corev1.Pod)
-			for _, pod := range currentPods.Items {
-				key := s.podKey(pod.Namespace, pod.Name)
-				previousPods[key] = pod.DeepCopy()
+	for _, change := range changes {
+		switch change.Type {
+		case string(watch.Added), string(watch.Modified):
+			if idx, exists := podIndexMap[change.Key]; exists {
+				events = append(events, metav1.WatchEvent{
+					Type:   change.Type,
+					Object: *s.tableRowToRawExtension(table, idx),
+				})
 			}
+		case string(watch.Deleted):
+			// For deleted pods, create a minimal table row
+			deletedTable := s.createDeletedPodTable(change.Pod)
+			applyIncludeObject(deletedTable, includeObject)
+			events = append(events, metav1.WatchEvent{
+				Type:   change.Type,
+				Object: *s.tableRowToRawExtension(deletedTable, 0),
+			})
 		}
 	}
+	return events
+}
+
+// podsByKey returns copies of pods by their key, as compared by detectPodChanges
+func (s *Server) podsByKey(pods []corev1.Pod) map[string]*corev1.Pod {
+	byKey := make(map[string]*corev1.Pod, len(pods))
+	for i := range pods {
+		byKey[s.podKey(pods[i].Namespace, pods[i].Name)] = pods[i].DeepCopy()
+	}
+	return byKey
 }
 
 // PodChange represents a change detected in pod state
@@ -738,6 +775,16 @@ func (s *Server) detectPodChanges(previousPods map[string]*corev1.Pod, currentPo
 func (s *Server) podChanged(previous, current *corev1.Pod) bool {
 	// Don't check ResourceVersion - it changes too frequently for internal reasons
 
+	// Check the metadata changed by deletions and finalizer updates
+	if !previous.DeletionTimestamp.Equal(current.DeletionTimestamp) {
+		klog.V(2).Infof("Pod %s: DeletionTimestamp changed", current.Name)
+		return true
+	}
+	if !slices.Equal(previous.Finalizers, current.Finalizers) {
+		klog.V(2).Infof("Pod %s: Finalizers changed %v -> %v", current.Name, previous.Finalizers, current.Finalizers)
+		return true
+	}
+
 	// Check status phase
 	if previous.Status.Phase != current.Status.Phase {
 		klog.V(2).Infof("Pod %s: Phase changed %s -> %s", current.Name, previous.Status.Phase, current.Status.Phase)
@@ -790,38 +837,36 @@ func (s *Server) getPodConditionSummary(pod *corev1.Pod) string {
 
 // createDeletedPodTable creates a table representation for a deleted pod
 func (s *Server) createDeletedPodTable(pod *corev1.Pod) *metav1.Table {
+	// Custom columns are rendered from the last known state of the pod
+	if columns := s.customPodColumns(); columns != nil {
+		return customPodListToTable(&corev1.PodList{Items: []corev1.Pod{*pod}}, columns)
+	}
+
+	// The row carries the pod so that --show-labels renders its labels like for live pods
 	table := &metav1.Table{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Table",
 			APIVersion: "meta.k8s.io/v1",
 		},
-		ColumnDefinitions: []metav1.TableColumnDefinition{
-			{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace"},
-			{Name: "Ready", Type: "string", Description: "The aggregate readiness state of this pod for accepting traffic"},
-			{Name: "Status", Type: "string", Description: "The aggregate status of the containers in this pod"},
-			{Name: "Restarts", Type: "integer", Description: "The number of times the containers in this pod have been restarted", Priority: 1},
-			{Name: "Age", Type: "string", Description: "Time since the container started running"},
-			{Name: "Created", Type: "string", Description: "When the container was created"},
-			{Name: "Image", Type: "string", Description: "The image the container is running", Priority: 1},
-			{Name: "Command", Type: "string", Description: "The command the container is running", Priority: 1},
-			{Name: "Ports", Type: "string", Description: "The ports exposed by the container", Priority: 1},
-			{Name: "Container-ID", Type: "string", Description: "Container ID", Priority: 1},
-			{Name: "Labels", Type: "string", Description: "Labels assigned to the pod"},
-		},
+		ColumnDefinitions: podColumnDefinitions,
 		Rows: []metav1.TableRow{
 			{
 				Cells: []interface{}{
 					pod.Name,
-					"0/0",
+					fmt.Sprintf("0/%d", len(pod.Spec.Containers)),
 					"Terminating",
-					0,
+					podRestarts(pod),
 					"<unknown>",
 					"<unknown>",
+					valueOrNone(pod.Status.PodIP),
+					valueOrNone(pod.Spec.NodeName),
 					"<none>",
 					"<none>",
 					"<none>",
 					"<none>",
-					s.formatLabelsForTable(pod.Labels),
+				},
+				Object: runtime.RawExtension{
+					Object: pod.DeepCopy(),
 				},
 			},
 		},
@@ -880,25 +925,36 @@ func (s *Server) tableRowToRawExtension(table *metav1.Table, rowIndex int) *runt
 	}
 }
 
-// podListToTable converts a PodList to Table format with custom columns
+// podColumnDefinitions are the default columns of pod tables, those of kubectl get pods with
+// IP and Node shown by -o wide, and podman details
+var podColumnDefinitions = []metav1.TableColumnDefinition{
+	{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace"},
+	{Name: "Ready", Type: "string", Description: "The aggregate readiness state of this pod for accepting traffic"},
+	{Name: "Status", Type: "string", Description: "The aggregate status of the containers in this pod"},
+	{Name: "Restarts", Type: "string", Description: "The number of times the containers in this pod have been restarted and when the last container in this pod has restarted"},
+	{Name: "Age", Type: "string", Description: "Time since the container started running"},
+	{Name: "Created", Type: "string", Description: "When the container was created"},
+	{Name: "IP", Type: "string", Description: "IP address allocated to the pod", Priority: 1},
+	{Name: "Node", Type: "string", Description: "Name of the node the pod runs on", Priority: 1},
+	{Name: "Image", Type: "string", Description: "The image the container is running", Priority: 1},
+	{Name: "Command", Type: "string", Description: "The command the container is running", Priority: 1},
+	{Name: "Ports", Type: "string", Description: "The ports exposed by the container", Priority: 1},
+	{Name: "Container-ID", Type: "string", Description: "Container ID", Priority: 1},
+}
+
+// podListToTable converts a PodList to Table format, with the columns set by SetPodColumns
+// or podman-flavored default columns
 func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
+	if columns := s.customPodColumns(); columns != nil {
+		return customPodListToTable(podList, columns)
+	}
+
 	table := &metav1.Table{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Table",
 			APIVersion: "meta.k8s.io/v1",
 		},
-		ColumnDefinitions: []metav1.TableColumnDefinition{
-			{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace"},
-			{Name: "Ready", Type: "string", Description: "The aggregate readiness state of this pod for accepting traffic"},
-			{Name: "Status", Type: "string", Description: "The aggregate status of the containers in this pod"},
-			{Name: "Restarts", Type: "integer", Description: "The number of times the containers in this pod have been restarted", Priority: 1},
-			{Name: "Age", Type: "string", Description: "Time since the container started running"},
-			{Name: "Created", Type: "string", Description: "When the container was created"},
-			{Name: "Image", Type: "string", Description: "The image the container is running", Priority: 1},
-			{Name: "Command", Type: "string", Description: "The command the container is running", Priority: 1},
-			{Name: "Ports", Type: "string", Description: "The ports exposed by the container", Priority: 1},
-			{Name: "Container-ID", Type: "string", Description: "Container ID", Priority: 1},
-		},
+		ColumnDefinitions: podColumnDefinitions,
 	}
 
 	// Convert each pod to a table row
@@ -922,7 +978,6 @@ func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
 		ports := "<none>"
 		readyContainers := 0
 		totalContainers := len(pod.Status.ContainerStatuses)
-		restarts := int32(0)
 
 		// Get command and ports from pod spec
 		if len(pod.Spec.Containers) > 0 {
@@ -963,8 +1018,7 @@ func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
 			if containerStatus.ContainerID != "" {
 				// Extract short container ID
 				fullID := containerStatus.ContainerID
-				if strings.HasPrefix(fullID, "podman://") {
-					shortID := strings.TrimPrefix(fullID, "podman://")
+				if _, shortID, ok := strings.Cut(fullID, "://"); ok {
 					if len(shortID) >= 12 {
 						containerID = shortID[:12]
 					} else {
@@ -974,7 +1028,8 @@ func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
 					containerID = fullID
 				}
 			}
-			restarts = containerStatus.RestartCount
+		}
+		for _, containerStatus := range pod.Status.ContainerStatuses {
 			if containerStatus.Ready {
 				readyContainers++
 			}
@@ -989,10 +1044,12 @@ func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
 			Cells: []interface{}{
 				pod.Name,
 				ready,
-				string(pod.Status.Phase),
-				restarts,
+				podStatusReason(&pod),
+				podRestarts(&pod),
 				age,
 				created,
+				valueOrNone(pod.Status.PodIP),
+				valueOrNone(pod.Spec.NodeName),
 				image,
 				command,
 				ports,
@@ -1008,25 +1065,64 @@ func (s *Server) podListToTable(podList *corev1.PodList) *metav1.Table {
 	return table
 }
 
-// formatLabelsForTable formats pod labels for table display
-func (s *Server) formatLabelsForTable(labels map[string]string) string {
-	if len(labels) == 0 {
-		return "<none>"
+// podStatusReason returns the status of a pod as kubectl shows it: the reason a container is
+// waiting or terminated (CrashLoopBackOff, ContainerCreating, Completed, Error...) when there
+// is one, Paused for pods with a paused container, Terminating for pods being deleted, and
+// its phase otherwise
+func podStatusReason(pod *corev1.Pod) string {
+	reason := string(pod.Status.Phase)
+	if pod.Status.Reason != "" {
+		reason = pod.Status.Reason
+	}
+	running := false
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		switch state := containerStatus.State; {
+		case state.Waiting != nil && state.Waiting.Reason != "":
+			reason = state.Waiting.Reason
+		case state.Terminated != nil && state.Terminated.Reason != "":
+			reason = state.Terminated.Reason
+		case state.Running != nil:
+			running = true
+		}
 	}
-
-	// Create key=value pairs
-	var labelPairs []string
-	for key, value := range labels {
-		labelPairs = append(labelPairs, fmt.Sprintf("%s=%s", key, value))
+	if reason == "Completed" && running {
+		// Containers still running in a pod where another completed
+		reason = string(corev1.PodRunning)
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == "Paused" && condition.Status == corev1.ConditionTrue {
+			reason = "Paused"
+		}
 	}
+	if pod.DeletionTimestamp != nil {
+		reason = "Terminating"
+	}
+	return reason
+}
 
-	// Join with commas, but truncate if too long for table display
-	result := strings.Join(labelPairs, ",")
-	if len(result) > 60 { // Limit to 60 characters for table readability
-		result = result[:57] + "..."
+// podRestarts formats the restarts of the containers of a pod like kubectl does: their total,
+// followed by the time since the last one when known, e.g. "3 (5m ago)"
+func podRestarts(pod *corev1.Pod) string {
+	restarts := int32(0)
+	var lastRestart metav1.Time
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		restarts += containerStatus.RestartCount
+		if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil && lastRestart.Before(&terminated.FinishedAt) {
+			lastRestart = terminated.FinishedAt
+		}
+	}
+	if restarts == 0 || lastRestart.IsZero() {
+		return strconv.Itoa(int(restarts))
 	}
+	return fmt.Sprintf("%d (%s ago)", restarts, duration.HumanDuration(time.Since(lastRestart.Time)))
+}
 
-	return result
+// valueOrNone returns value, or <none> when it is empty
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
 }
 
 // translateTimestampSince returns the elapsed time since timestamp in podman ps format
@@ -1101,11 +1197,14 @@ func translateTimestampSinceCreated(timestamp metav1.Time) string {
 	}
 }
 
-// getPod retrieves a specific pod
+// getPod retrieves a specific pod, or with export=true its manifest cleaned up by
+// storage.ExportPod
 func (s *Server) getPod(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	pod, err := s.podStorage.Get(namespace, name)
+	pod, err := s.podStorage.Get(r.Context(), namespace, name)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
 		} else {
 			klog.Errorf("Failed to get pod %s/%s: %v", namespace, name, err)
@@ -1114,6 +1213,12 @@ func (s *Server) getPod(w http.ResponseWriter, r *http.Request, namespace, name
 		return
 	}
 
+	// A cleaned manifest to apply elsewhere, in the requested format
+	if r.URL.Query().Get("export") == "true" {
+		s.writeObject(w, r, storage.ExportPod(pod))
+		return
+	}
+
 	// Check if client wants table format (oc get pod uses this)
 	acceptHeader := r.Header.Get("Accept")
 	if strings.Contains(acceptHeader, "as=Table") {
@@ -1124,24 +1229,40 @@ func (s *Server) getPod(w http.ResponseWriter, r *http.Request, namespace, name
 			},
 			Items: []corev1.Pod{*pod},
 		}
-		table := s.podListToTable(podList)
-		s.writeJSON(w, table)
+		s.writeTable(w, r, s.podListToTable(podList))
 	} else {
-		s.writeJSON(w, pod)
+		s.writeObject(w, r, pod)
 	}
 }
 
 // createPod creates a new pod
 func (s *Server) createPod(w http.ResponseWriter, r *http.Request, namespace string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
 	var pod corev1.Pod
-	if err := json.NewDecoder(r.Body).Decode(&pod); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode pod: %v", err), http.StatusBadRequest)
+	if err := decodeBody(w, r, &pod); err != nil {
+		s.writeDecodeError(w, "pod", err)
+		return
+	}
+
+	// Admit the pod: defaults are applied before the name is generated, validation after
+	admission := s.podAdmission()
+	attrs := &admissionAttributes{operation: admissionCreate, namespace: namespace, dryRun: dryRun, user: requestUser(r)}
+	statusErr := admission.mutate(r.Context(), attrs, &pod)
+	attrs.flushWarnings(w)
+	if statusErr != nil {
+		s.writeStatusError(w, statusErr)
 		return
 	}
 
-	// Set namespace from URL if not specified in the pod
-	if pod.Namespace == "" {
-		pod.Namespace = namespace
+	generated := pod.Name == ""
+	if err := assignName(&pod.ObjectMeta); err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
 	}
 
 	// Validate namespace matches URL
@@ -1150,10 +1271,50 @@ func (s *Server) createPod(w http.ResponseWriter, r *http.Request, namespace str
 		return
 	}
 
-	createdPod, err := s.podStorage.Create(&pod)
+	statusErr = admission.validate(r.Context(), attrs, &pod)
+	attrs.flushWarnings(w)
+	if statusErr != nil {
+		s.writeStatusError(w, statusErr)
+		return
+	}
+
+	// Report the fields that would be dropped; debug copies of a pod are expected to carry some.
+	// Pods podman run cannot express are created with podman kube play, which honors more fields.
+	unsupportedFields := storage.UnsupportedPodFields
+	if storage.RequiresKubePlay(&pod) {
+		unsupportedFields = storage.KubePlayUnsupportedPodFields
+	}
+	if errs := unsupportedFields(&pod); len(errs) > 0 {
+		_, isDebugPod := pod.Annotations["debug.openshift.io/source-container"]
+		if !s.tolerateUnsupportedFields.Load() && !isDebugPod {
+			s.writeStatusError(w, unsupportedFieldsError(&pod, errs))
+			return
+		}
+		for _, fieldErr := range errs {
+			addWarning(w, fieldErr.Error())
+		}
+	}
+
+	var createdPod *corev1.Pod
+	for attempt := 1; ; attempt++ {
+		if dryRun {
+			createdPod, err = s.podStorage.DryRunCreate(r.Context(), &pod)
+		} else {
+			createdPod, err = s.podStorage.Create(r.Context(), &pod)
+		}
+		if !retryGeneratedName(&pod.ObjectMeta, generated, attempt, err) {
+			break
+		}
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			http.Error(w, err.Error(), http.StatusConflict)
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if errors.Is(err, storage.ErrUnschedulable) || errors.Is(err, storage.ErrKubePlayUnsupported) {
+			s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		} else if errors.Is(err, storage.ErrImagePull) || errors.Is(err, storage.ErrImagePullBackOff) {
+			s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		} else if strings.Contains(err.Error(), "already exists") {
+			s.adoptPod(w, r, &pod, dryRun, err)
 		} else {
 			klog.Errorf("Failed to create pod: %v", err)
 			http.Error(w, fmt.Sprintf("Failed to create pod: %v", err), http.StatusInternalServerError)
@@ -1161,18 +1322,133 @@ func (s *Server) createPod(w http.ResponseWriter, r *http.Request, namespace str
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(createdPod); err != nil {
-		klog.Errorf("Failed to encode created pod: %v", err)
+	s.writeObjectWithStatus(w, r, http.StatusCreated, createdPod)
+}
+
+// adoptPod answers the creation of a pod whose name is taken, which failed with createErr: the
+// existing pod is adopted and returned when its spec is equivalent, so that creating the same
+// pod again, or over a container run with podman, succeeds; the creation conflicts otherwise
+func (s *Server) adoptPod(w http.ResponseWriter, r *http.Request, pod *corev1.Pod, dryRun bool, createErr error) {
+	adopted, err := s.podStorage.Adopt(r.Context(), pod, dryRun)
+	var adoptionErr *storage.AdoptionError
+	switch {
+	case err == nil:
+		addWarning(w, fmt.Sprintf("pod %s adopts the existing container of the same name in namespace %s", pod.Name, adopted.Namespace))
+		s.writeObjectWithStatus(w, r, http.StatusOK, adopted)
+	case errors.As(err, &adoptionErr):
+		statusErr := apierrors.NewAlreadyExists(corev1.Resource("pods"), pod.Name)
+		statusErr.ErrStatus.Message = fmt.Sprintf("pods %q already exists in namespace %s with a different spec", pod.Name, adoptionErr.Namespace)
+		for _, fieldErr := range adoptionErr.Errs {
+			statusErr.ErrStatus.Details.Causes = append(statusErr.ErrStatus.Details.Causes, metav1.StatusCause{
+				Type:    metav1.CauseType(fieldErr.Type),
+				Message: fieldErr.Detail,
+				Field:   fieldErr.Field,
+			})
+		}
+		s.writeStatusError(w, statusErr)
+	case errors.Is(err, storage.ErrPodmanUnavailable):
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+	default:
+		http.Error(w, createErr.Error(), http.StatusConflict)
+	}
+}
+
+// unsupportedFieldsError builds the 400 Status listing every unsupported field of a pod
+func unsupportedFieldsError(pod *corev1.Pod, errs field.ErrorList) *apierrors.StatusError {
+	details := &metav1.StatusDetails{
+		Name: pod.Name,
+		Kind: "pods",
+	}
+	fields := make([]string, len(errs))
+	for i, fieldErr := range errs {
+		fields[i] = fieldErr.Field
+		details.Causes = append(details.Causes, metav1.StatusCause{
+			Type:    metav1.CauseType(fieldErr.Type),
+			Message: fieldErr.Detail,
+			Field:   fieldErr.Field,
+		})
 	}
+
+	statusErr := apierrors.NewBadRequest(fmt.Sprintf("pod %q uses fields podKube cannot honor: %s (use --tolerate-unsupported-fields to create it anyway)", pod.Name, strings.Join(fields, ", ")))
+	statusErr.ErrStatus.Details = details
+	return statusErr
 }
 
 // updatePod updates an existing pod
 func (s *Server) updatePod(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
 	var pod corev1.Pod
-	if err := json.NewDecoder(r.Body).Decode(&pod); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode pod: %v", err), http.StatusBadRequest)
+	if err := decodeBody(w, r, &pod); err != nil {
+		s.writeDecodeError(w, "pod", err)
+		return
+	}
+
+	s.replacePod(w, r, namespace, name, &pod, dryRun)
+}
+
+// patchPod applies a JSON, merge or strategic merge patch to a pod, then updates it like a PUT
+func (s *Server) patchPod(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.podStorage.Get(r.Context(), namespace, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else {
+			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
+		}
+		return
+	}
+	original, err := json.Marshal(current)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := applyPatch(r.Header.Get("Content-Type"), original, patch)
+	if err != nil {
+		s.writeDecodeError(w, "patch", err)
+		return
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(patched, &pod); err != nil {
+		s.writeDecodeError(w, "patched pod", err)
+		return
+	}
+	// Like with kube-apiserver, only the patches setting the resourceVersion conflict with the
+	// updates made since the pod was read
+	if pod.ResourceVersion == current.ResourceVersion && !patchSetsResourceVersion(r.Header.Get("Content-Type"), patch) {
+		pod.ResourceVersion = ""
+	}
+
+	s.replacePod(w, r, namespace, name, &pod, dryRun)
+}
+
+// replacePod updates a pod with its new version from a PUT or PATCH request
+func (s *Server) replacePod(w http.ResponseWriter, r *http.Request, namespace, name string, pod *corev1.Pod, dryRun bool) {
+	// Mutating webhooks see the current pod, read again below to check the preconditions
+	admission := s.podAdmission()
+	attrs := &admissionAttributes{operation: admissionUpdate, namespace: namespace, dryRun: dryRun, user: requestUser(r)}
+	attrs.old, _ = s.podStorage.Get(r.Context(), namespace, name)
+	statusErr := admission.mutate(r.Context(), attrs, pod)
+	attrs.flushWarnings(w)
+	if statusErr != nil {
+		s.writeStatusError(w, statusErr)
 		return
 	}
 
@@ -1186,9 +1462,44 @@ func (s *Server) updatePod(w http.ResponseWriter, r *http.Request, namespace, na
 		return
 	}
 
-	updatedPod, err := s.podStorage.Update(&pod)
+	// Read the current pod to check the uid and resourceVersion preconditions
+	updatedPod, err := s.podStorage.Get(r.Context(), namespace, name)
+	if err == nil {
+		preconditions := &metav1.Preconditions{}
+		if pod.UID != "" {
+			preconditions.UID = &pod.UID
+		}
+		if pod.ResourceVersion != "" {
+			preconditions.ResourceVersion = &pod.ResourceVersion
+		}
+		if statusErr := checkPreconditions("pods", name, preconditions, updatedPod); statusErr != nil {
+			s.writeStatusError(w, statusErr)
+			return
+		}
+		attrs.old = updatedPod
+		statusErr = admission.validate(r.Context(), attrs, pod)
+		attrs.flushWarnings(w)
+		if statusErr != nil {
+			s.writeStatusError(w, statusErr)
+			return
+		}
+		if dryRun {
+			updatedPod, err = s.podStorage.DryRunUpdate(r.Context(), pod)
+		} else {
+			updatedPod, err = s.podStorage.Update(r.Context(), pod)
+		}
+	}
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		var invalid *storage.InvalidUpdateError
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if errors.Is(err, storage.ErrConflict) {
+			s.writeStatusError(w, apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, name, err))
+		} else if errors.As(err, &invalid) {
+			s.writeStatusError(w, apierrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, name, invalid.Errs))
+		} else if errors.Is(err, storage.ErrInvalidUpdate) {
+			s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
 		} else {
 			klog.Errorf("Failed to update pod %s/%s: %v", namespace, name, err)
@@ -1197,14 +1508,50 @@ func (s *Server) updatePod(w http.ResponseWriter, r *http.Request, namespace, na
 		return
 	}
 
-	s.writeJSON(w, updatedPod)
+	s.writeObject(w, r, updatedPod)
 }
 
 // deletePod deletes a pod
 func (s *Server) deletePod(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	err := s.podStorage.Delete(namespace, name)
+	dryRun, err := dryRunRequested(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	options, err := decodeDeleteOptions(w, r)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		s.writeDecodeError(w, "delete options", err)
+		return
+	}
+	dryRun = dryRun || len(options.DryRun) > 0
+
+	// Preconditions are checked against the current pod; a dry run only checks that it exists
+	if dryRun || options.Preconditions != nil {
+		var current *corev1.Pod
+		if current, err = s.podStorage.Get(r.Context(), namespace, name); err == nil {
+			if statusErr := checkPreconditions("pods", name, options.Preconditions, current); statusErr != nil {
+				s.writeStatusError(w, statusErr)
+				return
+			}
+		}
+	}
+	var pending *corev1.Pod
+	if err == nil && !dryRun {
+		// kubectl delete --force --grace-period=0 also deletes the pods of systemd units
+		if forceDeletion(r, options) {
+			pending, err = s.podStorage.ForceDelete(r.Context(), namespace, name)
+		} else {
+			pending, err = s.podStorage.Delete(r.Context(), namespace, name)
+		}
+	}
+	if err != nil {
+		var systemdErr *storage.SystemdUnitError
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if errors.As(err, &systemdErr) {
+			s.writeStatusError(w, apierrors.NewConflict(schema.GroupResource{Resource: "pods"}, name, err))
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
 		} else {
 			klog.Errorf("Failed to delete pod %s/%s: %v", namespace, name, err)
@@ -1213,6 +1560,12 @@ func (s *Server) deletePod(w http.ResponseWriter, r *http.Request, namespace, na
 		return
 	}
 
+	// A pod with finalizers stays until they are removed: return it with its deletionTimestamp
+	if pending != nil {
+		s.writeObject(w, r, pending)
+		return
+	}
+
 	// Return success status with proper Kubernetes Status object
 	status := &metav1.Status{
 		TypeMeta: metav1.TypeMeta{
@@ -1224,20 +1577,93 @@ func (s *Server) deletePod(w http.ResponseWriter, r *http.Request, namespace, na
 		Message: fmt.Sprintf(`pod "%s" deleted`, name),
 	}
 
-	s.writeJSON(w, status)
+	s.writeObject(w, r, status)
+}
+
+// handlePodBinding handles pod binding requests: /api/v1/namespaces/{namespace}/pods/{name}/binding.
+// Pods are scheduled when created and run on their node from the start, so binding a pod
+// to the node it runs on succeeds without changing anything, and binding it to any other
+// node conflicts like binding an already assigned pod does.
+func (s *Server) handlePodBinding(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	if _, err := dryRunRequested(r); err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	var binding corev1.Binding
+	if err := decodeBody(w, r, &binding); err != nil {
+		s.writeDecodeError(w, "binding", err)
+		return
+	}
+	if binding.Name != "" && binding.Name != name {
+		http.Error(w, "Binding name does not match URL", http.StatusBadRequest)
+		return
+	}
+	if binding.Target.Name == "" {
+		s.writeStatusError(w, apierrors.NewInvalid(schema.GroupKind{Kind: "Binding"}, name,
+			field.ErrorList{field.Required(field.NewPath("target", "name"), "")}))
+		return
+	}
+
+	pod, err := s.podStorage.Get(r.Context(), namespace, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else {
+			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
+		}
+		return
+	}
+	if binding.Target.Name != pod.Spec.NodeName {
+		s.writeStatusError(w, apierrors.NewConflict(schema.GroupResource{Resource: "pods/binding"}, name,
+			fmt.Errorf("pod %v is already assigned to node %q", name, pod.Spec.NodeName)))
+		return
+	}
+
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status: metav1.StatusSuccess,
+		Code:   http.StatusCreated,
+	}
+	s.writeObjectWithStatus(w, r, http.StatusCreated, status)
+}
+
+// runtimeContainer returns the ID of the runtime container running the named container of a
+// pod. Pods of a single container, such as those created through podKube, whose container
+// may be named differently in the spec and the runtime, always use it.
+func runtimeContainer(pod *corev1.Pod, containerName string) (string, error) {
+	statuses := pod.Status.ContainerStatuses
+	for i := range statuses {
+		if len(statuses) > 1 && containerName != "" && statuses[i].Name != containerName {
+			continue
+		}
+		if _, id, ok := strings.Cut(statuses[i].ContainerID, "://"); ok && id != "" {
+			return id, nil
+		}
+		break
+	}
+	if len(statuses) > 1 && containerName != "" {
+		return "", fmt.Errorf("container %s is not valid for pod %s", containerName, pod.Name)
+	}
+	return pod.Name, nil
 }
 
 // handlePodLogs handles requests for pod logs: /api/v1/namespaces/{namespace}/pods/{name}/log
 func (s *Server) handlePodLogs(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if s.rejectIfShuttingDown(w) {
 		return
 	}
+	defer s.beginSession()()
 
 	// Validate that the pod exists first
-	_, err := s.podStorage.Get(namespace, name)
+	pod, err := s.podStorage.Get(r.Context(), namespace, name)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to get pod: %v", err), http.StatusInternalServerError)
@@ -1248,10 +1674,13 @@ func (s *Server) handlePodLogs(w http.ResponseWriter, r *http.Request, namespace
 	// Parse query parameters for logs options
 	query := r.URL.Query()
 	follow := query.Get("follow") == "true"
-	timestamps := query.Get("timestamps") == "true"
 	previous := query.Get("previous") == "true"
-	sinceSeconds := query.Get("sinceSeconds")
 	tailLines := query.Get("tailLines")
+	options, err := requestLogOptions(r, time.Now())
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
 
 	// Build podman logs command
 	args := []string{"logs"}
@@ -1259,33 +1688,41 @@ func (s *Server) handlePodLogs(w http.ResponseWriter, r *http.Request, namespace
 	if follow {
 		args = append(args, "--follow")
 	}
-	if timestamps {
-		args = append(args, "--timestamps")
-	}
+	args = append(args, options.runtimeArgs()...)
 	if previous {
 		args = append(args, "--latest")
 	}
-	if sinceSeconds != "" {
-		args = append(args, "--since", sinceSeconds+"s")
-	}
 	if tailLines != "" {
 		args = append(args, "--tail", tailLines)
 	}
 
-	// Add the container name
-	args = append(args, name)
+	// Add the runtime container
+	container, err := runtimeContainer(pod, query.Get("container"))
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	args = append(args, container)
+
+	// Run the container runtime against the node the pod is on
+	args = s.podStorage.CommandLine(pod.Spec.NodeName, args...)
 
-	klog.Infof("Executing: podman %v", strings.Join(args, " "))
+	klog.Infof("Executing: %v", strings.Join(args, " "))
 
-	// Execute podman logs command
-	cmd := exec.Command("podman", args...)
+	// Execute the logs command; it is killed when the client goes away
+	cmd := exec.CommandContext(r.Context(), args[0], args[1:]...)
 
 	if follow {
 		// For follow mode, we need to stream the output
-		s.streamPodmanLogs(w, r, cmd)
+		s.streamPodmanLogs(w, r, cmd, options)
 	} else {
 		// For non-follow mode, get all output and return it
-		output, err := cmd.CombinedOutput()
+		var buffer bytes.Buffer
+		var flush func() error
+		cmd.Stdout, cmd.Stderr, flush = options.streams(&lockedWriter{w: &buffer})
+		err := cmd.Run()
+		flush()
+		output := buffer.Bytes()
 		if err != nil {
 			klog.Errorf("Failed to get logs for pod %s/%s: %v, output: %s", namespace, name, err, string(output))
 			http.Error(w, fmt.Sprintf("Failed to get logs: %v", err), http.StatusInternalServerError)
@@ -1310,76 +1747,83 @@ func (s *Server) handlePodLogs(w http.ResponseWriter, r *http.Request, namespace
 	}
 }
 
-// streamPodmanLogs handles streaming logs for follow mode
-func (s *Server) streamPodmanLogs(w http.ResponseWriter, r *http.Request, cmd *exec.Cmd) {
-	// Set headers for streaming
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Transfer-Encoding", "chunked")
+// logsWaitDelay bounds how long a followed logs command may keep its output open once it has
+// been killed, such as through an ssh connection to a remote node that lingers
+const logsWaitDelay = 5 * time.Second
+
+// streamPodmanLogs streams the output of a logs command for follow mode, until the command
+// ends, which it does when the container exits, or the client goes away, which kills it. The
+// command is always waited for, so that no process is left behind.
+func (s *Server) streamPodmanLogs(w http.ResponseWriter, r *http.Request, cmd *exec.Cmd, options logOptions) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
 
-	// Get stdout pipe
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to create pipe: %v", err), http.StatusInternalServerError)
 		return
 	}
+	output := &flushWriter{w: w, flusher: flusher}
+	stdoutLines, stderrLines, flush := options.streams(output)
+	cmd.Stderr = stderrLines
+	cmd.WaitDelay = logsWaitDelay
 
-	// Start the command
 	if err := cmd.Start(); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to start logs command: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Make sure we can flush the response
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
-		return
-	}
-
-	// Write initial response
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
 
-	// Copy output to response writer
-	// Note: This will block until the command finishes or the client disconnects
-	buffer := make([]byte, 4096)
-	for {
-		klog.V(4).Infof("Reading Stdout ...")
-		n, err := stdout.Read(buffer)
-		klog.V(4).Infof("Reading Stdout ...")
-		if n > 0 {
-			w.Write(buffer[:n])
-			flusher.Flush()
-		}
+	// Copy the logs as they come; the copy ends with the output of the command, or with the
+	// first failed write to a client that went away
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdoutLines, stdout)
+		copied <- err
+	}()
+
+	select {
+	case err = <-copied:
 		if err != nil {
-			break
-		}
-		// Check if client disconnected
-		if r.Context().Done() != nil {
-			select {
-			case <-r.Context().Done():
-				cmd.Process.Kill()
-				return
-			default:
-			}
+			// The client is gone, stop the command rather than waiting for more logs
+			cmd.Process.Kill()
 		}
+		err = cmd.Wait()
+	case <-r.Context().Done():
+		// The command is killed by its context; waiting for it closes its output, which
+		// ends the copy
+		err = cmd.Wait()
+		<-copied
 	}
 
-	// Wait for command to finish
-	cmd.Wait()
+	flush()
+
+	if err != nil && r.Context().Err() == nil {
+		klog.Errorf("Logs command %v failed: %v", cmd.Args, err)
+	} else {
+		klog.V(4).Infof("Logs stream of %v ended", cmd.Args)
+	}
 }
 
 // handlePodExec handles requests for pod exec: /api/v1/namespaces/{namespace}/pods/{name}/exec
 func (s *Server) handlePodExec(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if s.rejectIfShuttingDown(w) {
 		return
 	}
+	defer s.beginSession()()
 
 	// Validate that the pod exists first
-	_, err := s.podStorage.Get(namespace, name)
+	pod, err := s.podStorage.Get(r.Context(), namespace, name)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, storage.ErrPodmanUnavailable) {
+			s.writeStatusError(w, apierrors.NewServiceUnavailable(err.Error()))
+		} else if strings.Contains(err.Error(), "not found") {
 			http.Error(w, fmt.Sprintf(`pods "%s" not found`, name), http.StatusNotFound)
 		} else {
 			http.Error(w, fmt.Sprintf("Failed to get pod: %v", err), http.StatusInternalServerError)
@@ -1435,11 +1879,59 @@ func (s *Server) handlePodExec(w http.ResponseWriter, r *http.Request, namespace
 		args = append(args, "-i")
 	}
 
-	// Add the container name and command
-	args = append(args, name)
+	// Add the runtime container and command
+	container, err := runtimeContainer(pod, query.Get("container"))
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	args = append(args, container)
 	args = append(args, command...)
 
-	klog.Infof("Executing: podman %v", strings.Join(args, " "))
+	// Run the container runtime against the node the pod is on
+	args = s.podStorage.CommandLine(pod.Spec.NodeName, args...)
+
+	klog.Infof("Executing: %v", strings.Join(args, " "))
+
+	timeouts, err := s.requestStreamTimeouts(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+
+	// Register the session, which runs until it ends or is terminated through /debug/sessions
+	session := execSession{
+		Kind:      "exec",
+		Namespace: namespace,
+		Pod:       name,
+		Container: container,
+		Command:   command,
+		TTY:       tty,
+		User:      requestUser(r).Username,
+	}
+	ctx, endSession, err := s.execSessions.begin(r.Context(), session)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewTooManyRequests(err.Error(), 1))
+		return
+	}
+	defer endSession()
+	r = r.WithContext(ctx)
+
+	// Log who runs the session, and record its transcript when enabled
+	r, recording, err := s.beginExecRecording(r, session)
+	if err != nil {
+		klog.Errorf("Refusing exec session in pod %s/%s: %v", namespace, name, err)
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return
+	}
+	defer recording.end()
+
+	// Clients that cannot upgrade stream over the request itself
+	if isFramedExecRequest(r) {
+		klog.Infof("Handling framed exec request")
+		s.handleFramedExec(w, r, args, stdin, stdout, stderr, tty)
+		return
+	}
 
 	// Check if this is an upgrade request (WebSocket or SPDY)
 	klog.Infof("Checking for protocol upgrade. Connection: %s, Upgrade: %s", r.Header.Get("Connection"), r.Header.Get("Upgrade"))
@@ -1447,10 +1939,10 @@ func (s *Server) handlePodExec(w http.ResponseWriter, r *http.Request, namespace
 		upgrade := strings.ToLower(r.Header.Get("Upgrade"))
 		if strings.HasPrefix(upgrade, "spdy") {
 			klog.Infof("Handling SPDY exec request")
-			s.handleSPDYExec(w, r, args, stdin, stdout, stderr, tty)
+			s.handleSPDYExec(w, r, args, stdin, stdout, stderr, tty, timeouts)
 		} else if upgrade == "websocket" {
 			klog.Infof("Handling WebSocket exec request")
-			s.handleWebSocketExec(w, r, args, stdin, stdout, stderr, tty)
+			s.handleWebSocketExec(w, r, args, stdin, stdout, stderr, tty, timeouts)
 		}
 		return
 	}
@@ -1459,31 +1951,45 @@ func (s *Server) handlePodExec(w http.ResponseWriter, r *http.Request, namespace
 	// Handle different streaming modes for HTTP
 	if stdin && (stdout || stderr) {
 		// Interactive mode - bidirectional streaming
-		s.handleInteractiveExec(w, r, args, tty)
+		s.handleInteractiveExec(w, r, args, stdout, stderr)
 	} else {
 		// Simple exec mode - just run command and return output
-		s.handleSimpleExec(w, r, args)
+		s.handleSimpleExec(w, r, args, stdout, stderr)
 	}
 }
 
-// handleSimpleExec executes a command and returns the output
-func (s *Server) handleSimpleExec(w http.ResponseWriter, r *http.Request, args []string) {
-	cmd := exec.Command("podman", args...)
-
-	output, err := cmd.CombinedOutput()
+// handleSimpleExec executes a command and returns its stdout, or its stderr when only stderr
+// is requested: a plain HTTP response carries a single stream, so they are never merged. A
+// failed command gets a 500 with its stderr.
+func (s *Server) handleSimpleExec(w http.ResponseWriter, r *http.Request, args []string, stdout, stderr bool) {
+	cmd := exec.CommandContext(r.Context(), args[0], args[1:]...)
+	var stdoutBuffer, stderrBuffer bytes.Buffer
+	cmd.Stdout = &stdoutBuffer
+	cmd.Stderr = &stderrBuffer
+
+	err := cmd.Run()
+	recording := execRecordingFrom(r.Context())
+	recording.record("o", stdoutBuffer.Bytes())
+	recording.record("e", stderrBuffer.Bytes())
+	recording.setResult(err)
 	if err != nil {
-		klog.Errorf("Failed to exec command: %v, output: %s", err, string(output))
-		http.Error(w, fmt.Sprintf("Failed to exec: %v", err), http.StatusInternalServerError)
+		klog.Errorf("Failed to exec command: %v, stderr: %s", err, stderrBuffer.String())
+		http.Error(w, fmt.Sprintf("Failed to exec: %v: %s", err, strings.TrimSpace(stderrBuffer.String())), http.StatusInternalServerError)
 		return
 	}
 
+	output := stdoutBuffer.Bytes()
+	if stderr && !stdout {
+		output = stderrBuffer.Bytes()
+	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write(output)
 }
 
-// handleInteractiveExec handles interactive exec with bidirectional streaming
-func (s *Server) handleInteractiveExec(w http.ResponseWriter, r *http.Request, args []string, tty bool) {
+// handleInteractiveExec handles interactive exec with bidirectional streaming. Only the
+// requested streams are written to the response, a whole chunk at a time.
+func (s *Server) handleInteractiveExec(w http.ResponseWriter, r *http.Request, args []string, stdout, stderr bool) {
 	// Set headers for streaming
 	w.Header().Set("Content-Type", "text/plain")
 	w.Header().Set("Transfer-Encoding", "chunked")
@@ -1496,7 +2002,7 @@ func (s *Server) handleInteractiveExec(w http.ResponseWriter, r *http.Request, a
 	}
 
 	// Create the command
-	cmd := exec.Command("podman", args...)
+	cmd := exec.CommandContext(r.Context(), args[0], args[1:]...)
 
 	// Set up pipes
 	stdin, err := cmd.StdinPipe()
@@ -1506,16 +2012,14 @@ func (s *Server) handleInteractiveExec(w http.ResponseWriter, r *http.Request, a
 	}
 	defer stdin.Close()
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create stdout pipe: %v", err), http.StatusInternalServerError)
-		return
+	// The streams are recorded in the transcript of the session, if any
+	recording := execRecordingFrom(r.Context())
+	output := &flushWriter{w: w, flusher: flusher}
+	if stdout {
+		cmd.Stdout = recording.writer("o", output)
 	}
-
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create stderr pipe: %v", err), http.StatusInternalServerError)
-		return
+	if stderr {
+		cmd.Stderr = recording.writer("e", output)
 	}
 
 	// Start the command
@@ -1528,52 +2032,32 @@ func (s *Server) handleInteractiveExec(w http.ResponseWriter, r *http.Request, a
 	w.WriteHeader(http.StatusOK)
 	flusher.Flush()
 
-	// Handle stdout in a goroutine
-	go func() {
-		defer stdout.Close()
-		buffer := make([]byte, 1024)
-		for {
-			klog.V(4).Infof("Reading Stdout(2) ...")
-			n, err := stdout.Read(buffer)
-			klog.V(4).Infof("Reading Stdout(2) ... DONE")
-			if n > 0 {
-				w.Write(buffer[:n])
-				flusher.Flush()
-			}
-			if err != nil {
-				break
-			}
-		}
-	}()
-
-	// Handle stderr in a goroutine
-	go func() {
-		defer stderr.Close()
-		buffer := make([]byte, 1024)
-		for {
-			klog.V(4).Infof("Reading Stderr ...")
-			n, err := stderr.Read(buffer)
-			klog.V(4).Infof("Reading Stderr ... DONE")
-			if n > 0 {
-				w.Write(buffer[:n])
-				flusher.Flush()
-			}
-			if err != nil {
-				break
-			}
-		}
-	}()
-
 	// Handle stdin from request body
 	if r.Body != nil {
 		go func() {
 			defer stdin.Close()
-			io.Copy(stdin, r.Body)
+			io.Copy(stdin, recording.reader(r.Body))
 		}()
 	}
 
-	// Wait for command to finish
-	cmd.Wait()
+	// Wait for command to finish and its output to be written
+	recording.setResult(cmd.Wait())
+}
+
+// flushWriter writes to a streamed response and flushes every write; writes from the stdout
+// and stderr copies of a command are serialized
+type flushWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	flusher http.Flusher
+}
+
+func (fw *flushWriter) Write(data []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	n, err := fw.w.Write(data)
+	fw.flusher.Flush()
+	return n, err
 }
 
 // isUpgradeRequest checks if the request is asking for a protocol upgrade
@@ -1614,7 +2098,7 @@ type streamAndReply struct {
 }
 
 // handleSPDYExec handles SPDY-based exec requests following kubelet patterns
-func (s *Server) handleSPDYExec(w http.ResponseWriter, r *http.Request, args []string, stdin, stdout, stderr, tty bool) {
+func (s *Server) handleSPDYExec(w http.ResponseWriter, r *http.Request, args []string, stdin, stdout, stderr, tty bool, timeouts streamTimeouts) {
 	klog.Infof("Kubelet-style SPDY exec session starting tty=%v", tty)
 
 	// Parse options from request parameters (kubelet style)
@@ -1634,7 +2118,7 @@ func (s *Server) handleSPDYExec(w http.ResponseWriter, r *http.Request, args []s
 	}
 
 	// Create streaming context using kubelet patterns
-	ctx, ok := s.createStreams(r, w, opts, supportedStreamProtocols, 30*time.Second, 10*time.Second)
+	ctx, ok := s.createStreams(r, w, opts, supportedStreamProtocols, timeouts.idle, timeouts.creation)
 	if !ok {
 		// error is handled by createStreams
 		return
@@ -1643,33 +2127,8 @@ func (s *Server) handleSPDYExec(w http.ResponseWriter, r *http.Request, args []s
 
 	// Execute the command with established streams
 	klog.V(4).Infof("About to call execInContainer with tty=%t", tty)
-	err := s.execInContainer(args, ctx.stdinStream, ctx.stdoutStream, ctx.stderrStream, tty, ctx.resizeChan)
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ProcessState != nil {
-			rc := exitErr.ProcessState.ExitCode()
-			ctx.writeStatus(&apierrors.StatusError{ErrStatus: metav1.Status{
-				Status: metav1.StatusFailure,
-				Reason: remotecommandconsts.NonZeroExitCodeReason,
-				Details: &metav1.StatusDetails{
-					Causes: []metav1.StatusCause{
-						{
-							Type:    remotecommandconsts.ExitCodeCauseType,
-							Message: fmt.Sprintf("%d", rc),
-						},
-					},
-				},
-				Message: fmt.Sprintf("command terminated with non-zero exit code: %v", exitErr),
-			}})
-		} else {
-			err = fmt.Errorf("error executing command in container: %v", err)
-			klog.Errorf("%v", err)
-			ctx.writeStatus(apierrors.NewInternalError(err))
-		}
-	} else {
-		ctx.writeStatus(&apierrors.StatusError{ErrStatus: metav1.Status{
-			Status: metav1.StatusSuccess,
-		}})
-	}
+	err := s.execInContainer(r.Context(), args, ctx.stdinStream, ctx.stdoutStream, ctx.stderrStream, tty, ctx.resizeChan, initialTerminalSize(r))
+	ctx.writeStatus(execResultStatus(err))
 
 	klog.Infof("Kubelet-style SPDY exec session completed")
 }
@@ -1841,16 +2300,21 @@ func (s *Server) writeV1Status(stream httpstream.Stream, status *apierrors.Statu
 }
 
 // execInContainer executes the command using the established streams (kubelet-style async stream handling)
-func (s *Server) execInContainer(args []string, stdin io.ReadCloser, stdout, stderr io.WriteCloser, tty bool, resizeChan <-chan TerminalSize) error {
+func (s *Server) execInContainer(ctx context.Context, args []string, stdin io.ReadCloser, stdout, stderr io.WriteCloser, tty bool, resizeChan <-chan TerminalSize, initialSize *TerminalSize) error {
 	klog.V(4).Infof("Starting execInContainer with args: %v", args)
 	klog.V(4).Infof("Stream setup - stdin: %t, stdout: %t, stderr: %t, tty: %t, resize: %t",
 		stdin != nil, stdout != nil, stderr != nil, tty, resizeChan != nil)
 
+	// The streams are recorded in the transcript of the session, if any
+	recording := execRecordingFrom(ctx)
+	stdin, stdout, stderr = recording.wrap(stdin, stdout, stderr)
+
+	// The command is killed when the session is terminated
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+
 	// Create context to cancel goroutines when command completes
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-
-	cmd := exec.Command("podman", args...)
 	var cmdPid int // Store the podman exec process PID for resize handling
 	var ptyFile *os.File // Store PTY file for resize operations
 
@@ -1858,88 +2322,75 @@ func (s *Server) execInContainer(args []string, stdin io.ReadCloser, stdout, std
 	if tty {
 		klog.V(4).Infof("Creating real PTY for TTY mode")
 
+		// Size the PTY before starting the command, so that full-screen programs render at the
+		// size of the client terminal from the start: from the size given in the request, or
+		// else from the first resize event, which clients send right after connecting
+		size := initialSize
+		if size == nil && resizeChan != nil {
+			select {
+			case first, ok := <-resizeChan:
+				if ok {
+					size = &first
+				}
+			case <-time.After(initialTerminalSizeWait):
+				klog.V(4).Infof("No initial resize event from client, starting with the default PTY size")
+			}
+		}
+
 		// Start the command with a PTY
 		var err error
-		ptyFile, err = pty.Start(cmd)
+		if size != nil && size.Width > 0 && size.Height > 0 {
+			klog.V(4).Infof("Starting PTY with initial size %dx%d", size.Width, size.Height)
+			ptyFile, err = pty.StartWithSize(cmd, &pty.Winsize{Rows: size.Height, Cols: size.Width})
+		} else {
+			ptyFile, err = pty.Start(cmd)
+		}
 		if err != nil {
 			klog.Errorf("=== EXEC DEBUG: Failed to start command with PTY: %v", err)
 			return fmt.Errorf("failed to start command with PTY: %v", err)
 		}
 		cmdPid = cmd.Process.Pid
 		klog.V(4).Infof("Podman exec started with PTY, PID: %d", cmdPid)
-
-		// Note: Initial PTY size will be set by resize events from the client
-		klog.V(4).Infof("PTY created, waiting for initial resize event from client")
 	} else {
 		klog.V(4).Infof("Using pipes for non-TTY mode")
 
-		// Set up pipes for all streams
-		var stdinPipe io.WriteCloser
-		var stdoutPipe io.ReadCloser
-		var stderrPipe io.ReadCloser
-		var err error
+		// stdout and stderr are copied to their own streams by the exec package, and
+		// cmd.Wait returns once both copies are complete; a stream that was not requested
+		// is discarded rather than merged into another one
+		if stdout != nil {
+			cmd.Stdout = stdout
+		}
+		if stderr != nil {
+			cmd.Stderr = stderr
+		}
 
+		// stdin is copied by hand so that a client that never closes it does not block
+		// cmd.Wait once the command has exited
+		var stdinPipe io.WriteCloser
 		if stdin != nil {
-			klog.V(4).Infof("Creating stdin pipe")
+			var err error
 			stdinPipe, err = cmd.StdinPipe()
 			if err != nil {
 				klog.Errorf("=== EXEC DEBUG: Failed to create stdin pipe: %v", err)
 				return fmt.Errorf("failed to create stdin pipe: %v", err)
 			}
-			klog.V(4).Infof("Stdin pipe created successfully")
-		}
-
-		if stdout != nil {
-			klog.V(4).Infof("Creating stdout pipe")
-			stdoutPipe, err = cmd.StdoutPipe()
-			if err != nil {
-				klog.Errorf("=== EXEC DEBUG: Failed to create stdout pipe: %v", err)
-				return fmt.Errorf("failed to create stdout pipe: %v", err)
-			}
-			klog.V(4).Infof("Stdout pipe created successfully")
-		}
-
-		if stderr != nil {
-			klog.V(4).Infof("Creating stderr pipe")
-			stderrPipe, err = cmd.StderrPipe()
-			if err != nil {
-				klog.Errorf("=== EXEC DEBUG: Failed to create stderr pipe: %v", err)
-				return fmt.Errorf("failed to create stderr pipe: %v", err)
-			}
-			klog.V(4).Infof("Stderr pipe created successfully")
 		}
 
 		// Start the command
 		klog.V(4).Infof("Starting podman command")
-		err = cmd.Start()
-		if err != nil {
+		if err := cmd.Start(); err != nil {
 			klog.Errorf("=== EXEC DEBUG: Failed to start command: %v", err)
 			return err
 		}
 		cmdPid = cmd.Process.Pid
 		klog.V(4).Infof("Podman exec command started successfully, PID: %d", cmdPid)
 
-		// Handle pipe-based streams asynchronously
-		if stdinPipe != nil && stdin != nil {
+		if stdinPipe != nil {
 			go func() {
 				defer stdinPipe.Close()
 				io.Copy(stdinPipe, stdin)
 			}()
 		}
-
-		if stdoutPipe != nil && stdout != nil {
-			go func() {
-				defer stdoutPipe.Close()
-				io.Copy(stdout, stdoutPipe)
-			}()
-		}
-
-		if stderrPipe != nil && stderr != nil {
-			go func() {
-				defer stderrPipe.Close()
-				io.Copy(stderr, stderrPipe)
-			}()
-		}
 	}
 
 	// Handle streams asynchronously (kubelet pattern)
@@ -2061,9 +2512,30 @@ func (s *Server) execInContainer(args []string, stdin io.ReadCloser, stdout, std
 	wg.Wait()
 	klog.V(4).Infof("All stream copying completed")
 
+	recording.setResult(cmdErr)
 	return cmdErr
 }
 
+// initialTerminalSizeWait is how long a TTY session waits for the first resize event of the
+// client before starting its command with the default PTY size
+const initialTerminalSizeWait = 500 * time.Millisecond
+
+// initialTerminalSize returns the terminal size given by the width and height parameters of
+// an exec request, nil when they are missing or invalid
+func initialTerminalSize(r *http.Request) *TerminalSize {
+	query := r.URL.Query()
+	if query.Get("width") == "" && query.Get("height") == "" {
+		return nil
+	}
+	width, widthErr := strconv.ParseUint(query.Get("width"), 10, 16)
+	height, heightErr := strconv.ParseUint(query.Get("height"), 10, 16)
+	if widthErr != nil || heightErr != nil || width == 0 || height == 0 {
+		klog.Warningf("Ignoring invalid terminal size %sx%s", query.Get("width"), query.Get("height"))
+		return nil
+	}
+	return &TerminalSize{Width: uint16(width), Height: uint16(height)}
+}
+
 // handleResizeEvents handles terminal resize events (kubelet pattern)
 func (s *Server) handleResizeEvents(ctx context.Context, stream io.Reader, resizeChan chan<- TerminalSize) {
 	defer close(resizeChan)
@@ -2089,160 +2561,230 @@ func (s *Server) handleResizeEvents(ctx context.Context, stream io.Reader, resiz
 }
 
 
-// handleWebSocketExec handles WebSocket-based exec requests (placeholder for now)
-func (s *Server) handleWebSocketExec(w http.ResponseWriter, r *http.Request, args []string, stdin, stdout, stderr, tty bool) {
-	klog.Infof("WebSocket exec not fully implemented yet, falling back to simple exec")
+// Channels of the websocket exec protocols, in the order of the kubelet
+const (
+	wsStdinChannel = iota
+	wsStdoutChannel
+	wsStderrChannel
+	wsErrorChannel
+	wsResizeChannel
+)
+
+// wsBase64V4Protocol is the v4 exec protocol with base64 encoded text frames
+const wsBase64V4Protocol = "v4." + wsstream.Base64ChannelWebSocketProtocol
 
-	// For now, fall back to simple exec
-	cmd := exec.Command("podman", args...)
-	output, err := cmd.CombinedOutput()
+// handleWebSocketExec handles WebSocket-based exec requests, with the channel.k8s.io
+// subprotocols of the kubelet: kubectl 1.30+ and browsers, which cannot speak SPDY, use them
+func (s *Server) handleWebSocketExec(w http.ResponseWriter, r *http.Request, args []string, stdin, stdout, stderr, tty bool, timeouts streamTimeouts) {
+	channels := make([]wsstream.ChannelType, 5)
+	channels[wsStdinChannel] = wsstream.IgnoreChannel
+	if stdin {
+		channels[wsStdinChannel] = wsstream.ReadChannel
+	}
+	channels[wsStdoutChannel] = wsstream.IgnoreChannel
+	if stdout {
+		channels[wsStdoutChannel] = wsstream.WriteChannel
+	}
+	channels[wsStderrChannel] = wsstream.IgnoreChannel
+	if stderr {
+		channels[wsStderrChannel] = wsstream.WriteChannel
+	}
+	channels[wsErrorChannel] = wsstream.WriteChannel
+	channels[wsResizeChannel] = wsstream.ReadChannel
+
+	conn := wsstream.NewConn(map[string]wsstream.ChannelProtocolConfig{
+		"":                                       {Binary: true, Channels: channels},
+		wsstream.ChannelWebSocketProtocol:        {Binary: true, Channels: channels},
+		wsstream.Base64ChannelWebSocketProtocol:  {Binary: false, Channels: channels},
+		remotecommandconsts.StreamProtocolV4Name: {Binary: true, Channels: channels},
+		wsBase64V4Protocol:                       {Binary: false, Channels: channels},
+		remotecommandconsts.StreamProtocolV5Name: {Binary: true, Channels: channels},
+	})
+	conn.SetIdleTimeout(timeouts.idle)
+	protocol, streams, err := conn.Open(w, r)
 	if err != nil {
-		klog.Errorf("Failed to exec command: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to exec: %v", err), http.StatusInternalServerError)
+		klog.Errorf("Failed to open websocket exec connection: %v", err)
 		return
 	}
+	defer conn.Close()
+	klog.Infof("WebSocket exec session starting with protocol %q tty=%v", protocol, tty)
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(output)
-}
-
-// handleSecretByName handles requests for specific secrets
-func (s *Server) handleSecretByName(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	switch r.Method {
-	case http.MethodGet:
-		s.getSecret(w, r, namespace, name)
-	case http.MethodDelete:
-		s.deleteSecret(w, r, namespace, name)
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	var stdinStream io.ReadCloser
+	var stdoutStream, stderrStream io.WriteCloser
+	if stdin {
+		stdinStream = streams[wsStdinChannel]
+	}
+	if stdout {
+		stdoutStream = streams[wsStdoutChannel]
+	}
+	if stderr {
+		stderrStream = streams[wsStderrChannel]
+	}
+	var resizeChan chan TerminalSize
+	if tty {
+		resizeChan = make(chan TerminalSize)
+		go s.handleResizeEvents(r.Context(), streams[wsResizeChannel], resizeChan)
 	}
-}
 
-// listSecrets lists secrets, optionally filtered by namespace
-func (s *Server) listSecrets(w http.ResponseWriter, r *http.Request, namespace string) {
-	secretList, err := s.podStorage.ListSecrets(namespace)
-	if err != nil {
-		klog.Errorf("Failed to list secrets: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to list secrets: %v", err), http.StatusInternalServerError)
-		return
+	// Protocols before v4 report failures as plain text and success as nothing
+	errorStream := streams[wsErrorChannel]
+	writeStatus := func(status *apierrors.StatusError) {
+		if !strings.HasPrefix(protocol, "v4.") && !strings.HasPrefix(protocol, "v5.") {
+			if status.Status().Status != metav1.StatusSuccess {
+				errorStream.Write([]byte(status.Error()))
+			}
+			return
+		}
+		if data, err := json.Marshal(status.Status()); err == nil {
+			errorStream.Write(data)
+		}
 	}
 
-	s.writeJSON(w, secretList)
+	err = s.execInContainer(r.Context(), args, stdinStream, stdoutStream, stderrStream, tty, resizeChan, initialTerminalSize(r))
+	writeStatus(execResultStatus(err))
+
+	klog.Infof("WebSocket exec session completed")
 }
 
-// getSecret retrieves a specific secret
-func (s *Server) getSecret(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	secret, err := s.podStorage.GetSecret(namespace, name)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf(`secrets "%s" not found`, name), http.StatusNotFound)
-		} else {
-			klog.Errorf("Failed to get secret %s/%s: %v", namespace, name, err)
-			http.Error(w, fmt.Sprintf("Failed to get secret: %v", err), http.StatusInternalServerError)
-		}
-		return
-	}
+// execResultStatus returns the Status reporting the end of an exec session to its client: a
+// NonZeroExitCode failure carrying the exit code of the command, an internal error when it
+// could not run, or success
+func execResultStatus(err error) *apierrors.StatusError {
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ProcessState != nil {
+		return &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status: metav1.StatusFailure,
+			Reason: remotecommandconsts.NonZeroExitCodeReason,
+			Details: &metav1.StatusDetails{
+				Causes: []metav1.StatusCause{
+					{
+						Type:    remotecommandconsts.ExitCodeCauseType,
+						Message: fmt.Sprintf("%d", exitErr.ProcessState.ExitCode()),
+					},
+				},
+			},
+			Message: fmt.Sprintf("command terminated with non-zero exit code: %v", exitErr),
+		}}
+	} else if err != nil {
+		err = fmt.Errorf("error executing command in container: %v", err)
+		klog.Errorf("%v", err)
+		return apierrors.NewInternalError(err)
+	}
+	return &apierrors.StatusError{ErrStatus: metav1.Status{Status: metav1.StatusSuccess}}
+}
+
+// handleHealth handles health check requests
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
 
-	s.writeJSON(w, secret)
+// handleVersion handles version requests with the build information of the server
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	s.writeObject(w, r, version.Get())
 }
 
-// createSecret creates a new secret
-func (s *Server) createSecret(w http.ResponseWriter, r *http.Request, namespace string) {
-	var secret corev1.Secret
-	if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to decode secret: %v", err), http.StatusBadRequest)
-		return
-	}
+// maxGeneratedNameLength caps generateName prefixes so generated names stay valid DNS labels
+const maxGeneratedNameLength = 63 - generatedNameSuffixLength
 
-	// Set namespace from URL if not specified in the secret
-	if secret.Namespace == "" {
-		secret.Namespace = namespace
-	}
+// generatedNameSuffixLength is the length of the random suffix appended to generateName
+const generatedNameSuffixLength = 5
 
-	// Validate namespace matches URL
-	if namespace != "" && secret.Namespace != namespace {
-		http.Error(w, "Secret namespace does not match URL namespace", http.StatusBadRequest)
-		return
+// assignName sets the name of an object being created from metadata.generateName, with a
+// random suffix like kube-apiserver, when no name is given
+func assignName(meta *metav1.ObjectMeta) error {
+	if meta.Name != "" {
+		return nil
+	}
+	if meta.GenerateName == "" {
+		return fmt.Errorf("name or generateName is required")
 	}
 
-	createdSecret, err := s.podStorage.CreateSecret(&secret)
-	if err != nil {
-		if strings.Contains(err.Error(), "already exists") {
-			http.Error(w, err.Error(), http.StatusConflict)
-		} else {
-			klog.Errorf("Failed to create secret: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to create secret: %v", err), http.StatusInternalServerError)
-		}
-		return
+	prefix := meta.GenerateName
+	if len(prefix) > maxGeneratedNameLength {
+		prefix = prefix[:maxGeneratedNameLength]
 	}
+	meta.Name = prefix + utilrand.String(generatedNameSuffixLength)
+	return nil
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(createdSecret); err != nil {
-		klog.Errorf("Failed to encode created secret: %v", err)
+// generateNameAttempts is how many random suffixes are tried before the creation of an
+// object named from generateName gives up on name collisions
+const generateNameAttempts = 3
+
+// retryGeneratedName gives an object named from generateName a new random suffix when its
+// creation failed because the name is taken, and reports whether to try again
+func retryGeneratedName(meta *metav1.ObjectMeta, generated bool, attempt int, err error) bool {
+	if err == nil || !generated || attempt >= generateNameAttempts || !strings.Contains(err.Error(), "already exists") {
+		return false
 	}
+	klog.V(2).Infof("Generated name %s is already taken, retrying with another suffix", meta.Name)
+	meta.Name = ""
+	return assignName(meta) == nil
 }
 
-// deleteSecret deletes a secret
-func (s *Server) deleteSecret(w http.ResponseWriter, r *http.Request, namespace, name string) {
-	err := s.podStorage.DeleteSecret(namespace, name)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			http.Error(w, fmt.Sprintf(`secrets "%s" not found`, name), http.StatusNotFound)
-		} else {
-			klog.Errorf("Failed to delete secret %s/%s: %v", namespace, name, err)
-			http.Error(w, fmt.Sprintf("Failed to delete secret: %v", err), http.StatusInternalServerError)
-		}
-		return
+// decodeDeleteOptions decodes the optional DeleteOptions body of a delete request
+func decodeDeleteOptions(w http.ResponseWriter, r *http.Request) (*metav1.DeleteOptions, error) {
+	options := &metav1.DeleteOptions{}
+	if r.Body == nil {
+		return options, nil
 	}
 
-	// Return success status with proper Kubernetes Status object
-	status := &metav1.Status{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Status",
-			APIVersion: "v1",
-		},
-		Status:  "Success",
-		Code:    200,
-		Message: fmt.Sprintf(`secret "%s" deleted`, name),
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return options, nil
 	}
 
-	s.writeJSON(w, status)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err := decodeBody(w, r, options); err != nil {
+		return nil, err
+	}
+	for _, value := range options.DryRun {
+		if value != metav1.DryRunAll {
+			return nil, fmt.Errorf("invalid dryRun value %q, only %q is supported", value, metav1.DryRunAll)
+		}
+	}
+	return options, nil
 }
 
-// handleHealth handles health check requests
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// forceDeletion reports whether a deletion asks for a grace period of 0, in its options or
+// as the gracePeriodSeconds query parameter, as kubectl delete --force --grace-period=0 does
+func forceDeletion(r *http.Request, options *metav1.DeleteOptions) bool {
+	if options.GracePeriodSeconds != nil {
+		return *options.GracePeriodSeconds == 0
 	}
-
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("ok"))
+	return r.URL.Query().Get("gracePeriodSeconds") == "0"
 }
 
-// handleVersion handles version requests
-func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// checkPreconditions verifies the uid and resourceVersion preconditions of a request
+// against the current object, returning a Conflict like kube-apiserver when they differ
+func checkPreconditions(resource, name string, preconditions *metav1.Preconditions, current metav1.Object) *apierrors.StatusError {
+	if preconditions == nil {
+		return nil
 	}
-
-	version := map[string]interface{}{
-		"major":        "1",
-		"minor":        "29",
-		"gitVersion":   "v1.29.0-podman-adapter",
-		"gitCommit":    "podman-adapter",
-		"gitTreeState": "clean",
-		"buildDate":    time.Now().Format(time.RFC3339),
-		"goVersion":    "go1.24.0",
-		"compiler":     "gc",
-		"platform":     "linux/amd64",
+	groupResource := schema.GroupResource{Resource: resource}
+	if preconditions.UID != nil && *preconditions.UID != current.GetUID() {
+		return apierrors.NewConflict(groupResource, name, fmt.Errorf("Precondition failed: UID in precondition: %v, UID in object meta: %v", *preconditions.UID, current.GetUID()))
 	}
+	if preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != current.GetResourceVersion() {
+		return apierrors.NewConflict(groupResource, name, fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+	return nil
+}
 
-	s.writeJSON(w, version)
+// dryRunRequested reports whether the request asks for a dry run. Like kube-apiserver,
+// only dryRun=All is accepted.
+func dryRunRequested(r *http.Request) (bool, error) {
+	values := r.URL.Query()["dryRun"]
+	for _, value := range values {
+		if value != metav1.DryRunAll {
+			return false, fmt.Errorf("invalid dryRun value %q, only %q is supported", value, metav1.DryRunAll)
+		}
+	}
+	return len(values) > 0, nil
 }
 
 // writeJSON writes a JSON response
@@ -2256,8 +2798,25 @@ func (s *Server) writeJSON(w http.ResponseWriter, obj interface{}) {
 	}
 }
 
+// writeStatusError writes a Kubernetes Status object with the error's HTTP code
+func (s *Server) writeStatusError(w http.ResponseWriter, statusErr *apierrors.StatusError) {
+	status := statusErr.Status()
+	status.TypeMeta = metav1.TypeMeta{
+		Kind:       "Status",
+		APIVersion: "v1",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(status.Code))
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		klog.Errorf("Failed to encode status response: %v", err)
+	}
+}
+
 // ListenAndServeTLSWithSelfSigned starts the server with a self-signed certificate
 func (s *Server) ListenAndServeTLSWithSelfSigned() error {
+	s.startBackgroundTasks()
+
 	cert, err := s.generateSelfSignedCert()
 	if err != nil {
 		return fmt.Errorf("failed to generate self-signed certificate: %v", err)
@@ -2268,48 +2827,58 @@ func (s *Server) ListenAndServeTLSWithSelfSigned() error {
 	}
 
 	klog.Infof("Starting HTTPS server with self-signed certificate")
-	klog.Infof("Use: oc get pods --server=https://%s:%d --insecure-skip-tls-verify", s.host, s.port)
+	if s.stateDir != "" {
+		klog.Infof("Use: oc get pods --server=https://%s:%d --certificate-authority=%s", s.host, s.port, filepath.Join(s.stateDir, "pki", caCertFileName))
+	} else {
+		klog.Infof("Use: oc get pods --server=https://%s:%d --insecure-skip-tls-verify", s.host, s.port)
+	}
 
 	return s.httpServer.ListenAndServeTLS("", "")
 }
 
-// ListenAndServeTLS starts the server with provided certificates
-func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
-	klog.Infof("Starting HTTPS server with provided certificate")
-	return s.httpServer.ListenAndServeTLS(certFile, keyFile)
-}
-
-// generateSelfSignedCert creates a self-signed certificate
-func (s *Server) generateSelfSignedCert() (tls.Certificate, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return tls.Certificate{}, err
+// SetInsecureServing enables a plain HTTP listener serving the same API without TLS.
+// It is restricted to loopback addresses since requests on it are not authenticated.
+func (s *Server) SetInsecureServing(bindAddress string, port int) error {
+	ip := net.ParseIP(bindAddress)
+	if bindAddress == "localhost" {
+		ip = net.ParseIP("127.0.0.1")
+	}
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("insecure bind address %q must be a loopback address", bindAddress)
 	}
 
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Organization: []string{"Podman-K8s-Adapter"},
-			Country:      []string{"US"},
-		},
-		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(365 * 24 * time.Hour),
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		IPAddresses: []net.IP{
-			net.ParseIP("127.0.0.1"),
-			net.ParseIP("::1"),
-		},
-		DNSNames: []string{"localhost"},
+	s.insecureServer = &http.Server{
+		Addr:    net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port)),
+		Handler: s.httpServer.Handler,
 	}
+	return nil
+}
+
+// ListenAndServeInsecure starts the plain HTTP listener configured with SetInsecureServing
+func (s *Server) ListenAndServeInsecure() error {
+	s.startBackgroundTasks()
+
+	klog.Infof("Starting insecure HTTP server on %s", s.insecureServer.Addr)
+	klog.Infof("Use: oc get pods --server=http://%s", s.insecureServer.Addr)
+	return s.insecureServer.ListenAndServe()
+}
+
+// ListenAndServeTLS starts the server with provided certificates. The files are watched
+// and reloaded when they change, so the certificate can be rotated without a restart.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	s.startBackgroundTasks()
 
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	reloader, err := newCertReloader(certFile, keyFile)
 	if err != nil {
-		return tls.Certificate{}, err
+		return err
 	}
+	s.certReloader = reloader
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	s.httpServer.TLSConfig = &tls.Config{
+		GetCertificate: reloader.getCertificate,
+	}
+	go reloader.watch(s.shutdownCh)
 
-	return tls.X509KeyPair(certPEM, keyPEM)
+	klog.Infof("Starting HTTPS server with provided certificate")
+	return s.httpServer.ListenAndServeTLS("", "")
 }
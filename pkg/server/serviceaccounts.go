@@ -0,0 +1,303 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// serviceAccountIssuer is the issuer of the service account tokens, and the audience of the
+// API server, which authenticates the tokens issued for it only
+const serviceAccountIssuer = "https://kubernetes.default.svc"
+
+// Users and groups of the service accounts, as kube-apiserver authenticates their tokens
+const (
+	serviceAccountUserPrefix  = "system:serviceaccount:"
+	serviceAccountsGroup      = "system:serviceaccounts"
+	serviceAccountGroupPrefix = "system:serviceaccounts:"
+)
+
+// Lifetimes of the service account tokens: requested ones default to an hour and last at least
+// 10 minutes, as with kube-apiserver, and those of projected volumes, which are not rotated,
+// are extended to a year as --service-account-extend-token-expiration does
+const (
+	tokenDefaultExpiration  = time.Hour
+	tokenMinExpiration      = 10 * time.Minute
+	tokenExtendedExpiration = 365 * 24 * time.Hour
+)
+
+// serviceAccountKeyFileName is the key signing the service account tokens, in the pki
+// directory of the state directory
+const serviceAccountKeyFileName = "sa.key"
+
+// serviceAccountClaims are the claims of the service account tokens, those of the tokens of
+// kube-apiserver
+type serviceAccountClaims struct {
+	Issuer     string   `json:"iss"`
+	Subject    string   `json:"sub"`
+	Audience   []string `json:"aud"`
+	IssuedAt   int64    `json:"iat"`
+	NotBefore  int64    `json:"nbf"`
+	Expiry     int64    `json:"exp"`
+	Kubernetes struct {
+		Namespace      string           `json:"namespace"`
+		ServiceAccount tokenObjectName  `json:"serviceaccount"`
+		Pod            *tokenObjectName `json:"pod,omitempty"`
+	} `json:"kubernetes.io"`
+}
+
+// tokenObjectName names the service account and the pod of a token
+type tokenObjectName struct {
+	Name string `json:"name"`
+}
+
+// tokenHeader is the JOSE header of the service account tokens, signed with HMAC SHA-256
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// serviceAccountTokens issues the tokens of service accounts, JWTs signed by a key that is
+// persisted with the self-signed CA, and kept in memory without a state directory. Service
+// accounts are not stored: every namespace has all of them.
+type serviceAccountTokens struct {
+	server *Server
+
+	once sync.Once
+	key  []byte
+	err  error
+}
+
+// signingKey returns the key signing the tokens, loaded or generated on first use
+func (t *serviceAccountTokens) signingKey() ([]byte, error) {
+	t.once.Do(func() {
+		path := ""
+		if t.server.stateDir != "" {
+			path = filepath.Join(t.server.stateDir, "pki", serviceAccountKeyFileName)
+			if key, err := os.ReadFile(path); err == nil && len(key) >= 32 {
+				t.key = key
+				return
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.err = fmt.Errorf("failed to read service account key: %v", err)
+				return
+			}
+		}
+
+		klog.Infof("Generating service account signing key")
+		t.key = make([]byte, 32)
+		if _, err := rand.Read(t.key); err != nil {
+			t.err = fmt.Errorf("failed to generate service account key: %v", err)
+			return
+		}
+		if path == "" {
+			return
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.err = fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+			return
+		}
+		if err := os.WriteFile(path, t.key, 0600); err != nil {
+			t.err = fmt.Errorf("failed to write service account key: %v", err)
+		}
+	})
+	return t.key, t.err
+}
+
+// issue returns a token of a service account for the audiences, bound to a pod unless podName
+// is empty, and its expiration time
+func (t *serviceAccountTokens) issue(namespace, name string, audiences []string, expiration time.Duration, podName string) (string, time.Time, error) {
+	key, err := t.signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(expiration)
+	claims := serviceAccountClaims{
+		Issuer:    serviceAccountIssuer,
+		Subject:   serviceAccountUserPrefix + namespace + ":" + name,
+		Audience:  audiences,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		Expiry:    expiry.Unix(),
+	}
+	claims.Kubernetes.Namespace = namespace
+	claims.Kubernetes.ServiceAccount.Name = name
+	if podName != "" {
+		claims.Kubernetes.Pod = &tokenObjectName{Name: podName}
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signed := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + tokenSignature(key, signed), expiry, nil
+}
+
+// tokenSignature returns the encoded signature of the header and payload of a token
+func tokenSignature(key []byte, signed string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authenticate returns the service account of a token issued for the API server. ours reports
+// whether the token is a service account token at all, so that others are looked up in the
+// static token file.
+func (t *serviceAccountTokens) authenticate(token string) (user AuditUserInfo, ok, ours bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return AuditUserInfo{}, false, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return AuditUserInfo{}, false, false
+	}
+	var claims serviceAccountClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != serviceAccountIssuer {
+		return AuditUserInfo{}, false, false
+	}
+
+	key, err := t.signingKey()
+	if err != nil || parts[0] != tokenHeader || !hmac.Equal([]byte(parts[2]), []byte(tokenSignature(key, parts[0]+"."+parts[1]))) {
+		return AuditUserInfo{}, false, true
+	}
+	now := time.Now().Unix()
+	if now >= claims.Expiry || now < claims.NotBefore || !slices.Contains(claims.Audience, serviceAccountIssuer) {
+		return AuditUserInfo{}, false, true
+	}
+
+	namespace := claims.Kubernetes.Namespace
+	return AuditUserInfo{
+		Username: claims.Subject,
+		Groups: []string{
+			serviceAccountsGroup,
+			serviceAccountGroupPrefix + namespace,
+			// SimpleRBAC gives service accounts the access of their namespace
+			namespaceGroupPrefix + namespace,
+			"system:authenticated",
+		},
+	}, true, true
+}
+
+// IssueToken issues the token of a serviceAccountToken source of a projected volume of a pod,
+// for the service account of the pod. The token is not rotated and its expiration extended.
+func (t *serviceAccountTokens) IssueToken(pod *corev1.Pod, audience string, expirationSeconds int64) (string, error) {
+	audiences := []string{serviceAccountIssuer}
+	if audience != "" {
+		audiences = []string{audience}
+	}
+	expiration := max(time.Duration(expirationSeconds)*time.Second, tokenExtendedExpiration)
+	token, _, err := t.issue(pod.Namespace, podServiceAccount(pod), audiences, expiration, pod.Name)
+	return token, err
+}
+
+// ClusterCA returns the certificate at the root of the chain the API server serves: the
+// self-signed CA, or the last certificate of --cert-file
+func (t *serviceAccountTokens) ClusterCA() ([]byte, error) {
+	config := t.server.httpServer.TLSConfig
+	var cert *tls.Certificate
+	switch {
+	case config == nil:
+		return nil, fmt.Errorf("the API server does not serve TLS")
+	case config.GetCertificate != nil:
+		var err error
+		if cert, err = config.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+	case len(config.Certificates) > 0:
+		cert = &config.Certificates[0]
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("the API server has no certificate")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[len(cert.Certificate)-1]}), nil
+}
+
+// podServiceAccount returns the service account of a pod, default when it sets none
+func podServiceAccount(pod *corev1.Pod) string {
+	if pod.Spec.ServiceAccountName != "" {
+		return pod.Spec.ServiceAccountName
+	}
+	return "default"
+}
+
+// createServiceAccountToken serves the TokenRequest of a service account, as kubectl create
+// token sends it. Tokens may be bound to a pod, but stay valid once it is deleted.
+func (s *Server) createServiceAccountToken(w http.ResponseWriter, r *http.Request, namespace, name string) {
+	var request authenticationv1.TokenRequest
+	if err := decodeBody(w, r, &request); err != nil {
+		s.writeDecodeError(w, "tokenrequest", err)
+		return
+	}
+
+	gk := schema.GroupKind{Group: authenticationv1.GroupName, Kind: "TokenRequest"}
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		s.writeStatusError(w, apierrors.NewNotFound(schema.GroupResource{Resource: "serviceaccounts"}, name))
+		return
+	}
+	expiration := tokenDefaultExpiration
+	if request.Spec.ExpirationSeconds != nil {
+		expiration = time.Duration(*request.Spec.ExpirationSeconds) * time.Second
+	}
+	specPath := field.NewPath("spec")
+	var errs field.ErrorList
+	if expiration < tokenMinExpiration {
+		errs = append(errs, field.Invalid(specPath.Child("expirationSeconds"), int64(expiration/time.Second), "may not specify a duration less than 10 minutes"))
+	}
+	podName := ""
+	if ref := request.Spec.BoundObjectRef; ref != nil {
+		if ref.Kind != "Pod" {
+			errs = append(errs, field.NotSupported(specPath.Child("boundObjectRef", "kind"), ref.Kind, []string{"Pod"}))
+		} else if pod, err := s.podStorage.Get(r.Context(), namespace, ref.Name); err != nil || pod == nil {
+			errs = append(errs, field.NotFound(specPath.Child("boundObjectRef", "name"), ref.Name))
+		} else if podServiceAccount(pod) != name {
+			errs = append(errs, field.Invalid(specPath.Child("boundObjectRef", "name"), ref.Name, fmt.Sprintf("pod runs with service account %s", podServiceAccount(pod))))
+		} else {
+			podName = pod.Name
+		}
+	}
+	if len(errs) > 0 {
+		s.writeStatusError(w, apierrors.NewInvalid(gk, name, errs))
+		return
+	}
+
+	audiences := request.Spec.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{serviceAccountIssuer}
+	}
+	token, expiry, err := s.serviceAccounts.issue(namespace, name, audiences, expiration, podName)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewInternalError(err))
+		return
+	}
+
+	request.TypeMeta = metav1.TypeMeta{Kind: "TokenRequest", APIVersion: authenticationv1.SchemeGroupVersion.String()}
+	request.Name, request.Namespace = name, namespace
+	request.CreationTimestamp = metav1.Now()
+	request.Spec.Audiences = audiences
+	request.Spec.ExpirationSeconds = new(int64)
+	*request.Spec.ExpirationSeconds = int64(expiration / time.Second)
+	request.Status = authenticationv1.TokenRequestStatus{Token: token, ExpirationTimestamp: metav1.NewTime(expiry)}
+	s.writeObjectWithStatus(w, r, http.StatusCreated, &request)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// serviceResource names services in API errors
+var serviceResource = schema.GroupResource{Resource: "services"}
+
+// serverStartTime is when podKube started, the creation time of the kubernetes service
+var serverStartTime = time.Now()
+
+// The kubernetes service of the default namespace, the API server as in-cluster clients reach it
+const (
+	kubernetesServiceName      = "kubernetes"
+	kubernetesServiceNamespace = "default"
+)
+
+// SetKubernetesService sets whether the containers of created pods get the environment and
+// names of the kubernetes service, pointing at the HTTPS listener of podKube through the host
+// gateway, and whether the service is served. It requires the HTTPS listener.
+func (s *Server) SetKubernetesService(enabled bool) error {
+	if !enabled {
+		s.kubernetesService.Store(false)
+		s.podStorage.SetKubernetesService(0)
+		return nil
+	}
+	if s.port == 0 {
+		return fmt.Errorf("the kubernetes service requires the HTTPS listener (--port)")
+	}
+	if ip := net.ParseIP(s.host); (ip != nil && ip.IsLoopback()) || s.host == "localhost" {
+		klog.Warningf("The kubernetes service points at %s:%d, which containers cannot reach", s.host, s.port)
+	}
+	s.kubernetesService.Store(true)
+	s.podStorage.SetKubernetesService(s.port)
+	return nil
+}
+
+// kubernetesServiceObject returns the kubernetes service of the default namespace, created
+// when podKube started, without cluster IP as containers reach it through the host gateway
+func (s *Server) kubernetesServiceObject() *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{Kind: "Service", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              kubernetesServiceName,
+			Namespace:         kubernetesServiceNamespace,
+			CreationTimestamp: metav1.NewTime(serverStartTime),
+			Labels: map[string]string{
+				"component": "apiserver",
+				"provider":  "kubernetes",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{{
+				Name:       "https",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       int32(s.port),
+				TargetPort: intstr.FromInt32(int32(s.port)),
+			}},
+			SessionAffinity: corev1.ServiceAffinityNone,
+		},
+	}
+}
+
+// serviceREST serves the kubernetes service, the only service, when it is enabled
+type serviceREST struct {
+	server *Server
+}
+
+func (sr *serviceREST) New() runtime.Object {
+	return &corev1.Service{}
+}
+
+func (sr *serviceREST) Get(ctx context.Context, namespace, name string) (runtime.Object, error) {
+	if !sr.server.kubernetesService.Load() || namespace != kubernetesServiceNamespace || name != kubernetesServiceName {
+		return nil, apierrors.NewNotFound(serviceResource, name)
+	}
+	return sr.server.kubernetesServiceObject(), nil
+}
+
+func (sr *serviceREST) List(ctx context.Context, namespace string) (runtime.Object, error) {
+	list := &corev1.ServiceList{TypeMeta: metav1.TypeMeta{Kind: "ServiceList", APIVersion: "v1"}}
+	if sr.server.kubernetesService.Load() && (namespace == "" || namespace == kubernetesServiceNamespace) {
+		list.Items = append(list.Items, *sr.server.kubernetesServiceObject())
+	}
+	return list, nil
+}
+
+func (sr *serviceREST) ConvertToTable(obj runtime.Object) *metav1.Table {
+	if service, ok := obj.(*corev1.Service); ok {
+		return serviceListToTable(&corev1.ServiceList{Items: []corev1.Service{*service}})
+	}
+	return serviceListToTable(obj.(*corev1.ServiceList))
+}
+
+// serviceListToTable converts a ServiceList to the table format used by kubectl get services
+func serviceListToTable(serviceList *corev1.ServiceList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the service"},
+			{Name: "Type", Type: "string", Description: "Type of the service"},
+			{Name: "Cluster-IP", Type: "string", Description: "Cluster IP of the service"},
+			{Name: "Port(s)", Type: "string", Description: "Ports of the service"},
+			{Name: "Age", Type: "string", Description: "Time since the service was created"},
+		},
+	}
+
+	for _, service := range serviceList.Items {
+		clusterIP := service.Spec.ClusterIP
+		if clusterIP == "" {
+			clusterIP = "<none>"
+		}
+		ports := make([]string, 0, len(service.Spec.Ports))
+		for _, port := range service.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				service.Name,
+				string(service.Spec.Type),
+				clusterIP,
+				strings.Join(ports, ","),
+				translateTimestampSince(service.CreationTimestamp),
+			},
+			Object: runtime.RawExtension{
+				Object: service.DeepCopy(),
+			},
+		})
+	}
+
+	return table
+}
+
+// handleServiceProxy handles service proxy requests:
+// /api/v1/namespaces/{namespace}/services/{[scheme:]name[:port]}/proxy[/{path}]. The only
+// service served, kubernetes, is backed by the HTTPS listener of podKube, so its proxy
+// reaches the API as in-cluster clients going through the service would, without the
+// credentials of the client.
+func (s *Server) handleServiceProxy(w http.ResponseWriter, r *http.Request, namespace, id, path string) {
+	if s.rejectIfShuttingDown(w) {
+		return
+	}
+	defer s.beginSession()()
+
+	scheme, name, port, valid := utilnet.SplitSchemeNamePort(id)
+	if !valid {
+		s.writeStatusError(w, apierrors.NewBadRequest(fmt.Sprintf("invalid request %q", id)))
+		return
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	if !s.kubernetesService.Load() || namespace != kubernetesServiceNamespace || name != kubernetesServiceName {
+		s.writeStatusError(w, apierrors.NewNotFound(serviceResource, name))
+		return
+	}
+	servicePort, ok := findServicePort(s.kubernetesServiceObject(), port)
+	if !ok {
+		s.writeStatusError(w, apierrors.NewServiceUnavailable(fmt.Sprintf("no service port %q found for service %q", port, name)))
+		return
+	}
+
+	address := net.JoinHostPort(s.serviceEndpointHost(), servicePort.TargetPort.String())
+	klog.V(2).Infof("Proxying %s %s to service %s/%s at %s://%s", r.Method, path, namespace, name, scheme, address)
+	s.reverseProxy(scheme, address, path, "service "+name).ServeHTTP(w, r)
+}
+
+// findServicePort returns the port of a service named or numbered port, or its only port
+// when port is empty
+func findServicePort(service *corev1.Service, port string) (corev1.ServicePort, bool) {
+	for _, servicePort := range service.Spec.Ports {
+		if port == "" && len(service.Spec.Ports) == 1 || port == servicePort.Name || port == strconv.Itoa(int(servicePort.Port)) {
+			return servicePort, true
+		}
+	}
+	return corev1.ServicePort{}, false
+}
+
+// serviceEndpointHost returns the address podKube reaches its own listener at, the endpoint
+// of the kubernetes service
+func (s *Server) serviceEndpointHost() string {
+	if ip := net.ParseIP(s.host); s.host == "" || (ip != nil && ip.IsUnspecified()) {
+		return "127.0.0.1"
+	}
+	return s.host
+}
+
+// kubernetesServiceSANs returns the names of the kubernetes service the serving certificate
+// covers when the service is enabled, for in-cluster clients to verify it
+func (s *Server) kubernetesServiceSANs() []string {
+	if !s.kubernetesService.Load() {
+		return nil
+	}
+	return storage.KubernetesServiceHostnames
+}
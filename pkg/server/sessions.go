@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+)
+
+// execSession is an active exec session, as listed by /debug/sessions
+type execSession struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // exec
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container,omitempty"`
+	Command   []string  `json:"command,omitempty"`
+	TTY       bool      `json:"tty"`
+	User      string    `json:"user"`
+	Started   time.Time `json:"started"`
+
+	cancel context.CancelFunc // Terminates the session
+}
+
+// sessionManager tracks the active exec sessions, caps how many run at once and lets
+// administrators terminate them
+type sessionManager struct {
+	mu     sync.Mutex
+	max    int // Maximum number of concurrent sessions, 0 for no limit
+	nextID uint64
+	active map[string]*execSession
+
+	// Counters exposed as metrics
+	started    uint64
+	rejected   uint64
+	terminated uint64
+}
+
+// setMax sets the maximum number of concurrent sessions; sessions beyond a lowered maximum
+// keep running, new ones are rejected until enough of them end
+func (m *sessionManager) setMax(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.max = max
+}
+
+// begin registers a session, unless the maximum number of sessions are already running. The
+// session runs under the returned context, cancelled when it is terminated, and the returned
+// function must be called when it ends.
+func (m *sessionManager) begin(ctx context.Context, session execSession) (context.Context, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.max > 0 && len(m.active) >= m.max {
+		m.rejected++
+		return nil, nil, fmt.Errorf("too many exec sessions: %d are running, the maximum is %d", len(m.active), m.max)
+	}
+	if m.active == nil {
+		m.active = map[string]*execSession{}
+	}
+
+	m.nextID++
+	m.started++
+	session.ID = strconv.FormatUint(m.nextID, 10)
+	session.Started = time.Now()
+	ctx, session.cancel = context.WithCancel(ctx)
+	m.active[session.ID] = &session
+
+	return ctx, func() {
+		session.cancel()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.active, session.ID)
+	}, nil
+}
+
+// list returns the active sessions, oldest first
+func (m *sessionManager) list() []execSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := make([]execSession, 0, len(m.active))
+	for _, session := range m.active {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Started.Before(sessions[j].Started)
+	})
+	return sessions
+}
+
+// terminate ends a session by killing its process; it returns false for unknown sessions
+func (m *sessionManager) terminate(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.active[id]
+	if !ok {
+		return false
+	}
+	m.terminated++
+	session.cancel()
+	return true
+}
+
+// streamTimeouts bound how long an exec client may take to create its streams, and how
+// long the streams of a session may stay idle before it is closed
+type streamTimeouts struct {
+	creation time.Duration
+	idle     time.Duration
+}
+
+// SetStreamTimeouts sets the default stream creation and idle timeouts of exec sessions; an
+// idle timeout of 0 keeps idle sessions open
+func (s *Server) SetStreamTimeouts(creation, idle time.Duration) error {
+	if creation <= 0 {
+		return fmt.Errorf("the stream creation timeout must be positive, got %s", creation)
+	}
+	if idle < 0 {
+		return fmt.Errorf("the stream idle timeout cannot be negative, got %s", idle)
+	}
+	s.streamCreationTimeout.Store(int64(creation))
+	s.streamIdleTimeout.Store(int64(idle))
+	return nil
+}
+
+// requestStreamTimeouts returns the stream timeouts of an exec request: the defaults, unless
+// overridden by its streamCreationTimeout and streamIdleTimeout parameters, named after the
+// streaming settings of the kubelet (e.g. streamIdleTimeout=8h)
+func (s *Server) requestStreamTimeouts(r *http.Request) (streamTimeouts, error) {
+	timeouts := streamTimeouts{
+		creation: time.Duration(s.streamCreationTimeout.Load()),
+		idle:     time.Duration(s.streamIdleTimeout.Load()),
+	}
+	for name, timeout := range map[string]*time.Duration{
+		"streamCreationTimeout": &timeouts.creation,
+		"streamIdleTimeout":     &timeouts.idle,
+	} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return timeouts, fmt.Errorf("invalid %s %q, expected a positive duration such as 30s or 4h", name, value)
+		}
+		*timeout = duration
+	}
+	return timeouts, nil
+}
+
+// SetMaxExecSessions sets the maximum number of concurrent exec sessions (0 means no limit);
+// exec requests beyond it are rejected with 429 Too Many Requests
+func (s *Server) SetMaxExecSessions(max int) {
+	s.execSessions.setMax(max)
+}
+
+// handleSessionList lists the active exec sessions
+func (s *Server) handleSessionList(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, map[string]interface{}{
+		"sessions": s.execSessions.list(),
+	})
+}
+
+// handleSessionTerminate terminates an active exec session, such as one left behind by a
+// client that vanished
+func (s *Server) handleSessionTerminate(w http.ResponseWriter, r *http.Request, id string) {
+	if !s.execSessions.terminate(id) {
+		s.writeStatusError(w, apierrors.NewNotFound(schema.GroupResource{Resource: "sessions"}, id))
+		return
+	}
+	klog.Infof("Terminated exec session %s on request of %s", id, requestUser(r).Username)
+	s.writeJSON(w, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+		Message:  fmt.Sprintf("exec session %s terminated", id),
+	})
+}
+
+// writeMetrics writes the session metrics in the Prometheus text format
+func (m *sessionManager) writeMetrics(w *metricsWriter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.gauge("podkube_exec_sessions_active", "Number of running exec sessions", float64(len(m.active)))
+	w.gauge("podkube_exec_sessions_max", "Maximum number of concurrent exec sessions, 0 for no limit", float64(m.max))
+	w.counter("podkube_exec_sessions_started_total", "Number of exec sessions started", float64(m.started))
+	w.counter("podkube_exec_sessions_rejected_total", "Number of exec sessions rejected by the concurrent session limit", float64(m.rejected))
+	w.counter("podkube_exec_sessions_terminated_total", "Number of exec sessions terminated through /debug/sessions", float64(m.terminated))
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+)
+
+// Shutdown gracefully stops the server: listeners are closed, active watches receive a final
+// bookmark and are ended, and in-flight exec/log sessions are given until ctx expires to finish.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		klog.Infof("Shutting down: closing listeners and draining active sessions")
+		close(s.shutdownCh)
+	})
+
+	// Stops accepting connections and waits for regular handlers (watches end on shutdownCh)
+	var insecureErr error
+	insecureDone := make(chan struct{})
+	go func() {
+		defer close(insecureDone)
+		if s.insecureServer != nil {
+			insecureErr = s.insecureServer.Shutdown(ctx)
+		}
+	}()
+	err := s.httpServer.Shutdown(ctx)
+	<-insecureDone
+	if err == nil {
+		err = insecureErr
+	}
+
+	// Hijacked connections (SPDY exec) are not tracked by http.Server, wait for them explicitly
+	sessionsDone := make(chan struct{})
+	go func() {
+		s.sessions.Wait()
+		close(sessionsDone)
+	}()
+
+	select {
+	case <-sessionsDone:
+		klog.Infof("All exec and log sessions completed")
+	case <-ctx.Done():
+		klog.Warningf("Shutdown timeout reached with exec/log sessions still running, closing them")
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	s.cancel()
+	return err
+}
+
+// ShutdownCh returns a channel that is closed when the server starts shutting down
+func (s *Server) ShutdownCh() <-chan struct{} {
+	return s.shutdownCh
+}
+
+// isShuttingDown reports whether Shutdown has been called
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// beginSession registers a long-running exec or log session that shutdown should wait for.
+// The returned function must be called when the session ends.
+func (s *Server) beginSession() func() {
+	s.sessions.Add(1)
+	return s.sessions.Done
+}
+
+// rejectIfShuttingDown answers 503 to new streaming sessions once shutdown has started
+func (s *Server) rejectIfShuttingDown(w http.ResponseWriter) bool {
+	if !s.isShuttingDown() {
+		return false
+	}
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+// writeWatchBookmark sends a BOOKMARK event so clients can resume the watch after a restart,
+// or know the initial events of a watch list are over. Its pod carries only the metadata given,
+// with the current time as resourceVersion when it sets none.
+func (s *Server) writeWatchBookmark(w http.ResponseWriter, metadata metav1.ObjectMeta) error {
+	if metadata.ResourceVersion == "" {
+		metadata.ResourceVersion = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	bookmark := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metadata,
+	}
+
+	event := &metav1.WatchEvent{
+		Type:   string(watch.Bookmark),
+		Object: *s.podToRawExtension(bookmark),
+	}
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
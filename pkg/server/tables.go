@@ -0,0 +1,354 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// podColumn is a custom pod table column, whose cells are the values of a field path
+type podColumn struct {
+	Name string
+	Path []string // Field names, indexes ("0") and wildcards ("*") from the root of the pod
+}
+
+// parsePodColumns parses custom pod columns in the kubectl custom-columns format:
+// NAME:.metadata.name,NODE:.spec.nodeName,IMAGES:.spec.containers[*].image.
+// Paths select fields, list indexes and, with [*], every element of a list.
+func parsePodColumns(spec string) ([]podColumn, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var columns []podColumn
+	for _, definition := range strings.Split(spec, ",") {
+		name, path, ok := strings.Cut(definition, ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid pod column %q, expected NAME:.field.path", definition)
+		}
+		path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+		if !strings.HasPrefix(path, ".") {
+			return nil, fmt.Errorf("invalid path %q of pod column %s, paths start with a dot", path, name)
+		}
+
+		column := podColumn{Name: name}
+		for _, field := range strings.Split(path[1:], ".") {
+			field, index, hasIndex := strings.Cut(field, "[")
+			if field == "" && !hasIndex {
+				return nil, fmt.Errorf("invalid path %q of pod column %s, empty field", path, name)
+			}
+			if field != "" {
+				column.Path = append(column.Path, field)
+			}
+			if hasIndex {
+				index = strings.TrimSuffix(index, "]")
+				if _, err := strconv.Atoi(index); err != nil && index != "*" {
+					return nil, fmt.Errorf("invalid index [%s] in path %q of pod column %s", index, path, name)
+				}
+				column.Path = append(column.Path, index)
+			}
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// SetPodColumns replaces the columns of pod tables (oc get pods) with custom columns, in the
+// kubectl custom-columns format; an empty spec restores the default columns
+func (s *Server) SetPodColumns(spec string) error {
+	columns, err := parsePodColumns(spec)
+	if err != nil {
+		return err
+	}
+	s.podColumns.Store(&columns)
+	return nil
+}
+
+// customPodColumns returns the custom pod columns, nil for the default ones
+func (s *Server) customPodColumns() []podColumn {
+	if columns := s.podColumns.Load(); columns != nil {
+		return *columns
+	}
+	return nil
+}
+
+// customPodListToTable converts a PodList to a table of custom columns
+func customPodListToTable(podList *corev1.PodList, columns []podColumn) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+	}
+	for i, column := range columns {
+		definition := metav1.TableColumnDefinition{Name: column.Name, Type: "string"}
+		if i == 0 {
+			definition.Format = "name"
+		}
+		table.ColumnDefinitions = append(table.ColumnDefinitions, definition)
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+		if err != nil {
+			klog.Errorf("Failed to convert pod %s for its table row: %v", pod.Name, err)
+			continue
+		}
+
+		row := metav1.TableRow{Object: runtime.RawExtension{Object: pod.DeepCopy()}}
+		for _, column := range columns {
+			row.Cells = append(row.Cells, formatColumnValues(selectField(fields, column.Path)))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table
+}
+
+// selectField returns the values at path in an unstructured object
+func selectField(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		if field, ok := typed[path[0]]; ok {
+			return selectField(field, path[1:])
+		}
+	case []interface{}:
+		if path[0] == "*" {
+			var values []interface{}
+			for _, element := range typed {
+				values = append(values, selectField(element, path[1:])...)
+			}
+			return values
+		}
+		if index, err := strconv.Atoi(path[0]); err == nil && index >= 0 && index < len(typed) {
+			return selectField(typed[index], path[1:])
+		}
+	}
+	return nil
+}
+
+// formatColumnValues renders the values of a custom column cell like kubectl does: scalars
+// as is, objects and lists as JSON, several values comma-separated, no value as <none>
+func formatColumnValues(values []interface{}) string {
+	var cells []string
+	for _, value := range values {
+		switch typed := value.(type) {
+		case nil:
+		case string:
+			cells = append(cells, typed)
+		case map[string]interface{}, []interface{}:
+			data, _ := json.Marshal(typed)
+			cells = append(cells, string(data))
+		default:
+			cells = append(cells, fmt.Sprint(typed))
+		}
+	}
+	if len(cells) == 0 {
+		return "<none>"
+	}
+	return strings.Join(cells, ",")
+}
+
+// includeObjectPolicy returns the includeObject parameter of a table request: whether rows
+// carry their whole object (the default), its metadata only, or nothing
+func includeObjectPolicy(r *http.Request) (metav1.IncludeObjectPolicy, error) {
+	switch policy := metav1.IncludeObjectPolicy(r.URL.Query().Get("includeObject")); policy {
+	case "":
+		return metav1.IncludeObject, nil
+	case metav1.IncludeNone, metav1.IncludeMetadata, metav1.IncludeObject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid includeObject %q (supported: %s, %s, %s)", policy, metav1.IncludeNone, metav1.IncludeMetadata, metav1.IncludeObject)
+	}
+}
+
+// applyIncludeObject replaces the objects of the rows of a table according to policy
+func applyIncludeObject(table *metav1.Table, policy metav1.IncludeObjectPolicy) {
+	for i := range table.Rows {
+		row := &table.Rows[i]
+		switch policy {
+		case metav1.IncludeNone:
+			row.Object = runtime.RawExtension{}
+		case metav1.IncludeMetadata:
+			if row.Object.Object == nil {
+				continue
+			}
+			accessor, err := meta.Accessor(row.Object.Object)
+			if err != nil {
+				continue
+			}
+			partial := meta.AsPartialObjectMetadata(accessor)
+			partial.TypeMeta = metav1.TypeMeta{Kind: "PartialObjectMetadata", APIVersion: "meta.k8s.io/v1"}
+			row.Object = runtime.RawExtension{Object: partial}
+		}
+	}
+}
+
+// writeTable writes a table, its rows carrying their objects as requested by includeObject
+func (s *Server) writeTable(w http.ResponseWriter, r *http.Request, table *metav1.Table) {
+	policy, err := includeObjectPolicy(r)
+	if err != nil {
+		s.writeStatusError(w, apierrors.NewBadRequest(err.Error()))
+		return
+	}
+	applyIncludeObject(table, policy)
+	data, err := json.Marshal(table)
+	if err != nil {
+		klog.Errorf("Failed to encode table response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if notModified(w, r, data) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		klog.V(4).Infof("Failed to write response: %v", err)
+	}
+}
+
+// secretListToTable converts a SecretList to the table format used by oc get secrets
+func secretListToTable(secretList *corev1.SecretList) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace"},
+			{Name: "Type", Type: "string", Description: "The type of the secret"},
+			{Name: "Data", Type: "string", Description: "The number of keys in the secret"},
+			{Name: "Age", Type: "string", Description: "Time since the secret was created"},
+		},
+	}
+
+	for i := range secretList.Items {
+		secret := &secretList.Items[i]
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				secret.Name,
+				string(secret.Type),
+				strconv.Itoa(len(secret.Data) + len(secret.StringData)),
+				translateTimestampSince(secret.CreationTimestamp),
+			},
+			Object: runtime.RawExtension{
+				Object: secret.DeepCopy(),
+			},
+		})
+	}
+	return table
+}
+
+// namespaceListToTable converts a NamespaceList to the table format used by oc get namespaces,
+// with the number of pods of each namespace from podCounts in the wide output (nil when the
+// pods could not be listed)
+func namespaceListToTable(namespaceList *corev1.NamespaceList, podCounts map[string]int) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the namespace"},
+			{Name: "Status", Type: "string", Description: "The phase of the namespace"},
+			{Name: "Age", Type: "string", Description: "Time since the namespace was created"},
+			{Name: "Pods", Type: "string", Priority: 1, Description: "Number of pods in the namespace"},
+		},
+	}
+
+	for i := range namespaceList.Items {
+		namespace := &namespaceList.Items[i]
+		phase := string(namespace.Status.Phase)
+		if phase == "" {
+			phase = string(corev1.NamespaceActive)
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				namespace.Name,
+				phase,
+				translateTimestampSince(namespace.CreationTimestamp),
+				podCountCell(podCounts, namespace.Name),
+			},
+			Object: runtime.RawExtension{
+				Object: namespace.DeepCopy(),
+			},
+		})
+	}
+	return table
+}
+
+// projectListToTable converts a ProjectList to the table format used by oc get projects, with
+// the number of pods of each project from podCounts (nil when the pods could not be listed)
+func projectListToTable(projectList *storage.ProjectList, podCounts map[string]int) *metav1.Table {
+	table := &metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name of the project"},
+			{Name: "Display Name", Type: "string", Description: "The display name of the project"},
+			{Name: "Status", Type: "string", Description: "The phase of the project"},
+			{Name: "Age", Type: "string", Description: "Time since the project was created"},
+			{Name: "Pods", Type: "string", Description: "Number of pods in the project"},
+		},
+	}
+
+	for i := range projectList.Items {
+		project := &projectList.Items[i]
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells: []interface{}{
+				project.Name,
+				project.Annotations["openshift.io/display-name"],
+				project.Status.Phase,
+				translateTimestampSince(project.CreationTimestamp),
+				podCountCell(podCounts, project.Name),
+			},
+			Object: runtime.RawExtension{
+				Object: project.DeepCopy(),
+			},
+		})
+	}
+	return table
+}
+
+// podCountCell returns the cell of the number of pods of a namespace, <unknown> when the
+// pods could not be listed
+func podCountCell(podCounts map[string]int, namespace string) string {
+	if podCounts == nil {
+		return "<unknown>"
+	}
+	return strconv.Itoa(podCounts[namespace])
+}
+
+// namespacePodCounts returns the number of pods of each namespace, for the tables of
+// namespaces and projects, or nil when the pods cannot be listed
+func (s *Server) namespacePodCounts(ctx context.Context) map[string]int {
+	podList, err := s.podStorage.List(ctx, "", "", "")
+	if err != nil {
+		klog.Warningf("Failed to count the pods of the namespaces: %v", err)
+		return nil
+	}
+	counts := map[string]int{}
+	for i := range podList.Items {
+		counts[podList.Items[i].Namespace]++
+	}
+	return counts
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiAssets are the files of the web UI served under /ui/
+//
+//go:embed ui
+var uiAssets embed.FS
+
+// registerUI routes the web UI, a single page dashboard of namespaces and pods with live
+// logs and an exec terminal. It only talks to the API endpoints of the server: the pod
+// list, the follow mode of pod logs and websocket exec.
+func (s *Server) registerUI(rt *router) {
+	assets, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		panic(err)
+	}
+	rt.handle("/ui", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusMovedPermanently)
+	}, http.MethodGet)
+	rt.handle("/ui/", http.StripPrefix("/ui/", http.FileServerFS(assets)).ServeHTTP, http.MethodGet)
+}
@@ -0,0 +1,298 @@
+// podKube web UI: namespaces and pods from the API, with live logs and an exec terminal
+// over the websocket exec protocol (v4.channel.k8s.io) of the server.
+'use strict';
+
+const refreshInterval = 5000;
+
+// Channels of the websocket exec protocol
+const stdinChannel = 0;
+const stdoutChannel = 1;
+const stderrChannel = 2;
+const errorChannel = 3;
+const resizeChannel = 4;
+
+const state = {
+  namespace: '',
+  pod: null,        // Selected pod
+  logs: null,       // AbortController of the followed logs
+  socket: null,     // Websocket of the exec session
+  terminal: null,   // xterm.js terminal of the exec session
+};
+
+const $ = (id) => document.getElementById(id);
+
+async function getJSON(path) {
+  const response = await fetch(path, { headers: { Accept: 'application/json' } });
+  if (!response.ok) {
+    let message = `${response.status} ${response.statusText}`;
+    try {
+      message = (await response.json()).message || message;
+    } catch (e) {
+      // Not a Status
+    }
+    throw new Error(message);
+  }
+  return response.json();
+}
+
+function podPath(pod, subresource) {
+  return `/api/v1/namespaces/${encodeURIComponent(pod.metadata.namespace)}/pods/${encodeURIComponent(pod.metadata.name)}/${subresource}`;
+}
+
+async function loadVersion() {
+  try {
+    const version = await getJSON('/version');
+    $('version').textContent = version.gitVersion;
+  } catch (e) {
+    // The version is informative only
+  }
+}
+
+async function loadNamespaces() {
+  const list = await getJSON('/api/v1/namespaces');
+  const select = $('namespace');
+  for (const namespace of list.items || []) {
+    const option = document.createElement('option');
+    option.value = namespace.metadata.name;
+    option.textContent = namespace.metadata.name;
+    select.appendChild(option);
+  }
+}
+
+function podSummary(pod) {
+  const statuses = (pod.status && pod.status.containerStatuses) || [];
+  const ready = statuses.filter((status) => status.ready).length;
+  const restarts = statuses.reduce((total, status) => total + (status.restartCount || 0), 0);
+  return {
+    ready: `${ready}/${statuses.length}`,
+    phase: (pod.status && pod.status.phase) || 'Unknown',
+    restarts: String(restarts),
+    node: pod.spec.nodeName || '<none>',
+    image: pod.spec.containers.map((container) => container.image).join(', '),
+  };
+}
+
+async function loadPods() {
+  const path = state.namespace ? `/api/v1/namespaces/${encodeURIComponent(state.namespace)}/pods` : '/api/v1/pods';
+  try {
+    const list = await getJSON(path);
+    renderPods(list.items || []);
+    $('error').hidden = true;
+  } catch (e) {
+    $('error').textContent = `Failed to list pods: ${e.message}`;
+    $('error').hidden = false;
+  }
+}
+
+function renderPods(pods) {
+  const rows = $('pod-rows');
+  rows.replaceChildren();
+  for (const pod of pods) {
+    const summary = podSummary(pod);
+    const row = document.createElement('tr');
+    for (const value of [pod.metadata.name, pod.metadata.namespace, summary.ready, summary.phase, summary.restarts, summary.node, summary.image]) {
+      const cell = document.createElement('td');
+      cell.textContent = value;
+      row.appendChild(cell);
+    }
+    row.children[3].className = summary.phase;
+    if (state.pod && state.pod.metadata.uid === pod.metadata.uid) {
+      row.classList.add('selected');
+    }
+    row.addEventListener('click', () => selectPod(pod));
+    rows.appendChild(row);
+  }
+}
+
+function selectPod(pod) {
+  closeDetails();
+  state.pod = pod;
+  $('pod-name').textContent = `${pod.metadata.namespace}/${pod.metadata.name}`;
+  const select = $('container');
+  select.replaceChildren();
+  for (const container of pod.spec.containers) {
+    const option = document.createElement('option');
+    option.value = container.name;
+    option.textContent = container.name;
+    select.appendChild(option);
+  }
+  select.hidden = pod.spec.containers.length < 2;
+  $('details').hidden = false;
+  showLogs();
+}
+
+function closeDetails() {
+  stopLogs();
+  stopTerminal();
+  state.pod = null;
+  $('details').hidden = true;
+}
+
+function setTab(tab) {
+  $('show-logs').classList.toggle('active', tab === 'logs');
+  $('show-terminal').classList.toggle('active', tab === 'terminal');
+  $('logs').hidden = tab !== 'logs';
+  $('terminal').hidden = tab !== 'terminal';
+}
+
+// showLogs follows the logs of the selected container
+async function showLogs() {
+  stopLogs();
+  stopTerminal();
+  setTab('logs');
+
+  const output = $('logs');
+  output.textContent = '';
+  const controller = new AbortController();
+  state.logs = controller;
+  const query = new URLSearchParams({ follow: 'true', tailLines: '500', container: $('container').value });
+  try {
+    const response = await fetch(`${podPath(state.pod, 'log')}?${query}`, { signal: controller.signal });
+    if (!response.ok) {
+      output.textContent = `Failed to get logs: ${response.status} ${await response.text()}`;
+      return;
+    }
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        break;
+      }
+      const follow = output.scrollTop + output.clientHeight >= output.scrollHeight - 5;
+      output.textContent += decoder.decode(value, { stream: true });
+      if (follow) {
+        output.scrollTop = output.scrollHeight;
+      }
+    }
+  } catch (e) {
+    if (e.name !== 'AbortError') {
+      output.textContent += `\n[logs stopped: ${e.message}]`;
+    }
+  }
+}
+
+function stopLogs() {
+  if (state.logs) {
+    state.logs.abort();
+    state.logs = null;
+  }
+}
+
+// showTerminal opens an interactive shell in the selected container
+function showTerminal() {
+  stopLogs();
+  stopTerminal();
+  setTab('terminal');
+
+  const container = $('terminal');
+  container.replaceChildren();
+  if (typeof Terminal === 'undefined') {
+    container.textContent = 'The terminal needs xterm.js, which could not be loaded from cdn.jsdelivr.net.';
+    return;
+  }
+
+  const terminal = new Terminal({ cursorBlink: true, convertEol: false });
+  terminal.open(container);
+  fitTerminal(terminal);
+  state.terminal = terminal;
+
+  // The size of the terminal is sent upfront, so that the shell starts at that size
+  const query = new URLSearchParams({
+    container: $('container').value,
+    stdin: 'true',
+    stdout: 'true',
+    tty: 'true',
+    width: String(terminal.cols),
+    height: String(terminal.rows),
+  });
+  for (const part of ['/bin/sh', '-c', 'command -v bash >/dev/null && exec bash || exec sh']) {
+    query.append('command', part);
+  }
+  const scheme = location.protocol === 'https:' ? 'wss:' : 'ws:';
+  const socket = new WebSocket(`${scheme}//${location.host}${podPath(state.pod, 'exec')}?${query}`, ['v4.channel.k8s.io']);
+  socket.binaryType = 'arraybuffer';
+  state.socket = socket;
+
+  const encoder = new TextEncoder();
+  const send = (channel, data) => {
+    if (socket.readyState !== WebSocket.OPEN) {
+      return;
+    }
+    const bytes = typeof data === 'string' ? encoder.encode(data) : data;
+    const frame = new Uint8Array(bytes.length + 1);
+    frame[0] = channel;
+    frame.set(bytes, 1);
+    socket.send(frame);
+  };
+  const resize = () => send(resizeChannel, JSON.stringify({ width: terminal.cols, height: terminal.rows }));
+
+  socket.onopen = () => terminal.focus();
+  socket.onmessage = (event) => {
+    const data = new Uint8Array(event.data);
+    if (data.length === 0) {
+      return;
+    }
+    const payload = data.subarray(1);
+    switch (data[0]) {
+      case stdoutChannel:
+      case stderrChannel:
+        terminal.write(payload);
+        break;
+      case errorChannel: {
+        const status = JSON.parse(new TextDecoder().decode(payload));
+        if (status.status !== 'Success') {
+          terminal.write(`\r\n[${status.message}]\r\n`);
+        }
+        break;
+      }
+    }
+  };
+  socket.onclose = () => terminal.write('\r\n[session closed]\r\n');
+  terminal.onData((data) => send(stdinChannel, data));
+  terminal.onResize(resize);
+}
+
+// fitTerminal sizes the terminal to its container, from the size of a character cell
+function fitTerminal(terminal) {
+  const container = $('terminal');
+  const cell = terminal.element.querySelector('.xterm-rows > div');
+  if (!cell) {
+    return;
+  }
+  const width = cell.getBoundingClientRect().width / Math.max(terminal.cols, 1);
+  const height = cell.getBoundingClientRect().height;
+  if (width > 0 && height > 0) {
+    terminal.resize(Math.floor(container.clientWidth / width) - 1, Math.floor(container.clientHeight / height));
+  }
+}
+
+function stopTerminal() {
+  if (state.socket) {
+    state.socket.close();
+    state.socket = null;
+  }
+  if (state.terminal) {
+    state.terminal.dispose();
+    state.terminal = null;
+  }
+}
+
+$('namespace').addEventListener('change', (event) => {
+  state.namespace = event.target.value;
+  closeDetails();
+  loadPods();
+});
+$('container').addEventListener('change', () => ($('show-terminal').classList.contains('active') ? showTerminal() : showLogs()));
+$('show-logs').addEventListener('click', showLogs);
+$('show-terminal').addEventListener('click', showTerminal);
+$('close').addEventListener('click', closeDetails);
+window.addEventListener('resize', () => state.terminal && fitTerminal(state.terminal));
+
+loadVersion();
+loadNamespaces().catch((e) => {
+  $('error').textContent = `Failed to list namespaces: ${e.message}`;
+  $('error').hidden = false;
+});
+loadPods();
+setInterval(loadPods, refreshInterval);
@@ -0,0 +1,65 @@
+package server
+
+import (
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// validateObjectMeta validates the metadata of an object created, when old is nil, or updated,
+// as kube-apiserver does: the name must be a DNS subdomain, label keys and values, annotation
+// keys and finalizers must be qualified names and the annotations may not exceed 256KiB.
+//
+// On updates only the labels, annotations and finalizers added or changed are validated: the
+// containers of podman carry the labels of their image, such as a maintainer with an email
+// address, which are not valid label values but must not prevent updating their pods.
+func validateObjectMeta(meta, old *metav1.ObjectMeta) field.ErrorList {
+	metaPath := field.NewPath("metadata")
+	var errs field.ErrorList
+
+	labels, annotations, finalizers := meta.Labels, meta.Annotations, meta.Finalizers
+	if old == nil {
+		for _, msg := range apivalidation.NameIsDNSSubdomain(meta.Name, false) {
+			errs = append(errs, field.Invalid(metaPath.Child("name"), meta.Name, msg))
+		}
+	} else {
+		labels = changedEntries(meta.Labels, old.Labels)
+		annotations = changedEntries(meta.Annotations, old.Annotations)
+		finalizers = nil
+		for _, finalizer := range meta.Finalizers {
+			if !containsString(old.Finalizers, finalizer) {
+				finalizers = append(finalizers, finalizer)
+			}
+		}
+		if err := apivalidation.ValidateAnnotationsSize(meta.Annotations); err != nil {
+			errs = append(errs, field.TooLong(metaPath.Child("annotations"), "", apivalidation.TotalAnnotationSizeLimitB))
+		}
+	}
+
+	errs = append(errs, metav1validation.ValidateLabels(labels, metaPath.Child("labels"))...)
+	errs = append(errs, apivalidation.ValidateAnnotations(annotations, metaPath.Child("annotations"))...)
+	errs = append(errs, apivalidation.ValidateFinalizers(finalizers, metaPath.Child("finalizers"))...)
+	return errs
+}
+
+// changedEntries returns the entries of a map that are not in old with the same value
+func changedEntries(entries, old map[string]string) map[string]string {
+	changed := map[string]string{}
+	for key, value := range entries {
+		if oldValue, ok := old[key]; !ok || oldValue != value {
+			changed[key] = value
+		}
+	}
+	return changed
+}
+
+// containsString reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
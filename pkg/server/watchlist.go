@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// watchInitialEvents tells how a watch starts from the sendInitialEvents parameter of the
+// WatchList protocol, which client-go informers use instead of a list followed by a watch:
+// with sendInitialEvents=true the current objects are sent as ADDED events ended by a
+// bookmark, with false no initial events are sent. Without the parameter the initial events
+// are sent without the bookmark, as before the protocol. Like kube-apiserver, sendInitialEvents
+// requires allowWatchBookmarks=true and resourceVersionMatch=NotOlderThan.
+func watchInitialEvents(r *http.Request) (send, bookmark bool, statusErr *apierrors.StatusError) {
+	query := r.URL.Query()
+	value := query.Get("sendInitialEvents")
+	if value == "" {
+		if match := query.Get("resourceVersionMatch"); match != "" {
+			return false, false, watchOptionsInvalid(field.Forbidden(field.NewPath("resourceVersionMatch"),
+				fmt.Sprintf("resourceVersionMatch is forbidden for watch unless sendInitialEvents is provided, not %q", match)))
+		}
+		return true, false, nil
+	}
+
+	send, parseErr := strconv.ParseBool(value)
+	if parseErr != nil {
+		return false, false, apierrors.NewBadRequest(fmt.Sprintf("invalid sendInitialEvents %q", value))
+	}
+	var errs field.ErrorList
+	if query.Get("allowWatchBookmarks") != "true" {
+		errs = append(errs, field.Forbidden(field.NewPath("allowWatchBookmarks"), "allowWatchBookmarks required when sendInitialEvents is provided"))
+	}
+	if match := metav1.ResourceVersionMatch(query.Get("resourceVersionMatch")); match != metav1.ResourceVersionMatchNotOlderThan {
+		errs = append(errs, field.Forbidden(field.NewPath("resourceVersionMatch"),
+			fmt.Sprintf("sendInitialEvents requires setting resourceVersionMatch to %s", metav1.ResourceVersionMatchNotOlderThan)))
+	}
+	if len(errs) > 0 {
+		return false, false, watchOptionsInvalid(errs...)
+	}
+	return send, send, nil
+}
+
+// watchOptionsInvalid returns the 422 Invalid Status of invalid watch options
+func watchOptionsInvalid(errs ...*field.Error) *apierrors.StatusError {
+	return apierrors.NewInvalid(schema.GroupKind{Group: "meta.k8s.io", Kind: "ListOptions"}, "", errs)
+}
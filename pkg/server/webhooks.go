@@ -0,0 +1,276 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/klog/v2"
+
+	"podman-k8s-adapter/pkg/config"
+)
+
+// defaultWebhookTimeout bounds the calls to webhooks that set no timeout, as in kube-apiserver
+const defaultWebhookTimeout = 10 * time.Second
+
+// maxWebhookResponseSize bounds the AdmissionReview a webhook may answer with
+const maxWebhookResponseSize = 3 << 20
+
+// admissionWebhook is an external admission webhook, sent an admission.k8s.io/v1
+// AdmissionReview for the pods its rules select. Mutating webhooks answer with a JSON patch of
+// the pod, validating ones only allow or deny it.
+type admissionWebhook struct {
+	name           string
+	mutating       bool
+	url            string
+	rules          []admissionregistrationv1.RuleWithOperations
+	ignoreFailures bool // The Ignore failure policy: the request is admitted when the webhook cannot be called
+	client         *http.Client
+}
+
+// newAdmissionWebhook validates the config of a webhook and builds its client
+func newAdmissionWebhook(cfg config.WebhookConfig) (*admissionWebhook, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("webhooks require a name")
+	}
+	webhook := &admissionWebhook{name: cfg.Name, url: cfg.URL, rules: cfg.Rules}
+
+	switch cfg.Type {
+	case "Mutating":
+		webhook.mutating = true
+	case "Validating":
+	default:
+		return nil, fmt.Errorf("webhook %q: type must be Mutating or Validating, not %q", cfg.Name, cfg.Type)
+	}
+
+	switch admissionregistrationv1.FailurePolicyType(cfg.FailurePolicy) {
+	case "", admissionregistrationv1.Fail:
+	case admissionregistrationv1.Ignore:
+		webhook.ignoreFailures = true
+	default:
+		return nil, fmt.Errorf("webhook %q: failurePolicy must be Fail or Ignore, not %q", cfg.Name, cfg.FailurePolicy)
+	}
+
+	target, err := url.Parse(cfg.URL)
+	if err != nil || target.Scheme != "https" || target.Host == "" {
+		return nil, fmt.Errorf("webhook %q: url must be an https:// URL, not %q", cfg.Name, cfg.URL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: failed to read caFile: %v", cfg.Name, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("webhook %q: caFile %s has no PEM certificate", cfg.Name, cfg.CAFile)
+		}
+	}
+
+	timeout := defaultWebhookTimeout
+	if cfg.Timeout != nil && cfg.Timeout.Duration > 0 {
+		timeout = cfg.Timeout.Duration
+	}
+	webhook.client = &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return webhook, nil
+}
+
+// matches reports whether the rules of the webhook select a pod request; webhooks without
+// rules get every pod create and update
+func (wh *admissionWebhook) matches(attrs *admissionAttributes) bool {
+	if len(wh.rules) == 0 {
+		return true
+	}
+	matchesAny := func(values []string, wanted ...string) bool {
+		for _, value := range values {
+			if value == "*" || slices.Contains(wanted, value) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range wh.rules {
+		operations := make([]string, len(rule.Operations))
+		for i, operation := range rule.Operations {
+			operations[i] = string(operation)
+		}
+		if matchesAny(operations, string(attrs.operation)) &&
+			matchesAny(rule.APIGroups, "") &&
+			matchesAny(rule.APIVersions, "v1") &&
+			matchesAny(rule.Resources, "pods", "*/*") &&
+			(rule.Scope == nil || *rule.Scope == admissionregistrationv1.AllScopes || *rule.Scope == admissionregistrationv1.NamespacedScope) {
+			return true
+		}
+	}
+	return false
+}
+
+// review sends a pod to the webhook, applying the patch of mutating webhooks to the pod. A
+// denial is returned as the Status of the webhook; a webhook that cannot be called fails the
+// request, unless its failure policy is Ignore.
+func (wh *admissionWebhook) review(ctx context.Context, attrs *admissionAttributes, pod *corev1.Pod) error {
+	response, err := wh.call(ctx, attrs, pod)
+	if err != nil {
+		if wh.ignoreFailures {
+			klog.Warningf("Ignoring the failure of admission webhook %q for pod %s/%s: %v", wh.name, pod.Namespace, pod.Name, err)
+			return nil
+		}
+		return apierrors.NewInternalError(fmt.Errorf("failed calling webhook %q: %v", wh.name, err))
+	}
+
+	attrs.warnings = append(attrs.warnings, response.Warnings...)
+	if !response.Allowed {
+		return webhookDenial(wh.name, response.Result)
+	}
+
+	if len(response.Patch) == 0 {
+		return nil
+	}
+	if !wh.mutating {
+		return apierrors.NewInternalError(fmt.Errorf("validating webhook %q returned a patch", wh.name))
+	}
+	if response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		return apierrors.NewInternalError(fmt.Errorf("webhook %q returned a patch that is not a JSONPatch", wh.name))
+	}
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	patched, err := applyPatch("application/json-patch+json", original, response.Patch)
+	if err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("failed to apply the patch of webhook %q: %v", wh.name, err))
+	}
+	var mutated corev1.Pod
+	if err := json.Unmarshal(patched, &mutated); err != nil {
+		return apierrors.NewInternalError(fmt.Errorf("the patch of webhook %q makes an invalid pod: %v", wh.name, err))
+	}
+	*pod = mutated
+	return nil
+}
+
+// call posts the AdmissionReview of a pod request to the webhook and returns its response
+func (wh *admissionWebhook) call(ctx context.Context, attrs *admissionAttributes, pod *corev1.Pod) (*admissionv1.AdmissionResponse, error) {
+	object, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	podKind := metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	podResource := metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
+	dryRun := attrs.dryRun
+	request := &admissionv1.AdmissionRequest{
+		UID:             uuid.NewUUID(),
+		Kind:            podKind,
+		Resource:        podResource,
+		RequestKind:     &podKind,
+		RequestResource: &podResource,
+		Name:            pod.Name,
+		Namespace:       pod.Namespace,
+		Operation:       admissionv1.Operation(attrs.operation),
+		UserInfo: authenticationv1.UserInfo{
+			Username: attrs.user.Username,
+			Groups:   attrs.user.Groups,
+		},
+		Object: runtime.RawExtension{Raw: object},
+		DryRun: &dryRun,
+	}
+	if attrs.old != nil {
+		old, err := json.Marshal(attrs.old)
+		if err != nil {
+			return nil, err
+		}
+		request.OldObject = runtime.RawExtension{Raw: old}
+	}
+	body, err := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{Kind: "AdmissionReview", APIVersion: admissionv1.SchemeGroupVersion.String()},
+		Request:  request,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	var review admissionv1.AdmissionReview
+	if err := json.Unmarshal(data, &review); err != nil {
+		return nil, fmt.Errorf("invalid AdmissionReview: %v", err)
+	}
+	if review.Response == nil {
+		return nil, fmt.Errorf("the AdmissionReview has no response")
+	}
+	if review.Response.UID != request.UID {
+		return nil, fmt.Errorf("the AdmissionReview answers request %q, not %q", review.Response.UID, request.UID)
+	}
+	return review.Response, nil
+}
+
+// webhookDenial returns the Status of a request denied by a webhook, as kube-apiserver reports it
+func webhookDenial(name string, result *metav1.Status) *apierrors.StatusError {
+	status := metav1.Status{}
+	if result != nil {
+		status = *result
+	}
+	if status.Code < http.StatusBadRequest {
+		status.Code = http.StatusBadRequest
+	}
+	status.Status = metav1.StatusFailure
+	deniedBy := fmt.Sprintf("admission webhook %q denied the request", name)
+	if status.Message != "" {
+		status.Message = deniedBy + ": " + status.Message
+	} else {
+		status.Message = deniedBy + " without explanation"
+	}
+	return &apierrors.StatusError{ErrStatus: status}
+}
+
+// SetAdmissionWebhooks sets the external admission webhooks called on pod create and update,
+// after the built-in plugins of their kind
+func (s *Server) SetAdmissionWebhooks(configs []config.WebhookConfig) error {
+	webhooks := make([]*admissionWebhook, 0, len(configs))
+	for _, cfg := range configs {
+		webhook, err := newAdmissionWebhook(cfg)
+		if err != nil {
+			return err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	s.admissionWebhooks.Store(&webhooks)
+	return nil
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// AdoptedLabel marks the pods of containers that existed before a pod of the same name was
+// created, such as containers run with podman run, and were adopted by that creation
+const AdoptedLabel = "podkube.io/adopted"
+
+// AdoptionError lists the differences between a created pod and the existing pod of the same
+// name, which prevent the existing one from being adopted
+type AdoptionError struct {
+	Namespace string // Namespace of the existing pod
+	Errs      field.ErrorList
+}
+
+func (e *AdoptionError) Error() string {
+	return fmt.Sprintf("pod already exists in namespace %s with a different spec: %v", e.Namespace, e.Errs.ToAggregate())
+}
+
+// Adopt makes the creation of a pod named after an existing container idempotent: when the
+// pod of that container, in the namespace of the created pod or exited, runs an equivalent
+// spec, it gets the labels, annotations and finalizers of the created pod along with
+// AdoptedLabel, and is returned, as kubectl create or apply would have it. It fails with an
+// AdoptionError when the specs differ, and with a not found error when no pod holds the name.
+func (c *Cluster) Adopt(ctx context.Context, pod *corev1.Pod, dryRun bool) (*corev1.Pod, error) {
+	_, existing, err := c.find(ctx, pod.Namespace, pod.Name)
+	if err != nil && pod.Namespace != exitedNamespace {
+		_, existing, err = c.find(ctx, exitedNamespace, pod.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if errs := adoptionConflicts(existing, pod); len(errs) > 0 {
+		return nil, &AdoptionError{Namespace: existing.Namespace, Errs: errs}
+	}
+
+	adopted := existing.DeepCopy()
+	adopted.Labels = mergeStrings(existing.Labels, pod.Labels)
+	adopted.Labels[AdoptedLabel] = "true"
+	adopted.Annotations = mergeStrings(existing.Annotations, pod.Annotations)
+	adopted.Finalizers = append(adopted.Finalizers, addedFinalizers(existing.Finalizers, pod.Finalizers)...)
+	if !dryRun {
+		klog.Infof("Adopting the existing container of pod %s/%s", existing.Namespace, existing.Name)
+	}
+	return c.update(ctx, adopted, dryRun)
+}
+
+// adoptionConflicts returns the differences between the spec of a created pod and the one of
+// the existing pod it would adopt. The fields the created pod leaves out take the values of
+// the existing pod, whose spec podman fills in: only the containers, their images, commands,
+// arguments, environment variables and host ports it sets are compared.
+func adoptionConflicts(existing, created *corev1.Pod) field.ErrorList {
+	containersPath := field.NewPath("spec", "containers")
+	if existing.DeletionTimestamp != nil {
+		return field.ErrorList{field.Forbidden(field.NewPath("metadata", "name"), "the existing pod is being deleted")}
+	}
+	if len(created.Spec.Containers) != len(existing.Spec.Containers) {
+		return field.ErrorList{field.Invalid(containersPath, len(created.Spec.Containers),
+			fmt.Sprintf("the existing pod has %d containers", len(existing.Spec.Containers)))}
+	}
+
+	var errs field.ErrorList
+	for i := range created.Spec.Containers {
+		container, current := &created.Spec.Containers[i], &existing.Spec.Containers[i]
+		path := containersPath.Index(i)
+		if normalizeImage(container.Image) != normalizeImage(current.Image) {
+			errs = append(errs, field.Invalid(path.Child("image"), container.Image, fmt.Sprintf("the existing container runs %s", current.Image)))
+		}
+		// podman reports the command line of a container as its command, with the arguments
+		command := append(append([]string(nil), container.Command...), container.Args...)
+		currentCommand := append(append([]string(nil), current.Command...), current.Args...)
+		if len(command) > 0 && !equality.Semantic.DeepEqual(command, currentCommand) {
+			errs = append(errs, field.Invalid(path.Child("command"), command, fmt.Sprintf("the existing container runs %q", currentCommand)))
+		}
+		currentEnv := map[string]string{}
+		for _, env := range current.Env {
+			currentEnv[env.Name] = env.Value
+		}
+		for j, env := range container.Env {
+			if value, ok := currentEnv[env.Name]; env.ValueFrom == nil && (!ok || value != env.Value) {
+				errs = append(errs, field.Invalid(path.Child("env").Index(j), env.Name, "the existing container does not set it to the same value"))
+			}
+		}
+		for j, port := range container.Ports {
+			if port.HostPort != 0 && !publishesHostPort(current, port.HostPort) {
+				errs = append(errs, field.Invalid(path.Child("ports").Index(j).Child("hostPort"), port.HostPort, "the existing container does not publish it"))
+			}
+		}
+	}
+	return errs
+}
+
+// publishesHostPort reports whether a container publishes a host port
+func publishesHostPort(container *corev1.Container, hostPort int32) bool {
+	for _, port := range container.Ports {
+		if port.HostPort == hostPort {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeImage returns the fully qualified form of an image reference, as podman reports
+// it: nginx is docker.io/library/nginx:latest
+func normalizeImage(image string) string {
+	name, digest, hasDigest := strings.Cut(image, "@")
+	if domain, _, ok := strings.Cut(name, "/"); !ok || !strings.ContainsAny(domain, ".:") && domain != "localhost" {
+		if !ok {
+			name = "library/" + name
+		}
+		name = "docker.io/" + name
+	}
+	if lastSegment := name[strings.LastIndex(name, "/")+1:]; !hasDigest && !strings.Contains(lastSegment, ":") {
+		name += ":latest"
+	}
+	if hasDigest {
+		return name + "@" + digest
+	}
+	return name
+}
+
+// mergeStrings returns the values of base overridden by those of overrides
+func mergeStrings(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
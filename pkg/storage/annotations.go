@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// internalAnnotationPrefixes match the annotations set by podKube and by the container
+// runtimes themselves, as opposed to the annotations of the pod a user created
+var internalAnnotationPrefixes = []string{
+	"podman.io/",
+	"docker.io/",
+	"podkube.io/",
+	"io.podman.annotations.",
+	"io.container.manager",
+	"org.opencontainers.image.",
+}
+
+// userAnnotationPrefix escapes user annotations whose key looks internal when they are stored
+// on the container, so they are told apart from the internal ones and round-trip unchanged
+const userAnnotationPrefix = "user.podkube.io/"
+
+// isInternalAnnotation reports whether an annotation key is reserved for podKube and the
+// container runtimes
+func isInternalAnnotation(key string) bool {
+	for _, prefix := range internalAnnotationPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// containerAnnotationKey returns the key under which a pod annotation is stored on its container
+func containerAnnotationKey(key string) string {
+	if isInternalAnnotation(key) || strings.HasPrefix(key, userAnnotationPrefix) {
+		return userAnnotationPrefix + key
+	}
+	return key
+}
+
+// translateAnnotations turns the annotations read from a container back into pod annotations:
+// escaped user annotations get their key back and take precedence over internal annotations
+// of the same key, which are dropped altogether when hideInternal is set
+func translateAnnotations(pod *corev1.Pod, hideInternal bool) {
+	if len(pod.Annotations) == 0 {
+		return
+	}
+
+	annotations := make(map[string]string, len(pod.Annotations))
+	for key, value := range pod.Annotations {
+		if isInternalAnnotation(key) && !hideInternal {
+			annotations[key] = value
+		}
+	}
+	for key, value := range pod.Annotations {
+		if userKey, ok := strings.CutPrefix(key, userAnnotationPrefix); ok {
+			annotations[userKey] = value
+		} else if !isInternalAnnotation(key) {
+			annotations[key] = value
+		}
+	}
+	pod.Annotations = annotations
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Supported container runtimes
+const (
+	RuntimePodman = "podman"
+	RuntimeDocker = "docker"
+)
+
+// Backend is a container runtime exposed as pods and secrets. PodStorage implements it on
+// top of the podman CLI and DockerStorage on top of the docker CLI; a node of the cluster
+// can be backed by either.
+type Backend interface {
+	List(ctx context.Context, namespace, labelSelector, fieldSelector string) (*corev1.PodList, error)
+	Get(ctx context.Context, namespace, name string) (*corev1.Pod, error)
+	Create(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error)
+	// DryRunCreate validates a creation like Create and returns the would-be pod, without running a container
+	DryRunCreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error)
+	Update(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error)
+	// Recreate replaces the container of a pod created through podKube with a new one running
+	// the given pod, under the same name
+	Recreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error)
+	Delete(ctx context.Context, namespace, name string) error
+	// Checkpoint checkpoints the container of a pod and returns the exported archive
+	Checkpoint(ctx context.Context, namespace, name string, leaveRunning bool) (io.ReadCloser, error)
+	// Restore creates a pod from a checkpoint archive
+	Restore(ctx context.Context, namespace, name string, checkpoint io.Reader) (*corev1.Pod, error)
+	// Pause freezes the containers of a pod, Unpause resumes them
+	Pause(ctx context.Context, namespace, name string) error
+	Unpause(ctx context.Context, namespace, name string) error
+	// ContainerUsage returns the CPU and memory usage of running containers, by container ID
+	ContainerUsage(ctx context.Context, ids []string) (map[string]ContainerUsage, error)
+
+	ListSecrets(ctx context.Context, namespace string) (*corev1.SecretList, error)
+	GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error)
+	CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error)
+	// DryRunCreateSecret validates a creation like CreateSecret and returns the would-be secret
+	DryRunCreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error)
+	DeleteSecret(ctx context.Context, namespace, name string) error
+
+	// ListImages returns the images of the runtime's image store
+	ListImages(ctx context.Context) ([]Image, error)
+	// PullImage pulls an image into the image store and returns it
+	PullImage(ctx context.Context, reference string) (*Image, error)
+	// RemoveImage removes an image, by ID, from the image store
+	RemoveImage(ctx context.Context, id string) error
+
+	// ListNetworks returns the runtime's networks
+	ListNetworks(ctx context.Context) ([]Network, error)
+	// CreateNetwork creates a network and returns it
+	CreateNetwork(ctx context.Context, network *Network) (*Network, error)
+	// RemoveNetwork removes a network by name
+	RemoveNetwork(ctx context.Context, name string) error
+
+	ListNamespaces() []string
+	ListProjects() *ProjectList
+
+	// Ping checks that the runtime is reachable and returns its version
+	Ping(ctx context.Context) (string, error)
+	// BackendStatus reports whether the runtime's circuit breaker is closed
+	BackendStatus() (bool, error)
+	// RunEventWatcher keeps the container cache in sync with runtime events until ctx is cancelled
+	RunEventWatcher(ctx context.Context)
+	// Changes returns a channel closed at the next change of the containers, as runtime events
+	// and the writes through the backend report them
+	Changes() <-chan struct{}
+
+	// Runtime returns the runtime name, used as the container ID scheme (podman://, docker://)
+	Runtime() string
+	// CommandLine returns the full command line running the runtime CLI with args against
+	// this backend's connection, for exec and logs
+	CommandLine(args ...string) []string
+
+	SetConnection(connection, identity string) error
+	SetNodeName(name string)
+	SetCacheTTL(ttl time.Duration)
+	SetCommandTimeout(timeout time.Duration)
+	SetCircuitBreaker(threshold int, cooldown time.Duration)
+	SetParallelism(parallelism int)
+	SetServiceAccountTokens(tokens ServiceAccountTokens)
+}
+
+var (
+	_ Backend = &PodStorage{}
+	_ Backend = &DockerStorage{}
+)
+
+// NewBackend creates the storage backend for the given runtime
+func NewBackend(runtime string) (Backend, error) {
+	switch runtime {
+	case RuntimePodman, "":
+		return NewPodStorage(), nil
+	case RuntimeDocker:
+		return NewDockerStorage(), nil
+	default:
+		return nil, fmt.Errorf("unsupported container runtime %q (supported: %s, %s)", runtime, RuntimePodman, RuntimeDocker)
+	}
+}
+
+// dryRunPod returns the pod as it would be created on the named node, for dry-run requests
+func dryRunPod(pod *corev1.Pod, nodeName string) *corev1.Pod {
+	wouldBe := pod.DeepCopy()
+	wouldBe.TypeMeta = metav1.TypeMeta{
+		Kind:       "Pod",
+		APIVersion: "v1",
+	}
+	wouldBe.CreationTimestamp = metav1.Now()
+	setPodDefaults(&wouldBe.Spec)
+	wouldBe.Status = corev1.PodStatus{
+		Phase:    corev1.PodPending,
+		QOSClass: podQOSClass(&wouldBe.Spec),
+	}
+	if nodeName != "" {
+		wouldBe.Spec.NodeName = nodeName
+		wouldBe.Status.NominatedNodeName = nodeName
+	}
+	return wouldBe
+}
+
+// recreatableContainer returns the container of a pod that Recreate can replace: the single
+// standalone container of a pod created through podKube
+func recreatableContainer(containers []PodmanContainer, pod *corev1.Pod, namespace string) (*PodmanContainer, error) {
+	if pod.Namespace != namespace {
+		return nil, fmt.Errorf("pods can only be recreated in namespace %s", namespace)
+	}
+	members := podContainers(containers, pod.Namespace, pod.Name, namespace)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("pod %s/%s not found", pod.Namespace, pod.Name)
+	}
+	if _, ok := containerIdentity(members[0]); ok || len(members) > 1 {
+		return nil, fmt.Errorf("pod %s/%s was not created through podKube and cannot be recreated", pod.Namespace, pod.Name)
+	}
+	return members[0], nil
+}
+
+// uidFromID derives a stable UID from a runtime object ID, so a pod or secret keeps its UID
+// across restarts of the adapter and gets a new one when it is recreated. kind keeps the
+// UIDs of different object kinds apart.
+func uidFromID(kind, id string) types.UID {
+	sum := sha256.Sum256([]byte(kind + "/" + id))
+	return types.UID(fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16]))
+}
+
+// secretResourceVersion uses the secret ID prefix as resourceVersion, like pods do with
+// the container ID: secrets are replaced rather than modified
+func secretResourceVersion(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultFailureThreshold is the number of consecutive podman failures that trips the breaker
+	defaultFailureThreshold = 5
+	// defaultBreakerCooldown is how long the breaker stays open before probing podman again
+	defaultBreakerCooldown = 30 * time.Second
+
+	// DegradedAnnotation is set on objects served from the cache while podman is unavailable
+	DegradedAnnotation = "podman.io/degraded"
+)
+
+// ErrPodmanUnavailable is returned when the circuit breaker is open and no cached data can be served
+var ErrPodmanUnavailable = errors.New("podman is unavailable")
+
+// circuitBreaker stops sending requests to podman after repeated failures
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	lastError error
+}
+
+// newCircuitBreaker creates a closed breaker with the default threshold and cooldown
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{
+		threshold: defaultFailureThreshold,
+		cooldown:  defaultBreakerCooldown,
+	}
+}
+
+// allow reports whether a podman call may be attempted. Once the cooldown of an
+// open breaker has expired a single probe call is let through (half-open state).
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if time.Now().After(b.openUntil) {
+		// Let this caller probe podman; everyone else waits for another cooldown
+		b.openUntil = time.Now().Add(b.cooldown)
+		return true
+	}
+	return false
+}
+
+// isOpen reports whether the breaker is currently rejecting podman calls
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold
+}
+
+// recordSuccess closes the breaker
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold > 0 && b.failures >= b.threshold {
+		klog.Infof("Podman is reachable again, closing circuit breaker")
+	}
+	b.failures = 0
+	b.lastError = nil
+}
+
+// recordFailure counts a failed podman call and opens the breaker once the threshold is reached
+func (b *circuitBreaker) recordFailure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = err
+	if b.threshold > 0 && b.failures == b.threshold {
+		klog.Errorf("Podman failed %d times in a row, opening circuit breaker for %v: %v", b.failures, b.cooldown, err)
+	}
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// unavailableError builds the error returned while the breaker is open
+func (b *circuitBreaker) unavailableError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lastError != nil {
+		return fmt.Errorf("%w: %v", ErrPodmanUnavailable, b.lastError)
+	}
+	return ErrPodmanUnavailable
+}
+
+// SetCircuitBreaker configures how many consecutive podman failures open the breaker
+// and how long it stays open before probing again (threshold 0 disables the breaker)
+func (ps *PodStorage) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	ps.breaker.mu.Lock()
+	defer ps.breaker.mu.Unlock()
+	ps.breaker.threshold = threshold
+	ps.breaker.cooldown = cooldown
+}
+
+// BackendStatus reports whether podman is considered healthy, with the last error otherwise
+func (ps *PodStorage) BackendStatus() (bool, error) {
+	if ps.breaker.isOpen() {
+		return false, ps.breaker.unavailableError()
+	}
+	return true, nil
+}
+
+// checkBackend fails fast when the breaker is open, for calls that cannot be served from the cache
+func (ps *PodStorage) checkBackend() error {
+	if !ps.breaker.allow() {
+		return ps.breaker.unavailableError()
+	}
+	return nil
+}
+
+// degradedContainers returns the last known containers, marked as stale, while podman is unavailable
+func (ps *PodStorage) degradedContainers() ([]PodmanContainer, error) {
+	return degradedContainers(ps.cache, ps.breaker, RuntimePodman)
+}
+
+// degradedContainers returns the containers of cache, marked as stale, while the runtime is unavailable
+func degradedContainers(cache *containerCache, breaker *circuitBreaker, runtime string) ([]PodmanContainer, error) {
+	containers, fetchedAt, ok := cache.getStale()
+	if !ok {
+		return nil, breaker.unavailableError()
+	}
+
+	message := fmt.Sprintf("%s is unavailable, serving data cached at %s", runtime, fetchedAt.UTC().Format(time.RFC3339))
+	for i := range containers {
+		annotations := make(map[string]string, len(containers[i].Annotations)+1)
+		for key, value := range containers[i].Annotations {
+			annotations[key] = value
+		}
+		annotations[DegradedAnnotation] = message
+		containers[i].Annotations = annotations
+	}
+
+	return containers, nil
+}
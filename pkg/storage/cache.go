@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultCacheTTL bounds staleness when podman events are not available
+	defaultCacheTTL = 2 * time.Second
+	// eventDrivenCacheTTL is used while the podman events stream is connected,
+	// since every container change invalidates the cache anyway
+	eventDrivenCacheTTL = 30 * time.Second
+	// eventWatcherRetryInterval is the delay before reconnecting to podman events
+	eventWatcherRetryInterval = 5 * time.Second
+)
+
+// PodmanEvent represents a single event from podman events --format json
+type PodmanEvent struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Status string `json:"Status"`
+	Type   string `json:"Type"`
+	Time   string `json:"time"`
+}
+
+// containerCache keeps the last podman ps result in memory
+type containerCache struct {
+	mu           sync.Mutex
+	containers   []PodmanContainer
+	fetchedAt    time.Time
+	generation   uint64
+	valid        bool
+	ttl          time.Duration
+	eventsActive bool
+
+	// fetchMu serializes refreshes so concurrent requests share one podman call
+	fetchMu sync.Mutex
+	// changes wakes up the watches of pods on every invalidation
+	changes changeBroadcast
+}
+
+// changeBroadcast wakes up every goroutine waiting for the next change at once, by closing
+// the channel they wait on
+type changeBroadcast struct {
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// wait returns a channel closed at the next change; it must be called before reading the
+// state the change is awaited for, so that no change is missed
+func (b *changeBroadcast) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.changed == nil {
+		b.changed = make(chan struct{})
+	}
+	return b.changed
+}
+
+// notify wakes up the goroutines waiting for a change
+func (b *changeBroadcast) notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.changed != nil {
+		close(b.changed)
+		b.changed = nil
+	}
+}
+
+// newContainerCache creates an empty cache with the default TTL
+func newContainerCache() *containerCache {
+	return &containerCache{
+		ttl: defaultCacheTTL,
+	}
+}
+
+// get returns a copy of the cached containers if they are still fresh
+func (c *containerCache) get() ([]PodmanContainer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.valid {
+		return nil, false
+	}
+
+	ttl := c.ttl
+	if ttl > 0 && c.eventsActive && eventDrivenCacheTTL > ttl {
+		ttl = eventDrivenCacheTTL
+	}
+	if ttl <= 0 || time.Since(c.fetchedAt) > ttl {
+		return nil, false
+	}
+
+	containers := make([]PodmanContainer, len(c.containers))
+	copy(containers, c.containers)
+	return containers, true
+}
+
+// getStale returns a copy of the last fetched containers regardless of freshness
+func (c *containerCache) getStale() ([]PodmanContainer, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fetchedAt.IsZero() {
+		return nil, time.Time{}, false
+	}
+
+	containers := make([]PodmanContainer, len(c.containers))
+	copy(containers, c.containers)
+	return containers, c.fetchedAt, true
+}
+
+// currentGeneration returns the invalidation counter, to be passed back to store
+func (c *containerCache) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// store saves a fresh podman ps result, unless the cache was invalidated while it was being fetched
+func (c *containerCache) store(containers []PodmanContainer, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.containers = make([]PodmanContainer, len(containers))
+	copy(c.containers, containers)
+	c.fetchedAt = time.Now()
+	c.valid = true
+}
+
+// invalidate drops the cached containers so the next read goes to podman, and wakes up the
+// watches to read them
+func (c *containerCache) invalidate() {
+	c.mu.Lock()
+	c.generation++
+	c.valid = false
+	c.mu.Unlock()
+
+	c.changes.notify()
+}
+
+// setEventsActive records whether the podman events stream is keeping the cache up to date
+func (c *containerCache) setEventsActive(active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.eventsActive = active
+	if !active {
+		c.generation++
+		c.valid = false
+	}
+}
+
+// Changes returns a channel closed at the next change of the containers, as podman events
+// and the writes through this storage report them
+func (ps *PodStorage) Changes() <-chan struct{} {
+	return ps.cache.changes.wait()
+}
+
+// SetCacheTTL sets how long a podman ps result is served from memory (0 disables caching)
+func (ps *PodStorage) SetCacheTTL(ttl time.Duration) {
+	ps.cache.mu.Lock()
+	defer ps.cache.mu.Unlock()
+	ps.cache.ttl = ttl
+	if ttl <= 0 {
+		ps.cache.valid = false
+	}
+}
+
+// InvalidateCache forces the next read to query podman
+func (ps *PodStorage) InvalidateCache() {
+	ps.cache.invalidate()
+}
+
+// RunEventWatcher follows podman events and invalidates the container cache on every
+// container event. It reconnects when the stream ends and returns when ctx is cancelled.
+func (ps *PodStorage) RunEventWatcher(ctx context.Context) {
+	for {
+		if err := ps.watchPodmanEvents(ctx); err != nil {
+			klog.Warningf("Podman events stream failed, falling back to TTL-based cache expiry: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventWatcherRetryInterval):
+		}
+	}
+}
+
+// watchPodmanEvents runs a single podman events session until it ends or ctx is cancelled
+func (ps *PodStorage) watchPodmanEvents(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, "podman", ps.PodmanArgs("events", "--format", "json", "--filter", "type=container")...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	klog.Infof("Watching podman events to keep the container cache up to date")
+	ps.cache.setEventsActive(true)
+	defer ps.cache.setEventsActive(false)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var event PodmanEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			klog.V(4).Infof("Ignoring unparsable podman event %q: %v", scanner.Text(), err)
+			continue
+		}
+		klog.V(4).Infof("Podman event: %s %s (%s)", event.Status, event.Name, event.ID)
+		ps.cache.invalidate()
+	}
+
+	return cmd.Wait()
+}
+
+// podSpecCache keeps the output of podman kube generate per container. A container's
+// configuration is immutable, so a spec only needs regenerating when the container is recreated.
+type podSpecCache struct {
+	mu    sync.Mutex
+	specs map[string]podSpecCacheEntry // keyed by container ID
+}
+
+type podSpecCacheEntry struct {
+	digest string
+	spec   *corev1.PodSpec
+}
+
+// newPodSpecCache creates an empty pod spec cache
+func newPodSpecCache() *podSpecCache {
+	return &podSpecCache{
+		specs: make(map[string]podSpecCacheEntry),
+	}
+}
+
+// containerConfigDigest identifies a container's configuration; it changes when the
+// container is recreated under the same ID or name
+func containerConfigDigest(container *PodmanContainer) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s|%v", container.Id, container.Created, container.ImageID, container.Image, container.Command)))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a copy of the cached spec for container, if its configuration is unchanged
+func (c *podSpecCache) get(container *PodmanContainer) (*corev1.PodSpec, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.specs[container.Id]
+	if !ok || entry.digest != containerConfigDigest(container) {
+		return nil, false
+	}
+	return entry.spec.DeepCopy(), true
+}
+
+// store saves the generated spec for container
+func (c *podSpecCache) store(container *PodmanContainer, spec *corev1.PodSpec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.specs[container.Id] = podSpecCacheEntry{
+		digest: containerConfigDigest(container),
+		spec:   spec.DeepCopy(),
+	}
+}
+
+// prune drops the specs of containers that no longer exist
+func (c *podSpecCache) prune(containers []PodmanContainer) {
+	existing := make(map[string]bool, len(containers))
+	for i := range containers {
+		existing[containers[i].Id] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id := range c.specs {
+		if !existing[id] {
+			delete(c.specs, id)
+		}
+	}
+}
+
+// imageDigestCache holds the repository digests of images by image ID, so that the image IDs
+// of container statuses can name the digests; image IDs never change, so entries are kept
+type imageDigestCache struct {
+	mu      sync.Mutex
+	digests map[string][]string // keyed by image ID, nil for images without digests
+}
+
+// newImageDigestCache creates an empty image digest cache
+func newImageDigestCache() *imageDigestCache {
+	return &imageDigestCache{
+		digests: make(map[string][]string),
+	}
+}
+
+// resolve sets the image IDs of the container statuses of pods to the repository digests
+// of their images, inspecting the images it has not seen yet
+func (c *imageDigestCache) resolve(ctx context.Context, command commandFunc, pods []*corev1.Pod) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unknown []string
+	seen := map[string]bool{}
+	for _, pod := range pods {
+		for _, status := range pod.Status.ContainerStatuses {
+			id := status.ImageID
+			if _, ok := c.digests[id]; !ok && id != "" && !seen[id] {
+				seen[id] = true
+				unknown = append(unknown, id)
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		images, err := inspectImages(ctx, command, unknown...)
+		if err != nil {
+			// A removed image fails the whole inspection, look them up one by one
+			klog.V(4).Infof("Inspecting images one by one: %v", err)
+			images = nil
+			for _, id := range unknown {
+				if inspected, err := inspectImages(ctx, command, id); err == nil {
+					images = append(images, inspected...)
+				}
+			}
+		}
+		byID := make(map[string][]string, len(images))
+		for _, image := range images {
+			byID[image.Status.ID] = image.Status.RepoDigests
+		}
+		for _, id := range unknown {
+			if digests, ok := byID[strings.TrimPrefix(id, "sha256:")]; ok || ctx.Err() == nil {
+				c.digests[id] = digests
+			}
+		}
+	}
+
+	for _, pod := range pods {
+		for i := range pod.Status.ContainerStatuses {
+			status := &pod.Status.ContainerStatuses[i]
+			status.ImageID = imageReference(status.Image, status.ImageID, c.digests[status.ImageID])
+		}
+	}
+}
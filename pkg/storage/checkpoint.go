@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ErrCheckpointUnsupported is returned when checkpointing or restoring pods on a runtime
+// that cannot export checkpoints
+var ErrCheckpointUnsupported = errors.New("checkpoint and restore are only supported by the podman runtime")
+
+// checkpointArchive is an exported checkpoint in a temporary file, removed once closed
+type checkpointArchive struct {
+	*os.File
+}
+
+func (a *checkpointArchive) Close() error {
+	err := a.File.Close()
+	os.Remove(a.Name())
+	return err
+}
+
+// newCheckpointArchive creates an empty temporary file for a checkpoint archive
+func newCheckpointArchive() (*checkpointArchive, error) {
+	file, err := os.CreateTemp("", "podkube-checkpoint-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint archive: %v", err)
+	}
+	return &checkpointArchive{File: file}, nil
+}
+
+// Checkpoint checkpoints the container of a pod with podman container checkpoint and returns
+// the exported archive, to be closed by the caller. The container is stopped unless
+// leaveRunning is set.
+func (ps *PodStorage) Checkpoint(ctx context.Context, namespace, name string, leaveRunning bool) (io.ReadCloser, error) {
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+
+	containers, err := ps.getPodmanContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	members := podContainers(containers, namespace, name, ps.namespace)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+	if len(members) > 1 {
+		return nil, fmt.Errorf("pod %s/%s has %d containers, only single-container pods can be checkpointed", namespace, name, len(members))
+	}
+
+	archive, err := newCheckpointArchive()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"container", "checkpoint", "--export", archive.Name()}
+	if leaveRunning {
+		args = append(args, "--leave-running")
+	}
+	args = append(args, members[0].Id)
+
+	cmd, cancel := ps.podmanCommand(ctx, args...)
+	defer cancel()
+	defer ps.cache.invalidate()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("failed to checkpoint pod %s/%s: %v: %s", namespace, name, err, strings.TrimSpace(string(output)))
+	}
+
+	klog.Infof("Checkpointed pod %s/%s", namespace, name)
+	return archive, nil
+}
+
+// Restore restores a pod from a checkpoint archive with podman container restore, under the
+// given name
+func (ps *PodStorage) Restore(ctx context.Context, namespace, name string, checkpoint io.Reader) (*corev1.Pod, error) {
+	if namespace != ps.namespace {
+		return nil, fmt.Errorf("pods can only be restored in namespace %s", ps.namespace)
+	}
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+
+	if existing, err := ps.getPodmanContainer(ctx, name); err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists", namespace, name)
+	}
+
+	// podman reads the archive from a file, on the client side for remote connections
+	archive, err := newCheckpointArchive()
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	if _, err := io.Copy(archive, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to receive checkpoint archive: %v", err)
+	}
+
+	cmd, cancel := ps.podmanCommand(ctx, "container", "restore", "--import", archive.Name(), "--name", name)
+	defer cancel()
+	output, err := cmd.CombinedOutput()
+	ps.cache.invalidate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore pod %s/%s: %v: %s", namespace, name, err, strings.TrimSpace(string(output)))
+	}
+	klog.Infof("Restored pod %s/%s", namespace, name)
+
+	restored, err := ps.getPodmanContainer(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get restored container: %v", err)
+	}
+	return ps.podmanContainerToPod(ctx, restored), nil
+}
+
+// Checkpoint always fails: docker checkpoints are experimental and cannot be exported
+func (ds *DockerStorage) Checkpoint(ctx context.Context, namespace, name string, leaveRunning bool) (io.ReadCloser, error) {
+	return nil, ErrCheckpointUnsupported
+}
+
+// Restore always fails: docker checkpoints are experimental and cannot be imported
+func (ds *DockerStorage) Restore(ctx context.Context, namespace, name string, checkpoint io.Reader) (*corev1.Pod, error) {
+	return nil, ErrCheckpointUnsupported
+}
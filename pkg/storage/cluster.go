@@ -0,0 +1,1158 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/klog/v2"
+)
+
+// RootfulConnection is the system podman service socket, used to reach rootful podman
+// from a rootless adapter
+const RootfulConnection = "unix:///run/podman/podman.sock"
+
+// RootlessLabel tells whether a node's podman runs rootless ("true") or rootful ("false")
+const RootlessLabel = "podman.io/rootless"
+
+// ErrUnschedulable is returned when no node can run a pod being created
+var ErrUnschedulable = errors.New("pod cannot be scheduled")
+
+// ErrInvalidUpdate is returned when a pod update is not allowed
+var ErrInvalidUpdate = errors.New("invalid pod update")
+
+// ErrConflict is returned when an update is based on an older version of the object, as told
+// by its resourceVersion, than the current one
+var ErrConflict = errors.New("the object has been modified; please apply your changes to the latest version and try again")
+
+// Node is a container runtime backend exposed as a Kubernetes Node
+type Node struct {
+	Name       string
+	Connection string            // Runtime connection URL or name, empty for the local runtime
+	Labels     map[string]string // Extra labels, matched against pod nodeSelectors
+	Storage    Backend
+	created    time.Time
+}
+
+// NewNode creates a node backed by its own storage for the given runtime (podman or docker),
+// talking to the service selected by connection (see SetConnection; empty means local)
+func NewNode(name, runtime, connection, identity string, nodeLabels map[string]string) (*Node, error) {
+	backend, err := NewBackend(runtime)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.SetConnection(connection, identity); err != nil {
+		return nil, err
+	}
+	backend.SetNodeName(name)
+
+	return &Node{
+		Name:       name,
+		Connection: connection,
+		Labels:     nodeLabels,
+		Storage:    backend,
+		created:    time.Now(),
+	}, nil
+}
+
+// DefaultNodeName names the local node after the machine
+func DefaultNodeName() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return strings.ToLower(hostname)
+	}
+	return "localhost"
+}
+
+// labels returns the well-known node labels merged with the configured ones
+func (n *Node) labels() map[string]string {
+	nodeLabels := map[string]string{
+		"kubernetes.io/hostname": n.Name,
+		"kubernetes.io/os":       "linux",
+	}
+	if n.Connection == "" {
+		nodeLabels["kubernetes.io/arch"] = runtime.GOARCH
+	}
+	for key, value := range n.Labels {
+		nodeLabels[key] = value
+	}
+	return nodeLabels
+}
+
+// Cluster spreads pods over one or more runtime nodes: lists and watches are aggregated,
+// and created pods are scheduled on a node by nodeName, nodeSelector or round-robin
+type Cluster struct {
+	nodes       []*Node
+	next        uint32 // Round-robin scheduling cursor
+	defaultNode string // Node for pods without nodeName or nodeSelector, round-robin when empty
+	metadata    *metadataStore
+	gc          garbageCollector
+	leases      nodeLeases
+	namespaces  namespaceState
+	podLocks    podLocks
+
+	// hideInternalAnnotations drops the podman.io/* and other runtime annotations from pods
+	hideInternalAnnotations atomic.Bool
+	// allowRecreate lets updates recreate containers to change their image or env
+	allowRecreate atomic.Bool
+	// allowSystemdDelete lets deletions remove the containers of systemd units
+	allowSystemdDelete atomic.Bool
+	// podUsageAnnotations annotates the pods read one at a time with their CPU and memory usage
+	podUsageAnnotations atomic.Bool
+	// kubernetesServicePort is the API server port of the kubernetes service of created pods,
+	// which get none when 0
+	kubernetesServicePort atomic.Int32
+}
+
+// NewCluster creates a cluster from the given nodes, in scheduling order
+func NewCluster(nodes ...*Node) *Cluster {
+	return &Cluster{
+		nodes:    nodes,
+		metadata: newMetadataStore(),
+	}
+}
+
+// SetDefaultNode makes pods that specify neither nodeName nor nodeSelector go to the named
+// node while it is reachable, instead of being spread round-robin
+func (c *Cluster) SetDefaultNode(name string) error {
+	if name != "" {
+		if _, ok := c.Node(name); !ok {
+			return fmt.Errorf("default node %q does not exist", name)
+		}
+	}
+	c.defaultNode = name
+	return nil
+}
+
+// Nodes returns the nodes of the cluster
+func (c *Cluster) Nodes() []*Node {
+	return c.nodes
+}
+
+// Node returns the node with the given name
+func (c *Cluster) Node(name string) (*Node, bool) {
+	for _, node := range c.nodes {
+		if node.Name == name {
+			return node, true
+		}
+	}
+	return nil, false
+}
+
+// forEachNode runs fn concurrently on every node and waits for all of them
+func (c *Cluster) forEachNode(fn func(node *Node)) {
+	var wg sync.WaitGroup
+	for _, node := range c.nodes {
+		wg.Add(1)
+		go func(node *Node) {
+			defer wg.Done()
+			fn(node)
+		}(node)
+	}
+	wg.Wait()
+}
+
+// SetHideInternalAnnotations sets whether the annotations set by podKube and the container
+// runtimes are left out of the pods, which then only carry the annotations they were created with
+func (c *Cluster) SetHideInternalAnnotations(hide bool) {
+	c.hideInternalAnnotations.Store(hide)
+}
+
+// present turns a pod read from a node into the pod served by the API: annotations are
+// translated back to the pod's own, and the metadata kept by the cluster is applied
+func (c *Cluster) present(pod *corev1.Pod) {
+	if pod == nil {
+		return
+	}
+	translateAnnotations(pod, c.hideInternalAnnotations.Load())
+	c.metadata.decorate(pod)
+}
+
+// SetCacheTTL sets the container cache TTL of every node
+func (c *Cluster) SetCacheTTL(ttl time.Duration) {
+	for _, node := range c.nodes {
+		node.Storage.SetCacheTTL(ttl)
+	}
+}
+
+// SetCommandTimeout sets the podman command timeout of every node
+func (c *Cluster) SetCommandTimeout(timeout time.Duration) {
+	for _, node := range c.nodes {
+		node.Storage.SetCommandTimeout(timeout)
+	}
+}
+
+// SetCircuitBreaker configures the circuit breaker of every node
+func (c *Cluster) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	for _, node := range c.nodes {
+		node.Storage.SetCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// SetParallelism sets the per-node podman call parallelism
+func (c *Cluster) SetParallelism(parallelism int) {
+	for _, node := range c.nodes {
+		node.Storage.SetParallelism(parallelism)
+	}
+}
+
+// SetServiceAccountTokens sets the issuer of the service account tokens of the projected
+// volumes of every node
+func (c *Cluster) SetServiceAccountTokens(tokens ServiceAccountTokens) {
+	for _, node := range c.nodes {
+		node.Storage.SetServiceAccountTokens(tokens)
+	}
+}
+
+// RunEventWatcher follows podman events on every node until ctx is cancelled
+func (c *Cluster) RunEventWatcher(ctx context.Context) {
+	c.forEachNode(func(node *Node) {
+		node.Storage.RunEventWatcher(ctx)
+	})
+}
+
+// Changed returns a channel closed at the next change of the pods of any node or of their
+// stored metadata, for watches to list the pods again right away instead of at their next
+// poll. It must be called before listing the pods the change is awaited for; the channel is
+// never closed if ctx is cancelled first.
+func (c *Cluster) Changed(ctx context.Context) <-chan struct{} {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.metadata.changes.wait())},
+	}
+	for _, node := range c.nodes {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(node.Storage.Changes())})
+	}
+
+	changed := make(chan struct{})
+	go func() {
+		if chosen, _, _ := reflect.Select(cases); chosen > 0 {
+			close(changed)
+		}
+	}()
+	return changed
+}
+
+// List returns the pods of all nodes. Nodes that cannot be reached are skipped with a
+// warning, unless none can be reached.
+func (c *Cluster) List(ctx context.Context, namespace, labelSelector, fieldSelector string) (*corev1.PodList, error) {
+	var mu sync.Mutex
+	var items []corev1.Pod
+	var errs []error
+
+	c.forEachNode(func(node *Node) {
+		// Labels may have been changed by updates, the label selector is applied once presented
+		podList, err := node.Storage.List(ctx, namespace, "", fieldSelector)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %s: %w", node.Name, err))
+			return
+		}
+		items = append(items, podList.Items...)
+	})
+
+	for i := range items {
+		c.present(&items[i])
+	}
+	if len(errs) == 0 && namespace == "" && fieldSelector == "" {
+		c.metadata.prune(items)
+	}
+	sortByNamespacedName(items)
+	resourceVersion := listResourceVersion(items)
+	if labelSelector != "" {
+		selected := items[:0]
+		for i := range items {
+			if matchesLabelSelector(&items[i], labelSelector) {
+				selected = append(selected, items[i])
+			}
+		}
+		items = selected
+	}
+
+	if len(errs) == len(c.nodes) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		klog.Warningf("Listing pods without an unreachable node: %v", err)
+	}
+
+	return &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodList",
+			APIVersion: "v1",
+		},
+		ListMeta: metav1.ListMeta{ResourceVersion: resourceVersion},
+		Items:    items,
+	}, nil
+}
+
+// sortByNamespacedName sorts the items of a list by namespace and name, so lists keep the
+// same order across nodes and whatever the order of the output of podman
+func sortByNamespacedName[T any, PT interface {
+	*T
+	metav1.Object
+}](items []T) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := PT(&items[i]), PT(&items[j])
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+}
+
+// listResourceVersion derives the resourceVersion of a list from the names and
+// resourceVersions of its sorted items. Podman has no revision of its whole state, so listing
+// the same objects again gives the same resourceVersion, and any change of an item a new one.
+func listResourceVersion[T any, PT interface {
+	*T
+	metav1.Object
+}](items []T) string {
+	hash := fnv.New64a()
+	for i := range items {
+		item := PT(&items[i])
+		fmt.Fprintf(hash, "%s/%s/%s\n", item.GetNamespace(), item.GetName(), item.GetResourceVersion())
+	}
+	return strconv.FormatUint(hash.Sum64(), 10)
+}
+
+// find returns the node running the named pod, along with the pod
+func (c *Cluster) find(ctx context.Context, namespace, name string) (*Node, *corev1.Pod, error) {
+	node, pod, err := c.locate(ctx, namespace, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.present(pod)
+	return node, pod, nil
+}
+
+// locate returns the node running the named pod, along with the pod as the node reads it
+func (c *Cluster) locate(ctx context.Context, namespace, name string) (*Node, *corev1.Pod, error) {
+	var unavailable error
+	for _, node := range c.nodes {
+		pod, err := node.Storage.Get(ctx, namespace, name)
+		if err == nil {
+			return node, pod, nil
+		}
+		if errors.Is(err, ErrPodmanUnavailable) {
+			unavailable = err
+		}
+	}
+
+	// The pod may be on a node that cannot be reached
+	if unavailable != nil {
+		return nil, nil, unavailable
+	}
+	return nil, nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+}
+
+// Get returns a specific pod from whichever node runs it
+func (c *Cluster) Get(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	node, pod, err := c.find(ctx, namespace, name)
+	if err == nil && c.podUsageAnnotations.Load() {
+		annotateUsage(ctx, node.Storage, pod)
+	}
+	return pod, err
+}
+
+// Create schedules the pod on a node and creates it there
+func (c *Cluster) Create(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	// Pod names are unique across the cluster, not only per node
+	if existing, _, err := c.find(ctx, pod.Namespace, pod.Name); err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists on node %s", pod.Namespace, pod.Name, existing.Name)
+	}
+
+	node, err := c.schedule(pod, false)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Scheduling pod %s/%s on node %s", pod.Namespace, pod.Name, node.Name)
+
+	// Pods get their UID from their container, only a recreated pod keeps its own
+	if pod.UID != "" {
+		pod = pod.DeepCopy()
+		pod.UID = ""
+	}
+	created, err := node.Storage.Create(ctx, c.withKubernetesService(pod))
+	if err != nil {
+		return nil, err
+	}
+	c.present(created)
+	return created, nil
+}
+
+// DryRunCreate validates a pod creation like Create, including scheduling, and returns the
+// pod as it would be created on its node
+func (c *Cluster) DryRunCreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if existing, _, err := c.find(ctx, pod.Namespace, pod.Name); err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists on node %s", pod.Namespace, pod.Name, existing.Name)
+	}
+
+	node, err := c.schedule(pod, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return node.Storage.DryRunCreate(ctx, c.withKubernetesService(pod))
+}
+
+// schedule picks the node a new pod runs on: spec.nodeName if set, then the default node
+// for pods without a nodeSelector, otherwise the next reachable node (round-robin) whose
+// labels match spec.nodeSelector. A dry run does not advance the round-robin cursor.
+func (c *Cluster) schedule(pod *corev1.Pod, dryRun bool) (*Node, error) {
+	if pod.Spec.NodeName != "" {
+		node, ok := c.Node(pod.Spec.NodeName)
+		if !ok {
+			return nil, fmt.Errorf("%w: node %q does not exist", ErrUnschedulable, pod.Spec.NodeName)
+		}
+		return node, nil
+	}
+
+	if c.defaultNode != "" && len(pod.Spec.NodeSelector) == 0 {
+		node, _ := c.Node(c.defaultNode)
+		if healthy, _ := node.Storage.BackendStatus(); healthy {
+			return node, nil
+		}
+		klog.Warningf("Default node %s is unavailable, scheduling pod %s/%s on another node", node.Name, pod.Namespace, pod.Name)
+	}
+
+	selector := labels.SelectorFromSet(pod.Spec.NodeSelector)
+	var candidates []*Node
+	for _, node := range c.nodes {
+		if !selector.Matches(labels.Set(node.labels())) {
+			continue
+		}
+		if healthy, _ := node.Storage.BackendStatus(); !healthy {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no reachable node matches node selector %q", ErrUnschedulable, selector.String())
+	}
+
+	index := atomic.LoadUint32(&c.next)
+	if !dryRun {
+		index = atomic.AddUint32(&c.next, 1) - 1
+	}
+	return candidates[int(index)%len(candidates)], nil
+}
+
+// SetAllowRecreateOnUpdate sets whether updates changing the image or env of containers
+// recreate the pod's container; such updates are rejected otherwise
+func (c *Cluster) SetAllowRecreateOnUpdate(allow bool) {
+	c.allowRecreate.Store(allow)
+}
+
+// SetAllowSystemdDelete sets whether deleting a pod whose container is managed by a systemd
+// unit removes it, as forced deletions do, and whether the garbage collector removes such pods
+// once exited; such deletions are rejected and such pods kept otherwise
+func (c *Cluster) SetAllowSystemdDelete(allow bool) {
+	c.allowSystemdDelete.Store(allow)
+}
+
+// SetPodUsageAnnotations sets whether the pods read one at a time are annotated with the CPU
+// and memory usage of their running containers, sampled with podman stats
+func (c *Cluster) SetPodUsageAnnotations(enabled bool) {
+	c.podUsageAnnotations.Store(enabled)
+}
+
+// Update updates a pod on the node running it. Labels, annotations and finalizers are kept
+// by the cluster, and removing the last finalizer of a pod pending deletion removes it.
+// Changing the image or env of containers recreates the pod's container, when allowed.
+// Updates changing anything else fail with an InvalidUpdateError, and those of a pod whose
+// resourceVersion is set but no longer the current one with ErrConflict.
+func (c *Cluster) Update(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	return c.update(ctx, pod, false)
+}
+
+// DryRunUpdate validates a pod update like Update and returns the pod as it would be updated
+func (c *Cluster) DryRunUpdate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	return c.update(ctx, pod, true)
+}
+
+func (c *Cluster) update(ctx context.Context, pod *corev1.Pod, dryRun bool) (*corev1.Pod, error) {
+	unlock := c.podLocks.lock(pod.Namespace, pod.Name)
+	defer unlock()
+
+	node, current, err := c.find(ctx, pod.Namespace, pod.Name)
+	if err != nil {
+		return nil, err
+	}
+	// Checked with the pod locked, so of concurrent updates of the same version only one wins
+	if pod.ResourceVersion != "" && pod.ResourceVersion != current.ResourceVersion {
+		return nil, ErrConflict
+	}
+
+	plan, errs := planUpdate(current, pod)
+	if current.DeletionTimestamp != nil {
+		if added := addedFinalizers(current.Finalizers, pod.Finalizers); len(added) > 0 {
+			errs = append(errs, field.Forbidden(field.NewPath("metadata", "finalizers"),
+				fmt.Sprintf("no new finalizers can be added if the object is being deleted, found new finalizers %q", added)))
+		}
+	}
+	if plan != nil && len(plan.recreate) > 0 && !c.allowRecreate.Load() {
+		for _, path := range plan.recreate {
+			errs = append(errs, field.Forbidden(path, "changing the image or env of a container requires recreating it, which is disabled (see --allow-pod-recreate-on-update)"))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &InvalidUpdateError{Errs: errs}
+	}
+	if dryRun {
+		return plan.apply(current, pod), nil
+	}
+
+	if plan.finalizersChanged {
+		c.metadata.setFinalizers(current, pod.Finalizers)
+
+		if current.DeletionTimestamp != nil && len(pod.Finalizers) == 0 {
+			klog.Infof("Last finalizer removed from pod %s/%s, deleting it", pod.Namespace, pod.Name)
+			if err := node.Storage.Delete(ctx, pod.Namespace, pod.Name); err != nil {
+				return nil, err
+			}
+			c.metadata.forget(current.UID)
+			current.Finalizers = nil
+			return current, nil
+		}
+	}
+
+	// The new container is created with the updated labels and annotations
+	if len(plan.recreate) > 0 {
+		klog.Infof("Recreating pod %s/%s for changes to %v", pod.Namespace, pod.Name, plan.recreate)
+		recreated, err := node.Storage.Recreate(ctx, plan.recreated(current, pod))
+		if err != nil {
+			return nil, err
+		}
+		c.metadata.resetLabelsAndAnnotations(current)
+		c.present(recreated)
+		return recreated, nil
+	}
+
+	if plan.labelsChanged {
+		c.metadata.setLabels(current, pod.Labels)
+	}
+	if plan.annotationsChanged {
+		c.metadata.setAnnotations(current, plan.annotations)
+	}
+
+	updated, err := node.Storage.Update(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	c.present(updated)
+	return updated, nil
+}
+
+// Delete deletes a pod from the node running it. A pod with finalizers is only marked for
+// deletion and returned, it is removed once its finalizers are removed by an update; the
+// returned pod is nil when the pod was removed. Pods whose container is managed by a systemd
+// unit are not deleted, failing with a SystemdUnitError, unless SetAllowSystemdDelete allows it.
+func (c *Cluster) Delete(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	return c.delete(ctx, namespace, name, false)
+}
+
+// ForceDelete deletes a pod like Delete, including the pods managed by systemd units
+func (c *Cluster) ForceDelete(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	return c.delete(ctx, namespace, name, true)
+}
+
+func (c *Cluster) delete(ctx context.Context, namespace, name string, force bool) (*corev1.Pod, error) {
+	unlock := c.podLocks.lock(namespace, name)
+	defer unlock()
+
+	// The unit annotation is read before it may be hidden
+	node, pod, err := c.locate(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if unit := pod.Annotations[SystemdUnitAnnotation]; unit != "" && !force && !c.allowSystemdDelete.Load() {
+		return nil, &SystemdUnitError{Namespace: namespace, Name: name, Unit: unit}
+	}
+	c.present(pod)
+
+	if len(pod.Finalizers) > 0 {
+		klog.Infof("Pod %s/%s has finalizers %v, marking it for deletion", namespace, name, pod.Finalizers)
+		c.metadata.markDeleted(pod)
+		_, pod, err = c.find(ctx, namespace, name)
+		return pod, err
+	}
+
+	if err := node.Storage.Delete(ctx, namespace, name); err != nil {
+		return nil, err
+	}
+	c.metadata.forget(pod.UID)
+	return nil, nil
+}
+
+// Checkpoint checkpoints a pod on the node running it and returns the exported archive
+func (c *Cluster) Checkpoint(ctx context.Context, namespace, name string, leaveRunning bool) (io.ReadCloser, error) {
+	node, _, err := c.find(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return node.Storage.Checkpoint(ctx, namespace, name, leaveRunning)
+}
+
+// Pause freezes the containers of a pod on the node running it and returns the paused pod
+func (c *Cluster) Pause(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	node, _, err := c.find(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Storage.Pause(ctx, namespace, name); err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, namespace, name)
+}
+
+// Unpause resumes the containers of a paused pod and returns the pod
+func (c *Cluster) Unpause(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	node, _, err := c.find(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.Storage.Unpause(ctx, namespace, name); err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, namespace, name)
+}
+
+// Restore restores a pod from a checkpoint archive, on the named node or on a node picked
+// as for a pod without nodeName or nodeSelector
+func (c *Cluster) Restore(ctx context.Context, namespace, name, nodeName string, checkpoint io.Reader) (*corev1.Pod, error) {
+	if existing, _, err := c.find(ctx, namespace, name); err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists on node %s", namespace, name, existing.Name)
+	}
+
+	pod := &corev1.Pod{}
+	pod.Namespace, pod.Name, pod.Spec.NodeName = namespace, name, nodeName
+	node, err := c.schedule(pod, false)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Restoring pod %s/%s on node %s", namespace, name, node.Name)
+
+	restored, err := node.Storage.Restore(ctx, namespace, name, checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	c.present(restored)
+	return restored, nil
+}
+
+// CommandLine returns the runtime command line running args against the named node,
+// for exec and logs of a pod running on that node
+func (c *Cluster) CommandLine(nodeName string, args ...string) []string {
+	node, ok := c.Node(nodeName)
+	if !ok {
+		if len(c.nodes) == 0 {
+			return append([]string{RuntimePodman}, args...)
+		}
+		node = c.nodes[0]
+	}
+	return node.Storage.CommandLine(args...)
+}
+
+// ListSecrets returns the secrets of all nodes; a secret present on several nodes is listed once
+func (c *Cluster) ListSecrets(ctx context.Context, namespace string) (*corev1.SecretList, error) {
+	var secretList *corev1.SecretList
+	seen := map[string]bool{}
+	var lastErr error
+	for _, node := range c.nodes {
+		nodeSecrets, err := node.Storage.ListSecrets(ctx, namespace)
+		if err != nil {
+			klog.Warningf("Failed to list secrets on node %s: %v", node.Name, err)
+			lastErr = err
+			continue
+		}
+		if secretList == nil {
+			secretList = &corev1.SecretList{TypeMeta: nodeSecrets.TypeMeta, Items: []corev1.Secret{}}
+		}
+		for _, secret := range nodeSecrets.Items {
+			key := secret.Namespace + "/" + secret.Name
+			if !seen[key] {
+				seen[key] = true
+				secretList.Items = append(secretList.Items, secret)
+			}
+		}
+	}
+	if secretList == nil {
+		return nil, lastErr
+	}
+	sortByNamespacedName(secretList.Items)
+	secretList.ResourceVersion = listResourceVersion(secretList.Items)
+	return secretList, nil
+}
+
+// GetSecret returns a secret from the first node that has it
+func (c *Cluster) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	var lastErr error
+	for _, node := range c.nodes {
+		secret, err := node.Storage.GetSecret(ctx, namespace, name)
+		if err == nil {
+			return secret, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// CreateSecret creates the secret on every node, so pods can use it wherever they are scheduled
+func (c *Cluster) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	var created *corev1.Secret
+	var errs []string
+	for _, node := range c.nodes {
+		result, err := node.Storage.CreateSecret(ctx, secret)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("node %s: %v", node.Name, err))
+			continue
+		}
+		if created == nil {
+			created = result
+		}
+	}
+	if len(errs) > 0 {
+		if created == nil {
+			return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		klog.Warningf("Secret %s/%s was not created on every node: %s", secret.Namespace, secret.Name, strings.Join(errs, "; "))
+	}
+	return created, nil
+}
+
+// DryRunCreateSecret validates a secret creation like CreateSecret and returns the secret
+// as it would be created
+func (c *Cluster) DryRunCreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	var errs []string
+	for _, node := range c.nodes {
+		wouldBe, err := node.Storage.DryRunCreateSecret(ctx, secret)
+		if err == nil {
+			return wouldBe, nil
+		}
+		errs = append(errs, fmt.Sprintf("node %s: %v", node.Name, err))
+	}
+	return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+}
+
+// DeleteSecret deletes the secret from every node that has it
+func (c *Cluster) DeleteSecret(ctx context.Context, namespace, name string) error {
+	deleted := false
+	var lastErr error
+	for _, node := range c.nodes {
+		if err := node.Storage.DeleteSecret(ctx, namespace, name); err != nil {
+			lastErr = err
+			continue
+		}
+		deleted = true
+	}
+	if !deleted {
+		return lastErr
+	}
+	return nil
+}
+
+// ListImages returns the images of all nodes; an image present on several nodes is listed
+// once, with the nodes that have it. Nodes that cannot be reached are skipped with a
+// warning, unless none can be reached.
+func (c *Cluster) ListImages(ctx context.Context) (*ImageList, error) {
+	nodeImages := make([][]Image, len(c.nodes))
+	errs := make([]error, len(c.nodes))
+	var wg sync.WaitGroup
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			nodeImages[i], errs[i] = node.Storage.ListImages(ctx)
+		}(i, node)
+	}
+	wg.Wait()
+
+	imageList := &ImageList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ImageList",
+			APIVersion: PodmanAPIVersion,
+		},
+		Items: []Image{},
+	}
+	index := map[string]int{}
+	var failed []error
+	for i, node := range c.nodes {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("node %s: %w", node.Name, errs[i]))
+			continue
+		}
+		for _, image := range nodeImages[i] {
+			if j, ok := index[image.Status.ID]; ok {
+				imageList.Items[j].Status.Nodes = append(imageList.Items[j].Status.Nodes, node.Name)
+				continue
+			}
+			image.Status.Nodes = []string{node.Name}
+			index[image.Status.ID] = len(imageList.Items)
+			imageList.Items = append(imageList.Items, image)
+		}
+	}
+
+	if len(failed) == len(c.nodes) && len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	for _, err := range failed {
+		klog.Warningf("Listing images without an unreachable node: %v", err)
+	}
+
+	sort.SliceStable(imageList.Items, func(i, j int) bool {
+		return imageList.Items[i].Name < imageList.Items[j].Name
+	})
+	return imageList, nil
+}
+
+// GetImage returns an image by name or full ID
+func (c *Cluster) GetImage(ctx context.Context, name string) (*Image, error) {
+	imageList, err := c.ListImages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range imageList.Items {
+		if image := &imageList.Items[i]; image.Name == name || image.Status.ID == name {
+			return image, nil
+		}
+	}
+	return nil, fmt.Errorf("image %s not found", name)
+}
+
+// PullImage pulls the image of spec.image on every node, so pods using it start right away
+// wherever they are scheduled
+func (c *Cluster) PullImage(ctx context.Context, reference string) (*Image, error) {
+	var pulled *Image
+	var errs []string
+	for _, node := range c.nodes {
+		image, err := node.Storage.PullImage(ctx, reference)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("node %s: %v", node.Name, err))
+			continue
+		}
+		if pulled == nil {
+			pulled = image
+		}
+		pulled.Status.Nodes = append(pulled.Status.Nodes, node.Name)
+	}
+	if len(errs) > 0 {
+		if pulled == nil {
+			return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		klog.Warningf("Image %s was not pulled on every node: %s", reference, strings.Join(errs, "; "))
+	}
+	return pulled, nil
+}
+
+// DeleteImage removes an image from every node that has it
+func (c *Cluster) DeleteImage(ctx context.Context, name string) error {
+	image, err := c.GetImage(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, nodeName := range image.Status.Nodes {
+		node, _ := c.Node(nodeName)
+		if err := node.Storage.RemoveImage(ctx, image.Status.ID); err != nil {
+			return fmt.Errorf("node %s: %w", node.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListNetworks returns the networks of all nodes; a network present on several nodes is
+// listed once, as found on the first of them, with the nodes that have it. Nodes that
+// cannot be reached are skipped with a warning, unless none can be reached.
+func (c *Cluster) ListNetworks(ctx context.Context) (*NetworkList, error) {
+	nodeNetworks := make([][]Network, len(c.nodes))
+	errs := make([]error, len(c.nodes))
+	var wg sync.WaitGroup
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			nodeNetworks[i], errs[i] = node.Storage.ListNetworks(ctx)
+		}(i, node)
+	}
+	wg.Wait()
+
+	networkList := &NetworkList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NetworkList",
+			APIVersion: PodmanAPIVersion,
+		},
+		Items: []Network{},
+	}
+	index := map[string]int{}
+	var failed []error
+	for i, node := range c.nodes {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("node %s: %w", node.Name, errs[i]))
+			continue
+		}
+		for _, network := range nodeNetworks[i] {
+			if j, ok := index[network.Name]; ok {
+				networkList.Items[j].Status.Nodes = append(networkList.Items[j].Status.Nodes, node.Name)
+				continue
+			}
+			network.Status.Nodes = []string{node.Name}
+			index[network.Name] = len(networkList.Items)
+			networkList.Items = append(networkList.Items, network)
+		}
+	}
+
+	if len(failed) == len(c.nodes) && len(failed) > 0 {
+		return nil, errors.Join(failed...)
+	}
+	for _, err := range failed {
+		klog.Warningf("Listing networks without an unreachable node: %v", err)
+	}
+
+	sort.SliceStable(networkList.Items, func(i, j int) bool {
+		return networkList.Items[i].Name < networkList.Items[j].Name
+	})
+	return networkList, nil
+}
+
+// GetNetwork returns a network by name
+func (c *Cluster) GetNetwork(ctx context.Context, name string) (*Network, error) {
+	networkList, err := c.ListNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range networkList.Items {
+		if networkList.Items[i].Name == name {
+			return &networkList.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("network %s not found", name)
+}
+
+// CreateNetwork creates the network on every node, so pods can join it wherever they are scheduled
+func (c *Cluster) CreateNetwork(ctx context.Context, network *Network) (*Network, error) {
+	if _, err := c.GetNetwork(ctx, network.Name); err == nil {
+		return nil, fmt.Errorf("network %s already exists", network.Name)
+	}
+
+	var created *Network
+	var errs []string
+	for _, node := range c.nodes {
+		result, err := node.Storage.CreateNetwork(ctx, network)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("node %s: %v", node.Name, err))
+			continue
+		}
+		if created == nil {
+			created = result
+		}
+		created.Status.Nodes = append(created.Status.Nodes, node.Name)
+	}
+	if len(errs) > 0 {
+		if created == nil {
+			return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		klog.Warningf("Network %s was not created on every node: %s", network.Name, strings.Join(errs, "; "))
+	}
+	return created, nil
+}
+
+// DeleteNetwork removes a network from every node that has it
+func (c *Cluster) DeleteNetwork(ctx context.Context, name string) error {
+	network, err := c.GetNetwork(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, nodeName := range network.Status.Nodes {
+		node, _ := c.Node(nodeName)
+		if err := node.Storage.RemoveNetwork(ctx, name); err != nil {
+			return fmt.Errorf("node %s: %w", node.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListNamespaces returns the namespaces, which are the same on every node
+func (c *Cluster) ListNamespaces() []string {
+	return c.nodes[0].Storage.ListNamespaces()
+}
+
+// Ping checks every node and succeeds when at least one podman is reachable
+func (c *Cluster) Ping(ctx context.Context) (string, error) {
+	var mu sync.Mutex
+	var versions []string
+	var errs []error
+
+	c.forEachNode(func(node *Node) {
+		version, err := node.Storage.Ping(ctx)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("node %s: %w", node.Name, err))
+			return
+		}
+		versions = append(versions, version)
+	})
+
+	if len(versions) == 0 {
+		return "", errors.Join(errs...)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ","), nil
+}
+
+// BackendStatus reports whether at least one node's podman is considered healthy
+func (c *Cluster) BackendStatus() (bool, error) {
+	var errs []error
+	for _, node := range c.nodes {
+		healthy, err := node.Storage.BackendStatus()
+		if healthy {
+			return true, nil
+		}
+		errs = append(errs, fmt.Errorf("node %s: %w", node.Name, err))
+	}
+	return false, errors.Join(errs...)
+}
+
+// ListNodes returns the nodes as Kubernetes Node objects, with readiness from a podman ping
+func (c *Cluster) ListNodes(ctx context.Context) *corev1.NodeList {
+	items := make([]corev1.Node, len(c.nodes))
+	var wg sync.WaitGroup
+	for i, node := range c.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			items[i] = *node.toKubeNode(ctx)
+		}(i, node)
+	}
+	wg.Wait()
+
+	return &corev1.NodeList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "NodeList",
+			APIVersion: "v1",
+		},
+		Items: items,
+	}
+}
+
+// GetNode returns a single node as a Kubernetes Node object
+func (c *Cluster) GetNode(ctx context.Context, name string) (*corev1.Node, error) {
+	node, ok := c.Node(name)
+	if !ok {
+		return nil, fmt.Errorf("node %s not found", name)
+	}
+	return node.toKubeNode(ctx), nil
+}
+
+// toKubeNode converts the node to a Kubernetes Node object
+func (n *Node) toKubeNode(ctx context.Context) *corev1.Node {
+	now := metav1.Now()
+	ready := corev1.NodeCondition{
+		Type:              corev1.NodeReady,
+		Status:            corev1.ConditionTrue,
+		LastHeartbeatTime: now,
+		Reason:            "PodmanReady",
+		Message:           n.Storage.Runtime() + " is reachable",
+	}
+
+	version, err := n.Storage.Ping(ctx)
+	if err == nil {
+		if healthy, breakerErr := n.Storage.BackendStatus(); !healthy {
+			err = breakerErr
+		}
+	}
+	if err != nil {
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = "PodmanUnavailable"
+		ready.Message = err.Error()
+	}
+
+	connection := n.Connection
+	if connection == "" {
+		connection = "local"
+	}
+
+	kubeNode := &corev1.Node{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Node",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              n.Name,
+			Labels:            n.labels(),
+			CreationTimestamp: metav1.NewTime(n.created),
+			Annotations: map[string]string{
+				"podman.io/connection": connection,
+			},
+		},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{ready},
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeHostName, Address: n.Name},
+			},
+			NodeInfo: corev1.NodeSystemInfo{
+				OperatingSystem: "linux",
+				Architecture:    n.labels()["kubernetes.io/arch"],
+			},
+		},
+	}
+	if version != "" {
+		kubeNode.Status.NodeInfo.ContainerRuntimeVersion = n.Storage.Runtime() + "://" + version
+	}
+
+	return kubeNode
+}
+
+// podLocks serializes the updates and deletions of each pod, so that the version of a pod an
+// update is checked against is still the current one when it is applied
+type podLocks struct {
+	mu    sync.Mutex
+	locks map[string]*podLock
+}
+
+// podLock is the lock of a pod, dropped once no update or deletion holds or awaits it
+type podLock struct {
+	sync.Mutex
+	users int
+}
+
+// lock locks a pod and returns the function unlocking it
+func (l *podLocks) lock(namespace, name string) func() {
+	key := namespace + "/" + name
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*podLock{}
+	}
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &podLock{}
+		l.locks[key] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// SetConnection makes every podman call go to a remote podman service instead of the local one.
+// connection is either a service URL (ssh://user@host/run/podman/podman.sock, unix:///path,
+// tcp://host:port) or the name of a connection from `podman system connection list`, such as
+// podman-machine-default. identity is the SSH key used with ssh:// URLs (optional).
+func (ps *PodStorage) SetConnection(connection, identity string) error {
+	// The systemd units of containers can only be read on this host
+	switch connection {
+	case "":
+		ps.systemd = newSystemdRestarts(os.Geteuid() != 0)
+	case RootfulConnection:
+		ps.systemd = newSystemdRestarts(false)
+	default:
+		ps.systemd = nil
+	}
+
+	if connection == "" {
+		ps.connectionArgs = nil
+		return nil
+	}
+
+	if !strings.Contains(connection, "://") {
+		ps.connectionArgs = []string{"--remote", "--connection", connection}
+		return nil
+	}
+
+	u, err := url.Parse(connection)
+	if err != nil {
+		return fmt.Errorf("invalid podman connection URL %q: %v", connection, err)
+	}
+	switch u.Scheme {
+	case "ssh", "unix", "tcp":
+	default:
+		return fmt.Errorf("unsupported podman connection scheme %q (supported: ssh, unix, tcp)", u.Scheme)
+	}
+
+	ps.connectionArgs = []string{"--remote", "--url", connection}
+	if identity != "" {
+		ps.connectionArgs = append(ps.connectionArgs, "--identity", identity)
+	}
+	return nil
+}
+
+// SetNodeName sets the node reported in spec.nodeName of the pods
+func (ps *PodStorage) SetNodeName(name string) {
+	ps.nodeName = name
+}
+
+// Runtime returns the container runtime name
+func (ps *PodStorage) Runtime() string {
+	return RuntimePodman
+}
+
+// CommandLine returns the podman command line running args against the configured connection
+func (ps *PodStorage) CommandLine(args ...string) []string {
+	return append([]string{"podman"}, ps.PodmanArgs(args...)...)
+}
+
+// PodmanArgs prepends the connection flags to the arguments of a podman invocation
+func (ps *PodStorage) PodmanArgs(args ...string) []string {
+	if len(ps.connectionArgs) == 0 {
+		return args
+	}
+	return append(append([]string{}, ps.connectionArgs...), args...)
+}
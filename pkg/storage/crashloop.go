@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// crashLoopWindow is how far back restarts count towards a crash loop
+	crashLoopWindow = 10 * time.Minute
+	// crashLoopRestarts is how many restarts within the window make a crash loop
+	crashLoopRestarts = 3
+	// crashLoopMinRun is how long a restarted container must run to be considered up again,
+	// as the kubelet resets its backoff after a successful run
+	crashLoopMinRun = 10 * time.Second
+
+	// The backoff of the kubelet between restarts: doubled from 10s at each restart, up to 5m
+	initialRestartBackoff = 10 * time.Second
+	maxRestartBackoff     = 5 * time.Minute
+)
+
+// restartTracker records when the containers of a runtime restarted, as their restart count
+// goes up between listings, to tell containers that keep crashing from those that restarted
+// once. The runtimes restart containers right away; containers in a crash loop are reported
+// waiting in CrashLoopBackOff like the kubelet reports them between restarts.
+type restartTracker struct {
+	mu         sync.Mutex
+	containers map[string]*restartHistory // keyed by container ID
+}
+
+type restartHistory struct {
+	count    int32       // Last restart count seen
+	restarts []time.Time // Recent restarts, oldest first
+	seen     time.Time   // Last time the container was seen
+}
+
+// newRestartTracker creates an empty restart tracker
+func newRestartTracker() *restartTracker {
+	return &restartTracker{
+		containers: make(map[string]*restartHistory),
+	}
+}
+
+// apply records the restarts of the containers of pods and reports the containers in a crash
+// loop as waiting in CrashLoopBackOff
+func (t *restartTracker) apply(pods []*corev1.Pod) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, pod := range pods {
+		changed := false
+		for i := range pod.Status.ContainerStatuses {
+			if t.observe(pod, &pod.Status.ContainerStatuses[i], now) {
+				changed = true
+			}
+		}
+		if changed {
+			pod.Status.Conditions = podConditions(pod, pod.CreationTimestamp, readinessTransition(pod))
+		}
+	}
+
+	// Forget containers that are gone
+	for id, history := range t.containers {
+		if now.Sub(history.seen) > crashLoopWindow {
+			delete(t.containers, id)
+		}
+	}
+}
+
+// observe records the restarts of a container and reports whether it is in a crash loop, in
+// which case its status is changed to wait in CrashLoopBackOff
+func (t *restartTracker) observe(pod *corev1.Pod, status *corev1.ContainerStatus, now time.Time) bool {
+	history, ok := t.containers[status.ContainerID]
+	if !ok {
+		history = &restartHistory{}
+		t.containers[status.ContainerID] = history
+	}
+	history.seen = now
+
+	// Restarts are dated by the start of the run that followed them; the restarts before the
+	// container was first seen are all dated by its current run
+	started := now
+	if running := status.State.Running; running != nil && !running.StartedAt.IsZero() {
+		started = running.StartedAt.Time
+	}
+	for restart := history.count; restart < status.RestartCount; restart++ {
+		history.restarts = append(history.restarts, started)
+	}
+	history.count = status.RestartCount
+	for len(history.restarts) > 0 && now.Sub(history.restarts[0]) > crashLoopWindow {
+		history.restarts = history.restarts[1:]
+	}
+
+	if len(history.restarts) < crashLoopRestarts {
+		return false
+	}
+	switch state := status.State; {
+	case state.Waiting != nil:
+		// Restarting
+	case state.Running != nil && now.Sub(state.Running.StartedAt.Time) < crashLoopMinRun:
+		// Restarted, but not up for long enough to be up again
+	default:
+		return false
+	}
+
+	status.State = corev1.ContainerState{
+		Waiting: &corev1.ContainerStateWaiting{
+			Reason:  "CrashLoopBackOff",
+			Message: fmt.Sprintf("back-off %s restarting failed container=%s pod=%s_%s(%s)", restartBackoff(len(history.restarts)), status.Name, pod.Name, pod.Namespace, pod.UID),
+		},
+	}
+	status.Ready = false
+	notStarted := false
+	status.Started = &notStarted
+	if status.LastTerminationState.Terminated == nil {
+		// The runtime does not keep the exit of the previous run of running containers
+		status.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{
+			Reason:      "Error",
+			FinishedAt:  metav1.NewTime(history.restarts[len(history.restarts)-1]),
+			ContainerID: status.ContainerID,
+		}
+	}
+	return true
+}
+
+// restartBackoff returns the backoff of the kubelet after a number of restarts
+func restartBackoff(restarts int) string {
+	backoff := initialRestartBackoff
+	for i := 1; i < restarts && backoff < maxRestartBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRestartBackoff {
+		backoff = maxRestartBackoff
+	}
+	return backoff.String()
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DevicesAnnotation lists the host devices given to the container of a pod, separated by
+// commas, as --device takes them: a device path, host:container[:permissions], or a CDI
+// device name such as nvidia.com/gpu=all
+const DevicesAnnotation = "podkube.io/devices"
+
+// nvidiaGPUResource is the extended resource of the NVIDIA device plugin, the only one docker
+// runs containers with, through --gpus
+const nvidiaGPUResource corev1.ResourceName = "nvidia.com/gpu"
+
+// isExtendedResource reports whether a resource is an extended resource, named after the
+// domain of its vendor such as nvidia.com/gpu, rather than one of Kubernetes
+func isExtendedResource(name corev1.ResourceName) bool {
+	return strings.Contains(string(name), "/") && !strings.Contains(string(name), "kubernetes.io/") &&
+		!strings.HasPrefix(string(name), corev1.DefaultResourceRequestsPrefix)
+}
+
+// withoutExtendedResources returns the resources of a container other than the extended ones
+func withoutExtendedResources(resources corev1.ResourceRequirements) corev1.ResourceRequirements {
+	resources = *resources.DeepCopy()
+	for name := range resources.Limits {
+		if isExtendedResource(name) {
+			delete(resources.Limits, name)
+		}
+	}
+	for name := range resources.Requests {
+		if isExtendedResource(name) {
+			delete(resources.Requests, name)
+		}
+	}
+	if len(resources.Limits) == 0 {
+		resources.Limits = nil
+	}
+	if len(resources.Requests) == 0 {
+		resources.Requests = nil
+	}
+	return resources
+}
+
+// extendedResources returns the extended resources of a container, from its limits or else
+// its requests, which Kubernetes requires to be equal, sorted by name
+func extendedResources(container *corev1.Container) []corev1.ResourceName {
+	var names []corev1.ResourceName
+	for _, list := range []corev1.ResourceList{container.Resources.Limits, container.Resources.Requests} {
+		for name := range list {
+			if isExtendedResource(name) && !containsResource(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+func containsResource(names []corev1.ResourceName, name corev1.ResourceName) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceArgs returns the run arguments giving a container the devices of the pod annotation
+// and of its extended resources. podman gets the first N CDI devices of the class of an
+// extended resource, vendor.com/class=0 to N-1, and docker the N GPUs of --gpus, which only
+// exists for NVIDIA GPUs.
+func deviceArgs(pod *corev1.Pod, container *corev1.Container, runtime string) ([]string, error) {
+	var args []string
+	for _, device := range strings.Split(pod.Annotations[DevicesAnnotation], ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			args = append(args, "--device", device)
+		}
+	}
+
+	for _, name := range extendedResources(container) {
+		quantity, ok := container.Resources.Limits[name]
+		if !ok {
+			quantity = container.Resources.Requests[name]
+		}
+		count, ok := quantity.AsInt64()
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("extended resource %s of container %s must be a whole number, not %s", name, container.Name, quantity.String())
+		}
+		if count == 0 {
+			continue
+		}
+		if runtime == RuntimeDocker {
+			if name != nvidiaGPUResource {
+				return nil, fmt.Errorf("extended resource %s is not supported by docker, only %s is", name, nvidiaGPUResource)
+			}
+			args = append(args, "--gpus", fmt.Sprint(count))
+			continue
+		}
+		for i := int64(0); i < count; i++ {
+			args = append(args, "--device", fmt.Sprintf("%s=%d", name, i))
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hostsAndDNSArgs returns the run arguments applying the host aliases, DNS policy and DNS
+// config of a pod. There is no cluster DNS: the ClusterFirst policies resolve as the Default
+// one, with the resolver the runtime gives the network of the container, extended by the
+// DNS config. The None policy only uses the DNS config; without nameservers the container
+// gets no /etc/resolv.conf.
+func hostsAndDNSArgs(pod *corev1.Pod) []string {
+	var args []string
+	for _, alias := range pod.Spec.HostAliases {
+		for _, hostname := range alias.Hostnames {
+			args = append(args, "--add-host", fmt.Sprintf("%s:%s", hostname, alias.IP))
+		}
+	}
+
+	config := pod.Spec.DNSConfig
+	if config == nil {
+		config = &corev1.PodDNSConfig{}
+	}
+	if pod.Spec.DNSPolicy == corev1.DNSNone {
+		if len(config.Nameservers) == 0 {
+			return append(args, "--dns", "none")
+		}
+		if len(config.Searches) == 0 {
+			// Rather than the search domains of the host
+			args = append(args, "--dns-search", ".")
+		}
+	}
+	for _, nameserver := range config.Nameservers {
+		args = append(args, "--dns", nameserver)
+	}
+	for _, search := range config.Searches {
+		args = append(args, "--dns-search", search)
+	}
+	for _, option := range config.Options {
+		if option.Value != nil {
+			args = append(args, "--dns-option", fmt.Sprintf("%s:%s", option.Name, *option.Value))
+		} else {
+			args = append(args, "--dns-option", option.Name)
+		}
+	}
+	return args
+}
@@ -0,0 +1,724 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog/v2"
+)
+
+// annotationLabelPrefix marks the labels holding pod annotations on runtimes without
+// container annotations (docker)
+const annotationLabelPrefix = "annotations.podkube.io/"
+
+// errDockerSecretsUnsupported is returned for secret writes on docker nodes: docker secrets
+// require swarm mode
+var errDockerSecretsUnsupported = errors.New("secrets are not supported by the docker runtime")
+
+// DockerStorage provides Pod storage operations backed by the docker CLI
+type DockerStorage struct {
+	namespace string            // All containers go in this namespace
+	cache     *containerCache   // In-memory docker ps result, invalidated by docker events
+	specCache *podSpecCache     // Pod specs built from docker inspect, per container
+	digests   *imageDigestCache // Repository digests of the images of containers
+	restarts  *restartTracker   // Recent restarts of containers, to detect crash loops
+	usage     *usageCache       // Recently sampled docker stats of containers
+	pulls     *pullBackoff      // Images that recently failed to pull
+	breaker   *circuitBreaker   // Stops calling docker after repeated failures
+	ping      *pingCache        // Last docker connectivity check
+
+	commandTimeout atomic.Int64 // Maximum duration of a single docker invocation, reloadable
+	connectionArgs []string     // Global docker flags selecting a remote docker engine
+	nodeName       string       // Node reported in spec.nodeName of the pods
+}
+
+// NewDockerStorage creates a new DockerStorage instance
+func NewDockerStorage() *DockerStorage {
+	ds := &DockerStorage{
+		namespace: "containers",
+		cache:     newContainerCache(),
+		specCache: newPodSpecCache(),
+		digests:   newImageDigestCache(),
+		restarts:  newRestartTracker(),
+		usage:     newUsageCache(),
+		pulls:     newPullBackoff(),
+		breaker:   newCircuitBreaker(),
+		ping:      &pingCache{},
+	}
+	ds.commandTimeout.Store(int64(defaultCommandTimeout))
+	return ds
+}
+
+// Runtime returns the container runtime name
+func (ds *DockerStorage) Runtime() string {
+	return RuntimeDocker
+}
+
+// SetConnection makes every docker call go to a remote docker engine. connection is either
+// a daemon URL (ssh://user@host, unix:///path/docker.sock, tcp://host:port) or the name of a
+// docker context. SSH keys are taken from the SSH agent or configuration, identity is unused.
+func (ds *DockerStorage) SetConnection(connection, identity string) error {
+	if connection == "" {
+		ds.connectionArgs = nil
+		return nil
+	}
+
+	if !strings.Contains(connection, "://") {
+		ds.connectionArgs = []string{"--context", connection}
+		return nil
+	}
+
+	u, err := url.Parse(connection)
+	if err != nil {
+		return fmt.Errorf("invalid docker connection URL %q: %v", connection, err)
+	}
+	switch u.Scheme {
+	case "ssh", "unix", "tcp":
+	default:
+		return fmt.Errorf("unsupported docker connection scheme %q (supported: ssh, unix, tcp)", u.Scheme)
+	}
+	if identity != "" {
+		klog.Warningf("Ignoring identity %s for docker connection %s, docker uses the SSH agent and ~/.ssh/config", identity, connection)
+	}
+
+	ds.connectionArgs = []string{"--host", connection}
+	return nil
+}
+
+// SetNodeName sets the node reported in spec.nodeName of the pods
+func (ds *DockerStorage) SetNodeName(name string) {
+	ds.nodeName = name
+}
+
+// SetCacheTTL sets how long a docker ps result is served from memory (0 disables caching)
+func (ds *DockerStorage) SetCacheTTL(ttl time.Duration) {
+	ds.cache.mu.Lock()
+	defer ds.cache.mu.Unlock()
+	ds.cache.ttl = ttl
+	if ttl <= 0 {
+		ds.cache.valid = false
+	}
+}
+
+// SetCommandTimeout sets the maximum duration of a single docker invocation (0 disables the limit)
+func (ds *DockerStorage) SetCommandTimeout(timeout time.Duration) {
+	ds.commandTimeout.Store(int64(timeout))
+}
+
+// SetCircuitBreaker configures how many consecutive docker failures open the breaker
+// and how long it stays open before probing again (threshold 0 disables the breaker)
+func (ds *DockerStorage) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	ds.breaker.mu.Lock()
+	defer ds.breaker.mu.Unlock()
+	ds.breaker.threshold = threshold
+	ds.breaker.cooldown = cooldown
+}
+
+// SetParallelism is a no-op: docker containers are listed with a single inspect call
+func (ds *DockerStorage) SetParallelism(parallelism int) {}
+
+// SetServiceAccountTokens is a no-op: docker cannot mount projected volumes
+func (ds *DockerStorage) SetServiceAccountTokens(tokens ServiceAccountTokens) {}
+
+// CommandLine returns the docker command line running args against the configured connection
+func (ds *DockerStorage) CommandLine(args ...string) []string {
+	return append(append([]string{"docker"}, ds.connectionArgs...), args...)
+}
+
+// dockerCommand builds a docker invocation bound to ctx and to the per-command timeout.
+// The returned cancel function must be called once the command has completed.
+func (ds *DockerStorage) dockerCommand(ctx context.Context, args ...string) (*exec.Cmd, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if timeout := time.Duration(ds.commandTimeout.Load()); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	commandLine := ds.CommandLine(args...)
+	return exec.CommandContext(ctx, commandLine[0], commandLine[1:]...), cancel
+}
+
+// List returns a list of pods, optionally filtered by namespace and selectors
+func (ds *DockerStorage) List(ctx context.Context, namespace, labelSelector, fieldSelector string) (*corev1.PodList, error) {
+	selector, err := ParsePodFieldSelector(fieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector %q: %v", fieldSelector, err)
+	}
+	containers, err := ds.getDockerContainers(ctx)
+	if err != nil {
+		klog.Errorf("Failed to get docker containers: %v", err)
+		return nil, fmt.Errorf("failed to get containers: %w", err)
+	}
+	ds.specCache.prune(containers)
+
+	converted := make([]*corev1.Pod, len(containers))
+	for i := range containers {
+		converted[i] = ds.dockerContainerToPod(&containers[i])
+	}
+	grouped := groupPods(converted)
+	ds.digests.resolve(ctx, ds.dockerCommand, grouped)
+	ds.restarts.apply(grouped)
+
+	var pods []corev1.Pod
+	for _, pod := range grouped {
+		if namespace != "" && pod.Namespace != namespace {
+			continue
+		}
+		if labelSelector != "" && !matchesLabelSelector(pod, labelSelector) {
+			continue
+		}
+		if !matchesFieldSelector(pod, selector) {
+			continue
+		}
+		pods = append(pods, *pod)
+	}
+
+	return &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PodList",
+			APIVersion: "v1",
+		},
+		Items: pods,
+	}, nil
+}
+
+// Get returns a specific pod by namespace and name
+func (ds *DockerStorage) Get(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	members, err := ds.podContainers(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]*corev1.Pod, len(members))
+	for i, container := range members {
+		converted[i] = ds.dockerContainerToPod(container)
+	}
+	pod := groupPods(converted)[0]
+	ds.digests.resolve(ctx, ds.dockerCommand, []*corev1.Pod{pod})
+	ds.restarts.apply([]*corev1.Pod{pod})
+	return pod, nil
+}
+
+// podContainers returns the containers of the named pod: a standalone container, or the
+// containers kubelet ran for the pod through cri-dockerd
+func (ds *DockerStorage) podContainers(ctx context.Context, namespace, name string) ([]*PodmanContainer, error) {
+	containers, err := ds.getDockerContainers(ctx)
+	if errors.Is(err, ErrPodmanUnavailable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+
+	members := podContainers(containers, namespace, name, ds.namespace)
+	if len(members) == 0 {
+		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+	return members, nil
+}
+
+// Create adds a new pod by running a docker container
+func (ds *DockerStorage) Create(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if pod.Namespace != ds.namespace {
+		return nil, fmt.Errorf("pods can only be created in namespace %s", ds.namespace)
+	}
+	if RequiresKubePlay(pod) {
+		return nil, ErrKubePlayUnsupported
+	}
+	if !ds.breaker.allow() {
+		return nil, ds.breaker.unavailableError()
+	}
+
+	if existing, err := ds.getDockerContainer(ctx, pod.Name); err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+	}
+
+	if err := ds.pulls.check(pod); err != nil {
+		return nil, err
+	}
+
+	args, err := containerRunArgs(pod, RuntimeDocker)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd, cancel := ds.dockerCommand(ctx, args...)
+	defer cancel()
+	output, err := cmd.Output()
+	ds.cache.invalidate()
+	if err != nil {
+		if isNameInUse(err) {
+			return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+		}
+		return nil, ds.pulls.failed(pod, commandOutput(err), fmt.Errorf("failed to create container: %v", err))
+	}
+	ds.pulls.succeeded(pod)
+	klog.Infof("Created docker container %s with ID: %s", pod.Name, strings.TrimSpace(string(output)))
+
+	created, err := ds.getDockerContainer(ctx, pod.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get created container: %v", err)
+	}
+	return ds.dockerContainerToPod(created), nil
+}
+
+// DryRunCreate validates a pod creation like Create and returns the pod as it would be
+// created, without running a container
+func (ds *DockerStorage) DryRunCreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if pod.Namespace != ds.namespace {
+		return nil, fmt.Errorf("pods can only be created in namespace %s", ds.namespace)
+	}
+	if RequiresKubePlay(pod) {
+		return nil, ErrKubePlayUnsupported
+	}
+
+	existing, err := ds.getDockerContainer(ctx, pod.Name)
+	if errors.Is(err, ErrPodmanUnavailable) {
+		return nil, err
+	}
+	if err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+	}
+
+	if _, err := containerRunArgs(pod, RuntimeDocker); err != nil {
+		return nil, err
+	}
+
+	return dryRunPod(pod, ds.nodeName), nil
+}
+
+// Update returns the current state of the pod; containers cannot be updated in place
+func (ds *DockerStorage) Update(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	klog.Infof("Update request for pod %s - containers have limited update support", pod.Name)
+	return ds.Get(ctx, pod.Namespace, pod.Name)
+}
+
+// Recreate stops and removes the container of a pod and runs a new one for the given pod,
+// under the same name
+func (ds *DockerStorage) Recreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if !ds.breaker.allow() {
+		return nil, ds.breaker.unavailableError()
+	}
+	args, err := containerRunArgs(pod, RuntimeDocker)
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := ds.getDockerContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	container, err := recreatableContainer(containers, pod, ds.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	klog.Infof("Recreating docker container %s of pod %s/%s", container.Id, pod.Namespace, pod.Name)
+	defer ds.cache.invalidate()
+
+	rmCmd, cancel := ds.dockerCommand(ctx, "rm", "--force", container.Id)
+	defer cancel()
+	if err := rmCmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to remove container %s: %v", pod.Name, err)
+	}
+
+	runCmd, cancel := ds.dockerCommand(ctx, args...)
+	defer cancel()
+	if err := runCmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to create container: %v", err)
+	}
+	ds.cache.invalidate()
+
+	created, err := ds.getDockerContainer(ctx, pod.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recreated container: %v", err)
+	}
+	return ds.dockerContainerToPod(created), nil
+}
+
+// Delete stops and removes the docker containers of a pod
+func (ds *DockerStorage) Delete(ctx context.Context, namespace, name string) error {
+	if !ds.breaker.allow() {
+		return ds.breaker.unavailableError()
+	}
+
+	members, err := ds.podContainers(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	defer ds.cache.invalidate()
+
+	for _, container := range members {
+		stopCmd, cancel := ds.dockerCommand(ctx, "stop", container.Id)
+		defer cancel()
+		if err := stopCmd.Run(); err != nil {
+			klog.Warningf("Failed to stop container %s: %v", containerPodName(container), err)
+		}
+
+		rmCmd, cancel := ds.dockerCommand(ctx, "rm", container.Id)
+		defer cancel()
+		if err := rmCmd.Run(); err != nil {
+			return fmt.Errorf("failed to remove container %s: %v", containerPodName(container), err)
+		}
+
+		klog.Infof("Deleted docker container %s", containerPodName(container))
+	}
+	return nil
+}
+
+// ListSecrets returns no secrets: docker secrets require swarm mode
+func (ds *DockerStorage) ListSecrets(ctx context.Context, namespace string) (*corev1.SecretList, error) {
+	return &corev1.SecretList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "SecretList",
+			APIVersion: "v1",
+		},
+	}, nil
+}
+
+// GetSecret always fails: docker secrets require swarm mode
+func (ds *DockerStorage) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+}
+
+// CreateSecret always fails: docker secrets require swarm mode
+func (ds *DockerStorage) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	return nil, errDockerSecretsUnsupported
+}
+
+// DryRunCreateSecret always fails: docker secrets require swarm mode
+func (ds *DockerStorage) DryRunCreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	return nil, errDockerSecretsUnsupported
+}
+
+// DeleteSecret always fails: docker secrets require swarm mode
+func (ds *DockerStorage) DeleteSecret(ctx context.Context, namespace, name string) error {
+	return errDockerSecretsUnsupported
+}
+
+// ListNamespaces returns the list of available namespaces
+func (ds *DockerStorage) ListNamespaces() []string {
+	return []string{
+		"containers",
+		"containers-exited",
+	}
+}
+
+// ListProjects returns the list of available namespaces as OpenShift projects
+func (ds *DockerStorage) ListProjects() *ProjectList {
+	return namespacesToProjects(ds.ListNamespaces())
+}
+
+// Ping checks that the docker engine is reachable by running docker version
+func (ds *DockerStorage) Ping(ctx context.Context) (string, error) {
+	ds.ping.mu.Lock()
+	defer ds.ping.mu.Unlock()
+
+	if !ds.ping.checkedAt.IsZero() && time.Since(ds.ping.checkedAt) < pingCacheTTL {
+		return ds.ping.version, ds.ping.err
+	}
+
+	cmd, cancel := ds.dockerCommand(ctx, "version", "--format", "{{.Server.Version}}")
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		err = fmt.Errorf("docker version failed: %v", err)
+	}
+
+	ds.ping.checkedAt = time.Now()
+	ds.ping.version = strings.TrimSpace(string(output))
+	ds.ping.err = err
+	return ds.ping.version, err
+}
+
+// BackendStatus reports whether docker is considered healthy, with the last error otherwise
+func (ds *DockerStorage) BackendStatus() (bool, error) {
+	if ds.breaker.isOpen() {
+		return false, ds.breaker.unavailableError()
+	}
+	return true, nil
+}
+
+// RunEventWatcher follows docker events and invalidates the container cache on every
+// container event. It reconnects when the stream ends and returns when ctx is cancelled.
+func (ds *DockerStorage) RunEventWatcher(ctx context.Context) {
+	for {
+		if err := ds.watchDockerEvents(ctx); err != nil {
+			klog.Warningf("Docker events stream failed, falling back to TTL-based cache expiry: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventWatcherRetryInterval):
+		}
+	}
+}
+
+// watchDockerEvents runs a single docker events session until it ends or ctx is cancelled
+func (ds *DockerStorage) watchDockerEvents(ctx context.Context) error {
+	commandLine := ds.CommandLine("events", "--format", "{{json .}}", "--filter", "type=container")
+	cmd := exec.CommandContext(ctx, commandLine[0], commandLine[1:]...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	klog.Infof("Watching docker events to keep the container cache up to date")
+	ds.cache.setEventsActive(true)
+	defer ds.cache.setEventsActive(false)
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		klog.V(4).Infof("Docker event: %s", scanner.Text())
+		ds.cache.invalidate()
+	}
+
+	return cmd.Wait()
+}
+
+// Changes returns a channel closed at the next change of the containers, as docker events
+// and the writes through this storage report them
+func (ds *DockerStorage) Changes() <-chan struct{} {
+	return ds.cache.changes.wait()
+}
+
+// dockerInspectResult is the subset of docker inspect output used by the adapter
+type dockerInspectResult struct {
+	Id           string `json:"Id"`
+	Name         string `json:"Name"`
+	Created      string `json:"Created"`
+	Image        string `json:"Image"`
+	RestartCount int    `json:"RestartCount"`
+	State        struct {
+		Status     string `json:"Status"`
+		ExitCode   int    `json:"ExitCode"`
+		StartedAt  string `json:"StartedAt"`
+		FinishedAt string `json:"FinishedAt"`
+	} `json:"State"`
+	Config struct {
+		Image        string              `json:"Image"`
+		Cmd          []string            `json:"Cmd"`
+		Entrypoint   []string            `json:"Entrypoint"`
+		Env          []string            `json:"Env"`
+		Labels       map[string]string   `json:"Labels"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"Config"`
+	AppArmorProfile string `json:"AppArmorProfile"`
+	HostConfig      struct {
+		SecurityOpt []string `json:"SecurityOpt"`
+	} `json:"HostConfig"`
+}
+
+// getDockerContainers returns all containers, served from the cache when it is fresh
+func (ds *DockerStorage) getDockerContainers(ctx context.Context) ([]PodmanContainer, error) {
+	if containers, ok := ds.cache.get(); ok {
+		return containers, nil
+	}
+	if !ds.breaker.allow() {
+		return degradedContainers(ds.cache, ds.breaker, RuntimeDocker)
+	}
+
+	ds.cache.fetchMu.Lock()
+	defer ds.cache.fetchMu.Unlock()
+
+	if containers, ok := ds.cache.get(); ok {
+		return containers, nil
+	}
+
+	generation := ds.cache.currentGeneration()
+	containers, err := ds.listDockerContainers(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			ds.breaker.recordFailure(err)
+		}
+		if ds.breaker.isOpen() {
+			return degradedContainers(ds.cache, ds.breaker, RuntimeDocker)
+		}
+		return nil, err
+	}
+	ds.breaker.recordSuccess()
+	ds.cache.store(containers, generation)
+
+	return containers, nil
+}
+
+// getDockerContainer gets a specific container by ID or name
+func (ds *DockerStorage) getDockerContainer(ctx context.Context, nameOrID string) (*PodmanContainer, error) {
+	containers, err := ds.getDockerContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range containers {
+		if containers[i].Id == nameOrID || (len(containers[i].Names) > 0 && containers[i].Names[0] == nameOrID) {
+			return &containers[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("container %s not found", nameOrID)
+}
+
+// listDockerContainers lists all containers with docker ps and describes them with a
+// single docker inspect call
+func (ds *DockerStorage) listDockerContainers(ctx context.Context) ([]PodmanContainer, error) {
+	psCmd, cancel := ds.dockerCommand(ctx, "ps", "--all", "--quiet", "--no-trunc")
+	defer cancel()
+	output, err := psCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run docker ps: %v", err)
+	}
+
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return []PodmanContainer{}, nil
+	}
+
+	inspectCmd, cancel := ds.dockerCommand(ctx, append([]string{"inspect", "--type", "container"}, ids...)...)
+	defer cancel()
+	output, err = inspectCmd.Output()
+	if err != nil && len(output) == 0 {
+		return nil, fmt.Errorf("failed to inspect containers: %v", err)
+	}
+	if err != nil {
+		// A container removed after docker ps makes inspect fail for it only
+		klog.V(2).Infof("docker inspect reported an error, using partial output: %v", err)
+	}
+
+	var inspectResults []dockerInspectResult
+	if err := json.Unmarshal(output, &inspectResults); err != nil {
+		return nil, fmt.Errorf("failed to parse docker inspect output: %v", err)
+	}
+
+	containers := make([]PodmanContainer, 0, len(inspectResults))
+	for i := range inspectResults {
+		container := inspectResults[i].toContainer()
+		ds.specCache.store(&container, inspectResults[i].podSpec(containerPodName(&container)))
+		containers = append(containers, container)
+	}
+
+	return containers, nil
+}
+
+// toContainer converts docker inspect output to the container record shared with podman
+func (d *dockerInspectResult) toContainer() PodmanContainer {
+	container := PodmanContainer{
+		Id:          d.Id,
+		Names:       []string{strings.TrimPrefix(d.Name, "/")},
+		Image:       d.Config.Image,
+		ImageID:     d.Image,
+		Command:     append(append([]string{}, d.Config.Entrypoint...), d.Config.Cmd...),
+		State:       d.State.Status,
+		Exited:      d.State.Status == "exited",
+		ExitCode:    d.State.ExitCode,
+		Restarts:    d.RestartCount,
+		Labels:      map[string]string{},
+		Annotations: map[string]string{},
+	}
+
+	// Annotations are stored as prefixed labels
+	for key, value := range d.Config.Labels {
+		if annotation, ok := strings.CutPrefix(key, annotationLabelPrefix); ok {
+			container.Annotations[annotation] = value
+		} else {
+			container.Labels[key] = value
+		}
+	}
+	for key, value := range appliedProfileAnnotations(d.AppArmorProfile, d.HostConfig.SecurityOpt) {
+		container.Annotations[key] = value
+	}
+
+	if created, err := time.Parse(time.RFC3339Nano, d.Created); err == nil {
+		container.Created = created.Unix()
+	}
+	if started, err := time.Parse(time.RFC3339Nano, d.State.StartedAt); err == nil && started.Year() > 1 {
+		container.StartedAt = started.Unix()
+	}
+	if finished, err := time.Parse(time.RFC3339Nano, d.State.FinishedAt); err == nil && finished.Year() > 1 {
+		container.ExitedAt = finished.Unix()
+	}
+
+	return container
+}
+
+// podSpec builds the pod spec of a docker container, since docker has no kube generate
+func (d *dockerInspectResult) podSpec(podName string) *corev1.PodSpec {
+	container := corev1.Container{
+		Name:    podName,
+		Image:   d.Config.Image,
+		Command: d.Config.Entrypoint,
+		Args:    d.Config.Cmd,
+	}
+
+	for _, env := range d.Config.Env {
+		name, value, _ := strings.Cut(env, "=")
+		container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: value})
+	}
+
+	for exposed := range d.Config.ExposedPorts {
+		port, protocol, _ := strings.Cut(exposed, "/")
+		containerPort := intstr.Parse(port)
+		if containerPort.Type != intstr.Int {
+			continue
+		}
+		container.Ports = append(container.Ports, corev1.ContainerPort{
+			ContainerPort: containerPort.IntVal,
+			Protocol:      corev1.Protocol(strings.ToUpper(protocol)),
+		})
+	}
+
+	return &corev1.PodSpec{
+		Containers: []corev1.Container{container},
+	}
+}
+
+// dockerContainerToPod converts a docker container to a Kubernetes Pod
+func (ds *DockerStorage) dockerContainerToPod(container *PodmanContainer) *corev1.Pod {
+	if isInfraContainer(container) {
+		// cri-dockerd sandbox containers only hold the namespaces of a pod
+		return nil
+	}
+	podName := containerPodName(container)
+
+	var podSpec corev1.PodSpec
+	if cachedSpec, ok := ds.specCache.get(container); ok {
+		podSpec = *cachedSpec
+	}
+
+	annotations := map[string]string{
+		"docker.io/container-id": container.Id,
+		"docker.io/image-id":     container.ImageID,
+	}
+	for key, value := range container.Annotations {
+		annotations[key] = value
+	}
+
+	podNamespace := ds.namespace
+	if _, hasDebugAnnotation := annotations["debug.openshift.io/source-container"]; container.State == "exited" && !hasDebugAnnotation {
+		podNamespace = "containers-exited"
+	}
+
+	pod := containerToPod(container, podName, podNamespace, podSpec, annotations, RuntimeDocker, ds.nodeName)
+	if identity, ok := containerIdentity(container); ok {
+		applyIdentity(pod, identity, ds.namespace)
+	}
+	return pod
+}
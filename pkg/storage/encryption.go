@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// EncryptedResources are the resources podKube stores itself, on disk, and can encrypt:
+// namespaces, their annotations and deletions in namespaces.json; pods, their finalizers,
+// label and annotation changes and deletions in pods.json; and routes, in routes.json
+var EncryptedResources = []string{"namespaces", "pods", "routes.route.openshift.io"}
+
+// aesgcmPrefix starts the data encrypted by an aesgcm provider, followed by the name of the
+// key, a colon, the nonce and the ciphertext, as kube-apiserver stores it in etcd
+const aesgcmPrefix = "k8s:enc:aesgcm:v1:"
+
+// EncryptionConfiguration is the subset of the kube-apiserver EncryptionConfiguration
+// (apiserver.config.k8s.io/v1) podKube supports: the aesgcm and identity providers
+type EncryptionConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+	Resources       []ResourceConfiguration `json:"resources"`
+}
+
+// ResourceConfiguration lists the providers of some resources, the first one encrypting what
+// is written, all of them decrypting what is read, for key rotations
+type ResourceConfiguration struct {
+	Resources []string                `json:"resources"`
+	Providers []ProviderConfiguration `json:"providers"`
+}
+
+// ProviderConfiguration is a provider: aesgcm, or identity, which stores data as it is
+type ProviderConfiguration struct {
+	AESGCM   *KeysConfiguration `json:"aesgcm,omitempty"`
+	Identity *struct{}          `json:"identity,omitempty"`
+}
+
+// KeysConfiguration holds the keys of a provider, the first one encrypting
+type KeysConfiguration struct {
+	Keys []Key `json:"keys"`
+}
+
+// Key is a named AES key, base64-encoded, of 16, 24 or 32 bytes
+type Key struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+// encryptionKey is an aesgcm key, or the identity provider when aead is nil
+type encryptionKey struct {
+	name string
+	aead cipher.AEAD
+}
+
+// Encryption encrypts and decrypts the resources podKube stores on disk; resources without
+// providers are stored as they are
+type Encryption struct {
+	providers map[string][]encryptionKey // By resource
+}
+
+// LoadEncryptionConfig reads an EncryptionConfiguration file; an empty path stores every
+// resource as it is
+func LoadEncryptionConfig(path string) (*Encryption, error) {
+	encryption := &Encryption{providers: map[string][]encryptionKey{}}
+	if path == "" {
+		return encryption, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption config: %v", err)
+	}
+	var config EncryptionConfiguration
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid encryption config %s: %v", path, err)
+	}
+	if config.Kind != "EncryptionConfiguration" || config.APIVersion != "apiserver.config.k8s.io/v1" {
+		return nil, fmt.Errorf("invalid encryption config %s: expected kind EncryptionConfiguration of apiserver.config.k8s.io/v1", path)
+	}
+
+	for i, resources := range config.Resources {
+		keys, err := encryptionKeys(resources.Providers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption config %s: resources[%d]: %v", path, i, err)
+		}
+		for _, resource := range resources.Resources {
+			matched := false
+			for _, stored := range EncryptedResources {
+				if encryptionMatches(resource, stored) {
+					matched = true
+					if _, ok := encryption.providers[stored]; !ok {
+						// As with kube-apiserver, the first entry matching a resource wins
+						encryption.providers[stored] = keys
+					}
+				}
+			}
+			if !matched {
+				klog.Warningf("Encryption config %s lists %s, which podKube does not store, only %v", path, resource, EncryptedResources)
+			}
+		}
+	}
+	return encryption, nil
+}
+
+// encryptionMatches reports whether a resource of an EncryptionConfiguration, such as pods,
+// routes.route.openshift.io or the wildcards *. (the core group), *.route.openshift.io and
+// *.*, selects a stored resource
+func encryptionMatches(resource, stored string) bool {
+	name, group, _ := strings.Cut(stored, ".")
+	switch resource {
+	case stored, "*." + group, "*.*":
+		return true
+	case name + ".":
+		return group == ""
+	}
+	return false
+}
+
+// encryptionKeys returns the keys of providers, in order
+func encryptionKeys(providers []ProviderConfiguration) ([]encryptionKey, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no providers")
+	}
+	var keys []encryptionKey
+	for i, provider := range providers {
+		switch {
+		case provider.AESGCM != nil && provider.Identity != nil:
+			return nil, fmt.Errorf("providers[%d] sets more than one provider", i)
+		case provider.Identity != nil:
+			keys = append(keys, encryptionKey{})
+		case provider.AESGCM != nil:
+			if len(provider.AESGCM.Keys) == 0 {
+				return nil, fmt.Errorf("providers[%d].aesgcm has no keys", i)
+			}
+			for j, key := range provider.AESGCM.Keys {
+				aead, err := newAESGCM(key)
+				if err != nil {
+					return nil, fmt.Errorf("providers[%d].aesgcm.keys[%d]: %v", i, j, err)
+				}
+				keys = append(keys, encryptionKey{name: key.Name, aead: aead})
+			}
+		default:
+			return nil, fmt.Errorf("providers[%d] is not supported, only aesgcm and identity are", i)
+		}
+	}
+	return keys, nil
+}
+
+// newAESGCM returns the AES-GCM cipher of a key
+func newAESGCM(key Key) (cipher.AEAD, error) {
+	if key.Name == "" || strings.Contains(key.Name, ":") {
+		return nil, fmt.Errorf("invalid key name %q", key.Name)
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("key %s is not base64-encoded: %v", key.Name, err)
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %v", key.Name, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt encrypts the data of a resource with its first provider
+func (e *Encryption) Encrypt(resource string, data []byte) ([]byte, error) {
+	keys := e.keys(resource)
+	if len(keys) == 0 || keys[0].aead == nil {
+		return data, nil
+	}
+	key := keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(aesgcmPrefix+key.name+":"), nonce...)
+	return key.aead.Seal(out, nonce, data, []byte(resource)), nil
+}
+
+// Decrypt decrypts the data of a resource with the provider that encrypted it; stale reports
+// that it was not written by the first provider, and should be written again to be encrypted
+// with the current key
+func (e *Encryption) Decrypt(resource string, data []byte) (plain []byte, stale bool, err error) {
+	keys := e.keys(resource)
+	rest, encrypted := bytes.CutPrefix(data, []byte(aesgcmPrefix))
+	if !encrypted {
+		for i, key := range keys {
+			if key.aead == nil {
+				return data, i != 0, nil
+			}
+		}
+		if len(keys) == 0 {
+			return data, false, nil
+		}
+		return nil, false, fmt.Errorf("%s are not encrypted, add the identity provider to the encryption config to read them", resource)
+	}
+
+	name, sealed, ok := bytes.Cut(rest, []byte(":"))
+	if !ok {
+		return nil, false, fmt.Errorf("invalid encrypted %s", resource)
+	}
+	for i, key := range keys {
+		if key.aead == nil || key.name != string(name) {
+			continue
+		}
+		if len(sealed) < key.aead.NonceSize() {
+			return nil, false, fmt.Errorf("invalid encrypted %s", resource)
+		}
+		nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+		plain, err := key.aead.Open(nil, nonce, ciphertext, []byte(resource))
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to decrypt %s with key %s: %v", resource, key.name, err)
+		}
+		return plain, i != 0, nil
+	}
+	return nil, false, fmt.Errorf("%s are encrypted with key %s, which is not in the encryption config", resource, name)
+}
+
+// keys returns the providers of a resource, none when it is stored as it is
+func (e *Encryption) keys(resource string) []encryptionKey {
+	if e == nil {
+		return nil
+	}
+	return e.providers[resource]
+}
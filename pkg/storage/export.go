@@ -0,0 +1,50 @@
+package storage
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// lastAppliedAnnotation is set by kubectl apply, which sets it again when the manifest is applied
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// ExportPod returns the manifest of a pod, cleaned up to be applied elsewhere: its spec, as
+// podman kube generate reads it from the container, with its name, labels, annotations and
+// finalizers, without its status, the fields the server and the runtime assign (namespace,
+// UID, resourceVersion, timestamps, node, default tolerations, owners) and the internal
+// annotations and labels of podKube and the runtimes
+func ExportPod(pod *corev1.Pod) *corev1.Pod {
+	exported := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Labels:      exportedMetadata(pod.Labels),
+			Annotations: exportedMetadata(pod.Annotations),
+			Finalizers:  append([]string(nil), pod.Finalizers...),
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	delete(exported.Annotations, lastAppliedAnnotation)
+	if len(exported.Annotations) == 0 {
+		exported.Annotations = nil
+	}
+
+	exported.Spec.NodeName = ""
+	exported.Spec.Tolerations = nonDefaultTolerations(exported.Spec.Tolerations)
+	return exported
+}
+
+// exportedMetadata returns the labels or annotations of a pod without the internal ones
+func exportedMetadata(values map[string]string) map[string]string {
+	var exported map[string]string
+	for key, value := range values {
+		if isInternalAnnotation(key) {
+			continue
+		}
+		if exported == nil {
+			exported = map[string]string{}
+		}
+		exported[key] = value
+	}
+	return exported
+}
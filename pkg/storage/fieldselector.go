@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// podFieldLabels are the fields pods can be selected by, those of the API server
+var podFieldLabels = map[string]bool{
+	"metadata.name":            true,
+	"metadata.namespace":       true,
+	"spec.nodeName":            true,
+	"spec.restartPolicy":       true,
+	"spec.schedulerName":       true,
+	"spec.serviceAccountName":  true,
+	"spec.hostNetwork":         true,
+	"status.phase":             true,
+	"status.podIP":             true,
+	"status.nominatedNodeName": true,
+}
+
+// ParsePodFieldSelector parses a field selector of pods, such as
+// metadata.namespace=default,status.phase!=Running. Like the API server, it fails on fields
+// pods cannot be selected by, rather than ignoring them and selecting every pod.
+func ParsePodFieldSelector(selector string) (fields.Selector, error) {
+	parsed, err := fields.ParseSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, requirement := range parsed.Requirements() {
+		if !podFieldLabels[requirement.Field] {
+			return nil, fmt.Errorf("field label not supported: %s", requirement.Field)
+		}
+	}
+	return parsed, nil
+}
+
+// PodSelectableFields returns the values of the fields pods can be selected by
+func PodSelectableFields(pod *corev1.Pod) fields.Set {
+	return fields.Set{
+		"metadata.name":            pod.Name,
+		"metadata.namespace":       pod.Namespace,
+		"spec.nodeName":            pod.Spec.NodeName,
+		"spec.restartPolicy":       string(pod.Spec.RestartPolicy),
+		"spec.schedulerName":       pod.Spec.SchedulerName,
+		"spec.serviceAccountName":  pod.Spec.ServiceAccountName,
+		"spec.hostNetwork":         strconv.FormatBool(pod.Spec.HostNetwork),
+		"status.phase":             string(pod.Status.Phase),
+		"status.podIP":             pod.Status.PodIP,
+		"status.nominatedNodeName": pod.Status.NominatedNodeName,
+	}
+}
+
+// matchesFieldSelector reports whether a pod has the fields of a parsed field selector
+func matchesFieldSelector(pod *corev1.Pod, selector fields.Selector) bool {
+	return selector.Matches(PodSelectableFields(pod))
+}
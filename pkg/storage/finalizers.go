@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// finalizersAnnotation records the finalizers a pod was created with on its container
+const finalizersAnnotation = "podkube.io/finalizers"
+
+// uidAnnotation records the UID of a pod whose container was recreated by an update
+const uidAnnotation = "podkube.io/uid"
+
+// podMetadata is the part of a pod's metadata that changes after creation, which container
+// labels and annotations cannot store
+type podMetadata struct {
+	Finalizers        []string          `json:"finalizers,omitempty"`
+	DeletionTimestamp *metav1.Time      `json:"deletionTimestamp,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`      // Replace the container labels when set
+	Annotations       map[string]string `json:"annotations,omitempty"` // Replace the user annotations when set
+	Generation        int               `json:"generation"`            // Bumped on every change and appended to the resourceVersion
+}
+
+// metadataStore keeps the mutable metadata of pods by pod UID, which is stable across
+// restarts as it derives from the container ID. It is saved to a state file on every change
+// when the state directory is set; otherwise it is lost when the adapter restarts, and pods
+// get back the finalizers, labels and annotations they were created with.
+type metadataStore struct {
+	mu   sync.Mutex
+	file StateFile
+	pods map[types.UID]*podMetadata
+	// changes wakes up the watches of pods on every change
+	changes changeBroadcast
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{
+		pods: map[types.UID]*podMetadata{},
+	}
+}
+
+// load reads the state file, which does not exist before the first change
+func (s *metadataStore) load(file StateFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.file = file
+	s.pods = map[types.UID]*podMetadata{}
+	return file.Load(&s.pods)
+}
+
+// save writes the state file and wakes up the watches; the caller holds s.mu. A failure is
+// only logged: the change is served from memory and saved again with the next one.
+func (s *metadataStore) save() {
+	if err := s.file.Save(s.pods); err != nil {
+		klog.Errorf("Failed to save pod metadata: %v", err)
+	}
+	s.changes.notify()
+}
+
+// SetPodStateFile loads the finalizers, label and annotation changes and deletions of pods
+// from path, where their changes are then saved, encrypted as encryption sets for pods; an
+// empty path keeps them in memory
+func (c *Cluster) SetPodStateFile(path string, encryption *Encryption) error {
+	return c.metadata.load(StateFile{Path: path, Resource: "pods", Encryption: encryption})
+}
+
+// decorate applies the stored metadata to pod
+func (s *metadataStore) decorate(pod *corev1.Pod) {
+	if pod == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata, ok := s.pods[pod.UID]
+	if !ok {
+		return
+	}
+	pod.Finalizers = append([]string(nil), metadata.Finalizers...)
+	pod.DeletionTimestamp = metadata.DeletionTimestamp
+	if metadata.DeletionTimestamp != nil {
+		gracePeriod := int64(0)
+		pod.DeletionGracePeriodSeconds = &gracePeriod
+	}
+	if metadata.Labels != nil {
+		pod.Labels = make(map[string]string, len(metadata.Labels))
+		for key, value := range metadata.Labels {
+			pod.Labels[key] = value
+		}
+	}
+	if metadata.Annotations != nil {
+		pod.Annotations = mergeUserAnnotations(pod.Annotations, metadata.Annotations)
+	}
+	pod.ResourceVersion += "-" + strconv.Itoa(metadata.Generation)
+}
+
+// entry returns the stored metadata of pod, created from its current finalizers
+func (s *metadataStore) entry(pod *corev1.Pod) *podMetadata {
+	metadata, ok := s.pods[pod.UID]
+	if !ok {
+		metadata = &podMetadata{Finalizers: pod.Finalizers}
+		s.pods[pod.UID] = metadata
+	}
+	return metadata
+}
+
+// setFinalizers replaces the finalizers of pod
+func (s *metadataStore) setFinalizers(pod *corev1.Pod, finalizers []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := s.entry(pod)
+	metadata.Finalizers = append([]string(nil), finalizers...)
+	metadata.Generation++
+	s.save()
+}
+
+// setLabels replaces the labels of pod
+func (s *metadataStore) setLabels(pod *corev1.Pod, labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := s.entry(pod)
+	metadata.Labels = make(map[string]string, len(labels))
+	for key, value := range labels {
+		metadata.Labels[key] = value
+	}
+	metadata.Generation++
+	s.save()
+}
+
+// setAnnotations replaces the user annotations of pod
+func (s *metadataStore) setAnnotations(pod *corev1.Pod, annotations map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := s.entry(pod)
+	metadata.Annotations = annotations
+	metadata.Generation++
+	s.save()
+}
+
+// resetLabelsAndAnnotations drops the label and annotation changes of a pod whose container
+// was recreated with them
+func (s *metadataStore) resetLabelsAndAnnotations(pod *corev1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if metadata, ok := s.pods[pod.UID]; ok {
+		metadata.Labels = nil
+		metadata.Annotations = nil
+		metadata.Generation++
+		s.save()
+	}
+}
+
+// markDeleted sets the deletionTimestamp of pod, if not already set
+func (s *metadataStore) markDeleted(pod *corev1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metadata := s.entry(pod)
+	if metadata.DeletionTimestamp == nil {
+		now := metav1.Now()
+		metadata.DeletionTimestamp = &now
+		metadata.Generation++
+		s.save()
+	}
+}
+
+// forget drops the stored metadata of a removed pod
+func (s *metadataStore) forget(uid types.UID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pods[uid]; ok {
+		delete(s.pods, uid)
+		s.save()
+	}
+}
+
+// prune drops the stored metadata of pods that no longer exist
+func (s *metadataStore) prune(pods []corev1.Pod) {
+	existing := make(map[types.UID]bool, len(pods))
+	for i := range pods {
+		existing[pods[i].UID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pruned := false
+	for uid := range s.pods {
+		if !existing[uid] {
+			delete(s.pods, uid)
+			pruned = true
+		}
+	}
+	if pruned {
+		s.save()
+	}
+}
+
+// encodeFinalizers returns the finalizersAnnotation value of a pod's finalizers
+func encodeFinalizers(finalizers []string) string {
+	return strings.Join(finalizers, ",")
+}
+
+// restoreUID gives a pod whose container was recreated by an update its original UID back
+func restoreUID(pod *corev1.Pod) {
+	if uid, ok := pod.Annotations[uidAnnotation]; ok {
+		delete(pod.Annotations, uidAnnotation)
+		pod.UID = types.UID(uid)
+	}
+}
+
+// restoreFinalizers moves the finalizers recorded in the container annotations to the pod
+func restoreFinalizers(pod *corev1.Pod) {
+	value, ok := pod.Annotations[finalizersAnnotation]
+	if !ok {
+		return
+	}
+	delete(pod.Annotations, finalizersAnnotation)
+	if value != "" {
+		pod.Finalizers = strings.Split(value, ",")
+	}
+}
+
+// addedFinalizers returns the finalizers of updated that are not in current
+func addedFinalizers(current, updated []string) []string {
+	known := make(map[string]bool, len(current))
+	for _, finalizer := range current {
+		known[finalizer] = true
+	}
+	var added []string
+	for _, finalizer := range updated {
+		if !known[finalizer] {
+			added = append(added, finalizer)
+		}
+	}
+	return added
+}
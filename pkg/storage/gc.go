@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// exitedNamespace holds the pods of exited containers
+const exitedNamespace = "containers-exited"
+
+// gcInterval is how often exited containers are checked for garbage collection
+const gcInterval = time.Minute
+
+// gcPolicy decides which exited containers are removed; zero values disable a limit
+type gcPolicy struct {
+	exitedAfter time.Duration // Age after exiting at which a container is removed
+	maxExited   int           // Number of exited containers kept per node
+}
+
+// garbageCollector holds the garbage collection policy, which can change at runtime
+type garbageCollector struct {
+	policy atomic.Pointer[gcPolicy]
+}
+
+// SetGarbageCollection configures the removal of exited containers (the pods of the
+// containers-exited namespace): those that exited more than exitedAfter ago, and on each
+// node the oldest beyond the maxExited most recent ones. Zero disables either limit.
+func (c *Cluster) SetGarbageCollection(exitedAfter time.Duration, maxExited int) {
+	c.gc.policy.Store(&gcPolicy{
+		exitedAfter: exitedAfter,
+		maxExited:   maxExited,
+	})
+}
+
+// RunGarbageCollector removes exited containers according to the garbage collection policy,
+// every gcInterval until ctx is cancelled. Watches report the removed pods as DELETED.
+func (c *Cluster) RunGarbageCollector(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		c.collectGarbage(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectGarbage removes the exited containers selected by the policy on every node
+func (c *Cluster) collectGarbage(ctx context.Context) {
+	policy := c.gc.policy.Load()
+	if policy == nil || (policy.exitedAfter <= 0 && policy.maxExited <= 0) {
+		return
+	}
+
+	c.forEachNode(func(node *Node) {
+		podList, err := node.Storage.List(ctx, exitedNamespace, "", "")
+		if err != nil {
+			klog.V(2).Infof("Skipping garbage collection on node %s: %v", node.Name, err)
+			return
+		}
+
+		for _, pod := range policy.expired(podList.Items, time.Now()) {
+			c.metadata.decorate(pod)
+			if len(pod.Finalizers) > 0 {
+				klog.V(2).Infof("Not collecting exited pod %s on node %s, it has finalizers %v", pod.Name, node.Name, pod.Finalizers)
+				continue
+			}
+			// Like deletions, collection leaves the containers of systemd units to their unit
+			if unit := pod.Annotations[SystemdUnitAnnotation]; unit != "" && !c.allowSystemdDelete.Load() {
+				klog.V(2).Infof("Not collecting exited pod %s on node %s, it is managed by systemd unit %s", pod.Name, node.Name, unit)
+				continue
+			}
+			if err := node.Storage.Delete(ctx, "", pod.Name); err != nil {
+				klog.Warningf("Failed to garbage collect exited pod %s on node %s: %v", pod.Name, node.Name, err)
+				continue
+			}
+			c.metadata.forget(pod.UID)
+			klog.Infof("Garbage collected exited pod %s on node %s (exited %v ago)", pod.Name, node.Name, time.Since(exitedAt(pod)).Round(time.Second))
+		}
+	})
+}
+
+// expired returns the exited pods to remove, oldest first
+func (p *gcPolicy) expired(pods []corev1.Pod, now time.Time) []*corev1.Pod {
+	sorted := make([]*corev1.Pod, len(pods))
+	for i := range pods {
+		sorted[i] = &pods[i]
+	}
+	// Most recently exited first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return exitedAt(sorted[i]).After(exitedAt(sorted[j]))
+	})
+
+	var expired []*corev1.Pod
+	for i := len(sorted) - 1; i >= 0; i-- {
+		pod := sorted[i]
+		tooMany := p.maxExited > 0 && i >= p.maxExited
+		tooOld := p.exitedAfter > 0 && now.Sub(exitedAt(pod)) > p.exitedAfter
+		if tooMany || tooOld {
+			expired = append(expired, pod)
+		}
+	}
+	return expired
+}
+
+// exitedAt returns when the container of an exited pod finished, or its creation time
+// when unknown
+func exitedAt(pod *corev1.Pod) time.Time {
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil && !terminated.FinishedAt.IsZero() {
+			return terminated.FinishedAt.Time
+		}
+	}
+	return pod.CreationTimestamp.Time
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pingCacheTTL is how long the result of a podman connectivity check is reused
+const pingCacheTTL = 5 * time.Second
+
+// pingCache remembers the last podman connectivity check
+type pingCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	version   string
+	err       error
+}
+
+// Ping checks that podman is reachable by running podman info. The result is cached
+// for a few seconds so frequent readiness probes don't spawn a process each time.
+func (ps *PodStorage) Ping(ctx context.Context) (string, error) {
+	ps.ping.mu.Lock()
+	defer ps.ping.mu.Unlock()
+
+	if !ps.ping.checkedAt.IsZero() && time.Since(ps.ping.checkedAt) < pingCacheTTL {
+		return ps.ping.version, ps.ping.err
+	}
+
+	cmd, cancel := ps.podmanCommand(ctx, "info", "--format", "{{.Version.Version}}")
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		// Don't cache a check cut short by the caller going away
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		err = fmt.Errorf("podman info failed: %v", err)
+	}
+
+	ps.ping.checkedAt = time.Now()
+	ps.ping.version = strings.TrimSpace(string(output))
+	ps.ping.err = err
+	return ps.ping.version, err
+}
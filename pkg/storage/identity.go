@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Labels naming the pod of a container, set by kubelet on the containers it runs through a
+// CRI runtime (cri-dockerd, CRI-O), and by tools that mimic it
+const (
+	podNameLabel       = "io.kubernetes.pod.name"
+	podNamespaceLabel  = "io.kubernetes.pod.namespace"
+	podUIDLabel        = "io.kubernetes.pod.uid"
+	containerNameLabel = "io.kubernetes.container.name"
+
+	// dockerTypeLabel tells cri-dockerd sandbox (pause) containers from the pod containers
+	dockerTypeLabel = "io.kubernetes.docker.type"
+)
+
+// Labels set by docker compose and podman-compose on the containers of a compose project
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeNumberLabel  = "com.docker.compose.container-number"
+)
+
+// podIdentity is the pod a container belongs to, when it was created as part of a
+// Kubernetes pod rather than as a standalone container
+type podIdentity struct {
+	Namespace string // Empty for the storage namespace
+	Name      string
+	Container string
+	UID       types.UID
+}
+
+// containerIdentity returns the pod a container belongs to, from its io.kubernetes.* labels
+// or annotations, from its compose project, or from its podman pod when it was created by
+// podman kube play. Standalone containers, which are pods on their own, have no identity.
+func containerIdentity(container *PodmanContainer) (podIdentity, bool) {
+	lookup := func(key string) string {
+		if value := container.Labels[key]; value != "" {
+			return value
+		}
+		return container.Annotations[key]
+	}
+
+	if name := lookup(podNameLabel); name != "" {
+		identity := podIdentity{
+			Namespace: lookup(podNamespaceLabel),
+			Name:      name,
+			Container: lookup(containerNameLabel),
+			UID:       types.UID(lookup(podUIDLabel)),
+		}
+		if identity.Container == "" {
+			identity.Container = containerPodName(container)
+		}
+		return identity, true
+	}
+
+	// A compose project is a pod with a container per service, which podman-compose may
+	// also have put in a podman pod
+	if project := container.Labels[composeProjectLabel]; composeName(project) != "" {
+		name := container.Labels[composeServiceLabel]
+		if composeName(name) == "" {
+			name = containerPodName(container)
+		} else if number := container.Labels[composeNumberLabel]; number != "" && number != "1" {
+			// Scaled services run a container per replica
+			name += "-" + number
+		}
+		return podIdentity{
+			Name:      composeName(project),
+			Container: composeName(name),
+			UID:       uidFromID("compose", project),
+		}, true
+	}
+
+	// podman kube play names the containers of a pod <pod>-<container>
+	if container.Pod != "" && container.PodName != "" {
+		return podIdentity{
+			Name:      container.PodName,
+			Container: strings.TrimPrefix(containerPodName(container), container.PodName+"-"),
+			UID:       uidFromID("pod", container.Pod),
+		}, true
+	}
+
+	return podIdentity{}, false
+}
+
+// composeName returns the DNS-1123 label standing for a compose project or service name as a
+// pod or container name: compose allows uppercase letters, underscores and dots, which are
+// lowercased and replaced with dashes
+func composeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = name[:validation.DNS1123LabelMaxLength]
+	}
+	return strings.Trim(name, "-")
+}
+
+// isInfraContainer reports whether a container only holds the namespaces of a pod: the
+// infra container of a podman pod or the sandbox container of cri-dockerd
+func isInfraContainer(container *PodmanContainer) bool {
+	return container.IsInfra || container.Labels[dockerTypeLabel] == "podsandbox"
+}
+
+// applyIdentity renames the pod of a single container after the pod the container belongs to
+func applyIdentity(pod *corev1.Pod, identity podIdentity, defaultNamespace string) {
+	pod.Name = identity.Name
+	pod.Namespace = identity.Namespace
+	if pod.Namespace == "" {
+		pod.Namespace = defaultNamespace
+	}
+	if identity.UID != "" {
+		pod.UID = identity.UID
+	}
+	if len(pod.Spec.Containers) == 1 {
+		pod.Spec.Containers[0].Name = identity.Container
+	}
+	if len(pod.Status.ContainerStatuses) == 1 {
+		pod.Status.ContainerStatuses[0].Name = identity.Container
+		pod.Status.Conditions = podConditions(pod, pod.CreationTimestamp, readinessTransition(pod))
+	}
+}
+
+// groupPods merges the pods of containers belonging to the same pod (same namespace and
+// name) into a single pod listing all their containers, keeping the order of first appearance
+func groupPods(pods []*corev1.Pod) []*corev1.Pod {
+	var grouped []*corev1.Pod
+	index := map[string]*corev1.Pod{}
+	for _, pod := range pods {
+		if pod == nil {
+			continue
+		}
+		key := pod.Namespace + "/" + pod.Name
+		existing, ok := index[key]
+		if !ok {
+			index[key] = pod
+			grouped = append(grouped, pod)
+			continue
+		}
+		mergePod(existing, pod)
+	}
+	return grouped
+}
+
+// mergePod adds the containers of other to pod, and derives the pod phase and readiness
+// from all of them. Sidecars count for readiness, but the phase is that of the containers.
+func mergePod(pod, other *corev1.Pod) {
+	pod.Spec.Containers = append(pod.Spec.Containers, other.Spec.Containers...)
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, other.Status.ContainerStatuses...)
+	if len(other.Spec.InitContainers) > 0 {
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, other.Spec.InitContainers...)
+		pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, other.Status.InitContainerStatuses...)
+		sortInitContainers(pod)
+	}
+	sort.SliceStable(pod.Spec.Containers, func(i, j int) bool {
+		return pod.Spec.Containers[i].Name < pod.Spec.Containers[j].Name
+	})
+	sort.SliceStable(pod.Status.ContainerStatuses, func(i, j int) bool {
+		return pod.Status.ContainerStatuses[i].Name < pod.Status.ContainerStatuses[j].Name
+	})
+
+	for key, value := range other.Labels {
+		if _, ok := pod.Labels[key]; !ok {
+			if pod.Labels == nil {
+				pod.Labels = map[string]string{}
+			}
+			pod.Labels[key] = value
+		}
+	}
+	if other.Annotations[pausedAnnotation] == "true" {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[pausedAnnotation] = "true"
+	}
+	transition := readinessTransition(pod)
+	if otherTransition := readinessTransition(other); transition.Before(&otherTransition) {
+		transition = otherTransition
+	}
+	if other.CreationTimestamp.Before(&pod.CreationTimestamp) {
+		pod.CreationTimestamp = other.CreationTimestamp
+	}
+	if other.Status.StartTime != nil && (pod.Status.StartTime == nil || other.Status.StartTime.Before(pod.Status.StartTime)) {
+		pod.Status.StartTime = other.Status.StartTime
+	}
+
+	switch {
+	case len(other.Spec.Containers) == 0:
+		// A sidecar keeps the phase of the containers
+	case len(pod.Spec.Containers) == len(other.Spec.Containers):
+		// The pod only had sidecars so far
+		pod.Status.Phase = other.Status.Phase
+	default:
+		pod.Status.Phase = combinedPhase(pod.Status.Phase, other.Status.Phase)
+	}
+	pod.Status.QOSClass = podQOSClass(&pod.Spec)
+	pod.Status.Conditions = podConditions(pod, pod.CreationTimestamp, transition)
+}
+
+// combinedPhase returns the phase of a pod from the phases of two of its containers:
+// running while any container runs, failed if any failed, succeeded when all succeeded
+func combinedPhase(a, b corev1.PodPhase) corev1.PodPhase {
+	for _, phase := range []corev1.PodPhase{corev1.PodRunning, corev1.PodPending, corev1.PodUnknown, corev1.PodFailed} {
+		if a == phase || b == phase {
+			return phase
+		}
+	}
+	return corev1.PodSucceeded
+}
+
+// allContainersReady reports whether every container and sidecar of the pod is ready
+func allContainersReady(pod *corev1.Pod) bool {
+	for _, status := range append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		if !status.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+// podContainers returns the containers making up the named pod: the standalone container
+// with that name, otherwise the containers whose identity names the pod
+func podContainers(containers []PodmanContainer, namespace, name, defaultNamespace string) []*PodmanContainer {
+	var members []*PodmanContainer
+	for i := range containers {
+		container := &containers[i]
+		if isInfraContainer(container) {
+			continue
+		}
+		identity, ok := containerIdentity(container)
+		if !ok {
+			if (containerPodName(container) == name || container.Id == name) && (namespace == "" || namespace == defaultNamespace) {
+				return []*PodmanContainer{container}
+			}
+			continue
+		}
+		identityNamespace := identity.Namespace
+		if identityNamespace == "" {
+			identityNamespace = defaultNamespace
+		}
+		if identity.Name == name && (namespace == "" || namespace == identityNamespace) {
+			members = append(members, container)
+		}
+	}
+	return members
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// PodmanAPIVersion is the group version images and networks are served as
+const PodmanAPIVersion = "podman.io/v1"
+
+// imageNameLength is the length of the image ID prefix naming an image, as the runtime CLIs
+// abbreviate image IDs
+const imageNameLength = 12
+
+// ErrImageInUse is returned when removing an image that containers still use
+var ErrImageInUse = errors.New("image is in use by a container")
+
+// Image is an image of the nodes' image stores
+type Image struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ImageSpec   `json:"spec,omitempty"`
+	Status            ImageStatus `json:"status,omitempty"`
+}
+
+// ImageSpec is the image to pull when an Image is created
+type ImageSpec struct {
+	Image string `json:"image,omitempty"` // Image reference, e.g. docker.io/library/nginx:latest
+}
+
+// ImageStatus describes an image of the image stores
+type ImageStatus struct {
+	ID          string   `json:"id,omitempty"`
+	RepoTags    []string `json:"repoTags,omitempty"`
+	RepoDigests []string `json:"repoDigests,omitempty"`
+	Size        int64    `json:"size,omitempty"`  // In bytes
+	Nodes       []string `json:"nodes,omitempty"` // Nodes whose image store has the image
+}
+
+// ImageList is a list of images
+type ImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Image `json:"items"`
+}
+
+// DeepCopy returns a copy of the image
+func (in *Image) DeepCopy() *Image {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Status.RepoTags = append([]string(nil), in.Status.RepoTags...)
+	out.Status.RepoDigests = append([]string(nil), in.Status.RepoDigests...)
+	out.Status.Nodes = append([]string(nil), in.Status.Nodes...)
+	return &out
+}
+
+// DeepCopyObject implements runtime.Object, so images can be decoded from request bodies
+func (in *Image) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// runtimeImage is an image in podman and docker image inspect output, which share these fields
+type runtimeImage struct {
+	Id          string    `json:"Id"`
+	RepoTags    []string  `json:"RepoTags"`
+	RepoDigests []string  `json:"RepoDigests"`
+	Size        int64     `json:"Size"`
+	Created     time.Time `json:"Created"`
+}
+
+// toImage converts an inspected image to an Image named after its abbreviated ID
+func (ri *runtimeImage) toImage() Image {
+	id := strings.TrimPrefix(ri.Id, "sha256:")
+	name := id
+	if len(name) > imageNameLength {
+		name = name[:imageNameLength]
+	}
+
+	image := Image{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Image",
+			APIVersion: PodmanAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               uidFromID("image", id),
+			CreationTimestamp: metav1.NewTime(ri.Created),
+		},
+		Status: ImageStatus{
+			ID:          id,
+			RepoTags:    ri.RepoTags,
+			RepoDigests: ri.RepoDigests,
+			Size:        ri.Size,
+		},
+	}
+	if len(ri.RepoTags) > 0 {
+		image.Spec.Image = ri.RepoTags[0]
+	}
+	return image
+}
+
+// commandFunc builds a runtime CLI command, like PodStorage.podmanCommand and DockerStorage.dockerCommand
+type commandFunc func(ctx context.Context, args ...string) (*exec.Cmd, context.CancelFunc)
+
+// listImages returns the images of a runtime's image store
+func listImages(ctx context.Context, command commandFunc) ([]Image, error) {
+	cmd, cancel := command(ctx, "images", "--quiet", "--no-trunc")
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %v", err)
+	}
+
+	// Images with several tags are listed once per tag
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range strings.Fields(string(output)) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []Image{}, nil
+	}
+	return inspectImages(ctx, command, ids...)
+}
+
+// inspectImages returns the named images
+func inspectImages(ctx context.Context, command commandFunc, references ...string) ([]Image, error) {
+	cmd, cancel := command(ctx, append([]string{"image", "inspect"}, references...)...)
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect images: %v", err)
+	}
+
+	var inspected []runtimeImage
+	if err := json.Unmarshal(output, &inspected); err != nil {
+		return nil, fmt.Errorf("failed to parse image inspect output: %v", err)
+	}
+	images := make([]Image, len(inspected))
+	for i := range inspected {
+		images[i] = inspected[i].toImage()
+	}
+	return images, nil
+}
+
+// pullImage pulls an image into a runtime's image store and returns it
+func pullImage(ctx context.Context, command commandFunc, reference string) (*Image, error) {
+	klog.Infof("Pulling image %s", reference)
+	cmd, cancel := command(ctx, "pull", "--quiet", reference)
+	defer cancel()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to pull image %s: %v: %s", reference, err, strings.TrimSpace(string(output)))
+	}
+
+	images, err := inspectImages(ctx, command, reference)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("image %s not found after pulling it", reference)
+	}
+	return &images[0], nil
+}
+
+// removeImage removes an image from a runtime's image store, failing with ErrImageInUse
+// when containers use it
+func removeImage(ctx context.Context, command commandFunc, id string) error {
+	cmd, cancel := command(ctx, "rmi", id)
+	defer cancel()
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if strings.Contains(message, "in use") || strings.Contains(message, "being used") {
+			return fmt.Errorf("%w: %s", ErrImageInUse, message)
+		}
+		return fmt.Errorf("failed to remove image %s: %v: %s", id, err, message)
+	}
+
+	klog.Infof("Removed image %s", id)
+	return nil
+}
+
+// ListImages returns the images of the podman image store
+func (ps *PodStorage) ListImages(ctx context.Context) ([]Image, error) {
+	return listImages(ctx, ps.podmanCommand)
+}
+
+// PullImage pulls an image with podman pull
+func (ps *PodStorage) PullImage(ctx context.Context, reference string) (*Image, error) {
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+	return pullImage(ctx, ps.podmanCommand, reference)
+}
+
+// RemoveImage removes an image with podman rmi
+func (ps *PodStorage) RemoveImage(ctx context.Context, id string) error {
+	if err := ps.checkBackend(); err != nil {
+		return err
+	}
+	return removeImage(ctx, ps.podmanCommand, id)
+}
+
+// ListImages returns the images of the docker image store
+func (ds *DockerStorage) ListImages(ctx context.Context) ([]Image, error) {
+	return listImages(ctx, ds.dockerCommand)
+}
+
+// PullImage pulls an image with docker pull
+func (ds *DockerStorage) PullImage(ctx context.Context, reference string) (*Image, error) {
+	if !ds.breaker.allow() {
+		return nil, ds.breaker.unavailableError()
+	}
+	return pullImage(ctx, ds.dockerCommand, reference)
+}
+
+// RemoveImage removes an image with docker rmi
+func (ds *DockerStorage) RemoveImage(ctx context.Context, id string) error {
+	if !ds.breaker.allow() {
+		return ds.breaker.unavailableError()
+	}
+	return removeImage(ctx, ds.dockerCommand, id)
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrKubePlayUnsupported is returned when creating a pod that needs podman kube play on a
+// runtime without it
+var ErrKubePlayUnsupported = errors.New("pods with several containers or fields podman run cannot express are only supported by the podman runtime")
+
+// kubePlayManifest serializes the pod podman kube play creates: the pod as submitted, with its
+// sidecars as containers, the metadata podKube keeps on containers (escaped annotations,
+// finalizers, sidecars) as annotations, which kube play sets on every container of the pod,
+// and the seccomp and AppArmor profiles of the securityContext fields as the annotations
+// kube play reads
+func kubePlayManifest(pod *corev1.Pod) ([]byte, error) {
+	manifest := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   pod.Name,
+			Labels: pod.Labels,
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	// kube play rejects a nodeName it cannot schedule on; the pod is already on this node
+	manifest.Spec.NodeName = ""
+
+	// kube play reads the profiles from annotations, and the sysctls are recorded as one
+	annotations := profileAnnotations(pod)
+	if sc := pod.Spec.SecurityContext; sc != nil && len(sc.Sysctls) > 0 {
+		annotations[sysctlsAnnotation] = encodeSysctls(sc.Sysctls)
+	}
+	if sidecars := playSidecars(&manifest.Spec); len(sidecars) > 0 {
+		annotations[sidecarsAnnotation] = strings.Join(sidecars, ",")
+	}
+	if len(pod.Annotations) > 0 || len(pod.Finalizers) > 0 || len(annotations) > 0 {
+		manifest.Annotations = map[string]string{}
+	}
+	for key, value := range pod.Annotations {
+		manifest.Annotations[containerAnnotationKey(key)] = value
+	}
+	for key, value := range annotations {
+		manifest.Annotations[key] = value
+	}
+	if len(pod.Finalizers) > 0 {
+		manifest.Annotations[finalizersAnnotation] = encodeFinalizers(pod.Finalizers)
+	}
+
+	data, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize pod %s for podman kube play: %v", pod.Name, err)
+	}
+	return data, nil
+}
+
+// playPod creates a pod with podman kube play, for pods containerRunArgs cannot express.
+// The resulting podman pod is adopted through the identity of its containers.
+func (ps *PodStorage) playPod(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	manifest, err := kubePlayManifest(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// podman reads the manifest from a file, on the client side for remote connections
+	file, err := os.CreateTemp("", "podkube-play-*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kube play manifest: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(manifest)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write kube play manifest: %v", err)
+	}
+
+	args := []string{"kube", "play"}
+	if network := pod.Annotations[networkAnnotation]; network != "" {
+		args = append(args, "--network", network)
+	}
+	args = append(args, file.Name())
+
+	cmd, cancel := ps.podmanCommand(ctx, args...)
+	defer cancel()
+	output, err := cmd.CombinedOutput()
+	ps.cache.invalidate()
+	if err != nil {
+		return nil, ps.pulls.failed(pod, string(output), fmt.Errorf("failed to play pod %s: %v: %s", pod.Name, err, strings.TrimSpace(string(output))))
+	}
+	ps.pulls.succeeded(pod)
+	klog.Infof("Created pod %s with podman kube play (%d containers)", pod.Name, len(pod.Spec.Containers))
+	ps.keepSidecarsRunning(ctx, pod)
+
+	created, err := ps.Get(ctx, pod.Namespace, pod.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get played pod: %v", err)
+	}
+	return created, nil
+}
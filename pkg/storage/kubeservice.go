@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// KubernetesServiceHost is the host in-cluster clients reach the API server at, as the
+// KUBERNETES_SERVICE_HOST of the containers of pods
+const KubernetesServiceHost = "kubernetes.default.svc"
+
+// KubernetesServiceHostnames are the names of the kubernetes service of the default namespace,
+// which resolve to the host running podKube in the containers of pods
+var KubernetesServiceHostnames = []string{
+	"kubernetes",
+	"kubernetes.default",
+	KubernetesServiceHost,
+	KubernetesServiceHost + ".cluster.local",
+}
+
+// hostGateway is the address podman and docker resolve to the host in --add-host
+const hostGateway = "host-gateway"
+
+// SetKubernetesService sets the port of the API server that the containers of created pods
+// reach through the kubernetes service, 0 to give them neither its environment nor its names
+func (c *Cluster) SetKubernetesService(port int) {
+	c.kubernetesServicePort.Store(int32(port))
+}
+
+// withKubernetesService returns a pod whose containers get the environment of the kubernetes
+// service, as the kubelet sets it, and resolve its names to the host, so that clients such as
+// client-go find the API server as in a cluster. Variables and host aliases the pod sets are
+// kept.
+func (c *Cluster) withKubernetesService(pod *corev1.Pod) *corev1.Pod {
+	port := int(c.kubernetesServicePort.Load())
+	if port == 0 {
+		return pod
+	}
+
+	pod = pod.DeepCopy()
+	address := fmt.Sprintf("tcp://%s:%d", KubernetesServiceHost, port)
+	prefix := fmt.Sprintf("KUBERNETES_PORT_%d_TCP", port)
+	env := []corev1.EnvVar{
+		{Name: "KUBERNETES_SERVICE_HOST", Value: KubernetesServiceHost},
+		{Name: "KUBERNETES_SERVICE_PORT", Value: strconv.Itoa(port)},
+		{Name: "KUBERNETES_SERVICE_PORT_HTTPS", Value: strconv.Itoa(port)},
+		{Name: "KUBERNETES_PORT", Value: address},
+		{Name: prefix, Value: address},
+		{Name: prefix + "_PROTO", Value: "tcp"},
+		{Name: prefix + "_PORT", Value: strconv.Itoa(port)},
+		{Name: prefix + "_ADDR", Value: KubernetesServiceHost},
+	}
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			container := &containers[i]
+			for _, variable := range env {
+				if !slices.ContainsFunc(container.Env, func(existing corev1.EnvVar) bool { return existing.Name == variable.Name }) {
+					container.Env = append(container.Env, variable)
+				}
+			}
+		}
+	}
+
+	var hostnames []string
+	for _, hostname := range KubernetesServiceHostnames {
+		if !slices.ContainsFunc(pod.Spec.HostAliases, func(alias corev1.HostAlias) bool { return slices.Contains(alias.Hostnames, hostname) }) {
+			hostnames = append(hostnames, hostname)
+		}
+	}
+	if len(hostnames) > 0 {
+		pod.Spec.HostAliases = append(pod.Spec.HostAliases, corev1.HostAlias{IP: hostGateway, Hostnames: hostnames})
+	}
+	return pod
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// NodeLeaseNamespace holds the leases the nodes renew while they are healthy
+const NodeLeaseNamespace = "kube-node-lease"
+
+const (
+	// nodeLeaseDuration is how long a node lease is valid after its last renewal, as set by
+	// the kubelet
+	nodeLeaseDuration int32 = 40
+	// leaseRenewInterval is how often the leases of healthy nodes are renewed, a quarter of
+	// their duration like the kubelet
+	leaseRenewInterval = 10 * time.Second
+)
+
+// nodeLeases holds the lease of each node, by node name. A node gets its lease once its
+// runtime is first reachable; the lease is then renewed while the runtime stays reachable
+// and expires when it is not, which is how controllers and monitoring tell node health.
+type nodeLeases struct {
+	mu       sync.Mutex
+	leases   map[string]*coordinationv1.Lease
+	revision int // Bumped on every renewal, as the resourceVersion of the renewed lease
+}
+
+// RunLeaseRenewer renews the leases of the healthy nodes every leaseRenewInterval until ctx
+// is cancelled
+func (c *Cluster) RunLeaseRenewer(ctx context.Context) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		c.renewLeases(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLeases renews the lease of every node whose runtime is reachable
+func (c *Cluster) renewLeases(ctx context.Context) {
+	c.forEachNode(func(node *Node) {
+		_, err := node.Storage.Ping(ctx)
+		if err == nil {
+			if healthy, breakerErr := node.Storage.BackendStatus(); !healthy {
+				err = breakerErr
+			}
+		}
+		if err != nil {
+			klog.V(2).Infof("Not renewing the lease of node %s: %v", node.Name, err)
+			return
+		}
+		c.leases.renew(node, time.Now())
+	})
+}
+
+// renew renews the lease of a node, creating it on its first renewal
+func (l *nodeLeases) renew(node *Node, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.leases == nil {
+		l.leases = map[string]*coordinationv1.Lease{}
+	}
+	lease, ok := l.leases[node.Name]
+	if !ok {
+		holder, duration := node.Name, nodeLeaseDuration
+		acquired := metav1.NewMicroTime(now)
+		lease = &coordinationv1.Lease{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Lease",
+				APIVersion: "coordination.k8s.io/v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              node.Name,
+				Namespace:         NodeLeaseNamespace,
+				CreationTimestamp: metav1.NewTime(now),
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &acquired,
+			},
+		}
+		l.leases[node.Name] = lease
+	}
+
+	l.revision++
+	renewed := metav1.NewMicroTime(now)
+	lease.Spec.RenewTime = &renewed
+	lease.ResourceVersion = strconv.Itoa(l.revision)
+}
+
+// ListLeases returns the node leases, which are all in NodeLeaseNamespace; an empty namespace
+// lists them too
+func (c *Cluster) ListLeases(namespace string) *coordinationv1.LeaseList {
+	c.leases.mu.Lock()
+	defer c.leases.mu.Unlock()
+
+	list := &coordinationv1.LeaseList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "LeaseList",
+			APIVersion: "coordination.k8s.io/v1",
+		},
+		ListMeta: metav1.ListMeta{ResourceVersion: strconv.Itoa(c.leases.revision)},
+		Items:    []coordinationv1.Lease{},
+	}
+	if namespace != "" && namespace != NodeLeaseNamespace {
+		return list
+	}
+	for _, lease := range c.leases.leases {
+		list.Items = append(list.Items, *lease.DeepCopy())
+	}
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+	return list
+}
+
+// GetLease returns the lease of a node
+func (c *Cluster) GetLease(namespace, name string) (*coordinationv1.Lease, error) {
+	c.leases.mu.Lock()
+	defer c.leases.mu.Unlock()
+
+	lease, ok := c.leases.leases[name]
+	if namespace != NodeLeaseNamespace || !ok {
+		return nil, fmt.Errorf("lease %s/%s not found", namespace, name)
+	}
+	return lease.DeepCopy(), nil
+}
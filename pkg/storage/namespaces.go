@@ -1,11 +1,26 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
 )
 
+// RequesterAnnotation names the user who requested a project
+const RequesterAnnotation = "openshift.io/requester"
+
+// namespaceDeleteInterval is how often the pods of terminating namespaces are deleted
+const namespaceDeleteInterval = 5 * time.Second
+
 // OpenShift Project types (simplified)
 type Project struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -14,12 +29,27 @@ type Project struct {
 	Status            ProjectStatus `json:"status,omitempty"`
 }
 
+// DeepCopy returns a copy of the project
+func (in *Project) DeepCopy() *Project {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec.Finalizers = append([]string(nil), in.Spec.Finalizers...)
+	out.Status.Conditions = append([]corev1.NamespaceCondition(nil), in.Status.Conditions...)
+	return &out
+}
+
+// DeepCopyObject implements runtime.Object, so projects can be embedded in table rows
+func (in *Project) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
 type ProjectSpec struct {
 	Finalizers []string `json:"finalizers,omitempty"`
 }
 
 type ProjectStatus struct {
-	Phase string `json:"phase,omitempty"`
+	Phase      string                      `json:"phase,omitempty"`
+	Conditions []corev1.NamespaceCondition `json:"conditions,omitempty"`
 }
 
 type ProjectList struct {
@@ -39,7 +69,11 @@ func (ps *PodStorage) ListNamespaces() []string {
 
 // ListProjects returns the list of available namespaces as OpenShift projects
 func (ps *PodStorage) ListProjects() *ProjectList {
-	namespaces := ps.ListNamespaces()
+	return namespacesToProjects(ps.ListNamespaces())
+}
+
+// namespacesToProjects converts namespace names to OpenShift projects
+func namespacesToProjects(namespaces []string) *ProjectList {
 	var projects []Project
 
 	for _, ns := range namespaces {
@@ -49,7 +83,8 @@ func (ps *PodStorage) ListProjects() *ProjectList {
 				APIVersion: "project.openshift.io/v1",
 			},
 			ObjectMeta: metav1.ObjectMeta{
-				Name: ns,
+				Name:            ns,
+				ResourceVersion: "1",
 				Annotations: map[string]string{
 					"openshift.io/display-name": ns,
 					"openshift.io/description":  fmt.Sprintf("Project for %s", ns),
@@ -71,4 +106,311 @@ func (ps *PodStorage) ListProjects() *ProjectList {
 		},
 		Items: projects,
 	}
-}
\ No newline at end of file
+}
+
+// namespaceRecord is what is known of a namespace beyond its pods
+type namespaceRecord struct {
+	Labels            map[string]string           `json:"labels,omitempty"`
+	Annotations       map[string]string           `json:"annotations,omitempty"` // Replacing the default annotations when set
+	DeletionTimestamp *metav1.Time                `json:"deletionTimestamp,omitempty"`
+	Conditions        []corev1.NamespaceCondition `json:"conditions,omitempty"` // Progress of the deletion
+	Generation        int64                       `json:"generation,omitempty"` // Changes to the metadata and deletion
+}
+
+// resourceVersion returns the resourceVersion of the project of a namespace, which changes
+// with its metadata and deletion; the caller holds ns.mu
+func (ns *namespaceState) resourceVersion(name string) string {
+	var generation int64
+	if record, ok := ns.records[name]; ok {
+		generation = record.Generation
+	}
+	return strconv.FormatInt(generation+1, 10)
+}
+
+// namespaceState holds the labels, annotations and deletions of the namespaces, persisted to
+// a file so they survive restarts. The namespaces themselves always exist: deleting one
+// deletes its pods, and once they are gone the namespace is back, without its metadata.
+type namespaceState struct {
+	mu      sync.Mutex
+	file    StateFile
+	records map[string]*namespaceRecord
+}
+
+// load reads the state file, which does not exist before the first change
+func (ns *namespaceState) load(file StateFile) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	ns.file = file
+	ns.records = map[string]*namespaceRecord{}
+	return file.Load(&ns.records)
+}
+
+// save writes the state file; the caller holds ns.mu
+func (ns *namespaceState) save() error {
+	return ns.file.Save(ns.records)
+}
+
+// record returns the record of a namespace, creating it; the caller holds ns.mu
+func (ns *namespaceState) record(name string) *namespaceRecord {
+	if ns.records == nil {
+		ns.records = map[string]*namespaceRecord{}
+	}
+	record, ok := ns.records[name]
+	if !ok {
+		record = &namespaceRecord{}
+		ns.records[name] = record
+	}
+	return record
+}
+
+// decorate applies the record of a namespace to its project
+func (ns *namespaceState) decorate(project *Project) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	project.ResourceVersion = ns.resourceVersion(project.Name)
+	record, ok := ns.records[project.Name]
+	if !ok {
+		return
+	}
+	if len(record.Labels) > 0 {
+		project.Labels = make(map[string]string, len(record.Labels))
+		for key, value := range record.Labels {
+			project.Labels[key] = value
+		}
+	}
+	if record.Annotations != nil {
+		project.Annotations = make(map[string]string, len(record.Annotations))
+		for key, value := range record.Annotations {
+			project.Annotations[key] = value
+		}
+	}
+	if record.DeletionTimestamp != nil {
+		project.DeletionTimestamp = record.DeletionTimestamp.DeepCopy()
+		project.Status.Phase = string(corev1.NamespaceTerminating)
+		project.Status.Conditions = append([]corev1.NamespaceCondition(nil), record.Conditions...)
+	}
+}
+
+// SetNamespaceStateFile loads the labels, annotations and deletions of the namespaces from
+// path, where their changes are then saved, encrypted as encryption sets for namespaces; an
+// empty path keeps them in memory
+func (c *Cluster) SetNamespaceStateFile(path string, encryption *Encryption) error {
+	return c.namespaces.load(StateFile{Path: path, Resource: "namespaces", Encryption: encryption})
+}
+
+// ListProjects returns the namespaces as OpenShift projects, which are the same on every node
+// and exist since podKube started
+func (c *Cluster) ListProjects() *ProjectList {
+	projects := c.nodes[0].Storage.ListProjects()
+	for i := range projects.Items {
+		projects.Items[i].CreationTimestamp = metav1.NewTime(c.nodes[0].created)
+		c.namespaces.decorate(&projects.Items[i])
+	}
+	return projects
+}
+
+// GetProject returns the project of a namespace
+func (c *Cluster) GetProject(name string) (*Project, error) {
+	for _, project := range c.ListProjects().Items {
+		if project.Name == name {
+			return &project, nil
+		}
+	}
+	return nil, fmt.Errorf("project %s not found", name)
+}
+
+// UpdateProjectAnnotations replaces the annotations of a project. It fails with ErrConflict
+// when resourceVersion is set but no longer the one of the project.
+func (c *Cluster) UpdateProjectAnnotations(name, resourceVersion string, annotations map[string]string) (*Project, error) {
+	return c.updateProject(name, resourceVersion, func(record *namespaceRecord) {
+		record.Annotations = withoutProjectStatus(copyStringMap(annotations))
+	})
+}
+
+// UpdateProjectMetadata replaces the labels and annotations of a project, as
+// UpdateProjectAnnotations does
+func (c *Cluster) UpdateProjectMetadata(name, resourceVersion string, labels, annotations map[string]string) (*Project, error) {
+	return c.updateProject(name, resourceVersion, func(record *namespaceRecord) {
+		record.Labels = copyStringMap(labels)
+		record.Annotations = withoutProjectStatus(copyStringMap(annotations))
+	})
+}
+
+// updateProject changes the record of a project and saves it
+func (c *Cluster) updateProject(name, resourceVersion string, change func(record *namespaceRecord)) (*Project, error) {
+	if _, err := c.GetProject(name); err != nil {
+		return nil, err
+	}
+
+	c.namespaces.mu.Lock()
+	if resourceVersion != "" && resourceVersion != c.namespaces.resourceVersion(name) {
+		c.namespaces.mu.Unlock()
+		return nil, ErrConflict
+	}
+	record := c.namespaces.record(name)
+	record.Generation++
+	change(record)
+	err := c.namespaces.save()
+	c.namespaces.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save the metadata of project %s: %v", name, err)
+	}
+	return c.GetProject(name)
+}
+
+// copyStringMap returns a copy of labels or annotations, never nil
+func copyStringMap(values map[string]string) map[string]string {
+	copied := make(map[string]string, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+	return copied
+}
+
+// DeleteNamespace starts the deletion of a namespace, whose pods RunNamespaceDeleter then
+// deletes; deleting a terminating namespace changes nothing
+func (c *Cluster) DeleteNamespace(name string) (*Project, error) {
+	if _, err := c.GetProject(name); err != nil {
+		return nil, err
+	}
+
+	c.namespaces.mu.Lock()
+	record := c.namespaces.record(name)
+	var err error
+	if record.DeletionTimestamp == nil {
+		now := metav1.Now()
+		record.DeletionTimestamp = &now
+		record.Generation++
+		err = c.namespaces.save()
+	}
+	c.namespaces.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save the deletion of namespace %s: %v", name, err)
+	}
+	return c.GetProject(name)
+}
+
+// NamespaceTerminating reports whether a namespace is being deleted
+func (c *Cluster) NamespaceTerminating(name string) bool {
+	c.namespaces.mu.Lock()
+	defer c.namespaces.mu.Unlock()
+
+	record, ok := c.namespaces.records[name]
+	return ok && record.DeletionTimestamp != nil
+}
+
+// NamespaceLabels returns the labels of a namespace
+func (c *Cluster) NamespaceLabels(name string) map[string]string {
+	c.namespaces.mu.Lock()
+	defer c.namespaces.mu.Unlock()
+
+	if record, ok := c.namespaces.records[name]; ok {
+		return copyStringMap(record.Labels)
+	}
+	return nil
+}
+
+// RunNamespaceDeleter deletes the pods of the terminating namespaces every
+// namespaceDeleteInterval until ctx is cancelled, including the deletions started before a
+// restart. A namespace is deleted once its last pod is gone, pods with finalizers included.
+func (c *Cluster) RunNamespaceDeleter(ctx context.Context) {
+	ticker := time.NewTicker(namespaceDeleteInterval)
+	defer ticker.Stop()
+
+	for {
+		c.deleteNamespaceContent(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteNamespaceContent deletes the pods of the terminating namespaces, and the namespaces
+// left without pods
+func (c *Cluster) deleteNamespaceContent(ctx context.Context) {
+	c.namespaces.mu.Lock()
+	var terminating []string
+	for name, record := range c.namespaces.records {
+		if record.DeletionTimestamp != nil {
+			terminating = append(terminating, name)
+		}
+	}
+	c.namespaces.mu.Unlock()
+	sort.Strings(terminating)
+
+	for _, namespace := range terminating {
+		podList, err := c.List(ctx, namespace, "", "")
+		if err != nil {
+			klog.Warningf("Failed to list the pods of terminating namespace %s: %v", namespace, err)
+			continue
+		}
+
+		finalizers := map[string]int{}
+		for i := range podList.Items {
+			pod := &podList.Items[i]
+			if pod.DeletionTimestamp != nil {
+				for _, finalizer := range pod.Finalizers {
+					finalizers[finalizer]++
+				}
+				continue
+			}
+			if _, err := c.Delete(ctx, namespace, pod.Name); err != nil {
+				klog.Warningf("Failed to delete pod %s of terminating namespace %s: %v", pod.Name, namespace, err)
+			}
+		}
+
+		c.namespaces.mu.Lock()
+		if len(podList.Items) == 0 {
+			delete(c.namespaces.records, namespace)
+			klog.Infof("Deleted namespace %s", namespace)
+		} else {
+			record := c.namespaces.record(namespace)
+			conditions := namespaceConditions(len(podList.Items), finalizers)
+			for i := range conditions {
+				for _, previous := range record.Conditions {
+					if previous.Type == conditions[i].Type {
+						conditions[i].LastTransitionTime = previous.LastTransitionTime
+					}
+				}
+			}
+			record.Conditions = conditions
+		}
+		if err := c.namespaces.save(); err != nil {
+			klog.Errorf("Failed to save the namespace state: %v", err)
+		}
+		c.namespaces.mu.Unlock()
+	}
+}
+
+// namespaceConditions returns the conditions of a terminating namespace with pods left, as
+// kube-controller-manager reports them
+func namespaceConditions(pods int, finalizers map[string]int) []corev1.NamespaceCondition {
+	now := metav1.Now()
+	conditions := []corev1.NamespaceCondition{{
+		Type:               corev1.NamespaceContentRemaining,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: now,
+		Reason:             "SomeResourcesRemain",
+		Message:            fmt.Sprintf("Some resources are remaining: pods. has %d resource instances", pods),
+	}}
+	if len(finalizers) > 0 {
+		names := make([]string, 0, len(finalizers))
+		for name, count := range finalizers {
+			names = append(names, fmt.Sprintf("%s in %d resource instances", name, count))
+		}
+		sort.Strings(names)
+		conditions = append(conditions, corev1.NamespaceCondition{
+			Type:               corev1.NamespaceFinalizersRemaining,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: now,
+			Reason:             "SomeFinalizersRemain",
+			Message:            fmt.Sprintf("Some content in the namespace has finalizers remaining: %s", strings.Join(names, ", ")),
+		})
+	}
+	return conditions
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+)
+
+// networkAnnotation selects the network a pod's container joins, as passed to --network
+const networkAnnotation = "podman.io/network"
+
+// ErrNetworkInUse is returned when removing a network that containers are connected to
+var ErrNetworkInUse = errors.New("network is in use by a container")
+
+// Network is a network of the nodes' container runtimes
+type Network struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              NetworkSpec   `json:"spec,omitempty"`
+	Status            NetworkStatus `json:"status,omitempty"`
+}
+
+// NetworkSpec is the configuration of a network
+type NetworkSpec struct {
+	Driver   string          `json:"driver,omitempty"`  // bridge by default
+	Subnets  []NetworkSubnet `json:"subnets,omitempty"` // Allocated by the runtime when empty
+	Internal bool            `json:"internal,omitempty"`
+}
+
+// NetworkSubnet is a subnet of a network
+type NetworkSubnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// NetworkStatus describes a network of the runtimes
+type NetworkStatus struct {
+	ID    string   `json:"id,omitempty"`
+	Nodes []string `json:"nodes,omitempty"` // Nodes whose runtime has the network
+}
+
+// NetworkList is a list of networks
+type NetworkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Network `json:"items"`
+}
+
+// DeepCopy returns a copy of the network
+func (in *Network) DeepCopy() *Network {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec.Subnets = append([]NetworkSubnet(nil), in.Spec.Subnets...)
+	out.Status.Nodes = append([]string(nil), in.Status.Nodes...)
+	return &out
+}
+
+// DeepCopyObject implements runtime.Object, so networks can be decoded from request bodies
+func (in *Network) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+// runtimeNetwork is a network in network inspect output. Podman writes lowercase keys and
+// lists subnets directly, docker capitalizes them and lists subnets in its IPAM config;
+// field names are matched case-insensitively.
+type runtimeNetwork struct {
+	Name     string          `json:"name"`
+	ID       string          `json:"id"`
+	Driver   string          `json:"driver"`
+	Created  time.Time       `json:"created"`
+	Internal bool            `json:"internal"`
+	Subnets  []NetworkSubnet `json:"subnets"`
+	IPAM     struct {
+		Config []NetworkSubnet `json:"config"`
+	} `json:"ipam"`
+}
+
+// toNetwork converts an inspected network to a Network
+func (rn *runtimeNetwork) toNetwork() Network {
+	subnets := rn.Subnets
+	if len(subnets) == 0 {
+		subnets = rn.IPAM.Config
+	}
+	return Network{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Network",
+			APIVersion: PodmanAPIVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              rn.Name,
+			UID:               uidFromID("network", rn.ID),
+			CreationTimestamp: metav1.NewTime(rn.Created),
+		},
+		Spec: NetworkSpec{
+			Driver:   rn.Driver,
+			Subnets:  subnets,
+			Internal: rn.Internal,
+		},
+		Status: NetworkStatus{
+			ID: rn.ID,
+		},
+	}
+}
+
+// listNetworks returns the networks of a runtime
+func listNetworks(ctx context.Context, command commandFunc) ([]Network, error) {
+	cmd, cancel := command(ctx, "network", "ls", "--quiet")
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+
+	ids := strings.Fields(string(output))
+	if len(ids) == 0 {
+		return []Network{}, nil
+	}
+	return inspectNetworks(ctx, command, ids...)
+}
+
+// inspectNetworks returns the named networks
+func inspectNetworks(ctx context.Context, command commandFunc, names ...string) ([]Network, error) {
+	cmd, cancel := command(ctx, append([]string{"network", "inspect"}, names...)...)
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect networks: %v", err)
+	}
+
+	var inspected []runtimeNetwork
+	if err := json.Unmarshal(output, &inspected); err != nil {
+		return nil, fmt.Errorf("failed to parse network inspect output: %v", err)
+	}
+	networks := make([]Network, len(inspected))
+	for i := range inspected {
+		networks[i] = inspected[i].toNetwork()
+	}
+	return networks, nil
+}
+
+// createNetwork creates a network in a runtime and returns it
+func createNetwork(ctx context.Context, command commandFunc, network *Network) (*Network, error) {
+	args := []string{"network", "create"}
+	if network.Spec.Driver != "" {
+		args = append(args, "--driver", network.Spec.Driver)
+	}
+	for _, subnet := range network.Spec.Subnets {
+		args = append(args, "--subnet", subnet.Subnet)
+		if subnet.Gateway != "" {
+			args = append(args, "--gateway", subnet.Gateway)
+		}
+	}
+	if network.Spec.Internal {
+		args = append(args, "--internal")
+	}
+	args = append(args, network.Name)
+
+	cmd, cancel := command(ctx, args...)
+	defer cancel()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("failed to create network %s: %v: %s", network.Name, err, strings.TrimSpace(string(output)))
+	}
+	klog.Infof("Created network %s", network.Name)
+
+	networks, err := inspectNetworks(ctx, command, network.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(networks) == 0 {
+		return nil, fmt.Errorf("network %s not found after creating it", network.Name)
+	}
+	return &networks[0], nil
+}
+
+// removeNetwork removes a network from a runtime, failing with ErrNetworkInUse when
+// containers are connected to it
+func removeNetwork(ctx context.Context, command commandFunc, name string) error {
+	cmd, cancel := command(ctx, "network", "rm", name)
+	defer cancel()
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := strings.TrimSpace(string(output))
+		if strings.Contains(message, "being used") || strings.Contains(message, "in use") || strings.Contains(message, "active endpoints") {
+			return fmt.Errorf("%w: %s", ErrNetworkInUse, message)
+		}
+		return fmt.Errorf("failed to remove network %s: %v: %s", name, err, message)
+	}
+
+	klog.Infof("Removed network %s", name)
+	return nil
+}
+
+// ListNetworks returns the podman networks
+func (ps *PodStorage) ListNetworks(ctx context.Context) ([]Network, error) {
+	return listNetworks(ctx, ps.podmanCommand)
+}
+
+// CreateNetwork creates a network with podman network create
+func (ps *PodStorage) CreateNetwork(ctx context.Context, network *Network) (*Network, error) {
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+	return createNetwork(ctx, ps.podmanCommand, network)
+}
+
+// RemoveNetwork removes a network with podman network rm
+func (ps *PodStorage) RemoveNetwork(ctx context.Context, name string) error {
+	if err := ps.checkBackend(); err != nil {
+		return err
+	}
+	return removeNetwork(ctx, ps.podmanCommand, name)
+}
+
+// ListNetworks returns the docker networks
+func (ds *DockerStorage) ListNetworks(ctx context.Context) ([]Network, error) {
+	return listNetworks(ctx, ds.dockerCommand)
+}
+
+// CreateNetwork creates a network with docker network create
+func (ds *DockerStorage) CreateNetwork(ctx context.Context, network *Network) (*Network, error) {
+	if !ds.breaker.allow() {
+		return nil, ds.breaker.unavailableError()
+	}
+	return createNetwork(ctx, ds.dockerCommand, network)
+}
+
+// RemoveNetwork removes a network with docker network rm
+func (ds *DockerStorage) RemoveNetwork(ctx context.Context, name string) error {
+	if !ds.breaker.allow() {
+		return ds.breaker.unavailableError()
+	}
+	return removeNetwork(ctx, ds.dockerCommand, name)
+}
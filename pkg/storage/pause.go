@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// ErrInvalidPause is returned when pausing or unpausing a pod whose containers are not running
+var ErrInvalidPause = errors.New("invalid pause request")
+
+// Pause freezes the processes of the containers of a pod with podman pause; the pod keeps
+// running, with the Paused condition, until it is unpaused
+func (ps *PodStorage) Pause(ctx context.Context, namespace, name string) error {
+	return ps.setPaused(ctx, namespace, name, true)
+}
+
+// Unpause resumes the containers of a paused pod with podman unpause
+func (ps *PodStorage) Unpause(ctx context.Context, namespace, name string) error {
+	return ps.setPaused(ctx, namespace, name, false)
+}
+
+func (ps *PodStorage) setPaused(ctx context.Context, namespace, name string, paused bool) error {
+	if err := ps.checkBackend(); err != nil {
+		return err
+	}
+
+	containers, err := ps.getPodmanContainers(ctx)
+	if err != nil {
+		return err
+	}
+	members := podContainers(containers, namespace, name, ps.namespace)
+	if len(members) == 0 {
+		return fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+	defer ps.cache.invalidate()
+	return pauseContainers(ctx, ps.podmanCommand, namespace, name, members, paused)
+}
+
+// Pause freezes the processes of the containers of a pod with docker pause
+func (ds *DockerStorage) Pause(ctx context.Context, namespace, name string) error {
+	return ds.setPaused(ctx, namespace, name, true)
+}
+
+// Unpause resumes the containers of a paused pod with docker unpause
+func (ds *DockerStorage) Unpause(ctx context.Context, namespace, name string) error {
+	return ds.setPaused(ctx, namespace, name, false)
+}
+
+func (ds *DockerStorage) setPaused(ctx context.Context, namespace, name string, paused bool) error {
+	members, err := ds.podContainers(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	defer ds.cache.invalidate()
+	return pauseContainers(ctx, ds.dockerCommand, namespace, name, members, paused)
+}
+
+// pauseContainers pauses or unpauses the containers of a pod. Containers already in the
+// requested state are left alone, so that pausing a paused pod succeeds; containers that
+// are not running cannot be paused.
+func pauseContainers(ctx context.Context, command commandFunc, namespace, name string, members []*PodmanContainer, paused bool) error {
+	action, from := "pause", "running"
+	if !paused {
+		action, from = "unpause", "paused"
+	}
+
+	var ids []string
+	for _, container := range members {
+		switch container.State {
+		case from:
+			ids = append(ids, container.Id)
+		case "paused", "running":
+			// Already in the requested state
+		default:
+			return fmt.Errorf("%w: pod %s/%s cannot be %sd, container %s is %s", ErrInvalidPause, namespace, name, action, containerPodName(container), container.State)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	cmd, cancel := command(ctx, append([]string{action}, ids...)...)
+	defer cancel()
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to %s pod %s/%s: %v: %s", action, namespace, name, err, strings.TrimSpace(string(output)))
+	}
+	klog.Infof("%sd pod %s/%s", strings.ToUpper(action[:1])+action[1:], namespace, name)
+	return nil
+}
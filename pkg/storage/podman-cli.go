@@ -1,19 +1,82 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
 )
 
-// getPodmanContainers calls podman ps --format json to get running containers
-func (ps *PodStorage) getPodmanContainers() ([]PodmanContainer, error) {
-	cmd := exec.Command("podman", "ps", "--format", "json", "--all")
+// defaultCommandTimeout bounds a single non-streaming podman invocation
+const defaultCommandTimeout = 60 * time.Second
+
+// SetCommandTimeout sets the maximum duration of a single podman invocation (0 disables the limit)
+func (ps *PodStorage) SetCommandTimeout(timeout time.Duration) {
+	ps.commandTimeout.Store(int64(timeout))
+}
+
+// podmanCommand builds a podman invocation bound to ctx and to the per-command timeout.
+// The returned cancel function must be called once the command has completed.
+func (ps *PodStorage) podmanCommand(ctx context.Context, args ...string) (*exec.Cmd, context.CancelFunc) {
+	var cancel context.CancelFunc
+	if timeout := time.Duration(ps.commandTimeout.Load()); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	return exec.CommandContext(ctx, "podman", ps.PodmanArgs(args...)...), cancel
+}
+
+// getPodmanContainers returns all containers, served from the cache when it is fresh
+func (ps *PodStorage) getPodmanContainers(ctx context.Context) ([]PodmanContainer, error) {
+	if containers, ok := ps.cache.get(); ok {
+		return containers, nil
+	}
+
+	// Serve the last known state instead of piling up on a broken podman
+	if !ps.breaker.allow() {
+		return ps.degradedContainers()
+	}
+
+	// Only one refresh at a time; concurrent callers pick up its result
+	ps.cache.fetchMu.Lock()
+	defer ps.cache.fetchMu.Unlock()
+
+	if containers, ok := ps.cache.get(); ok {
+		return containers, nil
+	}
+
+	generation := ps.cache.currentGeneration()
+	containers, err := ps.listPodmanContainers(ctx)
+	if err != nil {
+		// A cancelled client request says nothing about podman's health
+		if ctx.Err() == nil {
+			ps.breaker.recordFailure(err)
+		}
+		if ps.breaker.isOpen() {
+			return ps.degradedContainers()
+		}
+		return nil, err
+	}
+	ps.breaker.recordSuccess()
+	ps.cache.store(containers, generation)
+
+	return containers, nil
+}
+
+// listPodmanContainers calls podman ps --format json to get running containers
+func (ps *PodStorage) listPodmanContainers(ctx context.Context) ([]PodmanContainer, error) {
+	cmd, cancel := ps.podmanCommand(ctx, "ps", "--format", "json", "--all")
+	defer cancel()
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run podman ps: %v", err)
@@ -24,32 +87,117 @@ func (ps *PodStorage) getPodmanContainers() ([]PodmanContainer, error) {
 		return nil, fmt.Errorf("failed to parse podman output: %v", err)
 	}
 
-	// Enhance each container with detailed annotations from inspect
+	// Enhance each container with detailed annotations from a single batched inspect
+	ids := make([]string, 0, len(containers))
 	for i := range containers {
-		if annotations, err := ps.getPodmanContainerAnnotations(containers[i].Id); err == nil {
+		ids = append(ids, containers[i].Id)
+	}
+
+	allAnnotations, err := ps.getPodmanContainersAnnotations(ctx, ids)
+	if err != nil {
+		klog.Warningf("Batched inspect failed, inspecting containers one by one: %v", err)
+		allAnnotations = ps.getPodmanContainersAnnotationsParallel(ctx, ids)
+	}
+
+	for i := range containers {
+		if annotations, ok := allAnnotations[containers[i].Id]; ok {
 			containers[i].Annotations = annotations
-		} else {
-			klog.Warningf("Failed to get annotations for container %s: %v", containers[i].Id, err)
 		}
 	}
 
 	return containers, nil
 }
 
+// getPodmanContainersAnnotationsParallel inspects containers individually through the worker pool
+func (ps *PodStorage) getPodmanContainersAnnotationsParallel(ctx context.Context, containerIDs []string) map[string]map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, enrichmentTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	result := make(map[string]map[string]string, len(containerIDs))
+	forEachParallel(ctx, int(ps.parallelism.Load()), len(containerIDs), func(ctx context.Context, i int) {
+		id := containerIDs[i]
+		annotations, err := ps.getPodmanContainerAnnotations(ctx, id)
+		if err != nil {
+			klog.Warningf("Failed to get annotations for container %s: %v", id, err)
+			return
+		}
+		mu.Lock()
+		result[id] = annotations
+		mu.Unlock()
+	})
+
+	return result
+}
+
+// podmanInspectResult is the subset of podman inspect output used by the adapter
+type podmanInspectResult struct {
+	Id     string `json:"Id"`
+	Config struct {
+		Annotations map[string]string `json:"Annotations"`
+	} `json:"Config"`
+	AppArmorProfile string `json:"AppArmorProfile"`
+	HostConfig      struct {
+		SecurityOpt []string `json:"SecurityOpt"`
+	} `json:"HostConfig"`
+}
+
+// annotations returns the annotations of an inspected container, with those reporting its
+// seccomp and AppArmor profiles
+func (inspected *podmanInspectResult) annotations() map[string]string {
+	annotations := make(map[string]string, len(inspected.Config.Annotations)+2)
+	for key, value := range inspected.Config.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range appliedProfileAnnotations(inspected.AppArmorProfile, inspected.HostConfig.SecurityOpt) {
+		annotations[key] = value
+	}
+	return annotations
+}
+
+// getPodmanContainersAnnotations gets annotations for many containers with a single inspect call
+func (ps *PodStorage) getPodmanContainersAnnotations(ctx context.Context, containerIDs []string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string, len(containerIDs))
+	if len(containerIDs) == 0 {
+		return result, nil
+	}
+
+	args := append([]string{"inspect", "--type", "container"}, containerIDs...)
+	cmd, cancel := ps.podmanCommand(ctx, args...)
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil && len(output) == 0 {
+		return nil, fmt.Errorf("failed to inspect containers: %v", err)
+	}
+	if err != nil {
+		// A container removed after podman ps makes inspect fail, but the
+		// remaining containers are still reported on stdout
+		klog.V(2).Infof("podman inspect reported an error, using partial output: %v", err)
+	}
+
+	var inspectResults []podmanInspectResult
+	if err := json.Unmarshal(output, &inspectResults); err != nil {
+		return nil, fmt.Errorf("failed to parse inspect output: %v", err)
+	}
+
+	for i := range inspectResults {
+		result[inspectResults[i].Id] = inspectResults[i].annotations()
+	}
+
+	return result, nil
+}
+
 // getPodmanContainerAnnotations gets annotations for a specific container using inspect
-func (ps *PodStorage) getPodmanContainerAnnotations(containerID string) (map[string]string, error) {
-	cmd := exec.Command("podman", "inspect", containerID)
+func (ps *PodStorage) getPodmanContainerAnnotations(ctx context.Context, containerID string) (map[string]string, error) {
+	cmd, cancel := ps.podmanCommand(ctx, "inspect", containerID)
+	defer cancel()
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to inspect container %s: %v", containerID, err)
 	}
 
 	// Parse the inspect output to get annotations
-	var inspectResult []struct {
-		Config struct {
-			Annotations map[string]string `json:"Annotations"`
-		} `json:"Config"`
-	}
+	var inspectResult []podmanInspectResult
 
 	if err := json.Unmarshal(output, &inspectResult); err != nil {
 		return nil, fmt.Errorf("failed to parse inspect output: %v", err)
@@ -59,17 +207,13 @@ func (ps *PodStorage) getPodmanContainerAnnotations(containerID string) (map[str
 		return map[string]string{}, nil
 	}
 
-	annotations := inspectResult[0].Config.Annotations
-	if annotations == nil {
-		return map[string]string{}, nil
-	}
-
-	return annotations, nil
+	return inspectResult[0].annotations(), nil
 }
 
 // getPodmanK8sContainer calls podman kube generate NAME to get the container details
-func (ps *PodStorage) getPodmanK8sContainer(containerName string) (*corev1.Pod, error) {
-	cmd := exec.Command("podman", "kube", "generate", "-t", "pod", containerName)
+func (ps *PodStorage) getPodmanK8sContainer(ctx context.Context, containerName string) (*corev1.Pod, error) {
+	cmd, cancel := ps.podmanCommand(ctx, "kube", "generate", "-t", "pod", containerName)
+	defer cancel()
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run podman kube generate: %v", err)
@@ -84,8 +228,8 @@ func (ps *PodStorage) getPodmanK8sContainer(containerName string) (*corev1.Pod,
 }
 
 // getPodmanContainer gets details for a specific container by ID
-func (ps *PodStorage) getPodmanContainer(containerID string) (*PodmanContainer, error) {
-	containers, err := ps.getPodmanContainers()
+func (ps *PodStorage) getPodmanContainer(ctx context.Context, containerID string) (*PodmanContainer, error) {
+	containers, err := ps.getPodmanContainers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -100,15 +244,56 @@ func (ps *PodStorage) getPodmanContainer(containerID string) (*PodmanContainer,
 }
 
 // createPodmanContainer runs a Podman container with the given arguments
-func (ps *PodStorage) createPodmanContainer(pod *corev1.Pod) (string, error) {
+func (ps *PodStorage) createPodmanContainer(ctx context.Context, pod *corev1.Pod) (string, error) {
+	pod = ps.withServiceAccountVolume(pod)
+	args, err := containerRunArgs(pod, RuntimePodman)
+	if err != nil {
+		return "", err
+	}
+	if err := ps.writeProjectedFiles(ctx, pod); err != nil {
+		return "", err
+	}
+
+	// Run the container
+	cmd, cancel := ps.podmanCommand(ctx, args...)
+	defer cancel()
+	output, err := cmd.Output()
+	if err != nil {
+		// Another container may have taken the name since the existence check
+		if isNameInUse(err) {
+			return "", fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+		}
+		return "", ps.pulls.failed(pod, commandOutput(err), fmt.Errorf("failed to create container: %v", err))
+	}
+
+	ps.cache.invalidate()
+
+	containerID := strings.TrimSpace(string(output))
+	klog.Infof("Created container %s with ID: %s", pod.Name, containerID)
+
+	return containerID, nil
+}
+
+// isNameInUse reports whether a failed run was refused because the container name is
+// taken, which podman and docker both report as "already in use"
+func isNameInUse(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && bytes.Contains(exitErr.Stderr, []byte("already in use"))
+}
+
+// containerRunArgs builds the `run` arguments creating the container of a single-container pod
+// on a runtime. Docker, which has no container annotations, keeps them as prefixed labels
+// instead.
+func containerRunArgs(pod *corev1.Pod, runtime string) ([]string, error) {
 	// For now, we only support single-container pods
 	if len(pod.Spec.Containers) != 1 {
-		return "", fmt.Errorf("only single-container pods are supported")
+		return nil, fmt.Errorf("only single-container pods are supported")
 	}
+	annotationsAsLabels := runtime == RuntimeDocker
 
 	container := pod.Spec.Containers[0]
 
-	// Build podman run command
+	// Build the run command
 	args := []string{"run", "-d", "--name", pod.Name}
 
 	// Add environment variables
@@ -123,9 +308,70 @@ func (ps *PodStorage) createPodmanContainer(pod *corev1.Pod) (string, error) {
 
 	// Add annotations from pod
 	for key, value := range pod.Annotations {
-		args = append(args, "--annotation", fmt.Sprintf("%s=%s", key, value))
+		key = containerAnnotationKey(key)
+		if annotationsAsLabels {
+			args = append(args, "--label", fmt.Sprintf("%s%s=%s", annotationLabelPrefix, key, value))
+		} else {
+			args = append(args, "--annotation", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
+	// Finalizers and the UID kept by a recreated pod are part of the pod metadata, stored
+	// alongside the annotations
+	internal := map[string]string{}
+	if len(pod.Finalizers) > 0 {
+		internal[finalizersAnnotation] = encodeFinalizers(pod.Finalizers)
+	}
+	if pod.UID != "" {
+		internal[uidAnnotation] = string(pod.UID)
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil && len(sc.Sysctls) > 0 {
+		internal[sysctlsAnnotation] = encodeSysctls(sc.Sysctls)
+	}
+	for _, key := range []string{finalizersAnnotation, uidAnnotation, sysctlsAnnotation} {
+		value, ok := internal[key]
+		if !ok {
+			continue
+		}
+		if annotationsAsLabels {
+			args = append(args, "--label", fmt.Sprintf("%s%s=%s", annotationLabelPrefix, key, value))
+		} else {
+			args = append(args, "--annotation", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
+	// Join the network selected by the pod, instead of the runtime's default one
+	if network := pod.Annotations[networkAnnotation]; network != "" {
+		args = append(args, "--network", network)
 	}
 
+	// Add the host aliases and DNS settings of the pod
+	args = append(args, hostsAndDNSArgs(pod)...)
+
+	// Apply the seccomp and AppArmor profiles of the pod
+	args = append(args, securityOptArgs(pod, &container)...)
+
+	// Set the sysctls and resource limits of the pod
+	limits, err := sysctlsAndUlimitsArgs(pod)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, limits...)
+
+	// Mount the files of the projected volumes of the pod
+	projected, err := projectedVolumeArgs(pod, &container, runtime)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, projected...)
+
+	// Pass the devices and GPUs of the pod through
+	devices, err := deviceArgs(pod, &container, runtime)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, devices...)
+
 	// Add the image and command
 	args = append(args, container.Image)
 
@@ -147,22 +393,14 @@ func (ps *PodStorage) createPodmanContainer(pod *corev1.Pod) (string, error) {
 		args = append(args, "sleep", "3600")
 	}
 
-	// Run the container
-	cmd := exec.Command("podman", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to create container: %v", err)
-	}
-
-	containerID := strings.TrimSpace(string(output))
-	klog.Infof("Created container %s with ID: %s", pod.Name, containerID)
-
-	return containerID, nil
+	return args, nil
 }
 
 // stopPodmanContainer stops a Podman container
-func (ps *PodStorage) stopPodmanContainer(name string) error {
-	stopCmd := exec.Command("podman", "stop", name)
+func (ps *PodStorage) stopPodmanContainer(ctx context.Context, name string) error {
+	stopCmd, cancel := ps.podmanCommand(ctx, "stop", name)
+	defer cancel()
+	defer ps.cache.invalidate()
 	if err := stopCmd.Run(); err != nil {
 		klog.Warningf("Failed to stop container %s: %v", name, err)
 		// Continue to try removal even if stop fails
@@ -171,8 +409,10 @@ func (ps *PodStorage) stopPodmanContainer(name string) error {
 }
 
 // removePodmanContainer removes a Podman container
-func (ps *PodStorage) removePodmanContainer(name string) error {
-	rmCmd := exec.Command("podman", "rm", name)
+func (ps *PodStorage) removePodmanContainer(ctx context.Context, name string) error {
+	rmCmd, cancel := ps.podmanCommand(ctx, "rm", name)
+	defer cancel()
+	defer ps.cache.invalidate()
 	if err := rmCmd.Run(); err != nil {
 		return fmt.Errorf("failed to remove container %s: %v", name, err)
 	}
@@ -181,9 +421,23 @@ func (ps *PodStorage) removePodmanContainer(name string) error {
 	return nil
 }
 
+// removePodmanPod stops and removes a podman pod along with its containers
+func (ps *PodStorage) removePodmanPod(ctx context.Context, podID string) error {
+	rmCmd, cancel := ps.podmanCommand(ctx, "pod", "rm", "--force", podID)
+	defer cancel()
+	defer ps.cache.invalidate()
+	if err := rmCmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove podman pod %s: %v", podID, err)
+	}
+
+	klog.Infof("Deleted podman pod %s", podID)
+	return nil
+}
+
 // getPodmanSecrets calls podman secret ls with custom format to get secrets
-func (ps *PodStorage) getPodmanSecrets() ([]PodmanSecret, error) {
-	cmd := exec.Command("podman", "secret", "ls", "--format", "{{.ID}}\t{{.Name}}\t{{.Driver}}\t{{.CreatedAt}}\t{{.UpdatedAt}}")
+func (ps *PodStorage) getPodmanSecrets(ctx context.Context) ([]PodmanSecret, error) {
+	cmd, cancel := ps.podmanCommand(ctx, "secret", "ls", "--format", "{{.ID}}\t{{.Name}}\t{{.Driver}}\t{{.CreatedAt}}\t{{.UpdatedAt}}")
+	defer cancel()
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to run podman secret ls: %v", err)
@@ -220,8 +474,8 @@ func (ps *PodStorage) getPodmanSecrets() ([]PodmanSecret, error) {
 }
 
 // getPodmanSecret gets details for a specific secret by name
-func (ps *PodStorage) getPodmanSecret(secretName string) (*PodmanSecret, error) {
-	secrets, err := ps.getPodmanSecrets()
+func (ps *PodStorage) getPodmanSecret(ctx context.Context, secretName string) (*PodmanSecret, error) {
+	secrets, err := ps.getPodmanSecrets(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -236,7 +490,7 @@ func (ps *PodStorage) getPodmanSecret(secretName string) (*PodmanSecret, error)
 }
 
 // createPodmanSecret creates a Podman secret
-func (ps *PodStorage) createPodmanSecret(secret *corev1.Secret) error {
+func (ps *PodStorage) createPodmanSecret(ctx context.Context, secret *corev1.Secret) error {
 	// Validate secret data - must have exactly one key named "data"
 	if len(secret.Data) == 0 {
 		return fmt.Errorf("secret must contain data")
@@ -256,8 +510,10 @@ func (ps *PodStorage) createPodmanSecret(secret *corev1.Secret) error {
 		break
 	}
 
-	// Create secret using echo and pipe (use -n to avoid trailing newline)
-	cmd := exec.Command("sh", "-c", fmt.Sprintf("echo -n '%s' | podman secret create %s -", string(secretValue), secret.Name))
+	// Create secret by feeding the value on stdin
+	cmd, cancel := ps.podmanCommand(ctx, "secret", "create", secret.Name, "-")
+	defer cancel()
+	cmd.Stdin = bytes.NewReader(secretValue)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to create secret %s: %v", secret.Name, err)
 	}
@@ -267,15 +523,16 @@ func (ps *PodStorage) createPodmanSecret(secret *corev1.Secret) error {
 }
 
 // getPodmanSecretData retrieves the actual secret data by temporarily mounting it in a container
-func (ps *PodStorage) getPodmanSecretData(secretName string) (map[string][]byte, error) {
+func (ps *PodStorage) getPodmanSecretData(ctx context.Context, secretName string) (map[string][]byte, error) {
 	// Create a temporary container to access the secret data
 	// Use a minimal image and mount the secret to read its content
 	containerName := fmt.Sprintf("temp-secret-reader-%s", secretName)
 
 	// Run a temporary container that mounts the secret and outputs its content
-	cmd := exec.Command("podman", "run", "--rm", "--name", containerName,
+	cmd, cancel := ps.podmanCommand(ctx, "run", "--rm", "--name", containerName,
 		"--secret", fmt.Sprintf("%s,type=mount,target=/tmp/secret", secretName),
 		"alpine:latest", "cat", "/tmp/secret")
+	defer cancel()
 
 	output, err := cmd.Output()
 	if err != nil {
@@ -294,8 +551,9 @@ func (ps *PodStorage) getPodmanSecretData(secretName string) (map[string][]byte,
 }
 
 // removePodmanSecret removes a Podman secret
-func (ps *PodStorage) removePodmanSecret(name string) error {
-	rmCmd := exec.Command("podman", "secret", "rm", name)
+func (ps *PodStorage) removePodmanSecret(ctx context.Context, name string) error {
+	rmCmd, cancel := ps.podmanCommand(ctx, "secret", "rm", name)
+	defer cancel()
 	if err := rmCmd.Run(); err != nil {
 		return fmt.Errorf("failed to remove secret %s: %v", name, err)
 	}
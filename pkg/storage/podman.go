@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -24,9 +25,12 @@ type PodmanContainer struct {
 	Names         []string               `json:"Names"`
 	Pid           int                    `json:"Pid"`
 	Pod           string                 `json:"Pod"`
+	PodName       string                 `json:"PodName"`
+	IsInfra       bool                   `json:"IsInfra"`
 	Ports         interface{}            `json:"Ports"`
 	Restarts      int                    `json:"Restarts"`
 	StartedAt     int64                  `json:"StartedAt"`
+	ExitedAt      int64                  `json:"ExitedAt"`
 	State         string                 `json:"State"`
 	Status        string                 `json:"Status"`
 	Created       int64                  `json:"Created"`
@@ -35,31 +39,26 @@ type PodmanContainer struct {
 
 
 // podmanContainerToPod converts a Podman container to a Kubernetes Pod
-func (ps *PodStorage) podmanContainerToPod(container *PodmanContainer) *corev1.Pod {
-	// Use the first name as pod name, fall back to truncated container ID
-	podName := "unknown"
+func (ps *PodStorage) podmanContainerToPod(ctx context.Context, container *PodmanContainer) *corev1.Pod {
+	podName := containerPodName(container)
 	podNamespace := ps.namespace
 
-	if len(container.Names) > 0 {
-		podName = container.Names[0]
-	} else {
-		// Use first 12 chars of container ID
-		if len(container.Id) >= 12 {
-			podName = container.Id[:12]
-		} else {
-			podName = container.Id
-		}
-	}
-
 	// generate the podSpec
 	var podSpec corev1.PodSpec
 
+	if isInfraContainer(container) {
+		// The infra container only holds the namespaces of a podman pod
+		return nil
+	}
+
 	if container.Pod == "" {
-		podmanPod, err := ps.getPodmanK8sContainer(container.Id)
-		if err != nil {
+		if cachedSpec, ok := ps.specCache.get(container); ok {
+			podSpec = *cachedSpec
+		} else if podmanPod, err := ps.getPodmanK8sContainer(ctx, container.Id); err != nil {
 			klog.Warningf("Failed to get detailed pod spec from podman for id=%s: %v", container.Id, err)
 		} else {
 			podSpec = podmanPod.Spec
+			ps.specCache.store(container, &podSpec)
 		}
 
 		// Keep debug pods in main namespace even when exited so watch can find them
@@ -68,89 +67,98 @@ func (ps *PodStorage) podmanContainerToPod(container *PodmanContainer) *corev1.P
 			podNamespace = "containers-exited"
 		}
 	} else {
-		return nil
+		// Containers of a podman pod (podman kube play) are grouped back into their pod
 		podSpec = corev1.PodSpec{
 			Containers: []corev1.Container{
 				{
-					Name:    podName, // Use the same name as the pod
+					Name:    podName,
 					Image:   container.Image,
 					Command: container.Command,
 				},
 			},
 		}
-		podNamespace = "pods"
 	}
 
+	pod := containerToPod(container, podName, podNamespace, podSpec, ps.mergeAnnotations(container), RuntimePodman, ps.nodeName)
+	ps.applySystemdRestarts(ctx, container, pod)
+	if identity, ok := containerIdentity(container); ok {
+		applyIdentity(pod, identity, ps.namespace)
+	}
+	restoreSidecar(pod)
+	return pod
+}
+
+// containerPodName uses the first container name as pod name, falling back to the truncated container ID
+func containerPodName(container *PodmanContainer) string {
+	if len(container.Names) > 0 {
+		return container.Names[0]
+	}
+	// Use first 12 chars of container ID
+	if len(container.Id) >= 12 {
+		return container.Id[:12]
+	}
+	return container.Id
+}
+
+// containerToPod builds the Pod of a container from its runtime state and resolved spec
+func containerToPod(container *PodmanContainer, podName, podNamespace string, podSpec corev1.PodSpec, annotations map[string]string, runtime, nodeName string) *corev1.Pod {
 	// Convert Podman state to Kubernetes phase and container state
 	var phase corev1.PodPhase
-	var conditions []corev1.PodCondition
 	var containerState corev1.ContainerState
 	var ready bool = false
 	var restartCount int32 = int32(container.Restarts)
+	created := metav1.NewTime(time.Unix(container.Created, 0))
+	started := metav1.NewTime(time.Unix(container.StartedAt, 0))
+	transition := created // Last change of the readiness of the pod
+
+	var lastState corev1.ContainerState
+	paused := false
 
 	switch container.State {
-	case "running":
+	case "running", "stopping":
+		// A stopping container still runs until it exits, but no longer serves
 		phase = corev1.PodRunning
-		ready = true
-		now := metav1.NewTime(time.Unix(container.StartedAt, 0))
-		conditions = []corev1.PodCondition{
-			{
-				Type:               corev1.PodScheduled,
-				Status:             corev1.ConditionTrue,
-				LastTransitionTime: now,
-				Reason:             "PodScheduled",
-			},
-			{
-				Type:               corev1.PodInitialized,
-				Status:             corev1.ConditionTrue,
-				LastTransitionTime: now,
-				Reason:             "PodInitialized",
-			},
-			{
-				Type:               corev1.ContainersReady,
-				Status:             corev1.ConditionTrue,
-				LastTransitionTime: now,
-				Reason:             "ContainersReady",
-			},
-			{
-				Type:               corev1.PodReady,
-				Status:             corev1.ConditionTrue,
-				LastTransitionTime: now,
-				Reason:             "PodReady",
+		ready = container.State == "running"
+		transition = started
+		containerState = corev1.ContainerState{
+			Running: &corev1.ContainerStateRunning{
+				StartedAt: started,
 			},
 		}
+		if container.Restarts > 0 && container.ExitedAt > 0 {
+			lastState.Terminated = terminatedState(container, runtime)
+		}
+	case "paused":
+		// A paused container keeps its processes, frozen
+		phase = corev1.PodRunning
+		paused = true
+		transition = started
 		containerState = corev1.ContainerState{
 			Running: &corev1.ContainerStateRunning{
-				StartedAt: metav1.NewTime(time.Unix(container.StartedAt, 0)),
+				StartedAt: started,
 			},
 		}
-	case "exited":
+	case "restarting":
+		// The restart policy of the container is restarting it after it exited
+		phase = corev1.PodRunning
+		containerState = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "CrashLoopBackOff",
+				Message: "back-off restarting failed container",
+			},
+		}
+		lastState.Terminated = terminatedState(container, runtime)
+		transition = lastState.Terminated.FinishedAt
+	case "exited", "stopped", "removing", "dead":
 		if container.ExitCode == 0 {
 			phase = corev1.PodSucceeded
 		} else {
 			phase = corev1.PodFailed
 		}
-		conditions = []corev1.PodCondition{
-			{
-				Type:   corev1.PodReady,
-				Status: corev1.ConditionFalse,
-			},
-		}
-		containerState = corev1.ContainerState{
-			Terminated: &corev1.ContainerStateTerminated{
-				ExitCode:   int32(container.ExitCode),
-				Reason:     "Completed",
-				FinishedAt: metav1.NewTime(time.Unix(container.StartedAt, 0)),
-			},
-		}
-	case "created", "configured":
+		containerState.Terminated = terminatedState(container, runtime)
+		transition = containerState.Terminated.FinishedAt
+	case "created", "configured", "initialized":
 		phase = corev1.PodPending
-		conditions = []corev1.PodCondition{
-			{
-				Type:   corev1.PodScheduled,
-				Status: corev1.ConditionTrue,
-			},
-		}
 		containerState = corev1.ContainerState{
 			Waiting: &corev1.ContainerStateWaiting{
 				Reason: "ContainerCreating",
@@ -158,7 +166,6 @@ func (ps *PodStorage) podmanContainerToPod(container *PodmanContainer) *corev1.P
 		}
 	default:
 		phase = corev1.PodUnknown
-		conditions = []corev1.PodCondition{}
 		containerState = corev1.ContainerState{
 			Waiting: &corev1.ContainerStateWaiting{
 				Reason: "Unknown",
@@ -169,13 +176,12 @@ func (ps *PodStorage) podmanContainerToPod(container *PodmanContainer) *corev1.P
 	// Convert creation and start times
 	var creationTime, startTime *metav1.Time
 	if container.Created > 0 {
-		t := metav1.NewTime(time.Unix(container.Created, 0))
-		creationTime = &t
+		creationTime = &created
 	}
 	if container.StartedAt > 0 {
-		t := metav1.NewTime(time.Unix(container.StartedAt, 0))
-		startTime = &t
+		startTime = &started
 	}
+	running := containerState.Running != nil
 
 	// Create the Pod object
 	pod := &corev1.Pod{
@@ -187,41 +193,85 @@ func (ps *PodStorage) podmanContainerToPod(container *PodmanContainer) *corev1.P
 			Name:            podName,
 			Namespace:       podNamespace,
 			Labels:          container.Labels, // Use Podman labels directly
-			Annotations:     ps.mergeAnnotations(container),
+			Annotations:     annotations,
+			UID:             uidFromID("container", container.Id),
 			ResourceVersion: container.Id[:12], // Use container ID prefix as resourceVersion
 		},
 		Spec: podSpec,
 		Status: corev1.PodStatus{
-			Phase:      phase,
-			Conditions: conditions,
-			StartTime:  startTime,
+			Phase:     phase,
+			StartTime: startTime,
 			ContainerStatuses: []corev1.ContainerStatus{
 				{
-					Name:         podName,
-					Image:        container.Image,
-					ImageID:      container.ImageID,
-					ContainerID:  fmt.Sprintf("podman://%s", container.Id),
-					Ready:        ready,
-					RestartCount: restartCount,
-					State:        containerState,
+					Name:                 podName,
+					Image:                container.Image,
+					ImageID:              container.ImageID,
+					ContainerID:          fmt.Sprintf("%s://%s", runtime, container.Id),
+					Ready:                ready,
+					Started:              &running,
+					RestartCount:         restartCount,
+					State:                containerState,
+					LastTerminationState: lastState,
 				},
 			},
 		},
 	}
+	if paused {
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[pausedAnnotation] = "true"
+	}
+	setPodDefaults(&pod.Spec)
+	pod.Status.QOSClass = podQOSClass(&pod.Spec)
+	pod.Status.Conditions = podConditions(pod, created, transition)
 
 	if creationTime != nil {
 		pod.ObjectMeta.CreationTimestamp = *creationTime
 	}
+	if nodeName != "" {
+		pod.Spec.NodeName = nodeName
+		pod.Status.NominatedNodeName = nodeName
+	}
+	restoreFinalizers(pod)
+	restoreUID(pod)
+	restoreSysctls(pod)
 
 	return pod
 }
 
+// terminatedState returns the state of a container that exited, for its current state once
+// it stopped or its last state while it restarts
+func terminatedState(container *PodmanContainer, runtime string) *corev1.ContainerStateTerminated {
+	reason := "Completed"
+	if container.ExitCode != 0 {
+		reason = "Error"
+	}
+	finishedAt := container.ExitedAt
+	if finishedAt <= 0 {
+		finishedAt = container.StartedAt
+	}
+	terminated := &corev1.ContainerStateTerminated{
+		ExitCode:    int32(container.ExitCode),
+		Reason:      reason,
+		FinishedAt:  metav1.NewTime(time.Unix(finishedAt, 0)),
+		ContainerID: fmt.Sprintf("%s://%s", runtime, container.Id),
+	}
+	if container.StartedAt > 0 {
+		terminated.StartedAt = metav1.NewTime(time.Unix(container.StartedAt, 0))
+	}
+	return terminated
+}
+
 // mergeAnnotations merges container annotations with podman.io annotations
 func (ps *PodStorage) mergeAnnotations(container *PodmanContainer) map[string]string {
 	annotations := map[string]string{
 		"podman.io/container-id": container.Id,
 		"podman.io/image-id":     container.ImageID,
 	}
+	if unit := container.Labels[systemdUnitLabel]; unit != "" {
+		annotations[SystemdUnitAnnotation] = unit
+	}
 
 	// Add container annotations if they exist
 	if container.Annotations != nil {
@@ -231,4 +281,4 @@ func (ps *PodStorage) mergeAnnotations(container *PodmanContainer) map[string]st
 	}
 
 	return annotations
-}
\ No newline at end of file
+}
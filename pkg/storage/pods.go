@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"sync/atomic"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,45 +15,83 @@ import (
 
 // PodStorage provides Pod storage operations backed by Podman
 type PodStorage struct {
-	namespace string // All containers go in this namespace
+	namespace   string               // All containers go in this namespace
+	cache       *containerCache      // In-memory podman ps result, invalidated by podman events
+	parallelism atomic.Int32         // Maximum concurrent per-container podman calls, reloadable
+	specCache   *podSpecCache        // podman kube generate output per container
+	digests     *imageDigestCache    // Repository digests of the images of containers
+	restarts    *restartTracker      // Recent restarts of containers, to detect crash loops
+	usage       *usageCache          // Recently sampled podman stats of containers
+	pulls       *pullBackoff         // Images that recently failed to pull
+	breaker     *circuitBreaker      // Stops calling podman after repeated failures
+	ping        *pingCache           // Last podman connectivity check
+	systemd     *systemdRestarts     // Restart counts of the systemd units of containers, nil for remote podman
+	tokens      ServiceAccountTokens // Issuer of the service account tokens of projected volumes
+
+	commandTimeout atomic.Int64 // Maximum duration of a single podman invocation, reloadable
+	connectionArgs []string     // Global podman flags selecting a remote podman service
+	nodeName       string       // Node reported in spec.nodeName of the pods
 }
 
 // NewPodStorage creates a new PodStorage instance
 func NewPodStorage() *PodStorage {
-	return &PodStorage{
+	ps := &PodStorage{
 		namespace: "containers", // All Podman containers go in "containers" namespace
+		cache:     newContainerCache(),
+		specCache: newPodSpecCache(),
+		digests:   newImageDigestCache(),
+		restarts:  newRestartTracker(),
+		usage:     newUsageCache(),
+		pulls:     newPullBackoff(),
+		breaker:   newCircuitBreaker(),
+		ping:      &pingCache{},
+		systemd:   newSystemdRestarts(os.Geteuid() != 0),
 	}
+	ps.parallelism.Store(defaultParallelism)
+	ps.commandTimeout.Store(int64(defaultCommandTimeout))
+	return ps
 }
 
 // List returns a list of pods, optionally filtered by namespace and selectors
-func (ps *PodStorage) List(namespace, labelSelector, fieldSelector string) (*corev1.PodList, error) {
+func (ps *PodStorage) List(ctx context.Context, namespace, labelSelector, fieldSelector string) (*corev1.PodList, error) {
+	selector, err := ParsePodFieldSelector(fieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field selector %q: %v", fieldSelector, err)
+	}
+
 	// Get containers from Podman
-	containers, err := ps.getPodmanContainers()
+	containers, err := ps.getPodmanContainers(ctx)
 	if err != nil {
 		klog.Errorf("Failed to get Podman containers: %v", err)
-		return nil, fmt.Errorf("failed to get containers: %v", err)
+		return nil, fmt.Errorf("failed to get containers: %w", err)
 	}
 
-	var pods []corev1.Pod
-	for _, container := range containers {
-		pod := ps.podmanContainerToPod(&container)
+	// Convert containers concurrently, since each conversion may shell out to podman kube generate
+	ctx, cancel := context.WithTimeout(ctx, enrichmentTimeout)
+	defer cancel()
 
-		if pod == nil {
-			continue
-		}
+	converted := make([]*corev1.Pod, len(containers))
+	forEachParallel(ctx, int(ps.parallelism.Load()), len(containers), func(ctx context.Context, i int) {
+		converted[i] = ps.podmanContainerToPod(ctx, &containers[i])
+	})
+	ps.specCache.prune(containers)
+	grouped := groupPods(converted)
+	ps.digests.resolve(ctx, ps.podmanCommand, grouped)
+	ps.restarts.apply(grouped)
 
+	var pods []corev1.Pod
+	for _, pod := range grouped {
 		// Filter by namespace if specified
 		if namespace != "" && pod.Namespace != namespace {
 			continue
 		}
 
 		// Apply label selector filtering (simple implementation)
-		if labelSelector != "" && !ps.matchesLabelSelector(pod, labelSelector) {
+		if labelSelector != "" && !matchesLabelSelector(pod, labelSelector) {
 			continue
 		}
 
-		// Apply field selector filtering (simple implementation)
-		if fieldSelector != "" && !ps.matchesFieldSelector(pod, fieldSelector) {
+		if !matchesFieldSelector(pod, selector) {
 			continue
 		}
 
@@ -67,103 +109,200 @@ func (ps *PodStorage) List(namespace, labelSelector, fieldSelector string) (*cor
 }
 
 // Get returns a specific pod by namespace and name
-func (ps *PodStorage) Get(namespace, name string) (*corev1.Pod, error) {
-	// Only support our containers namespace
-	if namespace != "" && namespace != ps.namespace {
+func (ps *PodStorage) Get(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	containers, err := ps.getPodmanContainers(ctx)
+	if errors.Is(err, ErrPodmanUnavailable) {
+		return nil, err
+	}
+	if err != nil {
 		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
 	}
 
-	// Get specific container by name
-	container, err := ps.getPodmanContainer(name)
-	if err != nil {
+	// A pod is a standalone container, or the containers of a pod created outside podKube
+	members := podContainers(containers, namespace, name, ps.namespace)
+	if len(members) == 0 {
 		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
 	}
 
-	pod := ps.podmanContainerToPod(container)
-	return pod, nil
+	converted := make([]*corev1.Pod, len(members))
+	for i, container := range members {
+		converted[i] = ps.podmanContainerToPod(ctx, container)
+	}
+	pods := groupPods(converted)
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
+	ps.digests.resolve(ctx, ps.podmanCommand, pods[:1])
+	ps.restarts.apply(pods[:1])
+	return pods[0], nil
 }
 
 // Create adds a new pod to storage by running a Podman container
-func (ps *PodStorage) Create(pod *corev1.Pod) (*corev1.Pod, error) {
+func (ps *PodStorage) Create(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
 	// Validate namespace
 	if pod.Namespace != ps.namespace {
 		return nil, fmt.Errorf("pods can only be created in namespace %s", ps.namespace)
 	}
 
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+
 	// Check if container already exists
-	existing, err := ps.getPodmanContainer(pod.Name)
+	existing, err := ps.getPodmanContainer(ctx, pod.Name)
 	if err == nil && existing != nil {
 		return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
 	}
 
+	// Images that recently failed to pull are not pulled again until they back off
+	if err := ps.pulls.check(pod); err != nil {
+		return nil, err
+	}
+
+	// Pods podman run cannot express are created with podman kube play
+	if RequiresKubePlay(pod) {
+		if existing, err := ps.Get(ctx, pod.Namespace, pod.Name); err == nil && existing != nil {
+			return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+		}
+		return ps.playPod(ctx, pod)
+	}
+
 	// Create the Podman container using CLI layer
-	_, err = ps.createPodmanContainer(pod)
+	_, err = ps.createPodmanContainer(ctx, pod)
 	if err != nil {
 		return nil, err
 	}
+	ps.pulls.succeeded(pod)
 
 	// Get the created container details and return as Pod
-	createdContainer, err := ps.getPodmanContainer(pod.Name)
+	createdContainer, err := ps.getPodmanContainer(ctx, pod.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get created container: %v", err)
 	}
 
-	return ps.podmanContainerToPod(createdContainer), nil
+	return ps.podmanContainerToPod(ctx, createdContainer), nil
 }
 
-// Update modifies an existing pod in storage (limited support for containers)
-func (ps *PodStorage) Update(pod *corev1.Pod) (*corev1.Pod, error) {
-	// Validate namespace
+// DryRunCreate validates a pod creation like Create and returns the pod as it would be
+// created, without running a container
+func (ps *PodStorage) DryRunCreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
 	if pod.Namespace != ps.namespace {
-		return nil, fmt.Errorf("pods can only be updated in namespace %s", ps.namespace)
+		return nil, fmt.Errorf("pods can only be created in namespace %s", ps.namespace)
 	}
 
-	// Check if container exists
-	_, err := ps.getPodmanContainer(pod.Name)
+	existing, err := ps.getPodmanContainer(ctx, pod.Name)
+	if errors.Is(err, ErrPodmanUnavailable) {
+		return nil, err
+	}
+	if err == nil && existing != nil {
+		return nil, fmt.Errorf("pod %s/%s already exists", pod.Namespace, pod.Name)
+	}
+
+	// Building the podman run arguments or the kube play manifest is the conversion Create would do
+	if RequiresKubePlay(pod) {
+		if _, err := kubePlayManifest(pod); err != nil {
+			return nil, err
+		}
+	} else {
+		pod = ps.withServiceAccountVolume(pod)
+		if _, err := containerRunArgs(pod, RuntimePodman); err != nil {
+			return nil, err
+		}
+	}
+
+	return dryRunPod(pod, ps.nodeName), nil
+}
+
+// Update modifies an existing pod in storage (limited support for containers)
+func (ps *PodStorage) Update(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	// Check if the pod exists
+	current, err := ps.Get(ctx, pod.Namespace, pod.Name)
 	if err != nil {
-		return nil, fmt.Errorf("pod %s/%s not found", pod.Namespace, pod.Name)
+		return nil, err
 	}
 
 	// For containers, we can't update much - mainly just return current state
 	// In a real implementation, you might support label updates via podman update
 	klog.Infof("Update request for pod %s - containers have limited update support", pod.Name)
 
-	// Get current state and return it
-	current, err := ps.Get(pod.Namespace, pod.Name)
+	return current, nil
+}
+
+// Recreate stops and removes the container of a pod and runs a new one for the given pod,
+// under the same name
+func (ps *PodStorage) Recreate(ctx context.Context, pod *corev1.Pod) (*corev1.Pod, error) {
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+	if _, err := containerRunArgs(pod, RuntimePodman); err != nil {
+		return nil, err
+	}
+
+	containers, err := ps.getPodmanContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	container, err := recreatableContainer(containers, pod, ps.namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	return current, nil
+	klog.Infof("Recreating container %s of pod %s/%s", container.Id, pod.Namespace, pod.Name)
+	ps.stopPodmanContainer(ctx, container.Id)
+	if err := ps.removePodmanContainer(ctx, container.Id); err != nil {
+		return nil, err
+	}
+	if _, err := ps.createPodmanContainer(ctx, pod); err != nil {
+		return nil, err
+	}
+
+	created, err := ps.getPodmanContainer(ctx, pod.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recreated container: %v", err)
+	}
+	return ps.podmanContainerToPod(ctx, created), nil
 }
 
-// Delete removes a pod from storage by stopping and removing the Podman container
-func (ps *PodStorage) Delete(namespace, name string) error {
-	// Validate namespace
-	if namespace != "" && namespace != ps.namespace {
-		return fmt.Errorf("pod %s/%s not found", namespace, name)
+// Delete removes a pod from storage by stopping and removing its Podman containers. Pods
+// created by podman kube play are removed with their podman pod.
+func (ps *PodStorage) Delete(ctx context.Context, namespace, name string) error {
+	if err := ps.checkBackend(); err != nil {
+		return err
 	}
 
-	// Check if container exists
-	_, err := ps.getPodmanContainer(name)
+	// Check if the containers exist
+	containers, err := ps.getPodmanContainers(ctx)
+	if errors.Is(err, ErrPodmanUnavailable) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("pod %s/%s not found", namespace, name)
 	}
+	members := podContainers(containers, namespace, name, ps.namespace)
+	if len(members) == 0 {
+		return fmt.Errorf("pod %s/%s not found", namespace, name)
+	}
 
-	// Stop the container using CLI layer
-	ps.stopPodmanContainer(name)
+	if podID := members[0].Pod; podID != "" {
+		return ps.removePodmanPod(ctx, podID)
+	}
 
-	// Remove the container using CLI layer
-	err = ps.removePodmanContainer(name)
-	if err != nil {
-		return err
+	for _, container := range members {
+		// Stop the container using CLI layer
+		ps.stopPodmanContainer(ctx, container.Id)
+
+		// Remove the container using CLI layer
+		if err := ps.removePodmanContainer(ctx, container.Id); err != nil {
+			return err
+		}
 	}
+	ps.removeProjectedFiles(ctx, name)
 
 	return nil
 }
 
 // matchesLabelSelector performs simple label selector matching
-func (ps *PodStorage) matchesLabelSelector(pod *corev1.Pod, selector string) bool {
+func matchesLabelSelector(pod *corev1.Pod, selector string) bool {
 	// Simple implementation: supports "key=value" format
 	if selector == "" {
 		return true
@@ -184,31 +323,3 @@ func (ps *PodStorage) matchesLabelSelector(pod *corev1.Pod, selector string) boo
 	podValue, exists := pod.Labels[key]
 	return exists && podValue == value
 }
-
-// matchesFieldSelector performs simple field selector matching
-func (ps *PodStorage) matchesFieldSelector(pod *corev1.Pod, selector string) bool {
-	// Simple implementation: supports "status.phase=Running" format
-	if selector == "" {
-		return true
-	}
-
-	parts := strings.Split(selector, "=")
-	if len(parts) != 2 {
-		return true // Skip complex selectors for now
-	}
-
-	field := strings.TrimSpace(parts[0])
-	value := strings.TrimSpace(parts[1])
-
-	switch field {
-	case "status.phase":
-		return string(pod.Status.Phase) == value
-	case "metadata.namespace":
-		return pod.Namespace == value
-	case "metadata.name":
-		return pod.Name == value
-	default:
-		return true // Unknown fields are ignored
-	}
-}
-
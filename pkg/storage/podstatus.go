@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pausedAnnotation marks the pods with a paused container, which get the Paused condition
+const pausedAnnotation = "podkube.io/paused"
+
+// podPaused is the type of the condition of pods with a paused container
+const podPaused corev1.PodConditionType = "Paused"
+
+// defaultTolerationSeconds is how long kube-apiserver lets pods tolerate a not ready or
+// unreachable node, through the tolerations it adds to every pod
+const defaultTolerationSeconds int64 = 300
+
+// defaultTolerations returns the tolerations kube-apiserver adds to pods that do not set them
+func defaultTolerations() []corev1.Toleration {
+	seconds := defaultTolerationSeconds
+	var tolerations []corev1.Toleration
+	for _, key := range []string{corev1.TaintNodeNotReady, corev1.TaintNodeUnreachable} {
+		tolerations = append(tolerations, corev1.Toleration{
+			Key:               key,
+			Operator:          corev1.TolerationOpExists,
+			Effect:            corev1.TaintEffectNoExecute,
+			TolerationSeconds: &seconds,
+		})
+	}
+	return tolerations
+}
+
+// setPodDefaults sets the fields of a pod spec that kube-apiserver defaults and podKube
+// leaves empty, as clients show them for any pod: the default tolerations
+func setPodDefaults(spec *corev1.PodSpec) {
+	for _, toleration := range defaultTolerations() {
+		if !hasToleration(spec.Tolerations, toleration.Key, corev1.TaintEffectNoExecute) {
+			spec.Tolerations = append(spec.Tolerations, toleration)
+		}
+	}
+}
+
+// hasToleration reports whether tolerations tolerate the taint key with the effect
+func hasToleration(tolerations []corev1.Toleration, key string, effect corev1.TaintEffect) bool {
+	for _, toleration := range tolerations {
+		if toleration.Key == key && (toleration.Effect == "" || toleration.Effect == effect) {
+			return true
+		}
+	}
+	return false
+}
+
+// nonDefaultTolerations returns the tolerations other than the default ones, which pods
+// read from the API carry and clients send back
+func nonDefaultTolerations(tolerations []corev1.Toleration) []corev1.Toleration {
+	var others []corev1.Toleration
+	for _, toleration := range tolerations {
+		isDefault := false
+		for _, defaultToleration := range defaultTolerations() {
+			if equality.Semantic.DeepEqual(toleration, defaultToleration) {
+				isDefault = true
+			}
+		}
+		if !isDefault {
+			others = append(others, toleration)
+		}
+	}
+	return others
+}
+
+// podQOSClass returns the QoS class of a pod from the resources of its containers, as the
+// kubelet does: Guaranteed when every container limits CPU and memory with equal requests,
+// BestEffort when none sets any, Burstable otherwise
+func podQOSClass(spec *corev1.PodSpec) corev1.PodQOSClass {
+	guaranteed, bestEffort := true, true
+	for _, container := range append(append([]corev1.Container(nil), spec.InitContainers...), spec.Containers...) {
+		resources := container.Resources
+		if len(resources.Requests) > 0 || len(resources.Limits) > 0 {
+			bestEffort = false
+		}
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			limit, limited := resources.Limits[name]
+			if !limited {
+				guaranteed = false
+				continue
+			}
+			if request, ok := resources.Requests[name]; ok && request.Cmp(limit) != 0 {
+				guaranteed = false
+			}
+		}
+	}
+	switch {
+	case bestEffort:
+		return corev1.PodQOSBestEffort
+	case guaranteed:
+		return corev1.PodQOSGuaranteed
+	default:
+		return corev1.PodQOSBurstable
+	}
+}
+
+// podConditions returns the conditions of a pod from its phase and the readiness of its
+// containers, with the reasons and messages of the kubelet: the pod was scheduled and
+// initialized when it was created, and its readiness last changed at transition
+func podConditions(pod *corev1.Pod, scheduled, transition metav1.Time) []corev1.PodCondition {
+	finished := pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+
+	sandboxReady := corev1.ConditionTrue
+	if finished {
+		sandboxReady = corev1.ConditionFalse
+	}
+	ready := corev1.PodCondition{Status: corev1.ConditionTrue, LastTransitionTime: transition}
+	switch {
+	case finished:
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = "PodCompleted"
+	case pod.Status.Phase == corev1.PodUnknown:
+		ready.Status = corev1.ConditionUnknown
+	case !allContainersReady(pod):
+		var unready []string
+		for _, status := range append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+			if !status.Ready {
+				unready = append(unready, status.Name)
+			}
+		}
+		sort.Strings(unready)
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = "ContainersNotReady"
+		ready.Message = fmt.Sprintf("containers with unready status: [%s]", strings.Join(unready, " "))
+	}
+	containersReady := ready
+	ready.Type = corev1.PodReady
+	containersReady.Type = corev1.ContainersReady
+
+	conditions := []corev1.PodCondition{
+		{Type: corev1.PodReadyToStartContainers, Status: sandboxReady, LastTransitionTime: transition},
+		{Type: corev1.PodInitialized, Status: corev1.ConditionTrue, LastTransitionTime: scheduled},
+		ready,
+		containersReady,
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: scheduled},
+	}
+	if pod.Annotations[pausedAnnotation] == "true" {
+		conditions = append(conditions, corev1.PodCondition{
+			Type:               podPaused,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: transition,
+			Reason:             "ContainerPaused",
+			Message:            "a container of the pod is paused by the container runtime",
+		})
+	}
+	return conditions
+}
+
+// readinessTransition returns when the readiness of a pod last changed, from its conditions
+func readinessTransition(pod *corev1.Pod) metav1.Time {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.LastTransitionTime
+		}
+	}
+	return pod.CreationTimestamp
+}
+
+// imageReference returns the image ID reported in container statuses: the repository digest
+// the image was pulled by, as the kubelet reports it, or its ID when it has none
+func imageReference(image, id string, repoDigests []string) string {
+	repository := image
+	if at := strings.Index(repository, "@"); at >= 0 {
+		repository = repository[:at]
+	} else if colon := strings.LastIndex(repository, ":"); colon > strings.LastIndex(repository, "/") {
+		repository = repository[:colon]
+	}
+	for _, digest := range repoDigests {
+		if strings.HasPrefix(digest, repository+"@") {
+			return digest
+		}
+	}
+	if len(repoDigests) > 0 {
+		return repoDigests[0]
+	}
+	if id == "" || strings.HasPrefix(id, "sha256:") {
+		return id
+	}
+	return "sha256:" + id
+}
@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ServiceAccountTokens issues the service account tokens of the projected volumes of pods, as
+// the TokenRequest API does, and gives the CA certificate of the API server, which the
+// kube-root-ca.crt config map of every namespace holds in Kubernetes
+type ServiceAccountTokens interface {
+	IssueToken(pod *corev1.Pod, audience string, expirationSeconds int64) (string, error)
+	ClusterCA() ([]byte, error)
+}
+
+// kubeRootCAConfigMap is the only config map podKube serves, in projected volumes
+const (
+	kubeRootCAConfigMap = "kube-root-ca.crt"
+	kubeRootCAKey       = "ca.crt"
+)
+
+// secretDataKey is the only key of secrets, which are podman secrets holding a single value
+const secretDataKey = "data"
+
+// projectedSecretPrefix names the podman secrets holding the files podKube generates for the
+// projected volumes of a pod, podkube-projected_POD_VOLUME_N: the underscores pod and volume
+// names cannot contain tell the secrets of pods apart
+const projectedSecretPrefix = "podkube-projected_"
+
+// projectedFile is a file of a projected volume, mounted in the container from a podman secret:
+// the secret of a secret source, or a secret holding the file podKube generates for the other
+// sources
+type projectedFile struct {
+	target string // Path of the file in the container
+	secret string // Podman secret mounted on the file
+	mode   *int32
+
+	// Source of a generated file
+	downwardAPI *corev1.DownwardAPIVolumeFile
+	token       *corev1.ServiceAccountTokenProjection
+	clusterCA   bool
+}
+
+// generated reports whether podKube writes the content of the file
+func (f *projectedFile) generated() bool {
+	return f.downwardAPI != nil || f.token != nil || f.clusterCA
+}
+
+// projectedSecretName names the podman secret of the nth generated file of a projected volume
+func projectedSecretName(pod *corev1.Pod, volume string, n int) string {
+	return fmt.Sprintf("%s%s_%s_%d", projectedSecretPrefix, pod.Name, volume, n)
+}
+
+// projectedFiles returns the files of the projected volumes a container mounts. Secrets hold a
+// single value, the data key, and the only config map is kube-root-ca.crt.
+func projectedFiles(pod *corev1.Pod, container *corev1.Container) ([]projectedFile, error) {
+	var files []projectedFile
+	for _, mount := range container.VolumeMounts {
+		volume := podVolume(pod, mount.Name)
+		if volume == nil || volume.Projected == nil {
+			continue
+		}
+		if mount.SubPath != "" || mount.SubPathExpr != "" {
+			return nil, fmt.Errorf("volume mount %s of container %s cannot use a subPath of a projected volume", mount.Name, container.Name)
+		}
+		generated := 0
+		add := func(file projectedFile, filePath string, mode *int32) {
+			file.target = path.Join(mount.MountPath, filePath)
+			file.mode = mode
+			if file.mode == nil {
+				file.mode = volume.Projected.DefaultMode
+			}
+			if file.generated() {
+				file.secret = projectedSecretName(pod, volume.Name, generated)
+				generated++
+			}
+			files = append(files, file)
+		}
+
+		for _, source := range volume.Projected.Sources {
+			switch {
+			case source.Secret != nil:
+				items, err := keyItems(source.Secret.Items, secretDataKey, "secret", source.Secret.Name)
+				if err != nil {
+					return nil, err
+				}
+				for _, item := range items {
+					add(projectedFile{secret: source.Secret.Name}, item.Path, item.Mode)
+				}
+			case source.ConfigMap != nil:
+				if source.ConfigMap.Name != kubeRootCAConfigMap {
+					if source.ConfigMap.Optional != nil && *source.ConfigMap.Optional {
+						continue
+					}
+					return nil, fmt.Errorf("config map %s of volume %s does not exist, the only config map is %s", source.ConfigMap.Name, volume.Name, kubeRootCAConfigMap)
+				}
+				items, err := keyItems(source.ConfigMap.Items, kubeRootCAKey, "config map", source.ConfigMap.Name)
+				if err != nil {
+					return nil, err
+				}
+				for _, item := range items {
+					add(projectedFile{clusterCA: true}, item.Path, item.Mode)
+				}
+			case source.DownwardAPI != nil:
+				for i := range source.DownwardAPI.Items {
+					item := &source.DownwardAPI.Items[i]
+					if item.FieldRef == nil {
+						return nil, fmt.Errorf("downward API file %s of volume %s must reference a field, resources are not supported", item.Path, volume.Name)
+					}
+					if _, err := downwardAPIValue(pod, item.FieldRef.FieldPath); err != nil {
+						return nil, err
+					}
+					add(projectedFile{downwardAPI: item}, item.Path, item.Mode)
+				}
+			case source.ServiceAccountToken != nil:
+				add(projectedFile{token: source.ServiceAccountToken}, source.ServiceAccountToken.Path, nil)
+			default:
+				return nil, fmt.Errorf("volume %s projects an unsupported source, only secrets, config map %s, the downward API and service account tokens are", volume.Name, kubeRootCAConfigMap)
+			}
+		}
+	}
+	return files, nil
+}
+
+// podVolume returns the volume of a pod with the given name, nil when there is none
+func podVolume(pod *corev1.Pod, name string) *corev1.Volume {
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == name {
+			return &pod.Spec.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// isProjectedVolume reports whether the named volume of a pod is a projected volume
+func isProjectedVolume(pod *corev1.Pod, name string) bool {
+	volume := podVolume(pod, name)
+	return volume != nil && volume.Projected != nil
+}
+
+// keyItems returns the files of the items of a secret or config map source, which may only
+// project the single key of the object; without items the key is projected under its name
+func keyItems(items []corev1.KeyToPath, key, kind, name string) ([]corev1.KeyToPath, error) {
+	if len(items) == 0 {
+		return []corev1.KeyToPath{{Key: key, Path: key}}, nil
+	}
+	for _, item := range items {
+		if item.Key != key {
+			return nil, fmt.Errorf("%s %s has no key %s, only %s", kind, name, item.Key, key)
+		}
+	}
+	return items, nil
+}
+
+// projectedVolumeArgs returns the run arguments mounting the files of the projected volumes
+// of a container, each from its podman secret. docker has no secrets outside of swarm.
+func projectedVolumeArgs(pod *corev1.Pod, container *corev1.Container, runtime string) ([]string, error) {
+	files, err := projectedFiles(pod, container)
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	if runtime == RuntimeDocker {
+		return nil, fmt.Errorf("projected volumes are not supported by docker")
+	}
+	var args []string
+	for _, file := range files {
+		secret := fmt.Sprintf("%s,type=mount,target=%s", file.secret, file.target)
+		if file.mode != nil {
+			secret += fmt.Sprintf(",mode=%04o", *file.mode)
+		}
+		args = append(args, "--secret", secret)
+	}
+	return args, nil
+}
+
+// downwardAPIValue returns the content of a downward API file, in the format of the kubelet.
+// The pod UID and status are not known before the container is created.
+func downwardAPIValue(pod *corev1.Pod, fieldPath string) (string, error) {
+	switch fieldPath {
+	case "metadata.name":
+		return pod.Name, nil
+	case "metadata.namespace":
+		return pod.Namespace, nil
+	case "metadata.labels":
+		return formatMap(pod.Labels), nil
+	case "metadata.annotations":
+		return formatMap(pod.Annotations), nil
+	case "spec.nodeName":
+		return pod.Spec.NodeName, nil
+	case "spec.serviceAccountName":
+		return pod.Spec.ServiceAccountName, nil
+	}
+	if key, ok := strings.CutPrefix(fieldPath, "metadata.labels['"); ok && strings.HasSuffix(key, "']") {
+		return pod.Labels[strings.TrimSuffix(key, "']")], nil
+	}
+	if key, ok := strings.CutPrefix(fieldPath, "metadata.annotations['"); ok && strings.HasSuffix(key, "']") {
+		return pod.Annotations[strings.TrimSuffix(key, "']")], nil
+	}
+	return "", fmt.Errorf("field %s is not supported in downward API volumes", fieldPath)
+}
+
+// formatMap formats labels or annotations as the kubelet writes them, a sorted key="value"
+// line per entry
+func formatMap(m map[string]string) string {
+	lines := make([]string, 0, len(m))
+	for key, value := range m {
+		lines = append(lines, fmt.Sprintf("%s=%s", key, strconv.Quote(value)))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// SetServiceAccountTokens sets the issuer of the service account tokens of projected volumes
+func (ps *PodStorage) SetServiceAccountTokens(tokens ServiceAccountTokens) {
+	ps.tokens = tokens
+}
+
+// serviceAccountMountPath is where pods find the token, CA and namespace of their service
+// account, and serviceAccountVolume names the projected volume mounted there
+const (
+	serviceAccountMountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceAccountVolume    = "kube-api-access"
+)
+
+// withServiceAccountVolume returns a pod whose containers mount the token, CA and namespace of
+// the service account of the pod, as the ServiceAccount admission plugin adds them, unless the
+// pod opts out with automountServiceAccountToken or mounts something there already. Pods are
+// left as is when the API server has no CA to give them.
+func (ps *PodStorage) withServiceAccountVolume(pod *corev1.Pod) *corev1.Pod {
+	if ps.tokens == nil || (pod.Spec.AutomountServiceAccountToken != nil && !*pod.Spec.AutomountServiceAccountToken) || podVolume(pod, serviceAccountVolume) != nil {
+		return pod
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if path.Clean(mount.MountPath) == serviceAccountMountPath {
+				return pod
+			}
+		}
+	}
+	if _, err := ps.tokens.ClusterCA(); err != nil {
+		klog.V(2).Infof("Not mounting the service account of pod %s: %v", pod.Name, err)
+		return pod
+	}
+
+	pod = pod.DeepCopy()
+	expiration := int64(3607)
+	mode := int32(0644)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: serviceAccountVolume,
+		VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+			DefaultMode: &mode,
+			Sources: []corev1.VolumeProjection{
+				{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", ExpirationSeconds: &expiration}},
+				{ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: kubeRootCAConfigMap},
+					Items:                []corev1.KeyToPath{{Key: kubeRootCAKey, Path: kubeRootCAKey}},
+				}},
+				{DownwardAPI: &corev1.DownwardAPIProjection{Items: []corev1.DownwardAPIVolumeFile{
+					{Path: "namespace", FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.namespace"}},
+				}}},
+			},
+		}},
+	})
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: serviceAccountVolume, MountPath: serviceAccountMountPath, ReadOnly: true})
+	}
+	return pod
+}
+
+// projectedContent returns the content of a generated file of a projected volume
+func (ps *PodStorage) projectedContent(pod *corev1.Pod, file *projectedFile) ([]byte, error) {
+	switch {
+	case file.downwardAPI != nil:
+		value, err := downwardAPIValue(pod, file.downwardAPI.FieldRef.FieldPath)
+		return []byte(value), err
+	case ps.tokens == nil:
+		return nil, fmt.Errorf("service account tokens are not available")
+	case file.token != nil:
+		expiration := int64(3600)
+		if file.token.ExpirationSeconds != nil {
+			expiration = *file.token.ExpirationSeconds
+		}
+		token, err := ps.tokens.IssueToken(pod, file.token.Audience, expiration)
+		return []byte(token), err
+	default:
+		return ps.tokens.ClusterCA()
+	}
+}
+
+// writeProjectedFiles creates the podman secrets of the files podKube generates for the
+// projected volumes of a pod, replacing those of a previous container of the pod
+func (ps *PodStorage) writeProjectedFiles(ctx context.Context, pod *corev1.Pod) error {
+	files, err := projectedFiles(pod, &pod.Spec.Containers[0])
+	if err != nil {
+		return err
+	}
+	ps.removeProjectedFiles(ctx, pod.Name)
+	for i := range files {
+		if !files[i].generated() {
+			continue
+		}
+		content, err := ps.projectedContent(pod, &files[i])
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %v", files[i].target, err)
+		}
+		cmd, cancel := ps.podmanCommand(ctx, "secret", "create", files[i].secret, "-")
+		cmd.Stdin = bytes.NewReader(content)
+		err = cmd.Run()
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to create secret %s of %s: %v", files[i].secret, files[i].target, err)
+		}
+	}
+	return nil
+}
+
+// removeProjectedFiles removes the podman secrets of the generated files of a pod
+func (ps *PodStorage) removeProjectedFiles(ctx context.Context, podName string) {
+	secrets, err := ps.getPodmanSecrets(ctx)
+	if err != nil {
+		klog.Warningf("Failed to list the projected files of pod %s: %v", podName, err)
+		return
+	}
+	for _, secret := range secrets {
+		if isProjectedSecret(secret.Name, podName) {
+			if err := ps.removePodmanSecret(ctx, secret.Name); err != nil {
+				klog.Warningf("Failed to remove projected file %s: %v", secret.Name, err)
+			}
+		}
+	}
+}
+
+// isProjectedSecret reports whether a podman secret holds a generated file of the projected
+// volumes of the named pod, or of any pod when podName is empty
+func isProjectedSecret(secretName, podName string) bool {
+	if podName == "" {
+		return strings.HasPrefix(secretName, projectedSecretPrefix)
+	}
+	return strings.HasPrefix(secretName, projectedSecretPrefix+podName+"_")
+}
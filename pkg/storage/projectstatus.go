@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// Annotations summarizing the pods of a namespace on its project, or namespace, read on its own
+const (
+	runningPodsAnnotation = "podkube.io/running-pods"
+	exitedPodsAnnotation  = "podkube.io/exited-pods"
+)
+
+// projectStatusAnnotations are the annotations set by AnnotateProjectStatus, which are not
+// stored when a client sends them back in an update
+var projectStatusAnnotations = []string{
+	runningPodsAnnotation,
+	exitedPodsAnnotation,
+	cpuUsageAnnotation,
+	memoryUsageAnnotation,
+	usageSampledAnnotation,
+}
+
+// AnnotateProjectStatus annotates the project of a namespace with the number of its running
+// and exited pods and, with pod usage annotations enabled, the total CPU and memory usage of
+// their running containers, for oc describe project to give an overview of the namespace.
+// The annotations are left out when the pods cannot be listed.
+func (c *Cluster) AnnotateProjectStatus(ctx context.Context, project *Project) {
+	podList, err := c.List(ctx, project.Name, "", "")
+	if err != nil {
+		klog.V(2).Infof("No status for project %s: %v", project.Name, err)
+		return
+	}
+
+	running, exited := 0, 0
+	for i := range podList.Items {
+		switch podList.Items[i].Status.Phase {
+		case corev1.PodRunning:
+			running++
+		case corev1.PodSucceeded, corev1.PodFailed:
+			exited++
+		}
+	}
+	if project.Annotations == nil {
+		project.Annotations = map[string]string{}
+	}
+	project.Annotations[runningPodsAnnotation] = strconv.Itoa(running)
+	project.Annotations[exitedPodsAnnotation] = strconv.Itoa(exited)
+
+	if c.podUsageAnnotations.Load() {
+		c.annotateNamespaceUsage(ctx, project, podList.Items)
+	}
+}
+
+// annotateNamespaceUsage sets the usage annotations of a project to the sum of the usage of
+// the running containers of its pods, sampled on the nodes running them
+func (c *Cluster) annotateNamespaceUsage(ctx context.Context, project *Project, pods []corev1.Pod) {
+	ids := map[string][]string{} // Container IDs by node
+	for i := range pods {
+		for _, status := range pods[i].Status.ContainerStatuses {
+			if status.State.Running == nil {
+				continue
+			}
+			if _, id, ok := strings.Cut(status.ContainerID, "://"); ok {
+				ids[pods[i].Spec.NodeName] = append(ids[pods[i].Spec.NodeName], id)
+			}
+		}
+	}
+
+	var cpu, memory float64
+	var sampled []ContainerUsage
+	for nodeName, nodeIDs := range ids {
+		node, ok := c.Node(nodeName)
+		if !ok {
+			continue
+		}
+		usages, err := node.Storage.ContainerUsage(ctx, nodeIDs)
+		if err != nil {
+			klog.V(2).Infof("No usage for project %s on node %s: %v", project.Name, nodeName, err)
+			continue
+		}
+		for _, usage := range usages {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(usage.CPU, "%"), 64)
+			if err != nil {
+				continue
+			}
+			bytes, err := parseByteSize(usage.Memory)
+			if err != nil {
+				continue
+			}
+			cpu += percent
+			memory += bytes
+			sampled = append(sampled, usage)
+		}
+	}
+	if len(sampled) == 0 {
+		return
+	}
+
+	latest := sampled[0].Sampled
+	for _, usage := range sampled[1:] {
+		if usage.Sampled.After(latest) {
+			latest = usage.Sampled
+		}
+	}
+	project.Annotations[cpuUsageAnnotation] = strconv.FormatFloat(cpu, 'f', 2, 64) + "%"
+	project.Annotations[memoryUsageAnnotation] = formatByteSize(memory)
+	project.Annotations[usageSampledAnnotation] = latest.UTC().Format(time.RFC3339)
+}
+
+// byteSizeUnits are the multipliers of the units of the memory usage printed by podman stats
+// (kB, MB, GB, decimal) and docker stats (KiB, MiB, GiB, binary)
+var byteSizeUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseByteSize parses a memory usage such as 12.3MB or 512KiB into bytes
+func parseByteSize(size string) (float64, error) {
+	size = strings.TrimSpace(size)
+	number := strings.TrimRight(size, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	multiplier, ok := byteSizeUnits[size[len(number):]]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in size %q", size)
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", size, err)
+	}
+	return value * multiplier, nil
+}
+
+// formatByteSize formats bytes with decimal units, as podman stats prints memory usage
+func formatByteSize(bytes float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+	unit := 0
+	for bytes >= 1000 && unit < len(units)-1 {
+		bytes /= 1000
+		unit++
+	}
+	return strconv.FormatFloat(bytes, 'f', 2, 64) + units[unit]
+}
+
+// withoutProjectStatus returns annotations without those set by AnnotateProjectStatus
+func withoutProjectStatus(annotations map[string]string) map[string]string {
+	for _, key := range projectStatusAnnotations {
+		delete(annotations, key)
+	}
+	return annotations
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// ErrImagePull is returned when the image of a pod cannot be pulled, with the error of the registry
+var ErrImagePull = errors.New("ErrImagePull")
+
+// ErrImagePullBackOff is returned when creating a pod whose image recently failed to pull,
+// until the backoff of the image expires
+var ErrImagePullBackOff = errors.New("ImagePullBackOff")
+
+const (
+	// The backoff of the kubelet between pulls of an image that fails to pull: doubled from
+	// 10s at each failure, up to 5m
+	initialPullBackoff = 10 * time.Second
+	maxPullBackoff     = 5 * time.Minute
+)
+
+// pullErrorMarkers are found in the errors of the runtimes when an image cannot be pulled,
+// as opposed to the other errors of podman run and docker run
+var pullErrorMarkers = []string{
+	"initializing source",
+	"reading manifest",
+	"manifest unknown",
+	"name unknown",
+	"unauthorized",
+	"authentication required",
+	"access denied",
+	"pull access denied",
+	"repository does not exist",
+	"unable to copy from source",
+	"unable to find image",
+	"failed to resolve image",
+	"error pulling image",
+	"pinging container registry",
+	"short-name",
+}
+
+// pullBackoff records the images that failed to pull, to fail the creation of pods using them
+// right away while they back off, as the kubelet does instead of pulling them on every sync
+type pullBackoff struct {
+	mu     sync.Mutex
+	images map[string]*pullFailure
+}
+
+type pullFailure struct {
+	failures int       // Consecutive failures
+	last     time.Time // Last failure
+	message  string    // Error of the registry on the last failure
+}
+
+// newPullBackoff creates an empty pull backoff
+func newPullBackoff() *pullBackoff {
+	return &pullBackoff{
+		images: make(map[string]*pullFailure),
+	}
+}
+
+// delay returns how long an image backs off after a number of consecutive failures
+func (f *pullFailure) delay() time.Duration {
+	backoff := initialPullBackoff
+	for i := 1; i < f.failures && backoff < maxPullBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxPullBackoff {
+		backoff = maxPullBackoff
+	}
+	return backoff
+}
+
+// check returns ErrImagePullBackOff when an image of the pod is backing off
+func (b *pullBackoff) check(pod *corev1.Pod) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for _, image := range podImages(pod) {
+		failure, ok := b.images[image]
+		if !ok {
+			continue
+		}
+		if remaining := failure.last.Add(failure.delay()).Sub(now); remaining > 0 {
+			return fmt.Errorf("%w: Back-off pulling image %q, retrying in %s: %s", ErrImagePullBackOff, image, remaining.Round(time.Second), failure.message)
+		}
+	}
+	return nil
+}
+
+// failed records the failure of a pod creation, returning ErrImagePull with the registry error
+// when the output of the runtime tells an image could not be pulled, err otherwise
+func (b *pullBackoff) failed(pod *corev1.Pod, output string, err error) error {
+	message := pullErrorMessage(output)
+	if message == "" {
+		return err
+	}
+
+	// The failing image is the one named in the error, or the only one of the pod
+	images := podImages(pod)
+	image := images[0]
+	for _, candidate := range images {
+		if strings.Contains(output, candidate) {
+			image = candidate
+			break
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	failure, ok := b.images[image]
+	if !ok || time.Since(failure.last) > 2*maxPullBackoff {
+		failure = &pullFailure{}
+		b.images[image] = failure
+	}
+	failure.failures++
+	failure.last = time.Now()
+	failure.message = message
+	klog.Warningf("Failed to pull image %q for pod %s/%s, backing off %s: %s", image, pod.Namespace, pod.Name, failure.delay(), message)
+
+	return fmt.Errorf("%w: Failed to pull image %q: %s", ErrImagePull, image, message)
+}
+
+// succeeded forgets the failures of the images of a pod that was created
+func (b *pullBackoff) succeeded(pod *corev1.Pod) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, image := range podImages(pod) {
+		delete(b.images, image)
+	}
+}
+
+// podImages returns the images of the containers of a pod, init containers first
+func podImages(pod *corev1.Pod) []string {
+	var images []string
+	for _, container := range append(append([]corev1.Container(nil), pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+// commandOutput returns the error output of a failed command, which Output keeps in the
+// exit error
+func commandOutput(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(exitErr.Stderr)
+	}
+	return ""
+}
+
+// pullErrorMessage returns the error of the registry from the output of a runtime that failed
+// to pull an image, or an empty string when the output is not about a pull
+func pullErrorMessage(output string) string {
+	lower := strings.ToLower(output)
+	found := false
+	for _, marker := range pullErrorMarkers {
+		if strings.Contains(lower, marker) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return ""
+	}
+
+	// The runtimes print their progress before the error, on its own line, which docker
+	// follows with a usage hint
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	message := ""
+	for i := len(lines) - 1; i >= 0 && message == ""; i-- {
+		if line := strings.TrimSpace(lines[i]); !strings.HasPrefix(line, "See '") {
+			message = line
+		}
+	}
+	for _, prefix := range []string{"Error: ", "docker: ", "Error response from daemon: "} {
+		message = strings.TrimPrefix(message, prefix)
+	}
+	return strings.TrimSuffix(message, ".")
+}
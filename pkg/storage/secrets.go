@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -68,12 +69,12 @@ func (ps *PodStorage) parseRelativeTime(relativeTime string) time.Time {
 }
 
 // podmanSecretToSecret converts a Podman secret to a Kubernetes Secret
-func (ps *PodStorage) podmanSecretToSecret(secret *PodmanSecret) *corev1.Secret {
+func (ps *PodStorage) podmanSecretToSecret(ctx context.Context, secret *PodmanSecret) *corev1.Secret {
 	// Parse creation time from Podman relative format
 	creationTime := metav1.NewTime(ps.parseRelativeTime(secret.CreatedAt))
 
 	// Get the actual secret data
-	secretData, err := ps.getPodmanSecretData(secret.Name)
+	secretData, err := ps.getPodmanSecretData(ctx, secret.Name)
 	if err != nil {
 		klog.Warningf("Failed to get secret data for %s: %v", secret.Name, err)
 		// Use placeholder if we can't get the real data
@@ -90,6 +91,8 @@ func (ps *PodStorage) podmanSecretToSecret(secret *PodmanSecret) *corev1.Secret
 		ObjectMeta: metav1.ObjectMeta{
 			Name:              secret.Name,
 			Namespace:         ps.namespace,
+			UID:               uidFromID("secret", secret.ID),
+			ResourceVersion:   secretResourceVersion(secret.ID),
 			CreationTimestamp: creationTime,
 			Annotations: map[string]string{
 				"podman.io/secret-id": secret.ID,
@@ -104,7 +107,7 @@ func (ps *PodStorage) podmanSecretToSecret(secret *PodmanSecret) *corev1.Secret
 }
 
 // ListSecrets returns a list of secrets from Podman
-func (ps *PodStorage) ListSecrets(namespace string) (*corev1.SecretList, error) {
+func (ps *PodStorage) ListSecrets(ctx context.Context, namespace string) (*corev1.SecretList, error) {
 	// Filter by namespace if specified
 	if namespace != "" && namespace != ps.namespace {
 		return &corev1.SecretList{
@@ -117,7 +120,7 @@ func (ps *PodStorage) ListSecrets(namespace string) (*corev1.SecretList, error)
 	}
 
 	// Get secrets from Podman
-	secrets, err := ps.getPodmanSecrets()
+	secrets, err := ps.getPodmanSecrets(ctx)
 	if err != nil {
 		klog.Errorf("Failed to get Podman secrets: %v", err)
 		return nil, fmt.Errorf("failed to get secrets: %v", err)
@@ -125,7 +128,11 @@ func (ps *PodStorage) ListSecrets(namespace string) (*corev1.SecretList, error)
 
 	var k8sSecrets []corev1.Secret
 	for _, secret := range secrets {
-		k8sSecret := ps.podmanSecretToSecret(&secret)
+		// The files of projected volumes are not secrets of the pods
+		if isProjectedSecret(secret.Name, "") {
+			continue
+		}
+		k8sSecret := ps.podmanSecretToSecret(ctx, &secret)
 		k8sSecrets = append(k8sSecrets, *k8sSecret)
 	}
 
@@ -140,64 +147,85 @@ func (ps *PodStorage) ListSecrets(namespace string) (*corev1.SecretList, error)
 }
 
 // GetSecret returns a specific secret by namespace and name
-func (ps *PodStorage) GetSecret(namespace, name string) (*corev1.Secret, error) {
+func (ps *PodStorage) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
 	// Only support our containers namespace
 	if namespace != "" && namespace != ps.namespace {
 		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
 	}
 
 	// Get specific secret by name
-	secret, err := ps.getPodmanSecret(name)
+	secret, err := ps.getPodmanSecret(ctx, name)
 	if err != nil {
 		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
 	}
 
-	return ps.podmanSecretToSecret(secret), nil
+	return ps.podmanSecretToSecret(ctx, secret), nil
 }
 
 // CreateSecret adds a new secret to storage by creating a Podman secret
-func (ps *PodStorage) CreateSecret(secret *corev1.Secret) (*corev1.Secret, error) {
+func (ps *PodStorage) CreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
 	// Validate namespace
 	if secret.Namespace != ps.namespace {
 		return nil, fmt.Errorf("secrets can only be created in namespace %s", ps.namespace)
 	}
 
 	// Check if secret already exists
-	existing, err := ps.getPodmanSecret(secret.Name)
+	existing, err := ps.getPodmanSecret(ctx, secret.Name)
 	if err == nil && existing != nil {
 		return nil, fmt.Errorf("secret %s/%s already exists", secret.Namespace, secret.Name)
 	}
 
 	// Create the Podman secret using CLI layer
-	err = ps.createPodmanSecret(secret)
+	err = ps.createPodmanSecret(ctx, secret)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get the created secret details and return as Secret
-	createdSecret, err := ps.getPodmanSecret(secret.Name)
+	createdSecret, err := ps.getPodmanSecret(ctx, secret.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get created secret: %v", err)
 	}
 
-	return ps.podmanSecretToSecret(createdSecret), nil
+	return ps.podmanSecretToSecret(ctx, createdSecret), nil
+}
+
+// DryRunCreateSecret validates a secret creation like CreateSecret and returns the secret
+// as it would be created, without creating the podman secret
+func (ps *PodStorage) DryRunCreateSecret(ctx context.Context, secret *corev1.Secret) (*corev1.Secret, error) {
+	if secret.Namespace != ps.namespace {
+		return nil, fmt.Errorf("secrets can only be created in namespace %s", ps.namespace)
+	}
+
+	existing, err := ps.getPodmanSecret(ctx, secret.Name)
+	if err == nil && existing != nil {
+		return nil, fmt.Errorf("secret %s/%s already exists", secret.Namespace, secret.Name)
+	}
+
+	wouldBe := secret.DeepCopy()
+	wouldBe.TypeMeta = metav1.TypeMeta{
+		Kind:       "Secret",
+		APIVersion: "v1",
+	}
+	wouldBe.CreationTimestamp = metav1.Now()
+	return wouldBe, nil
 }
 
 // DeleteSecret removes a secret from storage by removing the Podman secret
-func (ps *PodStorage) DeleteSecret(namespace, name string) error {
+func (ps *PodStorage) DeleteSecret(ctx context.Context, namespace, name string) error {
 	// Validate namespace
 	if namespace != "" && namespace != ps.namespace {
 		return fmt.Errorf("secret %s/%s not found", namespace, name)
 	}
 
 	// Check if secret exists
-	_, err := ps.getPodmanSecret(name)
+	_, err := ps.getPodmanSecret(ctx, name)
 	if err != nil {
 		return fmt.Errorf("secret %s/%s not found", namespace, name)
 	}
 
 	// Remove the secret using CLI layer
-	err = ps.removePodmanSecret(name)
+	err = ps.removePodmanSecret(ctx, name)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Annotations setting the seccomp and AppArmor profiles of containers, which Kubernetes read
+// before the securityContext fields and podman kube play still reads
+const (
+	seccompPodAnnotation              = "seccomp.security.alpha.kubernetes.io/pod"
+	seccompContainerAnnotationPrefix  = "container.seccomp.security.alpha.kubernetes.io/"
+	appArmorContainerAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+)
+
+// Profiles in the format of the annotations
+const (
+	profileRuntimeDefault  = "runtime/default"
+	profileUnconfined      = "unconfined"
+	profileLocalhostPrefix = "localhost/"
+)
+
+// SeccompProfileAnnotation and AppArmorProfileAnnotation report the seccomp and AppArmor
+// profiles the runtime applied to the container of a pod, in the format of the annotations:
+// runtime/default, unconfined or localhost/PROFILE
+const (
+	SeccompProfileAnnotation  = "podkube.io/seccomp-profile"
+	AppArmorProfileAnnotation = "podkube.io/apparmor-profile"
+)
+
+// seccompProfileRoot is the directory of the Localhost seccomp profiles given by a relative
+// path, the one of the kubelet and of podman kube play
+const seccompProfileRoot = "/var/lib/kubelet/seccomp"
+
+// profileOf returns the profile of a securityContext field in the format of the annotations,
+// or "" when it is not set
+func profileOf(profileType, localhostProfile string) string {
+	switch profileType {
+	case string(corev1.SeccompProfileTypeRuntimeDefault):
+		return profileRuntimeDefault
+	case string(corev1.SeccompProfileTypeUnconfined):
+		return profileUnconfined
+	case string(corev1.SeccompProfileTypeLocalhost):
+		return profileLocalhostPrefix + localhostProfile
+	}
+	return ""
+}
+
+// seccompProfile returns the seccomp profile of a container: that of its securityContext,
+// else of the pod securityContext, else of the container and pod annotations; "" when none
+// is set and the runtime default applies
+func seccompProfile(pod *corev1.Pod, container *corev1.Container) string {
+	if sc := container.SecurityContext; sc != nil && sc.SeccompProfile != nil {
+		return profileOf(string(sc.SeccompProfile.Type), stringValue(sc.SeccompProfile.LocalhostProfile))
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.SeccompProfile != nil {
+		return profileOf(string(sc.SeccompProfile.Type), stringValue(sc.SeccompProfile.LocalhostProfile))
+	}
+	if profile, ok := pod.Annotations[seccompContainerAnnotationPrefix+container.Name]; ok {
+		return profile
+	}
+	return pod.Annotations[seccompPodAnnotation]
+}
+
+// appArmorProfile returns the AppArmor profile of a container, read as seccompProfile does;
+// AppArmor had no pod annotation
+func appArmorProfile(pod *corev1.Pod, container *corev1.Container) string {
+	if sc := container.SecurityContext; sc != nil && sc.AppArmorProfile != nil {
+		return profileOf(string(sc.AppArmorProfile.Type), stringValue(sc.AppArmorProfile.LocalhostProfile))
+	}
+	if sc := pod.Spec.SecurityContext; sc != nil && sc.AppArmorProfile != nil {
+		return profileOf(string(sc.AppArmorProfile.Type), stringValue(sc.AppArmorProfile.LocalhostProfile))
+	}
+	return pod.Annotations[appArmorContainerAnnotationPrefix+container.Name]
+}
+
+// stringValue returns the value of an optional string, "" when unset
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// securityOptArgs returns the --security-opt arguments of run applying the seccomp and
+// AppArmor profiles of a container; the runtime defaults need none
+func securityOptArgs(pod *corev1.Pod, container *corev1.Container) []string {
+	var args []string
+	switch profile := seccompProfile(pod, container); {
+	case profile == profileUnconfined:
+		args = append(args, "--security-opt", "seccomp=unconfined")
+	case strings.HasPrefix(profile, profileLocalhostPrefix):
+		path := strings.TrimPrefix(profile, profileLocalhostPrefix)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(seccompProfileRoot, path)
+		}
+		args = append(args, "--security-opt", "seccomp="+path)
+	}
+	switch profile := appArmorProfile(pod, container); {
+	case profile == profileUnconfined:
+		args = append(args, "--security-opt", "apparmor=unconfined")
+	case strings.HasPrefix(profile, profileLocalhostPrefix):
+		args = append(args, "--security-opt", "apparmor="+strings.TrimPrefix(profile, profileLocalhostPrefix))
+	}
+	return args
+}
+
+// profileAnnotations returns the annotations of the containers of a pod setting the profiles of
+// their securityContext fields, for podman kube play, which reads the annotations only
+func profileAnnotations(pod *corev1.Pod) map[string]string {
+	annotations := map[string]string{}
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if profile := seccompProfile(pod, container); profile != "" {
+			annotations[seccompContainerAnnotationPrefix+container.Name] = profile
+		}
+		if profile := appArmorProfile(pod, container); profile != "" {
+			annotations[appArmorContainerAnnotationPrefix+container.Name] = profile
+		}
+	}
+	return annotations
+}
+
+// appliedProfileAnnotations returns the annotations reporting the profiles the runtime applied
+// to a container, from the AppArmor profile and the security options of its inspection. The
+// AppArmor profile is not reported on hosts without AppArmor.
+func appliedProfileAnnotations(appArmor string, securityOpts []string) map[string]string {
+	annotations := map[string]string{SeccompProfileAnnotation: profileRuntimeDefault}
+	for _, opt := range securityOpts {
+		value, ok := strings.CutPrefix(opt, "seccomp=")
+		if !ok {
+			value, ok = strings.CutPrefix(opt, "seccomp:")
+		}
+		switch {
+		case !ok || value == "":
+		case value == profileUnconfined:
+			annotations[SeccompProfileAnnotation] = profileUnconfined
+		case strings.HasPrefix(value, "{"):
+			// docker keeps the content of the profile rather than its path
+			annotations[SeccompProfileAnnotation] = "localhost"
+		default:
+			if relative, err := filepath.Rel(seccompProfileRoot, value); err == nil && !strings.HasPrefix(relative, "..") {
+				value = relative
+			}
+			annotations[SeccompProfileAnnotation] = profileLocalhostPrefix + value
+		}
+	}
+
+	switch {
+	case appArmor == "":
+	case appArmor == profileUnconfined:
+		annotations[AppArmorProfileAnnotation] = profileUnconfined
+	case appArmor == "docker-default" || strings.HasPrefix(appArmor, "containers-default-"):
+		annotations[AppArmorProfileAnnotation] = profileRuntimeDefault
+	default:
+		annotations[AppArmorProfileAnnotation] = profileLocalhostPrefix + appArmor
+	}
+	return annotations
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// sidecarsAnnotation records the names of the sidecar containers of a played pod, separated by
+// commas, on every container of the pod, to report them back as restartable init containers
+const sidecarsAnnotation = "podkube.io/sidecars"
+
+// isSidecar reports whether an init container is a sidecar, an init container with the Always
+// restart policy that keeps running alongside the containers of the pod
+func isSidecar(container *corev1.Container) bool {
+	return container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// playSidecars moves the sidecars of a played pod spec to its containers, ahead of the others,
+// since podman has no restartable init containers: kube play then starts them with the pod
+// and keeps them for its lifetime. It returns the names of the sidecars.
+func playSidecars(spec *corev1.PodSpec) []string {
+	var names []string
+	var sidecars, initContainers []corev1.Container
+	for _, container := range spec.InitContainers {
+		if !isSidecar(&container) {
+			initContainers = append(initContainers, container)
+			continue
+		}
+		container.RestartPolicy = nil
+		sidecars = append(sidecars, container)
+		names = append(names, container.Name)
+	}
+	spec.InitContainers = initContainers
+	spec.Containers = append(sidecars, spec.Containers...)
+	return names
+}
+
+// keepSidecarsRunning makes the sidecars of a played pod restart whenever they exit, as the
+// kubelet restarts them, when the restart policy kube play gave the containers of the pod
+// would not
+func (ps *PodStorage) keepSidecarsRunning(ctx context.Context, pod *corev1.Pod) {
+	if pod.Spec.RestartPolicy == "" || pod.Spec.RestartPolicy == corev1.RestartPolicyAlways {
+		return
+	}
+	for i := range pod.Spec.InitContainers {
+		if !isSidecar(&pod.Spec.InitContainers[i]) {
+			continue
+		}
+		name := pod.Spec.InitContainers[i].Name
+		cmd, cancel := ps.podmanCommand(ctx, "update", "--restart", "always", pod.Name+"-"+name)
+		output, err := cmd.CombinedOutput()
+		cancel()
+		if err != nil {
+			klog.Warningf("Failed to set the restart policy of sidecar %s of pod %s: %v: %s", name, pod.Name, err, strings.TrimSpace(string(output)))
+		}
+	}
+}
+
+// restoreSidecar moves the container of the pod of a single container back to the init
+// containers, with its status, when the container is a sidecar of a played pod
+func restoreSidecar(pod *corev1.Pod) {
+	value, ok := pod.Annotations[sidecarsAnnotation]
+	if !ok {
+		return
+	}
+	delete(pod.Annotations, sidecarsAnnotation)
+	if len(pod.Spec.Containers) != 1 || !slices.Contains(strings.Split(value, ","), pod.Spec.Containers[0].Name) {
+		return
+	}
+
+	always := corev1.ContainerRestartPolicyAlways
+	pod.Spec.InitContainers = append(pod.Spec.InitContainers, pod.Spec.Containers[0])
+	pod.Spec.InitContainers[len(pod.Spec.InitContainers)-1].RestartPolicy = &always
+	pod.Spec.Containers = nil
+	pod.Status.InitContainerStatuses = append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+	pod.Status.ContainerStatuses = nil
+}
+
+// sortInitContainers sorts the init containers of a pod and their statuses by name
+func sortInitContainers(pod *corev1.Pod) {
+	sort.SliceStable(pod.Spec.InitContainers, func(i, j int) bool {
+		return pod.Spec.InitContainers[i].Name < pod.Spec.InitContainers[j].Name
+	})
+	sort.SliceStable(pod.Status.InitContainerStatuses, func(i, j int) bool {
+		return pod.Status.InitContainerStatuses[i].Name < pod.Status.InitContainerStatuses[j].Name
+	})
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/klog/v2"
+)
+
+// StateFile persists the state podKube owns for a resource, which has no podman
+// representation, as a JSON document in the state directory, encrypted at rest as its
+// Encryption sets for the resource. A StateFile without path keeps the state in memory.
+type StateFile struct {
+	Path       string
+	Resource   string // As named in EncryptionConfiguration, e.g. pods or routes.route.openshift.io
+	Encryption *Encryption
+}
+
+// Load reads the state into v, which is left untouched when the file does not exist yet. A
+// file that was not written with the current encryption provider is written again with it.
+func (f StateFile) Load(v interface{}) error {
+	if f.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, stale, err := f.Encryption.Decrypt(f.Resource, data)
+	if err != nil {
+		return fmt.Errorf("failed to read %s state %s: %v", f.Resource, f.Path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s state %s: %v", f.Resource, f.Path, err)
+	}
+	if stale {
+		klog.Infof("Writing %s state %s with the current encryption provider", f.Resource, f.Path)
+		return f.Save(v)
+	}
+	return nil
+}
+
+// Save writes the state of v, replacing the file at once
+func (f StateFile) Save(v interface{}) error {
+	if f.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if data, err = f.Encryption.Encrypt(f.Resource, data); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	tmp := f.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// UlimitsAnnotation sets the resource limits of the container of a pod, which Kubernetes has
+// no field for, separated by commas as --ulimit takes them: name=soft[:hard], such as
+// nofile=65536:65536,memlock=-1
+const UlimitsAnnotation = "podkube.io/ulimits"
+
+// sysctlsAnnotation records the sysctls of a pod on its container, since podman also reports
+// the sysctls it sets by default
+const sysctlsAnnotation = "podkube.io/sysctls"
+
+// ulimits returns the limits of the ulimits annotation of a pod
+func ulimits(pod *corev1.Pod) ([]string, error) {
+	var limits []string
+	for _, limit := range strings.Split(pod.Annotations[UlimitsAnnotation], ",") {
+		if limit = strings.TrimSpace(limit); limit == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(limit, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid ulimit %q in annotation %s, expected name=soft[:hard]", limit, UlimitsAnnotation)
+		}
+		soft, hard, hasHard := strings.Cut(values, ":")
+		if !isLimit(soft) || (hasHard && !isLimit(hard)) {
+			return nil, fmt.Errorf("invalid ulimit %q in annotation %s, expected name=soft[:hard]", limit, UlimitsAnnotation)
+		}
+		limits = append(limits, limit)
+	}
+	return limits, nil
+}
+
+// isLimit reports whether value is a limit of --ulimit, a number or -1 for unlimited
+func isLimit(value string) bool {
+	limit, err := strconv.ParseInt(value, 10, 64)
+	return err == nil && limit >= -1
+}
+
+// sysctlsAndUlimitsArgs returns the run arguments setting the sysctls of the pod
+// securityContext and the limits of its ulimits annotation
+func sysctlsAndUlimitsArgs(pod *corev1.Pod) ([]string, error) {
+	var args []string
+	if sc := pod.Spec.SecurityContext; sc != nil {
+		for _, sysctl := range sc.Sysctls {
+			args = append(args, "--sysctl", fmt.Sprintf("%s=%s", sysctl.Name, sysctl.Value))
+		}
+	}
+	limits, err := ulimits(pod)
+	if err != nil {
+		return nil, err
+	}
+	for _, limit := range limits {
+		args = append(args, "--ulimit", limit)
+	}
+	return args, nil
+}
+
+// encodeSysctls returns the sysctlsAnnotation value of the sysctls of a pod
+func encodeSysctls(sysctls []corev1.Sysctl) string {
+	encoded := make([]string, len(sysctls))
+	for i, sysctl := range sysctls {
+		encoded[i] = fmt.Sprintf("%s=%s", sysctl.Name, sysctl.Value)
+	}
+	return strings.Join(encoded, ",")
+}
+
+// restoreSysctls moves the sysctls recorded in the container annotations to the pod
+// securityContext
+func restoreSysctls(pod *corev1.Pod) {
+	value, ok := pod.Annotations[sysctlsAnnotation]
+	if !ok {
+		return
+	}
+	delete(pod.Annotations, sysctlsAnnotation)
+	var sysctls []corev1.Sysctl
+	for _, sysctl := range strings.Split(value, ",") {
+		if name, value, ok := strings.Cut(sysctl, "="); ok {
+			sysctls = append(sysctls, corev1.Sysctl{Name: name, Value: value})
+		}
+	}
+	if len(sysctls) == 0 {
+		return
+	}
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	pod.Spec.SecurityContext.Sysctls = sysctls
+}
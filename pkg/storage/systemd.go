@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// systemdUnitLabel is set by podman on the containers it runs for a systemd unit, such as
+// those of Quadlet and podman generate systemd, naming the unit
+const systemdUnitLabel = "PODMAN_SYSTEMD_UNIT"
+
+// SystemdUnitAnnotation names the systemd unit managing the container of a pod
+const SystemdUnitAnnotation = "podkube.io/systemd-unit"
+
+// systemdRestartsTTL is how long the restart count of a unit is cached
+const systemdRestartsTTL = 10 * time.Second
+
+// SystemdUnitError is returned when deleting a pod whose container is managed by a systemd
+// unit, which would run it again or fail
+type SystemdUnitError struct {
+	Namespace, Name string
+	Unit            string
+}
+
+func (e *SystemdUnitError) Error() string {
+	return fmt.Sprintf("pod %s/%s is managed by systemd unit %s: stop the unit instead, or delete the pod with --force --grace-period=0 (see --allow-systemd-delete)", e.Namespace, e.Name, e.Unit)
+}
+
+// systemdRestarts reads the restart counts of the systemd units of containers with systemctl
+// show, as units running podman restart their container by replacing it, whose own restart
+// count stays 0. Only the units of the local podman can be read, from the systemd of the user
+// manager for rootless podman or of the system.
+type systemdRestarts struct {
+	user bool // Units of the user manager
+
+	mu     sync.Mutex
+	counts map[string]systemdRestartCount // keyed by unit
+}
+
+type systemdRestartCount struct {
+	count int32
+	read  time.Time
+}
+
+// newSystemdRestarts creates the restart counts reader of the units of the user manager or
+// of the system
+func newSystemdRestarts(user bool) *systemdRestarts {
+	return &systemdRestarts{user: user, counts: map[string]systemdRestartCount{}}
+}
+
+// get returns the restart count of a unit, read at most every systemdRestartsTTL; it reports
+// false when it cannot be read, which a nil reader, for remote podman, never does
+func (s *systemdRestarts) get(ctx context.Context, unit string) (int32, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	cached, ok := s.counts[unit]
+	s.mu.Unlock()
+	if ok && time.Since(cached.read) < systemdRestartsTTL {
+		return cached.count, true
+	}
+
+	args := []string{"show", "--property", "NRestarts", "--value", unit}
+	if s.user {
+		args = append([]string{"--user"}, args...)
+	}
+	output, err := exec.CommandContext(ctx, "systemctl", args...).Output()
+	if err != nil {
+		klog.V(4).Infof("Failed to read the restarts of systemd unit %s: %v", unit, err)
+		return 0, false
+	}
+	count, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	s.mu.Lock()
+	s.counts[unit] = systemdRestartCount{count: int32(count), read: time.Now()}
+	for name, cached := range s.counts {
+		if time.Since(cached.read) > time.Minute {
+			delete(s.counts, name)
+		}
+	}
+	s.mu.Unlock()
+	return int32(count), true
+}
+
+// applySystemdRestarts reports the restarts of the unit of a container as those of the
+// container, when the unit restarted it more often than podman did
+func (ps *PodStorage) applySystemdRestarts(ctx context.Context, container *PodmanContainer, pod *corev1.Pod) {
+	unit := container.Labels[systemdUnitLabel]
+	if unit == "" || len(pod.Status.ContainerStatuses) != 1 {
+		return
+	}
+	if restarts, ok := ps.systemd.get(ctx, unit); ok && restarts > pod.Status.ContainerStatuses[0].RestartCount {
+		pod.Status.ContainerStatuses[0].RestartCount = restarts
+	}
+}
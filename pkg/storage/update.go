@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// InvalidUpdateError lists the changes of a pod update that cannot be applied
+type InvalidUpdateError struct {
+	Errs field.ErrorList
+}
+
+func (e *InvalidUpdateError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInvalidUpdate, e.Errs.ToAggregate())
+}
+
+func (e *InvalidUpdateError) Unwrap() error {
+	return ErrInvalidUpdate
+}
+
+// podUpdate is what an update changes in a pod
+type podUpdate struct {
+	labelsChanged      bool
+	annotationsChanged bool
+	finalizersChanged  bool
+	annotations        map[string]string // The user annotations of the updated pod
+	recreate           []*field.Path     // Changed fields that require a new container
+}
+
+// planUpdate compares a pod update with the current pod. Labels, annotations and finalizers
+// can change in place; container images and environments need the container to be recreated.
+// Any other change to the spec is returned as an error, per field.
+func planUpdate(current, updated *corev1.Pod) (*podUpdate, field.ErrorList) {
+	plan := &podUpdate{
+		labelsChanged:     !equality.Semantic.DeepEqual(current.Labels, updated.Labels),
+		finalizersChanged: !equality.Semantic.DeepEqual(current.Finalizers, updated.Finalizers),
+		annotations:       userAnnotations(updated.Annotations, current.Annotations),
+	}
+	plan.annotationsChanged = !equality.Semantic.DeepEqual(userAnnotations(current.Annotations, current.Annotations), plan.annotations)
+
+	specPath := field.NewPath("spec")
+	containersPath := specPath.Child("containers")
+	if len(updated.Spec.Containers) != len(current.Spec.Containers) {
+		return nil, field.ErrorList{field.Forbidden(containersPath, "pod updates may not add or remove containers")}
+	}
+
+	// Image and environment changes are allowed, any other difference is not
+	normalized := updated.Spec.DeepCopy()
+	setPodDefaults(normalized)
+	for i := range normalized.Containers {
+		container := &normalized.Containers[i]
+		currentContainer := &current.Spec.Containers[i]
+		if container.Image != currentContainer.Image {
+			plan.recreate = append(plan.recreate, containersPath.Index(i).Child("image"))
+		}
+		if !equality.Semantic.DeepEqual(container.Env, currentContainer.Env) {
+			plan.recreate = append(plan.recreate, containersPath.Index(i).Child("env"))
+		}
+		container.Image = currentContainer.Image
+		container.Env = currentContainer.Env
+	}
+
+	var errs field.ErrorList
+	for _, path := range changedFields(specPath, reflect.ValueOf(current.Spec), reflect.ValueOf(*normalized)) {
+		errs = append(errs, field.Forbidden(path, "pod updates may only change labels, annotations, finalizers and the image and env of containers"))
+	}
+	return plan, errs
+}
+
+// changedFields returns the paths of the fields that differ between two structs, descending
+// into the containers of a pod spec to name the changed container fields
+func changedFields(path *field.Path, a, b reflect.Value) []*field.Path {
+	var changed []*field.Path
+	for i := 0; i < a.NumField(); i++ {
+		fieldA, fieldB := a.Field(i), b.Field(i)
+		if equality.Semantic.DeepEqual(fieldA.Interface(), fieldB.Interface()) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("json"), ",")
+		childPath := path.Child(name)
+		if name == "containers" && fieldA.Len() == fieldB.Len() {
+			for j := 0; j < fieldA.Len(); j++ {
+				changed = append(changed, changedFields(childPath.Index(j), fieldA.Index(j), fieldB.Index(j))...)
+			}
+			continue
+		}
+		changed = append(changed, childPath)
+	}
+	return changed
+}
+
+// userAnnotations returns the annotations of a pod without the internal annotations echoed
+// back from the current pod, which are set by podKube and the runtime rather than the user
+func userAnnotations(annotations, current map[string]string) map[string]string {
+	user := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		if currentValue, ok := current[key]; ok && currentValue == value && isInternalAnnotation(key) {
+			continue
+		}
+		user[key] = value
+	}
+	return user
+}
+
+// apply returns the current pod with the update applied, as it is served once updated
+func (p *podUpdate) apply(current, updated *corev1.Pod) *corev1.Pod {
+	result := current.DeepCopy()
+	result.Labels = updated.Labels
+	result.Finalizers = updated.Finalizers
+	if p.annotationsChanged {
+		result.Annotations = mergeUserAnnotations(current.Annotations, p.annotations)
+	}
+	for i := range result.Spec.Containers {
+		result.Spec.Containers[i].Image = updated.Spec.Containers[i].Image
+		result.Spec.Containers[i].Env = updated.Spec.Containers[i].Env
+	}
+	return result
+}
+
+// recreated returns the pod to run in place of current: its spec with the updated images and
+// environments, the updated metadata, and its UID, which the new container keeps
+func (p *podUpdate) recreated(current, updated *corev1.Pod) *corev1.Pod {
+	pod := p.apply(current, updated)
+	pod.Annotations = p.annotations
+	pod.ResourceVersion = ""
+	pod.DeletionTimestamp = nil
+	pod.Status = corev1.PodStatus{}
+	for i := range pod.Spec.Containers {
+		// Containers are run with a single command line
+		container := &pod.Spec.Containers[i]
+		container.Command = append(container.Command, container.Args...)
+		container.Args = nil
+	}
+	return pod
+}
+
+// mergeUserAnnotations returns the internal annotations of a pod along with the given user annotations
+func mergeUserAnnotations(annotations, user map[string]string) map[string]string {
+	merged := make(map[string]string, len(annotations)+len(user))
+	for key, value := range annotations {
+		if isInternalAnnotation(key) {
+			merged[key] = value
+		}
+	}
+	for key, value := range user {
+		merged[key] = value
+	}
+	return merged
+}
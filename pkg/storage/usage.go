@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// usageCacheTTL is how long sampled container usage is served before sampling it again
+const usageCacheTTL = 10 * time.Second
+
+// Annotations carrying the resource usage of a pod, when enabled
+const (
+	cpuUsageAnnotation     = "podkube.io/cpu-usage"
+	memoryUsageAnnotation  = "podkube.io/memory-usage"
+	usageSampledAnnotation = "podkube.io/usage-sampled-at"
+)
+
+// usageFormat is the stats template giving the usage of a container, understood by both
+// podman and docker stats
+const usageFormat = "{{.ID}}\t{{.CPUPerc}}\t{{.MemUsage}}"
+
+// ContainerUsage is the resource usage of a container sampled by the runtime
+type ContainerUsage struct {
+	CPU     string    // CPU usage as a percentage of a CPU, e.g. 1.52%
+	Memory  string    // Memory usage, e.g. 12.3MB
+	Sampled time.Time // When the usage was sampled
+}
+
+// usageCache holds the sampled usage of containers by container ID
+type usageCache struct {
+	mu      sync.Mutex
+	samples map[string]ContainerUsage
+}
+
+// newUsageCache creates an empty usage cache
+func newUsageCache() *usageCache {
+	return &usageCache{
+		samples: make(map[string]ContainerUsage),
+	}
+}
+
+// get returns the usage of containers, sampling those without a recent sample with a single
+// stats command; containers that are not running have no usage
+func (c *usageCache) get(ctx context.Context, command commandFunc, ids []string) (map[string]ContainerUsage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, usage := range c.samples {
+		if now.Sub(usage.Sampled) > usageCacheTTL {
+			delete(c.samples, id)
+		}
+	}
+
+	var stale []string
+	for _, id := range ids {
+		if _, ok := c.samples[id]; !ok {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		cmd, cancel := command(ctx, append([]string{"stats", "--no-stream", "--format", usageFormat}, stale...)...)
+		defer cancel()
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample container usage: %v", err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 3 {
+				continue
+			}
+			memory, _, _ := strings.Cut(fields[2], " / ")
+			usage := ContainerUsage{CPU: strings.TrimSpace(fields[1]), Memory: strings.TrimSpace(memory), Sampled: now}
+			// The runtimes print abbreviated IDs
+			for _, id := range stale {
+				if strings.HasPrefix(id, strings.TrimSpace(fields[0])) {
+					c.samples[id] = usage
+				}
+			}
+		}
+	}
+
+	usages := make(map[string]ContainerUsage, len(ids))
+	for _, id := range ids {
+		if usage, ok := c.samples[id]; ok {
+			usages[id] = usage
+		}
+	}
+	return usages, nil
+}
+
+// ContainerUsage returns the CPU and memory usage of running podman containers, by ID
+func (ps *PodStorage) ContainerUsage(ctx context.Context, ids []string) (map[string]ContainerUsage, error) {
+	if err := ps.checkBackend(); err != nil {
+		return nil, err
+	}
+	return ps.usage.get(ctx, ps.podmanCommand, ids)
+}
+
+// ContainerUsage returns the CPU and memory usage of running docker containers, by ID
+func (ds *DockerStorage) ContainerUsage(ctx context.Context, ids []string) (map[string]ContainerUsage, error) {
+	return ds.usage.get(ctx, ds.dockerCommand, ids)
+}
+
+// annotateUsage sets the usage annotations of a pod from the usage of its running containers:
+// the usage of its container, or the usage of each container by name when it has several
+func annotateUsage(ctx context.Context, backend Backend, pod *corev1.Pod) {
+	names := map[string]string{}
+	var ids []string
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running == nil {
+			continue
+		}
+		if _, id, ok := strings.Cut(status.ContainerID, "://"); ok {
+			names[id] = status.Name
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	usages, err := backend.ContainerUsage(ctx, ids)
+	if err != nil {
+		klog.V(2).Infof("No usage for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return
+	}
+	if len(usages) == 0 {
+		return
+	}
+
+	var cpu, memory []string
+	var sampled time.Time
+	for id, usage := range usages {
+		if len(usages) == 1 {
+			cpu, memory = []string{usage.CPU}, []string{usage.Memory}
+		} else {
+			cpu = append(cpu, names[id]+"="+usage.CPU)
+			memory = append(memory, names[id]+"="+usage.Memory)
+		}
+		if usage.Sampled.After(sampled) {
+			sampled = usage.Sampled
+		}
+	}
+	sort.Strings(cpu)
+	sort.Strings(memory)
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	pod.Annotations[cpuUsageAnnotation] = strings.Join(cpu, ",")
+	pod.Annotations[memoryUsageAnnotation] = strings.Join(memory, ",")
+	pod.Annotations[usageSampledAnnotation] = sampled.UTC().Format(time.RFC3339)
+}
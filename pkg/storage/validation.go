@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// unsupportedDetail explains why a field is reported by UnsupportedPodFields
+const unsupportedDetail = "not supported by podKube, the field would be ignored"
+
+// UnsupportedPodFields returns the fields set in a pod that cannot be honored when its
+// container is created with podman run, and would otherwise be silently dropped. Fields that
+// clients or kube-apiserver default (restartPolicy, dnsPolicy, terminationGracePeriodSeconds,
+// imagePullPolicy, the not-ready and unreachable tolerations...) and the stdin/tty settings used by exec and attach are not reported.
+func UnsupportedPodFields(pod *corev1.Pod) field.ErrorList {
+	return unsupportedPodFields(pod, false)
+}
+
+// KubePlayUnsupportedPodFields returns the fields set in a pod that podman kube play ignores,
+// for the pods RequiresKubePlay sends there
+func KubePlayUnsupportedPodFields(pod *corev1.Pod) field.ErrorList {
+	return unsupportedPodFields(pod, true)
+}
+
+// RequiresKubePlay reports whether a pod cannot be created with podman run and is created with
+// podman kube play instead: pods with several containers, or setting fields only kube play honors
+func RequiresKubePlay(pod *corev1.Pod) bool {
+	if len(pod.Spec.Containers) > 1 {
+		return true
+	}
+	kubePlayUnsupported := map[string]bool{}
+	for _, err := range KubePlayUnsupportedPodFields(pod) {
+		kubePlayUnsupported[err.Field] = true
+	}
+	for _, err := range UnsupportedPodFields(pod) {
+		if !kubePlayUnsupported[err.Field] {
+			return true
+		}
+	}
+	return false
+}
+
+// unsupportedPodFields returns the fields set in a pod that the podman run path, or the podman
+// kube play path when kubePlay is set, cannot honor
+func unsupportedPodFields(pod *corev1.Pod, kubePlay bool) field.ErrorList {
+	var errs field.ErrorList
+	spec := &pod.Spec
+	specPath := field.NewPath("spec")
+
+	// check reports a set field, unless the pod is played and kube play honors the field
+	check := func(path *field.Path, value interface{}, honoredByKubePlay bool) {
+		if !isZero(value) && !(kubePlay && honoredByKubePlay) {
+			errs = append(errs, field.Forbidden(path, unsupportedDetail))
+		}
+	}
+
+	check(specPath.Child("initContainers"), spec.InitContainers, true)
+	check(specPath.Child("ephemeralContainers"), spec.EphemeralContainers, false)
+	for i := range spec.Volumes {
+		// podman run mounts the projected volumes, which kube play does not support
+		if spec.Volumes[i].Projected != nil {
+			if kubePlay {
+				errs = append(errs, field.Forbidden(specPath.Child("volumes").Index(i), unsupportedDetail))
+			}
+			continue
+		}
+		check(specPath.Child("volumes").Index(i), spec.Volumes[i], true)
+	}
+	check(specPath.Child("affinity"), spec.Affinity, false)
+	check(specPath.Child("tolerations"), nonDefaultTolerations(spec.Tolerations), false)
+	check(specPath.Child("topologySpreadConstraints"), spec.TopologySpreadConstraints, false)
+	// podman run applies the seccomp and AppArmor profiles and the sysctls, but no other
+	// security setting
+	if sc := spec.SecurityContext; sc != nil {
+		sc = sc.DeepCopy()
+		sc.SeccompProfile, sc.AppArmorProfile, sc.Sysctls = nil, nil, nil
+		check(specPath.Child("securityContext"), sc, true)
+	}
+	check(specPath.Child("hostNetwork"), spec.HostNetwork, true)
+	check(specPath.Child("hostPID"), spec.HostPID, true)
+	check(specPath.Child("hostIPC"), spec.HostIPC, true)
+	check(specPath.Child("hostUsers"), spec.HostUsers, true)
+	check(specPath.Child("shareProcessNamespace"), spec.ShareProcessNamespace, true)
+	check(specPath.Child("hostname"), spec.Hostname, true)
+	check(specPath.Child("subdomain"), spec.Subdomain, false)
+	check(specPath.Child("imagePullSecrets"), spec.ImagePullSecrets, false)
+	check(specPath.Child("activeDeadlineSeconds"), spec.ActiveDeadlineSeconds, false)
+	check(specPath.Child("priorityClassName"), spec.PriorityClassName, false)
+	check(specPath.Child("runtimeClassName"), spec.RuntimeClassName, false)
+	check(specPath.Child("readinessGates"), spec.ReadinessGates, false)
+	check(specPath.Child("overhead"), spec.Overhead, false)
+	check(specPath.Child("schedulingGates"), spec.SchedulingGates, false)
+	check(specPath.Child("resourceClaims"), spec.ResourceClaims, false)
+	check(specPath.Child("resources"), spec.Resources, false)
+	if kubePlay {
+		for _, annotation := range []string{DevicesAnnotation, UlimitsAnnotation} {
+			if _, ok := pod.Annotations[annotation]; ok {
+				errs = append(errs, field.Forbidden(field.NewPath("metadata", "annotations").Key(annotation), unsupportedDetail))
+			}
+		}
+	}
+
+	for i := range spec.Containers {
+		containerPath := specPath.Child("containers").Index(i)
+		container := &spec.Containers[i]
+
+		check(containerPath.Child("args"), container.Args, true)
+		check(containerPath.Child("workingDir"), container.WorkingDir, true)
+		check(containerPath.Child("ports"), container.Ports, true)
+		check(containerPath.Child("envFrom"), container.EnvFrom, true)
+		for j, env := range container.Env {
+			check(containerPath.Child("env").Index(j).Child("valueFrom"), env.ValueFrom, true)
+		}
+		// podman run passes the devices of extended resources, which kube play ignores
+		check(containerPath.Child("resources"), withoutExtendedResources(container.Resources), true)
+		if kubePlay {
+			for _, name := range extendedResources(container) {
+				errs = append(errs, field.Forbidden(containerPath.Child("resources", "limits").Key(string(name)), unsupportedDetail))
+			}
+		}
+		check(containerPath.Child("resizePolicy"), container.ResizePolicy, false)
+		check(containerPath.Child("restartPolicy"), container.RestartPolicy, false)
+		check(containerPath.Child("volumeMounts"), withoutProjectedMounts(pod, container.VolumeMounts), true)
+		check(containerPath.Child("volumeDevices"), container.VolumeDevices, false)
+		check(containerPath.Child("livenessProbe"), container.LivenessProbe, true)
+		check(containerPath.Child("readinessProbe"), container.ReadinessProbe, false)
+		check(containerPath.Child("startupProbe"), container.StartupProbe, true)
+		check(containerPath.Child("lifecycle"), container.Lifecycle, false)
+		if sc := container.SecurityContext; sc != nil {
+			sc = sc.DeepCopy()
+			sc.SeccompProfile, sc.AppArmorProfile = nil, nil
+			check(containerPath.Child("securityContext"), sc, true)
+		}
+	}
+
+	return errs
+}
+
+// withoutProjectedMounts returns the volume mounts other than those of projected volumes
+func withoutProjectedMounts(pod *corev1.Pod, mounts []corev1.VolumeMount) []corev1.VolumeMount {
+	var others []corev1.VolumeMount
+	for _, mount := range mounts {
+		if !isProjectedVolume(pod, mount.Name) {
+			others = append(others, mount)
+		}
+	}
+	return others
+}
+
+// isZero reports whether value is unset: nil, empty or the zero value of its type
+func isZero(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer:
+		return v.IsNil() || v.Elem().IsZero()
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultParallelism is the number of concurrent podman subprocesses used for per-container work
+	defaultParallelism = 8
+	// enrichmentTimeout bounds the per-container work done for a single list request
+	enrichmentTimeout = 30 * time.Second
+)
+
+// SetParallelism sets how many per-container podman calls (kube generate, inspect) run concurrently
+func (ps *PodStorage) SetParallelism(parallelism int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	ps.parallelism.Store(int32(parallelism))
+}
+
+// forEachParallel calls fn for every index in [0, count) using at most parallelism
+// goroutines. Items not yet started when ctx is done are still passed to fn, which
+// is expected to degrade gracefully (podman calls made with ctx fail immediately).
+func forEachParallel(ctx context.Context, parallelism, count int, fn func(ctx context.Context, i int)) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if parallelism > count {
+		parallelism = count
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(ctx, i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
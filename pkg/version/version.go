@@ -0,0 +1,90 @@
+// Package version holds the build information of the server, set at link time with
+//
+//	-ldflags "-X podman-k8s-adapter/pkg/version.gitTag=v0.3.0 -X podman-k8s-adapter/pkg/version.gitCommit=..."
+//
+// Binaries built without them, e.g. with go build in a checkout, fall back to the VCS
+// information recorded by the go toolchain.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	apimachineryversion "k8s.io/apimachinery/pkg/version"
+)
+
+// Kubernetes API level served, reported as the server version to kubectl and oc for their
+// version skew checks
+const (
+	kubernetesMajor   = "1"
+	kubernetesMinor   = "29"
+	kubernetesVersion = "v1.29.0"
+)
+
+// Set with -ldflags -X
+var (
+	gitTag       string // Release tag, from git describe
+	gitCommit    string // Full commit hash
+	gitTreeState string // clean or dirty
+	buildDate    string // RFC 3339 UTC build date
+)
+
+// Get returns the build information of the server, in the format of GET /version
+func Get() apimachineryversion.Info {
+	info := apimachineryversion.Info{
+		Major:        kubernetesMajor,
+		Minor:        kubernetesMinor,
+		GitVersion:   kubernetesVersion + "-podman-adapter",
+		GitCommit:    gitCommit,
+		GitTreeState: gitTreeState,
+		BuildDate:    buildDate,
+		GoVersion:    runtime.Version(),
+		Compiler:     runtime.Compiler,
+		Platform:     fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+	if gitTag != "" {
+		info.GitVersion += "+" + gitTag
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.GitCommit == "" {
+					info.GitCommit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = setting.Value
+				}
+			case "vcs.modified":
+				if info.GitTreeState == "" {
+					info.GitTreeState = "clean"
+					if setting.Value == "true" {
+						info.GitTreeState = "dirty"
+					}
+				}
+			}
+		}
+	}
+
+	if info.GitCommit == "" {
+		info.GitCommit = "unknown"
+	}
+	if info.GitTreeState == "" {
+		info.GitTreeState = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "1970-01-01T00:00:00Z"
+	}
+	return info
+}
+
+// Tag returns the release tag of the server, or its commit for untagged builds
+func Tag() string {
+	if gitTag != "" {
+		return gitTag
+	}
+	return Get().GitCommit
+}
@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/test/testutil"
+)
+
+// waitPromptness bounds how long oc wait may take once the awaited change happened, below
+// the 5 seconds between the periodic listings of pod watches
+const waitPromptness = 4 * time.Second
+
+// TestOCWait verifies that oc wait returns as soon as the condition it waits for is met
+func TestOCWait(t *testing.T) {
+	testutil.RequireOC(t)
+	testutil.RequirePodman(t)
+
+	// Start the test server
+	testServer := testutil.NewTestServerFromPodKubeServer(t)
+	defer testServer.Close()
+
+	ocHelper := testutil.NewOCHelper(t, testServer.URL)
+	podmanHelper := testutil.NewPodmanHelper(t)
+
+	t.Run("Wait for the Ready condition", func(t *testing.T) {
+		testName := "wait-ready-pod"
+		defer testutil.CleanupContainers(t, testName)
+
+		err := podmanHelper.CreateTestContainer(testName, "alpine:latest")
+		require.NoError(t, err, "Should create test container")
+
+		start := time.Now()
+		output, err := ocHelper.RunOCCommand("wait", "--for=condition=Ready", "pod/"+testName, "-n", "containers", "--timeout=30s")
+		require.NoError(t, err, "oc wait should return once the pod is ready: %s", output)
+		assert.Contains(t, output, "condition met")
+		assert.Less(t, time.Since(start), 2*waitPromptness, "oc wait should not wait for the next poll")
+	})
+
+	t.Run("Wait for a JSONPath value", func(t *testing.T) {
+		testName := "wait-jsonpath-pod"
+		defer testutil.CleanupContainers(t, testName)
+
+		err := podmanHelper.CreateTestContainer(testName, "alpine:latest")
+		require.NoError(t, err, "Should create test container")
+
+		output, err := ocHelper.RunOCCommand("wait", "--for=jsonpath={.status.phase}=Running", "pod/"+testName, "-n", "containers", "--timeout=30s")
+		require.NoError(t, err, "oc wait should return once the pod runs: %s", output)
+		assert.Contains(t, output, "condition met")
+	})
+
+	t.Run("Wait for the deletion", func(t *testing.T) {
+		testName := "wait-delete-pod"
+		defer testutil.CleanupContainers(t, testName)
+
+		err := podmanHelper.CreateTestContainer(testName, "alpine:latest")
+		require.NoError(t, err, "Should create test container")
+		testutil.WaitForCondition(t, func() bool {
+			_, err := ocHelper.RunOCCommand("get", "pod", testName, "-n", "containers")
+			return err == nil
+		}, 10*time.Second, "pod should appear in oc get pod")
+
+		// The container is removed while oc wait is watching the pod
+		go func() {
+			time.Sleep(time.Second)
+			podmanHelper.RemoveTestContainer(testName)
+		}()
+
+		start := time.Now()
+		output, err := ocHelper.RunOCCommand("wait", "--for=delete", "pod/"+testName, "-n", "containers", "--timeout=30s")
+		require.NoError(t, err, "oc wait should return once the pod is deleted: %s", output)
+		assert.Less(t, time.Since(start), time.Second+waitPromptness, "oc wait should not wait for the next poll")
+	})
+}
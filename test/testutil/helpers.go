@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -248,6 +251,24 @@ func RequireOC(t *testing.T) {
 	}
 }
 
+// FakeCommand installs a shell script named name in front of PATH for the
+// duration of the test and returns the directory it was written to
+func FakeCommand(t *testing.T, name, script string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+// FreePort returns a TCP port that is currently free on the loopback interface
+func FreePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
 // CleanupContainers removes all test containers with a specific prefix
 func CleanupContainers(t *testing.T, prefix string) {
 	cmd := exec.Command("podman", "ps", "-a", "--format", "{{.Names}}")
@@ -0,0 +1,77 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestAdmissionDefaults(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	s.SetTolerateUnsupportedFields(true)
+	require.NoError(t, s.SetAdmissionDefaults("team=platform,env=dev", "cpu=100m", "cpu=1,memory=128Mi"))
+
+	body := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web", "labels": {"env": "prod"}},
+		"spec": {"containers": [{"name": "web", "image": "nginx", "resources": {"limits": {"memory": "1Gi"}}}]}}`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", body)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	pod := decodePod(t, recorder.Body.Bytes())
+
+	assert.Equal(t, "containers", pod.Namespace, "the namespace of the URL should be defaulted")
+	assert.Equal(t, "platform", pod.Labels["team"])
+	assert.Equal(t, "prod", pod.Labels["env"], "labels set by the pod should be kept")
+	resources := pod.Spec.Containers[0].Resources
+	assert.Equal(t, "1", resources.Limits.Cpu().String())
+	assert.Equal(t, "1Gi", resources.Limits.Memory().String(), "limits set by the pod should be kept")
+	assert.Equal(t, "100m", resources.Requests.Cpu().String())
+	assert.Equal(t, "1Gi", resources.Requests.Memory().String(), "the request should default to the limit")
+}
+
+func TestAdmissionNameValidation(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	body := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "Web_Server"},
+		"spec": {"containers": [{"name": "my_container", "image": "nginx"}]}}`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	status := decodeStatus(t, recorder.Body.Bytes())
+	assert.Equal(t, "Invalid", string(status.Reason))
+	require.NotNil(t, status.Details)
+	var fields []string
+	for _, cause := range status.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	assert.Equal(t, []string{"metadata.name", "spec.containers[0].name"}, fields, "every invalid name should be reported")
+}
+
+func TestSetAdmissionDefaults(t *testing.T) {
+	tests := []struct {
+		name                     string
+		labels, requests, limits string
+		wantErr                  string
+	}{
+		{name: "empty"},
+		{name: "valid", labels: "team=platform, env=dev", requests: "cpu=100m", limits: "cpu=1,memory=128Mi"},
+		{name: "label without value", labels: "team", wantErr: `"team" is not key=value`},
+		{name: "invalid label value", labels: "team=a b", wantErr: "invalid pod labels"},
+		{name: "unsupported resource", requests: "nvidia.com/gpu=1", wantErr: `unsupported resource "nvidia.com/gpu"`},
+		{name: "invalid quantity", limits: "memory=lots", wantErr: "invalid container limits"},
+		{name: "request above limit", requests: "cpu=2", limits: "cpu=1", wantErr: "default cpu request 2 is greater than its default limit 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.New("127.0.0.1", 0).SetAdmissionDefaults(tt.labels, tt.requests, tt.limits)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
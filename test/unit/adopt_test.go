@@ -0,0 +1,67 @@
+package unit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanRunningWeb installs a podman running a web container of nginx, whose spec kube
+// generate reports, and logs the containers run to dir/runs
+func fakePodmanRunningWeb(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"), []byte(fakePodmanContainers), 0644))
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) cat `+dir+`/ps.json ;;
+inspect) echo '[]' ;;
+kube) printf 'apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: web\n    image: docker.io/library/nginx:latest\n    command: [nginx, -g, daemon off;]\n' ;;
+run) echo "$@" >> `+dir+`/runs; exit 1 ;;
+*) exit 1 ;;
+esac
+`)
+	return dir
+}
+
+func TestAdoptExistingContainer(t *testing.T) {
+	podJSON := func(image string) string {
+		return `{"apiVersion": "v1", "kind": "Pod",
+			"metadata": {"name": "web", "namespace": "containers", "labels": {"app": "web"}},
+			"spec": {"containers": [{"name": "web", "image": "` + image + `", "command": ["nginx"], "args": ["-g", "daemon off;"]}]}}`
+	}
+
+	t.Run("equivalent spec", func(t *testing.T) {
+		dir := fakePodmanRunningWeb(t)
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON("nginx"))
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Contains(t, recorder.Header().Get("Warning"), "adopts the existing container")
+		pod := decodePod(t, recorder.Body.Bytes())
+		assert.Equal(t, "web", pod.Name)
+		assert.Equal(t, "web", pod.Labels["app"])
+		assert.Equal(t, "true", pod.Labels[storage.AdoptedLabel])
+		assert.NoFileExists(t, filepath.Join(dir, "runs"), "no container should be run")
+	})
+
+	t.Run("different spec", func(t *testing.T) {
+		fakePodmanRunningWeb(t)
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON("httpd"))
+		require.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+		status := decodeStatus(t, recorder.Body.Bytes())
+		assert.Equal(t, "AlreadyExists", string(status.Reason))
+		require.Len(t, status.Details.Causes, 1)
+		assert.Equal(t, "spec.containers[0].image", status.Details.Causes[0].Field)
+		assert.Contains(t, status.Details.Causes[0].Message, "docker.io/library/nginx:latest")
+	})
+}
@@ -0,0 +1,69 @@
+package unit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+func TestUserAnnotationsStoredApart(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": "[]"})
+	cluster := storage.NewCluster(newTestNode(t, "node", "", nil))
+
+	_, err := cluster.Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "containers",
+			Annotations: map[string]string{
+				"team":                    "a",
+				"podman.io/container-id":  "mine",
+				"user.podkube.io/comment": "escaped twice",
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+	})
+	require.NoError(t, err)
+
+	runs := podmanCalls(t, filepath.Join(dir, "calls"), "run")
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0], "--annotation team=a")
+	assert.Contains(t, runs[0], "--annotation user.podkube.io/podman.io/container-id=mine", "user annotations with internal keys should be escaped")
+	assert.Contains(t, runs[0], "--annotation user.podkube.io/user.podkube.io/comment=escaped twice")
+}
+
+func TestUserAnnotationsReadBack(t *testing.T) {
+	fakePodman(t, `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`, `[
+	  {"Id": "aaaaaaaaaaaa0001", "Config": {"Annotations": {
+	    "team": "a",
+	    "user.podkube.io/podman.io/container-id": "mine",
+	    "io.podman.annotations.autoremove": "FALSE"
+	  }}}
+	]`)
+
+	annotations := func(hide bool) map[string]string {
+		node := newTestNode(t, "node", "", nil)
+		cluster := storage.NewCluster(node)
+		cluster.SetHideInternalAnnotations(hide)
+		pod, err := cluster.Get(context.Background(), "containers", "web")
+		require.NoError(t, err)
+		return pod.Annotations
+	}
+
+	shown := annotations(false)
+	assert.Equal(t, "a", shown["team"])
+	assert.Equal(t, "mine", shown["podman.io/container-id"], "user annotations should take precedence over internal ones")
+	assert.Equal(t, "FALSE", shown["io.podman.annotations.autoremove"])
+	assert.Contains(t, shown, "podman.io/image-id")
+
+	assert.Equal(t, map[string]string{
+		"team":                   "a",
+		"podman.io/container-id": "mine",
+	}, annotations(true))
+}
@@ -0,0 +1,58 @@
+package unit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestAuditLogger(t *testing.T) {
+	t.Run("Rejects unsupported levels", func(t *testing.T) {
+		_, err := server.NewAuditLogger(filepath.Join(t.TempDir(), "audit.log"), server.AuditLevel("Everything"))
+		assert.Error(t, err, "Unknown audit levels should be rejected")
+	})
+
+	t.Run("Writes one JSON event per line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.log")
+		auditLogger, err := server.NewAuditLogger(path, server.AuditLevelMetadata)
+		require.NoError(t, err)
+
+		for _, verb := range []string{"list", "delete"} {
+			auditLogger.Log(&server.AuditEvent{
+				TypeMeta: metav1.TypeMeta{Kind: "Event", APIVersion: "audit.k8s.io/v1"},
+				Level:    server.AuditLevelMetadata,
+				Stage:    "ResponseComplete",
+				Verb:     verb,
+				User:     server.AuditUserInfo{Username: "system:anonymous"},
+				ObjectRef: &server.AuditObjectReference{
+					Resource:  "pods",
+					Namespace: "containers",
+				},
+				StageTimestamp: metav1.NewMicroTime(time.Now()),
+			})
+		}
+		require.NoError(t, auditLogger.Close())
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		require.Len(t, lines, 2, "Should write one line per event")
+
+		var event server.AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+		assert.Equal(t, "audit.k8s.io/v1", event.APIVersion)
+		assert.Equal(t, "delete", event.Verb)
+		assert.Equal(t, "pods", event.ObjectRef.Resource)
+		assert.Equal(t, "containers", event.ObjectRef.Namespace)
+	})
+}
@@ -0,0 +1,190 @@
+package unit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// authorizationTokens are the token file of the authorization tests
+const authorizationTokens = `# token,user,uid,"groups"
+admin-token,admin,1
+viewer-token,viewer,2,"podkube:read-only"
+dev-token,dev,3,"podkube:namespace:dev, podkube:namespace:test,"
+`
+
+// writeTokenFile writes a static token file and returns its path
+func writeTokenFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// authorizedRequest serves a request received over TLS, with a bearer token or, for
+// kubelets, the client certificate of a node
+func authorizedRequest(s *server.Server, method, path, token, node string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.TLS = &tls.ConnectionState{}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if node != "" {
+		req.TLS.PeerCertificates = []*x509.Certificate{{Subject: pkix.Name{CommonName: "system:node:" + node, Organization: []string{"system:nodes"}}}}
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAuthorizationModes(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetAuthorization("Node, SimpleRBAC, AlwaysAllowReadOnlyForAnonymous", writeTokenFile(t, authorizationTokens), true))
+
+	get, post, put, patch, del := http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete
+	tests := []struct {
+		name    string
+		token   string
+		node    string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"admin deletes a pod", "admin-token", "", del, "/api/v1/namespaces/dev/pods/web", true},
+		{"admin reads the host logs", "admin-token", "", get, "/logs/", true},
+
+		{"viewer lists pods", "viewer-token", "", get, "/api/v1/pods", true},
+		{"viewer gets a secret", "viewer-token", "", get, "/api/v1/namespaces/dev/secrets/token", true},
+		{"viewer creates a pod", "viewer-token", "", post, "/api/v1/namespaces/dev/pods", false},
+		{"viewer deletes a pod", "viewer-token", "", del, "/api/v1/namespaces/dev/pods/web", false},
+		{"viewer execs with GET", "viewer-token", "", get, "/api/v1/namespaces/dev/pods/web/exec?command=sh", false},
+		{"viewer proxies to a pod", "viewer-token", "", get, "/api/v1/namespaces/dev/pods/web/proxy/", false},
+
+		{"developer gets a pod of its namespace", "dev-token", "", get, "/api/v1/namespaces/dev/pods/web", true},
+		{"developer creates a pod in its other namespace", "dev-token", "", post, "/api/v1/namespaces/test/pods", true},
+		{"developer gets its namespace", "dev-token", "", get, "/api/v1/namespaces/dev", true},
+		{"developer lists nodes", "dev-token", "", get, "/api/v1/nodes", true},
+		{"developer gets the version", "dev-token", "", get, "/version", true},
+		{"developer gets a pod of another namespace", "dev-token", "", get, "/api/v1/namespaces/prod/pods/web", false},
+		{"developer lists the pods of all namespaces", "dev-token", "", get, "/api/v1/pods", false},
+		{"developer deletes a node", "dev-token", "", del, "/api/v1/nodes/node1", false},
+		{"developer creates a namespace", "dev-token", "", post, "/api/v1/namespaces", false},
+		{"developer reads the host logs", "dev-token", "", get, "/logs/messages", false},
+		{"developer lists the exec sessions", "dev-token", "", get, "/debug/sessions", false},
+
+		{"kubelet gets its node", "", "node1", get, "/api/v1/nodes/node1", true},
+		{"kubelet patches the status of its node", "", "node1", patch, "/api/v1/nodes/node1/status", true},
+		{"kubelet renews its lease", "", "node1", put, "/apis/coordination.k8s.io/v1/namespaces/kube-node-lease/leases/node1", true},
+		{"kubelet lists pods", "", "node1", get, "/api/v1/pods", true},
+		{"kubelet patches another node", "", "node1", patch, "/api/v1/nodes/node2/status", false},
+		{"kubelet renews the lease of another node", "", "node1", put, "/apis/coordination.k8s.io/v1/namespaces/kube-node-lease/leases/node2", false},
+		{"kubelet deletes a pod", "", "node1", del, "/api/v1/namespaces/dev/pods/web", false},
+		{"kubelet reads secrets", "", "node1", get, "/api/v1/namespaces/dev/secrets/token", false},
+
+		{"anonymous lists pods", "", "", get, "/api/v1/pods", true},
+		{"anonymous reads pod logs", "", "", get, "/api/v1/namespaces/dev/pods/web/log", true},
+		{"anonymous gets a secret", "", "", get, "/api/v1/namespaces/dev/secrets/token", false},
+		{"anonymous reads the host logs", "", "", get, "/logs/", false},
+		{"anonymous creates a pod", "", "", post, "/api/v1/namespaces/dev/pods", false},
+		{"anonymous execs with GET", "", "", get, "/api/v1/namespaces/dev/pods/web/exec?command=sh", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := authorizedRequest(s, tt.method, tt.path, tt.token, tt.node)
+			if tt.allowed {
+				assert.NotEqual(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+			} else {
+				require.Equal(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+				assert.Equal(t, "Forbidden", string(decodeStatus(t, recorder.Body.Bytes()).Reason))
+			}
+		})
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, authorizedRequest(s, get, "/api/v1/pods", "wrong", "").Code)
+	})
+
+	t.Run("forbidden message", func(t *testing.T) {
+		recorder := authorizedRequest(s, del, "/api/v1/namespaces/prod/pods/web", "dev-token", "")
+		assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, `User "dev" cannot delete resource "pods" in API group "" in the namespace "prod"`)
+	})
+
+	t.Run("plain HTTP is not authorized", func(t *testing.T) {
+		recorder := serveRequest(s, post, "/api/v1/namespaces/dev/pods", "application/json", "", "{}")
+		assert.NotEqual(t, http.StatusForbidden, recorder.Code)
+	})
+}
+
+func TestAuthorizationAlwaysDeny(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetAuthorization("AlwaysDeny", "", true))
+
+	assert.Equal(t, http.StatusForbidden, authorizedRequest(s, http.MethodGet, "/api/v1/pods", "", "").Code)
+	assert.Equal(t, http.StatusOK, authorizedRequest(s, http.MethodGet, "/healthz", "", "").Code, "the health probes should stay open")
+}
+
+func TestSetAuthorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		modes   string
+		tokens  string
+		wantErr string
+	}{
+		{name: "default mode", modes: ""},
+		{name: "empty token file", modes: "SimpleRBAC", tokens: "# no tokens\n"},
+		{name: "unknown mode", modes: "RBAC", wantErr: `unknown authorization mode "RBAC"`},
+		{name: "repeated mode", modes: "Node,Node", wantErr: "listed twice"},
+		{name: "missing uid", modes: "SimpleRBAC", tokens: "token,admin\n", wantErr: "line 1 must be token,user,uid"},
+		{name: "token only", modes: "SimpleRBAC", tokens: "admin-token,admin,1\ntoken\n", wantErr: "line 2 must be token,user,uid"},
+		{name: "empty token", modes: "SimpleRBAC", tokens: ",admin,1\n", wantErr: "line 1 must be token,user,uid"},
+		{name: "empty user", modes: "SimpleRBAC", tokens: "token,,1\n", wantErr: "line 1 must be token,user,uid"},
+		{name: "duplicate token", modes: "SimpleRBAC", tokens: "token,admin,1\ntoken,viewer,2\n", wantErr: "duplicate token on line 2"},
+		{name: "unterminated quote", modes: "SimpleRBAC", tokens: "token,admin,1,\"podkube:read-only\n", wantErr: "invalid token file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenFile := ""
+			if tt.tokens != "" {
+				tokenFile = writeTokenFile(t, tt.tokens)
+			}
+			err := server.New("127.0.0.1", 0).SetAuthorization(tt.modes, tokenFile, true)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("missing token file", func(t *testing.T) {
+		err := server.New("127.0.0.1", 0).SetAuthorization("SimpleRBAC", filepath.Join(t.TempDir(), "missing.csv"), true)
+		assert.ErrorContains(t, err, "failed to read token file")
+	})
+}
+
+func TestAnonymousAuth(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	assert.ErrorContains(t, s.SetAuthorization("AlwaysAllow", "", false), "requires a token file")
+	require.NoError(t, s.SetAuthorization("AlwaysAllow", writeTokenFile(t, authorizationTokens), false))
+
+	recorder := authorizedRequest(s, http.MethodGet, "/api/v1/pods", "", "")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code, "requests without credentials should be rejected")
+	assert.Equal(t, "Unauthorized", string(decodeStatus(t, recorder.Body.Bytes()).Reason))
+
+	assert.Equal(t, http.StatusOK, authorizedRequest(s, http.MethodGet, "/api/v1/pods", "admin-token", "").Code)
+	assert.Equal(t, http.StatusOK, authorizedRequest(s, http.MethodGet, "/api/v1/pods", "", "node1").Code, "client certificates are credentials")
+	assert.Equal(t, http.StatusOK, authorizedRequest(s, http.MethodGet, "/healthz", "", "").Code, "the health probes should stay open")
+	assert.Equal(t, http.StatusOK, getPath(s, "/api/v1/pods").Code, "the plain HTTP listener should not authenticate")
+}
@@ -0,0 +1,100 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// backupStateDir returns a state directory holding certificates, their keys and routes
+func backupStateDir(t *testing.T) string {
+	stateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(stateDir, "pki"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "pki", "ca.crt"), []byte("CA"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "pki", "ca.key"), []byte("KEY"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "routes.json"), []byte("{}"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "routes.json.tmp"), []byte("{"), 0600))
+	return stateDir
+}
+
+func TestBackup(t *testing.T) {
+	t.Run("Holds the state directory without the keys", func(t *testing.T) {
+		var out bytes.Buffer
+		index, err := server.WriteBackup(context.Background(), &out, backupStateDir(t), storage.NewCluster(), false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"routes.json"}, index.State, "Files being written and the pki directory should be left out")
+		assert.False(t, index.Keys)
+
+		backup, err := server.ReadBackup(&out)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"routes.json": []byte("{}")}, backup.State)
+		assert.False(t, backup.Index.Keys)
+		assert.Empty(t, backup.Index.Pods)
+	})
+
+	t.Run("Includes the keys when asked to", func(t *testing.T) {
+		var out bytes.Buffer
+		index, err := server.WriteBackup(context.Background(), &out, backupStateDir(t), storage.NewCluster(), true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pki/ca.crt", "pki/ca.key", "routes.json"}, index.State)
+
+		backup, err := server.ReadBackup(&out)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("KEY"), backup.State["pki/ca.key"])
+		assert.True(t, backup.Index.Keys)
+	})
+
+	t.Run("Backs up a state directory not created yet", func(t *testing.T) {
+		var out bytes.Buffer
+		index, err := server.WriteBackup(context.Background(), &out, filepath.Join(t.TempDir(), "missing"), storage.NewCluster(), false)
+		require.NoError(t, err)
+		assert.Empty(t, index.State)
+	})
+
+	t.Run("Rejects other files", func(t *testing.T) {
+		_, err := server.ReadBackup(bytes.NewReader([]byte("not a backup")))
+		assert.Error(t, err)
+	})
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{newTestNode(t, "node-a", "", nil)}, ""))
+	s.SetSelfSignedCertConfig(backupStateDir(t), nil)
+
+	backup := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/backup", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+	assert.Equal(t, http.StatusForbidden, backup("").Code, "backups should be disabled without a token file")
+
+	tokenFile := filepath.Join(t.TempDir(), "debug-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0600))
+	require.NoError(t, s.SetDiagnostics(tokenFile, nil, ""))
+	assert.Equal(t, http.StatusUnauthorized, backup("wrong").Code)
+
+	recorder := backup("s3cret")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "application/gzip", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "podkube-backup-")
+	read, err := server.ReadBackup(recorder.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"routes.json"}, read.Index.State, "the private keys should never be served")
+	assert.NotContains(t, read.State, "pki/ca.key")
+}
@@ -0,0 +1,40 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+func TestPodBinding(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{
+		"local":  `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`,
+		"remote": "[]",
+	})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-b", "remote", nil),
+	}, ""))
+
+	pod := decodePod(t, getPath(s, "/api/v1/namespaces/containers/pods/web").Body.Bytes())
+	assert.Equal(t, "node-a", pod.Spec.NodeName)
+	assert.Equal(t, "node-a", pod.Status.NominatedNodeName)
+
+	bind := func(target string) int {
+		body := `{"apiVersion": "v1", "kind": "Binding", "metadata": {"name": "web"}, "target": {"kind": "Node", "name": "` + target + `"}}`
+		return serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/binding", "application/json", "", body).Code
+	}
+	assert.Equal(t, http.StatusCreated, bind("node-a"), "binding a pod to its node should be a no-op")
+	assert.Equal(t, http.StatusConflict, bind("node-b"))
+	assert.Equal(t, http.StatusUnprocessableEntity, bind(""))
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/missing/binding", "application/json", "",
+		`{"target": {"name": "node-a"}}`)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
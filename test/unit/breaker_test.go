@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// flakyPodman installs a podman serving fakePodmanContainers that fails every
+// call while the returned file exists
+func flakyPodman(t *testing.T) string {
+	dir := t.TempDir()
+	down := filepath.Join(dir, "down")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"), []byte(fakePodmanContainers), 0644))
+	testutil.FakeCommand(t, "podman", `
+[ -e `+down+` ] && { echo "cannot connect to podman" >&2; exit 125; }
+case "$1" in
+ps) cat `+filepath.Join(dir, "ps.json")+` ;;
+inspect) echo '[]' ;;
+*) exit 1 ;;
+esac
+`)
+	return down
+}
+
+func TestCircuitBreakerOpensAfterFailures(t *testing.T) {
+	down := flakyPodman(t)
+	require.NoError(t, os.WriteFile(down, nil, 0644))
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+	ps.SetCircuitBreaker(2, time.Minute)
+
+	_, err := ps.List(context.Background(), "", "", "")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, storage.ErrPodmanUnavailable), "a single failure should not open the breaker")
+	healthy, _ := ps.BackendStatus()
+	assert.True(t, healthy)
+
+	_, err = ps.List(context.Background(), "", "", "")
+	assert.True(t, errors.Is(err, storage.ErrPodmanUnavailable), "listing with the breaker open should report podman as unavailable, got %v", err)
+	healthy, err = ps.BackendStatus()
+	assert.False(t, healthy)
+	assert.ErrorIs(t, err, storage.ErrPodmanUnavailable)
+
+	// Podman comes back, but the breaker keeps failing fast until the cooldown expires
+	require.NoError(t, os.Remove(down))
+	_, err = ps.Get(context.Background(), "containers", "web")
+	assert.ErrorIs(t, err, storage.ErrPodmanUnavailable)
+}
+
+func TestCircuitBreakerServesDegradedReads(t *testing.T) {
+	down := flakyPodman(t)
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+	ps.SetCircuitBreaker(1, time.Minute)
+
+	podList, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	require.Len(t, podList.Items, 2)
+	assert.NotContains(t, podList.Items[0].Annotations, storage.DegradedAnnotation)
+
+	require.NoError(t, os.WriteFile(down, nil, 0644))
+	podList, err = ps.List(context.Background(), "", "", "")
+	require.NoError(t, err, "the last listing should be served while podman is down")
+	require.Len(t, podList.Items, 2)
+	for _, pod := range podList.Items {
+		assert.Contains(t, pod.Annotations, storage.DegradedAnnotation)
+	}
+}
+
+func TestCircuitBreakerHTTPStatus(t *testing.T) {
+	down := flakyPodman(t)
+	require.NoError(t, os.WriteFile(down, nil, 0644))
+
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+	s.SetCircuitBreaker(1, time.Minute)
+
+	for _, path := range []string{
+		"/api/v1/pods",
+		"/api/v1/namespaces/containers/pods",
+		"/api/v1/namespaces/containers/pods/web",
+	} {
+		t.Run(path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+			assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, recorder.Body.String())
+			var status metav1.Status
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status), "a Status object should be returned")
+			assert.Equal(t, "Status", status.Kind)
+			assert.Equal(t, metav1.StatusReasonServiceUnavailable, status.Reason)
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
@@ -0,0 +1,113 @@
+package unit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// readBundle returns the files of a diagnostics bundle by name, without their directory
+func readBundle(t *testing.T, data []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		require.NoError(t, err)
+		dir, name, ok := strings.Cut(header.Name, "/")
+		require.True(t, ok, header.Name)
+		assert.True(t, strings.HasPrefix(dir, "podkube-diagnostics-"), header.Name)
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[name] = string(content)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	auditLog := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(auditLog, []byte(
+		`{"auditID": "1", "verb": "create", "requestObject": {"data": {"password": "c2VjcmV0"}}, "responseObject": {}}`+"\n"+
+			"not an event\n"+
+			`{"auditID": "2", "verb": "get"}`+"\n"), 0600))
+
+	var out bytes.Buffer
+	err := server.WriteBundle(context.Background(), &out, server.BundleSources{
+		Flags:        map[string]string{"port": "8443", "address": "0.0.0.0"},
+		AuditLogPath: auditLog,
+		Commands: map[string][]string{
+			"echo.txt":   {"echo", "hello"},
+			"failed.txt": {"false"},
+		},
+		Files: map[string][]byte{"config.yaml": []byte("port: 8443\n")},
+	})
+	require.NoError(t, err)
+
+	files := readBundle(t, out.Bytes())
+	assert.Contains(t, files["version.json"], `"gitVersion"`)
+	assert.Equal(t, "address=0.0.0.0\nport=8443\n", files["flags.txt"])
+	assert.Equal(t, "port: 8443\n", files["config.yaml"])
+	assert.Equal(t, "hello\n", files["echo.txt"])
+	assert.Contains(t, files["failed.txt"], "false failed", "a failing command should be reported in its file")
+	assert.NotContains(t, files, "goroutines.txt")
+
+	assert.NotContains(t, files["audit.log"], "c2VjcmV0", "request and response objects should be left out")
+	assert.Contains(t, files["audit.log"], `"auditID":"1"`)
+	assert.Contains(t, files["audit.log"], `"auditID":"2"`)
+	assert.NotContains(t, files["audit.log"], "not an event")
+}
+
+func TestDiagnosticsBundleEndpoint(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{newTestNode(t, "node-a", "", nil)}, ""))
+
+	bundle := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/debug/bundle", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+	assert.Equal(t, http.StatusForbidden, bundle("").Code, "bundles should be disabled without a token file")
+
+	tokenFile := filepath.Join(t.TempDir(), "debug-token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("  \n"), 0600))
+	assert.Error(t, s.SetDiagnostics(tokenFile, nil, ""), "an empty token should be rejected")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0600))
+	require.NoError(t, s.SetDiagnostics(tokenFile, map[string]string{"port": "8443"}, ""))
+
+	assert.Equal(t, http.StatusUnauthorized, bundle("").Code)
+	assert.Equal(t, http.StatusUnauthorized, bundle("wrong").Code)
+
+	recorder := bundle("s3cret")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "application/gzip", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Header().Get("Content-Disposition"), "podkube-diagnostics-")
+	files := readBundle(t, recorder.Body.Bytes())
+	assert.Equal(t, "port=8443\n", files["flags.txt"])
+	assert.Contains(t, files, "version.json")
+	assert.Contains(t, files, "exec-sessions.json")
+	assert.Contains(t, files["goroutines.txt"], "goroutine")
+	assert.Contains(t, files, "nodes/node-a/ps.txt")
+	assert.Contains(t, files, "nodes/node-a/info.txt")
+}
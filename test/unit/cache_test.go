@@ -0,0 +1,87 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanPs installs a podman that logs every ps call and blocks while the
+// returned gate file exists
+func fakePodmanPs(t *testing.T) (calls, gate string) {
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	gate = filepath.Join(dir, "gate")
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps)
+	echo ps >> `+calls+`
+	while [ -e `+gate+` ]; do sleep 0.05; done
+	echo '[]'
+	;;
+esac
+`)
+	return calls, gate
+}
+
+func psCalls(t *testing.T, calls string) int {
+	data, err := os.ReadFile(calls)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return strings.Count(string(data), "ps\n")
+}
+
+func TestContainerCacheServesFreshListings(t *testing.T) {
+	calls, _ := fakePodmanPs(t)
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(time.Minute)
+
+	_, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	_, err = ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, psCalls(t, calls), "second listing should be served from the cache")
+
+	ps.InvalidateCache()
+	_, err = ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, psCalls(t, calls), "listing after invalidation should query podman")
+}
+
+func TestContainerCacheInvalidatedDuringRefresh(t *testing.T) {
+	calls, gate := fakePodmanPs(t)
+	require.NoError(t, os.WriteFile(gate, nil, 0644))
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(time.Minute)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ps.List(context.Background(), "", "", "")
+		done <- err
+	}()
+
+	testutil.WaitForCondition(t, func() bool { return psCalls(t, calls) == 1 }, 5*time.Second, "podman ps to start")
+
+	// A container change lands while podman ps is still running: the result
+	// of that call may predate the change and must not be cached
+	ps.InvalidateCache()
+	require.NoError(t, os.Remove(gate))
+	require.NoError(t, <-done)
+
+	_, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, psCalls(t, calls), "result fetched before the invalidation should not be cached")
+}
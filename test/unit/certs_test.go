@@ -0,0 +1,168 @@
+package unit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// serveSelfSigned runs a server with a self-signed certificate persisted in stateDir
+// and returns the certificate it presents
+func serveSelfSigned(t *testing.T, stateDir string, sans []string) *x509.Certificate {
+	port := testutil.FreePort(t)
+	s := server.New("127.0.0.1", port)
+	s.SetSelfSignedCertConfig(stateDir, sans)
+	go s.ListenAndServeTLSWithSelfSigned()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	caPEM := func() []byte {
+		data, _ := os.ReadFile(filepath.Join(stateDir, "pki", "ca.crt"))
+		return data
+	}
+	var conn *tls.Conn
+	testutil.WaitForCondition(t, func() bool {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM()) {
+			return false
+		}
+		var err error
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{
+			RootCAs:    roots,
+			ServerName: sans[0],
+		})
+		return err == nil
+	}, 10*time.Second, "server should present a certificate signed by the persisted CA")
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestSelfSignedCertPersisted(t *testing.T) {
+	stateDir := t.TempDir()
+
+	first := serveSelfSigned(t, stateDir, []string{"podkube.example.com", "192.0.2.10"})
+	assert.Contains(t, first.DNSNames, "podkube.example.com")
+	assert.Contains(t, first.DNSNames, "localhost")
+	assert.True(t, containsIP(first.IPAddresses, "192.0.2.10"))
+	assert.True(t, containsIP(first.IPAddresses, "127.0.0.1"))
+
+	for _, name := range []string{"ca.key", "serving.key"} {
+		info, err := os.Stat(filepath.Join(stateDir, "pki", name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "%s should only be readable by its owner", name)
+	}
+
+	t.Run("restart reuses the certificate", func(t *testing.T) {
+		second := serveSelfSigned(t, stateDir, []string{"podkube.example.com", "192.0.2.10"})
+		assert.Equal(t, first.SerialNumber, second.SerialNumber)
+	})
+
+	t.Run("new SAN regenerates the serving certificate with the same CA", func(t *testing.T) {
+		caBefore, err := os.ReadFile(filepath.Join(stateDir, "pki", "ca.crt"))
+		require.NoError(t, err)
+
+		third := serveSelfSigned(t, stateDir, []string{"other.example.com", "podkube.example.com"})
+		assert.NotEqual(t, first.SerialNumber, third.SerialNumber)
+		assert.Contains(t, third.DNSNames, "other.example.com")
+
+		caAfter, err := os.ReadFile(filepath.Join(stateDir, "pki", "ca.crt"))
+		require.NoError(t, err)
+		assert.Equal(t, caBefore, caAfter, "the CA should be kept so clients keep trusting the server")
+	})
+}
+
+func containsIP(ips []net.IP, ip string) bool {
+	for _, candidate := range ips {
+		if candidate.Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTestCert writes a self-signed certificate for commonName and its key as PEM files
+func writeTestCert(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// servedCommonName returns the common name of the certificate presented on port
+func servedCommonName(port int) (string, error) {
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: time.Second}, "tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestProvidedCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeTestCert(t, certFile, keyFile, "first")
+
+	port := testutil.FreePort(t)
+	s := server.New("127.0.0.1", port)
+	go s.ListenAndServeTLS(certFile, keyFile)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	}()
+
+	testutil.WaitForCondition(t, func() bool {
+		name, err := servedCommonName(port)
+		return err == nil && name == "first"
+	}, 10*time.Second, "server should present the provided certificate")
+
+	writeTestCert(t, certFile, keyFile, "second")
+	require.NoError(t, s.ReloadCertificate())
+	name, err := servedCommonName(port)
+	require.NoError(t, err)
+	assert.Equal(t, "second", name, "new connections should get the reloaded certificate")
+
+	t.Run("invalid files keep the current certificate", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0600))
+		assert.Error(t, s.ReloadCertificate())
+
+		name, err := servedCommonName(port)
+		require.NoError(t, err)
+		assert.Equal(t, "second", name)
+	})
+}
@@ -0,0 +1,74 @@
+package unit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanCheckpoint installs a podman running the web container, whose checkpoints hold
+// "checkpoint of ID" and whose restores add a container named after --name, and returns
+// the file restored archives are copied to
+func fakePodmanCheckpoint(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"),
+		[]byte(`[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`), 0644))
+	restored := filepath.Join(dir, "restored")
+	testutil.FakeCommand(t, "podman", `
+case "$1 $2" in
+ps*) cat `+dir+`/ps.json ;;
+inspect*) echo '[]' ;;
+"container checkpoint")
+	archive=$4
+	while [ $# -gt 1 ]; do shift; done
+	printf 'checkpoint of %s' "$1" > "$archive"
+	;;
+"container restore")
+	cp "$4" `+restored+`
+	printf '[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}, {"Id": "bbbbbbbbbbbb0002", "Names": ["%s"], "State": "running"}]' "$6" > `+dir+`/ps.json
+	;;
+*) exit 1 ;;
+esac
+`)
+	return restored
+}
+
+func TestPodCheckpointAndRestore(t *testing.T) {
+	restored := fakePodmanCheckpoint(t)
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/checkpoint?leaveRunning=true", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "application/octet-stream", recorder.Header().Get("Content-Type"))
+	archive := recorder.Body.String()
+	assert.Equal(t, "checkpoint of aaaaaaaaaaaa0001", archive)
+
+	assert.Equal(t, http.StatusNotFound,
+		serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/missing/checkpoint", "", "", "").Code)
+	assert.Equal(t, http.StatusConflict,
+		serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/restore", "application/octet-stream", "", archive).Code,
+		"restoring a pod over an existing one should fail")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web-copy/restore", "application/octet-stream", "", archive)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "web-copy", decodePod(t, recorder.Body.Bytes()).Name)
+	data, err := os.ReadFile(restored)
+	require.NoError(t, err)
+	assert.Equal(t, archive, string(data), "the archive should be passed to podman container restore")
+}
+
+func TestDockerCheckpointUnsupported(t *testing.T) {
+	fakeDocker(t, []string{"c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0"}, finalizedInspect)
+	s := newDockerServer(t)
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/checkpoint", "", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,105 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+const kubectlUserAgent = "kubectl/v1.29.0 (linux/amd64) kubernetes/3f7a50f"
+
+// clientList is the body of /debug/clients
+type clientList struct {
+	Clients []struct {
+		Client   string            `json:"client"`
+		Requests map[string]uint64 `json:"requests"`
+		Watches  int               `json:"watches"`
+	} `json:"clients"`
+	Watches []struct {
+		Client    string `json:"client"`
+		UserAgent string `json:"userAgent"`
+		Resource  string `json:"resource"`
+		Namespace string `json:"namespace"`
+	} `json:"watches"`
+}
+
+func getClients(t *testing.T, s *server.Server) *clientList {
+	recorder := getPath(s, "/debug/clients")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var clients clientList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &clients))
+	return &clients
+}
+
+func TestClientTracking(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/containers/pods", nil)
+		req.Header.Set("User-Agent", kubectlUserAgent)
+		s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/namespaces/containers/pods?watch=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("User-Agent", "k9s/0.32.4")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	clients := getClients(t, s)
+	require.Len(t, clients.Watches, 1)
+	assert.Equal(t, "k9s/0.32.4", clients.Watches[0].Client)
+	assert.Equal(t, "pods", clients.Watches[0].Resource)
+	assert.Equal(t, "containers", clients.Watches[0].Namespace)
+	byName := map[string]int{}
+	for i, client := range clients.Clients {
+		byName[client.Client] = i
+	}
+	require.Contains(t, byName, "kubectl/v1.29.0", "clients should be named after the product of their user agent")
+	assert.Equal(t, map[string]uint64{"list": 2}, clients.Clients[byName["kubectl/v1.29.0"]].Requests)
+	require.Contains(t, byName, "k9s/0.32.4")
+	assert.Equal(t, 1, clients.Clients[byName["k9s/0.32.4"]].Watches)
+	assert.Contains(t, byName, "unknown", "requests without user agent should be counted too")
+
+	recorder := getPath(s, "/metrics")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `podkube_requests_total{client="kubectl/v1.29.0",verb="list"} 2`)
+	assert.Contains(t, recorder.Body.String(), `podkube_watches_active{client="k9s/0.32.4"} 1`)
+
+	resp.Body.Close()
+	assert.Eventually(t, func() bool { return len(getClients(t, s).Watches) == 0 }, 5*time.Second, 20*time.Millisecond,
+		"a watch should be forgotten once closed")
+}
+
+func TestClientTrackingLimit(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+	for i := 0; i < 150; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/version", nil)
+		req.Header.Set("User-Agent", "tool-"+strconv.Itoa(i)+"/v1")
+		s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	clients := getClients(t, s)
+	assert.LessOrEqual(t, len(clients.Clients), 101, "clients beyond the limit should be counted together")
+	var other uint64
+	for _, client := range clients.Clients {
+		if client.Client == "other" {
+			for _, count := range client.Requests {
+				other += count
+			}
+		}
+	}
+	assert.Positive(t, other)
+}
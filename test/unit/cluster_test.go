@@ -0,0 +1,190 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanNodes installs a podman serving one container list per connection name
+// ("local" without --remote). podman run replaces the node's list with the new
+// container and is logged to dir/runs, podman rm empties the list. Every call is logged to dir/calls, and a node
+// without a list fails every call.
+func fakePodmanNodes(t *testing.T, containers map[string]string) string {
+	dir := t.TempDir()
+	for node, ps := range containers {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, node+".json"), []byte(ps), 0644))
+	}
+	testutil.FakeCommand(t, "podman", `
+node=local
+if [ "$1" = "--remote" ]; then node=$3; shift 3; fi
+echo "$@" >> `+dir+`/calls
+[ -e `+dir+`/$node.json ] || exit 125
+case "$1" in
+ps) cat `+dir+`/$node.json ;;
+inspect) echo '[]' ;;
+run)
+	while [ "$1" != "--name" ]; do shift; done
+	echo "$node $2" >> `+dir+`/runs
+	echo "[{\"Id\": \"0123456789abcdef$2\", \"Names\": [\"$2\"], \"State\": \"running\"}]" > `+dir+`/$node.json
+	echo 0123456789abcdef$2
+	;;
+kube) printf 'apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: main\n    image: nginx\n' ;;
+stop) ;;
+rm) echo '[]' > `+dir+`/$node.json ;;
+*) exit 1 ;;
+esac
+`)
+	return dir
+}
+
+// assertRuns checks the containers run so far, as "node name" lines
+func assertRuns(t *testing.T, dir, want string) {
+	runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	assert.Equal(t, want, string(runs))
+}
+
+func newTestNode(t *testing.T, name, connection string, labels map[string]string) *storage.Node {
+	node, err := storage.NewNode(name, storage.RuntimePodman, connection, "", labels)
+	require.NoError(t, err)
+	node.Storage.SetCacheTTL(0)
+	return node
+}
+
+func TestClusterList(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{
+		"local":  `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`,
+		"remote": `[{"Id": "bbbbbbbbbbbb0002", "Names": ["db"], "State": "running"}]`,
+	})
+	cluster := storage.NewCluster(
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-b", "remote", nil),
+		newTestNode(t, "node-down", "unreachable", nil),
+	)
+
+	podList, err := cluster.List(context.Background(), "", "", "")
+	require.NoError(t, err, "unreachable nodes should be skipped")
+
+	nodeNames := map[string]string{}
+	for _, pod := range podList.Items {
+		nodeNames[pod.Name] = pod.Spec.NodeName
+	}
+	assert.Equal(t, map[string]string{"web": "node-a", "db": "node-b"}, nodeNames)
+
+	_, err = storage.NewCluster(newTestNode(t, "node-down", "unreachable", nil)).List(context.Background(), "", "", "")
+	assert.Error(t, err, "listing should fail when no node can be reached")
+}
+
+func TestClusterScheduling(t *testing.T) {
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "containers"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: name, Image: "alpine"}}},
+		}
+	}
+
+	t.Run("node selector", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+		cluster := storage.NewCluster(
+			newTestNode(t, "node-a", "", nil),
+			newTestNode(t, "node-b", "remote", map[string]string{"disk": "ssd"}),
+		)
+
+		pod := newPod("fast")
+		pod.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+		created, err := cluster.Create(context.Background(), pod)
+		require.NoError(t, err)
+		assert.Equal(t, "node-b", created.Spec.NodeName)
+
+		assertRuns(t, dir, "remote fast\n")
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+		cluster := storage.NewCluster(
+			newTestNode(t, "node-a", "", nil),
+			newTestNode(t, "node-b", "remote", nil),
+		)
+
+		for _, name := range []string{"one", "two"} {
+			_, err := cluster.Create(context.Background(), newPod(name))
+			require.NoError(t, err)
+		}
+		assertRuns(t, dir, "local one\nremote two\n")
+	})
+
+	t.Run("default node", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+		cluster := storage.NewCluster(
+			newTestNode(t, "node-a", "", nil),
+			newTestNode(t, "node-b", "remote", map[string]string{"disk": "ssd"}),
+		)
+		assert.Error(t, cluster.SetDefaultNode("node-z"))
+		require.NoError(t, cluster.SetDefaultNode("node-b"))
+
+		for _, name := range []string{"one", "two"} {
+			_, err := cluster.Create(context.Background(), newPod(name))
+			require.NoError(t, err)
+		}
+		pinned := newPod("pinned")
+		pinned.Spec.NodeName = "node-a"
+		_, err := cluster.Create(context.Background(), pinned)
+		require.NoError(t, err)
+
+		assertRuns(t, dir, "remote one\nremote two\nlocal pinned\n")
+	})
+
+	t.Run("unschedulable", func(t *testing.T) {
+		fakePodmanNodes(t, map[string]string{"local": "[]"})
+		cluster := storage.NewCluster(newTestNode(t, "node-a", "", nil))
+
+		pod := newPod("nowhere")
+		pod.Spec.NodeSelector = map[string]string{"gpu": "true"}
+		_, err := cluster.Create(context.Background(), pod)
+		assert.True(t, errors.Is(err, storage.ErrUnschedulable), "got %v", err)
+
+		pod = newPod("missing-node")
+		pod.Spec.NodeName = "node-z"
+		_, err = cluster.Create(context.Background(), pod)
+		assert.True(t, errors.Is(err, storage.ErrUnschedulable), "got %v", err)
+	})
+}
+
+func TestNodesAPI(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+	s := server.New("127.0.0.1", 0)
+	err := s.SetNodes([]*storage.Node{
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-b", "remote", map[string]string{"zone": "lab"}),
+	}, "")
+	require.NoError(t, err)
+
+	recorder := getPath(s, "/api/v1/nodes")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var nodeList corev1.NodeList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &nodeList))
+	require.Len(t, nodeList.Items, 2)
+	assert.Equal(t, "node-a", nodeList.Items[0].Name)
+	assert.Equal(t, "lab", nodeList.Items[1].Labels["zone"])
+	assert.Equal(t, "node-b", nodeList.Items[1].Labels["kubernetes.io/hostname"])
+
+	recorder = getPath(s, "/api/v1/nodes/node-b")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = getPath(s, "/api/v1/nodes/node-z")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,207 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"sigs.k8s.io/yaml"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func serveRequest(s *server.Server, method, path, contentType, accept, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAcceptNegotiation(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "application/json", want: "application/json"},
+		{accept: "application/yaml", want: "application/yaml"},
+		{accept: "application/yaml, application/json", want: "application/yaml"},
+		{accept: "text/html, application/json;q=0.9", want: "application/json"},
+		{accept: "application/json;as=Table;g=meta.k8s.io;v=v1, application/yaml", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "text/html", want: "application/json"},
+		{accept: "application/vnd.kubernetes.protobuf, application/json", want: "application/vnd.kubernetes.protobuf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			recorder := serveRequest(s, http.MethodGet, "/api/v1/namespaces", "", tt.accept, "")
+			require.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tt.want, recorder.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestYAMLAndProtobufResponses(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	t.Run("yaml", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodGet, "/api/v1/namespaces", "", "application/yaml", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var namespaceList corev1.NamespaceList
+		require.NoError(t, yaml.UnmarshalStrict(recorder.Body.Bytes(), &namespaceList))
+		assert.Equal(t, "NamespaceList", namespaceList.Kind)
+		assert.NotEmpty(t, namespaceList.Items)
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodGet, "/api/v1/namespaces", "", "application/vnd.kubernetes.protobuf", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		scheme := runtime.NewScheme()
+		require.NoError(t, corev1.AddToScheme(scheme))
+		var namespaceList corev1.NamespaceList
+		_, _, err := protobuf.NewSerializer(scheme, scheme).Decode(recorder.Body.Bytes(), nil, &namespaceList)
+		require.NoError(t, err)
+		assert.NotEmpty(t, namespaceList.Items)
+	})
+
+	t.Run("protobuf falls back to JSON without a protobuf encoding", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodGet, "/apis/project.openshift.io/v1/projects", "", "application/vnd.kubernetes.protobuf", "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		assert.True(t, json.Valid(recorder.Body.Bytes()))
+	})
+}
+
+func TestVersionNegotiation(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodGet, "/version", "", "application/yaml", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/yaml", recorder.Header().Get("Content-Type"))
+	var version map[string]string
+	require.NoError(t, yaml.Unmarshal(recorder.Body.Bytes(), &version))
+	assert.Equal(t, "1", version["major"])
+
+	recorder = serveRequest(s, http.MethodGet, "/version", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &version))
+	assert.Equal(t, "1", version["major"])
+}
+
+func TestRequestBodyDecoding(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	podYAML := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  namespace: containers
+spec:
+  containers:
+  - name: web
+    image: nginx
+`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/yaml", "application/yaml", podYAML)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "application/yaml", recorder.Header().Get("Content-Type"))
+	var pod corev1.Pod
+	require.NoError(t, yaml.Unmarshal(recorder.Body.Bytes(), &pod))
+	assert.Equal(t, "web", pod.Name)
+	assertRuns(t, dir, "local web\n")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/yaml", "", "metadata: [")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "text/plain", "", podYAML)
+	assert.Equal(t, http.StatusUnsupportedMediaType, recorder.Code)
+	assertRuns(t, dir, "local web\n")
+}
+
+func TestFieldValidation(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	unknownFieldJSON := `{"apiVersion": "v1", "kind": "Pod",
+		"metadata": {"name": "web", "namespace": "containers"},
+		"spec": {"containers": [{"name": "web", "image": "nginx", "imagePullPolicyy": "Always"}]}}`
+	duplicateFieldYAML := `apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+  name: web2
+  namespace: containers
+spec:
+  containers:
+  - name: web
+    image: nginx
+`
+	create := func(contentType, fieldValidation, body string) *httptest.ResponseRecorder {
+		path := "/api/v1/namespaces/containers/pods?dryRun=All"
+		if fieldValidation != "" {
+			path += "&fieldValidation=" + fieldValidation
+		}
+		return serveRequest(s, http.MethodPost, path, contentType, "", body)
+	}
+
+	t.Run("strict rejects unknown fields", func(t *testing.T) {
+		recorder := create("application/json", "Strict", unknownFieldJSON)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "imagePullPolicyy")
+	})
+
+	t.Run("strict rejects duplicate YAML keys", func(t *testing.T) {
+		recorder := create("application/yaml", "Strict", duplicateFieldYAML)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "name")
+	})
+
+	t.Run("warn is the default", func(t *testing.T) {
+		for _, fieldValidation := range []string{"", "Warn"} {
+			recorder := create("application/json", fieldValidation, unknownFieldJSON)
+			require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+			warnings := recorder.Header().Values("Warning")
+			require.Len(t, warnings, 1)
+			assert.True(t, strings.HasPrefix(warnings[0], "299 - "))
+			assert.Contains(t, warnings[0], "imagePullPolicyy")
+		}
+
+		recorder := create("application/yaml", "Warn", duplicateFieldYAML)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.NotEmpty(t, recorder.Header().Values("Warning"))
+	})
+
+	t.Run("ignore drops unknown fields", func(t *testing.T) {
+		recorder := create("application/json", "Ignore", unknownFieldJSON)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Empty(t, recorder.Header().Values("Warning"))
+	})
+
+	t.Run("valid bodies pass strict validation", func(t *testing.T) {
+		recorder := create("application/json", "Strict", dryRunPodJSON)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Empty(t, recorder.Header().Values("Warning"))
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		recorder := create("application/json", "Loose", dryRunPodJSON)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
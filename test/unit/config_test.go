@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/config"
+)
+
+func writeConfig(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+// configFlags defines a few of the flags the server sets from its config file
+func configFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Duration("cache-ttl", 2*time.Second, "")
+	fs.Int("podman-parallelism", 8, "")
+	fs.Int("podman-failure-threshold", 5, "")
+	fs.String("host", "localhost", "")
+	return fs
+}
+
+func TestConfigLoad(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), `
+host: 0.0.0.0
+port: 9443
+podman:
+  cacheTTL: 5s
+  parallelism: 4
+  failureThreshold: 0
+logLevel: 3
+`)
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"host":                     "0.0.0.0",
+		"port":                     "9443",
+		"cache-ttl":                "5s",
+		"podman-parallelism":       "4",
+		"podman-failure-threshold": "0",
+		"v":                        "3",
+	}, cfg.FlagValues())
+}
+
+func TestConfigLoadRejectsUnknownFields(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "podman:\n  cacheSize: 100\n")
+	_, err := config.Load(path)
+	assert.Error(t, err)
+}
+
+func TestConfigApply(t *testing.T) {
+	dir := t.TempDir()
+	fs := configFlags()
+	require.NoError(t, fs.Parse([]string{"-podman-parallelism=2"}))
+	commandLine := config.Snapshot(fs)
+
+	cfg, err := config.Load(writeConfig(t, dir, "podman:\n  cacheTTL: 10s\n  parallelism: 16\n"))
+	require.NoError(t, err)
+	require.NoError(t, cfg.Apply(fs, commandLine, nil))
+	assert.Equal(t, "10s", fs.Lookup("cache-ttl").Value.String())
+	assert.Equal(t, "16", fs.Lookup("podman-parallelism").Value.String())
+
+	t.Run("invalid value leaves every flag unchanged", func(t *testing.T) {
+		cfg, err := config.Load(writeConfig(t, dir, "host: example.com\npodman:\n  cacheTTL: 1s\n  parallelism: 4\n  failureThreshold: 3\n"))
+		require.NoError(t, err)
+
+		// A flag rejecting its value, applied among valid ones in random order
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.Duration("cache-ttl", 2*time.Second, "")
+		fs.Int("podman-parallelism", 8, "")
+		fs.String("host", "localhost", "")
+		fs.Func("podman-failure-threshold", "", func(string) error { return assert.AnError })
+
+		before := config.Snapshot(fs)
+		for i := 0; i < 10; i++ {
+			assert.Error(t, cfg.Apply(fs, before, nil))
+			assert.Equal(t, before, config.Snapshot(fs))
+		}
+	})
+
+	t.Run("removed setting goes back to its command line value", func(t *testing.T) {
+		cfg, err := config.Load(writeConfig(t, dir, "podman:\n  cacheTTL: 10s\n"))
+		require.NoError(t, err)
+		require.NoError(t, cfg.Apply(fs, commandLine, nil))
+		assert.Equal(t, "10s", fs.Lookup("cache-ttl").Value.String())
+		assert.Equal(t, "2", fs.Lookup("podman-parallelism").Value.String())
+	})
+
+	t.Run("kept flags are not changed", func(t *testing.T) {
+		cfg, err := config.Load(writeConfig(t, dir, "host: example.com\npodman:\n  parallelism: 4\n"))
+		require.NoError(t, err)
+		require.NoError(t, cfg.Apply(fs, commandLine, map[string]bool{"host": true}))
+		assert.Equal(t, "localhost", fs.Lookup("host").Value.String())
+		assert.Equal(t, "4", fs.Lookup("podman-parallelism").Value.String())
+	})
+}
+
+func TestConfigWatch(t *testing.T) {
+	path := writeConfig(t, t.TempDir(), "port: 8443\n")
+
+	changed := make(chan struct{}, 1)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go config.Watch(path, 10*time.Millisecond, stopCh, func() { changed <- struct{}{} })
+
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("modifying the config file should be detected")
+	}
+}
@@ -0,0 +1,64 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// crashLoopScript is a podman with a single container, web, that just started again after
+// as many restarts as dir/restarts holds
+const crashLoopScript = `
+case "$1" in
+ps) cat <<JSON
+[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running",
+  "Restarts": $(cat %[1]s/restarts), "Created": 1714557600, "StartedAt": $(date +%%s)}]
+JSON
+;;
+inspect) echo '[]' ;;
+*) exit 1 ;;
+esac
+`
+
+func TestCrashLoopBackOff(t *testing.T) {
+	dir := t.TempDir()
+	testutil.FakeCommand(t, "podman", fmt.Sprintf(crashLoopScript, dir))
+	setRestarts := func(restarts int) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "restarts"), []byte(fmt.Sprint(restarts)), 0644))
+	}
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+
+	getStatus := func() corev1.ContainerStatus {
+		pod, err := ps.Get(context.Background(), "containers", "web")
+		require.NoError(t, err)
+		require.Len(t, pod.Status.ContainerStatuses, 1)
+		return pod.Status.ContainerStatuses[0]
+	}
+
+	setRestarts(0)
+	status := getStatus()
+	require.NotNil(t, status.State.Running)
+	assert.True(t, status.Ready)
+
+	setRestarts(1)
+	assert.NotNil(t, getStatus().State.Running, "a single restart is no crash loop")
+
+	setRestarts(3)
+	status = getStatus()
+	require.NotNil(t, status.State.Waiting, "a container that keeps restarting should be in a crash loop")
+	assert.Equal(t, "CrashLoopBackOff", status.State.Waiting.Reason)
+	assert.Contains(t, status.State.Waiting.Message, "back-off 40s restarting failed container=web pod=web_containers")
+	assert.False(t, status.Ready)
+	assert.Equal(t, int32(3), status.RestartCount)
+	require.NotNil(t, status.LastTerminationState.Terminated, "the previous run should be the last state")
+}
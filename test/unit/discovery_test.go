@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apidiscoveryv2 "k8s.io/api/apidiscovery/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+const aggregatedDiscoveryAccept = "application/json;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList"
+
+func getDiscovery(s *server.Server, path, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestAggregatedDiscovery(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getDiscovery(s, "/api", aggregatedDiscoveryAccept+",application/json")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, aggregatedDiscoveryAccept, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", recorder.Header().Get("Vary"))
+
+	var core apidiscoveryv2.APIGroupDiscoveryList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &core))
+	require.Len(t, core.Items, 1)
+	require.Len(t, core.Items[0].Versions, 1)
+	assert.Equal(t, "v1", core.Items[0].Versions[0].Version)
+
+	resources := map[string]apidiscoveryv2.APIResourceDiscovery{}
+	for _, resource := range core.Items[0].Versions[0].Resources {
+		resources[resource.Resource] = resource
+	}
+	require.Contains(t, resources, "pods")
+	assert.NotContains(t, resources, "pods/exec", "subresources should be nested under their resource")
+	assert.Equal(t, apidiscoveryv2.ScopeNamespace, resources["pods"].Scope)
+	var subresources []string
+	for _, subresource := range resources["pods"].Subresources {
+		subresources = append(subresources, subresource.Subresource)
+	}
+	assert.Contains(t, subresources, "exec")
+	assert.Contains(t, subresources, "log")
+	assert.Equal(t, apidiscoveryv2.ScopeCluster, resources["namespaces"].Scope)
+
+	recorder = getDiscovery(s, "/apis", aggregatedDiscoveryAccept)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var groups apidiscoveryv2.APIGroupDiscoveryList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &groups))
+	var names []string
+	for _, group := range groups.Items {
+		names = append(names, group.Name)
+	}
+	assert.Contains(t, names, "project.openshift.io")
+}
+
+func TestLegacyDiscovery(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	for _, accept := range []string{
+		"",
+		"application/json",
+		// Legacy discovery listed first is preferred
+		"application/json," + aggregatedDiscoveryAccept,
+		// Aggregated discovery is not served as protobuf
+		"application/vnd.kubernetes.protobuf;g=apidiscovery.k8s.io;v=v2;as=APIGroupDiscoveryList",
+	} {
+		t.Run(accept, func(t *testing.T) {
+			recorder := getDiscovery(s, "/api", accept)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			var versions metav1.APIVersions
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &versions))
+			assert.Equal(t, "APIVersions", versions.Kind)
+			assert.Equal(t, []string{"v1"}, versions.Versions)
+
+			recorder = getDiscovery(s, "/apis", accept)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			var groups metav1.APIGroupList
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &groups))
+			assert.Equal(t, "APIGroupList", groups.Kind)
+		})
+	}
+
+	recorder := getDiscovery(s, "/api/v1", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var resources metav1.APIResourceList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resources))
+	assert.Equal(t, "v1", resources.GroupVersion)
+}
+
+func TestDiscoveryVerbsFromRoutes(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	verbs := func(path string) map[string][]string {
+		recorder := getDiscovery(s, path, "")
+		require.Equal(t, http.StatusOK, recorder.Code)
+		var resources metav1.APIResourceList
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resources))
+		byName := map[string][]string{}
+		for _, resource := range resources.APIResources {
+			byName[resource.Name] = resource.Verbs
+		}
+		return byName
+	}
+
+	core := verbs("/api/v1")
+	assert.Equal(t, []string{"create", "delete", "get", "list", "patch", "update", "watch"}, core["pods"])
+	assert.Equal(t, []string{"get"}, core["pods/log"])
+	assert.Equal(t, []string{"create"}, core["pods/binding"])
+	assert.Equal(t, []string{"get", "list"}, core["nodes"], "nodes are read-only")
+	assert.Equal(t, []string{"create", "delete", "get", "list"}, core["secrets"])
+
+	project := verbs("/apis/project.openshift.io/v1")
+	assert.Equal(t, []string{"get"}, project["projects/status"])
+	assert.NotContains(t, project["projects"], "create", "projects cannot be created")
+}
@@ -0,0 +1,78 @@
+package unit
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+func TestHostAliasesAndDNS(t *testing.T) {
+	ndots := "2"
+	tests := []struct {
+		name       string
+		spec       corev1.PodSpec
+		want       []string
+		wantAbsent []string
+	}{
+		{
+			name: "host aliases",
+			spec: corev1.PodSpec{HostAliases: []corev1.HostAlias{{IP: "10.0.0.5", Hostnames: []string{"db", "db.local"}}}},
+			want: []string{"--add-host db:10.0.0.5", "--add-host db.local:10.0.0.5"},
+		},
+		{
+			name: "DNS config",
+			spec: corev1.PodSpec{DNSConfig: &corev1.PodDNSConfig{
+				Nameservers: []string{"1.1.1.1"},
+				Searches:    []string{"example.com"},
+				Options:     []corev1.PodDNSConfigOption{{Name: "ndots", Value: &ndots}, {Name: "edns0"}},
+			}},
+			want:       []string{"--dns 1.1.1.1", "--dns-search example.com", "--dns-option ndots:2", "--dns-option edns0"},
+			wantAbsent: []string{"--dns-search ."},
+		},
+		{
+			name:       "ClusterFirst resolves as Default",
+			spec:       corev1.PodSpec{DNSPolicy: corev1.DNSClusterFirst},
+			wantAbsent: []string{"--dns"},
+		},
+		{
+			name:       "None without nameservers",
+			spec:       corev1.PodSpec{DNSPolicy: corev1.DNSNone},
+			want:       []string{"--dns none"},
+			wantAbsent: []string{"--dns-search"},
+		},
+		{
+			name: "None with nameservers",
+			spec: corev1.PodSpec{DNSPolicy: corev1.DNSNone, DNSConfig: &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}}},
+			want: []string{"--dns 1.1.1.1", "--dns-search ."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := fakePodmanNodes(t, map[string]string{"local": "[]"})
+			cluster := storage.NewCluster(newTestNode(t, "node", "", nil))
+
+			tt.spec.Containers = []corev1.Container{{Name: "web", Image: "nginx"}}
+			_, err := cluster.Create(context.Background(), &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "containers"},
+				Spec:       tt.spec,
+			})
+			require.NoError(t, err)
+
+			runs := podmanCalls(t, filepath.Join(dir, "calls"), "run")
+			require.Len(t, runs, 1, "the pod should be run rather than played")
+			for _, arg := range tt.want {
+				assert.Contains(t, runs[0], arg)
+			}
+			for _, arg := range tt.wantAbsent {
+				assert.NotContains(t, runs[0], arg)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+const fakeDockerInspect = `[
+  {
+    "Id": "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1",
+    "Name": "/web",
+    "Created": "2024-05-01T10:00:00.000000000Z",
+    "Image": "sha256:1111",
+    "RestartCount": 2,
+    "State": {"Status": "running", "ExitCode": 0, "StartedAt": "2024-05-01T10:00:01Z"},
+    "Config": {
+      "Image": "nginx:latest",
+      "Entrypoint": ["/docker-entrypoint.sh"],
+      "Cmd": ["nginx", "-g", "daemon off;"],
+      "Env": ["PATH=/usr/bin", "MODE=prod"],
+      "Labels": {"app": "web", "annotations.podkube.io/team": "a"},
+      "ExposedPorts": {"80/tcp": {}}
+    }
+  },
+  {
+    "Id": "d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4",
+    "Name": "/job",
+    "Created": "2024-05-01T09:00:00Z",
+    "Image": "sha256:2222",
+    "State": {"Status": "exited", "ExitCode": 1, "StartedAt": "2024-05-01T09:00:01Z"},
+    "Config": {"Image": "busybox", "Cmd": ["false"]}
+  }
+]`
+
+// fakeDocker installs a docker answering ps with ids and inspect with inspectOutput.
+// Every call is logged to the returned file; run prints a new container id and rm removes
+// every container.
+func fakeDocker(t *testing.T, ids []string, inspectOutput string) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ids"), []byte(strings.Join(ids, "\n")), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "inspect.json"), []byte(inspectOutput), 0644))
+	log := filepath.Join(dir, "calls")
+	testutil.FakeCommand(t, "docker", `
+echo "$@" >> `+log+`
+case "$1" in
+ps) cat `+dir+`/ids ;;
+inspect) cat `+dir+`/inspect.json ;;
+run) echo e5e5e5e5e5e5e5e5 ;;
+stop) ;;
+rm) : > `+dir+`/ids ;;
+*) exit 1 ;;
+esac
+`)
+	return log
+}
+
+func TestDockerList(t *testing.T) {
+	log := fakeDocker(t, []string{
+		"a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1",
+		"d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4d4",
+	}, fakeDockerInspect)
+	ds := storage.NewDockerStorage()
+	ds.SetCacheTTL(0)
+
+	podList, err := ds.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	require.Len(t, podList.Items, 2)
+	assert.Len(t, podmanCalls(t, log, "inspect"), 1, "all containers should be inspected at once")
+
+	web := podList.Items[0]
+	assert.Equal(t, "web", web.Name, "the leading slash of docker names should be trimmed")
+	assert.Equal(t, "containers", web.Namespace)
+	assert.Equal(t, map[string]string{"app": "web"}, web.Labels)
+	assert.Equal(t, "a", web.Annotations["team"], "prefixed labels should be read back as annotations")
+	require.Len(t, web.Spec.Containers, 1)
+	assert.Equal(t, "nginx:latest", web.Spec.Containers[0].Image)
+	assert.Equal(t, []string{"/docker-entrypoint.sh"}, web.Spec.Containers[0].Command)
+	assert.Equal(t, []corev1.EnvVar{{Name: "PATH", Value: "/usr/bin"}, {Name: "MODE", Value: "prod"}}, web.Spec.Containers[0].Env)
+	assert.Equal(t, []corev1.ContainerPort{{ContainerPort: 80, Protocol: corev1.ProtocolTCP}}, web.Spec.Containers[0].Ports)
+	require.Len(t, web.Status.ContainerStatuses, 1)
+	assert.True(t, strings.HasPrefix(web.Status.ContainerStatuses[0].ContainerID, "docker://"))
+
+	job := podList.Items[1]
+	assert.Equal(t, "containers-exited", job.Namespace)
+
+	podList, err = ds.List(context.Background(), "containers-exited", "", "")
+	require.NoError(t, err)
+	require.Len(t, podList.Items, 1)
+	assert.Equal(t, "job", podList.Items[0].Name)
+}
+
+func TestDockerListWithoutContainers(t *testing.T) {
+	log := fakeDocker(t, nil, "")
+	ds := storage.NewDockerStorage()
+
+	podList, err := ds.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	assert.Empty(t, podList.Items)
+	assert.Empty(t, podmanCalls(t, log, "inspect"), "docker inspect should not be called without containers")
+}
+
+func TestDockerCreate(t *testing.T) {
+	log := fakeDocker(t, nil, "")
+	ds := storage.NewDockerStorage()
+	ds.SetCacheTTL(0)
+
+	_, err := ds.Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "containers", Annotations: map[string]string{"team": "a"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+	})
+	// The fake docker never lists the new container, so reading it back fails
+	assert.ErrorContains(t, err, "failed to get created container")
+
+	runs := podmanCalls(t, log, "run")
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0], "--label annotations.podkube.io/team=a", "annotations should be stored as prefixed labels")
+	assert.NotContains(t, runs[0], "--annotation")
+}
+
+func TestDockerConnection(t *testing.T) {
+	tests := []struct {
+		connection string
+		want       []string
+		wantErr    bool
+	}{
+		{connection: "", want: []string{"docker", "ps"}},
+		{connection: "desktop-linux", want: []string{"docker", "--context", "desktop-linux", "ps"}},
+		{connection: "ssh://user@host", want: []string{"docker", "--host", "ssh://user@host", "ps"}},
+		{connection: "unix:///var/run/docker.sock", want: []string{"docker", "--host", "unix:///var/run/docker.sock", "ps"}},
+		{connection: "http://host:2375", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.connection, func(t *testing.T) {
+			ds := storage.NewDockerStorage()
+			err := ds.SetConnection(tt.connection, "")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ds.CommandLine("ps"))
+		})
+	}
+}
+
+func TestNewBackend(t *testing.T) {
+	backend, err := storage.NewBackend(storage.RuntimeDocker)
+	require.NoError(t, err)
+	assert.Equal(t, storage.RuntimeDocker, backend.Runtime())
+
+	backend, err = storage.NewBackend(storage.RuntimePodman)
+	require.NoError(t, err)
+	assert.Equal(t, storage.RuntimePodman, backend.Runtime())
+
+	_, err = storage.NewBackend("containerd")
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+const dryRunPodJSON = `{"apiVersion": "v1", "kind": "Pod",
+	"metadata": {"name": "web", "namespace": "containers"},
+	"spec": {"containers": [{"name": "web", "image": "nginx"}]}}`
+
+func TestDryRunPodCreate(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", dryRunPodJSON)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var pod corev1.Pod
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &pod))
+	assert.Equal(t, "web", pod.Name)
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "run"), "a dry run should not run a container")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=Some", "application/json", "", dryRunPodJSON)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestDryRunPodDelete(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{
+		"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`,
+	})
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodDelete, "/api/v1/namespaces/containers/pods/web?dryRun=All", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "stop"))
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "rm"))
+
+	recorder = serveRequest(s, http.MethodDelete, "/api/v1/namespaces/containers/pods/missing?dryRun=All", "", "", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestDryRunSchedulingKeepsRoundRobin(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+	cluster := storage.NewCluster(
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-b", "remote", nil),
+	)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "containers"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+	}
+
+	wouldBe, err := cluster.DryRunCreate(context.Background(), pod)
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", wouldBe.Spec.NodeName)
+
+	_, err = cluster.Create(context.Background(), pod)
+	require.NoError(t, err)
+	assertRuns(t, dir, "local web\n")
+}
+
+func TestUnsupportedPodFieldsStatus(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	podJSON := `{"apiVersion": "v1", "kind": "Pod",
+		"metadata": {"name": "web", "namespace": "containers"},
+		"spec": {"tolerations": [{"key": "dedicated"}], "containers": [{"name": "web", "image": "nginx", "readinessProbe": {"tcpSocket": {"port": 80}}}]}}`
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", podJSON)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, metav1.StatusReasonBadRequest, status.Reason)
+	require.NotNil(t, status.Details)
+	var fields []string
+	for _, cause := range status.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	assert.ElementsMatch(t, []string{"spec.tolerations", "spec.containers[0].readinessProbe"}, fields)
+
+	s.SetTolerateUnsupportedFields(true)
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", podJSON)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Len(t, recorder.Header().Values("Warning"), 2)
+}
@@ -0,0 +1,139 @@
+package unit
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// writeEncryptionConfig writes an EncryptionConfiguration for namespaces with the given providers
+func writeEncryptionConfig(t *testing.T, providers string) string {
+	path := filepath.Join(t.TempDir(), "encryption.yaml")
+	config := `apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources: [namespaces]
+    providers:
+` + providers
+	require.NoError(t, os.WriteFile(path, []byte(config), 0600))
+	return path
+}
+
+func aesgcmProvider(names ...string) string {
+	provider := "      - aesgcm:\n          keys:\n"
+	for _, name := range names {
+		secret := base64.StdEncoding.EncodeToString([]byte(strings.Repeat(name[:1], 32)))
+		provider += "            - name: " + name + "\n              secret: " + secret + "\n"
+	}
+	return provider
+}
+
+const identityProvider = "      - identity: {}\n"
+
+func TestEncryption(t *testing.T) {
+	state := []byte(`{"team-a":{"annotations":{"owner":"alice"}}}`)
+
+	t.Run("Encrypts with the first key", func(t *testing.T) {
+		encryption, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key1")))
+		require.NoError(t, err)
+
+		encrypted, err := encryption.Encrypt("namespaces", state)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(encrypted), "k8s:enc:aesgcm:v1:key1:"), "Should be stored like kube-apiserver aesgcm data")
+		assert.NotContains(t, string(encrypted), "alice", "Should not store plaintext")
+
+		decrypted, stale, err := encryption.Decrypt("namespaces", encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, state, decrypted)
+		assert.False(t, stale)
+	})
+
+	t.Run("Decrypts with rotated keys and reports stale data", func(t *testing.T) {
+		old, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key1")))
+		require.NoError(t, err)
+		encrypted, err := old.Encrypt("namespaces", state)
+		require.NoError(t, err)
+
+		rotated, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key2", "key1")))
+		require.NoError(t, err)
+		decrypted, stale, err := rotated.Decrypt("namespaces", encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, state, decrypted)
+		assert.True(t, stale, "Data of an old key should be written again")
+	})
+
+	t.Run("Reads plaintext only with the identity provider", func(t *testing.T) {
+		strict, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key1")))
+		require.NoError(t, err)
+		_, _, err = strict.Decrypt("namespaces", state)
+		assert.Error(t, err, "Plaintext should be rejected without the identity provider")
+
+		migrating, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key1")+identityProvider))
+		require.NoError(t, err)
+		decrypted, stale, err := migrating.Decrypt("namespaces", state)
+		require.NoError(t, err)
+		assert.Equal(t, state, decrypted)
+		assert.True(t, stale, "Plaintext should be written again encrypted")
+	})
+
+	t.Run("Rejects unknown keys and invalid configs", func(t *testing.T) {
+		encryption, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key1")))
+		require.NoError(t, err)
+		encrypted, err := encryption.Encrypt("namespaces", state)
+		require.NoError(t, err)
+
+		other, err := storage.LoadEncryptionConfig(writeEncryptionConfig(t, aesgcmProvider("key2")))
+		require.NoError(t, err)
+		_, _, err = other.Decrypt("namespaces", encrypted)
+		assert.Error(t, err, "Data of a key missing from the config should not be readable")
+
+		_, err = storage.LoadEncryptionConfig(writeEncryptionConfig(t, "      - secretbox: {}\n"))
+		assert.Error(t, err, "Unsupported providers should be rejected")
+	})
+
+	t.Run("Stores as is without config", func(t *testing.T) {
+		encryption, err := storage.LoadEncryptionConfig("")
+		require.NoError(t, err)
+		stored, err := encryption.Encrypt("namespaces", state)
+		require.NoError(t, err)
+		assert.Equal(t, state, stored)
+	})
+}
+
+func TestStateFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "encryption.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`apiVersion: apiserver.config.k8s.io/v1
+kind: EncryptionConfiguration
+resources:
+  - resources: ["*.route.openshift.io", pods.]
+    providers:
+`+aesgcmProvider("key1")), 0600))
+	encryption, err := storage.LoadEncryptionConfig(configPath)
+	require.NoError(t, err)
+
+	for _, resource := range []string{"pods", "routes.route.openshift.io", "namespaces"} {
+		t.Run(resource, func(t *testing.T) {
+			file := storage.StateFile{Path: filepath.Join(t.TempDir(), "state.json"), Resource: resource, Encryption: encryption}
+			var missing map[string]string
+			require.NoError(t, file.Load(&missing), "A missing state file should be empty state")
+			assert.Nil(t, missing)
+
+			require.NoError(t, file.Save(map[string]string{"owner": "alice"}))
+			stored, err := os.ReadFile(file.Path)
+			require.NoError(t, err)
+			encrypted := resource != "namespaces"
+			assert.Equal(t, encrypted, strings.HasPrefix(string(stored), "k8s:enc:aesgcm:v1:key1:"), "Only the listed resources should be encrypted")
+
+			var loaded map[string]string
+			require.NoError(t, file.Load(&loaded))
+			assert.Equal(t, map[string]string{"owner": "alice"}, loaded)
+		})
+	}
+}
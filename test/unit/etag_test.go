@@ -0,0 +1,94 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// conditionalGet sends a request with an If-None-Match header and an optional Accept header
+func conditionalGet(s *server.Server, method, path, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+// etagPodmanContainers lists a container with a fixed creation time, so that its pod, unlike
+// secrets whose creation time podman only reports relative to now, reads the same over time
+const etagPodmanContainers = `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running", "Created": 1700000000}]`
+
+func TestETags(t *testing.T) {
+	fakePodman(t, etagPodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/pods/web"
+
+	recorder := conditionalGet(s, http.MethodGet, path, "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	etag := recorder.Header().Get("ETag")
+	require.Regexp(t, `^"[0-9a-f]+"$`, etag)
+	body := recorder.Body.String()
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{"matching ETag", http.MethodGet, etag, http.StatusNotModified},
+		{"weak matching ETag", http.MethodGet, "W/" + etag, http.StatusNotModified},
+		{"matching ETag among others", http.MethodGet, `"0123", ` + etag, http.StatusNotModified},
+		{"any ETag", http.MethodGet, "*", http.StatusNotModified},
+		{"other ETag", http.MethodGet, `"0123"`, http.StatusOK},
+		{"HEAD", http.MethodHead, "", http.StatusOK},
+		{"HEAD with matching ETag", http.MethodHead, etag, http.StatusNotModified},
+		{"HEAD with other ETag", http.MethodHead, `"0123"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := conditionalGet(s, tt.method, path, "", tt.ifNoneMatch)
+			require.Equal(t, tt.wantCode, recorder.Code, recorder.Body.String())
+			assert.Equal(t, etag, recorder.Header().Get("ETag"), "the ETag should be set on every response")
+			if tt.wantCode == http.StatusNotModified {
+				assert.Empty(t, recorder.Body.String(), "304 responses have no body")
+			} else if tt.method == http.MethodGet {
+				assert.Equal(t, body, recorder.Body.String())
+			}
+		})
+	}
+
+	t.Run("other media type", func(t *testing.T) {
+		recorder := conditionalGet(s, http.MethodGet, path, "application/yaml", etag)
+		require.Equal(t, http.StatusOK, recorder.Code, "the ETag of the JSON body should not match the YAML body")
+		assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+	})
+
+	t.Run("table", func(t *testing.T) {
+		listPath := "/api/v1/namespaces/containers/pods"
+		recorder := conditionalGet(s, http.MethodGet, listPath, tableAccept, "")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		tableETag := recorder.Header().Get("ETag")
+		require.NotEmpty(t, tableETag)
+		assert.Equal(t, http.StatusNotModified, conditionalGet(s, http.MethodGet, listPath, tableAccept, tableETag).Code)
+	})
+
+	t.Run("not on writes", func(t *testing.T) {
+		fakePodmanSecrets(t)
+		s := server.New("127.0.0.1", 0)
+		body := `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "api-token"}, "data": {"data": "c2VjcmV0"}}`
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/secrets", "application/json", "", body)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Empty(t, recorder.Header().Get("ETag"))
+	})
+}
@@ -0,0 +1,256 @@
+package unit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// streamsExecScript is a docker serving a single running container, web, whose exec
+// sessions write to both stdout and stderr, and fail when their command is fail
+const streamsExecScript = `
+case "$1" in
+ps) echo e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5 ;;
+inspect) cat <<'JSON'
+[{"Id": "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", "Name": "/web",
+  "Created": "2024-05-01T10:00:00Z", "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+  "Config": {"Image": "nginx"}}]
+JSON
+;;
+exec)
+	echo "to stdout"
+	echo "to stderr" >&2
+	for arg in "$@"; do
+		[ "$arg" = fail ] && exit 3
+	done
+	exit 0
+	;;
+*) echo '[]' ;;
+esac
+`
+
+func TestExecStreams(t *testing.T) {
+	_, httpServer := newExecServer(t, streamsExecScript)
+
+	exec := func(command string, streams ...string) (int, string) {
+		query := url.Values{"container": {"web"}, "command": {command}}
+		for _, stream := range streams {
+			query.Set(stream, "true")
+		}
+		response, err := http.Post(httpServer.URL+"/api/v1/namespaces/containers/pods/web/exec?"+query.Encode(), "text/plain", nil)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(body)
+	}
+
+	code, body := exec("true", "stdout")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "to stdout\n", body, "stderr should not be merged into stdout")
+
+	code, body = exec("true", "stdout", "stderr")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "to stdout\n", body)
+
+	code, body = exec("true", "stderr")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "to stderr\n", body)
+
+	code, body = exec("fail", "stdout")
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.Contains(t, body, "to stderr", "a failed command should report its stderr")
+	assert.NotContains(t, body, "to stdout")
+}
+
+// sizeExecScript is a docker serving a single running container, web, whose exec sessions
+// print the size of their terminal, then wait for a line of input
+const sizeExecScript = `
+case "$1" in
+ps) echo e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5 ;;
+inspect) cat <<'JSON'
+[{"Id": "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", "Name": "/web",
+  "Created": "2024-05-01T10:00:00Z", "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+  "Config": {"Image": "nginx"}}]
+JSON
+;;
+exec) echo "size $(stty size)"; read -r line ;;
+*) echo '[]' ;;
+esac
+`
+
+func TestExecInitialTerminalSize(t *testing.T) {
+	_, httpServer := newExecServer(t, sizeExecScript)
+
+	// execSize runs a TTY session, sending resize first when set, and returns its first line
+	execSize := func(extra url.Values, resize string) string {
+		extra.Set("tty", "true")
+		socket, err := dialExec(httpServer, extra)
+		require.NoError(t, err)
+		defer socket.Close()
+		socket.SetDeadline(time.Now().Add(30 * time.Second))
+		if resize != "" {
+			require.NoError(t, websocket.Message.Send(socket, append([]byte{wsResizeChannel}, resize...)))
+		}
+
+		var stdout strings.Builder
+		for !strings.Contains(stdout.String(), "\n") {
+			var frame []byte
+			require.NoError(t, websocket.Message.Receive(socket, &frame), "stdout so far: %q", stdout.String())
+			if len(frame) > 0 && frame[0] == wsStdoutChannel {
+				stdout.Write(frame[1:])
+			}
+		}
+		return stdout.String()
+	}
+
+	assert.Contains(t, execSize(url.Values{"width": {"100"}, "height": {"30"}}, ""), "size 30 100", "the PTY should have the size of the request")
+	assert.Contains(t, execSize(url.Values{}, `{"Width": 120, "Height": 40}`), "size 40 120", "the PTY should have the size of the first resize event")
+}
+
+// execFrame encodes a frame of a framed exec stream
+func execFrame(channel byte, payload string) []byte {
+	frame := make([]byte, 5, 5+len(payload))
+	frame[0] = channel
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestFramedExec(t *testing.T) {
+	testutil.FakeCommand(t, "docker", uiExecScript)
+	node, err := storage.NewNode("node", storage.RuntimeDocker, "", "", nil)
+	require.NoError(t, err)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{node}, ""))
+	httpServer := httptest.NewUnstartedServer(s.Handler())
+	httpServer.EnableHTTP2 = true
+	httpServer.StartTLS()
+	defer httpServer.Close()
+
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	query := url.Values{"container": {"web"}, "stdin": {"true"}, "stdout": {"true"}, "command": {"sh"}}
+	request, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/namespaces/containers/pods/web/exec?"+query.Encode(), stdin)
+	require.NoError(t, err)
+	request.Header.Set("X-Podkube-Exec-Stream", "framed")
+	response, err := httpServer.Client().Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 2, response.ProtoMajor, "the session should run over HTTP/2")
+	assert.Equal(t, "application/vnd.podkube.exec-stream", response.Header.Get("Content-Type"))
+
+	// readUntil reads the stdout frames until they have text, and returns the first frame of
+	// another channel, if any
+	var stdout strings.Builder
+	readUntil := func(text string) (byte, []byte) {
+		header := make([]byte, 5)
+		for !strings.Contains(stdout.String(), text) {
+			_, err := io.ReadFull(response.Body, header)
+			require.NoError(t, err, "stdout so far: %q", stdout.String())
+			payload := make([]byte, binary.BigEndian.Uint32(header[1:]))
+			_, err = io.ReadFull(response.Body, payload)
+			require.NoError(t, err)
+			if header[0] != wsStdoutChannel {
+				return header[0], payload
+			}
+			stdout.Write(payload)
+		}
+		return 0, nil
+	}
+
+	_, frame := readUntil("ready")
+	assert.Nil(t, frame)
+	go stdinWriter.Write(execFrame(wsStdinChannel, "hello\n"))
+	_, frame = readUntil("got hello")
+	assert.Nil(t, frame, "stdin frames should reach the command while its output is streamed")
+	go stdinWriter.Write(execFrame(wsStdinChannel, "exit\n"))
+
+	channel, frame := readUntil("\x00never")
+	require.Equal(t, byte(wsErrorChannel), channel)
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(frame, &status))
+	assert.Equal(t, metav1.StatusSuccess, status.Status, "the session should end successfully: %s", status.Message)
+}
+
+func TestExecTranscripts(t *testing.T) {
+	s, httpServer := newExecServer(t, streamsExecScript)
+	assert.Error(t, s.SetExecTranscriptDir("transcripts"), "the transcript directory should be absolute")
+	dir := filepath.Join(t.TempDir(), "transcripts")
+	require.NoError(t, s.SetExecTranscriptDir(dir))
+
+	exec := func(requestID string) int {
+		query := url.Values{"container": {"web"}, "command": {"true"}, "stdout": {"true"}, "stderr": {"true"}}
+		req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/api/v1/namespaces/containers/pods/web/exec?"+query.Encode(), nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Request-Id", requestID)
+		response, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		return response.StatusCode
+	}
+	require.Equal(t, http.StatusOK, exec("exec-1"))
+
+	transcripts, err := filepath.Glob(filepath.Join(dir, "containers_web_*_exec-1.log"))
+	require.NoError(t, err)
+	require.Len(t, transcripts, 1, "the session should have its transcript, named after its request")
+	info, err := os.Stat(transcripts[0])
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "transcripts should only be readable by the adapter")
+
+	content, err := os.ReadFile(transcripts[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 3, string(content))
+	var header struct {
+		Version   int      `json:"version"`
+		RequestID string   `json:"requestID"`
+		User      string   `json:"user"`
+		Namespace string   `json:"namespace"`
+		Pod       string   `json:"pod"`
+		Container string   `json:"container"`
+		Command   []string `json:"command"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &header))
+	assert.Equal(t, 1, header.Version)
+	assert.Equal(t, "exec-1", header.RequestID)
+	assert.Equal(t, "web", header.Pod)
+	assert.Equal(t, "containers", header.Namespace)
+	assert.Equal(t, []string{"true"}, header.Command)
+	assert.Equal(t, "system:anonymous", header.User)
+
+	streams := map[string]string{}
+	for _, line := range lines[1:] {
+		var event []interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.Len(t, event, 3)
+		assert.IsType(t, float64(0), event[0], "events should start with their time since the start of the session")
+		streams[event[1].(string)] += event[2].(string)
+	}
+	assert.Equal(t, map[string]string{"o": "to stdout\n", "e": "to stderr\n"}, streams)
+
+	// A session whose transcript cannot be written is refused
+	require.NoError(t, os.RemoveAll(dir))
+	assert.Equal(t, http.StatusInternalServerError, exec("exec-2"))
+
+	require.NoError(t, s.SetExecTranscriptDir(""))
+	assert.Equal(t, http.StatusOK, exec("exec-3"), "sessions should not be recorded once transcripts are disabled")
+}
@@ -0,0 +1,119 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// finalizedInspect is a docker container whose pod has the example.com/cleanup finalizer
+const finalizedInspect = `[
+  {
+    "Id": "c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0",
+    "Name": "/web",
+    "Created": "2024-05-01T10:00:00Z",
+    "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+    "Config": {
+      "Image": "nginx",
+      "Labels": {"app": "web", "annotations.podkube.io/podkube.io/finalizers": "example.com/cleanup"}
+    }
+  }
+]`
+
+// newDockerServer serves the API from a single docker node
+func newDockerServer(t *testing.T) *server.Server {
+	node, err := storage.NewNode("node", storage.RuntimeDocker, "", "", nil)
+	require.NoError(t, err)
+	node.Storage.SetCacheTTL(0)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{node}, ""))
+	return s
+}
+
+func decodePod(t *testing.T, data []byte) *corev1.Pod {
+	var pod corev1.Pod
+	require.NoError(t, json.Unmarshal(data, &pod), string(data))
+	return &pod
+}
+
+func TestFinalizedPodDeletion(t *testing.T) {
+	log := fakeDocker(t, []string{"c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0"}, finalizedInspect)
+	s := newDockerServer(t)
+	path := "/api/v1/namespaces/containers/pods/web"
+
+	pod := decodePod(t, getPath(s, path).Body.Bytes())
+	require.Equal(t, []string{"example.com/cleanup"}, pod.Finalizers)
+	require.Nil(t, pod.DeletionTimestamp)
+
+	// Deleting a pod with finalizers only marks it
+	recorder := serveRequest(s, http.MethodDelete, path, "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	deleted := decodePod(t, recorder.Body.Bytes())
+	require.NotNil(t, deleted.DeletionTimestamp)
+	assert.Equal(t, []string{"example.com/cleanup"}, deleted.Finalizers)
+	assert.Empty(t, podmanCalls(t, log, "rm"), "the container should be kept while the pod has finalizers")
+
+	pod = decodePod(t, getPath(s, path).Body.Bytes())
+	assert.Equal(t, deleted.DeletionTimestamp, pod.DeletionTimestamp, "the deletionTimestamp should be kept")
+
+	// Deleting again keeps the first deletionTimestamp
+	recorder = serveRequest(s, http.MethodDelete, path, "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, deleted.DeletionTimestamp, decodePod(t, recorder.Body.Bytes()).DeletionTimestamp)
+
+	// No finalizer can be added once the pod is being deleted
+	recorder = serveRequest(s, http.MethodPatch, path, "application/merge-patch+json", "",
+		`{"metadata": {"finalizers": ["example.com/cleanup", "example.com/other"]}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Empty(t, podmanCalls(t, log, "rm"))
+
+	// Removing the last finalizer removes the container
+	recorder = serveRequest(s, http.MethodPatch, path, "application/json-patch+json", "",
+		`[{"op": "remove", "path": "/metadata/finalizers"}]`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Empty(t, decodePod(t, recorder.Body.Bytes()).Finalizers)
+	assert.Len(t, podmanCalls(t, log, "rm"), 1, "the container should be removed with the last finalizer")
+
+	assert.Equal(t, http.StatusNotFound, getPath(s, path).Code)
+}
+
+func TestPodPatch(t *testing.T) {
+	fakeDocker(t, []string{"c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0"}, finalizedInspect)
+	s := newDockerServer(t)
+	path := "/api/v1/namespaces/containers/pods/web"
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		wantCode    int
+		want        []string
+	}{
+		{"merge patch", "application/merge-patch+json", `{"metadata": {"finalizers": ["a.io/x", "b.io/y"]}}`, http.StatusOK, []string{"a.io/x", "b.io/y"}},
+		{"strategic merge patch replaces lists", "application/strategic-merge-patch+json", `{"metadata": {"finalizers": ["c.io/z"]}}`, http.StatusOK, []string{"c.io/z"}},
+		{"JSON patch", "application/json-patch+json", `[{"op": "add", "path": "/metadata/finalizers/-", "value": "d.io/w"}]`, http.StatusOK, []string{"c.io/z", "d.io/w"}},
+		{"failed JSON patch test", "application/json-patch+json", `[{"op": "test", "path": "/metadata/name", "value": "db"}]`, http.StatusBadRequest, nil},
+		{"invalid merge patch", "application/merge-patch+json", `{"metadata":`, http.StatusBadRequest, nil},
+		{"unsupported patch type", "application/apply-patch+yaml", `metadata: {}`, http.StatusUnsupportedMediaType, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveRequest(s, http.MethodPatch, path, tt.contentType, "", tt.patch)
+			require.Equal(t, tt.wantCode, recorder.Code, recorder.Body.String())
+			if tt.want != nil {
+				assert.Equal(t, tt.want, decodePod(t, recorder.Body.Bytes()).Finalizers)
+			}
+		})
+	}
+
+	recorder := serveRequest(s, http.MethodPatch, path+"?dryRun=All", "application/merge-patch+json", "", `{"metadata": {"finalizers": null}}`)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"c.io/z", "d.io/w"}, decodePod(t, getPath(s, path).Body.Bytes()).Finalizers, "a dry run should not change the pod")
+}
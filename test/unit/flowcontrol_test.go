@@ -0,0 +1,50 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestFlowcontrolDiscovery(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	t.Run("group", func(t *testing.T) {
+		recorder := getPath(s, "/apis/flowcontrol.apiserver.k8s.io")
+		require.Equal(t, http.StatusOK, recorder.Code, "the group should be served without a redirect: %s", recorder.Body)
+		var group metav1.APIGroup
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &group))
+		assert.Equal(t, "APIGroup", group.Kind)
+		assert.Equal(t, "flowcontrol.apiserver.k8s.io", group.Name)
+		assert.Equal(t, "flowcontrol.apiserver.k8s.io/v1", group.PreferredVersion.GroupVersion)
+		assert.Equal(t, []metav1.GroupVersionForDiscovery{group.PreferredVersion}, group.Versions)
+	})
+
+	for _, path := range []string{"/apis/flowcontrol.apiserver.k8s.io/v1/flowschemas", "/apis/flowcontrol.apiserver.k8s.io/v1/prioritylevelconfigurations"} {
+		t.Run(path, func(t *testing.T) {
+			recorder := getPath(s, path)
+			require.Equal(t, http.StatusOK, recorder.Code)
+			var list struct {
+				Kind  string            `json:"kind"`
+				Items []json.RawMessage `json:"items"`
+			}
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+			assert.NotNil(t, list.Items, "lists should be empty, not null")
+			assert.Empty(t, list.Items)
+		})
+	}
+
+	for _, path := range []string{"/apis/flowcontrol.apiserver.k8s.io/", "/apis/flowcontrol.apiserver.k8s.io/v1beta3"} {
+		t.Run(path, func(t *testing.T) {
+			recorder := getPath(s, path)
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+			assert.Equal(t, metav1.StatusReasonNotFound, decodeStatus(t, recorder.Body.Bytes()).Reason)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// exitedContainers returns podman ps output with a running container and containers that
+// exited the given durations ago, named after their age
+func exitedContainers(ages ...time.Duration) string {
+	entries := []string{`{"Id": "aaaaaaaaaaaa0000", "Names": ["web"], "State": "running"}`}
+	for i, age := range ages {
+		entries = append(entries, fmt.Sprintf(`{"Id": "eeeeeeeeeeee%04d", "Names": ["exited-%s"], "State": "exited", "Exited": true, "ExitedAt": %d}`,
+			i, age, time.Now().Add(-age).Unix()))
+	}
+	return "[" + strings.Join(entries, ",") + "]"
+}
+
+// collectGarbage runs one garbage collection pass on a single local node and returns the
+// names of the removed containers, after configuring the cluster with configure
+func collectGarbage(t *testing.T, ps, inspect string, exitedAfter time.Duration, maxExited int, configure ...func(*storage.Cluster)) []string {
+	log := fakePodman(t, ps, inspect)
+	node := newTestNode(t, "node", "", nil)
+	cluster := storage.NewCluster(node)
+	cluster.SetGarbageCollection(exitedAfter, maxExited)
+	for _, f := range configure {
+		f(cluster)
+	}
+
+	// The first pass runs right away, the next one not before the context expires
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	cluster.RunGarbageCollector(ctx)
+
+	if _, err := os.Stat(log); os.IsNotExist(err) {
+		return nil
+	}
+
+	// Containers are removed by name or by ID
+	var containers []storage.PodmanContainer
+	require.NoError(t, json.Unmarshal([]byte(ps), &containers))
+	names := map[string]string{}
+	for _, container := range containers {
+		names[container.Id] = container.Names[0]
+		names[container.Names[0]] = container.Names[0]
+	}
+	var removed []string
+	for _, call := range podmanCalls(t, log, "rm") {
+		removed = append(removed, names[strings.TrimPrefix(call, "rm ")])
+	}
+	return removed
+}
+
+func TestGarbageCollection(t *testing.T) {
+	ps := exitedContainers(time.Minute, 2*time.Hour, 3*time.Hour)
+
+	tests := []struct {
+		name        string
+		exitedAfter time.Duration
+		maxExited   int
+		want        []string
+	}{
+		{name: "disabled", want: nil},
+		{name: "by age", exitedAfter: time.Hour, want: []string{"exited-3h0m0s", "exited-2h0m0s"}},
+		{name: "by count", maxExited: 2, want: []string{"exited-3h0m0s"}},
+		{name: "by count keeps the most recent", maxExited: 1, want: []string{"exited-3h0m0s", "exited-2h0m0s"}},
+		{name: "both limits", exitedAfter: 150 * time.Minute, maxExited: 2, want: []string{"exited-3h0m0s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, collectGarbage(t, ps, "[]", tt.exitedAfter, tt.maxExited))
+		})
+	}
+}
+
+func TestGarbageCollectionKeepsFinalizedPods(t *testing.T) {
+	ps := exitedContainers(2*time.Hour, 3*time.Hour)
+	inspect := `[{"Id": "eeeeeeeeeeee0001", "Config": {"Annotations": {"podkube.io/finalizers": "example.com/cleanup"}}}]`
+
+	removed := collectGarbage(t, ps, inspect, time.Hour, 0)
+	require.Len(t, removed, 1)
+	assert.Equal(t, "exited-2h0m0s", removed[0], "pods with finalizers should not be collected")
+}
+
+func TestGarbageCollectionKeepsSystemdPods(t *testing.T) {
+	ps := strings.Replace(exitedContainers(2*time.Hour, 3*time.Hour), `"Names": ["exited-3h0m0s"]`,
+		`"Names": ["exited-3h0m0s"], "Labels": {"PODMAN_SYSTEMD_UNIT": "exited.service"}`, 1)
+
+	removed := collectGarbage(t, ps, "[]", time.Hour, 0)
+	assert.Equal(t, []string{"exited-2h0m0s"}, removed, "the pods of systemd units should not be collected")
+
+	removed = collectGarbage(t, ps, "[]", time.Hour, 0, func(cluster *storage.Cluster) { cluster.SetAllowSystemdDelete(true) })
+	assert.Equal(t, []string{"exited-3h0m0s", "exited-2h0m0s"}, removed, "--allow-systemd-delete should let them be collected")
+}
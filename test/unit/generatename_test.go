@@ -0,0 +1,126 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanNameTaken installs a podman whose first taken runs fail like a container name
+// already in use, then runs and lists the container. Run names are logged to dir/runs.
+func fakePodmanNameTaken(t *testing.T, taken int) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"), []byte("[]"), 0644))
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) cat `+dir+`/ps.json ;;
+inspect) echo '[]' ;;
+run)
+	while [ "$1" != "--name" ]; do shift; done
+	echo "$2" >> `+dir+`/runs
+	if [ $(wc -l < `+dir+`/runs) -le `+strconv.Itoa(taken)+` ]; then
+		echo "Error: creating container storage: the container name \"$2\" is already in use by 0123456789ab" >&2
+		exit 125
+	fi
+	echo "[{\"Id\": \"0123456789abcdef$2\", \"Names\": [\"$2\"], \"State\": \"running\"}]" > `+dir+`/ps.json
+	echo 0123456789abcdef$2
+	;;
+*) exit 1 ;;
+esac
+`)
+	return dir
+}
+
+// runNames returns the container names podman was asked to run
+func runNames(t *testing.T, dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	return strings.Fields(string(data))
+}
+
+func TestGenerateName(t *testing.T) {
+	generatedName := regexp.MustCompile(`^web-[a-z0-9]{5}$`)
+	podJSON := `{"apiVersion": "v1", "kind": "Pod",
+		"metadata": {"generateName": "web-", "namespace": "containers"},
+		"spec": {"containers": [{"name": "web", "image": "nginx"}]}}`
+
+	t.Run("suffix", func(t *testing.T) {
+		dir := fakePodmanNameTaken(t, 0)
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		var pod corev1.Pod
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &pod))
+		assert.Regexp(t, generatedName, pod.Name)
+		assert.Equal(t, []string{pod.Name}, runNames(t, dir))
+	})
+
+	t.Run("long prefix is truncated", func(t *testing.T) {
+		fakePodmanNameTaken(t, 0)
+		s := server.New("127.0.0.1", 0)
+
+		body := strings.Replace(podJSON, `"web-"`, `"`+strings.Repeat("a", 70)+`"`, 1)
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		var pod corev1.Pod
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &pod))
+		assert.Len(t, pod.Name, 63)
+		assert.True(t, strings.HasPrefix(pod.Name, strings.Repeat("a", 58)))
+	})
+
+	t.Run("name collision is retried", func(t *testing.T) {
+		dir := fakePodmanNameTaken(t, 1)
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		var pod corev1.Pod
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &pod))
+
+		names := runNames(t, dir)
+		require.Len(t, names, 2)
+		assert.Regexp(t, generatedName, names[0])
+		assert.NotEqual(t, names[0], names[1], "the retry should use another suffix")
+		assert.Equal(t, names[1], pod.Name)
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		dir := fakePodmanNameTaken(t, 10)
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON)
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		assert.Len(t, runNames(t, dir), 3)
+	})
+
+	t.Run("explicit names are not retried", func(t *testing.T) {
+		dir := fakePodmanNameTaken(t, 1)
+		s := server.New("127.0.0.1", 0)
+
+		body := strings.Replace(podJSON, `"generateName": "web-"`, `"name": "web", "generateName": "web-"`, 1)
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+		assert.Equal(t, http.StatusConflict, recorder.Code)
+		assert.Equal(t, []string{"web"}, runNames(t, dir))
+	})
+
+	t.Run("name or generateName is required", func(t *testing.T) {
+		s := server.New("127.0.0.1", 0)
+
+		body := strings.Replace(podJSON, `"generateName": "web-", `, "", 1)
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
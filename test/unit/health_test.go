@@ -0,0 +1,64 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func getPath(s *server.Server, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestReadyzPodmanReachable(t *testing.T) {
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+info) echo 5.0.0 ;;
+*) exit 1 ;;
+esac
+`)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/readyz")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+
+	recorder = getPath(s, "/readyz?verbose")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "[+]ping ok\n")
+	assert.Contains(t, recorder.Body.String(), "[+]podman ok\n")
+	assert.Contains(t, recorder.Body.String(), "readyz check passed\n")
+
+	recorder = getPath(s, "/readyz/podman")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = getPath(s, "/readyz/unknown")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestReadyzPodmanUnreachable(t *testing.T) {
+	testutil.FakeCommand(t, "podman", "echo 'cannot connect' >&2; exit 125\n")
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "[-]podman failed: ")
+	assert.Contains(t, recorder.Body.String(), "readyz check failed\n")
+
+	recorder = getPath(s, "/readyz?exclude=podman")
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	recorder = getPath(s, "/readyz/ping")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// Liveness does not depend on podman
+	recorder = getPath(s, "/livez")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,115 @@
+package unit
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// identityContainers has a standalone container, a pod started by podman kube play with
+// its infra container, and the containers of a pod run by kubelet through cri-dockerd
+const identityContainers = `[
+  {"Id": "aaaaaaaaaaaa0001", "Names": ["standalone"], "State": "running"},
+  {"Id": "bbbbbbbbbbbb0001", "Names": ["f00dcafe0001-infra"], "State": "running", "Pod": "f00dcafe0001f00d", "PodName": "shop", "IsInfra": true},
+  {"Id": "bbbbbbbbbbbb0002", "Names": ["shop-web"], "State": "running", "Pod": "f00dcafe0001f00d", "PodName": "shop"},
+  {"Id": "bbbbbbbbbbbb0003", "Names": ["shop-cache"], "State": "exited", "Exited": true, "ExitCode": 1, "Pod": "f00dcafe0001f00d", "PodName": "shop"},
+  {"Id": "cccccccccccc0001", "Names": ["k8s_POD_api"], "State": "running",
+   "Labels": {"io.kubernetes.docker.type": "podsandbox", "io.kubernetes.pod.name": "api", "io.kubernetes.pod.namespace": "prod"}},
+  {"Id": "cccccccccccc0002", "Names": ["k8s_server_api"], "State": "running",
+   "Labels": {"io.kubernetes.pod.name": "api", "io.kubernetes.pod.namespace": "prod", "io.kubernetes.container.name": "server",
+              "io.kubernetes.pod.uid": "0b1e2c3d-0000-4000-8000-000000000001"}}
+]`
+
+func containerNames(pod *corev1.Pod) []string {
+	var names []string
+	for _, container := range pod.Spec.Containers {
+		names = append(names, container.Name)
+	}
+	return names
+}
+
+func TestPodIdentity(t *testing.T) {
+	log := fakePodman(t, identityContainers, "[]")
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+	ctx := context.Background()
+
+	podList, err := ps.List(ctx, "", "", "")
+	require.NoError(t, err)
+	pods := map[string]*corev1.Pod{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		pods[pod.Namespace+"/"+pod.Name] = pod
+	}
+	require.Len(t, pods, 3, "infra and sandbox containers should be hidden, pod containers grouped")
+
+	require.Contains(t, pods, "containers/standalone")
+
+	shop := pods["containers/shop"]
+	require.NotNil(t, shop, "kube play pods should be named after the podman pod")
+	assert.Equal(t, []string{"cache", "web"}, containerNames(shop))
+	assert.Equal(t, corev1.PodRunning, shop.Status.Phase, "a pod is running while any container runs")
+
+	api := pods["prod/api"]
+	require.NotNil(t, api, "io.kubernetes labels should give the pod name and namespace")
+	assert.Equal(t, []string{"server"}, containerNames(api))
+	assert.Equal(t, "0b1e2c3d-0000-4000-8000-000000000001", string(api.UID))
+
+	pod, err := ps.Get(ctx, "containers", "shop")
+	require.NoError(t, err)
+	assert.Len(t, pod.Spec.Containers, 2)
+
+	pod, err = ps.Get(ctx, "prod", "api")
+	require.NoError(t, err)
+	assert.Equal(t, api.UID, pod.UID)
+
+	_, err = ps.Get(ctx, "containers", "api")
+	assert.Error(t, err, "pods should only be found in their own namespace")
+
+	require.NoError(t, ps.Delete(ctx, "containers", "shop"))
+	assert.Equal(t, []string{"pod rm --force f00dcafe0001f00d"}, podmanCalls(t, log, "pod"), "kube play pods should be removed with their podman pod")
+	assert.Empty(t, podmanCalls(t, log, "rm"))
+}
+
+func TestComposeProjectNames(t *testing.T) {
+	tests := []struct {
+		name          string
+		labels        string
+		wantPod       string
+		wantContainer string
+	}{
+		{"valid names", `"com.docker.compose.project": "shop", "com.docker.compose.service": "web"`, "shop", "web"},
+		{"uppercase letters", `"com.docker.compose.project": "MyShop", "com.docker.compose.service": "Web"`, "myshop", "web"},
+		{"underscores", `"com.docker.compose.project": "my_shop", "com.docker.compose.service": "web_server"`, "my-shop", "web-server"},
+		{"dots", `"com.docker.compose.project": "shop.example", "com.docker.compose.service": "web.v2"`, "shop-example", "web-v2"},
+		{"leading and trailing separators", `"com.docker.compose.project": "_shop_", "com.docker.compose.service": "-web."`, "shop", "web"},
+		{"scaled service", `"com.docker.compose.project": "Shop", "com.docker.compose.service": "web_server", "com.docker.compose.container-number": "2"`, "shop", "web-server-2"},
+		{"no service", `"com.docker.compose.project": "My_Shop"`, "my-shop", "shop-web-1"},
+		{"long project", `"com.docker.compose.project": "` + strings.Repeat("a", 70) + `", "com.docker.compose.service": "web"`, strings.Repeat("a", 63), "web"},
+		// Standalone containers get the spec podman kube generate gives them
+		{"project without valid characters is standalone", `"com.docker.compose.project": "__"`, "Shop_Web_1", "generated-dddddddddddd0001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePodman(t, `[{"Id": "dddddddddddd0001", "Names": ["Shop_Web_1"], "State": "running", "Labels": {`+tt.labels+`}}]`, "[]")
+			ps := storage.NewPodStorage()
+			ps.SetCacheTTL(0)
+
+			podList, err := ps.List(context.Background(), "", "", "")
+			require.NoError(t, err)
+			require.Len(t, podList.Items, 1)
+			pod := &podList.Items[0]
+			assert.Equal(t, tt.wantPod, pod.Name)
+			assert.Equal(t, []string{tt.wantContainer}, containerNames(pod))
+
+			_, err = ps.Get(context.Background(), "containers", tt.wantPod)
+			assert.NoError(t, err, "the pod should be found by its name")
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+const fakeImagesInspect = `[
+  {"Id": "sha256:1111111111111111aaaa", "RepoTags": ["docker.io/library/nginx:latest"], "Size": 187000000, "Created": "2024-01-01T00:00:00Z"},
+  {"Id": "sha256:2222222222222222bbbb", "RepoTags": ["localhost:5000/tools"], "Size": 1200, "Created": "2024-01-01T00:00:00Z"}
+]`
+
+// fakePodmanImages installs a podman whose image store holds the images of fakeImagesInspect,
+// the first being used by a container, and returns the file podman rmi calls are logged to
+func fakePodmanImages(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "inspect.json"), []byte(fakeImagesInspect), 0644))
+	log := filepath.Join(dir, "rmi")
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+images) printf 'sha256:1111111111111111aaaa\nsha256:1111111111111111aaaa\nsha256:2222222222222222bbbb\n' ;;
+image) cat `+filepath.Join(dir, "inspect.json")+` ;;
+rmi)
+	echo "$2" >> `+log+`
+	case "$2" in
+	*1111*) echo "Error: image used by abc: image is in use by a container" >&2; exit 2 ;;
+	esac
+	;;
+*) exit 1 ;;
+esac
+`)
+	return log
+}
+
+func TestImageAPI(t *testing.T) {
+	log := fakePodmanImages(t)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/apis/podman.io/v1/images")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var imageList storage.ImageList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &imageList))
+	require.Len(t, imageList.Items, 2, "images with several tags should be listed once")
+	assert.Equal(t, "111111111111", imageList.Items[0].Name, "images should be named after their abbreviated ID")
+	assert.Equal(t, "docker.io/library/nginx:latest", imageList.Items[0].Spec.Image)
+
+	recorder = getPath(s, "/apis/podman.io/v1/images/222222222222")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"id":"2222222222222222bbbb"`)
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/apis/podman.io/v1/images/333333333333").Code)
+
+	deleteImage := func(name string) int {
+		return serveRequest(s, http.MethodDelete, "/apis/podman.io/v1/images/"+name, "", "", "").Code
+	}
+	assert.Equal(t, http.StatusConflict, deleteImage("111111111111"), "images used by containers cannot be removed")
+	assert.Equal(t, http.StatusOK, deleteImage("222222222222"))
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "1111111111111111aaaa\n2222222222222222bbbb\n", string(data))
+}
+
+func TestImageTable(t *testing.T) {
+	fakePodmanImages(t)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodGet, "/apis/podman.io/v1/images", "", "application/json;as=Table;v=v1;g=meta.k8s.io", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var table struct {
+		Rows []struct {
+			Cells []interface{} `json:"cells"`
+		} `json:"rows"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &table))
+	require.Len(t, table.Rows, 2)
+	assert.Equal(t, []interface{}{"111111111111", "docker.io/library/nginx", "latest", "187 MB"}, table.Rows[0].Cells[:4])
+	assert.Equal(t, []interface{}{"222222222222", "localhost:5000/tools", "<none>", "1.2 kB"}, table.Rows[1].Cells[:4],
+		"the port of a registry host is not a tag")
+}
@@ -0,0 +1,51 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func TestInsecureServingLoopbackOnly(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+	for _, address := range []string{"0.0.0.0", "192.0.2.1", "::", "example.com"} {
+		assert.Error(t, s.SetInsecureServing(address, 8080), "%s should be rejected", address)
+	}
+	for _, address := range []string{"127.0.0.1", "::1", "localhost"} {
+		assert.NoError(t, s.SetInsecureServing(address, 8080), "%s should be accepted", address)
+	}
+}
+
+func TestInsecureServing(t *testing.T) {
+	port := testutil.FreePort(t)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetInsecureServing("localhost", port))
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- s.ListenAndServeInsecure() }()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/healthz", port)
+	testutil.WaitForCondition(t, func() bool {
+		resp, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode == http.StatusOK && string(body) == "ok"
+	}, 10*time.Second, "plain HTTP listener should serve the API")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+	assert.Equal(t, http.ErrServerClosed, <-serveErr, "shutdown should close the plain HTTP listener")
+}
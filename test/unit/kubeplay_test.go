@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func TestRequiresKubePlay(t *testing.T) {
+	container := corev1.Container{Name: "web", Image: "nginx"}
+	tests := []struct {
+		name string
+		spec corev1.PodSpec
+		want bool
+	}{
+		{"single container", corev1.PodSpec{Containers: []corev1.Container{container}}, false},
+		{"several containers", corev1.PodSpec{Containers: []corev1.Container{container, {Name: "cache", Image: "redis"}}}, true},
+		{"volumes", corev1.PodSpec{Containers: []corev1.Container{container},
+			Volumes: []corev1.Volume{{Name: "data", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}}, true},
+		{"host network", corev1.PodSpec{Containers: []corev1.Container{container}, HostNetwork: true}, true},
+		{"fields kube play ignores too", corev1.PodSpec{Containers: []corev1.Container{container},
+			Tolerations: []corev1.Toleration{{Key: "dedicated"}}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, storage.RequiresKubePlay(&corev1.Pod{Spec: test.spec}))
+		})
+	}
+}
+
+func TestKubePlayCreate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"), []byte("[]"), 0644))
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) cat `+dir+`/ps.json ;;
+inspect) echo '[]' ;;
+kube)
+	if [ "$2" = play ]; then
+		cp "$3" `+dir+`/manifest.yaml
+		echo '[{"Id": "bbbbbbbbbbbb0002", "Names": ["shop-web"], "State": "running", "Pod": "f00dcafe0001f00d", "PodName": "shop"},
+		       {"Id": "bbbbbbbbbbbb0003", "Names": ["shop-cache"], "State": "running", "Pod": "f00dcafe0001f00d", "PodName": "shop"}]' > `+dir+`/ps.json
+	else
+		exit 1
+	fi
+	;;
+*) exit 1 ;;
+esac
+`)
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+
+	body := `{"apiVersion": "v1", "kind": "Pod",
+		"metadata": {"name": "shop", "namespace": "containers", "annotations": {"example.com/team": "store", "podkube.io/uid": "spoofed"}},
+		"spec": {"containers": [{"name": "web", "image": "nginx"}, {"name": "cache", "image": "redis"}]}}`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "shop", decodePod(t, recorder.Body.Bytes()).Name, "the played pod should be adopted")
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.yaml"))
+	require.NoError(t, err)
+	var manifest corev1.Pod
+	require.NoError(t, yaml.Unmarshal(data, &manifest))
+	assert.Equal(t, "shop", manifest.Name)
+	assert.Len(t, manifest.Spec.Containers, 2)
+	assert.Empty(t, manifest.Spec.NodeName, "kube play cannot schedule on a node name")
+	assert.Equal(t, map[string]string{"example.com/team": "store", "user.podkube.io/podkube.io/uid": "spoofed"}, manifest.Annotations,
+		"annotations should be escaped as on run containers")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestKubePlayUnsupportedByDocker(t *testing.T) {
+	fakeDocker(t, nil, "[]")
+	s := newDockerServer(t)
+
+	body := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "shop", "namespace": "containers"},
+		"spec": {"containers": [{"name": "web", "image": "nginx"}, {"name": "cache", "image": "redis"}]}}`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
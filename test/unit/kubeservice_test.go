@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+func TestKubernetesServiceEnvironment(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": "[]"})
+	cluster := storage.NewCluster(newTestNode(t, "node", "", nil))
+	cluster.SetKubernetesService(6443)
+
+	_, err := cluster.Create(context.Background(), &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "containers"},
+		Spec: corev1.PodSpec{
+			HostAliases: []corev1.HostAlias{{IP: "10.0.0.5", Hostnames: []string{"kubernetes"}}},
+			Containers: []corev1.Container{{
+				Name:  "operator",
+				Image: "operator",
+				Env:   []corev1.EnvVar{{Name: "KUBERNETES_SERVICE_PORT", Value: "443"}},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	runs := podmanCalls(t, filepath.Join(dir, "calls"), "run")
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0], "KUBERNETES_SERVICE_HOST=kubernetes.default.svc")
+	assert.Contains(t, runs[0], "KUBERNETES_PORT_6443_TCP_PORT=6443")
+	assert.Contains(t, runs[0], "KUBERNETES_SERVICE_PORT=443", "variables the pod sets should be kept")
+	assert.NotContains(t, runs[0], "KUBERNETES_SERVICE_PORT=6443")
+	assert.Contains(t, runs[0], "--add-host kubernetes:10.0.0.5", "host aliases the pod sets should be kept")
+	assert.Contains(t, runs[0], "--add-host kubernetes.default.svc:host-gateway")
+	assert.NotContains(t, runs[0], "--add-host kubernetes:host-gateway")
+}
+
+func TestKubernetesServiceServed(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+
+	t.Run("disabled", func(t *testing.T) {
+		s := server.New("127.0.0.1", 6443)
+
+		recorder := getPath(s, "/api/v1/namespaces/default/services/kubernetes")
+		assert.Equal(t, http.StatusNotFound, recorder.Code, recorder.Body.String())
+
+		recorder = getPath(s, "/api/v1/services")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var list corev1.ServiceList
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+		assert.Empty(t, list.Items)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		s := server.New("10.0.0.1", 6443)
+		require.NoError(t, s.SetKubernetesService(true))
+
+		recorder := getPath(s, "/api/v1/namespaces/default/services/kubernetes")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var service corev1.Service
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &service))
+		require.Len(t, service.Spec.Ports, 1)
+		assert.Equal(t, int32(6443), service.Spec.Ports[0].Port)
+
+		recorder = getPath(s, "/api/v1/namespaces/containers/services")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var list corev1.ServiceList
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+		assert.Empty(t, list.Items, "only the default namespace has the kubernetes service")
+
+		recorder = getPath(s, "/api/v1/namespaces/default/services/other")
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	})
+
+	t.Run("without HTTPS listener", func(t *testing.T) {
+		assert.Error(t, server.New("127.0.0.1", 0).SetKubernetesService(true))
+	})
+}
@@ -0,0 +1,76 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func TestNodeLeases(t *testing.T) {
+	// The local podman is reachable, the remote one is not
+	testutil.FakeCommand(t, "podman", `
+[ "$1" = "--remote" ] && exit 125
+case "$1" in
+info) echo 5.0.0 ;;
+ps|inspect) echo '[]' ;;
+*) exit 1 ;;
+esac
+`)
+	cluster := storage.NewCluster(
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-down", "unreachable", nil),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cluster.RunLeaseRenewer(ctx)
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return len(cluster.ListLeases(storage.NodeLeaseNamespace).Items) > 0
+	}, 10*time.Second, 20*time.Millisecond)
+	cancel()
+	<-done
+
+	leases := cluster.ListLeases("").Items
+	require.Len(t, leases, 1, "only reachable nodes should renew their lease")
+	lease := leases[0]
+	assert.Equal(t, "node-a", lease.Name)
+	assert.Equal(t, storage.NodeLeaseNamespace, lease.Namespace)
+	require.NotNil(t, lease.Spec.HolderIdentity)
+	assert.Equal(t, "node-a", *lease.Spec.HolderIdentity)
+	require.NotNil(t, lease.Spec.LeaseDurationSeconds)
+	assert.Equal(t, int32(40), *lease.Spec.LeaseDurationSeconds)
+	require.NotNil(t, lease.Spec.RenewTime)
+	assert.WithinDuration(t, time.Now(), lease.Spec.RenewTime.Time, 10*time.Second)
+
+	assert.Empty(t, cluster.ListLeases("default").Items)
+	_, err := cluster.GetLease(storage.NodeLeaseNamespace, "node-down")
+	assert.Error(t, err)
+	got, err := cluster.GetLease(storage.NodeLeaseNamespace, "node-a")
+	require.NoError(t, err)
+	assert.Equal(t, lease.ResourceVersion, got.ResourceVersion)
+}
+
+func TestLeaseDiscovery(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/apis/coordination.k8s.io/v1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"leases"`)
+	assert.Contains(t, getPath(s, "/apis").Body.String(), "coordination.k8s.io")
+
+	recorder = getPath(s, "/apis/coordination.k8s.io/v1/namespaces/kube-node-lease/leases")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"kind":"LeaseList"`)
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/apis/coordination.k8s.io/v1/namespaces/kube-node-lease/leases/missing").Code)
+}
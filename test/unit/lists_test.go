@@ -0,0 +1,99 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func decodeStatus(t *testing.T, data []byte) *metav1.Status {
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(data, &status), string(data))
+	return &status
+}
+
+func TestCreateList(t *testing.T) {
+	dir := fakePodmanNameTaken(t, 0)
+	s := server.New("127.0.0.1", 0)
+
+	body := `{"apiVersion": "v1", "kind": "List", "items": [
+		{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web"}, "spec": {"containers": [{"name": "web", "image": "nginx"}]}},
+		{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "api"}, "spec": {"containers": [{"name": "api", "image": "httpd"}]}}
+	]}`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	status := decodeStatus(t, recorder.Body.Bytes())
+	assert.Equal(t, metav1.StatusSuccess, status.Status)
+	require.NotNil(t, status.Details)
+	assert.Equal(t, []metav1.StatusCause{
+		{Type: "Created", Field: "items[0]", Message: "pod/web created"},
+		{Type: "Created", Field: "items[1]", Message: "pod/api created"},
+	}, status.Details.Causes)
+	assert.Equal(t, []string{"web", "api"}, runNames(t, dir))
+}
+
+func TestCreateMultiDocumentYAML(t *testing.T) {
+	dir := fakePodmanNameTaken(t, 0)
+	s := server.New("127.0.0.1", 0)
+
+	body := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: web
+spec:
+  containers:
+  - name: web
+    image: nginx
+---
+`
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/yaml", "application/json", body)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "the code of the first failed item should be returned")
+	status := decodeStatus(t, recorder.Body.Bytes())
+	assert.Equal(t, metav1.StatusFailure, status.Status)
+	assert.Equal(t, "created 1 of 2 objects: items[0]: kind \"ConfigMap\" cannot be created", status.Message)
+	require.NotNil(t, status.Details)
+	require.Len(t, status.Details.Causes, 2)
+	assert.Equal(t, "Created", string(status.Details.Causes[1].Type), "failed items should not stop the following ones")
+	assert.Equal(t, []string{"web"}, runNames(t, dir))
+}
+
+func TestListOrderAndResourceVersion(t *testing.T) {
+	fakePodmanSecrets(t, "zeta", "alpha")
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/secrets"
+
+	list := func() *corev1.SecretList {
+		recorder := getPath(s, path)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		var secretList corev1.SecretList
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &secretList))
+		return &secretList
+	}
+
+	first := list()
+	require.Len(t, first.Items, 2)
+	assert.Equal(t, "alpha", first.Items[0].Name, "lists should be sorted by name")
+	assert.Equal(t, "zeta", first.Items[1].Name)
+	assert.NotEmpty(t, first.ResourceVersion)
+	assert.Equal(t, first.ResourceVersion, list().ResourceVersion, "an unchanged list should keep its resourceVersion")
+	assert.Equal(t, first.ResourceVersion, getTable(t, s, path).ResourceVersion, "tables should carry the resourceVersion of the list")
+
+	body := `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "beta"}, "data": {"data": "c2VjcmV0"}}`
+	require.Equal(t, http.StatusCreated, serveRequest(s, http.MethodPost, path, "application/json", "", body).Code)
+	second := list()
+	require.Len(t, second.Items, 3)
+	assert.Equal(t, "beta", second.Items[1].Name)
+	assert.NotEqual(t, first.ResourceVersion, second.ResourceVersion, "a changed list should get a new resourceVersion")
+}
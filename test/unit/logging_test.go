@@ -0,0 +1,91 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := server.NewJSONLogger(&out).WithName("podkube").WithValues("node", "laptop")
+
+	logger.V(2).Info("Served request", "verb", "list", "latency", 1500*time.Millisecond, "status", 200)
+	logger.Error(errors.New("podman is not running"), "Failed to list pods", "namespace", "default")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2, "Should write one line per message")
+
+	var info map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &info), "Each line should be a JSON object")
+	assert.Equal(t, "info", info["level"])
+	assert.Equal(t, float64(2), info["v"])
+	assert.Equal(t, "podkube", info["logger"])
+	assert.Equal(t, "Served request", info["msg"])
+	assert.Equal(t, "laptop", info["node"], "Values of the logger should be fields")
+	assert.Equal(t, "list", info["verb"])
+	assert.Equal(t, "1.5s", info["latency"], "Durations should be written as strings")
+	assert.Equal(t, float64(200), info["status"])
+	assert.True(t, strings.HasPrefix(info["caller"].(string), "logging_test.go:"), "Caller should be the logging call site")
+	_, err := time.Parse(time.RFC3339Nano, info["ts"].(string))
+	assert.NoError(t, err, "Timestamp should be RFC3339")
+
+	var failure map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &failure))
+	assert.Equal(t, "error", failure["level"])
+	assert.NotContains(t, failure, "v", "Errors have no verbosity")
+	assert.Equal(t, "podman is not running", failure["err"])
+	assert.Equal(t, "default", failure["namespace"])
+}
+
+func TestRequestIDs(t *testing.T) {
+	fakePodmanSecrets(t)
+	s := server.New("127.0.0.1", 0)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLogger, err := server.NewAuditLogger(auditPath, server.AuditLevelMetadata)
+	require.NoError(t, err)
+	s.SetAuditLogger(auditLogger)
+
+	serve := func(id string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/containers/secrets", nil)
+		if id != "" {
+			req.Header.Set("X-Request-Id", id)
+		}
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		return recorder.Header().Get("X-Request-Id")
+	}
+
+	assert.Equal(t, "client-request-1", serve("client-request-1"), "the ID set by the client should be kept")
+	generated := serve("")
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, generated)
+	assert.NotEqual(t, generated, serve(""), "every request should get its own ID")
+	replaced := serve("bad\x01id")
+	assert.NotEqual(t, "bad\x01id", replaced, "IDs that are not printable should be replaced")
+	assert.NotEqual(t, strings.Repeat("a", 1000), serve(strings.Repeat("a", 1000)), "overlong IDs should be replaced")
+
+	require.NoError(t, auditLogger.Close())
+	content, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	var auditIDs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var event server.AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		auditIDs = append(auditIDs, string(event.AuditID))
+	}
+	require.GreaterOrEqual(t, len(auditIDs), 3)
+	assert.Equal(t, []string{"client-request-1", generated}, auditIDs[:2], "audit events should carry the request ID")
+}
@@ -0,0 +1,135 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logsScript is a docker serving a single running container, web, whose followed logs write
+// the pid of the logs command to dir/pid and a line, then end when dir/exited exists, like
+// for a container that exited, or else follow forever
+const logsScript = `
+case "$1" in
+ps) echo e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5 ;;
+inspect) cat <<'JSON'
+[{"Id": "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", "Name": "/web",
+  "Created": "2024-05-01T10:00:00Z", "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+  "Config": {"Image": "nginx"}}]
+JSON
+;;
+logs)
+	echo $$ > %[1]s/pid
+	echo "line 1"
+	[ -e %[1]s/exited ] && exit 0
+	exec sleep 30
+	;;
+*) echo '[]' ;;
+esac
+`
+
+func TestFollowLogs(t *testing.T) {
+	dir := t.TempDir()
+	_, httpServer := newExecServer(t, fmt.Sprintf(logsScript, dir))
+	logsURL := httpServer.URL + "/api/v1/namespaces/containers/pods/web/log?follow=true"
+
+	t.Run("container exits", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "exited"), nil, 0644))
+		defer os.Remove(filepath.Join(dir, "exited"))
+
+		client := &http.Client{Timeout: 10 * time.Second}
+		response, err := client.Get(logsURL)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err, "the stream should end with the logs of the container")
+		assert.Equal(t, "line 1\n", string(body))
+	})
+
+	t.Run("client goes away", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, logsURL, nil)
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		line, err := bufio.NewReader(response.Body).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "line 1\n", line, "logs should be streamed as they come")
+
+		data, err := os.ReadFile(filepath.Join(dir, "pid"))
+		require.NoError(t, err)
+		pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		require.NoError(t, err)
+		cancel()
+
+		// Once reaped, the logs command no longer shows in /proc, not even as a zombie
+		assert.Eventually(t, func() bool {
+			_, err := os.Stat(fmt.Sprintf("/proc/%d", pid))
+			return os.IsNotExist(err)
+		}, 10*time.Second, 50*time.Millisecond, "the logs command should be killed and reaped")
+	})
+}
+
+// timestampsScript is a docker serving a single running container, web, whose logs are
+// printed with their timestamps in the format and time zone of the runtime
+const timestampsScript = `
+case "$1" in
+ps) echo e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5 ;;
+inspect) cat <<'JSON'
+[{"Id": "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", "Name": "/web",
+  "Created": "2024-05-01T10:00:00Z", "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+  "Config": {"Image": "nginx"}}]
+JSON
+;;
+logs)
+	echo "2024-05-01T12:00:01.5+02:00 first"
+	echo "2024-05-01T12:00:02.000000001+02:00 second"
+	printf "2024-05-01T12:00:03+02:00 last"
+	;;
+*) echo '[]' ;;
+esac
+`
+
+func TestLogTimestamps(t *testing.T) {
+	_, httpServer := newExecServer(t, timestampsScript)
+
+	getLogs := func(query string) (int, string) {
+		response, err := http.Get(httpServer.URL + "/api/v1/namespaces/containers/pods/web/log?" + query)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		return response.StatusCode, string(body)
+	}
+
+	code, body := getLogs("timestamps=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "2024-05-01T10:00:01.500000000Z first\n2024-05-01T10:00:02.000000001Z second\n2024-05-01T10:00:03.000000000Z last", body,
+		"timestamps should be those of the kubelet, in UTC")
+
+	code, body = getLogs("sinceTime=2024-05-01T10:00:02Z")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "second\nlast", body, "lines logged before sinceTime should be dropped, and the timestamps of the runtime removed")
+
+	code, body = getLogs("sinceTime=2024-05-01T10:00:02Z&timestamps=true")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "2024-05-01T10:00:02.000000001Z second\n2024-05-01T10:00:03.000000000Z last", body)
+
+	code, _ = getLogs("sinceTime=2024-05-01T10:00:02Z&sinceSeconds=10")
+	assert.Equal(t, http.StatusBadRequest, code, "sinceTime and sinceSeconds are exclusive")
+	code, _ = getLogs("sinceSeconds=-1")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,94 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// watchEventList is the body of a long-poll watch response
+type watchEventList struct {
+	metav1.ListMeta `json:"metadata"`
+	Kind            string              `json:"kind"`
+	Events          []metav1.WatchEvent `json:"events"`
+}
+
+// longPoll sends a long-poll watch request and returns the events it answers
+func longPoll(t *testing.T, s *server.Server, query string) *watchEventList {
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods?watch=true&fallback=longpoll&timeoutSeconds=0"+query)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var events watchEventList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &events))
+	assert.Equal(t, "WatchEventList", events.Kind)
+	require.NotEmpty(t, events.ResourceVersion, "every answer should carry the cursor of the next request")
+	return &events
+}
+
+// eventPods returns the "TYPE name" of watch events
+func eventPods(t *testing.T, events []metav1.WatchEvent) []string {
+	var pods []string
+	for _, event := range events {
+		var pod corev1.Pod
+		require.NoError(t, json.Unmarshal(event.Object.Raw, &pod))
+		pods = append(pods, event.Type+" "+pod.Name)
+	}
+	return pods
+}
+
+func TestLongPollWatch(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`})
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+
+	first := longPoll(t, s, "")
+	assert.Equal(t, []string{"ADDED web"}, eventPods(t, first.Events), "a new watch should start with the current pods")
+
+	second := longPoll(t, s, "&resourceVersion="+first.ResourceVersion)
+	assert.Empty(t, second.Events)
+	assert.Equal(t, first.ResourceVersion, second.ResourceVersion, "a watch without events should keep its cursor")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "local.json"),
+		[]byte(`[{"Id": "bbbbbbbbbbbb0002", "Names": ["db"], "State": "running"}]`), 0644))
+	third := longPoll(t, s, "&resourceVersion="+second.ResourceVersion)
+	assert.ElementsMatch(t, []string{"ADDED db", "DELETED web"}, eventPods(t, third.Events))
+	assert.NotEqual(t, second.ResourceVersion, third.ResourceVersion)
+
+	// The previous cursor can be retried until the next one is used
+	assert.Len(t, longPoll(t, s, "&resourceVersion="+second.ResourceVersion).Events, 2)
+	assert.Empty(t, longPoll(t, s, "&resourceVersion="+third.ResourceVersion).Events)
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods?watch=true&fallback=longpoll&timeoutSeconds=0&resourceVersion="+second.ResourceVersion)
+	assert.Equal(t, http.StatusGone, recorder.Code, "a cursor should be forgotten once the next one is used")
+
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods?watch=true&fallback=longpoll&timeoutSeconds=0&resourceVersion=unknown")
+	assert.Equal(t, http.StatusGone, recorder.Code)
+	assert.Equal(t, metav1.StatusReasonExpired, decodeStatus(t, recorder.Body.Bytes()).Reason)
+
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods?watch=true&fallback=longpoll&labelSelector=app%3Dweb&timeoutSeconds=0&resourceVersion="+third.ResourceVersion)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code, "a cursor should only continue the watch it belongs to")
+
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods?watch=true&fallback=longpoll&timeoutSeconds=soon")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestLongPollWatchFromList(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`})
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var podList corev1.PodList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &podList))
+
+	events := longPoll(t, s, "&resourceVersion="+podList.ResourceVersion)
+	assert.Empty(t, events.Events, "a watch started from a list should not repeat its pods")
+}
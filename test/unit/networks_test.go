@@ -0,0 +1,86 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanNetworks installs a podman with the podman network and a backend network
+// containers are connected to, and returns the file every invocation is logged to
+func fakePodmanNetworks(t *testing.T) string {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "inspect.json"), []byte(`[
+  {"name": "podman", "id": "2f259bab93aaaaf2e", "driver": "bridge", "subnets": [{"subnet": "10.88.0.0/16", "gateway": "10.88.0.1"}]},
+  {"name": "backend", "id": "9c0d6f3e1b2c4a5d6", "driver": "bridge", "internal": true}
+]`), 0644))
+	log := filepath.Join(dir, "calls")
+	testutil.FakeCommand(t, "podman", `
+echo "$@" >> `+log+`
+case "$1 $2" in
+"network ls") printf 'podman\nbackend\n' ;;
+"network inspect") cat `+filepath.Join(dir, "inspect.json")+` ;;
+"network create") ;;
+"network rm")
+	if [ "$3" = backend ]; then echo "Error: network backend is being used" >&2; exit 2; fi
+	;;
+ps*) echo '[]' ;;
+run*) echo 0123456789abcdef ;;
+*) exit 1 ;;
+esac
+`)
+	return log
+}
+
+func TestNetworkAPI(t *testing.T) {
+	log := fakePodmanNetworks(t)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/apis/podman.io/v1/networks")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var networkList storage.NetworkList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &networkList))
+	require.Len(t, networkList.Items, 2)
+	networks := map[string]storage.Network{}
+	for _, network := range networkList.Items {
+		networks[network.Name] = network
+	}
+	assert.Equal(t, []storage.NetworkSubnet{{Subnet: "10.88.0.0/16", Gateway: "10.88.0.1"}}, networks["podman"].Spec.Subnets)
+	assert.True(t, networks["backend"].Spec.Internal)
+
+	body := `{"apiVersion": "podman.io/v1", "kind": "Network", "metadata": {"name": "frontend"},
+		"spec": {"subnets": [{"subnet": "10.90.0.0/24", "gateway": "10.90.0.1"}], "internal": true}}`
+	recorder = serveRequest(s, http.MethodPost, "/apis/podman.io/v1/networks", "application/json", "", body)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	assert.Contains(t, podmanCalls(t, log, "network"), "network create --subnet 10.90.0.0/24 --gateway 10.90.0.1 --internal frontend")
+
+	deleteNetwork := func(name string) int {
+		return serveRequest(s, http.MethodDelete, "/apis/podman.io/v1/networks/"+name, "", "", "").Code
+	}
+	assert.Equal(t, http.StatusConflict, deleteNetwork("backend"), "networks containers are connected to cannot be removed")
+	assert.Equal(t, http.StatusOK, deleteNetwork("podman"))
+	assert.Equal(t, http.StatusNotFound, deleteNetwork("missing"))
+}
+
+func TestPodNetworkAnnotation(t *testing.T) {
+	log := fakePodmanNetworks(t)
+	s := server.New("127.0.0.1", 0)
+
+	body := `{"apiVersion": "v1", "kind": "Pod",
+		"metadata": {"name": "web", "namespace": "containers", "annotations": {"podman.io/network": "backend"}},
+		"spec": {"containers": [{"name": "web", "image": "nginx"}]}}`
+	serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", body)
+
+	runs := podmanCalls(t, log, "run")
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0], "--network backend nginx")
+}
@@ -0,0 +1,90 @@
+package unit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakeJournalctl installs a journalctl printing its arguments, one per line
+func fakeJournalctl(t *testing.T) {
+	testutil.FakeCommand(t, "journalctl", `for arg in "$@"; do echo "$arg"; done`)
+}
+
+func TestNodeLogs(t *testing.T) {
+	fakeJournalctl(t)
+	logFile := filepath.Join(t.TempDir(), "containers.log")
+	require.NoError(t, os.WriteFile(logFile, []byte("container started\n"), 0644))
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodeLogs("podman.service, podman.socket", "app="+logFile))
+
+	recorder := getPath(s, "/logs/")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "app\n?query=podman.service\n?query=podman.socket\n", recorder.Body.String())
+
+	for _, path := range []string{"/logs/app", "/logs/?query=app"} {
+		recorder = getPath(s, path)
+		require.Equal(t, http.StatusOK, recorder.Code, path)
+		assert.Equal(t, "container started\n", recorder.Body.String(), path)
+	}
+
+	recorder = getPath(s, "/logs/?query=podman.service&tailLines=10&pattern=error&boot=-1")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	args := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	assert.Contains(t, args, "--unit=podman.service")
+	assert.Contains(t, args, "--lines=10")
+	assert.Contains(t, args, "--grep=error")
+	assert.Contains(t, args, "--boot=-1")
+	assert.Equal(t, os.Geteuid() != 0, strings.Contains(recorder.Body.String(), "--user\n"),
+		"the journal of the user manager should be read when running rootless")
+
+	// Only the configured logs are readable
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/logs/?query=sshd.service").Code)
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/logs/passwd").Code)
+	assert.NotEqual(t, http.StatusOK, getPath(s, "/logs/../../etc/passwd").Code)
+
+	for _, query := range []string{"tailLines=-1", "sinceTime=yesterday", "pattern=(", "boot=1"} {
+		recorder = getPath(s, "/logs/?query=podman.service&"+query)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+}
+
+func TestNodeLogsProxy(t *testing.T) {
+	fakeJournalctl(t)
+	fakePodmanNodes(t, map[string]string{"local": "[]", "remote": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{
+		newTestNode(t, "node-a", "", nil),
+		newTestNode(t, "node-b", "remote", nil),
+	}, ""))
+	require.NoError(t, s.SetNodeLogs("podman.service", ""))
+
+	recorder := getPath(s, "/api/v1/nodes/node-a/proxy/logs/")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "?query=podman.service\n", recorder.Body.String())
+	recorder = getPath(s, "/api/v1/nodes/node-a/proxy/logs/?query=podman.service")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Body.String(), "--unit=podman.service")
+
+	assert.Equal(t, http.StatusServiceUnavailable, getPath(s, "/api/v1/nodes/node-b/proxy/logs/").Code,
+		"the logs of nodes on other hosts should not be served")
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/api/v1/nodes/node-z/proxy/logs/").Code)
+}
+
+func TestSetNodeLogs(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+	assert.NoError(t, s.SetNodeLogs("", "/var/log/containers.log,audit=/var/log/audit/audit.log"))
+	assert.Error(t, s.SetNodeLogs("", "containers.log"), "log files should be absolute paths")
+	assert.Error(t, s.SetNodeLogs("", "=/var/log/containers.log"))
+	assert.Error(t, s.SetNodeLogs("", "a/b=/var/log/containers.log"))
+	assert.Error(t, s.SetNodeLogs("", "/var/log/containers.log,/srv/log/containers.log"), "log file names should be unique")
+}
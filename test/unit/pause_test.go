@@ -0,0 +1,71 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// pausePodmanScript is a podman with a single container, web, in the state held by dir/state,
+// which pause and unpause change
+const pausePodmanScript = `
+case "$1" in
+ps) cat <<JSON
+[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "$(cat %[1]s/state)",
+  "Created": 1714557600, "StartedAt": 1714557601}]
+JSON
+;;
+inspect) echo '[]' ;;
+pause) echo "$@" >> %[1]s/calls; echo paused > %[1]s/state ;;
+unpause) echo "$@" >> %[1]s/calls; echo running > %[1]s/state ;;
+*) exit 1 ;;
+esac
+`
+
+func TestPodPause(t *testing.T) {
+	dir := t.TempDir()
+	testutil.FakeCommand(t, "podman", fmt.Sprintf(pausePodmanScript, dir))
+	setState := func(state string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "state"), []byte(state), 0644))
+	}
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+	post := func(action string) (int, []byte) {
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/"+action, "", "", "")
+		return recorder.Code, recorder.Body.Bytes()
+	}
+
+	setState("running")
+	code, body := post("pause")
+	require.Equal(t, http.StatusOK, code, string(body))
+	pod := decodePod(t, body)
+	assert.Equal(t, "true", pod.Annotations["podkube.io/paused"], "the returned pod should be paused")
+
+	code, _ = post("pause")
+	assert.Equal(t, http.StatusOK, code, "pausing a paused pod is a no-op")
+
+	code, body = post("unpause")
+	require.Equal(t, http.StatusOK, code, string(body))
+	assert.Empty(t, decodePod(t, body).Annotations["podkube.io/paused"])
+
+	calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+	require.NoError(t, err)
+	assert.Equal(t, "pause aaaaaaaaaaaa0001\nunpause aaaaaaaaaaaa0001\n", string(calls))
+
+	setState("exited")
+	code, body = post("pause")
+	assert.Equal(t, http.StatusConflict, code, "an exited pod cannot be paused")
+	assert.Equal(t, "Conflict", string(decodeStatus(t, body).Reason))
+
+	code, _ = post("unknown")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/missing/pause", "", "", "").Code)
+}
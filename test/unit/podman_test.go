@@ -0,0 +1,244 @@
+package unit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+const fakePodmanContainers = `[
+  {"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running"},
+  {"Id": "bbbbbbbbbbbb0002", "Names": ["db"], "Image": "postgres", "State": "running"}
+]`
+
+const fakePodmanInspect = `[
+  {"Id": "aaaaaaaaaaaa0001", "Config": {"Annotations": {"example.com/role": "frontend"}}},
+  {"Id": "bbbbbbbbbbbb0002", "Config": {"Annotations": {"example.com/role": "database"}}}
+]`
+
+// fakePodman installs a podman that answers ps and inspect with the given
+// JSON documents, generates a one-container pod for kube generate and records every invocation in the returned log file
+func fakePodman(t *testing.T, psOutput, inspectOutput string) string {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"ps.json": psOutput, "inspect.json": inspectOutput} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	log := filepath.Join(dir, "calls")
+	testutil.FakeCommand(t, "podman", `
+echo "$@" >> `+log+`
+case "$1" in
+ps) cat `+filepath.Join(dir, "ps.json")+` ;;
+inspect) cat `+filepath.Join(dir, "inspect.json")+` ;;
+kube) printf 'apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: generated-%s\n' "$5" ;;
+stop|rm|pod) ;;
+*) exit 1 ;;
+esac
+`)
+	return log
+}
+
+// podmanCalls returns the recorded podman invocations starting with command
+func podmanCalls(t *testing.T, log, command string) []string {
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	var calls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, command+" ") {
+			calls = append(calls, line)
+		}
+	}
+	return calls
+}
+
+func TestPodmanBatchedInspect(t *testing.T) {
+	log := fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+
+	podList, err := storage.NewPodStorage().List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	require.Len(t, podList.Items, 2)
+
+	inspects := podmanCalls(t, log, "inspect")
+	require.Len(t, inspects, 1, "all containers should be inspected with one podman call")
+	assert.Contains(t, inspects[0], "aaaaaaaaaaaa0001")
+	assert.Contains(t, inspects[0], "bbbbbbbbbbbb0002")
+
+	roles := map[string]string{}
+	for _, pod := range podList.Items {
+		roles[pod.Name] = pod.Annotations["example.com/role"]
+	}
+	assert.Equal(t, map[string]string{"web": "frontend", "db": "database"}, roles)
+}
+
+func TestPodmanInspectFallback(t *testing.T) {
+	// Unparsable batched output makes the storage inspect containers one at a time
+	log := fakePodman(t, fakePodmanContainers, "not json")
+
+	podList, err := storage.NewPodStorage().List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	assert.Len(t, podList.Items, 2)
+	assert.Len(t, podmanCalls(t, log, "inspect"), 3, "one batched call, then one per container")
+}
+
+func TestPodmanParallelism(t *testing.T) {
+	dir := t.TempDir()
+	running := filepath.Join(dir, "running")
+	require.NoError(t, os.Mkdir(running, 0755))
+	peaks := filepath.Join(dir, "peaks")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ps.json"), []byte(`[
+  {"Id": "cccccccccccc0001", "Names": ["one"], "State": "running"},
+  {"Id": "cccccccccccc0002", "Names": ["two"], "State": "running"},
+  {"Id": "cccccccccccc0003", "Names": ["three"], "State": "running"},
+  {"Id": "cccccccccccc0004", "Names": ["four"], "State": "running"},
+  {"Id": "cccccccccccc0005", "Names": ["five"], "State": "running"}
+]`), 0644))
+
+	// kube generate records how many calls are running at the same time
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) cat `+filepath.Join(dir, "ps.json")+` ;;
+inspect) echo '[]' ;;
+kube)
+	touch `+running+`/$$
+	ls `+running+` | wc -l >> `+peaks+`
+	sleep 0.2
+	rm `+running+`/$$
+	exit 1
+	;;
+esac
+`)
+
+	ps := storage.NewPodStorage()
+	ps.SetParallelism(2)
+
+	podList, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+
+	var names []string
+	for _, pod := range podList.Items {
+		names = append(names, pod.Name)
+	}
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, names, "pods should keep the podman ps order")
+
+	data, err := os.ReadFile(peaks)
+	require.NoError(t, err)
+	counts := strings.Fields(string(data))
+	assert.Len(t, counts, 5, "every container should be enriched")
+	for _, count := range counts {
+		running, err := strconv.Atoi(count)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, running, 2, "no more than 2 podman calls should run at once")
+	}
+}
+
+func TestPodmanPodSpecCache(t *testing.T) {
+	log := fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+
+	for i := 0; i < 3; i++ {
+		podList, err := ps.List(context.Background(), "", "", "")
+		require.NoError(t, err)
+		require.Len(t, podList.Items, 2)
+		for _, pod := range podList.Items {
+			require.Len(t, pod.Spec.Containers, 1)
+			assert.Equal(t, "generated-"+pod.Annotations["podman.io/container-id"], pod.Spec.Containers[0].Name)
+		}
+	}
+	assert.Len(t, podmanCalls(t, log, "kube"), 2, "specs should be generated once per container")
+
+	// A container recreated under the same ID gets a new spec
+	recreated := strings.Replace(fakePodmanContainers, `"Image": "nginx"`, `"Image": "nginx:latest"`, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(log), "ps.json"), []byte(recreated), 0644))
+
+	_, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	kubeCalls := podmanCalls(t, log, "kube")
+	require.Len(t, kubeCalls, 3)
+	assert.Contains(t, kubeCalls[2], "aaaaaaaaaaaa0001")
+}
+
+func TestPodmanCommandTimeout(t *testing.T) {
+	testutil.FakeCommand(t, "podman", "exec sleep 5\n")
+
+	ps := storage.NewPodStorage()
+	ps.SetCommandTimeout(200 * time.Millisecond)
+
+	start := time.Now()
+	_, err := ps.List(context.Background(), "", "", "")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second, "podman ps should be killed after the command timeout")
+}
+
+func TestPodmanRequestCancellation(t *testing.T) {
+	testutil.FakeCommand(t, "podman", "exec sleep 5\n")
+
+	ps := storage.NewPodStorage()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := ps.List(ctx, "", "", "")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second, "podman ps should be killed when the request goes away")
+}
+
+func TestPodmanConnection(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection string
+		identity   string
+		expected   []string
+		wantErr    bool
+	}{
+		{name: "local", connection: "", expected: []string{"ps"}},
+		{name: "named connection", connection: "podman-machine-default", expected: []string{"--remote", "--connection", "podman-machine-default", "ps"}},
+		{name: "ssh with identity", connection: "ssh://core@host/run/podman/podman.sock", identity: "/keys/id_ed25519",
+			expected: []string{"--remote", "--url", "ssh://core@host/run/podman/podman.sock", "--identity", "/keys/id_ed25519", "ps"}},
+		{name: "unix socket", connection: "unix:///run/podman/podman.sock", expected: []string{"--remote", "--url", "unix:///run/podman/podman.sock", "ps"}},
+		{name: "unsupported scheme", connection: "http://host:8080", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := storage.NewPodStorage()
+			err := ps.SetConnection(tt.connection, tt.identity)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ps.PodmanArgs("ps"))
+		})
+	}
+}
+
+func TestPodmanConnectionUsedForListing(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	testutil.FakeCommand(t, "podman", `
+echo "$@" >> `+log+`
+case "$4" in
+ps) echo '[]' ;;
+esac
+`)
+
+	ps := storage.NewPodStorage()
+	require.NoError(t, ps.SetConnection("podman-machine-default", ""))
+	_, err := ps.List(context.Background(), "", "", "")
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	assert.Equal(t, "--remote --connection podman-machine-default ps --format json --all\n", string(data))
+}
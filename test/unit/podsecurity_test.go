@@ -0,0 +1,73 @@
+package unit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// securityPodJSON returns a pod of the containers namespace with the given spec fields,
+// those of its container and volumes
+func securityPodJSON(specFields, containerFields string) string {
+	return `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web", "namespace": "containers"},
+		"spec": {` + specFields + ` "containers": [{"name": "web", "image": "nginx"` + containerFields + `}]}}`
+}
+
+func TestPodSecurityAdmission(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	namespacePath := "/api/v1/namespaces/containers"
+	podsPath := "/api/v1/namespaces/containers/pods"
+
+	t.Run("invalid labels", func(t *testing.T) {
+		for _, labels := range []string{
+			`{"pod-security.kubernetes.io/enforce": "strict"}`,
+			`{"pod-security.kubernetes.io/enforce-version": "1.29"}`,
+			`{"team": "web"}`,
+		} {
+			recorder := serveRequest(s, http.MethodPatch, namespacePath, "application/merge-patch+json", "", `{"metadata": {"labels": `+labels+`}}`)
+			assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code, labels)
+		}
+	})
+
+	recorder := serveRequest(s, http.MethodPatch, namespacePath, "application/merge-patch+json", "",
+		`{"metadata": {"labels": {"pod-security.kubernetes.io/enforce": "baseline", "pod-security.kubernetes.io/warn": "restricted"}}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "baseline", getNamespace(t, s, "containers").Labels["pod-security.kubernetes.io/enforce"])
+
+	tests := []struct {
+		name            string
+		specFields      string
+		containerFields string
+		violation       string
+	}{
+		{"host network", `"hostNetwork": true,`, "", "host namespaces (hostNetwork=true)"},
+		{"privileged container", "", `, "securityContext": {"privileged": true}`, "privileged"},
+		{"added capability", "", `, "securityContext": {"capabilities": {"add": ["SYS_ADMIN"]}}`, `"SYS_ADMIN"`},
+		{"host port", "", `, "ports": [{"containerPort": 80, "hostPort": 8080}]`, "hostPort"},
+		{"hostPath volume", `"volumes": [{"name": "root", "hostPath": {"path": "/"}}],`, "", "hostPath"},
+		{"unsafe sysctl", `"securityContext": {"sysctls": [{"name": "kernel.msgmax", "value": "1"}]},`, "", "kernel.msgmax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveRequest(s, http.MethodPost, podsPath, "application/json", "", securityPodJSON(tt.specFields, tt.containerFields))
+			require.Equal(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+			message := decodeStatus(t, recorder.Body.Bytes()).Message
+			assert.Contains(t, message, `violates PodSecurity "baseline:latest"`)
+			assert.Contains(t, message, tt.violation)
+		})
+	}
+
+	t.Run("baseline pod is warned about the restricted level", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodPost, podsPath, "application/json", "", securityPodJSON("", ""))
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		warnings := strings.Join(recorder.Header().Values("Warning"), "\n")
+		assert.Contains(t, warnings, "would violate PodSecurity")
+		assert.Contains(t, warnings, "allowPrivilegeEscalation")
+	})
+}
@@ -0,0 +1,140 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// statusPodmanScript is a podman with a running container, web, and a failed one, job, whose
+// nginx image was pulled by digest
+const statusPodmanScript = `
+case "$1" in
+ps) cat <<'JSON'
+[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "docker.io/library/nginx:1.25", "ImageID": "1111111111111111",
+  "State": "running", "Created": 1714557600, "StartedAt": 1714557601},
+ {"Id": "bbbbbbbbbbbb0002", "Names": ["job"], "Image": "busybox", "ImageID": "2222222222222222",
+  "State": "exited", "ExitCode": 2, "Created": 1714557600, "StartedAt": 1714557601, "ExitedAt": 1714557660}]
+JSON
+;;
+image)
+	[ "$3" = 1111111111111111 ] && [ -z "$4" ] || exit 125
+	echo '[{"Id": "1111111111111111", "RepoDigests": ["docker.io/library/nginx@sha256:abcdef"]}]'
+	;;
+inspect) echo '[]' ;;
+*) exit 1 ;;
+esac
+`
+
+func TestPodStatusFidelity(t *testing.T) {
+	testutil.FakeCommand(t, "podman", statusPodmanScript)
+
+	podList, err := storage.NewPodStorage().List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	pods := map[string]corev1.Pod{}
+	for _, pod := range podList.Items {
+		pods[pod.Name] = pod
+	}
+	require.Len(t, pods, 2)
+
+	web := pods["web"]
+	assert.Equal(t, corev1.PodQOSBestEffort, web.Status.QOSClass)
+	conditions := map[corev1.PodConditionType]corev1.PodCondition{}
+	for _, condition := range web.Status.Conditions {
+		conditions[condition.Type] = condition
+	}
+	for _, conditionType := range []corev1.PodConditionType{corev1.PodScheduled, corev1.PodInitialized, corev1.ContainersReady, corev1.PodReady} {
+		require.Contains(t, conditions, conditionType)
+		assert.Equal(t, corev1.ConditionTrue, conditions[conditionType].Status, "%s", conditionType)
+		assert.False(t, conditions[conditionType].LastTransitionTime.Time.IsZero(), "%s should have a transition time", conditionType)
+	}
+	assert.Equal(t, time.Unix(1714557601, 0), conditions[corev1.PodReady].LastTransitionTime.Time, "the pod became ready when its container started")
+	require.Len(t, web.Status.ContainerStatuses, 1)
+	assert.Equal(t, "docker.io/library/nginx@sha256:abcdef", web.Status.ContainerStatuses[0].ImageID, "the image ID should be the digest the image was pulled by")
+	assert.Len(t, web.Spec.Tolerations, 2, "the default tolerations should be set")
+
+	job := pods["job"]
+	require.Len(t, job.Status.ContainerStatuses, 1)
+	status := job.Status.ContainerStatuses[0]
+	assert.Equal(t, "sha256:2222222222222222", status.ImageID, "an image without digests should be named by its ID")
+	require.NotNil(t, status.State.Terminated)
+	assert.Equal(t, "Error", status.State.Terminated.Reason)
+	assert.Equal(t, time.Unix(1714557601, 0), status.State.Terminated.StartedAt.Time)
+	assert.Equal(t, time.Unix(1714557660, 0), status.State.Terminated.FinishedAt.Time)
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			assert.Equal(t, corev1.ConditionFalse, condition.Status)
+			assert.Equal(t, "PodCompleted", condition.Reason)
+		}
+	}
+}
+
+func TestContainerStates(t *testing.T) {
+	fakePodman(t, `[
+  {"Id": "aaaaaaaaaaaa0001", "Names": ["paused"], "Image": "nginx", "State": "paused", "StartedAt": 1714557601},
+  {"Id": "aaaaaaaaaaaa0002", "Names": ["restarting"], "Image": "nginx", "State": "restarting", "Restarts": 4,
+   "ExitCode": 1, "StartedAt": 1714557601, "ExitedAt": 1714557660},
+  {"Id": "aaaaaaaaaaaa0003", "Names": ["stopping"], "Image": "nginx", "State": "stopping", "StartedAt": 1714557601},
+  {"Id": "aaaaaaaaaaaa0004", "Names": ["removing"], "Image": "nginx", "State": "removing", "StartedAt": 1714557601, "ExitedAt": 1714557660},
+  {"Id": "aaaaaaaaaaaa0005", "Names": ["initialized"], "Image": "nginx", "State": "initialized"}
+]`, "[]")
+
+	tests := []struct {
+		name   string
+		phase  corev1.PodPhase
+		ready  bool
+		status string // STATUS column of the pod table
+	}{
+		{name: "paused", phase: corev1.PodRunning, ready: false, status: "Paused"},
+		{name: "restarting", phase: corev1.PodRunning, ready: false, status: "CrashLoopBackOff"},
+		{name: "stopping", phase: corev1.PodRunning, ready: false, status: "Running"},
+		{name: "removing", phase: corev1.PodSucceeded, ready: false, status: "Completed"},
+		{name: "initialized", phase: corev1.PodPending, ready: false, status: "ContainerCreating"},
+	}
+
+	podList, err := storage.NewPodStorage().List(context.Background(), "", "", "")
+	require.NoError(t, err)
+	pods := map[string]corev1.Pod{}
+	for _, pod := range podList.Items {
+		pods[pod.Name] = pod
+	}
+	table := getTable(t, server.New("127.0.0.1", 0), "/api/v1/namespaces/containers/pods")
+	statuses := map[string]interface{}{}
+	for _, row := range table.Rows {
+		statuses[row.Cells[0].(string)] = row.Cells[2]
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pod, ok := pods[test.name]
+			require.True(t, ok)
+			assert.Equal(t, test.phase, pod.Status.Phase)
+			require.Len(t, pod.Status.ContainerStatuses, 1)
+			assert.Equal(t, test.ready, pod.Status.ContainerStatuses[0].Ready)
+			assert.Equal(t, test.status, statuses[test.name])
+		})
+	}
+
+	paused := pods["paused"]
+	assert.Equal(t, "true", paused.Annotations["podkube.io/paused"])
+	pausedCondition := false
+	for _, condition := range paused.Status.Conditions {
+		if condition.Type == "Paused" {
+			pausedCondition = condition.Status == corev1.ConditionTrue
+		}
+	}
+	assert.True(t, pausedCondition, "a paused pod should have the Paused condition")
+
+	restarting := pods["restarting"].Status.ContainerStatuses[0]
+	assert.Equal(t, int32(4), restarting.RestartCount)
+	require.NotNil(t, restarting.LastTerminationState.Terminated, "the last exit should be the last state")
+	assert.Equal(t, int32(1), restarting.LastTerminationState.Terminated.ExitCode)
+}
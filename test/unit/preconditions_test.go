@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+const preconditionsContainers = `[
+	{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"},
+	{"Id": "bbbbbbbbbbbb0002", "Names": ["db"], "State": "running"}
+]`
+
+func TestStableUIDs(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": preconditionsContainers})
+
+	uids := func() map[string]string {
+		ps := storage.NewPodStorage()
+		podList, err := ps.List(context.Background(), "", "", "")
+		require.NoError(t, err)
+		uids := map[string]string{}
+		for _, pod := range podList.Items {
+			uids[pod.Name] = string(pod.UID)
+		}
+		return uids
+	}
+
+	first := uids()
+	require.Len(t, first, 2)
+	assert.Len(t, first["web"], 36, "UIDs should be formatted like UUIDs")
+	assert.NotEqual(t, first["web"], first["db"])
+	assert.Equal(t, first, uids(), "UIDs should not change across adapter restarts")
+}
+
+func TestDeletePreconditions(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": preconditionsContainers})
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods/web")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var web corev1.Pod
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &web))
+	assert.Equal(t, "aaaaaaaaaaaa", web.ResourceVersion)
+
+	deleteWith := func(preconditions metav1.Preconditions) *httptest.ResponseRecorder {
+		body, err := json.Marshal(metav1.DeleteOptions{Preconditions: &preconditions})
+		require.NoError(t, err)
+		return serveRequest(s, http.MethodDelete, "/api/v1/namespaces/containers/pods/web", "application/json", "", string(body))
+	}
+
+	otherUID := web.UID + "x"
+	recorder = deleteWith(metav1.Preconditions{UID: &otherUID})
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+	assert.Equal(t, metav1.StatusReasonConflict, status.Reason)
+
+	staleVersion := "000000000000"
+	recorder = deleteWith(metav1.Preconditions{ResourceVersion: &staleVersion})
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = deleteWith(metav1.Preconditions{UID: &web.UID, ResourceVersion: &web.ResourceVersion})
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestUpdatePreconditions(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": preconditionsContainers})
+	s := server.New("127.0.0.1", 0)
+
+	update := func(resourceVersion string) int {
+		pod := decodePod(t, getPath(s, "/api/v1/namespaces/containers/pods/web").Body.Bytes())
+		pod.ResourceVersion = resourceVersion
+		body, err := json.Marshal(pod)
+		require.NoError(t, err)
+		return serveRequest(s, http.MethodPut, "/api/v1/namespaces/containers/pods/web", "application/json", "", string(body)).Code
+	}
+
+	assert.Equal(t, http.StatusConflict, update("000000000000"))
+	assert.Equal(t, http.StatusOK, update("aaaaaaaaaaaa"))
+	assert.Equal(t, http.StatusOK, update(""), "updates without a resourceVersion are unconditional")
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "rm"))
+}
@@ -0,0 +1,285 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+const projectPath = "/apis/project.openshift.io/v1/projects/containers"
+
+func decodeProject(t *testing.T, data []byte) *storage.Project {
+	var project storage.Project
+	require.NoError(t, json.Unmarshal(data, &project), string(data))
+	return &project
+}
+
+func getNamespace(t *testing.T, s *server.Server, name string) *corev1.Namespace {
+	recorder := getPath(s, "/api/v1/namespaces/"+name)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var namespace corev1.Namespace
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &namespace))
+	return &namespace
+}
+
+func TestProjectAnnotations(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	stateDir := t.TempDir()
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetStateDir(stateDir, ""))
+
+	patch := `{"metadata": {"annotations": {"openshift.io/display-name": "Web containers"}}}`
+	recorder := serveRequest(s, http.MethodPatch, projectPath, "application/merge-patch+json", "", patch)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "Web containers", decodeProject(t, recorder.Body.Bytes()).Annotations["openshift.io/display-name"])
+	assert.FileExists(t, filepath.Join(stateDir, "namespaces.json"))
+
+	recorder = serveRequest(s, http.MethodPatch, projectPath, "application/merge-patch+json", "", `{"metadata": {"labels": {"team": "web"}}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code, "only the annotations of projects can change")
+
+	recorder = serveRequest(s, http.MethodPatch, projectPath+"?dryRun=All", "application/merge-patch+json", "",
+		`{"metadata": {"annotations": {"openshift.io/display-name": "Dry run"}}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "Dry run", decodeProject(t, recorder.Body.Bytes()).Annotations["openshift.io/display-name"])
+
+	recorder = serveRequest(s, http.MethodPatch, "/apis/project.openshift.io/v1/projects/missing", "application/merge-patch+json", "", patch)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	// The annotations survive a restart, and are those of the namespace too
+	restarted := server.New("127.0.0.1", 0)
+	require.NoError(t, restarted.SetStateDir(stateDir, ""))
+	recorder = getPath(restarted, projectPath)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "Web containers", decodeProject(t, recorder.Body.Bytes()).Annotations["openshift.io/display-name"])
+	assert.Equal(t, "Web containers", getNamespace(t, restarted, "containers").Annotations["openshift.io/display-name"])
+
+	require.NoError(t, os.WriteFile(filepath.Join(stateDir, "namespaces.json"), []byte("{"), 0600))
+	assert.Error(t, server.New("127.0.0.1", 0).SetStateDir(stateDir, ""), "an invalid state should fail to load")
+}
+
+func TestProjectResourceVersionPatch(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	read := decodeProject(t, getPath(s, projectPath).Body.Bytes())
+
+	patch := `{"metadata": {"annotations": {"team": "a"}}}`
+	recorder := serveRequest(s, http.MethodPatch, projectPath, "application/merge-patch+json", "", patch)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.NotEqual(t, read.ResourceVersion, decodeProject(t, recorder.Body.Bytes()).ResourceVersion)
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		wantCode    int
+	}{
+		{"merge patch of the stale version", "application/merge-patch+json",
+			`{"metadata": {"resourceVersion": "` + read.ResourceVersion + `", "annotations": {"team": "b"}}}`, http.StatusConflict},
+		{"JSON patch of the stale version", "application/json-patch+json",
+			`[{"op": "replace", "path": "/metadata/resourceVersion", "value": "` + read.ResourceVersion + `"}]`, http.StatusConflict},
+		{"annotation naming the resourceVersion", "application/merge-patch+json",
+			`{"metadata": {"annotations": {"resourceVersion": "` + read.ResourceVersion + `"}}}`, http.StatusOK},
+		{"JSON patch testing the current annotation", "application/json-patch+json",
+			`[{"op": "test", "path": "/metadata/annotations/team", "value": "a"}, {"op": "add", "path": "/metadata/annotations/note", "value": "resourceVersion"}]`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := serveRequest(s, http.MethodPatch, projectPath, tt.contentType, "", tt.patch)
+			require.Equal(t, tt.wantCode, recorder.Code, recorder.Body.String())
+			if tt.wantCode == http.StatusConflict {
+				assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, "the object has been modified")
+			}
+		})
+	}
+	assert.Equal(t, "a", decodeProject(t, getPath(s, projectPath).Body.Bytes()).Annotations["team"], "conflicting patches should not apply")
+}
+
+func TestDeleteProject(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodDelete, projectPath+"?dryRun=All", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, corev1.NamespaceActive, getNamespace(t, s, "containers").Status.Phase, "a dry run should delete nothing")
+
+	recorder = serveRequest(s, http.MethodDelete, projectPath, "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, `project "containers" deleted`, decodeStatus(t, recorder.Body.Bytes()).Message)
+
+	namespace := getNamespace(t, s, "containers")
+	assert.Equal(t, corev1.NamespaceTerminating, namespace.Status.Phase)
+	assert.NotNil(t, namespace.DeletionTimestamp)
+	recorder = getPath(s, projectPath+"/status")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, string(corev1.NamespaceTerminating), decodeProject(t, recorder.Body.Bytes()).Status.Phase)
+	assert.Equal(t, corev1.NamespaceActive, getNamespace(t, s, "pods").Status.Phase, "other namespaces should not be deleted")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", webhookPodJSON)
+	require.Equal(t, http.StatusForbidden, recorder.Code, "pods should not be created in a terminating namespace")
+	assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, "because it is being terminated")
+
+	recorder = serveRequest(s, http.MethodDelete, "/api/v1/namespaces/pods", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var deleted corev1.Namespace
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &deleted))
+	assert.Equal(t, corev1.NamespaceTerminating, deleted.Status.Phase, "deleting a namespace should return it terminating")
+
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodDelete, "/api/v1/namespaces/missing", "", "", "").Code)
+}
+
+func TestNamespaceDeleter(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]`})
+	cluster := storage.NewCluster(newTestNode(t, "node-a", "", nil))
+	_, err := cluster.DeleteNamespace("containers")
+	require.NoError(t, err)
+	require.True(t, cluster.NamespaceTerminating("containers"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cluster.RunNamespaceDeleter(ctx)
+
+	require.Eventually(t, func() bool {
+		project, err := cluster.GetProject("containers")
+		return err == nil && len(project.Status.Conditions) > 0
+	}, 5*time.Second, 20*time.Millisecond, "the pods left should be reported")
+	project, err := cluster.GetProject("containers")
+	require.NoError(t, err)
+	assert.Equal(t, corev1.NamespaceContentRemaining, project.Status.Conditions[0].Type)
+	calls, err := os.ReadFile(filepath.Join(dir, "calls"))
+	require.NoError(t, err)
+	assert.Contains(t, string(calls), "rm", "the pods of a terminating namespace should be deleted")
+
+	// The namespace is deleted once its last pod is gone, on the next pass
+	cancel()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go cluster.RunNamespaceDeleter(ctx)
+	assert.Eventually(t, func() bool { return !cluster.NamespaceTerminating("containers") }, 5*time.Second, 20*time.Millisecond)
+	project, err = cluster.GetProject("containers")
+	require.NoError(t, err)
+	assert.Equal(t, "Active", project.Status.Phase)
+	assert.Nil(t, project.DeletionTimestamp)
+}
+
+func TestEncryptedNamespaceState(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	stateDir := t.TempDir()
+	encryptionConfig := writeEncryptionConfig(t, aesgcmProvider("key1"))
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetStateDir(stateDir, encryptionConfig))
+
+	patch := `{"metadata": {"annotations": {"openshift.io/display-name": "Web containers"}}}`
+	recorder := serveRequest(s, http.MethodPatch, projectPath, "application/merge-patch+json", "", patch)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	content, err := os.ReadFile(filepath.Join(stateDir, "namespaces.json"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "Web containers", "the state should be encrypted at rest")
+
+	restarted := server.New("127.0.0.1", 0)
+	require.NoError(t, restarted.SetStateDir(stateDir, encryptionConfig))
+	recorder = getPath(restarted, projectPath)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "Web containers", decodeProject(t, recorder.Body.Bytes()).Annotations["openshift.io/display-name"])
+
+	assert.Error(t, server.New("127.0.0.1", 0).SetStateDir(stateDir, ""), "encrypted state should not be read without its key")
+}
+
+func TestStateDirSurvivesRestarts(t *testing.T) {
+	fakePodmanPublishing(t)
+	stateDir := t.TempDir()
+	newServer := func() *server.Server {
+		s := server.New("127.0.0.1", 0)
+		s.SetCacheTTL(0)
+		s.SetRoutePortForwards(true)
+		require.NoError(t, s.SetStateDir(stateDir, ""))
+		return s
+	}
+	s := newServer()
+
+	patch := `{"metadata": {"labels": {"tier": "frontend"}, "finalizers": ["example.com/cleanup"]}}`
+	recorder := serveRequest(s, http.MethodPatch, "/api/v1/namespaces/containers/pods/web", "application/merge-patch+json", "", patch)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	createRoute(t, s, "web", "web", "http")
+	assert.FileExists(t, filepath.Join(stateDir, "pods.json"))
+	assert.FileExists(t, filepath.Join(stateDir, "routes.json"))
+
+	restarted := newServer()
+	recorder = getPath(restarted, "/api/v1/namespaces/containers/pods/web")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	pod := decodePod(t, recorder.Body.Bytes())
+	assert.Equal(t, "frontend", pod.Labels["tier"], "label changes should survive a restart")
+	assert.Equal(t, []string{"example.com/cleanup"}, pod.Finalizers, "finalizers should survive a restart")
+	assert.Equal(t, http.StatusOK, getPath(restarted, routesPath+"/web").Code, "routes should survive a restart")
+}
+
+func TestLegacyOAPIProjects(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/oapi/v1/projects")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Contains(t, recorder.Header().Get("Warning"), "/oapi/v1 API is deprecated")
+	var projects storage.ProjectList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &projects))
+	assert.NotEmpty(t, projects.Items)
+
+	recorder = getPath(s, "/oapi/v1/projects/containers")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, "containers", decodeProject(t, recorder.Body.Bytes()).Name)
+
+	recorder = getPath(s, "/oapi/v1/builds")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Warning"), "/oapi/v1 API is deprecated")
+	assert.Equal(t, metav1.StatusReasonNotFound, decodeStatus(t, recorder.Body.Bytes()).Reason)
+
+	// Projects are not watchable, under either path: a watch must not get a list and a closed connection
+	for _, path := range []string{"/oapi/v1/projects?watch=true", "/apis/project.openshift.io/v1/projects?watch=true"} {
+		recorder = getPath(s, path)
+		require.Equal(t, http.StatusMethodNotAllowed, recorder.Code, path)
+		assert.Equal(t, metav1.StatusReasonMethodNotAllowed, decodeStatus(t, recorder.Body.Bytes()).Reason, path)
+	}
+}
+
+func TestProjectPodCountAnnotations(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetStateDir(t.TempDir(), ""))
+
+	recorder := getPath(s, projectPath)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	project := decodeProject(t, recorder.Body.Bytes())
+	assert.Equal(t, "2", project.Annotations["podkube.io/running-pods"])
+	assert.Equal(t, "0", project.Annotations["podkube.io/exited-pods"])
+	assert.Equal(t, "2", getNamespace(t, s, "containers").Annotations["podkube.io/running-pods"])
+
+	// Sent back in an update, the counts are not stored but computed again
+	patch := `{"metadata": {"annotations": {"podkube.io/running-pods": "9", "openshift.io/display-name": "Web"}}}`
+	recorder = serveRequest(s, http.MethodPatch, projectPath, "application/merge-patch+json", "", patch)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = getPath(s, projectPath)
+	project = decodeProject(t, recorder.Body.Bytes())
+	assert.Equal(t, "Web", project.Annotations["openshift.io/display-name"])
+	assert.Equal(t, "2", project.Annotations["podkube.io/running-pods"])
+
+	// Lists are not annotated, to not list the pods of every namespace
+	recorder = getPath(s, "/apis/project.openshift.io/v1/projects")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var projects storage.ProjectList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &projects))
+	for _, listed := range projects.Items {
+		assert.NotContains(t, listed.Annotations, "podkube.io/running-pods", listed.Name)
+	}
+}
@@ -0,0 +1,87 @@
+package unit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func TestPodProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s authorization=%q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+	_, port, err := net.SplitHostPort(backend.Listener.Addr().String())
+	require.NoError(t, err)
+
+	// The pod IP is read with inspect --format
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) echo '[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]' ;;
+inspect) if [ "$2" = "--format" ]; then echo "127.0.0.1 "; else echo '[]'; fi ;;
+kube) printf 'apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: main\n' ;;
+*) exit 1 ;;
+esac
+`)
+	s := server.New("127.0.0.1", 0)
+	s.SetCacheTTL(0)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/containers/pods/web:"+port+"/proxy/healthz", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal(t, `GET /healthz authorization=""`, recorder.Body.String(), "the API credentials should not reach the pod")
+	}
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods/missing/proxy/")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods/web:http/proxy/")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, "a port name the pod does not declare cannot be proxied")
+}
+
+func TestServiceProxy(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	// The HTTPS listener of podKube, the endpoint of the kubernetes service
+	listener := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s authorization=%q", r.Method, r.URL.Path, r.Header.Get("Authorization"))
+	}))
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	s := server.New("127.0.0.1", portNumber)
+	proxyPath := "/api/v1/namespaces/default/services/https:kubernetes:https/proxy/version"
+
+	recorder := getPath(s, proxyPath)
+	assert.Equal(t, http.StatusNotFound, recorder.Code, "the service is only served with --kubernetes-service")
+
+	require.NoError(t, s.SetKubernetesService(true))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, proxyPath, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		recorder = httptest.NewRecorder()
+		s.Handler().ServeHTTP(recorder, req)
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal(t, `GET /version authorization=""`, recorder.Body.String(), "the client credentials should not be forwarded")
+	}
+
+	recorder = getPath(s, "/api/v1/namespaces/default/services/https:kubernetes:"+port+"/proxy/version")
+	assert.Equal(t, http.StatusOK, recorder.Code, "the service port can be given by number")
+	recorder = getPath(s, "/api/v1/namespaces/default/services/https:kubernetes:metrics/proxy/")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code, "the service has no such port")
+	recorder = getPath(s, "/api/v1/namespaces/containers/services/web/proxy/")
+	assert.Equal(t, http.StatusNotFound, recorder.Code, "only the kubernetes service is served")
+}
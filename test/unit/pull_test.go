@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// pullFailurePodmanScript is a podman without containers whose runs fail to pull their
+// image, recording them in dir/runs
+const pullFailurePodmanScript = `
+case "$1" in
+ps|inspect) echo '[]' ;;
+run)
+	echo run >> %[1]s/runs
+	echo "Trying to pull registry.example.com/app:1.0..." >&2
+	echo "Error: initializing source docker://registry.example.com/app:1.0: reading manifest 1.0 in registry.example.com/app: unauthorized: authentication required" >&2
+	exit 125
+	;;
+*) exit 1 ;;
+esac
+`
+
+func TestImagePullBackOff(t *testing.T) {
+	dir := t.TempDir()
+	testutil.FakeCommand(t, "podman", fmt.Sprintf(pullFailurePodmanScript, dir))
+	s := server.New("127.0.0.1", 0)
+	podJSON := `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "app", "namespace": "containers"},
+		"spec": {"containers": [{"name": "app", "image": "registry.example.com/app:1.0"}]}}`
+
+	recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	message := decodeStatus(t, recorder.Body.Bytes()).Message
+	assert.True(t, strings.HasPrefix(message, `ErrImagePull: Failed to pull image "registry.example.com/app:1.0"`), message)
+	assert.Contains(t, message, "unauthorized: authentication required", "the error of the registry should be reported")
+
+	recorder = serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods", "application/json", "", podJSON)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	message = decodeStatus(t, recorder.Body.Bytes()).Message
+	assert.True(t, strings.HasPrefix(message, `ImagePullBackOff: Back-off pulling image "registry.example.com/app:1.0"`), message)
+	assert.Contains(t, message, "unauthorized: authentication required")
+
+	runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+	require.NoError(t, err)
+	assert.Equal(t, "run\n", string(runs), "an image backing off should not be pulled again")
+}
@@ -0,0 +1,95 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// fakePodmanSecrets installs a podman whose secrets are the lines of dir/secrets, as
+// "ID<tab>NAME", and whose secret values are "value of NAME"
+func fakePodmanSecrets(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+	secrets := filepath.Join(dir, "secrets")
+	var lines string
+	for i, name := range names {
+		lines += string(rune('a'+i)) + "0000000000000000000000000\t" + name + "\n"
+	}
+	require.NoError(t, os.WriteFile(secrets, []byte(lines), 0644))
+	testutil.FakeCommand(t, "podman", `
+case "$1 $2" in
+"secret ls") awk -F '\t' '{ printf "%s\t%s\tfile\t2 hours ago\t2 hours ago\n", $1, $2 }' `+secrets+` ;;
+"secret create") cat > /dev/null; printf 'f0000000000000000000000000\t%s\n' "$3" >> `+secrets+` ;;
+"secret rm") awk -F '\t' -v name="$3" '$2 != name' `+secrets+` > `+secrets+`.new; mv `+secrets+`.new `+secrets+` ;;
+run*)
+	while [ "$1" != "--secret" ]; do shift; done
+	printf 'value of %s' "${2%%,*}"
+	;;
+*) exit 1 ;;
+esac
+`)
+	return secrets
+}
+
+func TestSecretREST(t *testing.T) {
+	fakePodmanSecrets(t, "db-password")
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/secrets"
+
+	recorder := getPath(s, path+"/db-password")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var secret corev1.Secret
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &secret))
+	assert.Equal(t, "value of db-password", string(secret.Data["data"]))
+
+	recorder = getPath(s, path+"/missing")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, metav1.StatusReasonNotFound, decodeStatus(t, recorder.Body.Bytes()).Reason)
+
+	body := `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "db-password"}, "data": {"data": "c2VjcmV0"}}`
+	recorder = serveRequest(s, http.MethodPost, path, "application/json", "", body)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Equal(t, metav1.StatusReasonAlreadyExists, decodeStatus(t, recorder.Body.Bytes()).Reason)
+
+	body = `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "api-token"}, "data": {"data": "c2VjcmV0"}}`
+	recorder = serveRequest(s, http.MethodPost, path, "application/json", "", body)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+	recorder = serveRequest(s, http.MethodDelete, path+"/db-password", "", "", "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Equal(t, `secret "db-password" deleted`, decodeStatus(t, recorder.Body.Bytes()).Message)
+
+	recorder = getPath(s, "/api/v1/secrets")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var secretList corev1.SecretList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &secretList))
+	require.Len(t, secretList.Items, 1, recorder.Body.String())
+	assert.Equal(t, "api-token", secretList.Items[0].Name)
+
+	recorder = getPath(s, path+"?labelSelector=app%3Dweb")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &secretList))
+	assert.Empty(t, secretList.Items, "the label selector should filter the list")
+	assert.Equal(t, http.StatusBadRequest, getPath(s, path+"?labelSelector=%3D%3D").Code)
+}
+
+func TestRESTVerbsFollowStorage(t *testing.T) {
+	fakePodmanSecrets(t)
+	s := server.New("127.0.0.1", 0)
+
+	// Nodes are read-only, secrets cannot be updated
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(s, http.MethodPost, "/api/v1/nodes", "application/json", "", "{}").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveRequest(s, http.MethodDelete, "/api/v1/nodes/local", "", "", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed,
+		serveRequest(s, http.MethodPut, "/api/v1/namespaces/containers/secrets/db-password", "application/json", "", "{}").Code)
+}
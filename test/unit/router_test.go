@@ -0,0 +1,59 @@
+package unit
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+func TestRouteVerbs(t *testing.T) {
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) echo '[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]' ;;
+inspect) echo '[]' ;;
+*) exit 1 ;;
+esac
+`)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := serveRequest(s, http.MethodPut, "/api/v1/namespaces/containers/pods", "application/json", "", "{}")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Allow"), http.MethodPost)
+
+	recorder = serveRequest(s, http.MethodOptions, "/api/v1/namespaces/containers/pods/web/log", "", "", "")
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", recorder.Header().Get("Allow"))
+
+	recorder = serveRequest(s, http.MethodHead, "/api/v1/namespaces/containers/pods/web", "", "", "")
+	assert.Equal(t, http.StatusOK, recorder.Code, "GET routes should serve HEAD")
+
+	recorder = serveRequest(s, http.MethodGet, "/api/v1/namespaces/containers/pods/web/binding", "", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestExecRouteVerbs(t *testing.T) {
+	fakePodman(t, "[]", "[]")
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/pods/web/exec?command=ls&stdout=true"
+
+	// Browsers and kubectl open websocket exec sessions with a GET upgrade request
+	t.Run("GET upgrade", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodGet, path, "", "", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code, "the exec handler should be reached: %s", recorder.Body)
+	})
+
+	t.Run("POST", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodPost, path, "", "", "")
+		assert.Equal(t, http.StatusNotFound, recorder.Code, "the exec handler should be reached: %s", recorder.Body)
+	})
+
+	t.Run("PUT", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodPut, path, "", "", "")
+		assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+		assert.Equal(t, "GET, HEAD, OPTIONS, POST", recorder.Header().Get("Allow"))
+	})
+}
@@ -0,0 +1,118 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+const routesPath = "/apis/route.openshift.io/v1/namespaces/containers/routes"
+
+// testRoute holds the fields of a route the tests check
+type testRoute struct {
+	metav1.ObjectMeta `json:"metadata"`
+	Status            struct {
+		Ingress []struct {
+			Host       string `json:"host"`
+			RouterName string `json:"routerName"`
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+				Reason string `json:"reason"`
+			} `json:"conditions"`
+		} `json:"ingress"`
+	} `json:"status"`
+}
+
+// fakePodmanPublishing installs a podman running the pod web, which publishes its port http
+// (80) on the host port 8080
+func fakePodmanPublishing(t *testing.T) {
+	testutil.FakeCommand(t, "podman", `
+case "$1" in
+ps) echo '[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running"}]' ;;
+inspect) echo '[]' ;;
+kube) printf 'apiVersion: v1\nkind: Pod\nspec:\n  containers:\n  - name: web\n    image: nginx\n    ports:\n    - name: http\n      containerPort: 80\n      hostPort: 8080\n    - name: metrics\n      containerPort: 9090\n' ;;
+*) exit 1 ;;
+esac
+`)
+}
+
+// createRoute creates a route to a pod and returns its admission condition and host
+func createRoute(t *testing.T, s *server.Server, name, pod, targetPort string) (reason, host string) {
+	body := `{"apiVersion": "route.openshift.io/v1", "kind": "Route", "metadata": {"name": "` + name + `"},
+		"spec": {"to": {"kind": "Service", "name": "` + pod + `"}, "port": {"targetPort": "` + targetPort + `"}}}`
+	recorder := serveRequest(s, http.MethodPost, routesPath, "application/json", "", body)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var r testRoute
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &r))
+	require.Len(t, r.Status.Ingress, 1)
+	ingress := r.Status.Ingress[0]
+	assert.Equal(t, "podkube", ingress.RouterName)
+	require.Len(t, ingress.Conditions, 1)
+	assert.Equal(t, "Admitted", ingress.Conditions[0].Type)
+	if ingress.Conditions[0].Status == "True" {
+		return "", ingress.Host
+	}
+	return ingress.Conditions[0].Reason, ingress.Host
+}
+
+func TestRoutesDisabled(t *testing.T) {
+	fakePodmanPublishing(t)
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/apis/route.openshift.io/v1/routes")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"kind": "RouteList", "apiVersion": "route.openshift.io/v1", "metadata": {}, "items": []}`, recorder.Body.String())
+
+	reason, _ := createRoute(t, s, "web", "web", "http")
+	assert.Equal(t, "RoutesDisabled", reason, "routes should be accepted but not admitted")
+	assert.Equal(t, http.StatusNotFound, getPath(s, routesPath+"/web").Code, "routes should not be stored")
+	assert.Empty(t, getTable(t, s, "/apis/route.openshift.io/v1/routes").Rows)
+}
+
+func TestRoutePortForwards(t *testing.T) {
+	fakePodmanPublishing(t)
+	s := server.New("127.0.0.1", 0)
+	s.SetRoutePortForwards(true)
+
+	reason, host := createRoute(t, s, "web", "web", "http")
+	assert.Empty(t, reason)
+	assert.Equal(t, "127.0.0.1:8080", host, "the route should be admitted at the host port of its target port")
+
+	reason, _ = createRoute(t, s, "metrics", "web", "metrics")
+	assert.Equal(t, "NoHostPort", reason)
+	reason, _ = createRoute(t, s, "missing", "missing", "http")
+	assert.Equal(t, "PodNotFound", reason)
+
+	body := `{"apiVersion": "route.openshift.io/v1", "kind": "Route", "metadata": {"name": "web"}, "spec": {"to": {"name": "web"}}}`
+	assert.Equal(t, http.StatusConflict, serveRequest(s, http.MethodPost, routesPath, "application/json", "", body).Code)
+	body = `{"apiVersion": "route.openshift.io/v1", "kind": "Route", "metadata": {"name": "other"}, "spec": {"to": {"kind": "Deployment", "name": "web"}}}`
+	assert.Equal(t, http.StatusUnprocessableEntity, serveRequest(s, http.MethodPost, routesPath, "application/json", "", body).Code)
+
+	recorder := getPath(s, routesPath+"/web")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var r testRoute
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &r))
+	require.Len(t, r.Status.Ingress, 1)
+	assert.Equal(t, "127.0.0.1:8080", r.Status.Ingress[0].Host)
+
+	table := getTable(t, s, routesPath)
+	require.Len(t, table.Rows, 3)
+	assert.Equal(t, "Host/Port", table.ColumnDefinitions[1].Name)
+	hosts := map[string]interface{}{}
+	for _, row := range table.Rows {
+		hosts[row.Cells[0].(string)] = row.Cells[1]
+	}
+	assert.Equal(t, map[string]interface{}{"metrics": "<none>", "missing": "<none>", "web": "127.0.0.1:8080"}, hosts)
+
+	require.Equal(t, http.StatusOK, serveRequest(s, http.MethodDelete, routesPath+"/web", "", "", "").Code)
+	assert.Equal(t, http.StatusNotFound, getPath(s, routesPath+"/web").Code)
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodDelete, routesPath+"/web", "", "", "").Code)
+}
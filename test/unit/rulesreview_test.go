@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+const rulesReviewPath = "/apis/authorization.k8s.io/v1/selfsubjectrulesreviews"
+
+// reviewRules creates the self subject rules review of a namespace over TLS, with a bearer
+// token when set
+func reviewRules(t *testing.T, s *server.Server, token, namespace string) *authorizationv1.SelfSubjectRulesReview {
+	body := `{"apiVersion": "authorization.k8s.io/v1", "kind": "SelfSubjectRulesReview", "spec": {"namespace": "` + namespace + `"}}`
+	req := httptest.NewRequest(http.MethodPost, rulesReviewPath, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.TLS = &tls.ConnectionState{}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var review authorizationv1.SelfSubjectRulesReview
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &review))
+	return &review
+}
+
+// resourceVerbs returns the verbs the rules of a review allow on a resource of the core group
+func resourceVerbs(review *authorizationv1.SelfSubjectRulesReview, resource string) []string {
+	for _, rule := range review.Status.ResourceRules {
+		for _, name := range rule.Resources {
+			if name == resource && len(rule.APIGroups) == 1 && rule.APIGroups[0] == "" {
+				return rule.Verbs
+			}
+		}
+	}
+	return nil
+}
+
+func TestSelfSubjectRulesReview(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+
+	t.Run("everything allowed", func(t *testing.T) {
+		review := reviewRules(t, s, "", "dev")
+		assert.Equal(t, []authorizationv1.ResourceRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}, review.Status.ResourceRules)
+		assert.Equal(t, []authorizationv1.NonResourceRule{{Verbs: []string{"*"}, NonResourceURLs: []string{"*"}}}, review.Status.NonResourceRules)
+		assert.False(t, review.Status.Incomplete)
+	})
+
+	t.Run("namespace required", func(t *testing.T) {
+		recorder := serveRequest(s, http.MethodPost, rulesReviewPath, "application/json", "", `{"spec": {}}`)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	require.NoError(t, s.SetAuthorization("Node,SimpleRBAC", writeTokenFile(t, authorizationTokens), true))
+
+	t.Run("read-only token", func(t *testing.T) {
+		review := reviewRules(t, s, "viewer-token", "dev")
+		for _, resource := range []string{"pods", "secrets"} {
+			verbs := resourceVerbs(review, resource)
+			assert.Contains(t, verbs, "get", resource)
+			assert.Subset(t, []string{"get", "list", "watch"}, verbs, "%s should only be read", resource)
+		}
+		assert.NotContains(t, review.Status.ResourceRules, authorizationv1.ResourceRule{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}})
+	})
+
+	t.Run("namespaced token", func(t *testing.T) {
+		assert.Contains(t, resourceVerbs(reviewRules(t, s, "dev-token", "dev"), "pods"), "create")
+		assert.Nil(t, resourceVerbs(reviewRules(t, s, "dev-token", "prod"), "pods"), "pods of other namespaces should not be listed")
+		nodeVerbs := resourceVerbs(reviewRules(t, s, "dev-token", "prod"), "nodes")
+		assert.Contains(t, nodeVerbs, "list")
+		assert.Subset(t, []string{"get", "list", "watch"}, nodeVerbs, "nodes should only be read")
+	})
+
+	t.Run("anonymous users review themselves", func(t *testing.T) {
+		review := reviewRules(t, s, "", "dev")
+		require.Len(t, review.Status.ResourceRules, 1, "only the review itself should be allowed")
+		assert.Equal(t, []string{"selfsubjectrulesreviews"}, review.Status.ResourceRules[0].Resources)
+		assert.Empty(t, review.Status.NonResourceRules)
+	})
+}
@@ -0,0 +1,127 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// newExecServer serves the web container of a docker script, such as uiExecScript, over HTTP
+func newExecServer(t *testing.T, script string) (*server.Server, *httptest.Server) {
+	testutil.FakeCommand(t, "docker", script)
+	node, err := storage.NewNode("node", storage.RuntimeDocker, "", "", nil)
+	require.NoError(t, err)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetNodes([]*storage.Node{node}, ""))
+	s.SetCacheTTL(0)
+	httpServer := httptest.NewServer(s.Handler())
+	t.Cleanup(httpServer.Close)
+	return s, httpServer
+}
+
+// dialExec opens a websocket exec session of sh in the web container, with the parameters
+// of extra on top of those of the session
+func dialExec(httpServer *httptest.Server, extra url.Values) (*websocket.Conn, error) {
+	query := url.Values{"container": {"web"}, "stdin": {"true"}, "stdout": {"true"}, "command": {"sh"}}
+	for name, values := range extra {
+		query[name] = values
+	}
+	config, err := websocket.NewConfig(strings.Replace(httpServer.URL, "http:", "ws:", 1)+"/api/v1/namespaces/containers/pods/web/exec?"+query.Encode(), httpServer.URL)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{"v4.channel.k8s.io"}
+	return websocket.DialConfig(config)
+}
+
+// activeSessions returns the sessions listed by /debug/sessions
+func activeSessions(t *testing.T, s *server.Server) []map[string]interface{} {
+	recorder := getPath(s, "/debug/sessions")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var list struct {
+		Sessions []map[string]interface{} `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	return list.Sessions
+}
+
+func TestExecSessions(t *testing.T) {
+	s, httpServer := newExecServer(t, uiExecScript)
+	s.SetMaxExecSessions(1)
+
+	socket, err := dialExec(httpServer, nil)
+	require.NoError(t, err)
+	defer socket.Close()
+	socket.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var sessions []map[string]interface{}
+	require.Eventually(t, func() bool {
+		sessions = activeSessions(t, s)
+		return len(sessions) == 1
+	}, 10*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "web", sessions[0]["pod"])
+	assert.Equal(t, []interface{}{"sh"}, sessions[0]["command"])
+
+	_, err = dialExec(httpServer, nil)
+	assert.Error(t, err, "sessions beyond the limit should be rejected")
+	response, err := http.Post(httpServer.URL+"/api/v1/namespaces/containers/pods/web/exec?command=sh&stdout=true", "", nil)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+
+	recorder := getPath(s, "/metrics")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "podkube_exec_sessions_active 1\n")
+	assert.Contains(t, recorder.Body.String(), "podkube_exec_sessions_max 1\n")
+	assert.Contains(t, recorder.Body.String(), "podkube_exec_sessions_rejected_total 2\n")
+
+	id := sessions[0]["id"].(string)
+	assert.Equal(t, http.StatusNotFound, serveRequest(s, http.MethodDelete, "/debug/sessions/missing", "", "", "").Code)
+	require.Equal(t, http.StatusOK, serveRequest(s, http.MethodDelete, "/debug/sessions/"+id, "", "", "").Code)
+	require.Eventually(t, func() bool {
+		return len(activeSessions(t, s)) == 0
+	}, 10*time.Second, 20*time.Millisecond, "terminated sessions should end")
+	assert.Contains(t, getPath(s, "/metrics").Body.String(), "podkube_exec_sessions_terminated_total 1\n")
+}
+
+func TestExecStreamTimeouts(t *testing.T) {
+	s, httpServer := newExecServer(t, uiExecScript)
+
+	assert.Error(t, s.SetStreamTimeouts(0, time.Hour), "the creation timeout must be positive")
+	assert.Error(t, s.SetStreamTimeouts(time.Second, -time.Second))
+	require.NoError(t, s.SetStreamTimeouts(10*time.Second, 0), "an idle timeout of 0 keeps idle sessions open")
+
+	for _, query := range []string{"streamIdleTimeout=abc", "streamCreationTimeout=-1s", "streamIdleTimeout=0s"} {
+		recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods/web/exec?command=sh&stdout=true&"+query, "", "", "")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, query)
+	}
+
+	// An idle session is closed once its idle timeout expires
+	socket, err := dialExec(httpServer, url.Values{"streamIdleTimeout": {"500ms"}})
+	require.NoError(t, err)
+	defer socket.Close()
+	socket.SetDeadline(time.Now().Add(30 * time.Second))
+	started := time.Now()
+	for {
+		var frame []byte
+		if err := websocket.Message.Receive(socket, &frame); err != nil {
+			break
+		}
+	}
+	assert.Less(t, time.Since(started), 20*time.Second, "the idle session should have been closed")
+	require.Eventually(t, func() bool {
+		return len(activeSessions(t, s)) == 0
+	}, 10*time.Second, 20*time.Millisecond)
+}
@@ -0,0 +1,63 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestShutdownEndsWatchesWithBookmark(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+
+	s := server.New("127.0.0.1", 0)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/namespaces/containers/pods?watch=true&allowWatchBookmarks=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	decoder := json.NewDecoder(resp.Body)
+	for i := 0; i < 2; i++ {
+		var event metav1.WatchEvent
+		require.NoError(t, decoder.Decode(&event))
+		assert.Equal(t, "ADDED", event.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	var event metav1.WatchEvent
+	require.NoError(t, decoder.Decode(&event))
+	assert.Equal(t, "BOOKMARK", event.Type, "the watch should end with a bookmark")
+	assert.ErrorIs(t, decoder.Decode(&event), io.EOF, "the watch should be closed after the bookmark")
+}
+
+func TestShutdownRejectsNewSessions(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+
+	s := server.New("127.0.0.1", 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods/web/log")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("Retry-After"))
+
+	recorder = getPath(s, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "[-]shutdown failed: server is shutting down")
+}
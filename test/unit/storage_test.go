@@ -1,12 +1,15 @@
 package unit
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"podman-k8s-adapter/pkg/storage"
@@ -23,7 +26,7 @@ func TestPodStorageInterface(t *testing.T) {
 		ps := storage.NewPodStorage()
 
 		// Test that List method exists and returns appropriate type
-		podList, err := ps.List("", "", "")
+		podList, err := ps.List(context.Background(), "", "", "")
 		if err != nil {
 			t.Logf("List method error (expected in test environment): %v", err)
 			return
@@ -40,7 +43,42 @@ func TestLabelSelectorMatching(t *testing.T) {
 }
 
 func TestFieldSelectorMatching(t *testing.T) {
-	t.Skip("Field selector matching is tested through integration tests - private method cannot be tested directly")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "team-a"},
+		Spec:       corev1.PodSpec{NodeName: "node-1", RestartPolicy: corev1.RestartPolicyAlways},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.88.0.5"},
+	}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"", true},
+		{"metadata.namespace=team-a", true},
+		{"metadata.namespace==team-b", false},
+		{"metadata.namespace!=team-b,status.phase=Running", true},
+		{"metadata.name=web,status.phase=Pending", false},
+		{"spec.nodeName=node-1,spec.restartPolicy=Always", true},
+		{"spec.hostNetwork=false", true},
+		{"status.podIP=10.88.0.6", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selector, err := storage.ParsePodFieldSelector(tt.selector)
+			require.NoError(t, err)
+			assert.Equal(t, tt.matches, selector.Matches(storage.PodSelectableFields(pod)))
+		})
+	}
+
+	t.Run("Unsupported fields are rejected", func(t *testing.T) {
+		_, err := storage.ParsePodFieldSelector("metadata.labels=app")
+		assert.ErrorContains(t, err, "field label not supported")
+	})
+
+	t.Run("Invalid selectors are rejected", func(t *testing.T) {
+		_, err := storage.ParsePodFieldSelector("status.phase")
+		assert.Error(t, err)
+	})
 }
 
 func TestAnnotationMerging(t *testing.T) {
@@ -80,7 +118,7 @@ func TestPodStorageCRUD(t *testing.T) {
 		// Clean up any existing container
 		defer testutil.CleanupContainers(t, "test-crud-pod")
 
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err, "Should create pod successfully")
 		// Note: Full validation is done in integration tests
 	})
@@ -90,11 +128,11 @@ func TestPodStorageCRUD(t *testing.T) {
 		defer testutil.CleanupContainers(t, "test-crud-pod")
 
 		// First create the pod
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err)
 
 		// Now get it
-		retrievedPod, err := ps.Get("containers", "test-crud-pod")
+		retrievedPod, err := ps.Get(context.Background(), "containers", "test-crud-pod")
 		require.NoError(t, err, "Should retrieve pod successfully")
 		assert.Equal(t, "test-crud-pod", retrievedPod.Name)
 		assert.Equal(t, "containers", retrievedPod.Namespace)
@@ -105,11 +143,11 @@ func TestPodStorageCRUD(t *testing.T) {
 		defer testutil.CleanupContainers(t, "test-crud-pod")
 
 		// Create a test pod
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err)
 
 		// List all pods
-		podList, err := ps.List("", "", "")
+		podList, err := ps.List(context.Background(), "", "", "")
 		require.NoError(t, err, "Should list pods successfully")
 
 		// Find our test pod in the list
@@ -129,11 +167,11 @@ func TestPodStorageCRUD(t *testing.T) {
 		defer testutil.CleanupContainers(t, "test-crud-pod")
 
 		// Create a test pod
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err)
 
 		// List pods with matching label selector
-		podList, err := ps.List("", "app=test", "")
+		podList, err := ps.List(context.Background(), "", "app=test", "")
 		require.NoError(t, err, "Should list pods with label selector")
 
 		// Verify only pods with correct labels are returned
@@ -149,15 +187,15 @@ func TestPodStorageCRUD(t *testing.T) {
 		defer testutil.CleanupContainers(t, "test-crud-pod")
 
 		// First create the pod
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err)
 
 		// Now delete it
-		err = ps.Delete("containers", "test-crud-pod")
+		err = ps.Delete(context.Background(), "containers", "test-crud-pod")
 		require.NoError(t, err, "Should delete pod successfully")
 
 		// Verify it's gone
-		_, err = ps.Get("containers", "test-crud-pod")
+		_, err = ps.Get(context.Background(), "containers", "test-crud-pod")
 		assert.Error(t, err, "Should not find deleted pod")
 	})
 
@@ -166,12 +204,12 @@ func TestPodStorageCRUD(t *testing.T) {
 		wrongNsPod := testPod.DeepCopy()
 		wrongNsPod.Namespace = "wrong-namespace"
 
-		_, err := ps.Create(wrongNsPod)
+		_, err := ps.Create(context.Background(), wrongNsPod)
 		assert.Error(t, err, "Should not allow creating pod in wrong namespace")
 		assert.Contains(t, err.Error(), "containers")
 
 		// Test getting from wrong namespace
-		_, err = ps.Get("wrong-namespace", "test-pod")
+		_, err = ps.Get(context.Background(), "wrong-namespace", "test-pod")
 		assert.Error(t, err, "Should not find pod in wrong namespace")
 	})
 }
@@ -195,13 +233,13 @@ func TestResourceConsistency(t *testing.T) {
 				Name:      "consistency-test",
 				Namespace: "containers",
 				Labels: map[string]string{
-					"app":        "consistency-test",
-					"version":    "v1.0",
-					"component":  "backend",
+					"app":       "consistency-test",
+					"version":   "v1.0",
+					"component": "backend",
 				},
 				Annotations: map[string]string{
 					"deployment.kubernetes.io/revision": "1",
-					"custom.annotation":                  "test-value",
+					"custom.annotation":                 "test-value",
 				},
 			},
 			Spec: corev1.PodSpec{
@@ -224,17 +262,17 @@ func TestResourceConsistency(t *testing.T) {
 		defer testutil.CleanupContainers(t, "consistency-test")
 
 		// Create the pod
-		_, err := ps.Create(testPod)
+		_, err := ps.Create(context.Background(), testPod)
 		require.NoError(t, err, "Should create pod successfully")
 
 		// Wait a moment for container to start
 		testutil.WaitForCondition(t, func() bool {
-			pod, err := ps.Get("containers", "consistency-test")
+			pod, err := ps.Get(context.Background(), "containers", "consistency-test")
 			return err == nil && pod.Status.Phase == corev1.PodRunning
 		}, 10*time.Second, "container should start running")
 
 		// Retrieve the pod and verify consistency
-		retrievedPod, err := ps.Get("containers", "consistency-test")
+		retrievedPod, err := ps.Get(context.Background(), "containers", "consistency-test")
 		require.NoError(t, err, "Should retrieve pod successfully")
 
 		// Verify basic metadata consistency
@@ -260,4 +298,288 @@ func TestResourceConsistency(t *testing.T) {
 		assert.True(t, containerStatus.Ready)
 		assert.Equal(t, corev1.PodRunning, retrievedPod.Status.Phase)
 	})
-}
\ No newline at end of file
+}
+
+// TestReloadWhileListing changes the settings a config reload sets while pods are listed, for
+// go test -race to catch unsynchronized reads of the settings by concurrent requests
+func TestReloadWhileListing(t *testing.T) {
+	testutil.FakeCommand(t, "podman", "echo '[]'\n")
+
+	ps := storage.NewPodStorage()
+	ps.SetCacheTTL(0)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 50; i++ {
+			ps.SetParallelism(i)
+			ps.SetCommandTimeout(time.Duration(i) * time.Second)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		_, err := ps.List(context.Background(), "", "", "")
+		require.NoError(t, err)
+	}
+	wg.Wait()
+}
+
+func TestUnsupportedPodFields(t *testing.T) {
+	t.Run("Supported pod has no unsupported fields", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "supported", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				RestartPolicy:   corev1.RestartPolicyAlways,
+				SecurityContext: &corev1.PodSecurityContext{},
+				Containers: []corev1.Container{
+					{
+						Name:    "main",
+						Image:   "alpine:latest",
+						Command: []string{"sleep", "3600"},
+						Env:     []corev1.EnvVar{{Name: "FOO", Value: "bar"}},
+						Stdin:   true,
+						TTY:     true,
+					},
+				},
+			},
+		}
+		assert.Empty(t, storage.UnsupportedPodFields(pod))
+	})
+
+	t.Run("Seccomp and AppArmor profiles are applied by podman run", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "profiles", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{
+					SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+				},
+				Containers: []corev1.Container{{
+					Name:  "main",
+					Image: "alpine:latest",
+					SecurityContext: &corev1.SecurityContext{
+						AppArmorProfile: &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined},
+					},
+				}},
+			},
+		}
+		assert.Empty(t, storage.UnsupportedPodFields(pod))
+		assert.False(t, storage.RequiresKubePlay(pod))
+
+		pod.Spec.Containers[0].SecurityContext.RunAsUser = new(int64)
+		assert.True(t, storage.RequiresKubePlay(pod), "Other security settings need podman kube play")
+	})
+
+	t.Run("Extended resources are passed by podman run only", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "gpu", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "main",
+					Image: "alpine:latest",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{"nvidia.com/gpu": resource.MustParse("1")},
+					},
+				}},
+			},
+		}
+		assert.Empty(t, storage.UnsupportedPodFields(pod))
+		assert.False(t, storage.RequiresKubePlay(pod))
+
+		pod.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU] = resource.MustParse("1")
+		assert.True(t, storage.RequiresKubePlay(pod))
+		errs := storage.KubePlayUnsupportedPodFields(pod)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "spec.containers[0].resources.limits[nvidia.com/gpu]", errs[0].Field)
+	})
+
+	t.Run("Sysctls and ulimits are set by podman run", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "database",
+				Namespace:   "containers",
+				Annotations: map[string]string{storage.UlimitsAnnotation: "nofile=65536:65536"},
+			},
+			Spec: corev1.PodSpec{
+				SecurityContext: &corev1.PodSecurityContext{
+					Sysctls: []corev1.Sysctl{{Name: "net.core.somaxconn", Value: "1024"}},
+				},
+				Containers: []corev1.Container{{Name: "main", Image: "postgres:16"}},
+			},
+		}
+		assert.Empty(t, storage.UnsupportedPodFields(pod))
+		assert.False(t, storage.RequiresKubePlay(pod))
+
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar", Image: "alpine:latest"})
+		errs := storage.KubePlayUnsupportedPodFields(pod)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "metadata.annotations[podkube.io/ulimits]", errs[0].Field)
+	})
+
+	t.Run("Projected volumes are mounted by podman run", func(t *testing.T) {
+		expiration := int64(3600)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "client", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{{
+					Name: "api",
+					VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{
+							{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", ExpirationSeconds: &expiration}},
+							{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "kube-root-ca.crt"}}},
+						},
+					}},
+				}},
+				Containers: []corev1.Container{{
+					Name:         "main",
+					Image:        "alpine:latest",
+					VolumeMounts: []corev1.VolumeMount{{Name: "api", MountPath: "/var/run/secrets/api"}},
+				}},
+			},
+		}
+		assert.Empty(t, storage.UnsupportedPodFields(pod))
+		assert.False(t, storage.RequiresKubePlay(pod))
+
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: "sidecar", Image: "alpine:latest"})
+		errs := storage.KubePlayUnsupportedPodFields(pod)
+		require.Len(t, errs, 1)
+		assert.Equal(t, "spec.volumes[0]", errs[0].Field)
+	})
+
+	t.Run("Sidecars are played", func(t *testing.T) {
+		always := corev1.ContainerRestartPolicyAlways
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "proxy", Image: "envoyproxy/envoy:v1.31", RestartPolicy: &always}},
+				Containers:     []corev1.Container{{Name: "main", Image: "nginx:latest"}},
+			},
+		}
+		assert.True(t, storage.RequiresKubePlay(pod))
+		assert.Empty(t, storage.KubePlayUnsupportedPodFields(pod))
+	})
+
+	t.Run("Reports every unsupported field", func(t *testing.T) {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "unsupported", Namespace: "containers"},
+			Spec: corev1.PodSpec{
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}},
+				Volumes:  []corev1.Volume{{Name: "data"}},
+				Containers: []corev1.Container{
+					{
+						Name:  "main",
+						Image: "alpine:latest",
+						Args:  []string{"--verbose"},
+						Env: []corev1.EnvVar{{
+							Name:      "TOKEN",
+							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}},
+						}},
+					},
+				},
+			},
+		}
+
+		var fields []string
+		for _, err := range storage.UnsupportedPodFields(pod) {
+			fields = append(fields, err.Field)
+		}
+		assert.ElementsMatch(t, []string{
+			"spec.volumes[0]",
+			"spec.affinity",
+			"spec.containers[0].args",
+			"spec.containers[0].env[0].valueFrom",
+		}, fields)
+	})
+}
+
+func TestExportPod(t *testing.T) {
+	seconds := int64(300)
+	now := metav1.Now()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "web",
+			Namespace:         "containers",
+			UID:               "1234",
+			ResourceVersion:   "42-1",
+			CreationTimestamp: now,
+			DeletionTimestamp: &now,
+			Labels:            map[string]string{"app": "web", "io.podman.annotations.autoremove": "FALSE"},
+			Annotations: map[string]string{
+				"owner":               "alice",
+				"podkube.io/uid":      "1234",
+				"podman.io/host-port": "8080",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+			Finalizers: []string{"example.com/protect"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "vm",
+			Containers: []corev1.Container{{Name: "web", Image: "nginx"}},
+			Tolerations: []corev1.Toleration{
+				{Key: corev1.TaintNodeNotReady, Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute, TolerationSeconds: &seconds},
+				{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "web"},
+			},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.88.0.2"},
+	}
+
+	exported := storage.ExportPod(pod)
+	assert.Equal(t, metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"}, exported.TypeMeta)
+	assert.Equal(t, metav1.ObjectMeta{
+		Name:        "web",
+		Labels:      map[string]string{"app": "web"},
+		Annotations: map[string]string{"owner": "alice"},
+		Finalizers:  []string{"example.com/protect"},
+	}, exported.ObjectMeta, "Only the metadata set by users should be kept")
+	assert.Empty(t, exported.Spec.NodeName)
+	assert.Equal(t, []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "web"}}, exported.Spec.Tolerations)
+	assert.Equal(t, pod.Spec.Containers, exported.Spec.Containers)
+	assert.Equal(t, corev1.PodStatus{}, exported.Status)
+	assert.Equal(t, "vm", pod.Spec.NodeName, "The pod should not be changed")
+}
+
+func TestProjectResourceVersionConflict(t *testing.T) {
+	node, err := storage.NewNode("node", "podman", "", "", nil)
+	require.NoError(t, err)
+	cluster := storage.NewCluster(node)
+
+	project, err := cluster.GetProject("pods")
+	require.NoError(t, err)
+	assert.Equal(t, "1", project.ResourceVersion)
+
+	updated, err := cluster.UpdateProjectAnnotations("pods", project.ResourceVersion, map[string]string{"team": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "2", updated.ResourceVersion)
+	assert.Equal(t, "a", updated.Annotations["team"])
+
+	t.Run("stale resourceVersion conflicts", func(t *testing.T) {
+		_, err := cluster.UpdateProjectAnnotations("pods", project.ResourceVersion, map[string]string{"team": "b"})
+		assert.ErrorIs(t, err, storage.ErrConflict)
+		current, err := cluster.GetProject("pods")
+		require.NoError(t, err)
+		assert.Equal(t, "a", current.Annotations["team"])
+	})
+
+	t.Run("empty resourceVersion updates unconditionally", func(t *testing.T) {
+		updated, err := cluster.UpdateProjectAnnotations("pods", "", map[string]string{"team": "c"})
+		require.NoError(t, err)
+		assert.Equal(t, "3", updated.ResourceVersion)
+	})
+}
+
+func TestProjectLabels(t *testing.T) {
+	node, err := storage.NewNode("node", "podman", "", "", nil)
+	require.NoError(t, err)
+	cluster := storage.NewCluster(node)
+	assert.Empty(t, cluster.NamespaceLabels("pods"))
+
+	labels := map[string]string{"pod-security.kubernetes.io/enforce": "baseline"}
+	updated, err := cluster.UpdateProjectMetadata("pods", "", labels, map[string]string{"team": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, labels, updated.Labels)
+	assert.Equal(t, labels, cluster.NamespaceLabels("pods"))
+
+	updated, err = cluster.UpdateProjectAnnotations("pods", updated.ResourceVersion, map[string]string{"team": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, labels, updated.Labels, "Updating the annotations should keep the labels")
+	assert.Equal(t, "b", updated.Annotations["team"])
+}
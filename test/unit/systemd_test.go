@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/storage"
+)
+
+// systemdContainers is a container run by a Quadlet unit
+const systemdContainers = `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "State": "running", "Labels": {"PODMAN_SYSTEMD_UNIT": "web.service"}}]`
+
+func TestSystemdPodDeletion(t *testing.T) {
+	path := "/api/v1/namespaces/containers/pods/web"
+
+	t.Run("annotated", func(t *testing.T) {
+		fakePodmanNodes(t, map[string]string{"local": systemdContainers})
+		s := server.New("127.0.0.1", 0)
+		assert.Equal(t, "web.service", decodePod(t, getPath(s, path).Body.Bytes()).Annotations[storage.SystemdUnitAnnotation])
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": systemdContainers})
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodDelete, path, "", "", "")
+		require.Equal(t, http.StatusConflict, recorder.Code, recorder.Body.String())
+		assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, "web.service")
+		assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "rm"), "the container should be kept")
+	})
+
+	t.Run("forced", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": systemdContainers})
+		s := server.New("127.0.0.1", 0)
+
+		recorder := serveRequest(s, http.MethodDelete, path+"?gracePeriodSeconds=0", "", "", "")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.NotEmpty(t, podmanCalls(t, filepath.Join(dir, "calls"), "rm"))
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		dir := fakePodmanNodes(t, map[string]string{"local": systemdContainers})
+		s := server.New("127.0.0.1", 0)
+		s.SetAllowSystemdDelete(true)
+
+		recorder := serveRequest(s, http.MethodDelete, path, "", "", "")
+		require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.NotEmpty(t, podmanCalls(t, filepath.Join(dir, "calls"), "rm"))
+	})
+}
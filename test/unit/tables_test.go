@@ -0,0 +1,134 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+const tableAccept = "application/json;as=Table;v=v1;g=meta.k8s.io"
+
+// getTable requests path as a table and decodes it
+func getTable(t *testing.T, s *server.Server, path string) *metav1.Table {
+	recorder := serveRequest(s, http.MethodGet, path, "", tableAccept, "")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var table metav1.Table
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &table))
+	return &table
+}
+
+func TestCustomPodColumns(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetPodColumns("NAME:.metadata.name,PHASE:.status.phase,CONTAINERS:.spec.containers[*].name,PORT:.spec.containers[0].ports"))
+
+	table := getTable(t, s, "/api/v1/namespaces/containers/pods")
+	var names []string
+	for _, column := range table.ColumnDefinitions {
+		names = append(names, column.Name)
+	}
+	assert.Equal(t, []string{"NAME", "PHASE", "CONTAINERS", "PORT"}, names)
+	require.Len(t, table.Rows, 2)
+	assert.ElementsMatch(t, [][]interface{}{
+		{"web", "Running", "generated-aaaaaaaaaaaa0001", "<none>"},
+		{"db", "Running", "generated-bbbbbbbbbbbb0002", "<none>"},
+	}, [][]interface{}{table.Rows[0].Cells, table.Rows[1].Cells})
+
+	require.NoError(t, s.SetPodColumns(""))
+	table = getTable(t, s, "/api/v1/namespaces/containers/pods")
+	assert.Equal(t, "Name", table.ColumnDefinitions[0].Name, "an empty spec should restore the default columns")
+
+	for _, spec := range []string{"NAME", ":.metadata.name", "NAME:metadata.name", "NAME:.spec..name", "NAME:.spec.containers[x]"} {
+		assert.Error(t, s.SetPodColumns(spec), spec)
+	}
+}
+
+func TestTableIncludeObject(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/pods"
+
+	table := getTable(t, s, path)
+	require.NotEmpty(t, table.Rows)
+	assert.Contains(t, string(table.Rows[0].Object.Raw), `"kind":"Pod"`)
+
+	table = getTable(t, s, path+"?includeObject=Metadata")
+	assert.Contains(t, string(table.Rows[0].Object.Raw), `"kind":"PartialObjectMetadata"`)
+	assert.NotContains(t, string(table.Rows[0].Object.Raw), `"spec"`)
+
+	table = getTable(t, s, path+"?includeObject=None")
+	assert.Empty(t, table.Rows[0].Object.Raw)
+
+	recorder := serveRequest(s, http.MethodGet, path+"?includeObject=All", "", tableAccept, "")
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestSecretTable(t *testing.T) {
+	fakePodmanSecrets(t, "db-password")
+	s := server.New("127.0.0.1", 0)
+
+	table := getTable(t, s, "/api/v1/namespaces/containers/secrets")
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, []interface{}{"db-password", "Opaque", "1"}, table.Rows[0].Cells[:3])
+}
+
+func TestPodTableColumns(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+
+	table := getTable(t, s, "/api/v1/namespaces/containers/pods")
+	wide := map[string]bool{}
+	var names []string
+	for _, column := range table.ColumnDefinitions {
+		names = append(names, column.Name)
+		wide[column.Name] = column.Priority > 0
+	}
+	assert.Equal(t, []string{"Name", "Ready", "Status", "Restarts", "Age", "Created", "IP", "Node", "Image", "Command", "Ports", "Container-ID"}, names)
+	assert.False(t, wide["Restarts"], "restarts are shown without -o wide, as by kubectl")
+	assert.True(t, wide["IP"])
+	assert.True(t, wide["Node"])
+	assert.NotContains(t, names, "Labels", "--show-labels reads the labels of the row objects")
+
+	require.NotEmpty(t, table.Rows)
+	pod := decodePod(t, table.Rows[0].Object.Raw)
+	require.NotEmpty(t, pod.Spec.NodeName)
+	assert.Equal(t, "0", table.Rows[0].Cells[3])
+	assert.Equal(t, pod.Spec.NodeName, table.Rows[0].Cells[7])
+}
+
+func TestProjectAndNamespaceTables(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+
+	columns := func(table *metav1.Table) (names []string, wide map[string]bool) {
+		wide = map[string]bool{}
+		for _, column := range table.ColumnDefinitions {
+			names = append(names, column.Name)
+			wide[column.Name] = column.Priority > 0
+		}
+		return names, wide
+	}
+
+	table := getTable(t, s, "/apis/project.openshift.io/v1/projects")
+	names, _ := columns(table)
+	assert.Equal(t, []string{"Name", "Display Name", "Status", "Age", "Pods"}, names)
+	cells := map[interface{}][]interface{}{}
+	for _, row := range table.Rows {
+		cells[row.Cells[0]] = row.Cells
+	}
+	require.Contains(t, cells, "containers")
+	assert.Equal(t, "2", cells["containers"][4], "both containers are pods of the containers project")
+
+	table = getTable(t, s, "/api/v1/namespaces/containers")
+	names, wide := columns(table)
+	assert.Equal(t, []string{"Name", "Status", "Age", "Pods"}, names)
+	assert.True(t, wide["Pods"], "pods are counted in the wide output of namespaces")
+	require.Len(t, table.Rows, 1)
+	assert.Equal(t, "2", table.Rows[0].Cells[3])
+}
@@ -0,0 +1,123 @@
+package unit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// Channels of the v4.channel.k8s.io websocket protocol
+const (
+	wsStdinChannel  = 0
+	wsStdoutChannel = 1
+	wsErrorChannel  = 3
+	wsResizeChannel = 4
+)
+
+// uiExecScript is a docker serving a single running container, web, whose exec sessions
+// echo their input until exit
+const uiExecScript = `
+case "$1" in
+ps) echo e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5 ;;
+inspect) cat <<'JSON'
+[{"Id": "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5", "Name": "/web",
+  "Created": "2024-05-01T10:00:00Z", "State": {"Status": "running", "StartedAt": "2024-05-01T10:00:01Z"},
+  "Config": {"Image": "nginx"}}]
+JSON
+;;
+exec)
+	echo ready
+	while read -r line; do
+		[ "$line" = exit ] && exit 0
+		echo "got $line"
+	done
+	;;
+*) echo '[]' ;;
+esac
+`
+
+func TestUIAssets(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/ui")
+	assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+	assert.Equal(t, "/ui/", recorder.Header().Get("Location"))
+
+	recorder = getPath(s, "/ui/")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, recorder.Body.String(), "app.js")
+
+	recorder = getPath(s, "/ui/app.js")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "podPath(state.pod, 'exec')", "the UI should open its terminal on the exec endpoint")
+	assert.Equal(t, http.StatusOK, getPath(s, "/ui/style.css").Code)
+	assert.Equal(t, http.StatusNotFound, getPath(s, "/ui/missing.js").Code)
+}
+
+// TestUIExec runs an exec session the way the terminal of the web UI opens it: a websocket
+// GET of the exec endpoint with the v4.channel.k8s.io protocol and a TTY
+func TestUIExec(t *testing.T) {
+	_, httpServer := newExecServer(t, uiExecScript)
+
+	// The query of app.js
+	query := url.Values{
+		"container": {"web"},
+		"stdin":     {"true"},
+		"stdout":    {"true"},
+		"tty":       {"true"},
+		"command":   {"/bin/sh", "-c", "command -v bash >/dev/null && exec bash || exec sh"},
+	}
+	config, err := websocket.NewConfig(strings.Replace(httpServer.URL, "http:", "ws:", 1)+"/api/v1/namespaces/containers/pods/web/exec?"+query.Encode(), httpServer.URL)
+	require.NoError(t, err)
+	config.Protocol = []string{"v4.channel.k8s.io"}
+	socket, err := websocket.DialConfig(config)
+	require.NoError(t, err, "the websocket exec request of the UI should be upgraded")
+	defer socket.Close()
+	socket.SetDeadline(time.Now().Add(30 * time.Second))
+
+	// readUntil reads the stdout channel until it has text, and returns the first frame of
+	// another channel, if any
+	var stdout strings.Builder
+	readUntil := func(text string) []byte {
+		for !strings.Contains(stdout.String(), text) {
+			var frame []byte
+			err := websocket.Message.Receive(socket, &frame)
+			if err == io.EOF {
+				return nil
+			}
+			require.NoError(t, err, "stdout so far: %q", stdout.String())
+			if len(frame) == 0 {
+				continue
+			}
+			if frame[0] != wsStdoutChannel {
+				return frame
+			}
+			stdout.Write(frame[1:])
+		}
+		return nil
+	}
+
+	assert.Nil(t, readUntil("ready"))
+	require.NoError(t, websocket.Message.Send(socket, append([]byte{wsStdinChannel}, "hello\r"...)))
+	assert.Nil(t, readUntil("got hello"), "keystrokes should reach the command")
+	require.NoError(t, websocket.Message.Send(socket, append([]byte{wsStdinChannel}, "exit\r"...)))
+
+	frame := readUntil("\x00never")
+	require.NotEmpty(t, frame)
+	require.Equal(t, byte(wsErrorChannel), frame[0])
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(frame[1:], &status))
+	assert.Equal(t, metav1.StatusSuccess, status.Status, "the session should end successfully: %s", status.Message)
+}
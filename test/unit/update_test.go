@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+// putPod sends a pod update built from the current pod
+func putPod(t *testing.T, s *server.Server, change func(pod *corev1.Pod)) (int, []byte) {
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods/web")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	pod := decodePod(t, recorder.Body.Bytes())
+	change(pod)
+	body, err := json.Marshal(pod)
+	require.NoError(t, err)
+	recorder = serveRequest(s, http.MethodPut, "/api/v1/namespaces/containers/pods/web", "application/json", "", string(body))
+	return recorder.Code, recorder.Body.Bytes()
+}
+
+func invalidFields(t *testing.T, body []byte) []string {
+	var status metav1.Status
+	require.NoError(t, json.Unmarshal(body, &status))
+	require.Equal(t, metav1.StatusReasonInvalid, status.Reason)
+	var fields []string
+	for _, cause := range status.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+func TestPodUpdateInPlace(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{
+		"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running"}]`,
+	})
+	s := server.New("127.0.0.1", 0)
+
+	code, body := putPod(t, s, func(pod *corev1.Pod) {
+		pod.Labels = map[string]string{"tier": "frontend"}
+		pod.Annotations["team"] = "a"
+	})
+	require.Equal(t, http.StatusOK, code, string(body))
+	updated := decodePod(t, body)
+	assert.Equal(t, "frontend", updated.Labels["tier"])
+	assert.Equal(t, "a", updated.Annotations["team"])
+
+	pod := decodePod(t, getPath(s, "/api/v1/namespaces/containers/pods/web").Body.Bytes())
+	assert.Equal(t, "frontend", pod.Labels["tier"], "updated labels should be served")
+	assert.Contains(t, pod.Annotations, "podman.io/container-id", "internal annotations should be kept")
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods?labelSelector=tier%3Dfrontend")
+	var podList corev1.PodList
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &podList))
+	assert.Len(t, podList.Items, 1, "label selectors should match updated labels")
+
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "run"), "in-place updates should not recreate the container")
+}
+
+func TestPodUpdateRejected(t *testing.T) {
+	fakePodmanNodes(t, map[string]string{
+		"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running"}]`,
+	})
+	s := server.New("127.0.0.1", 0)
+
+	code, body := putPod(t, s, func(pod *corev1.Pod) {
+		pod.Spec.Hostname = "other"
+		pod.Spec.Containers[0].WorkingDir = "/srv"
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, code, string(body))
+	assert.ElementsMatch(t, []string{"spec.hostname", "spec.containers[0].workingDir"}, invalidFields(t, body))
+
+	code, body = putPod(t, s, func(pod *corev1.Pod) {
+		pod.Spec.Containers[0].Image = "nginx:2"
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, code, string(body))
+	assert.Equal(t, []string{"spec.containers[0].image"}, invalidFields(t, body), "recreating containers should be disabled by default")
+}
+
+func TestPodUpdateRecreates(t *testing.T) {
+	dir := fakePodmanNodes(t, map[string]string{
+		"local": `[{"Id": "aaaaaaaaaaaa0001", "Names": ["web"], "Image": "nginx", "State": "running"}]`,
+	})
+	s := server.New("127.0.0.1", 0)
+	s.SetAllowPodRecreateOnUpdate(true)
+	before := decodePod(t, getPath(s, "/api/v1/namespaces/containers/pods/web").Body.Bytes())
+
+	code, body := serveUpdateDryRun(t, s)
+	require.Equal(t, http.StatusOK, code, string(body))
+	assert.Equal(t, "nginx:2", decodePod(t, body).Spec.Containers[0].Image)
+	assert.Empty(t, podmanCalls(t, filepath.Join(dir, "calls"), "run"), "a dry run should not recreate the container")
+
+	code, body = putPod(t, s, func(pod *corev1.Pod) {
+		pod.Spec.Containers[0].Image = "nginx:2"
+		pod.Spec.Containers[0].Env = []corev1.EnvVar{{Name: "MODE", Value: "prod"}}
+	})
+	require.Equal(t, http.StatusOK, code, string(body))
+
+	calls := filepath.Join(dir, "calls")
+	assert.Equal(t, []string{"rm aaaaaaaaaaaa0001"}, podmanCalls(t, calls, "rm"))
+	runs := podmanCalls(t, calls, "run")
+	require.Len(t, runs, 1)
+	assert.Contains(t, runs[0], "--name web")
+	assert.Contains(t, runs[0], "-e MODE=prod")
+	assert.Contains(t, runs[0], "nginx:2")
+	assert.Contains(t, runs[0], "--annotation podkube.io/uid="+string(before.UID), "the recreated pod should keep its UID")
+}
+
+// serveUpdateDryRun sends a dry run update changing the image of the pod
+func serveUpdateDryRun(t *testing.T, s *server.Server) (int, []byte) {
+	pod := decodePod(t, getPath(s, "/api/v1/namespaces/containers/pods/web").Body.Bytes())
+	pod.Spec.Containers[0].Image = "nginx:2"
+	body, err := json.Marshal(pod)
+	require.NoError(t, err)
+	recorder := serveRequest(s, http.MethodPut, "/api/v1/namespaces/containers/pods/web?dryRun=All", "application/json", "", string(body))
+	return recorder.Code, recorder.Body.Bytes()
+}
@@ -0,0 +1,62 @@
+package unit
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/test/testutil"
+)
+
+// usagePodmanScript is a podman with a running container, web, whose stats calls are
+// recorded in dir/stats
+const usagePodmanScript = `
+case "$1" in
+ps) cat <<'JSON'
+[{"Id": "aaaaaaaaaaaa0001ffff", "Names": ["web"], "Image": "nginx", "State": "running",
+  "Created": 1714557600, "StartedAt": 1714557601}]
+JSON
+;;
+inspect) echo '[]' ;;
+stats)
+	echo "$@" >> %[1]s/stats
+	printf 'aaaaaaaaaaaa\t1.52%%%%\t12.3MB / 1GB\n'
+	;;
+*) exit 1 ;;
+esac
+`
+
+func TestPodUsageAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	testutil.FakeCommand(t, "podman", fmt.Sprintf(usagePodmanScript, dir))
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/api/v1/namespaces/containers/pods/web")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, decodePod(t, recorder.Body.Bytes()).Annotations, "podkube.io/cpu-usage", "usage annotations are off by default")
+
+	s.SetPodUsageAnnotations(true)
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods/web")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	annotations := decodePod(t, recorder.Body.Bytes()).Annotations
+	assert.Equal(t, "1.52%", annotations["podkube.io/cpu-usage"])
+	assert.Equal(t, "12.3MB", annotations["podkube.io/memory-usage"])
+	assert.NotEmpty(t, annotations["podkube.io/usage-sampled-at"])
+
+	recorder = getPath(s, "/api/v1/namespaces/containers/pods")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotContains(t, recorder.Body.String(), "podkube.io/cpu-usage", "listings should not be annotated")
+
+	// A second read within 10s is served from the cached sample
+	require.Equal(t, http.StatusOK, getPath(s, "/api/v1/namespaces/containers/pods/web").Code)
+	stats, err := os.ReadFile(filepath.Join(dir, "stats"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(stats), "\n"), "usage should be sampled once")
+}
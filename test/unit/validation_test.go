@@ -0,0 +1,73 @@
+package unit
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+func TestMetadataValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		metadata   string
+		wantFields []string
+	}{
+		{"valid", `{"name": "web", "labels": {"app.kubernetes.io/name": "web"}, "annotations": {"example.com/owner": "ops"}}`, nil},
+		{"uppercase name", `{"name": "Web"}`, []string{"metadata.name"}},
+		{"invalid label value", `{"name": "web", "labels": {"maintainer": "ops@example.com"}}`, []string{"metadata.labels"}},
+		{"invalid label key", `{"name": "web", "labels": {"-app": "web"}}`, []string{"metadata.labels"}},
+		{"invalid annotation key", `{"name": "web", "annotations": {"example.com/": "ops"}}`, []string{"metadata.annotations"}},
+		{"invalid finalizer", `{"name": "web", "finalizers": ["cleanup up"]}`, []string{"metadata.finalizers"}},
+		{"every error", `{"name": "Web", "labels": {"maintainer": "ops@example.com"}}`, []string{"metadata.name", "metadata.labels"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakePodmanNodes(t, map[string]string{"local": "[]"})
+			s := server.New("127.0.0.1", 0)
+			body := `{"apiVersion": "v1", "kind": "Pod", "metadata": ` + tt.metadata + `,
+				"spec": {"containers": [{"name": "web", "image": "nginx"}]}}`
+			recorder := serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", body)
+			if tt.wantFields == nil {
+				assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+				return
+			}
+			require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+			status := decodeStatus(t, recorder.Body.Bytes())
+			assert.Equal(t, metav1.StatusReasonInvalid, status.Reason)
+			require.NotNil(t, status.Details)
+			assert.Equal(t, "Pod", status.Details.Kind)
+			fields := map[string]bool{}
+			for _, cause := range status.Details.Causes {
+				fields[strings.SplitN(cause.Field, "[", 2)[0]] = true
+			}
+			assert.Len(t, fields, len(tt.wantFields), "every error should be returned at once: %v", status.Details.Causes)
+			for _, field := range tt.wantFields {
+				assert.True(t, fields[field], "%s should be invalid", field)
+			}
+		})
+	}
+}
+
+func TestSecretKeyValidation(t *testing.T) {
+	fakePodmanSecrets(t)
+	s := server.New("127.0.0.1", 0)
+	path := "/api/v1/namespaces/containers/secrets"
+
+	body := `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "api-token"}, "data": {"token/value": "c2VjcmV0"}}`
+	recorder := serveRequest(s, http.MethodPost, path, "application/json", "", body)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+	status := decodeStatus(t, recorder.Body.Bytes())
+	require.NotNil(t, status.Details)
+	require.Len(t, status.Details.Causes, 1)
+	assert.Equal(t, "data[token/value]", status.Details.Causes[0].Field)
+
+	body = `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "api-token"}, "data": {"data": "c2VjcmV0"}}`
+	recorder = serveRequest(s, http.MethodPost, path, "application/json", "", body)
+	assert.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+}
@@ -0,0 +1,32 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apimachineryversion "k8s.io/apimachinery/pkg/version"
+
+	"podman-k8s-adapter/pkg/server"
+	"podman-k8s-adapter/pkg/version"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	s := server.New("127.0.0.1", 0)
+
+	recorder := getPath(s, "/version")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var info apimachineryversion.Info
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+	assert.Equal(t, version.Get(), info)
+	assert.Equal(t, "1", info.Major)
+	assert.Regexp(t, `^v1\.\d+\.\d+-podman-adapter`, info.GitVersion)
+	assert.Equal(t, runtime.Version(), info.GoVersion)
+	assert.Equal(t, runtime.GOOS+"/"+runtime.GOARCH, info.Platform)
+	assert.NotEmpty(t, info.GitCommit, "builds without ldflags should fall back to the VCS information")
+	assert.NotEmpty(t, info.BuildDate)
+	assert.NotEmpty(t, version.Tag())
+}
@@ -0,0 +1,99 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/server"
+)
+
+const watchListQuery = "?watch=true&allowWatchBookmarks=true&resourceVersionMatch=NotOlderThan"
+
+func TestWatchList(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	list := getPath(s, "/api/v1/namespaces/containers/pods")
+	require.Equal(t, http.StatusOK, list.Code)
+	var podList corev1.PodList
+	require.NoError(t, json.Unmarshal(list.Body.Bytes(), &podList))
+
+	resp, err := http.Get(ts.URL + "/api/v1/namespaces/containers/pods" + watchListQuery + "&sendInitialEvents=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	decoder := json.NewDecoder(resp.Body)
+	for i := 0; i < 2; i++ {
+		var event metav1.WatchEvent
+		require.NoError(t, decoder.Decode(&event))
+		assert.Equal(t, "ADDED", event.Type)
+	}
+	var event metav1.WatchEvent
+	require.NoError(t, decoder.Decode(&event))
+	require.Equal(t, "BOOKMARK", event.Type, "the initial events should end with a bookmark")
+	var bookmark corev1.Pod
+	require.NoError(t, json.Unmarshal(event.Object.Raw, &bookmark))
+	assert.Equal(t, "true", bookmark.Annotations[metav1.InitialEventsAnnotationKey])
+	assert.Equal(t, podList.ResourceVersion, bookmark.ResourceVersion, "the bookmark should carry the resourceVersion of the list")
+}
+
+func TestWatchListWithoutInitialEvents(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/v1/namespaces/containers/pods" + watchListQuery + "&sendInitialEvents=false")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, s.Shutdown(ctx))
+
+	var event metav1.WatchEvent
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&event))
+	assert.Equal(t, "BOOKMARK", event.Type, "no pod should be sent before the watch ends")
+	var bookmark corev1.Pod
+	require.NoError(t, json.Unmarshal(event.Object.Raw, &bookmark))
+	assert.Empty(t, bookmark.Annotations)
+}
+
+func TestWatchListOptionsValidation(t *testing.T) {
+	fakePodman(t, fakePodmanContainers, fakePodmanInspect)
+	s := server.New("127.0.0.1", 0)
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{"without bookmarks", "?watch=true&resourceVersionMatch=NotOlderThan&sendInitialEvents=true", http.StatusUnprocessableEntity},
+		{"without resourceVersionMatch", "?watch=true&allowWatchBookmarks=true&sendInitialEvents=true", http.StatusUnprocessableEntity},
+		{"exact resourceVersionMatch", "?watch=true&allowWatchBookmarks=true&resourceVersionMatch=Exact&sendInitialEvents=true", http.StatusUnprocessableEntity},
+		{"resourceVersionMatch alone", "?watch=true&resourceVersionMatch=NotOlderThan", http.StatusUnprocessableEntity},
+		{"invalid sendInitialEvents", watchListQuery + "&sendInitialEvents=maybe", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := getPath(s, "/api/v1/namespaces/containers/pods"+tt.query)
+			assert.Equal(t, tt.wantCode, recorder.Code, recorder.Body.String())
+			if tt.wantCode == http.StatusUnprocessableEntity {
+				assert.Equal(t, metav1.StatusReasonInvalid, decodeStatus(t, recorder.Body.Bytes()).Reason)
+			}
+		})
+	}
+}
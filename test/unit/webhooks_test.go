@@ -0,0 +1,187 @@
+package unit
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"podman-k8s-adapter/pkg/config"
+	"podman-k8s-adapter/pkg/server"
+)
+
+const webhookPodJSON = `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "web"},
+	"spec": {"containers": [{"name": "web", "image": "nginx"}]}}`
+
+// webhookServer serves an AdmissionReview webhook answering with the response respond
+// returns for the request, and returns the config of a validating webhook calling it
+func webhookServer(t *testing.T, respond func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) config.WebhookConfig {
+	webhook := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+		review.Response = respond(review.Request)
+		review.Request = nil
+		json.NewEncoder(w).Encode(&review)
+	}))
+	t.Cleanup(webhook.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: webhook.Certificate().Raw}), 0o600))
+	return config.WebhookConfig{Name: "policy.example.com", Type: "Validating", URL: webhook.URL, CAFile: caFile}
+}
+
+// createWithWebhooks dry runs the creation of webhookPodJSON through the webhooks
+func createWithWebhooks(t *testing.T, webhooks ...config.WebhookConfig) *httptest.ResponseRecorder {
+	fakePodmanNodes(t, map[string]string{"local": "[]"})
+	s := server.New("127.0.0.1", 0)
+	require.NoError(t, s.SetAdmissionWebhooks(webhooks))
+	return serveRequest(s, http.MethodPost, "/api/v1/namespaces/containers/pods?dryRun=All", "application/json", "", webhookPodJSON)
+}
+
+func allowRequest(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true, Warnings: []string{"checked"}}
+}
+
+func TestAdmissionWebhooks(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		var received *admissionv1.AdmissionRequest
+		recorder := createWithWebhooks(t, webhookServer(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			received = request
+			return allowRequest(request)
+		}))
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Contains(t, recorder.Header().Values("Warning"), `299 - "checked"`, "the warnings of the webhook should be returned")
+		require.NotNil(t, received)
+		assert.Len(t, received.UID, 36, "the request should be identified by a UUID")
+		assert.Equal(t, admissionv1.Create, received.Operation)
+		assert.Equal(t, "containers", received.Namespace)
+		assert.Equal(t, "pods", received.Resource.Resource)
+		require.NotNil(t, received.DryRun)
+		assert.True(t, *received.DryRun)
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		recorder := createWithWebhooks(t, webhookServer(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			return &admissionv1.AdmissionResponse{UID: request.UID, Result: &metav1.Status{
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: "images must come from the internal registry",
+			}}
+		}))
+		require.Equal(t, http.StatusForbidden, recorder.Code, recorder.Body.String())
+		assert.Equal(t, `admission webhook "policy.example.com" denied the request: images must come from the internal registry`,
+			decodeStatus(t, recorder.Body.Bytes()).Message)
+	})
+
+	t.Run("denied without explanation", func(t *testing.T) {
+		recorder := createWithWebhooks(t, webhookServer(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			return &admissionv1.AdmissionResponse{UID: request.UID}
+		}))
+		require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, "denied the request without explanation")
+	})
+
+	patch := func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		patchType := admissionv1.PatchTypeJSONPatch
+		return &admissionv1.AdmissionResponse{
+			UID:       request.UID,
+			Allowed:   true,
+			Patch:     []byte(`[{"op":"add","path":"/metadata/labels","value":{"injected":"true"}}]`),
+			PatchType: &patchType,
+		}
+	}
+
+	t.Run("mutating patch", func(t *testing.T) {
+		cfg := webhookServer(t, patch)
+		cfg.Type = "Mutating"
+		recorder := createWithWebhooks(t, cfg)
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Equal(t, map[string]string{"injected": "true"}, decodePod(t, recorder.Body.Bytes()).Labels)
+	})
+
+	t.Run("validating patch", func(t *testing.T) {
+		recorder := createWithWebhooks(t, webhookServer(t, patch))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code, "validating webhooks cannot change pods")
+		assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, `validating webhook "policy.example.com" returned a patch`)
+	})
+
+	t.Run("response to another request", func(t *testing.T) {
+		recorder := createWithWebhooks(t, webhookServer(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			return &admissionv1.AdmissionResponse{UID: "other", Allowed: true}
+		}))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+		assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, `answers request "other"`)
+	})
+
+	t.Run("rules not matching", func(t *testing.T) {
+		cfg := webhookServer(t, func(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+			return &admissionv1.AdmissionResponse{UID: request.UID}
+		})
+		cfg.Rules = []admissionregistrationv1.RuleWithOperations{{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Update},
+			Rule:       admissionregistrationv1.Rule{APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: []string{"pods"}},
+		}}
+		recorder := createWithWebhooks(t, cfg)
+		assert.Equal(t, http.StatusCreated, recorder.Code, "a webhook for updates should not be called on creates")
+	})
+
+	// A webhook whose certificate is not trusted cannot be called
+	tests := []struct {
+		name          string
+		failurePolicy string
+		wantCode      int
+	}{
+		{"default failure policy", "", http.StatusInternalServerError},
+		{"Fail failure policy", "Fail", http.StatusInternalServerError},
+		{"Ignore failure policy", "Ignore", http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := webhookServer(t, allowRequest)
+			cfg.CAFile = ""
+			cfg.FailurePolicy = tt.failurePolicy
+			recorder := createWithWebhooks(t, cfg)
+			require.Equal(t, tt.wantCode, recorder.Code, recorder.Body.String())
+			if tt.wantCode != http.StatusCreated {
+				assert.Contains(t, decodeStatus(t, recorder.Body.Bytes()).Message, `failed calling webhook "policy.example.com"`)
+			}
+		})
+	}
+}
+
+func TestSetAdmissionWebhooks(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.WebhookConfig
+		wantErr string
+	}{
+		{"valid", config.WebhookConfig{Name: "check", Type: "Validating", URL: "https://webhook.example.com/validate"}, ""},
+		{"no name", config.WebhookConfig{Type: "Validating", URL: "https://webhook.example.com"}, "require a name"},
+		{"unknown type", config.WebhookConfig{Name: "check", Type: "Auditing", URL: "https://webhook.example.com"}, "type must be Mutating or Validating"},
+		{"unknown failure policy", config.WebhookConfig{Name: "check", Type: "Mutating", URL: "https://webhook.example.com", FailurePolicy: "Retry"}, "failurePolicy must be Fail or Ignore"},
+		{"plain HTTP", config.WebhookConfig{Name: "check", Type: "Mutating", URL: "http://webhook.example.com"}, "url must be an https:// URL"},
+		{"missing CA file", config.WebhookConfig{Name: "check", Type: "Mutating", URL: "https://webhook.example.com", CAFile: "/nonexistent/ca.crt"}, "failed to read caFile"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := server.New("127.0.0.1", 0).SetAdmissionWebhooks([]config.WebhookConfig{tt.cfg})
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}